@@ -27,11 +27,11 @@ import (
 	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
 	"k8s.io/kubernetes/pkg/scheduler/algorithm/priorities"
 
-	kubesim "github.com/pfnet-research/k8s-cluster-simulator/pkg"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/queue"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/scheduler"
+	kubesim "simulator/pkg"
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
 
-	pb "simulator/pkg/client"
+	_ "simulator/pkg/client"
 )
 
 func main() {
@@ -58,7 +58,8 @@ var rootCmd = &cobra.Command{
 		// 1. Create a KubeSim with a pod queue and a scheduler.
 		queue := queue.NewPriorityQueue()
 		sched := buildScheduler() // see below
-		kubesim := kubesim.NewKubeSimFromConfigPathOrDie(configPath, queue, sched)
+		kubesim := kubesim.NewKubeSimFromConfigPathOrDie(configPath,
+			kubesim.WithQueue(queue), kubesim.WithScheduler(sched), kubesim.WithGlobalLogLevel())
 
 		// 2. Register one or more pod submitters to KubeSim.
 		numOfSubmittingPods := 8
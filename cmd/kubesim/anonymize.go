@@ -0,0 +1,89 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"simulator/pkg/config"
+	"simulator/pkg/trace"
+)
+
+var anonymizeOpts struct {
+	salt          string
+	keepNodeNames bool
+	labels        []string
+	annotations   []string
+	tolerations   []string
+	compression   string
+	maxSize       int
+}
+
+func init() {
+	anonymizeCmd.Flags().StringVar(&anonymizeOpts.salt, "salt", "",
+		"secret mixed into the hashes of names")
+	anonymizeCmd.Flags().BoolVar(&anonymizeOpts.keepNodeNames, "keep-node-names", false,
+		"keep the names of nodes, to replay on the original cluster config")
+	anonymizeCmd.Flags().StringSliceVar(&anonymizeOpts.labels, "keep-label", trace.DefaultLabelAllowlist,
+		"key of pod labels to keep (a trailing * matches a prefix)")
+	anonymizeCmd.Flags().StringSliceVar(&anonymizeOpts.annotations, "keep-annotation",
+		trace.DefaultAnnotationAllowlist, "key of pod annotations to keep (a trailing * matches a prefix)")
+	anonymizeCmd.Flags().StringSliceVar(&anonymizeOpts.tolerations, "keep-toleration",
+		trace.DefaultTolerationAllowlist, "key of pod tolerations to keep (a trailing * matches a prefix)")
+	anonymizeCmd.Flags().StringVar(&anonymizeOpts.compression, "compression", "",
+		"compression of OUT (gzip or zstd)")
+	anonymizeCmd.Flags().IntVar(&anonymizeOpts.maxSize, "max-size", 0,
+		"size in MiB after which OUT is rotated")
+	rootCmd.AddCommand(anonymizeCmd)
+}
+
+var anonymizeCmd = &cobra.Command{
+	Use:   "anonymize TRACE OUT",
+	Short: "Anonymize a trace to share it publicly.",
+	Long: `Anonymize the trace TRACE into OUT, replacing the names of pods, namespaces, and nodes with
+salted hashes, and stripping the pod labels, annotations, and tolerations not allowlisted, the pod
+affinity terms selecting the labels not allowlisted, and the pod fields irrelevant to scheduling.
+The default allowlists keep the labels and annotations used by the simulator, and the tolerations
+of the taints added by Kubernetes.
+Unless --keep-node-names is given, the recorded bindings refer to hashed node names, so OUT is meant
+to be re-scheduled (kubesim run, or kubesim replay --scheduler) on any cluster.`,
+	Args: cobra.ExactArgs(2),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := trace.ReadTrace(args[0])
+		if err != nil {
+			return err
+		}
+
+		rec, err := trace.NewRecorder(
+			args[1], config.BuildFileOptions(anonymizeOpts.compression, anonymizeOpts.maxSize))
+		if err != nil {
+			return err
+		}
+		rec.SetAnonymizer(config.BuildAnonymizer(&config.TraceAnonymizationConfig{
+			Salt:          anonymizeOpts.salt,
+			KeepNodeNames: anonymizeOpts.keepNodeNames,
+			Labels:        anonymizeOpts.labels,
+			Annotations:   anonymizeOpts.annotations,
+			Tolerations:   anonymizeOpts.tolerations,
+		}))
+
+		if err := rec.RecordEntries(entries); err != nil {
+			rec.Close()
+			return err
+		}
+		return rec.Close()
+	},
+}
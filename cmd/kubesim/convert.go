@@ -0,0 +1,98 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/workload"
+)
+
+var convertOpts struct {
+	from     string
+	to       string
+	start    string
+	cpuScale float64
+	memScale string
+}
+
+func init() {
+	formats := strings.Join(workload.FormatNames(), ", ")
+	convertCmd.Flags().StringVar(&convertOpts.from, "from", "", "format of SRC (one of "+formats+")")
+	convertCmd.Flags().StringVar(&convertOpts.to, "to", "", "format of DST (one of "+formats+")")
+	convertCmd.Flags().StringVar(&convertOpts.start, "start", "2019-01-01T00:00:00+09:00",
+		"clock of time 0 in the google, alibaba, and json formats, in RFC3339 format")
+	convertCmd.Flags().Float64Var(&convertOpts.cpuScale, "cpu-scale", 32,
+		"cores of the normalized CPU request 1.0 in the google format")
+	convertCmd.Flags().StringVar(&convertOpts.memScale, "memory-scale", "64Gi",
+		"memory of the normalized request 1.0 in the google format, and of plan_mem 100 in the alibaba format")
+	convertCmd.MarkFlagRequired("from") // nolint
+	convertCmd.MarkFlagRequired("to")   // nolint
+	rootCmd.AddCommand(convertCmd)
+}
+
+var convertCmd = &cobra.Command{
+	Use:   "convert SRC DST",
+	Short: "Convert a workload between formats.",
+	Long: `Convert the workload SRC in the format --from into DST in the format --to.
+The formats are the task_events of the Google trace (google), the batch_task of the Alibaba trace
+(alibaba), a directory of pod manifests annotated with simulator/submit-time (manifests), a JSON
+lines file of pods with their submission seconds, requests, and durations (json), and a trace
+replayable by kubesim run (trace).`,
+	Args: cobra.ExactArgs(2),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := parseWorkloadOptions(convertOpts.start, convertOpts.cpuScale, convertOpts.memScale)
+		if err != nil {
+			return err
+		}
+
+		n, err := workload.Convert(convertOpts.from, args[0], convertOpts.to, args[1], opts)
+		if err != nil {
+			return err
+		}
+
+		log.L.Infof("Converted %d pods", n)
+		return nil
+	},
+}
+
+// parseWorkloadOptions parses the values of the --start, --cpu-scale, and --memory-scale flags.
+func parseWorkloadOptions(start string, cpuScale float64, memScale string) (workload.Options, error) {
+	t, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return workload.Options{}, strongerrors.InvalidArgument(
+			errors.Errorf("invalid --start: %s", err.Error()))
+	}
+	mem, err := resource.ParseQuantity(memScale)
+	if err != nil {
+		return workload.Options{}, strongerrors.InvalidArgument(
+			errors.Errorf("invalid --memory-scale: %s", err.Error()))
+	}
+
+	return workload.Options{
+		Start:       clock.NewClock(t),
+		CPUScale:    cpuScale,
+		MemoryScale: float64(mem.Value()),
+	}, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"simulator/pkg/diff"
+)
+
+var diffOpts struct {
+	hotspotDuration int
+	checkpoints     bool
+}
+
+func init() {
+	diffCmd.Flags().IntVar(&diffOpts.hotspotDuration, "hotspot-duration",
+		int(diff.DefaultHotspotDuration/time.Second),
+		"seconds for which a node must stay saturated to be a hotspot")
+	diffCmd.Flags().BoolVar(&diffOpts.checkpoints, "checkpoints", false,
+		"compare A and B as checkpoint files instead of metrics logs")
+	rootCmd.AddCommand(diffCmd)
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff A B",
+	Short: "Compare the results of two simulations.",
+	Long: `Compare the results of two simulations, given as metrics logs written with the JSON formatter,
+and print the differences in the placements, outcomes of pods, utilization of nodes, and balance
+of the utilization over the nodes as JSON.
+With --checkpoints, A and B are checkpoint files instead, compared by the pods and the utilization
+at their clocks.`,
+	Args: cobra.ExactArgs(2),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := diff.ReadOptions{HotspotDuration: time.Duration(diffOpts.hotspotDuration) * time.Second}
+		read := diff.ReadResultWithOptions
+		if diffOpts.checkpoints {
+			read = diff.ReadCheckpointResult
+		}
+
+		a, err := read(args[0], opts)
+		if err != nil {
+			return err
+		}
+		b, err := read(args[1], opts)
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diff.Compare(a, b))
+	},
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"time"
+
+	"github.com/containerd/containerd/log"
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/config"
+	"simulator/pkg/export"
+)
+
+var exportOpts struct {
+	from        string
+	since       string
+	until       string
+	namespace   string
+	selector    string
+	compression string
+	maxSize     int
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportOpts.from, "from", "metrics",
+		"kind of SRC (metrics for a metrics log written with the JSON formatter, or trace)")
+	exportCmd.Flags().StringVar(&exportOpts.since, "since", "",
+		"first clock to export, in RFC3339 format")
+	exportCmd.Flags().StringVar(&exportOpts.until, "until", "",
+		"last clock to export, in RFC3339 format")
+	exportCmd.Flags().StringVarP(&exportOpts.namespace, "namespace", "n", "",
+		"namespace of the pods to export")
+	exportCmd.Flags().StringVarP(&exportOpts.selector, "selector", "l", "",
+		"label selector of the pods to export (e.g., app=web,tier!=cache)")
+	exportCmd.Flags().StringVar(&exportOpts.compression, "compression", "",
+		"compression of DST (gzip or zstd)")
+	exportCmd.Flags().IntVar(&exportOpts.maxSize, "max-size", 0,
+		"size in MiB after which DST is rotated")
+	rootCmd.AddCommand(exportCmd)
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export SRC DST",
+	Short: "Export a slice of the results of a simulation.",
+	Long: `Export the metrics log or the trace SRC into DST, keeping only the clocks between --since and
+--until and the pods selected by --namespace and --selector.
+The metrics of nodes and the queue are kept as is; only the pods in them are filtered.
+SRC is streamed, so that a slice of a huge run can be inspected without loading all of it.`,
+	Args: cobra.ExactArgs(2),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter := &export.Filter{Namespace: exportOpts.namespace}
+
+		var err error
+		if filter.Since, err = parseClockFlag("since", exportOpts.since); err != nil {
+			return err
+		}
+		if filter.Until, err = parseClockFlag("until", exportOpts.until); err != nil {
+			return err
+		}
+		if exportOpts.selector != "" {
+			if filter.Selector, err = labels.Parse(exportOpts.selector); err != nil {
+				return strongerrors.InvalidArgument(errors.Errorf("invalid --selector: %s", err.Error()))
+			}
+		}
+
+		opts := config.BuildFileOptions(exportOpts.compression, exportOpts.maxSize)
+		var n int
+		switch exportOpts.from {
+		case "metrics":
+			n, err = export.ExportMetrics(args[0], args[1], filter, opts)
+		case "trace":
+			n, err = export.ExportTrace(args[0], args[1], filter, opts)
+		default:
+			return strongerrors.InvalidArgument(errors.Errorf("invalid --from %q", exportOpts.from))
+		}
+		if err != nil {
+			return err
+		}
+
+		log.L.Infof("Exported %d lines", n)
+		return nil
+	},
+}
+
+// parseClockFlag parses the value of the flag in RFC3339 format, or returns nil if empty.
+func parseClockFlag(name, value string) (*clock.Clock, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, strongerrors.InvalidArgument(errors.Errorf("invalid --%s: %s", name, err.Error()))
+	}
+	clk := clock.NewClock(t)
+
+	return &clk, nil
+}
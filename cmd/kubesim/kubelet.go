@@ -0,0 +1,100 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+
+	"github.com/containerd/containerd/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"simulator/pkg/virtualkubelet"
+)
+
+var kubeletOpts struct {
+	kubeconfig string
+	queue      string
+	taint      bool
+	runSeconds int32
+}
+
+func init() {
+	kubeletCmd.Flags().StringVar(&kubeletOpts.kubeconfig, "kubeconfig", "",
+		"kubeconfig of the API server (default: in-cluster config)")
+	kubeletCmd.Flags().StringVar(&kubeletOpts.queue, "queue", "fifo", "pod queue (priority, fifo, or fairshare)")
+	kubeletCmd.Flags().BoolVar(&kubeletOpts.taint, "taint", false,
+		"taint the nodes with "+virtualkubelet.TaintKey+"="+virtualkubelet.ProviderName+":NoSchedule")
+	kubeletCmd.Flags().Int32Var(&kubeletOpts.runSeconds, "run-seconds", 0,
+		"execution time of the pods without resource usage annotations (default: forever)")
+	rootCmd.AddCommand(kubeletCmd)
+}
+
+var kubeletCmd = &cobra.Command{
+	Use:   "kubelet",
+	Short: "Run the simulated nodes as virtual kubelets of a real API server.",
+	Long: `Register the nodes of the cluster given by --config to the API server of --kubeconfig, like
+virtual-kubelet, and run the pods that the real kube-scheduler binds to them, reporting the statuses
+of the pods and the nodes back to the API server.
+KubeSim models the capacity and the lifecycle of the pods, paced to the wall clock, while the
+scheduling, the preemption, and the controllers are those of the real cluster (e.g., a kind
+cluster). The schedulerConfig of the config is not used.
+The nodes are left registered after exit.`,
+	Args: cobra.NoArgs,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		restConfig, err := clientcmd.BuildConfigFromFlags("", kubeletOpts.kubeconfig)
+		if err != nil {
+			return errors.Wrap(err, "error loading kubeconfig")
+		}
+		client, err := kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return err
+		}
+
+		queue, err := buildQueue(kubeletOpts.queue)
+		if err != nil {
+			return err
+		}
+
+		backend := virtualkubelet.NewBackend(client, virtualkubelet.Options{
+			Taint:      kubeletOpts.taint,
+			RunSeconds: kubeletOpts.runSeconds,
+		})
+		kubesim, err := newKubeSim(queue, backend.Scheduler())
+		if err != nil {
+			return err
+		}
+		kubesim.SetRealTime(true)
+
+		ctx := newInterruptableContext()
+		nodes, _ := kubesim.List()
+		if err := backend.Start(ctx, nodes); err != nil {
+			return err
+		}
+		kubesim.AddSubmitter("VirtualKubelet", backend.Submitter())
+
+		log.L.Infof("Running %d virtual kubelets", len(nodes))
+		err = kubesim.Run(ctx)
+		if err == nil || errors.Cause(err) != context.Canceled {
+			return err
+		}
+		log.L.Info("Interrupted")
+
+		return nil
+	},
+}
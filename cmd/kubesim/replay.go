@@ -0,0 +1,83 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/containerd/containerd/log"
+	"github.com/spf13/cobra"
+
+	kubesim "simulator/pkg"
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
+	"simulator/pkg/trace"
+)
+
+var replayOpts struct {
+	scheduler string
+	queue     string
+}
+
+func init() {
+	replayCmd.Flags().StringVar(&replayOpts.scheduler, "scheduler", "",
+		"re-schedule the recorded submissions with this built-in scheduler, instead of replaying the "+
+			"recorded scheduling decisions (one of generic, bin-packing, worst-fit, backfill, config)")
+	replayCmd.Flags().StringVar(&replayOpts.queue, "queue", "priority",
+		"pod queue, which must be the recorded one unless --scheduler is given (priority, fifo, or fairshare)")
+	rootCmd.AddCommand(replayCmd)
+}
+
+var replayCmd = &cobra.Command{
+	Use:   "replay TRACE",
+	Short: "Re-run a trace recorded with the traceFile config field.",
+	Long: `Re-run a trace recorded with the traceFile config field on the cluster given by --config.
+The config must be the same as the recorded one, except for the metrics loggers, so that the new
+metrics can be compared with the original.
+By default, the recorded scheduling decisions are replayed exactly, and so are the node changes
+(e.g., the faults and the scale-ups and scale-downs of the autoscaler) and the pods killed by their
+nodes. With --scheduler, only the recorded submissions and the node changes made by the submitters
+(e.g., the faults) are replayed, and the pods are scheduled by the given scheduler.`,
+	Args: cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		replayer, err := trace.NewReplayerFromFile(args[0])
+		if err != nil {
+			return err
+		}
+
+		sched := replayer.Scheduler()
+		if replayOpts.scheduler != "" {
+			if sched, err = buildScheduler(replayOpts.scheduler); err != nil {
+				return err
+			}
+		}
+
+		queue, err := buildQueue(replayOpts.queue)
+		if err != nil {
+			return err
+		}
+
+		return runReplay(replayer, queue, sched)
+	},
+}
+
+func runReplay(replayer *trace.Replayer, queue queue.PodQueue, sched scheduler.Scheduler) error {
+	kubesim, err := newKubeSim(queue, sched, kubesim.WithReplayer(replayer))
+	if err != nil {
+		return err
+	}
+
+	log.L.Infof("Replaying trace")
+	return runKubeSim(kubesim, "")
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/containerd/containerd/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	kubesim "simulator/pkg"
+	"simulator/pkg/clock"
+	"simulator/pkg/submitter"
+	"simulator/pkg/trace"
+	"simulator/pkg/workload"
+)
+
+var runOpts struct {
+	from        string
+	start       string
+	cpuScale    float64
+	memScale    string
+	scheduler   string
+	queue       string
+	routes      []string
+	resumeFrom  string
+	checkpoint  string
+	fastForward bool
+}
+
+func init() {
+	runCmd.Flags().StringVar(&runOpts.from, "from", "trace",
+		"format of WORKLOAD (one of "+strings.Join(workload.FormatNames(), ", ")+")")
+	runCmd.Flags().StringVar(&runOpts.start, "start", "2019-01-01T00:00:00+09:00",
+		"clock of time 0 in the google, alibaba, and json formats, in RFC3339 format")
+	runCmd.Flags().Float64Var(&runOpts.cpuScale, "cpu-scale", 32,
+		"cores of the normalized CPU request 1.0 in the google format")
+	runCmd.Flags().StringVar(&runOpts.memScale, "memory-scale", "64Gi",
+		"memory of the normalized request 1.0 in the google format, and of plan_mem 100 in the alibaba format")
+	runCmd.Flags().StringVar(&runOpts.scheduler, "scheduler", "generic",
+		"built-in scheduler (one of generic, bin-packing, worst-fit, backfill, or config for the "+
+			"KubeSchedulerConfiguration given by schedulerConfig in the config)")
+	runCmd.Flags().StringVar(&runOpts.queue, "queue", "",
+		"pod queue (priority, fifo, or fairshare; default: queue in the config, or priority)")
+	runCmd.Flags().StringArrayVar(&runOpts.routes, "route", nil,
+		"schedule the pods of a schedulerName by another built-in scheduler with its own queue, as "+
+			"SCHEDULER_NAME=SCHEDULER (e.g., bin-packing-scheduler=bin-packing); can be repeated")
+	runCmd.Flags().StringVar(&runOpts.resumeFrom, "resume-from", "",
+		"resume the simulation from the checkpoint file")
+	runCmd.Flags().StringVar(&runOpts.checkpoint, "checkpoint", "",
+		"save a checkpoint to the file when interrupted (see also checkpointFile in the config)")
+	runCmd.Flags().BoolVar(&runOpts.fastForward, "fast-forward", false,
+		"skip the ticks at which nothing happens (see also fastForward in the config)")
+	rootCmd.AddCommand(runCmd)
+}
+
+var runCmd = &cobra.Command{
+	Use:   "run WORKLOAD",
+	Short: "Run a simulation of a workload with a built-in scheduler.",
+	Long: `Run a simulation of the pods submitted in WORKLOAD, a trace recorded with the traceFile config
+field, on the cluster given by --config, scheduling them with a built-in scheduler.
+With --from, WORKLOAD can also be a workload in another format of kubesim convert, such as the
+task_events of the Google trace or a JSON lines file of pods; the pods are submitted at their
+submission clocks relative to --start.
+With --route, the pods of a schedulerName are scheduled by another built-in scheduler on the same
+nodes, e.g., to compare two policies side by side in a single run.
+A long simulation can be split across sessions: interrupt it with Ctrl-C after giving --checkpoint
+(or let it save checkpoints periodically with checkpointFile and checkpointTick in the config), then
+continue it with --resume-from and a config with the same tick and cluster.`,
+	Args: cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var sub workloadSubmitter
+		opts := []kubesim.Option{}
+		if runOpts.from == "trace" {
+			// The recorded submitters are replayed in place of the generators and the faults of the
+			// config, and skip the submissions consumed before a checkpoint by themselves.
+			replayer, err := trace.NewReplayerFromFile(args[0])
+			if err != nil {
+				return err
+			}
+			opts = append(opts, kubesim.WithReplayer(replayer))
+		} else {
+			var err error
+			if sub, err = buildWorkloadSubmitter(args[0]); err != nil {
+				return err
+			}
+		}
+
+		sched, err := buildScheduler(runOpts.scheduler)
+		if err != nil {
+			return err
+		}
+
+		queue, err := buildQueue(runOpts.queue)
+		if err != nil {
+			return err
+		}
+
+		kubesim, err := newKubeSim(queue, sched, opts...)
+		if err != nil {
+			return err
+		}
+		if err := addRoutedSchedulers(kubesim, runOpts.routes, runOpts.queue); err != nil {
+			return err
+		}
+
+		if runOpts.resumeFrom != "" {
+			ckpt, err := kubesim.RestoreCheckpoint(runOpts.resumeFrom)
+			if err != nil {
+				return err
+			}
+			if sub != nil {
+				sub.SkipUntil(ckpt.ConsumedUntil())
+			}
+		}
+		if sub != nil {
+			kubesim.AddSubmitter("Workload", sub)
+		}
+		if runOpts.fastForward {
+			kubesim.SetFastForward(true)
+		}
+
+		return runKubeSim(kubesim, runOpts.checkpoint)
+	},
+}
+
+// workloadSubmitter is a submitter of a workload that can skip the submissions consumed before a
+// checkpoint.
+type workloadSubmitter interface {
+	submitter.Submitter
+	SkipUntil(clock clock.Clock)
+}
+
+// buildWorkloadSubmitter builds the submitter of the workload at the path in the format --from,
+// other than trace.
+func buildWorkloadSubmitter(path string) (workloadSubmitter, error) {
+	opts, err := parseWorkloadOptions(runOpts.start, runOpts.cpuScale, runOpts.memScale)
+	if err != nil {
+		return nil, err
+	}
+	return workload.NewSubmitterFromFile(runOpts.from, path, opts)
+}
+
+// runKubeSim runs the KubeSim until it finishes or is interrupted.
+// If interrupted, a checkpoint is saved to the path unless it is empty.
+func runKubeSim(kubesim *kubesim.KubeSim, checkpoint string) error {
+	err := kubesim.Run(newInterruptableContext())
+	if err == nil || errors.Cause(err) != context.Canceled {
+		return err
+	}
+
+	log.L.Info("Interrupted")
+	if checkpoint != "" {
+		return kubesim.SaveCheckpoint(checkpoint)
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/priorities"
+
+	kubesim "simulator/pkg"
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
+)
+
+// schedulerNames lists the names of the built-in schedulers accepted by buildScheduler.
+var schedulerNames = []string{"generic", "bin-packing", "worst-fit", "backfill", "config"}
+
+// buildScheduler builds the built-in scheduler with the name.
+// "generic" is a GenericScheduler with preemption, GeneralPredicates, PodToleratesNodeTaints,
+// MatchInterPodAffinity, BalancedResourceAllocation, LeastRequested, NodeAffinityPriority, and
+// InterPodAffinityPriority, as in the example.
+// The other built-in schedulers filter nodes by GeneralPredicates and PodToleratesNodeTaints as well.
+// "config" returns nil, with which KubeSim builds the scheduler from the schedulerConfig of the
+// config.
+func buildScheduler(name string) (scheduler.Scheduler, error) {
+	switch name {
+	case "config":
+		return nil, nil
+	case "generic":
+		sched := scheduler.NewGenericScheduler( /* preemption enabled */ true)
+		sched.AddPredicate("GeneralPredicates", predicates.GeneralPredicates)
+		sched.AddPredicate(predicates.PodToleratesNodeTaintsPred, predicates.PodToleratesNodeTaints)
+		sched.AddPredicate(predicates.MatchInterPodAffinityPred, sched.InterPodAffinityPredicate())
+		sched.AddPrioritizer(priorities.PriorityConfig{
+			Name:   "BalancedResourceAllocation",
+			Map:    priorities.BalancedResourceAllocationMap,
+			Reduce: nil,
+			Weight: 1,
+		})
+		sched.AddPrioritizer(priorities.PriorityConfig{
+			Name:   "LeastRequested",
+			Map:    priorities.LeastRequestedPriorityMap,
+			Reduce: nil,
+			Weight: 1,
+		})
+		sched.AddPrioritizer(priorities.PriorityConfig{
+			Name:   "NodeAffinityPriority",
+			Map:    priorities.CalculateNodeAffinityPriorityMap,
+			Reduce: priorities.CalculateNodeAffinityPriorityReduce,
+			Weight: 1,
+		})
+		sched.AddPrioritizer(sched.InterPodAffinityPrioritizer(1, v1.DefaultHardPodAffinitySymmetricWeight))
+		return &sched, nil
+	case "bin-packing":
+		sched := scheduler.NewBinPackingScheduler()
+		sched.AddPredicate("GeneralPredicates", predicates.GeneralPredicates)
+		sched.AddPredicate(predicates.PodToleratesNodeTaintsPred, predicates.PodToleratesNodeTaints)
+		return &sched, nil
+	case "worst-fit":
+		sched := scheduler.NewWorstFitScheduler()
+		sched.AddPredicate("GeneralPredicates", predicates.GeneralPredicates)
+		sched.AddPredicate(predicates.PodToleratesNodeTaintsPred, predicates.PodToleratesNodeTaints)
+		return &sched, nil
+	case "backfill":
+		sched := scheduler.NewBackfillScheduler(1)
+		sched.AddPredicate("GeneralPredicates", predicates.GeneralPredicates)
+		sched.AddPredicate(predicates.PodToleratesNodeTaintsPred, predicates.PodToleratesNodeTaints)
+		return &sched, nil
+	default:
+		return nil, strongerrors.InvalidArgument(
+			errors.Errorf("scheduler %q is not supported (supported: %v)", name, schedulerNames))
+	}
+}
+
+// buildQueue builds the pod queue with the name, either "priority", "fifo", or "fairshare" (among
+// the namespaces with equal weights), or returns nil for the queue of the config if empty.
+func buildQueue(name string) (queue.PodQueue, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case "priority":
+		return queue.NewPriorityQueue(), nil
+	case "fifo":
+		return queue.NewFIFOQueue(), nil
+	case "fairshare":
+		return queue.NewFairShareQueue("", nil), nil
+	default:
+		return nil, strongerrors.InvalidArgument(errors.Errorf("queue %q is not supported", name))
+	}
+}
+
+// newKubeSim creates a KubeSim from the config given by --config and the other options.
+func newKubeSim(queue queue.PodQueue, sched scheduler.Scheduler, opts ...kubesim.Option) (*kubesim.KubeSim, error) {
+	return kubesim.NewKubeSimFromConfigPath(configPath, append([]kubesim.Option{
+		kubesim.WithQueue(queue), kubesim.WithScheduler(sched), kubesim.WithGlobalLogLevel(),
+	}, opts...)...)
+}
+
+// addRoutedSchedulers adds the built-in schedulers of the routes "SCHEDULER_NAME=SCHEDULER" to the
+// KubeSim, each scheduling the pods of the schedulerName from its own queue of the name.
+func addRoutedSchedulers(k *kubesim.KubeSim, routes []string, queueName string) error {
+	for _, route := range routes {
+		fields := strings.SplitN(route, "=", 2)
+		if len(fields) != 2 || fields[0] == "" {
+			return strongerrors.InvalidArgument(
+				errors.Errorf("invalid --route %q: must be SCHEDULER_NAME=SCHEDULER", route))
+		}
+
+		sched, err := buildScheduler(fields[1])
+		if err != nil {
+			return err
+		}
+		if sched == nil {
+			return strongerrors.InvalidArgument(errors.Errorf("scheduler %q cannot be routed", fields[1]))
+		}
+
+		q, err := buildQueue(queueName)
+		if err != nil {
+			return err
+		}
+		if q == nil {
+			q = queue.NewPriorityQueue()
+		}
+
+		k.AddScheduler(fields[0], sched, q)
+	}
+
+	return nil
+}
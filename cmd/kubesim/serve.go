@@ -0,0 +1,67 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/containerd/containerd/log"
+	"github.com/spf13/cobra"
+
+	"simulator/pkg/grafana"
+)
+
+var serveOpts struct {
+	listen string
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveOpts.listen, "listen", ":3001", "address to listen on")
+	rootCmd.AddCommand(serveCmd)
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve RESULTS_DB",
+	Short: "Serve a results database to Grafana.",
+	Long: `Serve RESULTS_DB, a results database written with the resultsDB config field, through the API of
+the JSON datasource of Grafana, until interrupted.
+Add a JSON datasource with the URL of --listen to Grafana, and set the range of the dashboards to
+the simulated clocks.`,
+	Args: cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		server, err := grafana.NewServer(args[0])
+		if err != nil {
+			return err
+		}
+		defer server.Close()
+
+		httpServer := &http.Server{Addr: serveOpts.listen, Handler: server}
+		ctx := newInterruptableContext()
+		go func() {
+			<-ctx.Done()
+			httpServer.Shutdown(context.Background()) // nolint
+		}()
+
+		log.L.Infof("Serving %s on %s", args[0], serveOpts.listen)
+		if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+			return err
+		}
+
+		log.L.Info("Interrupted")
+		return nil
+	},
+}
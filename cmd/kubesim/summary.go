@@ -0,0 +1,69 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/diff"
+)
+
+var summaryOpts struct {
+	hotspotDuration int
+}
+
+func init() {
+	summaryCmd.Flags().IntVar(&summaryOpts.hotspotDuration, "hotspot-duration",
+		int(diff.DefaultHotspotDuration/time.Second),
+		"seconds for which a node must stay saturated to be a hotspot")
+	rootCmd.AddCommand(summaryCmd)
+}
+
+// summary is the output of the summary command.
+type summary struct {
+	Utilization map[v1.ResourceName]diff.Utilization `json:"utilization"`
+	Balance     map[v1.ResourceName]diff.Balance     `json:"balance"`
+	Hotspots    []diff.Hotspot                       `json:"hotspots"`
+}
+
+var summaryCmd = &cobra.Command{
+	Use:   "summary LOG",
+	Short: "Summarize the results of a simulation.",
+	Long: `Summarize the results of a simulation, given as a metrics log written with the JSON formatter,
+and print the utilization of the cluster, the balance of the utilization over the nodes, and the
+hotspots, i.e., the nodes saturated for at least --hotspot-duration seconds, as JSON.`,
+	Args: cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := diff.ReadOptions{HotspotDuration: time.Duration(summaryOpts.hotspotDuration) * time.Second}
+		result, err := diff.ReadResultWithOptions(args[0], opts)
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(summary{
+			Utilization: result.Utilization[diff.ClusterNode],
+			Balance:     result.Balance,
+			Hotspots:    result.Hotspots,
+		})
+	},
+}
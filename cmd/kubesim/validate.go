@@ -0,0 +1,87 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"simulator/pkg/fidelity"
+	"simulator/pkg/scheduler"
+)
+
+var validateOpts struct {
+	scheduler       string
+	schedulerConfig string
+	minFidelity     float64
+}
+
+func init() {
+	validateCmd.Flags().StringVar(&validateOpts.scheduler, "scheduler", "generic",
+		"built-in scheduler to validate (one of generic, bin-packing, worst-fit, backfill, or config "+
+			"for the KubeSchedulerConfiguration given by --scheduler-config)")
+	validateCmd.Flags().StringVar(&validateOpts.schedulerConfig, "scheduler-config", "",
+		"KubeSchedulerConfiguration file of the scheduler to validate")
+	validateCmd.Flags().Float64Var(&validateOpts.minFidelity, "min-fidelity", 0,
+		"fail if the fraction of the pods placed as expected is below this")
+	rootCmd.AddCommand(validateCmd)
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate SCENARIOS",
+	Short: "Validate the placements of a scheduler against reference scenarios.",
+	Long: `Run the reference scenarios in SCENARIOS, each a cluster and pods with the placements known from
+the upstream kube-scheduler (see example/fidelity-scenarios.yaml), with a scheduler, and print the
+pods placed differently and the fraction of the pods placed as expected as JSON.`,
+	Args: cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scenarios, err := fidelity.ReadScenarios(args[0])
+		if err != nil {
+			return err
+		}
+
+		report, err := fidelity.Validate(newInterruptableContext(), scenarios, newValidatedScheduler)
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+
+		if report.Fidelity < validateOpts.minFidelity {
+			return errors.Errorf("fidelity %.3f is below %.3f", report.Fidelity, validateOpts.minFidelity)
+		}
+		return nil
+	},
+}
+
+// newValidatedScheduler creates a new scheduler given by --scheduler and --scheduler-config.
+func newValidatedScheduler() (scheduler.Scheduler, error) {
+	if validateOpts.scheduler != "config" {
+		return buildScheduler(validateOpts.scheduler)
+	}
+	if validateOpts.schedulerConfig == "" {
+		return nil, strongerrors.InvalidArgument(errors.New("--scheduler config requires --scheduler-config"))
+	}
+	return scheduler.ReadKubeSchedulerConfiguration(validateOpts.schedulerConfig)
+}
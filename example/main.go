@@ -27,9 +27,9 @@ import (
 	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
 	"k8s.io/kubernetes/pkg/scheduler/algorithm/priorities"
 
-	kubesim "github.com/pfnet-research/k8s-cluster-simulator/pkg"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/queue"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/scheduler"
+	kubesim "simulator/pkg"
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
 )
 
 func main() {
@@ -56,7 +56,8 @@ var rootCmd = &cobra.Command{
 		// 1. Create a KubeSim with a pod queue and a scheduler.
 		queue := queue.NewPriorityQueue()
 		sched := buildScheduler() // see below
-		kubesim := kubesim.NewKubeSimFromConfigPathOrDie(configPath, queue, sched)
+		kubesim := kubesim.NewKubeSimFromConfigPathOrDie(configPath,
+			kubesim.WithQueue(queue), kubesim.WithScheduler(sched), kubesim.WithGlobalLogLevel())
 
 		// 2. Register one or more pod submitters to KubeSim.
 		numOfSubmittingPods := 8
@@ -74,7 +75,7 @@ var rootCmd = &cobra.Command{
 	},
 }
 
-func buildScheduler() scheduler.Scheduler {
+func buildScheduler() *scheduler.GenericScheduler {
 	// 1. Create a generic scheduler that mimics a kube-scheduler.
 	sched := scheduler.NewGenericScheduler( /* preemption enabled */ true)
 
@@ -92,6 +93,8 @@ func buildScheduler() scheduler.Scheduler {
 	// 2. Register plugin(s)
 	// Predicate
 	sched.AddPredicate("GeneralPredicates", predicates.GeneralPredicates)
+	sched.AddPredicate(predicates.PodToleratesNodeTaintsPred, predicates.PodToleratesNodeTaints)
+	sched.AddPredicate(predicates.MatchInterPodAffinityPred, sched.InterPodAffinityPredicate())
 	// Prioritizer
 	sched.AddPrioritizer(priorities.PriorityConfig{
 		Name:   "BalancedResourceAllocation",
@@ -105,6 +108,13 @@ func buildScheduler() scheduler.Scheduler {
 		Reduce: nil,
 		Weight: 1,
 	})
+	sched.AddPrioritizer(priorities.PriorityConfig{
+		Name:   "NodeAffinityPriority",
+		Map:    priorities.CalculateNodeAffinityPriorityMap,
+		Reduce: priorities.CalculateNodeAffinityPriorityReduce,
+		Weight: 1,
+	})
+	sched.AddPrioritizer(sched.InterPodAffinityPrioritizer(1, v1.DefaultHardPodAffinitySymmetricWeight))
 
 	return &sched
 }
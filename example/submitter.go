@@ -15,6 +15,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"time"
@@ -24,10 +25,10 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/kubernetes/pkg/scheduler/algorithm"
 
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/clock"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/metrics"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/queue"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/submitter"
+	"simulator/pkg/clock"
+	"simulator/pkg/metrics"
+	"simulator/pkg/queue"
+	"simulator/pkg/submitter"
 )
 
 type mySubmitter struct {
@@ -45,6 +46,7 @@ func newMySubmitter(targetPodsNum int) *mySubmitter {
 }
 
 func (s *mySubmitter) Submit(
+	_ context.Context,
 	clock clock.Clock,
 	_ algorithm.NodeLister,
 	met metrics.Metrics) ([]submitter.Event, error) {
@@ -0,0 +1,162 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package api serves the state of a running simulation through read-only HTTP endpoints, so that
+// dashboards and external analysis tools can observe it live.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"simulator/pkg/metrics"
+)
+
+// Server is an http.Handler serving the metrics of a simulated cluster written last, as a
+// metrics.Writer, through the read-only endpoints:
+//
+//	GET /nodes    the clock and the metrics of the nodes in JSON (see node.Metrics)
+//	GET /pods     the clock and the metrics of the pods in JSON (see pod.Metrics)
+//	GET /queue    the clock and the metrics of the queue in JSON (see queue.Metrics)
+//	GET /metrics  the gauges of the clock, the queue, the nodes, and the pods in the Prometheus
+//	              text format, to be scraped by Prometheus
+//
+// The JSON endpoints respond 503 Service Unavailable until the first metrics are written.
+type Server struct {
+	mu     sync.RWMutex
+	latest metrics.Metrics
+
+	mux  *http.ServeMux
+	http *http.Server
+	// addr is the address on which this Server is listening.
+	addr string
+}
+
+// NewServer creates a new Server with no metrics written.
+func NewServer() *Server {
+	s := &Server{mux: http.NewServeMux()}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&collector{server: s})
+
+	s.mux.HandleFunc("/nodes", s.get(metrics.NodesMetricsKey))
+	s.mux.HandleFunc("/pods", s.get(metrics.PodsMetricsKey))
+	s.mux.HandleFunc("/queue", s.get(metrics.QueueMetricsKey))
+	s.mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	return s
+}
+
+// ServeHTTP implements http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Write implements metrics.Writer interface.
+// The metrics are served until the next ones are written.
+func (s *Server) Write(met *metrics.Metrics) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latest = *met
+	return nil
+}
+
+// Listen serves this Server on the TCP address (e.g., ":8080") in the background until Close.
+// Returns error if failed to listen on the address.
+func (s *Server) Listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrapf(err, "error listening on %s", addr)
+	}
+
+	s.http = &http.Server{Handler: s}
+	s.addr = listener.Addr().String()
+	go func(server *http.Server) {
+		if err := server.Serve(listener); err != http.ErrServerClosed {
+			log.L.Errorf("Error serving API: %s", err.Error())
+		}
+	}(s.http)
+
+	log.L.Infof("API served on %s", s.addr)
+	return nil
+}
+
+// Addr returns the address on which this Server is listening (e.g., with the port chosen for port
+// 0), or empty unless listening.
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// Close stops serving this Server, waiting for the active requests to complete.
+// It does nothing unless Listen has been called.
+func (s *Server) Close() error {
+	if s.http == nil {
+		return nil
+	}
+	err := s.http.Shutdown(context.Background())
+	s.http, s.addr = nil, ""
+
+	return err
+}
+
+// get returns the handler of the GET requests of the metrics of the key.
+func (s *Server) get(key string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		s.mu.RLock()
+		clk, ok := s.latest[metrics.ClockKey]
+		body := map[string]interface{}{metrics.ClockKey: clk, key: s.latest[key]}
+		s.mu.RUnlock()
+		if !ok {
+			http.Error(w, "no metrics written yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(body); err != nil {
+			log.L.Errorf("Error writing response: %s", err.Error())
+		}
+	}
+}
+
+// clock returns the clock of the metrics written last. The second return value is false if no
+// metrics have been written yet.
+func (s *Server) clock() (time.Time, bool) {
+	str, ok := s.latest[metrics.ClockKey].(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, str)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
+
+var _ = metrics.Writer(&Server{})
@@ -0,0 +1,116 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/metrics"
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+)
+
+func get(t *testing.T, handler http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer()
+	assert.Equal(t, http.StatusServiceUnavailable, get(t, s, "/nodes").Code)
+	assert.NotContains(t, get(t, s, "/metrics").Body.String(), "kubesim_")
+
+	clk := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, s.Write(&metrics.Metrics{
+		metrics.ClockKey: clk.ToRFC3339(),
+		metrics.NodesMetricsKey: map[string]node.Metrics{
+			"node-0": {
+				Allocatable:          v1.ResourceList{"cpu": resource.MustParse("4")},
+				RunningPodsNum:       1,
+				TotalResourceRequest: v1.ResourceList{"cpu": resource.MustParse("1500m")},
+				TotalResourceUsage:   v1.ResourceList{"cpu": resource.MustParse("500m")},
+			},
+		},
+		metrics.PodsMetricsKey: map[string]pod.Metrics{
+			"default/pod-0": {Status: pod.Ok, Node: "node-0"},
+		},
+		metrics.QueueMetricsKey: queue.Metrics{PendingPodsNum: 3},
+	}))
+
+	w := get(t, s, "/nodes")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var nodes struct {
+		Clock string
+		Nodes map[string]node.Metrics
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &nodes))
+	assert.Equal(t, "2019-01-01T00:00:00Z", nodes.Clock)
+	assert.Equal(t, int64(1), nodes.Nodes["node-0"].RunningPodsNum)
+
+	var q struct{ Queue queue.Metrics }
+	assert.NoError(t, json.Unmarshal(get(t, s, "/queue").Body.Bytes(), &q))
+	assert.Equal(t, 3, q.Queue.PendingPodsNum)
+	assert.Contains(t, get(t, s, "/pods").Body.String(), `"default/pod-0"`)
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/pods", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	body := get(t, s, "/metrics").Body.String()
+	for _, line := range []string{
+		"kubesim_clock_seconds 1.5463008e+09",
+		"kubesim_pending_pods 3",
+		`kubesim_pods{status="Ok"} 1`,
+		`kubesim_node_running_pods{node="node-0"} 1`,
+		`kubesim_node_allocatable{node="node-0",resource="cpu"} 4`,
+		`kubesim_node_request{node="node-0",resource="cpu"} 1.5`,
+		`kubesim_node_usage{node="node-0",resource="cpu"} 0.5`,
+	} {
+		assert.Contains(t, body, line)
+	}
+}
+
+func TestServerListen(t *testing.T) {
+	s := NewServer()
+	assert.NoError(t, s.Close())
+	assert.Equal(t, "", s.Addr())
+
+	assert.NoError(t, s.Listen("127.0.0.1:0"))
+	resp, err := http.Get("http://" + s.Addr() + "/queue")
+	assert.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "no metrics written yet", strings.TrimSpace(string(body)))
+
+	assert.NoError(t, s.Close())
+	assert.Equal(t, "", s.Addr())
+	assert.Error(t, s.Listen("256.0.0.1:0"))
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"simulator/pkg/metrics"
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+)
+
+// The gauges of the /metrics endpoint.
+// Resource amounts are in their base units (e.g., cores for cpu, and bytes for memory).
+var (
+	clockDesc = prometheus.NewDesc("kubesim_clock_seconds",
+		"Simulated clock of the metrics in Unix seconds.", nil, nil)
+	pendingPodsDesc = prometheus.NewDesc("kubesim_pending_pods",
+		"Number of the pods in the queue.", nil, nil)
+	podsDesc = prometheus.NewDesc("kubesim_pods",
+		"Number of the pods bound to the nodes by status.", []string{"status"}, nil)
+	nodeRunningPodsDesc = prometheus.NewDesc("kubesim_node_running_pods",
+		"Number of the running pods on the node.", []string{"node"}, nil)
+	nodeTerminatingPodsDesc = prometheus.NewDesc("kubesim_node_terminating_pods",
+		"Number of the terminating pods on the node.", []string{"node"}, nil)
+	nodeFailedPodsDesc = prometheus.NewDesc("kubesim_node_failed_pods",
+		"Number of the pods failed to start on the node.", []string{"node"}, nil)
+	nodeAllocatableDesc = prometheus.NewDesc("kubesim_node_allocatable",
+		"Allocatable amount of the resource of the node.", []string{"node", "resource"}, nil)
+	nodeRequestDesc = prometheus.NewDesc("kubesim_node_request",
+		"Total request of the resource by the pods on the node.", []string{"node", "resource"}, nil)
+	nodeUsageDesc = prometheus.NewDesc("kubesim_node_usage",
+		"Total usage of the resource by the pods on the node.", []string{"node", "resource"}, nil)
+)
+
+// collector is a prometheus.Collector of the gauges of the metrics written to a Server last.
+type collector struct {
+	server *Server
+}
+
+// Describe implements prometheus.Collector interface.
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		clockDesc, pendingPodsDesc, podsDesc,
+		nodeRunningPodsDesc, nodeTerminatingPodsDesc, nodeFailedPodsDesc,
+		nodeAllocatableDesc, nodeRequestDesc, nodeUsageDesc,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector interface.
+// Nothing is collected until the first metrics are written.
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	c.server.mu.RLock()
+	defer c.server.mu.RUnlock()
+
+	clk, ok := c.server.clock()
+	if !ok {
+		return
+	}
+	gauge := func(desc *prometheus.Desc, value float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+	}
+	gauge(clockDesc, float64(clk.Unix()))
+
+	if queueMet, ok := c.server.latest[metrics.QueueMetricsKey].(queue.Metrics); ok {
+		gauge(pendingPodsDesc, float64(queueMet.PendingPodsNum))
+	}
+
+	if podsMet, ok := c.server.latest[metrics.PodsMetricsKey].(map[string]pod.Metrics); ok {
+		counts := map[string]int{}
+		for _, met := range podsMet {
+			counts[met.Status.String()]++
+		}
+		for status, count := range counts {
+			gauge(podsDesc, float64(count), status)
+		}
+	}
+
+	if nodesMet, ok := c.server.latest[metrics.NodesMetricsKey].(map[string]node.Metrics); ok {
+		for name, met := range nodesMet {
+			gauge(nodeRunningPodsDesc, float64(met.RunningPodsNum), name)
+			gauge(nodeTerminatingPodsDesc, float64(met.TerminatingPodsNum), name)
+			gauge(nodeFailedPodsDesc, float64(met.FailedPodsNum), name)
+			for rsrc, alloc := range met.Allocatable {
+				gauge(nodeAllocatableDesc, quantityValue(alloc), name, string(rsrc))
+				gauge(nodeRequestDesc, quantityValue(met.TotalResourceRequest[rsrc]), name, string(rsrc))
+				gauge(nodeUsageDesc, quantityValue(met.TotalResourceUsage[rsrc]), name, string(rsrc))
+			}
+		}
+	}
+}
+
+// quantityValue returns the quantity in its base unit (e.g., cores for cpu).
+func quantityValue(q resource.Quantity) float64 {
+	return float64(q.MilliValue()) / 1000
+}
@@ -0,0 +1,542 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package autoscaler simulates a cluster autoscaler, which adds the nodes of node groups for the
+// pending pods that do not fit the cluster, and deletes the underutilized nodes.
+package autoscaler
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/node"
+	"simulator/pkg/submitter"
+	"simulator/pkg/util"
+)
+
+// NodeGroup is a group of nodes of the same template, whose size is kept between MinSize and
+// MaxSize.
+type NodeGroup struct {
+	Name string
+	// Template is the node added to the group, named "<Name>-<index>".
+	Template *v1.Node
+	// Overhead is the resource requests of the system pods on each node of the group, which are not
+	// available to the pending pods.
+	Overhead v1.ResourceList
+	MinSize  int
+	MaxSize  int
+}
+
+// free returns the resources of a new node of the group available to the pending pods.
+func (g *NodeGroup) free() v1.ResourceList {
+	free := g.Template.Status.Allocatable.DeepCopy()
+	subtract(free, g.Overhead)
+	return free
+}
+
+// Defaults of Policy, the defaults of the scale-down of the Kubernetes cluster autoscaler with a
+// tick of 10 seconds.
+const (
+	DefaultScaleDownUtilizationThreshold = 0.5
+	DefaultScaleDownTicks                = 60
+)
+
+// Policy is the policy of scaling the node groups.
+type Policy struct {
+	// ScaleDownUtilizationThreshold is the utilization, the larger ratio of the cpu and memory
+	// requests to the allocatable resources, below which a node is underutilized.
+	ScaleDownUtilizationThreshold float64
+	// ScaleDownTicks is the number of consecutive ticks for which a node must be underutilized to be
+	// deleted.
+	ScaleDownTicks int
+	// ProvisioningDelay is the time from the decision to add a node until it joins the cluster.
+	ProvisioningDelay time.Duration
+}
+
+// GroupMetrics is a metrics of a node group at one point of time.
+type GroupMetrics struct {
+	// Size is the number of the nodes that have joined the cluster.
+	Size int
+	// Provisioning is the number of the nodes that are being provisioned.
+	Provisioning int
+}
+
+// Autoscaler scales the node groups at each tick of the simulation.
+// A scale-up is triggered by the pending pods that would fit on a new node of a group: they are
+// packed into the nodes being provisioned, then into new nodes of the first group they fit, up to
+// its MaxSize.
+// A scale-down deletes one underutilized node of each group per tick, down to its MinSize, unless
+// the same tick scaled up.
+type Autoscaler struct {
+	groups []NodeGroup
+	policy Policy
+
+	// nodes maps the name of each group to the names of its nodes in the cluster.
+	nodes map[string][]string
+	// provisioning are the nodes being provisioned, in the order of their readiness.
+	provisioning []provisioningNode
+	// underutilized maps the name of each node to the number of the consecutive ticks for which it
+	// has been underutilized.
+	underutilized map[string]int
+	// next maps the name of each group to the index of its next node.
+	next map[string]int
+}
+
+type provisioningNode struct {
+	group   *NodeGroup
+	name    string
+	readyAt clock.Clock
+}
+
+// State is the state of an Autoscaler saved in a checkpoint (see Snapshot).
+type State struct {
+	// Nodes maps the name of each group to the names of its nodes in the cluster.
+	Nodes map[string][]string `json:",omitempty"`
+	// Provisioning are the nodes being provisioned, in the order of their readiness.
+	Provisioning []ProvisioningNode `json:",omitempty"`
+	// Underutilized maps the name of each node to the number of the consecutive ticks for which it
+	// has been underutilized.
+	Underutilized map[string]int `json:",omitempty"`
+	// Next maps the name of each group to the index of its next node.
+	Next map[string]int `json:",omitempty"`
+}
+
+// ProvisioningNode is a node being provisioned in a State.
+type ProvisioningNode struct {
+	Group   string
+	Name    string
+	ReadyAt clock.Clock
+}
+
+// NewAutoscaler creates a new Autoscaler of the node groups with the policy.
+// Returns error if a group is invalid or their names are not unique.
+func NewAutoscaler(groups []NodeGroup, policy Policy) (*Autoscaler, error) {
+	names := map[string]bool{}
+	for _, group := range groups {
+		if group.Name == "" {
+			return nil, strongerrors.InvalidArgument(errors.New("node group name must not be empty"))
+		}
+		if names[group.Name] {
+			return nil, strongerrors.InvalidArgument(errors.Errorf("duplicate node group name %q", group.Name))
+		}
+		names[group.Name] = true
+		if group.Template == nil {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("template of node group %s must not be empty", group.Name))
+		}
+		if group.MinSize < 0 || group.MaxSize < group.MinSize {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("invalid size [%d, %d] of node group %s", group.MinSize, group.MaxSize, group.Name))
+		}
+	}
+	if policy.ScaleDownUtilizationThreshold < 0 || policy.ScaleDownTicks < 0 || policy.ProvisioningDelay < 0 {
+		return nil, strongerrors.InvalidArgument(errors.New("autoscaler policy must not be negative"))
+	}
+
+	return &Autoscaler{
+		groups:        groups,
+		policy:        policy,
+		nodes:         map[string][]string{},
+		provisioning:  []provisioningNode{},
+		underutilized: map[string]int{},
+		next:          map[string]int{},
+	}, nil
+}
+
+// Start adds MinSize nodes of each group to the cluster immediately.
+// Returns error if failed to add a node.
+func (a *Autoscaler) Start(cluster submitter.NodeManager) error {
+	for i := range a.groups {
+		group := &a.groups[i]
+		for len(a.nodes[group.Name]) < group.MinSize {
+			if err := a.addNode(cluster, group, a.nodeName(group)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Autoscale adds the nodes that have been provisioned by the clock, then scales the node groups by
+// the pending pods and the utilization of the nodes in the cluster.
+// Returns error if failed to add or delete a node.
+func (a *Autoscaler) Autoscale(
+	clk clock.Clock, pending []*v1.Pod, nodes map[string]*node.Node, cluster submitter.NodeManager,
+) error {
+
+	joined := []provisioningNode{}
+	for len(a.provisioning) > 0 && !clk.Before(a.provisioning[0].readyAt) {
+		p := a.provisioning[0]
+		a.provisioning = a.provisioning[1:]
+		if err := a.addNode(cluster, p.group, p.name); err != nil {
+			return err
+		}
+		joined = append(joined, p)
+	}
+
+	// Forget the nodes deleted by others.
+	for group, names := range a.nodes {
+		kept := names[:0]
+		for _, name := range names {
+			if _, ok := nodes[name]; ok {
+				kept = append(kept, name)
+			} else {
+				delete(a.underutilized, name)
+			}
+		}
+		a.nodes[group] = kept
+	}
+
+	if a.scaleUp(clk, pending, joined) {
+		return nil
+	}
+	return a.scaleDown(clk, nodes, cluster)
+}
+
+// Observe updates the nodes of the groups to the nodes in the cluster named "<Name>-<index>",
+// instead of Autoscale, e.g., while the recorded node changes of a trace are replayed.
+// The nodes being provisioned are forgotten, since the cluster has the nodes that have joined.
+func (a *Autoscaler) Observe(nodes map[string]*node.Node) {
+	for _, group := range a.groups {
+		a.nodes[group.Name] = nil
+	}
+	a.provisioning = a.provisioning[:0]
+
+	for name := range nodes {
+		group, index, ok := a.parseNodeName(name)
+		if !ok {
+			continue
+		}
+		a.nodes[group.Name] = append(a.nodes[group.Name], name)
+		if index >= a.next[group.Name] {
+			a.next[group.Name] = index + 1
+		}
+	}
+	for _, names := range a.nodes {
+		sort.Strings(names)
+	}
+}
+
+// Snapshot returns a copy of the state of this Autoscaler.
+func (a *Autoscaler) Snapshot() *State {
+	state := &State{
+		Nodes:         make(map[string][]string, len(a.nodes)),
+		Provisioning:  make([]ProvisioningNode, 0, len(a.provisioning)),
+		Underutilized: make(map[string]int, len(a.underutilized)),
+		Next:          make(map[string]int, len(a.next)),
+	}
+	for group, names := range a.nodes {
+		state.Nodes[group] = append([]string{}, names...)
+	}
+	for _, p := range a.provisioning {
+		state.Provisioning = append(state.Provisioning, ProvisioningNode{
+			Group: p.group.Name, Name: p.name, ReadyAt: p.readyAt,
+		})
+	}
+	for name, ticks := range a.underutilized {
+		state.Underutilized[name] = ticks
+	}
+	for group, next := range a.next {
+		state.Next[group] = next
+	}
+
+	return state
+}
+
+// Restore restores the state of this Autoscaler from a copy of the state returned by Snapshot.
+// Returns error if the state has a group not in this Autoscaler.
+func (a *Autoscaler) Restore(state *State) error {
+	groups := make(map[string]*NodeGroup, len(a.groups))
+	for i := range a.groups {
+		groups[a.groups[i].Name] = &a.groups[i]
+	}
+	lookup := func(name string) (*NodeGroup, error) {
+		group, ok := groups[name]
+		if !ok {
+			return nil, strongerrors.InvalidArgument(errors.Errorf("no node group named %s", name))
+		}
+		return group, nil
+	}
+
+	nodes := make(map[string][]string, len(state.Nodes))
+	for name, names := range state.Nodes {
+		if _, err := lookup(name); err != nil {
+			return err
+		}
+		nodes[name] = append([]string{}, names...)
+	}
+	provisioning := make([]provisioningNode, 0, len(state.Provisioning))
+	for _, p := range state.Provisioning {
+		group, err := lookup(p.Group)
+		if err != nil {
+			return err
+		}
+		provisioning = append(provisioning, provisioningNode{group: group, name: p.Name, readyAt: p.ReadyAt})
+	}
+	next := make(map[string]int, len(state.Next))
+	for name, index := range state.Next {
+		if _, err := lookup(name); err != nil {
+			return err
+		}
+		next[name] = index
+	}
+
+	a.nodes = nodes
+	a.provisioning = provisioning
+	a.underutilized = make(map[string]int, len(state.Underutilized))
+	for name, ticks := range state.Underutilized {
+		a.underutilized[name] = ticks
+	}
+	a.next = next
+
+	return nil
+}
+
+// GroupOf returns the name of the node group of the node named "<Name>-<index>".
+// The second return value is false if the name is not of a node of the groups.
+func (a *Autoscaler) GroupOf(nodeName string) (string, bool) {
+	group, _, ok := a.parseNodeName(nodeName)
+	if !ok {
+		return "", false
+	}
+	return group.Name, true
+}
+
+// parseNodeName returns the node group and the index of the node named "<Name>-<index>", or false
+// if none.
+func (a *Autoscaler) parseNodeName(nodeName string) (*NodeGroup, int, bool) {
+	sep := strings.LastIndex(nodeName, "-")
+	if sep < 0 {
+		return nil, 0, false
+	}
+	index, err := strconv.Atoi(nodeName[sep+1:])
+	if err != nil {
+		return nil, 0, false
+	}
+	for i := range a.groups {
+		if a.groups[i].Name == nodeName[:sep] {
+			return &a.groups[i], index, true
+		}
+	}
+
+	return nil, 0, false
+}
+
+// Metrics returns the GroupMetrics of each node group.
+func (a *Autoscaler) Metrics() map[string]GroupMetrics {
+	met := make(map[string]GroupMetrics, len(a.groups))
+	for _, group := range a.groups {
+		met[group.Name] = GroupMetrics{Size: len(a.nodes[group.Name])}
+	}
+	for _, p := range a.provisioning {
+		m := met[p.group.Name]
+		m.Provisioning++
+		met[p.group.Name] = m
+	}
+
+	return met
+}
+
+// scaleUp starts provisioning the nodes for the pending pods, which have not been scheduled on the
+// joined nodes yet.
+// Returns whether any node is provisioned.
+func (a *Autoscaler) scaleUp(clk clock.Clock, pending []*v1.Pod, joined []provisioningNode) bool {
+	type bin struct {
+		group *NodeGroup
+		free  v1.ResourceList
+	}
+	bins := make([]*bin, 0, len(joined)+len(a.provisioning))
+	sizes := map[string]int{}
+	for _, group := range a.groups {
+		sizes[group.Name] = len(a.nodes[group.Name])
+	}
+	for _, p := range joined {
+		bins = append(bins, &bin{group: p.group, free: p.group.free()})
+	}
+	for _, p := range a.provisioning {
+		bins = append(bins, &bin{group: p.group, free: p.group.free()})
+		sizes[p.group.Name]++
+	}
+
+	added := 0
+	for _, p := range pending {
+		req := podRequests(p)
+
+		placed := false
+		for _, b := range bins {
+			if fits(p, req, b.group.Template, b.free) {
+				subtract(b.free, req)
+				placed = true
+				break
+			}
+		}
+		if placed {
+			continue
+		}
+
+		for i := range a.groups {
+			group := &a.groups[i]
+			free := group.free()
+			if sizes[group.Name] >= group.MaxSize || !fits(p, req, group.Template, free) {
+				continue
+			}
+
+			b := &bin{group: group, free: free}
+			subtract(b.free, req)
+			bins = append(bins, b)
+			sizes[group.Name]++
+
+			name := a.nodeName(group)
+			a.provisioning = append(a.provisioning, provisioningNode{
+				group:   group,
+				name:    name,
+				readyAt: clk.Add(a.policy.ProvisioningDelay),
+			})
+			added++
+			log.L.Infof("Autoscaler: Node %s of group %s provisioned for pod %s",
+				name, group.Name, util.PodKeyFromNames(p.Namespace, p.Name))
+			break
+		}
+	}
+
+	return added > 0
+}
+
+// scaleDown deletes an underutilized node of each group.
+func (a *Autoscaler) scaleDown(clk clock.Clock, nodes map[string]*node.Node, cluster submitter.NodeManager) error {
+	for _, group := range a.groups {
+		names := a.nodes[group.Name]
+		provisioning := 0
+		for _, p := range a.provisioning {
+			if p.group.Name == group.Name {
+				provisioning++
+			}
+		}
+
+		victim := ""
+		for _, name := range names {
+			if utilization(nodes[name].Metrics(clk)) < a.policy.ScaleDownUtilizationThreshold {
+				a.underutilized[name]++
+			} else {
+				a.underutilized[name] = 0
+			}
+			if victim == "" && a.underutilized[name] >= a.policy.ScaleDownTicks {
+				victim = name
+			}
+		}
+		if victim == "" || len(names)+provisioning <= group.MinSize {
+			continue
+		}
+
+		if err := cluster.DeleteNode(victim); err != nil {
+			return err
+		}
+		delete(a.underutilized, victim)
+		for i, name := range names {
+			if name == victim {
+				a.nodes[group.Name] = append(names[:i], names[i+1:]...)
+				break
+			}
+		}
+		log.L.Infof("Autoscaler: Node %s of group %s deleted", victim, group.Name)
+	}
+
+	return nil
+}
+
+// addNode adds the node of the name of the group to the cluster.
+func (a *Autoscaler) addNode(cluster submitter.NodeManager, group *NodeGroup, name string) error {
+	nodeV1 := group.Template.DeepCopy()
+	nodeV1.Name = name
+	if err := cluster.AddNode(nodeV1); err != nil {
+		return err
+	}
+
+	a.nodes[group.Name] = append(a.nodes[group.Name], name)
+	sort.Strings(a.nodes[group.Name])
+	return nil
+}
+
+// nodeName returns the name of the next node of the group.
+func (a *Autoscaler) nodeName(group *NodeGroup) string {
+	name := fmt.Sprintf("%s-%d", group.Name, a.next[group.Name])
+	a.next[group.Name]++
+	return name
+}
+
+// podRequests returns the resource requests of the pod, including the pods resource.
+func podRequests(p *v1.Pod) v1.ResourceList {
+	req := v1.ResourceList{}
+	for rsrc, q := range util.PodTotalResourceRequests(p) {
+		if !q.IsZero() {
+			req[rsrc] = q
+		}
+	}
+	req[v1.ResourcePods] = *resource.NewQuantity(1, resource.DecimalSI)
+
+	return req
+}
+
+// fits returns whether the pod with the requests fits the free resources of a node of the template,
+// by the resources and the node selector.
+func fits(p *v1.Pod, req v1.ResourceList, template *v1.Node, free v1.ResourceList) bool {
+	if !labels.SelectorFromSet(p.Spec.NodeSelector).Matches(labels.Set(template.Labels)) {
+		return false
+	}
+	if _, ok := free[v1.ResourcePods]; !ok {
+		req = req.DeepCopy()
+		delete(req, v1.ResourcePods)
+	}
+
+	return util.ResourceListGE(free, req)
+}
+
+// subtract subtracts the requests from the free resources.
+func subtract(free, req v1.ResourceList) {
+	for rsrc, q := range req {
+		if f, ok := free[rsrc]; ok {
+			f.Sub(q)
+			free[rsrc] = f
+		}
+	}
+}
+
+// utilization returns the larger ratio of the cpu and memory requests of the node to its allocatable
+// resources.
+func utilization(met node.Metrics) float64 {
+	ratio := 0.0
+	for _, rsrc := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+		alloc, ok := met.Allocatable[rsrc]
+		if !ok || alloc.IsZero() {
+			continue
+		}
+		req := met.TotalResourceRequest[rsrc]
+		ratio = math.Max(ratio, float64(req.MilliValue())/float64(alloc.MilliValue()))
+	}
+
+	return ratio
+}
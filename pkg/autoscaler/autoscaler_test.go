@@ -0,0 +1,144 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package autoscaler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/node"
+)
+
+type fakeCluster struct {
+	nodes map[string]*node.Node
+}
+
+func (c *fakeCluster) AddNode(nodeV1 *v1.Node) error {
+	if _, ok := c.nodes[nodeV1.Name]; ok {
+		return strongerrors.AlreadyExists(errors.Errorf("node %s already exists", nodeV1.Name))
+	}
+	n := node.NewNode(nodeV1.DeepCopy())
+	c.nodes[nodeV1.Name] = &n
+	return nil
+}
+
+func (c *fakeCluster) DeleteNode(name string) error {
+	delete(c.nodes, name)
+	return nil
+}
+
+func newTemplate(labels map[string]string, cpu string) *v1.Node {
+	allocatable := v1.ResourceList{
+		"cpu": resource.MustParse(cpu), "memory": resource.MustParse("4Gi"), "pods": resource.MustParse("10"),
+	}
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Labels: labels},
+		Status:     v1.NodeStatus{Allocatable: allocatable, Capacity: allocatable},
+	}
+}
+
+func newPendingPod(name, cpu string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: v1.PodSpec{Containers: []v1.Container{{
+			Name:      "container",
+			Resources: v1.ResourceRequirements{Requests: v1.ResourceList{"cpu": resource.MustParse(cpu)}},
+		}}},
+	}
+}
+
+func TestAutoscaler(t *testing.T) {
+	t0 := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	a, err := NewAutoscaler([]NodeGroup{
+		{Name: "pool", Template: newTemplate(nil, "2"), MinSize: 1, MaxSize: 3},
+		{Name: "gpu", Template: newTemplate(map[string]string{"gpu": "true"}, "1"), MaxSize: 1},
+	}, Policy{ScaleDownUtilizationThreshold: 0.5, ScaleDownTicks: 2, ProvisioningDelay: 30 * time.Second})
+	assert.NoError(t, err)
+
+	cluster := &fakeCluster{nodes: map[string]*node.Node{}}
+	assert.NoError(t, a.Start(cluster))
+	assert.Equal(t, map[string]GroupMetrics{"gpu": {}, "pool": {Size: 1}}, a.Metrics())
+
+	// Each pod needs its own node, up to the max size of the group; the pods do not fit the other.
+	pending := []*v1.Pod{newPendingPod("pod-0", "1500m"), newPendingPod("pod-1", "1500m"),
+		newPendingPod("pod-2", "1500m")}
+	assert.NoError(t, a.Autoscale(t0, pending, cluster.nodes, cluster))
+	assert.Equal(t, map[string]GroupMetrics{"gpu": {}, "pool": {Size: 1, Provisioning: 2}}, a.Metrics())
+
+	// The nodes being provisioned are counted for the pods still pending.
+	assert.NoError(t, a.Autoscale(t0.Add(10*time.Second), pending, cluster.nodes, cluster))
+	assert.Equal(t, map[string]GroupMetrics{"gpu": {}, "pool": {Size: 1, Provisioning: 2}}, a.Metrics())
+	assert.Len(t, cluster.nodes, 1)
+
+	// The provisioned nodes join, and the underutilized ones are deleted one per tick.
+	assert.NoError(t, a.Autoscale(t0.Add(30*time.Second), nil, cluster.nodes, cluster))
+	assert.Contains(t, cluster.nodes, "pool-1")
+	assert.Contains(t, cluster.nodes, "pool-2")
+	assert.NotContains(t, cluster.nodes, "pool-0")
+	assert.NoError(t, a.Autoscale(t0.Add(40*time.Second), nil, cluster.nodes, cluster))
+	assert.Equal(t, map[string]GroupMetrics{"gpu": {}, "pool": {Size: 1}}, a.Metrics())
+
+	// The min size is kept.
+	assert.NoError(t, a.Autoscale(t0.Add(50*time.Second), nil, cluster.nodes, cluster))
+	assert.Equal(t, map[string]GroupMetrics{"gpu": {}, "pool": {Size: 1}}, a.Metrics())
+
+	// A pod selecting the gpu group scales it, and a pod that fits no group does not.
+	gpuPod := newPendingPod("pod-3", "1")
+	gpuPod.Spec.NodeSelector = map[string]string{"gpu": "true"}
+	assert.NoError(t, a.Autoscale(t0.Add(60*time.Second),
+		[]*v1.Pod{gpuPod, newPendingPod("pod-4", "3")}, cluster.nodes, cluster))
+	assert.Equal(t, map[string]GroupMetrics{"gpu": {Provisioning: 1}, "pool": {Size: 1}}, a.Metrics())
+}
+
+func TestAutoscalerOverhead(t *testing.T) {
+	t0 := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	a, err := NewAutoscaler([]NodeGroup{{
+		Name: "pool", Template: newTemplate(nil, "2"), MaxSize: 3,
+		Overhead: v1.ResourceList{"cpu": resource.MustParse("500m"), "pods": resource.MustParse("1")},
+	}}, Policy{ScaleDownUtilizationThreshold: 0.5, ScaleDownTicks: 2})
+	assert.NoError(t, err)
+	cluster := &fakeCluster{nodes: map[string]*node.Node{}}
+
+	// A pod larger than the template without the system pods fits no new node.
+	pending := []*v1.Pod{newPendingPod("pod-0", "1600m"), newPendingPod("pod-1", "1")}
+	assert.NoError(t, a.Autoscale(t0, pending, cluster.nodes, cluster))
+	assert.Equal(t, map[string]GroupMetrics{"pool": {Provisioning: 1}}, a.Metrics())
+
+	group, ok := a.GroupOf("pool-1")
+	assert.True(t, ok)
+	assert.Equal(t, "pool", group)
+	_, ok = a.GroupOf("node-0")
+	assert.False(t, ok)
+}
+
+func TestNewAutoscaler(t *testing.T) {
+	_, err := NewAutoscaler([]NodeGroup{{Name: "pool", Template: newTemplate(nil, "2"), MinSize: 2, MaxSize: 1}}, Policy{})
+	assert.EqualError(t, err, "invalid size [2, 1] of node group pool")
+	_, err = NewAutoscaler([]NodeGroup{{Name: "pool", MaxSize: 1}}, Policy{})
+	assert.EqualError(t, err, "template of node group pool must not be empty")
+	_, err = NewAutoscaler([]NodeGroup{
+		{Name: "pool", Template: newTemplate(nil, "2"), MaxSize: 1},
+		{Name: "pool", Template: newTemplate(nil, "2"), MaxSize: 1},
+	}, Policy{})
+	assert.EqualError(t, err, `duplicate node group name "pool"`)
+}
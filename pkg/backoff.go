@@ -0,0 +1,123 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubesim
+
+import (
+	"github.com/containerd/containerd/log"
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	podutil "k8s.io/kubernetes/pkg/api/v1/pod"
+
+	"simulator/pkg/config"
+	"simulator/pkg/metrics"
+	"simulator/pkg/queue"
+	"simulator/pkg/util"
+)
+
+// buildUnschedulablePods builds the UnschedulablePods by the backoff config, or returns nil if the
+// backoff is disabled.
+// Returns error if the config is invalid or the pod queue does not implement queue.Lister.
+func buildUnschedulablePods(conf *config.Config, podQueue queue.PodQueue) (*queue.UnschedulablePods, error) {
+	policy, err := config.BuildBackoff(conf.Backoff)
+	if err != nil || policy == nil {
+		return nil, err
+	}
+	if _, ok := podQueue.(queue.Lister); !ok {
+		return nil, strongerrors.InvalidArgument(
+			errors.New("backoff requires a queue implementing queue.Lister"))
+	}
+
+	return queue.NewUnschedulablePods(*policy), nil
+}
+
+// reactivatePods pushes the pods whose backoffs have expired back to the queue.
+func (k *KubeSim) reactivatePods() error {
+	if k.unschedulable == nil {
+		return nil
+	}
+
+	for _, pod := range k.unschedulable.Reactivate(k.clock) {
+		if err := k.pendingPods.Push(pod); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// backOffPods moves the pods in the queue that the scheduler failed to schedule at the current
+// clock, i.e., whose PodScheduled condition was probed false then, out of the queue for their
+// backoffs, and gives up those failing more than the max retries, marking them Failed.
+// Returns the events of the pods given up.
+func (k *KubeSim) backOffPods() ([]metrics.Event, error) {
+	if k.unschedulable == nil {
+		return nil, nil
+	}
+
+	events := []metrics.Event{}
+	now := k.clock.ToMetaV1()
+	for _, pod := range k.pendingPods.(queue.Lister).List() {
+		_, cond := podutil.GetPodCondition(&pod.Status, v1.PodScheduled)
+		if cond == nil || cond.Status != v1.ConditionFalse || !cond.LastProbeTime.Equal(&now) {
+			continue
+		}
+
+		k.pendingPods.Delete(pod.Namespace, pod.Name)
+		added, err := k.unschedulable.Add(pod, k.clock)
+		if err != nil {
+			return nil, err
+		}
+		if !added {
+			k.releaseQuota(util.PodKeyFromNames(pod.Namespace, pod.Name))
+			pod.Status.Phase = v1.PodFailed
+			pod.Status.Reason = "SchedulingFailed"
+			pod.Status.Message = "the scheduler failed to schedule the pod more than the max retries"
+			log.L.Debugf("Pod %s failed to be scheduled more than the max retries",
+				util.PodKeyFromNames(pod.Namespace, pod.Name))
+			events = append(events, metrics.Event{
+				Clock: k.clock.ToRFC3339(),
+				Kind:  metrics.SchedulingFailedEvent,
+				Pod:   util.PodKeyFromNames(pod.Namespace, pod.Name),
+			})
+		}
+	}
+
+	return events, nil
+}
+
+// deleteUnschedulable deletes the pod from the pods held for their backoffs.
+// Returns true if the pod is found, or false otherwise.
+func (k *KubeSim) deleteUnschedulable(podNamespace, podName string) bool {
+	return k.unschedulable != nil && k.unschedulable.Delete(podNamespace, podName)
+}
+
+// observeClusterChange notifies the held pods of the events that may make them schedulable, i.e.,
+// the addition, recovery, or degradation of a node, or the termination of a pod.
+func (k *KubeSim) observeClusterChange(events []metrics.Event) {
+	if k.unschedulable == nil {
+		return
+	}
+
+	for _, e := range events {
+		switch e.Kind {
+		case metrics.NodeAddEvent, metrics.NodeReadyEvent, metrics.NodeDegradeEvent, metrics.CompleteEvent,
+			metrics.DeleteEvent, metrics.EvictEvent, metrics.PressureEvictEvent, metrics.NodeEvictEvent,
+			metrics.TaintEvictEvent, metrics.OOMKillEvent:
+			k.unschedulable.ClusterChanged(k.clock)
+			return
+		}
+	}
+}
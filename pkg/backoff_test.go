@@ -0,0 +1,125 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubesim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+
+	"simulator/pkg/config"
+	"simulator/pkg/metrics"
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
+)
+
+func TestKubeSimBackoff(t *testing.T) {
+	conf := newCheckpointConfig(10)
+	conf.Backoff = &config.BackoffConfig{MaxRetries: 2}
+	sched := scheduler.NewGenericScheduler(false)
+	sched.AddPredicate(predicates.PodFitsResourcesPred, predicates.PodFitsResources)
+
+	k, err := NewKubeSim(WithConfig(conf), WithScheduler(&sched), WithQueue(queue.NewFIFOQueue()))
+	assert.NoError(t, err)
+	t0 := k.clock
+
+	events := []metrics.Event{}
+	k.AddEventHandler(func(e metrics.Event) error {
+		if e.Kind != metrics.SubmitEvent {
+			events = append(events, e)
+		}
+		return nil
+	})
+	// The large pod never fits in the node of 2 cpus, and does not block the small one.
+	large := newCheckpointPod("large")
+	large.Spec.Containers[0].Resources.Requests["cpu"] = resource.MustParse("3")
+	k.AddSubmitter("Staged", &stagedSubmitter{stages: [][]*v1.Pod{
+		{large, newCheckpointPod("small")},
+	}})
+	assert.NoError(t, k.Run(context.Background()))
+
+	// The large pod is re-activated after the timeout of 60s, then after its backoff of 2s once the
+	// small pod completes, and given up at its third failure.
+	str := func(d time.Duration) string { return t0.Add(d).ToRFC3339() }
+	assert.Equal(t, []metrics.Event{
+		{Clock: str(0), Kind: metrics.UnschedulableEvent, Pod: "default/large"},
+		{Clock: str(10 * time.Second), Kind: metrics.BindEvent, Pod: "default/small", Node: "node-0"},
+		{Clock: str(70 * time.Second), Kind: metrics.CompleteEvent, Pod: "default/small", Node: "node-0"},
+		{Clock: str(80 * time.Second), Kind: metrics.SchedulingFailedEvent, Pod: "default/large"},
+	}, events)
+	assert.Equal(t, v1.PodFailed, large.Status.Phase)
+	assert.Equal(t, queue.BackoffMetrics{UnschedulablePodsNum: 0, FailedPodsNum: 1}, k.unschedulable.Metrics())
+}
+
+func TestKubeSimBackoffSnapshot(t *testing.T) {
+	conf := newCheckpointConfig(10)
+	conf.Backoff = &config.BackoffConfig{MaxRetries: 2}
+	newKubeSim := func(state *SimState) *KubeSim {
+		sched := scheduler.NewGenericScheduler(false)
+		sched.AddPredicate(predicates.PodFitsResourcesPred, predicates.PodFitsResources)
+		opts := []Option{WithConfig(conf), WithScheduler(&sched), WithQueue(queue.NewFIFOQueue())}
+		if state == nil {
+			k, err := NewKubeSim(opts...)
+			assert.NoError(t, err)
+			return k
+		}
+		k, err := NewKubeSimFromSnapshot(state, opts...)
+		assert.NoError(t, err)
+		return k
+	}
+
+	k := newKubeSim(nil)
+	t0 := k.clock
+	large := newCheckpointPod("large")
+	large.Spec.Containers[0].Resources.Requests["cpu"] = resource.MustParse("3")
+	k.AddSubmitter("Staged", &stagedSubmitter{stages: [][]*v1.Pod{
+		{large, newCheckpointPod("small")},
+	}})
+	assert.NoError(t, k.RunUntil(context.Background(), ClockReaches(t0.Add(30*time.Second))))
+	state, err := k.Snapshot()
+	assert.NoError(t, err)
+	assert.Len(t, state.PendingPods, 0)
+	assert.Len(t, state.Backoff.Pods, 1)
+	assert.Equal(t, map[string]int{"default/large": 1}, state.Backoff.Attempts)
+
+	// The resumed simulation keeps the backoff of the large pod, and gives it up as the
+	// uninterrupted one does (see TestKubeSimBackoff).
+	resumed := newKubeSim(state)
+	events := []metrics.Event{}
+	resumed.AddEventHandler(func(e metrics.Event) error {
+		events = append(events, e)
+		return nil
+	})
+	resumed.AddSubmitter("Staged", &stagedSubmitter{})
+	assert.NoError(t, resumed.Run(context.Background()))
+
+	str := func(d time.Duration) string { return t0.Add(d).ToRFC3339() }
+	assert.Equal(t, []metrics.Event{
+		{Clock: str(70 * time.Second), Kind: metrics.CompleteEvent, Pod: "default/small", Node: "node-0"},
+		{Clock: str(80 * time.Second), Kind: metrics.SchedulingFailedEvent, Pod: "default/large"},
+	}, events)
+	assert.Equal(t, queue.BackoffMetrics{UnschedulablePodsNum: 0, FailedPodsNum: 1}, resumed.unschedulable.Metrics())
+
+	// The backoff is not configured.
+	sched := scheduler.NewGenericScheduler(false)
+	other, err := NewKubeSimFromSnapshot(state, WithConfig(newCheckpointConfig(10)), WithScheduler(&sched))
+	assert.Nil(t, other)
+	assert.EqualError(t, err, "config is incompatible with the checkpoint: no backoff")
+}
@@ -0,0 +1,523 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubesim
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/autoscaler"
+	"simulator/pkg/clock"
+	"simulator/pkg/metrics"
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
+	"simulator/pkg/submitter"
+	"simulator/pkg/util"
+)
+
+// defaultCheckpointTick is the interval of checkpoints in seconds if checkpointFile is configured
+// without checkpointTick.
+const defaultCheckpointTick = 3600
+
+// Checkpoint is the state of a KubeSim between ticks, from which the simulation can be resumed.
+// The state of the scheduler is not included, nor are the states of the submitters not
+// implementing submitter.Snapshotter; the pods held by the scheduler (see scheduler.Holder) are
+// saved as pending pods, while the pods held for their backoffs are saved with their backoffs.
+// The nodes are saved as they are at the checkpoint, e.g., added, deleted, tainted, or degraded
+// during the simulation.
+type Checkpoint struct {
+	// Clock is the clock of the tick from which the simulation resumes.
+	Clock clock.Clock
+	Tick  time.Duration
+	// MetricsClock is the clock at which the metrics were written last.
+	MetricsClock    clock.Clock
+	ActiveScheduler string
+
+	// Nodes maps the name of each node in the cluster to the node.
+	Nodes map[string]CheckpointNode
+	// Pods are the pods bound to the nodes and not garbage-collected yet.
+	Pods []CheckpointPod
+	// PendingPods are the pods in the queue, in the order to push them back (see queue.Lister),
+	// followed by the pods held by the schedulers (see scheduler.Holder).
+	PendingPods []*v1.Pod
+	// Backoff is the state of the backoff, e.g., the pods held for their backoffs and the failures
+	// of the pods, or nil if disabled.
+	Backoff   *queue.BackoffState `json:",omitempty"`
+	Deadlines metrics.DeadlineMetrics
+	// WatchedDeadlines maps the key of each pod that has neither met nor missed its deadline yet to
+	// the deadline.
+	WatchedDeadlines map[string]metrics.WatchedDeadline `json:",omitempty"`
+	// MemoryPressure maps the name of each node under the node-pressure eviction to the clock at
+	// which it observed memory pressure last.
+	MemoryPressure map[string]clock.Clock `json:",omitempty"`
+	// Images maps the name of each node having pulled images to the images, including the ones
+	// seeded by the config.
+	Images map[string][]v1.ContainerImage `json:",omitempty"`
+	// ImagePulls maps the name of each node pulling images to the images being pulled, mapped to
+	// the clocks at which the pulls complete.
+	ImagePulls map[string]map[string]clock.Clock `json:",omitempty"`
+	// SubmittedPods is the number of the pods submitted by the submitters (see
+	// RunState.SubmittedPods).
+	SubmittedPods int `json:",omitempty"`
+	// Submitters maps the name of each submitter implementing submitter.Snapshotter to its state.
+	Submitters map[string]json.RawMessage `json:",omitempty"`
+	// Autoscaler is the state of the autoscaler, or nil if disabled.
+	Autoscaler *autoscaler.State `json:",omitempty"`
+}
+
+// CheckpointNode is a node in a Checkpoint.
+type CheckpointNode struct {
+	// Node is the node with its spec (e.g., taints) and status (e.g., conditions, and capacity and
+	// allocatable resources, degraded if Undegraded is not nil).
+	Node *v1.Node
+	// Undegraded is the capacity and the allocatable resources of the node before its degradation,
+	// or nil if not degraded (see KubeSim.DegradeNode).
+	Undegraded *v1.NodeStatus `json:",omitempty"`
+	// SystemPods are the system pods on the node, which are added to the restored node again.
+	SystemPods []*v1.Pod `json:",omitempty"`
+}
+
+// SimState is the state of a KubeSim returned by Snapshot, the same as the one saved in a
+// checkpoint file.
+type SimState = Checkpoint
+
+// CheckpointPod is a pod bound to a node in a Checkpoint.
+type CheckpointPod struct {
+	Pod     *v1.Pod
+	Node    string
+	BoundAt clock.Clock
+	Status  pod.Status
+	// StartupLatency is the latency from the binding to the start of the execution.
+	StartupLatency time.Duration `json:",omitempty"`
+}
+
+// ConsumedUntil returns the last clock simulated before the checkpoint.
+// The events a submitter or a scheduler switch scheduled at or before it have been consumed.
+func (c *Checkpoint) ConsumedUntil() clock.Clock {
+	return c.Clock.Add(-c.Tick)
+}
+
+// ReadCheckpoint reads the gzipped checkpoint file at the path.
+func ReadCheckpoint(path string) (*Checkpoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading checkpoint %s", path)
+	}
+	defer reader.Close()
+
+	var ckpt Checkpoint
+	if err := json.NewDecoder(reader).Decode(&ckpt); err != nil {
+		return nil, strongerrors.InvalidArgument(
+			errors.Errorf("invalid checkpoint %s: %s", path, err.Error()))
+	}
+
+	return &ckpt, nil
+}
+
+// SaveCheckpoint writes the current state of this KubeSim to a gzipped checkpoint file at the path.
+// It must not be called while Run is executing a tick; Run calls it periodically if checkpointFile
+// is configured, and the state after Run returns (e.g., interrupted by ctx) can be saved as well.
+// The state is taken by Snapshot.
+func (k *KubeSim) SaveCheckpoint(path string) error {
+	ckpt, err := k.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	writer := gzip.NewWriter(file)
+	if err := json.NewEncoder(writer).Encode(ckpt); err != nil {
+		file.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		file.Close()
+		return err
+	}
+
+	log.L.Infof("Checkpoint saved to %s at %s", path, k.clock.ToRFC3339())
+	return file.Close()
+}
+
+// Snapshot returns the current state of this KubeSim, which can be inspected or serialized in JSON,
+// and from which the simulation can be resumed or branched with NewKubeSimFromSnapshot (e.g., to
+// run what-if experiments from an intermediate state).
+// The state is a copy, not affected by the simulation continuing after it, and taking it does not
+// affect the simulation either.
+// It must not be called while Run is executing a tick.
+// The pods held by the schedulers are saved as pending pods after the ones in the queue.
+// Returns error if the queue does not implement queue.Lister, or a scheduler implements
+// scheduler.Drainer but not scheduler.Holder.
+func (k *KubeSim) Snapshot() (*SimState, error) {
+	lister, ok := k.pendingPods.(queue.Lister)
+	if !ok {
+		return nil, strongerrors.InvalidArgument(errors.New("snapshot requires a queue implementing queue.Lister"))
+	}
+	held := []*v1.Pod{}
+	for _, sq := range k.schedulerQueues() {
+		if holder, ok := sq.scheduler.(scheduler.Holder); ok {
+			held = append(held, holder.Held()...)
+		} else if _, ok := sq.scheduler.(scheduler.Drainer); ok {
+			return nil, strongerrors.InvalidArgument(
+				errors.New("snapshot requires a scheduler implementing scheduler.Drainer to implement scheduler.Holder"))
+		}
+	}
+
+	ckpt := &Checkpoint{
+		Clock:            k.clock,
+		Tick:             k.tick,
+		MetricsClock:     k.metricsClock,
+		Nodes:            make(map[string]CheckpointNode, len(k.nodes)),
+		Pods:             []CheckpointPod{},
+		PendingPods:      []*v1.Pod{},
+		Deadlines:        k.deadlines.Recorded(),
+		WatchedDeadlines: k.deadlines.Watched(),
+		SubmittedPods:    k.submittedPods,
+	}
+	ckpt.ActiveScheduler, _ = k.switcher.activeName()
+	if k.autoscaler != nil {
+		ckpt.Autoscaler = k.autoscaler.Snapshot()
+	}
+	if k.unschedulable != nil {
+		ckpt.Backoff = k.unschedulable.Snapshot()
+	}
+
+	names := make([]string, 0, len(k.nodes))
+	for name := range k.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		node := k.nodes[name]
+		ckptNode := CheckpointNode{Node: node.ToV1().DeepCopy(), Undegraded: node.Undegraded()}
+		if at, ok := node.MemoryPressureAt(); ok {
+			if ckpt.MemoryPressure == nil {
+				ckpt.MemoryPressure = map[string]clock.Clock{}
+			}
+			ckpt.MemoryPressure[name] = at
+		}
+		if images := node.Images(k.clock); len(images) > 0 {
+			if ckpt.Images == nil {
+				ckpt.Images = map[string][]v1.ContainerImage{}
+			}
+			ckpt.Images[name] = copyImages(images)
+		}
+		if pulls := node.ImagePulls(); len(pulls) > 0 {
+			if ckpt.ImagePulls == nil {
+				ckpt.ImagePulls = map[string]map[string]clock.Clock{}
+			}
+			ckpt.ImagePulls[name] = pulls
+		}
+
+		pods := node.PodList()
+		sort.Slice(pods, func(i, j int) bool {
+			return util.PodKeyFromNames(pods[i].ToV1().Namespace, pods[i].ToV1().Name) <
+				util.PodKeyFromNames(pods[j].ToV1().Namespace, pods[j].ToV1().Name)
+		})
+		for _, pod := range pods {
+			if node.IsSystemPod(pod.ToV1().Namespace, pod.ToV1().Name) {
+				ckptNode.SystemPods = append(ckptNode.SystemPods, pod.ToV1().DeepCopy())
+				continue
+			}
+			met := pod.Metrics(k.clock)
+			ckpt.Pods = append(ckpt.Pods, CheckpointPod{
+				Pod:     pod.ToV1().DeepCopy(),
+				Node:    name,
+				BoundAt: met.BoundAt,
+				Status:  met.Status,
+
+				StartupLatency: pod.StartupLatency(),
+			})
+		}
+		ckpt.Nodes[name] = ckptNode
+	}
+
+	if err := k.snapshotSubmitters(ckpt); err != nil {
+		return nil, err
+	}
+
+	for _, pod := range append(lister.List(), held...) {
+		ckpt.PendingPods = append(ckpt.PendingPods, pod.DeepCopy())
+	}
+
+	return ckpt, nil
+}
+
+// snapshotSubmitters saves the states of the submitters implementing submitter.Snapshotter in the
+// checkpoint.
+func (k *KubeSim) snapshotSubmitters(ckpt *Checkpoint) error {
+	for name, sub := range k.submitters {
+		snapshotter, ok := sub.(submitter.Snapshotter)
+		if !ok {
+			continue
+		}
+		state, err := snapshotter.Snapshot()
+		if err != nil {
+			return errors.Wrapf(err, "error saving the state of submitter %s", name)
+		}
+		if ckpt.Submitters == nil {
+			ckpt.Submitters = map[string]json.RawMessage{}
+		}
+		ckpt.Submitters[name] = state
+	}
+
+	return nil
+}
+
+// NewKubeSimFromSnapshot creates a new KubeSim configured with the options, and restores the state
+// into it, so that Run resumes the simulation from the state.
+// The config must be compatible with the state, as for RestoreCheckpoint; the submitters whose
+// states are in the snapshot must be added with WithSubmitter.
+// The same state can be restored into as many KubeSims as needed, e.g., to branch the simulation
+// with different schedulers.
+// Returns error if the configuration failed or the config is incompatible.
+func NewKubeSimFromSnapshot(state *SimState, opts ...Option) (*KubeSim, error) {
+	k, err := NewKubeSim(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := k.restore(state); err != nil {
+		return nil, err
+	}
+
+	log.L.Infof("Snapshot restored at %s", k.clock.ToRFC3339())
+	return k, nil
+}
+
+// RestoreCheckpoint restores the state of this KubeSim from the checkpoint file at the path, so that
+// Run resumes the simulation from the checkpoint.
+// This KubeSim must be newly created from a config compatible with the checkpoint, i.e., with the
+// same tick. The nodes are restored from the checkpoint in place of the ones of the config, with the
+// node-level settings of the config (e.g., overcommit and usage noise), as AddNode does.
+// The simulation resumes with the scheduler active at the checkpoint, and the scheduler switches
+// after it.
+// The submitters must be added in the state of the checkpoint, e.g., skipping the events until
+// Checkpoint.ConsumedUntil(), except for the generators in the config and the trace given by
+// WithReplayer, which are skipped here, and the submitters implementing submitter.Snapshotter,
+// whose states are restored here.
+// Returns the checkpoint, or error if failed to read it or the config is incompatible.
+func (k *KubeSim) RestoreCheckpoint(path string) (*Checkpoint, error) {
+	ckpt, err := ReadCheckpoint(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := k.restore(ckpt); err != nil {
+		return nil, err
+	}
+
+	log.L.Infof("Checkpoint restored from %s at %s", path, k.clock.ToRFC3339())
+	return ckpt, nil
+}
+
+// restore restores the state of this KubeSim from a copy of the checkpoint.
+func (k *KubeSim) restore(ckpt *Checkpoint) error {
+	if err := k.validateCheckpoint(ckpt); err != nil {
+		return err
+	}
+
+	if ckpt.Autoscaler != nil {
+		if err := k.autoscaler.Restore(ckpt.Autoscaler); err != nil {
+			return errors.Wrap(err, "config is incompatible with the checkpoint")
+		}
+	}
+	nodes := make(map[string]*node.Node, len(ckpt.Nodes))
+	for name, n := range ckpt.Nodes {
+		systemPods := make([]*v1.Pod, 0, len(n.SystemPods))
+		for _, pod := range n.SystemPods {
+			systemPods = append(systemPods, pod.DeepCopy())
+		}
+		nodeV1 := n.Node.DeepCopy()
+		nodeSim, err := newNode(k.conf, nodeV1, systemPods, k.clock)
+		if err != nil {
+			return err
+		}
+		var undegraded *v1.NodeStatus
+		if n.Undegraded != nil {
+			undegraded = n.Undegraded.DeepCopy()
+		}
+		nodeSim.RestoreResources(nodeV1.Status.Capacity.DeepCopy(), nodeV1.Status.Allocatable.DeepCopy(), undegraded)
+		nodes[name] = nodeSim
+	}
+	k.nodes = nodes
+
+	for _, p := range ckpt.Pods {
+		simPod, err := pod.NewPod(p.Pod.DeepCopy(), p.BoundAt, p.Status, p.Node)
+		if err != nil {
+			return err
+		}
+		simPod.SetStartupLatency(p.StartupLatency)
+		if err := k.nodes[p.Node].RestorePod(simPod); err != nil {
+			return err
+		}
+
+		key, err := util.PodKey(p.Pod)
+		if err != nil {
+			return err
+		}
+		k.boundPods[key] = simPod
+	}
+
+	for name, at := range ckpt.MemoryPressure {
+		k.nodes[name].RestoreMemoryPressure(at, ckpt.Clock)
+	}
+	for name, images := range ckpt.Images {
+		k.nodes[name].RestoreImages(copyImages(images))
+	}
+	for name, pulls := range ckpt.ImagePulls {
+		k.nodes[name].RestoreImagePulls(pulls)
+	}
+
+	for _, pod := range ckpt.PendingPods {
+		pod = pod.DeepCopy()
+		if err := k.pendingPods.Push(pod); err != nil {
+			return err
+		}
+		k.chargeQuotaFor(pod)
+		if pod.Status.NominatedNodeName != "" {
+			if err := k.pendingPods.UpdateNominatedNode(pod, pod.Status.NominatedNodeName); err != nil {
+				return err
+			}
+		}
+	}
+	if ckpt.Backoff != nil {
+		if err := k.unschedulable.Restore(ckpt.Backoff); err != nil {
+			return err
+		}
+		for _, pod := range k.unschedulable.List() {
+			k.chargeQuotaFor(pod)
+		}
+	}
+
+	k.clock = ckpt.Clock
+	k.metricsClock = ckpt.MetricsClock
+	k.checkpointClock = ckpt.Clock
+	k.submittedPods = ckpt.SubmittedPods
+	queueName := k.deadlines.Recorded().Queue
+	k.deadlines = metrics.NewDeadlineTracker(ckpt.Deadlines, ckpt.WatchedDeadlines)
+	k.deadlines.SetQueue(queueName)
+	k.switcher.restore(ckpt.ActiveScheduler, ckpt.ConsumedUntil())
+	for _, sub := range k.generated {
+		sub.SkipUntil(ckpt.ConsumedUntil())
+	}
+	if k.replayer != nil {
+		k.replayer.SkipUntil(ckpt.ConsumedUntil())
+	}
+	k.scheduler = k.switcher.schedulers[ckpt.ActiveScheduler]
+
+	for name, state := range ckpt.Submitters {
+		if err := k.submitters[name].(submitter.Snapshotter).Restore(state); err != nil {
+			return errors.Wrapf(err, "error restoring the state of submitter %s", name)
+		}
+	}
+
+	return nil
+}
+
+// copyImages returns a deep copy of the images.
+func copyImages(images []v1.ContainerImage) []v1.ContainerImage {
+	copied := make([]v1.ContainerImage, 0, len(images))
+	for i := range images {
+		copied = append(copied, *images[i].DeepCopy())
+	}
+	return copied
+}
+
+// validateCheckpoint returns error if the checkpoint cannot be restored into this KubeSim.
+func (k *KubeSim) validateCheckpoint(ckpt *Checkpoint) error {
+	incompatible := func(format string, args ...interface{}) error {
+		return strongerrors.InvalidArgument(
+			errors.Errorf("config is incompatible with the checkpoint: "+format, args...))
+	}
+	invalid := func(format string, args ...interface{}) error {
+		return strongerrors.InvalidArgument(errors.Errorf("invalid checkpoint: "+format, args...))
+	}
+
+	if len(k.boundPods) > 0 {
+		return strongerrors.Conflict(errors.New("checkpoint must be restored into a new KubeSim"))
+	}
+	if _, err := k.pendingPods.Front(); err != queue.ErrEmptyQueue {
+		return strongerrors.Conflict(errors.New("checkpoint must be restored into a new KubeSim"))
+	}
+
+	if ckpt.Tick != k.tick {
+		return incompatible("tick %s != %s", k.tick, ckpt.Tick)
+	}
+
+	for name, n := range ckpt.Nodes {
+		if n.Node == nil || n.Node.Name != name {
+			return invalid("node %s is not saved", name)
+		}
+	}
+	names := []string{}
+	for _, p := range ckpt.Pods {
+		names = append(names, p.Node)
+	}
+	for name := range ckpt.MemoryPressure {
+		names = append(names, name)
+	}
+	for name := range ckpt.Images {
+		names = append(names, name)
+	}
+	for name := range ckpt.ImagePulls {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if _, ok := ckpt.Nodes[name]; !ok {
+			return invalid("no node named %s", name)
+		}
+	}
+	if ckpt.Autoscaler != nil && k.autoscaler == nil {
+		return incompatible("no autoscaler")
+	}
+	if ckpt.Backoff != nil && k.unschedulable == nil {
+		return incompatible("no backoff")
+	}
+
+	if _, ok := k.switcher.schedulers[ckpt.ActiveScheduler]; !ok {
+		return incompatible("scheduler %q not registered", ckpt.ActiveScheduler)
+	}
+	for name := range ckpt.Submitters {
+		sub, ok := k.submitters[name]
+		if !ok {
+			return incompatible("submitter %q not added", name)
+		}
+		if _, ok := sub.(submitter.Snapshotter); !ok {
+			return incompatible("submitter %q does not implement submitter.Snapshotter", name)
+		}
+	}
+
+	return nil
+}
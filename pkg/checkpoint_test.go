@@ -0,0 +1,475 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubesim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+
+	"simulator/pkg/autoscaler"
+	"simulator/pkg/clock"
+	"simulator/pkg/config"
+	"simulator/pkg/metrics"
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
+	"simulator/pkg/submitter"
+)
+
+func newCheckpointConfig(tick int) *config.Config {
+	return &config.Config{
+		LogLevel:   "info",
+		Tick:       tick,
+		StartClock: "2019-01-01T00:00:00Z",
+		Cluster: []config.NodeConfig{{
+			Metadata: metav1.ObjectMeta{Name: "node-0"},
+			Status: config.NodeStatus{Allocatable: map[v1.ResourceName]string{
+				"cpu": "2", "memory": "4Gi", "pods": "10",
+			}},
+		}},
+	}
+}
+
+func newCheckpointPod(name string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "default",
+			Annotations: map[string]string{"simSpec": "- seconds: 60\n  resourceUsage:\n    cpu: 1\n"},
+		},
+		Spec: v1.PodSpec{Containers: []v1.Container{{
+			Name: "container",
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{"cpu": resource.MustParse("1")},
+			},
+		}}},
+	}
+}
+
+func TestKubeSimCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ckpt.gz")
+
+	binPacking := scheduler.NewBinPackingScheduler()
+	k, err := NewKubeSim(WithConfig(newCheckpointConfig(10)), WithScheduler(&binPacking))
+	assert.NoError(t, err)
+
+	// Two pods fit in the node, and the others remain pending.
+	for _, name := range []string{"pod-0", "pod-1", "pod-2", "pod-3"} {
+		pod := newCheckpointPod(name)
+		pod.Spec.Containers[0].Image = "app:" + name
+		assert.NoError(t, k.pendingPods.Push(pod))
+	}
+	assert.NoError(t, k.schedule(context.Background()))
+	k.clock = k.clock.Add(10 * time.Second)
+	pending := k.pendingPods.(queue.Lister).List()
+	assert.Len(t, pending, 2)
+
+	assert.NoError(t, k.SaveCheckpoint(path))
+	// Saving does not change the queue.
+	assert.Equal(t, pending, k.pendingPods.(queue.Lister).List())
+
+	binPacking2 := scheduler.NewBinPackingScheduler()
+	restored, err := NewKubeSim(WithConfig(newCheckpointConfig(10)), WithScheduler(&binPacking2))
+	assert.NoError(t, err)
+	ckpt, err := restored.RestoreCheckpoint(path)
+	assert.NoError(t, err)
+
+	assert.Equal(t, k.clock, restored.clock)
+	assert.Equal(t, k.clock.Add(-10*time.Second), ckpt.ConsumedUntil())
+	assert.Len(t, restored.boundPods, 2)
+	assert.Len(t, restored.nodes["node-0"].PodList(), 2)
+	assert.Equal(t, k.nodes["node-0"].Images(k.clock), restored.nodes["node-0"].Images(restored.clock))
+	assert.Len(t, restored.nodes["node-0"].Images(restored.clock), 2)
+
+	names := []string{}
+	for _, pod := range restored.pendingPods.(queue.Lister).List() {
+		names = append(names, pod.Name)
+	}
+	expected := []string{}
+	for _, pod := range pending {
+		expected = append(expected, pod.Name)
+	}
+	assert.Equal(t, expected, names)
+
+	// The restored KubeSim is not new any longer.
+	_, err = restored.RestoreCheckpoint(path)
+	assert.Error(t, err)
+
+	// The tick differs.
+	binPacking3 := scheduler.NewBinPackingScheduler()
+	other, err := NewKubeSim(WithConfig(newCheckpointConfig(5)), WithScheduler(&binPacking3))
+	assert.NoError(t, err)
+	_, err = other.RestoreCheckpoint(path)
+	assert.EqualError(t, err, "config is incompatible with the checkpoint: tick 5s != 10s")
+}
+
+func TestKubeSimCheckpointNodes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ckpt.gz")
+
+	newConfig := func() *config.Config {
+		conf := newCheckpointConfig(10)
+		conf.Cluster = append(conf.Cluster, config.NodeConfig{
+			Metadata: metav1.ObjectMeta{Name: "node-1"},
+			Status:   config.NodeStatus{Allocatable: map[v1.ResourceName]string{"cpu": "2", "memory": "4Gi"}},
+		})
+		conf.Autoscaler = &config.AutoscalerConfig{
+			NodeGroups: []config.NodeGroupConfig{{
+				Name:    "pool",
+				MaxSize: 2,
+				Template: config.NodeConfig{Status: config.NodeStatus{Allocatable: map[v1.ResourceName]string{
+					"cpu": "4", "memory": "4Gi",
+				}}},
+			}},
+			ProvisioningSeconds: 60,
+		}
+		return conf
+	}
+
+	binPacking := scheduler.NewBinPackingScheduler()
+	k, err := NewKubeSim(WithConfig(newConfig()), WithScheduler(&binPacking))
+	assert.NoError(t, err)
+
+	// The cluster changes during the simulation, and a node of the group is being provisioned.
+	extra := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "extra"},
+		Status:     v1.NodeStatus{Allocatable: v1.ResourceList{"cpu": resource.MustParse("2")}},
+	}
+	assert.NoError(t, k.AddNode(extra))
+	assert.NoError(t, k.DegradeNode("extra", map[v1.ResourceName]float64{"cpu": 0.5}))
+	assert.NoError(t, k.DeleteNode("node-1"))
+	assert.NoError(t, k.SetNodeReady("node-0", false))
+	large := newCheckpointPod("large")
+	large.Spec.Containers[0].Resources.Requests["cpu"] = resource.MustParse("3")
+	assert.NoError(t, k.pendingPods.Push(large))
+	assert.NoError(t, k.autoscale())
+	k.clock = k.clock.Add(10 * time.Second)
+	assert.NoError(t, k.SaveCheckpoint(path))
+
+	binPacking2 := scheduler.NewBinPackingScheduler()
+	restored, err := NewKubeSim(WithConfig(newConfig()), WithScheduler(&binPacking2))
+	assert.NoError(t, err)
+	_, err = restored.RestoreCheckpoint(path)
+	assert.NoError(t, err)
+
+	// The nodes are restored from the checkpoint instead of the config.
+	assert.Len(t, restored.nodes, 2)
+	assert.NotContains(t, restored.nodes, "node-1")
+	assert.False(t, restored.nodes["node-0"].IsReady())
+	assert.True(t, apiequality.Semantic.DeepEqual(k.nodes["node-0"].Taints(), restored.nodes["node-0"].Taints()))
+	assert.True(t, apiequality.Semantic.DeepEqual(
+		k.nodes["node-0"].ToV1().Status.Conditions, restored.nodes["node-0"].ToV1().Status.Conditions))
+	assert.True(t, restored.nodes["extra"].IsDegraded())
+	assert.Equal(t, "1", restored.nodes["extra"].ToV1().Status.Allocatable.Cpu().String())
+	assert.Equal(t, map[string]autoscaler.GroupMetrics{"pool": {Provisioning: 1}}, restored.autoscaler.Metrics())
+
+	// The restored nodes recover, and the node being provisioned joins.
+	assert.NoError(t, restored.DegradeNode("extra", nil))
+	assert.Equal(t, "2", restored.nodes["extra"].ToV1().Status.Allocatable.Cpu().String())
+	assert.NoError(t, restored.SetNodeReady("node-0", true))
+	assert.Empty(t, restored.nodes["node-0"].Taints())
+	restored.clock = restored.clock.Add(60 * time.Second)
+	assert.NoError(t, restored.autoscale())
+	assert.Contains(t, restored.nodes, "pool-0")
+
+	// The autoscaler is not configured.
+	conf := newConfig()
+	conf.Autoscaler = nil
+	binPacking3 := scheduler.NewBinPackingScheduler()
+	other, err := NewKubeSim(WithConfig(conf), WithScheduler(&binPacking3))
+	assert.NoError(t, err)
+	_, err = other.RestoreCheckpoint(path)
+	assert.EqualError(t, err, "config is incompatible with the checkpoint: no autoscaler")
+}
+
+func TestKubeSimCheckpointFaults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ckpt.gz")
+
+	newKubeSim := func() *KubeSim {
+		conf := newCheckpointConfig(10)
+		for _, name := range []string{"node-1", "node-2"} {
+			conf.Cluster = append(conf.Cluster, config.NodeConfig{
+				Metadata: metav1.ObjectMeta{Name: name},
+				Status:   config.NodeStatus{Allocatable: map[v1.ResourceName]string{"cpu": "2", "memory": "4Gi"}},
+			})
+		}
+		conf.Faults = []config.FaultConfig{
+			{Kind: "degradation", Node: "node-1", At: "2019-01-01T00:00:00Z", Until: "2019-01-01T00:00:40Z",
+				Ratios: map[v1.ResourceName]float64{"cpu": 0.5}},
+			{Kind: "notReady", Node: "node-0", At: "2019-01-01T00:00:10Z", Until: "2019-01-01T00:00:50Z"},
+			{Kind: "crash", Node: "node-2", At: "2019-01-01T00:00:10Z", Until: "2019-01-01T00:01:00Z"},
+		}
+		binPacking := scheduler.NewBinPackingScheduler()
+		binPacking.AddPredicate(predicates.PodToleratesNodeTaintsPred, predicates.PodToleratesNodeTaints)
+		k, err := NewKubeSim(WithConfig(conf), WithScheduler(&binPacking))
+		assert.NoError(t, err)
+		return k
+	}
+
+	// The checkpoint is saved while all of the faults are in effect.
+	k := newKubeSim()
+	k.AddSubmitter("OneShot", &oneShotSubmitter{pods: []*v1.Pod{newCheckpointPod("pod-0")}})
+	assert.NoError(t, k.RunUntil(context.Background(), ClockReaches(k.clock.Add(20*time.Second))))
+	assert.NoError(t, k.SaveCheckpoint(path))
+
+	restored := newKubeSim()
+	_, err = restored.RestoreCheckpoint(path)
+	assert.NoError(t, err)
+	assert.True(t, restored.nodes["node-1"].IsDegraded())
+	assert.False(t, restored.nodes["node-0"].IsReady())
+	assert.NotContains(t, restored.nodes, "node-2")
+
+	// The faults end on the restored nodes, and the crashed node is added back.
+	nodeEvents := []metrics.EventKind{}
+	restored.AddEventHandler(func(e metrics.Event) error {
+		if e.IsNodeEvent() {
+			nodeEvents = append(nodeEvents, e.Kind)
+		}
+		return nil
+	})
+	assert.NoError(t, restored.Run(context.Background()))
+	assert.Equal(t, []metrics.EventKind{
+		metrics.NodeDegradeEvent, metrics.NodeReadyEvent, metrics.NodeAddEvent,
+	}, nodeEvents)
+
+	nodes, err := restored.List()
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 3)
+	for _, n := range nodes {
+		assert.Equal(t, "2", n.Status.Allocatable.Cpu().String(), n.Name)
+		assert.Empty(t, n.Spec.Taints, n.Name)
+	}
+	pods, err := restored.ListPods(labels.Everything())
+	assert.NoError(t, err)
+	assert.Len(t, pods, 1)
+	assert.Equal(t, v1.PodSucceeded, pods[0].Status.Phase)
+}
+
+func TestKubeSimSnapshotHeldPods(t *testing.T) {
+	conf := newCheckpointConfig(10)
+	conf.Backoff = &config.BackoffConfig{}
+	newScheduler := func() *scheduler.GenericScheduler {
+		sched := scheduler.NewGenericScheduler(false)
+		sched.AddPredicate(predicates.PodFitsResourcesPred, predicates.PodFitsResources)
+		sched.EnableCoscheduling(time.Minute)
+		return &sched
+	}
+	sched := newScheduler()
+	k, err := NewKubeSim(WithConfig(conf), WithScheduler(sched), WithQueue(queue.NewFIFOQueue()))
+	assert.NoError(t, err)
+
+	// The pod of the group waits for the other one in the scheduler, and the large pod, which never
+	// fits, is in backoff.
+	member := newCheckpointPod("member")
+	member.Labels = map[string]string{
+		scheduler.PodGroupNameLabel:         "group",
+		scheduler.PodGroupMinAvailableLabel: "2",
+	}
+	large := newCheckpointPod("large")
+	large.Spec.Containers[0].Resources.Requests["cpu"] = resource.MustParse("3")
+	assert.NoError(t, k.pendingPods.Push(member))
+	assert.NoError(t, k.pendingPods.Push(large))
+	assert.NoError(t, k.schedule(context.Background()))
+	assert.NoError(t, k.pendingPods.Push(newCheckpointPod("pending")))
+
+	pending := k.pendingPods.(queue.Lister).List()
+	held := sched.Held()
+	backoff := k.unschedulable.List()
+	assert.Len(t, pending, 1)
+	assert.Len(t, held, 1)
+	assert.Len(t, backoff, 1)
+
+	state, err := k.Snapshot()
+	assert.NoError(t, err)
+	// Taking the snapshot does not change the queue, the scheduler, or the backoff.
+	assert.Equal(t, pending, k.pendingPods.(queue.Lister).List())
+	assert.Equal(t, held, sched.Held())
+	assert.Equal(t, backoff, k.unschedulable.List())
+
+	names := func(pods []*v1.Pod) []string {
+		names := []string{}
+		for _, pod := range pods {
+			names = append(names, pod.Name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"pending", "member"}, names(state.PendingPods))
+
+	// The pods held by the scheduler are pushed back to the queue of the restored KubeSim, and the
+	// pod in backoff stays there.
+	restored, err := NewKubeSimFromSnapshot(state,
+		WithConfig(conf), WithScheduler(newScheduler()), WithQueue(queue.NewFIFOQueue()))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pending", "member"}, names(restored.pendingPods.(queue.Lister).List()))
+	assert.Equal(t, []string{"large"}, names(restored.unschedulable.List()))
+}
+
+// countingSubmitter submits a pod at each tick until it has submitted n pods, then terminates.
+type countingSubmitter struct {
+	n         int
+	submitted int
+}
+
+func (s *countingSubmitter) Submit(
+	ctx context.Context,
+	clock clock.Clock,
+	nodeLister algorithm.NodeLister,
+	metrics metrics.Metrics,
+) ([]submitter.Event, error) {
+
+	if s.submitted == s.n {
+		return []submitter.Event{&submitter.TerminateSubmitterEvent{}}, nil
+	}
+	s.submitted++
+	return []submitter.Event{
+		&submitter.SubmitEvent{Pod: newCheckpointPod(fmt.Sprintf("pod-%d", s.submitted-1))},
+	}, nil
+}
+
+func (s *countingSubmitter) Snapshot() (json.RawMessage, error) {
+	return json.Marshal(s.submitted)
+}
+
+func (s *countingSubmitter) Restore(state json.RawMessage) error {
+	return json.Unmarshal(state, &s.submitted)
+}
+
+var _ = submitter.Snapshotter(&countingSubmitter{})
+
+func TestKubeSimSnapshot(t *testing.T) {
+	ctx := context.Background()
+	newKubeSim := func(state *SimState, opts ...Option) (*KubeSim, error) {
+		binPacking := scheduler.NewBinPackingScheduler()
+		opts = append(opts, WithConfig(newCheckpointConfig(10)), WithScheduler(&binPacking))
+		if state == nil {
+			return NewKubeSim(opts...)
+		}
+		return NewKubeSimFromSnapshot(state, opts...)
+	}
+
+	k, err := newKubeSim(nil, WithSubmitter("counter", &countingSubmitter{n: 4}))
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, k.submit(ctx, metrics.Metrics{}))
+		assert.NoError(t, k.schedule(ctx))
+		k.clock = k.clock.Add(10 * time.Second)
+	}
+
+	state, err := k.Snapshot()
+	assert.NoError(t, err)
+	assert.Len(t, state.Pods, 2)
+	assert.Len(t, state.PendingPods, 1)
+	assert.Equal(t, json.RawMessage("3"), state.Submitters["counter"])
+	saved, err := json.Marshal(state)
+	assert.NoError(t, err)
+
+	// The state is not affected by the simulation continuing after it.
+	assert.NoError(t, k.Run(ctx))
+	after, err := json.Marshal(state)
+	assert.NoError(t, err)
+	assert.Equal(t, string(saved), string(after))
+
+	// The simulation is branched from the state, also decoded from JSON.
+	var decoded SimState
+	assert.NoError(t, json.Unmarshal(saved, &decoded))
+	for _, s := range []*SimState{state, &decoded} {
+		counter := &countingSubmitter{n: 4}
+		branch, err := newKubeSim(s, WithSubmitter("counter", counter))
+		assert.NoError(t, err)
+		assert.Equal(t, 3, counter.submitted)
+		assert.Len(t, branch.boundPods, 2)
+
+		assert.NoError(t, branch.Run(ctx))
+		pods, err := branch.ListPods(labels.Everything())
+		assert.NoError(t, err)
+		assert.Len(t, pods, 4)
+		for _, p := range pods {
+			assert.Equal(t, v1.PodSucceeded, p.Status.Phase, p.Name)
+		}
+	}
+
+	_, err = newKubeSim(state)
+	assert.EqualError(t, err, `config is incompatible with the checkpoint: submitter "counter" not added`)
+}
+
+func TestKubeSimSystemPods(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ckpt.gz")
+
+	newConfig := func() *config.Config {
+		conf := newCheckpointConfig(10)
+		conf.Cluster[0].SystemPods = []config.SystemPodConfig{{
+			Name:     "kube-proxy",
+			Requests: map[v1.ResourceName]string{"cpu": "500m"},
+			Usage:    map[v1.ResourceName]string{"cpu": "100m"},
+		}}
+		return conf
+	}
+
+	binPacking := scheduler.NewBinPackingScheduler()
+	k, err := NewKubeSim(WithConfig(newConfig()), WithScheduler(&binPacking))
+	assert.NoError(t, err)
+
+	node := k.nodes["node-0"]
+	assert.True(t, node.IsSystemPod("kube-system", "kube-proxy-node-0"))
+	met := node.Metrics(k.clock)
+	assert.Equal(t, int64(1), met.RunningPodsNum)
+	assert.Equal(t, int64(0), node.WorkloadPodsNum(k.clock))
+	assert.Equal(t, "500m", met.TotalResourceRequest.Cpu().String())
+	assert.Equal(t, "100m", met.TotalResourceUsage.Cpu().String())
+
+	// Only one of the pods fits in the rest of the node.
+	for _, name := range []string{"pod-0", "pod-1"} {
+		assert.NoError(t, k.pendingPods.Push(newCheckpointPod(name)))
+	}
+	assert.NoError(t, k.schedule(context.Background()))
+	k.clock = k.clock.Add(10 * time.Second)
+	assert.Len(t, k.boundPods, 1)
+	assert.Len(t, node.PodList(), 2)
+
+	// The system pod is saved with the node, not with the pods, and added to the restored node again.
+	assert.NoError(t, k.SaveCheckpoint(path))
+	binPacking2 := scheduler.NewBinPackingScheduler()
+	restored, err := NewKubeSim(WithConfig(newConfig()), WithScheduler(&binPacking2))
+	assert.NoError(t, err)
+	ckpt, err := restored.RestoreCheckpoint(path)
+	assert.NoError(t, err)
+	assert.Len(t, ckpt.Pods, 1)
+	assert.Len(t, restored.nodes["node-0"].PodList(), 2)
+}
@@ -1,13 +1,17 @@
 package client
 
 import (
+	"log"
+
+	"google.golang.org/grpc"
+
 	pb "simulator/protos"
 )
 
 var Connect pb.SimRPCClient
 
 func establishConnection() {
-	address = "localhost:50051"
+	address := "localhost:50051"
 
 	conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithBlock())
 	if err != nil {
@@ -17,7 +21,7 @@ func establishConnection() {
 	Connect = pb.NewSimRPCClient(conn)
 
 	var metric pb.Metrics
-	metric.clock = "test clock"
-	metric.nodes = "test node"
+	metric.Clock = &pb.Clock{ClockMetrics_Key: "test clock"}
+	metric.Nodes = &pb.Nodes{NodesMetricsKey: "test node"}
 
-}
\ No newline at end of file
+}
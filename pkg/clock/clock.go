@@ -71,3 +71,20 @@ func (c Clock) ToRFC3339() string {
 func (c Clock) MarshalJSON() ([]byte, error) {
 	return json.Marshal(c.ToRFC3339())
 }
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+// It parses a string in RFC3339 format.
+func (c *Clock) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+
+	t, err := time.Parse(time.RFC3339, str)
+	if err != nil {
+		return err
+	}
+	*c = NewClock(t)
+
+	return nil
+}
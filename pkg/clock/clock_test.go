@@ -15,12 +15,13 @@
 package clock_test
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/clock"
+	"simulator/pkg/clock"
 )
 
 func TestClockNewClockAndToMetaV1(t *testing.T) {
@@ -83,3 +84,21 @@ func TestClockBefore(t *testing.T) {
 		t.Errorf("got: false\nwant: true")
 	}
 }
+
+func TestClockMarshalAndUnmarshalJSON(t *testing.T) {
+	time0, _ := time.Parse(time.RFC3339, "2018-01-01T12:30:15+09:00")
+	clock0 := clock.NewClock(time0)
+
+	bytes, err := json.Marshal(clock0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual clock.Clock
+	if err := json.Unmarshal(bytes, &actual); err != nil {
+		t.Fatal(err)
+	}
+	if actual.Sub(clock0) != 0 {
+		t.Errorf("got: %+v\nwant: %+v", actual, clock0)
+	}
+}
@@ -15,15 +15,29 @@
 package config
 
 import (
+	"fmt"
+	"math"
+	"sort"
 	"time"
 
 	"github.com/cpuguy83/strongerrors"
 	"github.com/pkg/errors"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/metrics"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/util"
+	"simulator/pkg/autoscaler"
+	"simulator/pkg/clock"
+	"simulator/pkg/logfile"
+	"simulator/pkg/metrics"
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+	"simulator/pkg/reservation"
+	"simulator/pkg/submitter"
+	"simulator/pkg/trace"
+	"simulator/pkg/util"
+	"simulator/pkg/workload"
 )
 
 // Config represents a user-specified simulator config.
@@ -34,6 +48,112 @@ type Config struct {
 	MetricsTick   int
 	MetricsLogger []MetricsLoggerConfig
 	Cluster       []NodeConfig
+	Reservations  []ReservationConfig
+	// SchedulerSwitches is a list of switches of the active scheduler during the simulation.
+	SchedulerSwitches []SchedulerSwitchConfig
+	// SchedulerConfig is the path of the KubeSchedulerConfiguration file of kube-scheduler, from
+	// which a scheduler is built (see scheduler.ReadKubeSchedulerConfiguration).
+	SchedulerConfig string
+	// TraceFile is the path of the file to which the inputs consumed by the simulation are recorded
+	// for replay.
+	TraceFile string
+	// TraceCompression and TraceMaxSize are the compression and the size in MiB after which the
+	// trace file is rotated (see logfile.Options).
+	TraceCompression string
+	TraceMaxSize     int
+	// TraceAnonymization anonymizes the recorded trace if not nil.
+	TraceAnonymization *TraceAnonymizationConfig
+	// ResultsDB is the path of the SQLite database to which the metrics and the events of pods are
+	// written.
+	ResultsDB string
+	// ParquetDir is the directory to which the metrics of nodes and the outcomes of pods are written
+	// in Parquet files.
+	ParquetDir string
+	// TimelineFile is the path of the JSON file to which the timeline of the pods and the nodes is
+	// written at the end of the simulation (see metrics.Timeline).
+	TimelineFile string
+	// SummaryFile is the path of the JSON file to which the summary report of the simulation is
+	// written at its end (see metrics.Summary).
+	SummaryFile string
+	// SummaryTableFile is the path of the file to which the summary report is also written in a
+	// human-readable table. Requires SummaryFile. Optional
+	SummaryTableFile string
+	// EventLogFile is the path of the file to which the events of pods and nodes are written, one
+	// JSON object per line (see metrics.EventLogWriter).
+	EventLogFile string
+	// EventLogCompression and EventLogMaxSize are the compression and the size in MiB after which
+	// the event log file is rotated (see logfile.Options).
+	EventLogCompression string
+	EventLogMaxSize     int
+	// APIPort is the port on which the metrics of the simulated cluster are served through read-only
+	// HTTP endpoints while the simulation runs (see api.Server). Optional (default: 0, i.e., not
+	// served)
+	APIPort int
+	// ClockMode is how the clock of the simulation advances: VirtualClockMode (as fast as the ticks
+	// are processed), RealTimeClockMode (paced to the wall clock), or FastForwardClockMode (skipping
+	// the idle ticks). Optional (default: VirtualClockMode, or the mode of RealTime or FastForward)
+	ClockMode string
+	// SpeedFactor is the ratio of the simulated time to the wall-clock time in RealTimeClockMode
+	// (e.g., 10 to advance the clock by 10 seconds per second). Optional (default: 1)
+	SpeedFactor float64
+	// RealTime paces the simulation to the wall clock, advancing it by a tick per tick of wall-clock
+	// time (e.g., to drive the simulated nodes from a real API server), like RealTimeClockMode.
+	RealTime bool
+	// FastForward skips the ticks at which nothing happens, i.e., no pods are pending, submitted, or
+	// changing their phases, so that long simulations of sparse workloads finish quickly, like
+	// FastForwardClockMode. Optional (default: false)
+	FastForward bool
+	// CheckpointFile is the path of the file to which the state of the simulation is saved every
+	// CheckpointTick seconds (default: 3600), to resume the simulation later.
+	CheckpointFile string
+	CheckpointTick int
+	// Seed seeds the random numbers of the simulation (e.g., the ties between nodes broken by the
+	// scheduler), and is the default seed of UsageNoise and Generators, so that two runs of the same
+	// config and seed write the same metrics. Optional (default: 0)
+	Seed int64
+	// UsageNoise is the default noise model of the resource usage of pods, which each pod can
+	// override with the pod.UsageNoiseAnnotation annotation.
+	UsageNoise *UsageNoiseConfig
+	// Overcommit schedules pods on more resources than the capacity of each node, and evicts pods
+	// when their actual memory usage exceeds it, if not nil.
+	Overcommit *OvercommitConfig
+	// SaturationThreshold is the utilization of a resource by the usage at or above which a node is
+	// saturated in the balance metrics. Optional (default: metrics.DefaultSaturationThreshold)
+	SaturationThreshold float64
+	// MaxPods is the number of pods that a node can run unless its config specifies the pods
+	// resource. Optional (default: DefaultMaxPods)
+	MaxPods int
+	// Queue is the queue of the pending pods, unless KubeSim is given another one. Optional
+	// (default: a priority queue)
+	Queue *QueueConfig
+	// Backoff holds the pods that the scheduler failed to schedule out of the queue for their
+	// backoffs, so that they do not block the other pods, if not nil (see queue.UnschedulablePods).
+	Backoff *BackoffConfig
+	// PodsPerTick is the maximum number of pending pods that the scheduler tries to schedule at each
+	// tick, each at most once. Optional (default: 0, i.e., as many as the scheduler does)
+	PodsPerTick int
+	// RequeuePreemptedPods pushes the pods deleted by the preemption of the scheduler back to the
+	// queue, as their controllers would recreate them. Optional (default: false)
+	RequeuePreemptedPods bool
+	// StartupLatency delays the start of the execution of each pod after its binding, if not nil.
+	StartupLatency *StartupLatencyConfig
+	// Images are the images that pods may pull, with their sizes, used by the image-locality
+	// priority. An image not listed has size 0.
+	Images []ImageConfig
+	// PriorityClasses are the PriorityClasses that pods may specify by PriorityClassName, besides
+	// system-cluster-critical and system-node-critical.
+	PriorityClasses []PriorityClassConfig
+	// Namespaces are the namespaces with the ResourceQuotas and the LimitRanges of their pods. The
+	// pods of the other namespaces are unlimited.
+	Namespaces []NamespaceConfig
+	// Generators are the synthetic workloads submitted from the start of the simulation, each by its
+	// own submitter (see workload.Generator).
+	Generators []GeneratorConfig
+	// Autoscaler adds and deletes the nodes of node groups during the simulation, if not nil.
+	Autoscaler *AutoscalerConfig
+	// Faults are the faults injected into the nodes during the simulation (see
+	// submitter.FaultInjector).
+	Faults []FaultConfig
 }
 
 // Made public to be parsed from YAML.
@@ -43,16 +163,265 @@ type MetricsLoggerConfig struct {
 	Dest string
 	// Formatter is a type of metrics format.
 	Formatter string
+	// Compression and MaxSize are the compression and the size in MiB after which the file is
+	// rotated (see logfile.Options). Not supported for standard out and standard error.
+	Compression string
+	MaxSize     int
+	// FlushInterval is the minimum interval in seconds of wall-clock time between flushes of the
+	// file, or 0 to flush every metrics written. Standard out and standard error are not buffered.
+	FlushInterval int
 }
 
 type NodeConfig struct {
 	Metadata metav1.ObjectMeta
 	Spec     v1.NodeSpec
 	Status   NodeStatus
+	// SystemPods are the pods always running on the node from its startup (e.g., kube-proxy and
+	// logging agents), which reduce the resources available to the scheduled pods.
+	SystemPods []SystemPodConfig
 }
 
 type NodeStatus struct {
+	// Allocatable are the resources available to the pods, including extended resources (e.g.,
+	// nvidia.com/gpu) and hugepages (e.g., hugepages-2Mi).
 	Allocatable map[v1.ResourceName]string
+	// Capacity are the total resources of the node, at least the allocatable ones, e.g., including
+	// the resources reserved for the system. Optional (default: Allocatable)
+	Capacity map[v1.ResourceName]string
+	// Images are the images that the node has pulled before the simulation starts.
+	Images []ImageConfig
+}
+
+type ImageConfig struct {
+	// Name is the name of the image (e.g., nginx:1.15), tagged latest if not tagged.
+	Name string
+	// Size is the size of the image (e.g., 100Mi).
+	Size string
+}
+
+type SystemPodConfig struct {
+	// Name is the name of the pod, suffixed with the name of the node (e.g., kube-proxy-node-0).
+	Name string
+	// Namespace is the namespace of the pod. Optional (default: kube-system)
+	Namespace string
+	// Requests is the amount of resources requested by the pod.
+	Requests map[v1.ResourceName]string
+	// Usage is the amount of resources used by the pod. Optional (default: Requests)
+	Usage map[v1.ResourceName]string
+}
+
+type ReservationConfig struct {
+	Name string
+	// NodeName is the name of the reserved node. Either NodeName or Zone must be specified.
+	NodeName string
+	// Zone is the zone in which every node is reserved.
+	Zone string
+	// Resource is the amount of resources reserved on each node.
+	Resource map[v1.ResourceName]string
+	// Start and End is the time interval of the reservation, in RFC3339 format.
+	Start string
+	End   string
+}
+
+type TraceAnonymizationConfig struct {
+	// Salt is mixed into the hashes of the names of pods, namespaces, and nodes.
+	Salt string
+	// KeepNodeNames keeps the names of nodes.
+	KeepNodeNames bool
+	// Labels, Annotations, and Tolerations are the allowlists of the keys of pod labels,
+	// annotations, and tolerations to keep. Optional (default: trace.DefaultLabelAllowlist,
+	// trace.DefaultAnnotationAllowlist, and trace.DefaultTolerationAllowlist)
+	Labels      []string
+	Annotations []string
+	Tolerations []string
+}
+
+type UsageNoiseConfig struct {
+	// Model is the noise model (none, uniform, gaussian, or lognormal; see pod.NoiseModel).
+	Model string
+	// Amplitude is the half width (uniform) or the standard deviation (gaussian and lognormal) of
+	// the multiplicative factor of usage.
+	Amplitude float64
+	// Seed seeds the noise of every pod, including the ones selecting the model by the annotation.
+	// Optional (default: the Seed of the simulation)
+	Seed int64
+}
+
+type OvercommitConfig struct {
+	// Ratios maps each resource to the ratio of the allocatable resources of every node, on which
+	// pods are scheduled by their requests, to its capacity (e.g., cpu: 2.0), except the device
+	// resources (e.g., nvidia.com/gpu), which cannot be overcommitted.
+	Ratios map[v1.ResourceName]float64
+	// MemoryAvailable is the eviction threshold of the memory available on each node, like the
+	// memory.available hard eviction threshold of the kubelet. Optional (default: 0)
+	MemoryAvailable string
+	// PressureTransitionPeriod is the duration in seconds for which a node keeps the
+	// MemoryPressure condition. Optional (default: 300)
+	PressureTransitionPeriod int
+}
+
+type QueueConfig struct {
+	// Kind is the kind of the queue: PriorityQueueKind, FIFOQueueKind, or FairShareQueueKind.
+	// Optional (default: PriorityQueueKind)
+	Kind string
+	// Order is the order of the pending pods in the priority queue: PriorityQueueOrder,
+	// EDFQueueOrder (earliest deadline first, see queue.EarliestDeadlineFirst), or LLFQueueOrder
+	// (least laxity first, see queue.LeastLaxityFirst). Optional (default: PriorityQueueOrder)
+	Order string
+	// TenantLabel is the key of the label of pods whose values are the tenants of the fair-share
+	// queue. Optional (default: the namespaces of pods are the tenants)
+	TenantLabel string
+	// Weights maps each tenant of the fair-share queue to its weight. Optional (default: 1)
+	Weights map[string]float64
+	// HoldPodGroups holds the pods of each pod group out of the queue until minAvailable pods of the
+	// group are pending or running (see queue.PodGroupQueue). Optional (default: false)
+	HoldPodGroups bool
+}
+
+type BackoffConfig struct {
+	// InitialSeconds is the backoff in seconds after the first failure of a pod, which doubles at
+	// each failure up to MaxSeconds. Optional (default: 1 and 10)
+	InitialSeconds float64
+	MaxSeconds     float64
+	// UnschedulableSeconds is the time in seconds after which a pod is retried once its backoff has
+	// expired, even if the cluster has not changed. Optional (default: 60)
+	UnschedulableSeconds float64
+	// MaxRetries is the number of retries after which a pod failing again is failed.
+	// Optional (default: 0, i.e., unlimited)
+	MaxRetries int
+}
+
+type StartupLatencyConfig struct {
+	// BindSeconds is the latency in seconds of the binding of a pod until its node notices it.
+	BindSeconds float64
+	// ImagePullBandwidth is the amount of images pulled per second by each node (e.g., 50Mi), with
+	// which the size of each image is converted to the time to pull it. Optional (default: pulled
+	// instantly)
+	ImagePullBandwidth string
+	// InitSeconds is the time in seconds to initialize a pod after its images are pulled, which each
+	// pod can override with the pod.InitSecondsAnnotation annotation.
+	InitSeconds float64
+}
+
+type PriorityClassConfig struct {
+	Name string
+	// Value is the priority of the pods of the class, up to 1000000000.
+	Value int32
+	// GlobalDefault makes the pods with neither PriorityClassName nor priority use the class.
+	GlobalDefault bool
+	// PreemptionPolicy is PreemptLowerPriority or Never. Optional (default: PreemptLowerPriority)
+	PreemptionPolicy string
+}
+
+type NamespaceConfig struct {
+	Name string
+	// ResourceQuota is the hard limits of the total usage of the pods in the namespace that are
+	// pending or running, e.g., pods, requests.cpu, limits.memory, or requests.nvidia.com/gpu.
+	// Optional (default: unlimited)
+	ResourceQuota map[v1.ResourceName]string
+	// LimitRange is the LimitRange of the containers of the pods in the namespace, if not nil.
+	LimitRange *LimitRangeConfig
+}
+
+type LimitRangeConfig struct {
+	// Default is the default limit of each resource of a container. Optional (default: Max)
+	Default map[v1.ResourceName]string
+	// DefaultRequest is the default request of each resource of a container. Optional (default:
+	// Default)
+	DefaultRequest map[v1.ResourceName]string
+	// Min is the minimum request of each resource of a container.
+	Min map[v1.ResourceName]string
+	// Max is the maximum limit of each resource of a container.
+	Max map[v1.ResourceName]string
+}
+
+type SchedulerSwitchConfig struct {
+	// At is the clock at which the switch happens, in RFC3339 format.
+	At string
+	// Scheduler is the name with which the scheduler is registered by KubeSim.RegisterScheduler.
+	Scheduler string
+}
+
+type GeneratorConfig struct {
+	// Name is the name of the submitter, and the prefix of the names of its pods.
+	Name string
+	// Namespace is the namespace of the pods. Optional (default: default)
+	Namespace string
+	// Count is the number of pods submitted.
+	Count int
+	// Seed seeds the random numbers, so that the same seed generates the same workload.
+	// Optional (default: drawn from the Seed of the simulation)
+	Seed int64
+	// Arrival is the arrival process of the pods (poisson, uniform, or bursty).
+	Arrival string
+	// Rate is the average number of pods submitted per second.
+	Rate float64
+	// BurstSize is the number of pods submitted at once by the bursty arrival.
+	BurstSize int
+	// CPU and Memory are the distributions of the resource requests of each pod.
+	CPU    DistributionConfig
+	Memory DistributionConfig
+	// Duration is the distribution of the execution seconds of each pod.
+	Duration DistributionConfig
+	// Priorities is the mix of the priorities of the pods. Optional (default: no priority)
+	Priorities []PriorityWeightConfig
+}
+
+type FaultConfig struct {
+	// Kind is crash, notReady, or degradation.
+	Kind string
+	// Node is the name of the node.
+	Node string
+	// At and Until is the time interval of the fault, in RFC3339 format.
+	// Optional Until (default: until the end of the simulation)
+	At    string
+	Until string
+	// Ratios maps each resource to the ratio of the capacity of the node kept by a degradation
+	// (e.g., cpu: 0.5). Required for and only for a degradation.
+	Ratios map[v1.ResourceName]float64
+}
+
+type AutoscalerConfig struct {
+	NodeGroups []NodeGroupConfig
+	// ScaleDownUtilizationThreshold is the larger ratio of the cpu and memory requests of a node to
+	// its allocatable resources below which the node is underutilized. Optional (default:
+	// autoscaler.DefaultScaleDownUtilizationThreshold)
+	ScaleDownUtilizationThreshold float64
+	// ScaleDownTicks is the number of consecutive ticks for which a node must be underutilized to be
+	// deleted. Optional (default: autoscaler.DefaultScaleDownTicks)
+	ScaleDownTicks int
+	// ProvisioningSeconds is the time in seconds from a scale-up until the node joins the cluster.
+	// Optional (default: 0)
+	ProvisioningSeconds float64
+}
+
+type NodeGroupConfig struct {
+	Name string
+	// MinSize and MaxSize are the bounds of the number of the nodes of the group. MinSize nodes join
+	// the cluster at the start of the simulation.
+	MinSize int
+	MaxSize int
+	// Template is the node of the group, named "<name>-<index>", with its system pods.
+	Template NodeConfig
+}
+
+type DistributionConfig struct {
+	// Distribution is constant, uniform, normal, lognormal, or exponential (see
+	// workload.DistributionKind). Optional (default: constant)
+	Distribution string
+	// Value (constant), Min and Max (uniform, or the bounds of the others), and Mean and StdDev
+	// (normal, lognormal, and exponential) are quantities (e.g., 500m, 1Gi, or 600 seconds).
+	Value  string
+	Min    string
+	Max    string
+	Mean   string
+	StdDev string
+}
+
+type PriorityWeightConfig struct {
+	Priority int32
+	// Weight is the relative frequency of the priority.
+	Weight float64
 }
 
 // BuildMetricsLogger builds metrics.FileWriter with the given MetricsLoggerConfig.
@@ -69,11 +438,17 @@ func BuildMetricsLogger(conf []MetricsLoggerConfig) ([]*metrics.FileWriter, erro
 		if err != nil {
 			return nil, err
 		}
+		if conf.FlushInterval < 0 {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("flushInterval of %s must not be negative", conf.Dest))
+		}
 
-		writer, err := metrics.NewFileWriter(conf.Dest, formatter)
+		writer, err := metrics.NewFileWriter(
+			conf.Dest, formatter, BuildFileOptions(conf.Compression, conf.MaxSize))
 		if err != nil {
 			return nil, err
 		}
+		writer.SetFlushInterval(time.Duration(conf.FlushInterval) * time.Second)
 
 		writers = append(writers, writer)
 	}
@@ -81,6 +456,712 @@ func BuildMetricsLogger(conf []MetricsLoggerConfig) ([]*metrics.FileWriter, erro
 	return writers, nil
 }
 
+// BuildAnonymizer builds trace.Anonymizer with the given TraceAnonymizationConfig.
+func BuildAnonymizer(conf *TraceAnonymizationConfig) *trace.Anonymizer {
+	opts := trace.AnonymizeOptions{
+		Salt:          conf.Salt,
+		KeepNodeNames: conf.KeepNodeNames,
+		Labels:        trace.DefaultLabelAllowlist,
+		Annotations:   trace.DefaultAnnotationAllowlist,
+		Tolerations:   trace.DefaultTolerationAllowlist,
+	}
+	if conf.Labels != nil {
+		opts.Labels = conf.Labels
+	}
+	if conf.Annotations != nil {
+		opts.Annotations = conf.Annotations
+	}
+	if conf.Tolerations != nil {
+		opts.Tolerations = conf.Tolerations
+	}
+
+	return trace.NewAnonymizer(opts)
+}
+
+// BuildUsageNoise builds pod.UsageNoise with the given UsageNoiseConfig, or no noise if nil.
+// Returns error if the config is invalid.
+func BuildUsageNoise(conf *UsageNoiseConfig) (pod.UsageNoise, error) {
+	if conf == nil {
+		return pod.UsageNoise{Model: pod.NoNoise}, nil
+	}
+
+	noise := pod.UsageNoise{
+		Model:     pod.NoiseModel(conf.Model),
+		Amplitude: conf.Amplitude,
+		Seed:      conf.Seed,
+	}
+	if err := noise.Validate(); err != nil {
+		return pod.UsageNoise{}, err
+	}
+
+	return noise, nil
+}
+
+// BuildOvercommit builds the overcommit ratios and node.EvictionPolicy with the given
+// OvercommitConfig, or neither if nil.
+// Returns error if the config is invalid.
+func BuildOvercommit(conf *OvercommitConfig) (map[v1.ResourceName]float64, *node.EvictionPolicy, error) {
+	if conf == nil {
+		return nil, nil, nil
+	}
+
+	for rsrc, ratio := range conf.Ratios {
+		if ratio <= 0 || math.IsNaN(ratio) || math.IsInf(ratio, 0) {
+			return nil, nil, strongerrors.InvalidArgument(
+				errors.Errorf("invalid overcommit ratio of %s: %v", rsrc, ratio))
+		}
+		if pod.IsDeviceResource(rsrc) {
+			return nil, nil, strongerrors.InvalidArgument(
+				errors.Errorf("device resource %s cannot be overcommitted", rsrc))
+		}
+	}
+
+	policy := &node.EvictionPolicy{PressureTransitionPeriod: node.DefaultPressureTransitionPeriod}
+	if conf.MemoryAvailable != "" {
+		q, err := resource.ParseQuantity(conf.MemoryAvailable)
+		if err != nil {
+			return nil, nil, strongerrors.InvalidArgument(
+				errors.Errorf("invalid memoryAvailable %q: %s", conf.MemoryAvailable, err.Error()))
+		}
+		policy.MemoryAvailable = q
+	}
+	if conf.PressureTransitionPeriod < 0 {
+		return nil, nil, strongerrors.InvalidArgument(
+			errors.Errorf("invalid pressureTransitionPeriod %d", conf.PressureTransitionPeriod))
+	} else if conf.PressureTransitionPeriod > 0 {
+		policy.PressureTransitionPeriod = time.Duration(conf.PressureTransitionPeriod) * time.Second
+	}
+
+	return conf.Ratios, policy, nil
+}
+
+// BuildSaturationThreshold returns the saturation threshold of the balance metrics, or
+// metrics.DefaultSaturationThreshold if 0.
+// Returns error if the threshold is negative.
+func BuildSaturationThreshold(threshold float64) (float64, error) {
+	if threshold == 0 {
+		return metrics.DefaultSaturationThreshold, nil
+	}
+	if threshold < 0 || math.IsNaN(threshold) {
+		return 0, strongerrors.InvalidArgument(
+			errors.Errorf("invalid saturationThreshold %v", threshold))
+	}
+
+	return threshold, nil
+}
+
+// BuildStartupLatency builds a pod.StartupLatency with the given StartupLatencyConfig, or one with
+// no latency if nil.
+// Returns error if the config is invalid.
+func BuildStartupLatency(conf *StartupLatencyConfig) (pod.StartupLatency, error) {
+	if conf == nil {
+		return pod.StartupLatency{}, nil
+	}
+
+	if conf.BindSeconds < 0 || math.IsNaN(conf.BindSeconds) {
+		return pod.StartupLatency{}, strongerrors.InvalidArgument(
+			errors.Errorf("invalid bindSeconds %v", conf.BindSeconds))
+	}
+	if conf.InitSeconds < 0 || math.IsNaN(conf.InitSeconds) {
+		return pod.StartupLatency{}, strongerrors.InvalidArgument(
+			errors.Errorf("invalid initSeconds %v", conf.InitSeconds))
+	}
+
+	var bandwidth int64
+	if conf.ImagePullBandwidth != "" {
+		q, err := resource.ParseQuantity(conf.ImagePullBandwidth)
+		if err != nil || q.Sign() <= 0 {
+			return pod.StartupLatency{}, strongerrors.InvalidArgument(
+				errors.Errorf("invalid imagePullBandwidth %q", conf.ImagePullBandwidth))
+		}
+		bandwidth = q.Value()
+	}
+
+	return pod.StartupLatency{
+		Bind:               time.Duration(conf.BindSeconds * float64(time.Second)),
+		ImagePullBandwidth: bandwidth,
+		Init:               time.Duration(conf.InitSeconds * float64(time.Second)),
+	}, nil
+}
+
+// DefaultMaxPods is the default number of pods that a node can run, the default of the kubelet.
+const DefaultMaxPods = 110
+
+// BuildMaxPods returns the number of pods that a node can run unless its config specifies the pods
+// resource, or DefaultMaxPods if maxPods is 0.
+// Returns error if maxPods is negative.
+func BuildMaxPods(maxPods int) (int64, error) {
+	if maxPods == 0 {
+		return DefaultMaxPods, nil
+	}
+	if maxPods < 0 {
+		return 0, strongerrors.InvalidArgument(errors.Errorf("invalid maxPods %d", maxPods))
+	}
+
+	return int64(maxPods), nil
+}
+
+// BuildPodsPerTick returns the maximum number of pods scheduled at each tick, or 0 if unlimited.
+// Returns error if podsPerTick is negative.
+func BuildPodsPerTick(podsPerTick int) (int, error) {
+	if podsPerTick < 0 {
+		return 0, strongerrors.InvalidArgument(errors.Errorf("invalid podsPerTick %d", podsPerTick))
+	}
+
+	return podsPerTick, nil
+}
+
+// BuildBackoff builds queue.BackoffPolicy with the given BackoffConfig, or nil if nil.
+// Returns error if a duration is negative, maxSeconds is less than initialSeconds, or maxRetries is
+// negative.
+func BuildBackoff(conf *BackoffConfig) (*queue.BackoffPolicy, error) {
+	if conf == nil {
+		return nil, nil
+	}
+
+	policy := &queue.BackoffPolicy{
+		Initial:              queue.DefaultInitialBackoff,
+		Max:                  queue.DefaultMaxBackoff,
+		UnschedulableTimeout: queue.DefaultUnschedulableTimeout,
+		MaxRetries:           conf.MaxRetries,
+	}
+	for _, field := range []struct {
+		name    string
+		seconds float64
+		dur     *time.Duration
+	}{
+		{"initialSeconds", conf.InitialSeconds, &policy.Initial},
+		{"maxSeconds", conf.MaxSeconds, &policy.Max},
+		{"unschedulableSeconds", conf.UnschedulableSeconds, &policy.UnschedulableTimeout},
+	} {
+		if field.seconds < 0 || math.IsNaN(field.seconds) || math.IsInf(field.seconds, 0) {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("invalid %s of backoff: %v", field.name, field.seconds))
+		}
+		if field.seconds > 0 {
+			*field.dur = time.Duration(field.seconds * float64(time.Second))
+		}
+	}
+
+	if policy.Max < policy.Initial {
+		return nil, strongerrors.InvalidArgument(
+			errors.Errorf("maxSeconds of backoff %v is less than initialSeconds %v",
+				policy.Max.Seconds(), policy.Initial.Seconds()))
+	}
+	if conf.MaxRetries < 0 {
+		return nil, strongerrors.InvalidArgument(
+			errors.Errorf("invalid maxRetries of backoff: %d", conf.MaxRetries))
+	}
+
+	return policy, nil
+}
+
+// Kinds of the queue of the pending pods (see QueueConfig.Kind).
+const (
+	PriorityQueueKind  = "priority"
+	FIFOQueueKind      = "fifo"
+	FairShareQueueKind = "fairshare"
+)
+
+// Orders of the pending pods in the priority queue (see QueueConfig.Order).
+const (
+	PriorityQueueOrder = "priority"
+	EDFQueueOrder      = "edf"
+	LLFQueueOrder      = "llf"
+)
+
+// BuildQueue builds the queue of the pending pods with the given QueueConfig, or a priority queue if
+// nil.
+// Returns error if the kind is not supported, the config has tenantLabel or weights for a kind other
+// than fairshare, or a weight is not positive.
+func BuildQueue(conf *QueueConfig) (queue.PodQueue, error) {
+	if conf == nil {
+		return queue.NewPriorityQueue(), nil
+	}
+
+	if conf.Kind != FairShareQueueKind && (conf.TenantLabel != "" || len(conf.Weights) > 0) {
+		return nil, strongerrors.InvalidArgument(
+			errors.New("tenantLabel and weights are supported only with queue kind fairshare"))
+	}
+
+	if conf.Order != "" && conf.Kind != "" && conf.Kind != PriorityQueueKind {
+		return nil, strongerrors.InvalidArgument(errors.New("order is supported only with queue kind priority"))
+	}
+
+	var q queue.PodQueue
+	switch conf.Kind {
+	case "", PriorityQueueKind:
+		switch conf.Order {
+		case "", PriorityQueueOrder:
+			q = queue.NewPriorityQueue()
+		case EDFQueueOrder:
+			q = queue.NewPriorityQueueWithComparator(queue.EarliestDeadlineFirst)
+		case LLFQueueOrder:
+			q = queue.NewPriorityQueueWithComparator(queue.LeastLaxityFirst)
+		default:
+			return nil, strongerrors.InvalidArgument(errors.Errorf("queue order %q is not supported", conf.Order))
+		}
+	case FIFOQueueKind:
+		q = queue.NewFIFOQueue()
+	case FairShareQueueKind:
+		for tenant, weight := range conf.Weights {
+			if weight <= 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+				return nil, strongerrors.InvalidArgument(
+					errors.Errorf("invalid weight of tenant %q: %v", tenant, weight))
+			}
+		}
+		q = queue.NewFairShareQueue(conf.TenantLabel, conf.Weights)
+	default:
+		return nil, strongerrors.InvalidArgument(errors.Errorf("queue kind %q is not supported", conf.Kind))
+	}
+
+	if conf.HoldPodGroups {
+		q = queue.NewPodGroupQueue(q)
+	}
+
+	return q, nil
+}
+
+// QueueName returns the name of the queue built by BuildQueue with the given QueueConfig: its kind
+// followed by its order if not the default one (e.g., "priority/edf").
+func QueueName(conf *QueueConfig) string {
+	if conf == nil {
+		return PriorityQueueKind
+	}
+
+	kind := conf.Kind
+	if kind == "" {
+		kind = PriorityQueueKind
+	}
+	if conf.Order == "" || conf.Order == PriorityQueueOrder {
+		return kind
+	}
+	return kind + "/" + conf.Order
+}
+
+// BuildAPIAddress returns the TCP address on which the API is served, or empty if not served.
+// Returns error if apiPort is not a valid port.
+func BuildAPIAddress(apiPort int) (string, error) {
+	if apiPort < 0 || apiPort > 65535 {
+		return "", strongerrors.InvalidArgument(errors.Errorf("invalid apiPort %d", apiPort))
+	}
+	if apiPort == 0 {
+		return "", nil
+	}
+
+	return fmt.Sprintf(":%d", apiPort), nil
+}
+
+// Clock modes of the simulation (see Config.ClockMode).
+const (
+	VirtualClockMode     = "virtual"
+	RealTimeClockMode    = "realtime"
+	FastForwardClockMode = "fastforward"
+)
+
+// ClockMode is how the clock of the simulation advances.
+type ClockMode struct {
+	// RealTime paces the simulation to the wall clock multiplied by SpeedFactor.
+	RealTime    bool
+	SpeedFactor float64
+	// FastForward skips the ticks at which nothing happens.
+	FastForward bool
+}
+
+// BuildClockMode builds a ClockMode with the clockMode and speedFactor fields of the config, or with
+// the realTime and fastForward fields if clockMode is empty.
+// Returns error if the mode is not supported or conflicts with realTime or fastForward, or the speed
+// factor is not positive or given for a mode other than realtime.
+func BuildClockMode(conf *Config) (ClockMode, error) {
+	mode := ClockMode{RealTime: conf.RealTime, FastForward: conf.FastForward, SpeedFactor: 1}
+	switch conf.ClockMode {
+	case "":
+	case VirtualClockMode, RealTimeClockMode, FastForwardClockMode:
+		if (conf.RealTime && conf.ClockMode != RealTimeClockMode) ||
+			(conf.FastForward && conf.ClockMode != FastForwardClockMode) {
+			return ClockMode{}, strongerrors.InvalidArgument(
+				errors.Errorf("clockMode %s conflicts with realTime or fastForward", conf.ClockMode))
+		}
+		mode.RealTime = conf.ClockMode == RealTimeClockMode
+		mode.FastForward = conf.ClockMode == FastForwardClockMode
+	default:
+		return ClockMode{}, strongerrors.InvalidArgument(
+			errors.Errorf("clockMode %q is not supported", conf.ClockMode))
+	}
+
+	if conf.SpeedFactor != 0 {
+		if conf.SpeedFactor < 0 || math.IsNaN(conf.SpeedFactor) || math.IsInf(conf.SpeedFactor, 0) {
+			return ClockMode{}, strongerrors.InvalidArgument(
+				errors.Errorf("invalid speedFactor %v", conf.SpeedFactor))
+		}
+		if !mode.RealTime {
+			return ClockMode{}, strongerrors.InvalidArgument(
+				errors.New("speedFactor is supported only with clockMode realtime"))
+		}
+		mode.SpeedFactor = conf.SpeedFactor
+	}
+
+	return mode, nil
+}
+
+// BuildPriorityClasses builds pod.PriorityClasses with the given PriorityClassConfig.
+// Returns error if the config is invalid.
+func BuildPriorityClasses(conf []PriorityClassConfig) (*pod.PriorityClasses, error) {
+	classes := make([]pod.PriorityClass, 0, len(conf))
+	for _, classConf := range conf {
+		classes = append(classes, pod.PriorityClass{
+			Name:             classConf.Name,
+			Value:            classConf.Value,
+			GlobalDefault:    classConf.GlobalDefault,
+			PreemptionPolicy: pod.PreemptionPolicy(classConf.PreemptionPolicy),
+		})
+	}
+
+	return pod.NewPriorityClasses(classes)
+}
+
+// BuildNamespaces builds pod.Namespaces with the given NamespaceConfig.
+// Returns error if the config is invalid.
+func BuildNamespaces(conf []NamespaceConfig) (*pod.Namespaces, error) {
+	namespaces := make([]pod.Namespace, 0, len(conf))
+	for _, nsConf := range conf {
+		ns := pod.Namespace{Name: nsConf.Name}
+		if len(nsConf.ResourceQuota) > 0 {
+			quota, err := util.BuildResourceList(nsConf.ResourceQuota)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid ResourceQuota of namespace %s", nsConf.Name)
+			}
+			ns.Quota = quota
+		}
+		if nsConf.LimitRange != nil {
+			lr, err := buildLimitRange(*nsConf.LimitRange)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid LimitRange of namespace %s", nsConf.Name)
+			}
+			ns.LimitRange = lr
+		}
+		namespaces = append(namespaces, ns)
+	}
+
+	return pod.NewNamespaces(namespaces)
+}
+
+// buildLimitRange builds pod.LimitRange with the given LimitRangeConfig.
+// Returns error if failed to parse.
+func buildLimitRange(conf LimitRangeConfig) (*pod.LimitRange, error) {
+	lr := &pod.LimitRange{}
+	var err error
+	if lr.Default, err = util.BuildResourceList(conf.Default); err != nil {
+		return nil, err
+	}
+	if lr.DefaultRequest, err = util.BuildResourceList(conf.DefaultRequest); err != nil {
+		return nil, err
+	}
+	if lr.Min, err = util.BuildResourceList(conf.Min); err != nil {
+		return nil, err
+	}
+	if lr.Max, err = util.BuildResourceList(conf.Max); err != nil {
+		return nil, err
+	}
+
+	return lr, nil
+}
+
+// BuildGenerators builds workload.Generator with the given GeneratorConfig.
+// Returns error if the config is invalid or the names are not unique.
+func BuildGenerators(conf []GeneratorConfig) ([]*workload.Generator, error) {
+	generators := make([]*workload.Generator, 0, len(conf))
+	names := map[string]bool{}
+	for _, genConf := range conf {
+		if names[genConf.Name] {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("duplicate generator name %q", genConf.Name))
+		}
+		names[genConf.Name] = true
+
+		gen := &workload.Generator{
+			Name:      genConf.Name,
+			Namespace: genConf.Namespace,
+			Count:     genConf.Count,
+			Seed:      genConf.Seed,
+			Arrival: workload.Arrival{
+				Process:   workload.ArrivalProcess(genConf.Arrival),
+				Rate:      genConf.Rate,
+				BurstSize: genConf.BurstSize,
+			},
+		}
+		for _, d := range []struct {
+			name string
+			conf DistributionConfig
+			dist *workload.Distribution
+		}{
+			{"cpu", genConf.CPU, &gen.CPU},
+			{"memory", genConf.Memory, &gen.Memory},
+			{"duration", genConf.Duration, &gen.Duration},
+		} {
+			dist, err := buildDistribution(d.conf)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid %s distribution of generator %s", d.name, genConf.Name)
+			}
+			*d.dist = dist
+		}
+		for _, p := range genConf.Priorities {
+			gen.Priorities = append(gen.Priorities, workload.PriorityWeight{Priority: p.Priority, Weight: p.Weight})
+		}
+
+		if err := gen.Validate(); err != nil {
+			return nil, err
+		}
+		generators = append(generators, gen)
+	}
+
+	return generators, nil
+}
+
+// BuildFaults builds submitter.Fault with the given FaultConfig.
+// Returns error if failed to parse or the config is invalid.
+func BuildFaults(conf []FaultConfig) ([]submitter.Fault, error) {
+	faults := make([]submitter.Fault, 0, len(conf))
+	for _, faultConf := range conf {
+		kind := submitter.FaultKind(faultConf.Kind)
+		switch kind {
+		case submitter.NodeCrash, submitter.NodeNotReady:
+			if len(faultConf.Ratios) > 0 {
+				return nil, strongerrors.InvalidArgument(
+					errors.Errorf("ratios of %s fault of node %s", kind, faultConf.Node))
+			}
+		case submitter.NodeDegradation:
+			if len(faultConf.Ratios) == 0 {
+				return nil, strongerrors.InvalidArgument(
+					errors.Errorf("no ratios of %s fault of node %s", kind, faultConf.Node))
+			}
+			if err := node.ValidateDegradation(faultConf.Ratios); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, strongerrors.InvalidArgument(errors.Errorf("fault kind %q is not supported", kind))
+		}
+
+		at, err := time.Parse(time.RFC3339, faultConf.At)
+		if err != nil {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("invalid clock of %s fault of node %s: %s", kind, faultConf.Node, err.Error()))
+		}
+		fault := submitter.Fault{
+			Kind:   kind,
+			Node:   faultConf.Node,
+			From:   clock.NewClock(at),
+			Ratios: faultConf.Ratios,
+		}
+		if faultConf.Until != "" {
+			until, err := time.Parse(time.RFC3339, faultConf.Until)
+			if err != nil {
+				return nil, strongerrors.InvalidArgument(
+					errors.Errorf("invalid end of %s fault of node %s: %s", kind, faultConf.Node, err.Error()))
+			}
+			untilClock := clock.NewClock(until)
+			fault.Until = &untilClock
+		}
+
+		faults = append(faults, fault)
+	}
+
+	return faults, nil
+}
+
+// BuildAutoscaler builds autoscaler.Autoscaler with the given AutoscalerConfig, or returns nil if
+// the config is nil.
+// Returns error if the config is invalid.
+func BuildAutoscaler(conf *AutoscalerConfig, startClock string, maxPods int64) (*autoscaler.Autoscaler, error) {
+	if conf == nil {
+		return nil, nil
+	}
+
+	groups := make([]autoscaler.NodeGroup, 0, len(conf.NodeGroups))
+	for _, groupConf := range conf.NodeGroups {
+		template, err := BuildNode(groupConf.Template, startClock, maxPods)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid template of node group %s", groupConf.Name)
+		}
+		systemPods, err := BuildSystemPods(groupConf.Template.SystemPods, groupConf.Name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid template of node group %s", groupConf.Name)
+		}
+		overhead := v1.ResourceList{}
+		for _, p := range systemPods {
+			overhead = util.ResourceListSum(overhead, util.PodTotalResourceRequests(p))
+		}
+		if len(systemPods) > 0 {
+			overhead[v1.ResourcePods] = *resource.NewQuantity(int64(len(systemPods)), resource.DecimalSI)
+		}
+
+		groups = append(groups, autoscaler.NodeGroup{
+			Name:     groupConf.Name,
+			Template: template,
+			Overhead: overhead,
+			MinSize:  groupConf.MinSize,
+			MaxSize:  groupConf.MaxSize,
+		})
+	}
+
+	policy := autoscaler.Policy{
+		ScaleDownUtilizationThreshold: conf.ScaleDownUtilizationThreshold,
+		ScaleDownTicks:                conf.ScaleDownTicks,
+		ProvisioningDelay:             time.Duration(conf.ProvisioningSeconds * float64(time.Second)),
+	}
+	if policy.ScaleDownUtilizationThreshold == 0 {
+		policy.ScaleDownUtilizationThreshold = autoscaler.DefaultScaleDownUtilizationThreshold
+	}
+	if policy.ScaleDownTicks == 0 {
+		policy.ScaleDownTicks = autoscaler.DefaultScaleDownTicks
+	}
+
+	return autoscaler.NewAutoscaler(groups, policy)
+}
+
+// buildDistribution builds workload.Distribution with the given DistributionConfig.
+// Returns error if a parameter is not a quantity.
+func buildDistribution(conf DistributionConfig) (workload.Distribution, error) {
+	dist := workload.Distribution{Kind: workload.DistributionKind(conf.Distribution)}
+	for _, param := range []struct {
+		name  string
+		str   string
+		value *float64
+	}{
+		{"value", conf.Value, &dist.Value},
+		{"min", conf.Min, &dist.Min},
+		{"max", conf.Max, &dist.Max},
+		{"mean", conf.Mean, &dist.Mean},
+		{"stdDev", conf.StdDev, &dist.StdDev},
+	} {
+		if param.str == "" {
+			continue
+		}
+		q, err := resource.ParseQuantity(param.str)
+		if err != nil {
+			return workload.Distribution{}, strongerrors.InvalidArgument(
+				errors.Errorf("invalid %s %q: %s", param.name, param.str, err.Error()))
+		}
+		*param.value = float64(q.MilliValue()) / 1000
+	}
+
+	return dist, nil
+}
+
+// systemPodPriority is the priority of system pods, the same as the system-node-critical
+// PriorityClass.
+const systemPodPriority int32 = 2000001000
+
+// BuildSystemPods builds the system pods on the node with the given SystemPodConfig.
+// Each pod runs throughout the simulation, with the priority of the system-node-critical
+// PriorityClass.
+// Returns error if the config is invalid.
+func BuildSystemPods(conf []SystemPodConfig, nodeName string) ([]*v1.Pod, error) {
+	pods := make([]*v1.Pod, 0, len(conf))
+	for _, podConf := range conf {
+		if podConf.Name == "" {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("name of a system pod on node %s must not be empty", nodeName))
+		}
+		namespace := podConf.Namespace
+		if namespace == "" {
+			namespace = metav1.NamespaceSystem
+		}
+
+		requests, err := util.BuildResourceList(podConf.Requests)
+		if err != nil {
+			return nil, err
+		}
+		usage, err := util.BuildResourceList(podConf.Usage)
+		if err != nil {
+			return nil, err
+		}
+
+		// The resources not listed in the usage are used as much as requested.
+		usageYAML := fmt.Sprintf("- seconds: %d\n", math.MaxInt32)
+		if len(usage) > 0 {
+			usageYAML += "  usage:\n"
+			rsrcs := make([]string, 0, len(usage))
+			for rsrc := range usage {
+				rsrcs = append(rsrcs, string(rsrc))
+			}
+			sort.Strings(rsrcs)
+			for _, rsrc := range rsrcs {
+				q := usage[v1.ResourceName(rsrc)]
+				usageYAML += fmt.Sprintf("    %s: %s\n", rsrc, q.String())
+			}
+		}
+
+		priority := systemPodPriority
+		pods = append(pods, &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        podConf.Name + "-" + nodeName,
+				Namespace:   namespace,
+				Annotations: map[string]string{pod.ResourceUsageAnnotation: usageYAML},
+			},
+			Spec: v1.PodSpec{
+				NodeName:          nodeName,
+				PriorityClassName: "system-node-critical",
+				Priority:          &priority,
+				Containers: []v1.Container{{
+					Name:      podConf.Name,
+					Resources: v1.ResourceRequirements{Requests: requests},
+				}},
+			},
+		})
+	}
+
+	return pods, nil
+}
+
+// BuildImageSizes builds the sizes in bytes of the images, keyed by their names, with the given
+// ImageConfig.
+// Returns error if the config is invalid.
+func BuildImageSizes(conf []ImageConfig) (map[string]int64, error) {
+	sizes := make(map[string]int64, len(conf))
+	for _, imageConf := range conf {
+		image, err := buildImage(imageConf)
+		if err != nil {
+			return nil, err
+		}
+		sizes[image.Names[0]] = image.SizeBytes
+	}
+
+	return sizes, nil
+}
+
+// buildImage builds a v1.ContainerImage with the given ImageConfig.
+// Returns error if the config is invalid.
+func buildImage(conf ImageConfig) (v1.ContainerImage, error) {
+	if conf.Name == "" {
+		return v1.ContainerImage{}, strongerrors.InvalidArgument(
+			errors.New("name of an image must not be empty"))
+	}
+
+	var size int64
+	if conf.Size != "" {
+		q, err := resource.ParseQuantity(conf.Size)
+		if err != nil || q.Sign() < 0 {
+			return v1.ContainerImage{}, strongerrors.InvalidArgument(
+				errors.Errorf("invalid size of image %q: %q", conf.Name, conf.Size))
+		}
+		size = q.Value()
+	}
+
+	return v1.ContainerImage{
+		Names:     []string{node.NormalizedImageName(conf.Name)},
+		SizeBytes: size,
+	}, nil
+}
+
+// BuildFileOptions builds logfile.Options with the compression and the maximum size in MiB.
+func BuildFileOptions(compression string, maxSize int) logfile.Options {
+	return logfile.Options{
+		Compression: compression,
+		MaxSize:     int64(maxSize) << 20,
+	}
+}
+
 func buildFormatter(conf string) (metrics.Formatter, error) {
 	switch conf {
 	case "JSON":
@@ -89,18 +1170,39 @@ func buildFormatter(conf string) (metrics.Formatter, error) {
 		return &metrics.HumanReadableFormatter{}, nil
 	case "table":
 		return &metrics.TableFormatter{}, nil
+	case "CSV":
+		return &metrics.CSVFormatter{}, nil
 	default:
 		return nil, strongerrors.InvalidArgument(errors.Errorf("formatter %q is not supported", conf))
 	}
 }
 
-// BuildNode builds a *v1.Node with the given NodeConfig.
-// Returns error if failed to parse.
-func BuildNode(conf NodeConfig, startClock string) (*v1.Node, error) {
+// BuildNode builds a *v1.Node with the given NodeConfig, which can run maxPods pods unless the
+// config specifies the pods resource.
+// The node is labeled with its name as its hostname unless labeled otherwise (see SetHostnameLabel),
+// and the NoExecute taints without timeAdded are added at the start clock.
+// Returns error if failed to parse or a taint is invalid.
+func BuildNode(conf NodeConfig, startClock string, maxPods int64) (*v1.Node, error) {
 	allocatable, err := util.BuildResourceList(conf.Status.Allocatable)
 	if err != nil {
 		return nil, err
 	}
+	if _, ok := allocatable[v1.ResourcePods]; !ok {
+		allocatable[v1.ResourcePods] = *resource.NewQuantity(maxPods, resource.DecimalSI)
+	}
+	capacity, err := buildCapacity(conf.Status.Capacity, allocatable)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid capacity of node %s", conf.Metadata.Name)
+	}
+
+	var images []v1.ContainerImage
+	for _, imageConf := range conf.Status.Images {
+		image, err := buildImage(imageConf)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
 
 	clock := time.Now()
 	if startClock != "" {
@@ -110,23 +1212,106 @@ func BuildNode(conf NodeConfig, startClock string) (*v1.Node, error) {
 		}
 	}
 
+	spec := *conf.Spec.DeepCopy()
+	for i, taint := range spec.Taints {
+		if err := node.ValidateTaint(taint); err != nil {
+			return nil, err
+		}
+		if taint.Effect == v1.TaintEffectNoExecute && taint.TimeAdded == nil {
+			added := metav1.NewTime(clock)
+			spec.Taints[i].TimeAdded = &added
+		}
+	}
+
+	metadata := *conf.Metadata.DeepCopy()
+	SetHostnameLabel(&metadata)
+
 	node := v1.Node{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Node",
 			APIVersion: "v1",
 		},
-		ObjectMeta: conf.Metadata,
-		Spec:       conf.Spec,
+		ObjectMeta: metadata,
+		Spec:       spec,
 		Status: v1.NodeStatus{
-			Capacity:    allocatable,
+			Capacity:    capacity,
 			Allocatable: allocatable,
 			Conditions:  buildNodeCondition(metav1.NewTime(clock)),
+			Images:      images,
 		},
 	}
 
 	return &node, nil
 }
 
+// buildCapacity builds the capacity of a node with the config and its allocatable resources, which
+// the capacity of the resources not in the config defaults to.
+// Returns error if failed to parse, or a resource is less than allocatable.
+func buildCapacity(conf map[v1.ResourceName]string, allocatable v1.ResourceList) (v1.ResourceList, error) {
+	if len(conf) == 0 {
+		return allocatable, nil
+	}
+
+	capacity, err := util.BuildResourceList(conf)
+	if err != nil {
+		return nil, err
+	}
+	for rsrc, alloc := range allocatable {
+		c, ok := capacity[rsrc]
+		if !ok {
+			capacity[rsrc] = alloc
+		} else if c.Cmp(alloc) < 0 {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("%s capacity %s is less than allocatable %s", rsrc, c.String(), alloc.String()))
+		}
+	}
+
+	return capacity, nil
+}
+
+// SetHostnameLabel labels the node of the metadata with its name as kubernetes.io/hostname, as the
+// kubelet does, unless labeled already, so that the hostname can be the topology key of the
+// inter-pod affinity.
+func SetHostnameLabel(metadata *metav1.ObjectMeta) {
+	if _, ok := metadata.Labels[v1.LabelHostname]; ok {
+		return
+	}
+	if metadata.Labels == nil {
+		metadata.Labels = map[string]string{}
+	}
+	metadata.Labels[v1.LabelHostname] = metadata.Name
+}
+
+// BuildReservation builds a *reservation.Reservation with the given ReservationConfig.
+// Returns error if failed to parse.
+func BuildReservation(conf ReservationConfig) (*reservation.Reservation, error) {
+	resource, err := util.BuildResourceList(conf.Resource)
+	if err != nil {
+		return nil, err
+	}
+
+	start, err := time.Parse(time.RFC3339, conf.Start)
+	if err != nil {
+		return nil, strongerrors.InvalidArgument(
+			errors.Errorf("invalid start of reservation %q: %s", conf.Name, err.Error()))
+	}
+
+	end, err := time.Parse(time.RFC3339, conf.End)
+	if err != nil {
+		return nil, strongerrors.InvalidArgument(
+			errors.Errorf("invalid end of reservation %q: %s", conf.Name, err.Error()))
+	}
+
+	return &reservation.Reservation{
+		Name:     conf.Name,
+		NodeName: conf.NodeName,
+		Zone:     conf.Zone,
+		Resource: resource,
+		Start:    clock.NewClock(start),
+		End:      clock.NewClock(end),
+	}, nil
+}
+
 func buildNodeCondition(clock metav1.Time) []v1.NodeCondition {
 	return []v1.NodeCondition{
 		{
@@ -24,7 +24,13 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/metrics"
+	"simulator/pkg/autoscaler"
+	"simulator/pkg/clock"
+	"simulator/pkg/metrics"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+	"simulator/pkg/submitter"
+	"simulator/pkg/workload"
 )
 
 func TestBuildMetricsLogger(t *testing.T) {
@@ -40,6 +46,13 @@ func TestBuildMetricsLogger(t *testing.T) {
 	}})
 	assert.EqualError(t, err, "formatter \"invalid\" is not supported")
 
+	_, err = BuildMetricsLogger([]MetricsLoggerConfig{{
+		Dest:          "foo",
+		Formatter:     "CSV",
+		FlushInterval: -1,
+	}})
+	assert.EqualError(t, err, "flushInterval of foo must not be negative")
+
 	// TODO: Test correct cases
 }
 
@@ -62,6 +75,9 @@ func TestBuildFormatter(t *testing.T) {
 		t.Errorf("got: %+v\nwant: %+v", actual2, expected2)
 	}
 
+	actual3, _ := buildFormatter("CSV")
+	assert.IsType(t, &metrics.CSVFormatter{}, actual3)
+
 	_, err := buildFormatter("invalid")
 	assert.EqualError(t, err, "formatter \"invalid\" is not supported")
 }
@@ -95,20 +111,25 @@ func TestBuildNode(t *testing.T) {
 				"nvidia.com/gpu": "1",
 			},
 		},
-	}, nowStr)
+	}, nowStr, DefaultMaxPods)
 
 	allocatable := v1.ResourceList{
 		"cpu":            resource.MustParse("2"),
 		"memory":         resource.MustParse("4Gi"),
 		"nvidia.com/gpu": resource.MustParse("1"),
+		"pods":           *resource.NewQuantity(110, resource.DecimalSI),
 	}
 
+	// The node is labeled with its hostname.
+	expectedMetadata := *metadata.DeepCopy()
+	expectedMetadata.Labels[v1.LabelHostname] = "node-0"
+
 	expected := v1.Node{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Node",
 			APIVersion: "v1",
 		},
-		ObjectMeta: metadata,
+		ObjectMeta: expectedMetadata,
 		Spec:       spec,
 		Status: v1.NodeStatus{
 			Capacity:    allocatable,
@@ -122,6 +143,56 @@ func TestBuildNode(t *testing.T) {
 	}
 }
 
+func TestBuildNodeTaints(t *testing.T) {
+	start := "2019-01-01T00:00:00Z"
+	startTime := metav1.NewTime(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	conf := NodeConfig{
+		Metadata: metav1.ObjectMeta{Name: "node-0"},
+		Spec: v1.NodeSpec{Taints: []v1.Taint{
+			{Key: "gpu", Effect: v1.TaintEffectNoSchedule},
+			{Key: "maintenance", Effect: v1.TaintEffectNoExecute},
+		}},
+	}
+
+	node, err := BuildNode(conf, start, DefaultMaxPods)
+	assert.NoError(t, err)
+	assert.Nil(t, node.Spec.Taints[0].TimeAdded)
+	assert.Equal(t, &startTime, node.Spec.Taints[1].TimeAdded)
+	assert.Nil(t, conf.Spec.Taints[1].TimeAdded)
+
+	conf.Spec.Taints = []v1.Taint{{Effect: v1.TaintEffectNoSchedule}}
+	_, err = BuildNode(conf, start, DefaultMaxPods)
+	assert.EqualError(t, err, "empty key of taint")
+	conf.Spec.Taints = []v1.Taint{{Key: "gpu", Effect: "NoRun"}}
+	_, err = BuildNode(conf, start, DefaultMaxPods)
+	assert.EqualError(t, err, `invalid effect "NoRun" of taint gpu`)
+}
+
+func TestBuildNodeCapacity(t *testing.T) {
+	conf := NodeConfig{
+		Metadata: metav1.ObjectMeta{Name: "node-0"},
+		Status: NodeStatus{
+			Allocatable: map[v1.ResourceName]string{"cpu": "3", "nvidia.com/gpu": "4", "hugepages-2Mi": "1Gi"},
+			Capacity:    map[v1.ResourceName]string{"cpu": "4", "memory": "8Gi"},
+		},
+	}
+
+	node, err := BuildNode(conf, "2019-01-01T00:00:00Z", DefaultMaxPods)
+	assert.NoError(t, err)
+	capacity := node.Status.Capacity
+	assert.Equal(t, "4", capacity.Cpu().String())
+	assert.Equal(t, "8Gi", capacity.Memory().String())
+	gpu := capacity["nvidia.com/gpu"]
+	assert.Equal(t, "4", gpu.String())
+	hugepages := capacity["hugepages-2Mi"]
+	assert.Equal(t, "1Gi", hugepages.String())
+	assert.Equal(t, "3", node.Status.Allocatable.Cpu().String())
+
+	conf.Status.Capacity = map[v1.ResourceName]string{"nvidia.com/gpu": "2"}
+	_, err = BuildNode(conf, "2019-01-01T00:00:00Z", DefaultMaxPods)
+	assert.EqualError(t, err, "invalid capacity of node node-0: nvidia.com/gpu capacity 2 is less than allocatable 4")
+}
+
 func TestBuildNodeConfig(t *testing.T) {
 	now := metav1.NewTime(time.Now())
 
@@ -173,3 +244,384 @@ func TestBuildNodeConfig(t *testing.T) {
 		t.Errorf("got: %+v\nwant: %+v", actual, expected)
 	}
 }
+
+func TestBuildOvercommit(t *testing.T) {
+	ratios, policy, err := BuildOvercommit(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, ratios)
+	assert.Nil(t, policy)
+
+	ratios, policy, err = BuildOvercommit(&OvercommitConfig{
+		Ratios:          map[v1.ResourceName]float64{"cpu": 2},
+		MemoryAvailable: "100Mi",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[v1.ResourceName]float64{"cpu": 2}, ratios)
+	assert.Equal(t, "100Mi", policy.MemoryAvailable.String())
+	assert.Equal(t, 5*time.Minute, policy.PressureTransitionPeriod)
+
+	_, policy, err = BuildOvercommit(&OvercommitConfig{PressureTransitionPeriod: 60})
+	assert.NoError(t, err)
+	assert.True(t, policy.MemoryAvailable.IsZero())
+	assert.Equal(t, time.Minute, policy.PressureTransitionPeriod)
+
+	_, _, err = BuildOvercommit(&OvercommitConfig{Ratios: map[v1.ResourceName]float64{"cpu": 0}})
+	assert.EqualError(t, err, "invalid overcommit ratio of cpu: 0")
+	_, _, err = BuildOvercommit(&OvercommitConfig{MemoryAvailable: "lots"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `invalid memoryAvailable "lots"`)
+	}
+	_, _, err = BuildOvercommit(&OvercommitConfig{PressureTransitionPeriod: -1})
+	assert.EqualError(t, err, "invalid pressureTransitionPeriod -1")
+	_, _, err = BuildOvercommit(&OvercommitConfig{Ratios: map[v1.ResourceName]float64{"nvidia.com/gpu": 2}})
+	assert.EqualError(t, err, "device resource nvidia.com/gpu cannot be overcommitted")
+}
+
+func TestBuildSaturationThreshold(t *testing.T) {
+	threshold, err := BuildSaturationThreshold(0)
+	assert.NoError(t, err)
+	assert.Equal(t, metrics.DefaultSaturationThreshold, threshold)
+
+	threshold, err = BuildSaturationThreshold(0.8)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.8, threshold)
+
+	_, err = BuildSaturationThreshold(-1)
+	assert.EqualError(t, err, "invalid saturationThreshold -1")
+}
+
+func TestBuildSystemPods(t *testing.T) {
+	pods, err := BuildSystemPods([]SystemPodConfig{
+		{
+			Name:     "kube-proxy",
+			Requests: map[v1.ResourceName]string{"cpu": "100m", "memory": "128Mi"},
+			Usage:    map[v1.ResourceName]string{"memory": "64Mi", "cpu": "50m"},
+		},
+		{Name: "fluentd", Namespace: "logging", Requests: map[v1.ResourceName]string{"cpu": "200m"}},
+	}, "node-0")
+	assert.NoError(t, err)
+	if assert.Len(t, pods, 2) {
+		assert.Equal(t, "kube-proxy-node-0", pods[0].Name)
+		assert.Equal(t, "kube-system", pods[0].Namespace)
+		assert.Equal(t, "node-0", pods[0].Spec.NodeName)
+		assert.Equal(t, int32(2000001000), *pods[0].Spec.Priority)
+		assert.Equal(t, "- seconds: 2147483647\n  usage:\n    cpu: 50m\n    memory: 64Mi\n",
+			pods[0].Annotations["simulator/resource-usage"])
+		assert.Equal(t, resource.MustParse("128Mi"), pods[0].Spec.Containers[0].Resources.Requests["memory"])
+
+		assert.Equal(t, "fluentd-node-0", pods[1].Name)
+		assert.Equal(t, "logging", pods[1].Namespace)
+		assert.Equal(t, "- seconds: 2147483647\n", pods[1].Annotations["simulator/resource-usage"])
+	}
+
+	_, err = BuildSystemPods([]SystemPodConfig{{}}, "node-0")
+	assert.EqualError(t, err, "name of a system pod on node node-0 must not be empty")
+}
+
+func TestBuildImageSizes(t *testing.T) {
+	sizes, err := BuildImageSizes([]ImageConfig{
+		{Name: "nginx:1.15", Size: "100Mi"},
+		{Name: "busybox"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"nginx:1.15": 100 * 1024 * 1024, "busybox:latest": 0}, sizes)
+
+	_, err = BuildImageSizes([]ImageConfig{{Size: "1Gi"}})
+	assert.EqualError(t, err, "name of an image must not be empty")
+	_, err = BuildImageSizes([]ImageConfig{{Name: "nginx", Size: "big"}})
+	assert.EqualError(t, err, `invalid size of image "nginx": "big"`)
+
+	node, err := BuildNode(NodeConfig{Status: NodeStatus{
+		Images: []ImageConfig{{Name: "nginx", Size: "1Ki"}},
+	}}, "2019-01-01T00:00:00+09:00", DefaultMaxPods)
+	assert.NoError(t, err)
+	assert.Equal(t, []v1.ContainerImage{{Names: []string{"nginx:latest"}, SizeBytes: 1024}}, node.Status.Images)
+}
+
+func TestBuildStartupLatency(t *testing.T) {
+	startup, err := BuildStartupLatency(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, pod.StartupLatency{}, startup)
+
+	startup, err = BuildStartupLatency(&StartupLatencyConfig{
+		BindSeconds: 0.5, ImagePullBandwidth: "50Mi", InitSeconds: 3,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, pod.StartupLatency{
+		Bind: 500 * time.Millisecond, ImagePullBandwidth: 50 << 20, Init: 3 * time.Second,
+	}, startup)
+
+	_, err = BuildStartupLatency(&StartupLatencyConfig{BindSeconds: -1})
+	assert.EqualError(t, err, "invalid bindSeconds -1")
+	_, err = BuildStartupLatency(&StartupLatencyConfig{ImagePullBandwidth: "0"})
+	assert.EqualError(t, err, `invalid imagePullBandwidth "0"`)
+}
+
+func TestBuildPriorityClasses(t *testing.T) {
+	classes, err := BuildPriorityClasses([]PriorityClassConfig{
+		{Name: "batch", Value: 10, GlobalDefault: true, PreemptionPolicy: "Never"},
+	})
+	assert.NoError(t, err)
+
+	v1Pod := &v1.Pod{}
+	assert.NoError(t, classes.Admit(v1Pod))
+	assert.Equal(t, int32(10), *v1Pod.Spec.Priority)
+	assert.Equal(t, pod.PreemptNever, pod.GetPreemptionPolicy(v1Pod))
+
+	_, err = BuildPriorityClasses([]PriorityClassConfig{{Name: "batch", PreemptionPolicy: "never"}})
+	assert.EqualError(t, err, `invalid preemption policy "never" of PriorityClass batch`)
+}
+
+func TestBuildNamespaces(t *testing.T) {
+	namespaces, err := BuildNamespaces([]NamespaceConfig{{
+		Name:          "team-a",
+		ResourceQuota: map[v1.ResourceName]string{"pods": "2", "requests.cpu": "4"},
+		LimitRange:    &LimitRangeConfig{Default: map[v1.ResourceName]string{"cpu": "1"}},
+	}})
+	assert.NoError(t, err)
+	assert.True(t, namespaces.HasQuota("team-a"))
+
+	v1Pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "team-a"},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "container"}}},
+	}
+	assert.NoError(t, namespaces.ApplyLimitRange(v1Pod))
+	assert.Equal(t, "1", v1Pod.Spec.Containers[0].Resources.Requests.Cpu().String())
+
+	_, err = BuildNamespaces([]NamespaceConfig{{
+		Name: "team-a", ResourceQuota: map[v1.ResourceName]string{"requests.cpu": "one"},
+	}})
+	assert.EqualError(t, err, `invalid ResourceQuota of namespace team-a: invalid requests.cpu value "one"`)
+	_, err = BuildNamespaces([]NamespaceConfig{{
+		Name: "team-a", ResourceQuota: map[v1.ResourceName]string{"services": "1"},
+	}})
+	assert.EqualError(t, err, "resource services of ResourceQuota of namespace team-a is not supported")
+	_, err = BuildNamespaces([]NamespaceConfig{{
+		Name: "team-a", LimitRange: &LimitRangeConfig{Max: map[v1.ResourceName]string{"cpu": "one"}},
+	}})
+	assert.EqualError(t, err, `invalid LimitRange of namespace team-a: invalid cpu value "one"`)
+}
+
+func TestBuildMaxPods(t *testing.T) {
+	maxPods, err := BuildMaxPods(0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(110), maxPods)
+	maxPods, err = BuildMaxPods(30)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(30), maxPods)
+	_, err = BuildMaxPods(-1)
+	assert.EqualError(t, err, "invalid maxPods -1")
+
+	node, err := BuildNode(NodeConfig{Status: NodeStatus{
+		Allocatable: map[v1.ResourceName]string{"cpu": "1", "pods": "8"},
+	}}, "2019-01-01T00:00:00+09:00", maxPods)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(8), node.Status.Allocatable.Pods().Value())
+}
+
+func TestBuildPodsPerTick(t *testing.T) {
+	podsPerTick, err := BuildPodsPerTick(0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, podsPerTick)
+	podsPerTick, err = BuildPodsPerTick(50)
+	assert.NoError(t, err)
+	assert.Equal(t, 50, podsPerTick)
+	_, err = BuildPodsPerTick(-1)
+	assert.EqualError(t, err, "invalid podsPerTick -1")
+}
+
+func TestBuildAPIAddress(t *testing.T) {
+	addr, err := BuildAPIAddress(0)
+	assert.NoError(t, err)
+	assert.Equal(t, "", addr)
+	addr, err = BuildAPIAddress(8080)
+	assert.NoError(t, err)
+	assert.Equal(t, ":8080", addr)
+	_, err = BuildAPIAddress(65536)
+	assert.EqualError(t, err, "invalid apiPort 65536")
+}
+
+func TestBuildClockMode(t *testing.T) {
+	mode, err := BuildClockMode(&Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, ClockMode{SpeedFactor: 1}, mode)
+	mode, err = BuildClockMode(&Config{ClockMode: "realtime", SpeedFactor: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, ClockMode{RealTime: true, SpeedFactor: 10}, mode)
+	mode, err = BuildClockMode(&Config{FastForward: true})
+	assert.NoError(t, err)
+	assert.Equal(t, ClockMode{FastForward: true, SpeedFactor: 1}, mode)
+
+	_, err = BuildClockMode(&Config{ClockMode: "paused"})
+	assert.EqualError(t, err, `clockMode "paused" is not supported`)
+	_, err = BuildClockMode(&Config{ClockMode: "virtual", RealTime: true})
+	assert.EqualError(t, err, "clockMode virtual conflicts with realTime or fastForward")
+	_, err = BuildClockMode(&Config{ClockMode: "realtime", SpeedFactor: -1})
+	assert.EqualError(t, err, "invalid speedFactor -1")
+	_, err = BuildClockMode(&Config{ClockMode: "fastforward", SpeedFactor: 10})
+	assert.EqualError(t, err, "speedFactor is supported only with clockMode realtime")
+}
+
+func TestBuildQueue(t *testing.T) {
+	q, err := BuildQueue(nil)
+	assert.NoError(t, err)
+	assert.IsType(t, &queue.PriorityQueue{}, q)
+	q, err = BuildQueue(&QueueConfig{Kind: "fifo"})
+	assert.NoError(t, err)
+	assert.IsType(t, &queue.FIFOQueue{}, q)
+	q, err = BuildQueue(&QueueConfig{Kind: "fairshare", TenantLabel: "user", Weights: map[string]float64{"alice": 2}})
+	assert.NoError(t, err)
+	assert.IsType(t, &queue.FairShareQueue{}, q)
+	q, err = BuildQueue(&QueueConfig{Kind: "fifo", HoldPodGroups: true})
+	assert.NoError(t, err)
+	assert.IsType(t, &queue.PodGroupQueue{}, q)
+	q, err = BuildQueue(&QueueConfig{Order: "edf"})
+	assert.NoError(t, err)
+	assert.IsType(t, &queue.PriorityQueue{}, q)
+
+	_, err = BuildQueue(&QueueConfig{Kind: "lifo"})
+	assert.EqualError(t, err, `queue kind "lifo" is not supported`)
+	_, err = BuildQueue(&QueueConfig{Kind: "fifo", TenantLabel: "user"})
+	assert.EqualError(t, err, "tenantLabel and weights are supported only with queue kind fairshare")
+	_, err = BuildQueue(&QueueConfig{Kind: "fairshare", Weights: map[string]float64{"bob": 0}})
+	assert.EqualError(t, err, `invalid weight of tenant "bob": 0`)
+	_, err = BuildQueue(&QueueConfig{Order: "sjf"})
+	assert.EqualError(t, err, `queue order "sjf" is not supported`)
+	_, err = BuildQueue(&QueueConfig{Kind: "fifo", Order: "llf"})
+	assert.EqualError(t, err, "order is supported only with queue kind priority")
+
+	assert.Equal(t, "priority", QueueName(nil))
+	assert.Equal(t, "priority", QueueName(&QueueConfig{Order: "priority"}))
+	assert.Equal(t, "priority/llf", QueueName(&QueueConfig{Order: "llf"}))
+	assert.Equal(t, "fairshare", QueueName(&QueueConfig{Kind: "fairshare"}))
+}
+
+func TestBuildBackoff(t *testing.T) {
+	policy, err := BuildBackoff(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, policy)
+
+	policy, err = BuildBackoff(&BackoffConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, &queue.BackoffPolicy{
+		Initial:              queue.DefaultInitialBackoff,
+		Max:                  queue.DefaultMaxBackoff,
+		UnschedulableTimeout: queue.DefaultUnschedulableTimeout,
+	}, policy)
+
+	policy, err = BuildBackoff(&BackoffConfig{InitialSeconds: 0.5, MaxSeconds: 30, UnschedulableSeconds: 300, MaxRetries: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, &queue.BackoffPolicy{
+		Initial:              500 * time.Millisecond,
+		Max:                  30 * time.Second,
+		UnschedulableTimeout: 5 * time.Minute,
+		MaxRetries:           5,
+	}, policy)
+
+	_, err = BuildBackoff(&BackoffConfig{InitialSeconds: -1})
+	assert.EqualError(t, err, "invalid initialSeconds of backoff: -1")
+	_, err = BuildBackoff(&BackoffConfig{InitialSeconds: 20})
+	assert.EqualError(t, err, "maxSeconds of backoff 10 is less than initialSeconds 20")
+	_, err = BuildBackoff(&BackoffConfig{MaxRetries: -1})
+	assert.EqualError(t, err, "invalid maxRetries of backoff: -1")
+}
+
+func TestBuildFaults(t *testing.T) {
+	faults, err := BuildFaults([]FaultConfig{
+		{Kind: "crash", Node: "node-0", At: "2019-01-01T00:01:00Z"},
+		{Kind: "degradation", Node: "node-1", At: "2019-01-01T00:00:00Z", Until: "2019-01-01T00:10:00Z",
+			Ratios: map[v1.ResourceName]float64{"cpu": 0.5}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, faults, 2)
+	start := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, submitter.Fault{Kind: submitter.NodeCrash, Node: "node-0", From: start.Add(time.Minute)}, faults[0])
+	assert.Equal(t, submitter.NodeDegradation, faults[1].Kind)
+	assert.Equal(t, start, faults[1].From)
+	assert.Equal(t, start.Add(10*time.Minute), *faults[1].Until)
+
+	_, err = BuildFaults([]FaultConfig{{Kind: "reboot", Node: "node-0", At: "2019-01-01T00:00:00Z"}})
+	assert.EqualError(t, err, `fault kind "reboot" is not supported`)
+	_, err = BuildFaults([]FaultConfig{{Kind: "notReady", Node: "node-0", At: "now"}})
+	assert.Error(t, err)
+	_, err = BuildFaults([]FaultConfig{{Kind: "degradation", Node: "node-0", At: "2019-01-01T00:00:00Z"}})
+	assert.EqualError(t, err, "no ratios of degradation fault of node node-0")
+	_, err = BuildFaults([]FaultConfig{{Kind: "degradation", Node: "node-0", At: "2019-01-01T00:00:00Z",
+		Ratios: map[v1.ResourceName]float64{"cpu": 2}}})
+	assert.EqualError(t, err, "invalid ratio of degradation of cpu: 2")
+	_, err = BuildFaults([]FaultConfig{{Kind: "crash", Node: "node-0", At: "2019-01-01T00:00:00Z",
+		Ratios: map[v1.ResourceName]float64{"cpu": 0.5}}})
+	assert.EqualError(t, err, "ratios of crash fault of node node-0")
+}
+
+func TestBuildGenerators(t *testing.T) {
+	generators, err := BuildGenerators([]GeneratorConfig{{
+		Name:      "batch",
+		Count:     10,
+		Seed:      1,
+		Arrival:   "bursty",
+		Rate:      0.5,
+		BurstSize: 5,
+		CPU:       DistributionConfig{Distribution: "uniform", Min: "500m", Max: "2"},
+		Memory:    DistributionConfig{Value: "1Gi"},
+		Duration:  DistributionConfig{Distribution: "exponential", Mean: "600", Max: "3600"},
+		Priorities: []PriorityWeightConfig{
+			{Priority: 0, Weight: 3},
+			{Priority: 100, Weight: 1},
+		},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, []*workload.Generator{{
+		Name:     "batch",
+		Count:    10,
+		Seed:     1,
+		Arrival:  workload.Arrival{Process: workload.BurstyArrival, Rate: 0.5, BurstSize: 5},
+		CPU:      workload.Distribution{Kind: workload.UniformDistribution, Min: 0.5, Max: 2},
+		Memory:   workload.Distribution{Value: 1 << 30},
+		Duration: workload.Distribution{Kind: workload.ExponentialDistribution, Mean: 600, Max: 3600},
+		Priorities: []workload.PriorityWeight{
+			{Priority: 0, Weight: 3},
+			{Priority: 100, Weight: 1},
+		},
+	}}, generators)
+
+	_, err = BuildGenerators([]GeneratorConfig{
+		{Name: "a", Count: 1, Arrival: "poisson", Rate: 1, CPU: DistributionConfig{Value: "x"}},
+	})
+	assert.Contains(t, err.Error(), `invalid cpu distribution of generator a: invalid value "x"`)
+	_, err = BuildGenerators([]GeneratorConfig{{Name: "a", Count: 1, Arrival: "poisson"}})
+	assert.EqualError(t, err, "arrival rate of generator a must be positive")
+	_, err = BuildGenerators([]GeneratorConfig{
+		{Name: "a", Count: 1, Arrival: "poisson", Rate: 1},
+		{Name: "a", Count: 1, Arrival: "poisson", Rate: 1},
+	})
+	assert.EqualError(t, err, `duplicate generator name "a"`)
+}
+
+func TestBuildAutoscaler(t *testing.T) {
+	a, err := BuildAutoscaler(nil, "2019-01-01T00:00:00Z", DefaultMaxPods)
+	assert.NoError(t, err)
+	assert.Nil(t, a)
+
+	conf := &AutoscalerConfig{NodeGroups: []NodeGroupConfig{{
+		Name:    "pool",
+		MinSize: 1,
+		MaxSize: 3,
+		Template: NodeConfig{Status: NodeStatus{Allocatable: map[v1.ResourceName]string{
+			"cpu": "4", "memory": "16Gi",
+		}}},
+	}}}
+	a, err = BuildAutoscaler(conf, "2019-01-01T00:00:00Z", DefaultMaxPods)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]autoscaler.GroupMetrics{"pool": {}}, a.Metrics())
+
+	conf.NodeGroups[0].Template.SystemPods = []SystemPodConfig{{}}
+	_, err = BuildAutoscaler(conf, "2019-01-01T00:00:00Z", DefaultMaxPods)
+	assert.EqualError(t, err,
+		"invalid template of node group pool: name of a system pod on node pool must not be empty")
+
+	conf.NodeGroups[0].Template.SystemPods = nil
+	conf.NodeGroups[0].MaxSize = 0
+	_, err = BuildAutoscaler(conf, "2019-01-01T00:00:00Z", DefaultMaxPods)
+	assert.EqualError(t, err, "invalid size [1, 0] of node group pool")
+}
@@ -0,0 +1,223 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// DefaultHotspotDuration is the default ReadOptions.HotspotDuration.
+const DefaultHotspotDuration = 5 * time.Minute
+
+// ReadOptions are the options of ReadResultWithOptions.
+type ReadOptions struct {
+	// HotspotDuration is the minimum duration for which a node must stay saturated to be a Hotspot.
+	// Optional (default: DefaultHotspotDuration)
+	HotspotDuration time.Duration
+}
+
+// Balance is the balance of the utilization of a resource over the nodes, averaged over the metrics
+// ticks (see metrics.BalanceMetrics).
+type Balance struct {
+	// RequestCoV and UsageCoV are the coefficients of variation of the utilization by the requests
+	// and the usage.
+	RequestCoV float64 `json:"requestCoV"`
+	UsageCoV   float64 `json:"usageCoV"`
+	// SaturatedNodes is the number of the saturated nodes.
+	SaturatedNodes float64 `json:"saturatedNodes"`
+	// Hotspots is the number of the Hotspots of the resource.
+	Hotspots int `json:"hotspots"`
+}
+
+// Hotspot is a node that stayed saturated in a resource for at least ReadOptions.HotspotDuration,
+// from the metrics tick Since through Until.
+type Hotspot struct {
+	Node     string          `json:"node"`
+	Resource v1.ResourceName `json:"resource"`
+	Since    string          `json:"since"`
+	Until    string          `json:"until"`
+}
+
+// BalanceDiff is a resource with different balance.
+type BalanceDiff struct {
+	Resource v1.ResourceName `json:"resource"`
+	A        Balance         `json:"a"`
+	B        Balance         `json:"b"`
+}
+
+// balanceLine is a metrics.ResourceBalance written by metrics.JSONFormatter, with the fields used by
+// Result.
+type balanceLine struct {
+	Request        struct{ CoV float64 }
+	Usage          struct{ CoV float64 }
+	SaturatedNodes []string
+}
+
+// saturation is a run of consecutive metrics ticks at which a node is saturated in a resource.
+type saturation struct {
+	since, until time.Time
+}
+
+// balanceReader accumulates the balance metrics of the metrics ticks into the Balance and the
+// Hotspots of a Result.
+type balanceReader struct {
+	opts  ReadOptions
+	ticks int
+	sums  map[v1.ResourceName]*Balance
+	// open are the runs of saturation not ended at the last tick.
+	open     map[v1.ResourceName]map[string]*saturation
+	hotspots []Hotspot
+}
+
+func newBalanceReader(opts ReadOptions) *balanceReader {
+	if opts.HotspotDuration == 0 {
+		opts.HotspotDuration = DefaultHotspotDuration
+	}
+
+	return &balanceReader{
+		opts: opts,
+		sums: map[v1.ResourceName]*Balance{},
+		open: map[v1.ResourceName]map[string]*saturation{},
+	}
+}
+
+// read reads the balance metrics of the metrics tick at the clock.
+// The lines without the balance metrics are ignored.
+func (r *balanceReader) read(clk time.Time, balance map[v1.ResourceName]balanceLine) {
+	if balance == nil {
+		return
+	}
+	r.ticks++
+
+	for rsrc, line := range balance {
+		sum, ok := r.sums[rsrc]
+		if !ok {
+			sum = &Balance{}
+			r.sums[rsrc] = sum
+		}
+		sum.RequestCoV += line.Request.CoV
+		sum.UsageCoV += line.Usage.CoV
+		sum.SaturatedNodes += float64(len(line.SaturatedNodes))
+	}
+
+	for rsrc, runs := range r.open {
+		saturated := map[string]bool{}
+		for _, name := range balance[rsrc].SaturatedNodes {
+			saturated[name] = true
+		}
+		for name, run := range runs {
+			if !saturated[name] {
+				r.end(name, rsrc, run)
+				delete(runs, name)
+			}
+		}
+	}
+
+	for rsrc, line := range balance {
+		runs, ok := r.open[rsrc]
+		if !ok {
+			runs = map[string]*saturation{}
+			r.open[rsrc] = runs
+		}
+		for _, name := range line.SaturatedNodes {
+			if run, ok := runs[name]; ok {
+				run.until = clk
+			} else {
+				runs[name] = &saturation{since: clk, until: clk}
+			}
+		}
+	}
+}
+
+// end records the run of saturation as a Hotspot if it lasted long enough.
+func (r *balanceReader) end(node string, rsrc v1.ResourceName, run *saturation) {
+	if run.until.Sub(run.since) < r.opts.HotspotDuration {
+		return
+	}
+
+	r.hotspots = append(r.hotspots, Hotspot{
+		Node:     node,
+		Resource: rsrc,
+		Since:    run.since.Format(time.RFC3339),
+		Until:    run.until.Format(time.RFC3339),
+	})
+	r.sums[rsrc].Hotspots++
+}
+
+// finish ends the open runs of saturation, and stores the Balance averaged over the metrics ticks
+// and the Hotspots sorted by their starts into the result.
+func (r *balanceReader) finish(result *Result) {
+	for rsrc, runs := range r.open {
+		for name, run := range runs {
+			r.end(name, rsrc, run)
+		}
+	}
+
+	sort.Slice(r.hotspots, func(i, j int) bool {
+		hi, hj := r.hotspots[i], r.hotspots[j]
+		if hi.Since != hj.Since {
+			return hi.Since < hj.Since
+		}
+		if hi.Node != hj.Node {
+			return hi.Node < hj.Node
+		}
+		return hi.Resource < hj.Resource
+	})
+	result.Hotspots = append(result.Hotspots, r.hotspots...)
+
+	for rsrc, sum := range r.sums {
+		result.Balance[rsrc] = Balance{
+			RequestCoV:     sum.RequestCoV / float64(r.ticks),
+			UsageCoV:       sum.UsageCoV / float64(r.ticks),
+			SaturatedNodes: sum.SaturatedNodes / float64(r.ticks),
+			Hotspots:       sum.Hotspots,
+		}
+	}
+}
+
+// compareBalance returns the resources with different balance in the results a and b.
+func compareBalance(a, b map[v1.ResourceName]Balance) []BalanceDiff {
+	set := map[v1.ResourceName]bool{}
+	for rsrc := range a {
+		set[rsrc] = true
+	}
+	for rsrc := range b {
+		set[rsrc] = true
+	}
+	rsrcs := make([]v1.ResourceName, 0, len(set))
+	for rsrc := range set {
+		rsrcs = append(rsrcs, rsrc)
+	}
+	sort.Slice(rsrcs, func(i, j int) bool { return rsrcs[i] < rsrcs[j] })
+
+	diffs := []BalanceDiff{}
+	for _, rsrc := range rsrcs {
+		balA, balB := a[rsrc], b[rsrc]
+		if nearlyEqual(balA.RequestCoV, balB.RequestCoV) && nearlyEqual(balA.UsageCoV, balB.UsageCoV) &&
+			nearlyEqual(balA.SaturatedNodes, balB.SaturatedNodes) && balA.Hotspots == balB.Hotspots {
+			continue
+		}
+		diffs = append(diffs, BalanceDiff{Resource: rsrc, A: balA, B: balB})
+	}
+
+	return diffs
+}
+
+func nearlyEqual(a, b float64) bool {
+	return a-b <= utilizationEpsilon && b-a <= utilizationEpsilon
+}
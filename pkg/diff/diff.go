@@ -0,0 +1,444 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package diff compares the results of two simulations, e.g., of two schedulers on the same
+// workload.
+package diff
+
+import (
+	"bufio"
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	kubesim "simulator/pkg"
+	"simulator/pkg/logfile"
+	"simulator/pkg/metrics"
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+)
+
+// Result is the summary of a simulation run, built from the metrics it wrote or from a checkpoint.
+type Result struct {
+	// Outcomes maps the key of each pod that has run to its last observed outcome.
+	Outcomes map[string]PodOutcome
+	// Utilization maps each node name to the utilization of each resource averaged over the metrics
+	// ticks. The utilization of the whole cluster is associated with ClusterNode.
+	Utilization map[string]map[v1.ResourceName]Utilization
+	// Balance maps each resource to the balance of its utilization over the nodes, if the metrics
+	// include metrics.BalanceMetrics.
+	Balance map[v1.ResourceName]Balance
+	// Hotspots are the nodes saturated for a sustained duration, sorted by their starts.
+	Hotspots []Hotspot
+}
+
+// ClusterNode is the node name of Result.Utilization associated with the whole cluster.
+const ClusterNode = ""
+
+// PodOutcome is the outcome of a pod at the last metrics tick at which it was running or
+// terminating.
+type PodOutcome struct {
+	Node            string `json:"node"`
+	BoundAt         string `json:"boundAt"`
+	ExecutedSeconds int32  `json:"executedSeconds"`
+	Status          string `json:"status"`
+}
+
+// Utilization is the fractions of the allocatable amount of a resource that are requested and used.
+type Utilization struct {
+	Request float64 `json:"request"`
+	Usage   float64 `json:"usage"`
+}
+
+// Diff is the differences between two results, A and B.
+type Diff struct {
+	// Placements are the pods bound to different nodes (or run in only one of the results).
+	Placements []PlacementDiff `json:"placements"`
+	// Outcomes are the pods with different outcomes.
+	Outcomes []OutcomeDiff `json:"outcomes"`
+	// Utilization are the resources of nodes with different utilization.
+	Utilization []UtilizationDiff `json:"utilization"`
+	// Balance are the resources with different balance over the nodes.
+	Balance []BalanceDiff `json:"balance"`
+}
+
+// PlacementDiff is a pod bound to NodeA in A and NodeB in B.
+// A node name is empty if the pod did not run in the result.
+type PlacementDiff struct {
+	Pod   string `json:"pod"`
+	NodeA string `json:"nodeA"`
+	NodeB string `json:"nodeB"`
+}
+
+// OutcomeDiff is a pod with different outcomes.
+// An outcome is nil if the pod did not run in the result.
+type OutcomeDiff struct {
+	Pod string      `json:"pod"`
+	A   *PodOutcome `json:"a"`
+	B   *PodOutcome `json:"b"`
+}
+
+// UtilizationDiff is a resource of a node, or the whole cluster if Node is empty, with different
+// utilization.
+type UtilizationDiff struct {
+	Node     string          `json:"node"`
+	Resource v1.ResourceName `json:"resource"`
+	A        Utilization     `json:"a"`
+	B        Utilization     `json:"b"`
+}
+
+// IsEmpty returns whether the results have no differences.
+func (d *Diff) IsEmpty() bool {
+	return len(d.Placements) == 0 && len(d.Outcomes) == 0 && len(d.Utilization) == 0 &&
+		len(d.Balance) == 0
+}
+
+// utilizationEpsilon is the tolerance of utilization considered the same.
+const utilizationEpsilon = 1e-9
+
+// Compare returns the differences between the results a and b, sorted by pods and nodes.
+func Compare(a, b *Result) *Diff {
+	diff := &Diff{
+		Placements:  []PlacementDiff{},
+		Outcomes:    []OutcomeDiff{},
+		Utilization: []UtilizationDiff{},
+	}
+
+	for _, key := range unionPods(a.Outcomes, b.Outcomes) {
+		outA, okA := a.Outcomes[key]
+		outB, okB := b.Outcomes[key]
+		if okA && okB && outA == outB {
+			continue
+		}
+
+		d := OutcomeDiff{Pod: key}
+		placement := PlacementDiff{Pod: key}
+		if okA {
+			d.A = &outA
+			placement.NodeA = outA.Node
+		}
+		if okB {
+			d.B = &outB
+			placement.NodeB = outB.Node
+		}
+
+		diff.Outcomes = append(diff.Outcomes, d)
+		if placement.NodeA != placement.NodeB {
+			diff.Placements = append(diff.Placements, placement)
+		}
+	}
+
+	for _, node := range unionNodes(a.Utilization, b.Utilization) {
+		rsrcsA := a.Utilization[node]
+		rsrcsB := b.Utilization[node]
+		for _, rsrc := range unionResources(rsrcsA, rsrcsB) {
+			utilA := rsrcsA[rsrc]
+			utilB := rsrcsB[rsrc]
+			if math.Abs(utilA.Request-utilB.Request) <= utilizationEpsilon &&
+				math.Abs(utilA.Usage-utilB.Usage) <= utilizationEpsilon {
+				continue
+			}
+
+			diff.Utilization = append(diff.Utilization, UtilizationDiff{
+				Node:     node,
+				Resource: rsrc,
+				A:        utilA,
+				B:        utilB,
+			})
+		}
+	}
+
+	diff.Balance = compareBalance(a.Balance, b.Balance)
+
+	return diff
+}
+
+// metricsLine is a metrics written by metrics.JSONFormatter, with the fields used by Result.
+type metricsLine struct {
+	Clock string
+	Nodes map[string]struct {
+		Allocatable          v1.ResourceList
+		TotalResourceRequest v1.ResourceList
+		TotalResourceUsage   v1.ResourceList
+	}
+	Pods map[string]struct {
+		Node            string
+		BoundAt         string
+		ExecutedSeconds int32
+		Status          string
+	}
+	Balance map[v1.ResourceName]balanceLine
+}
+
+// ReadResult builds a Result from the metrics log at the path, written with the JSON formatter,
+// with the default ReadOptions.
+// The log may be compressed or rotated (see logfile.Open).
+// Returns error if failed to read or parse the log.
+func ReadResult(path string) (*Result, error) {
+	return ReadResultWithOptions(path, ReadOptions{})
+}
+
+// ReadResultWithOptions builds a Result from the metrics log at the path, written with the JSON
+// formatter, with the options.
+// Returns error if failed to read or parse the log.
+func ReadResultWithOptions(path string, opts ReadOptions) (*Result, error) {
+	file, err := logfile.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := newResultReader(opts)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		var line metricsLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("invalid metrics at line %d of %s: %s", reader.ticks+1, path, err.Error()))
+		}
+		if err := reader.read(&line); err != nil {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("invalid clock at line %d of %s: %s", reader.ticks, path, err.Error()))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return reader.finish(), nil
+}
+
+// ReadCheckpointResult builds a Result from the checkpoint file at the path (see
+// kubesim.ReadCheckpoint), as if the metrics were written once at the clock of the checkpoint: the
+// outcomes are those of the pods running or terminating at the checkpoint, and a node is saturated
+// at or above metrics.DefaultSaturationThreshold.
+// Returns error if failed to read the checkpoint, or a pod in it is bound to an unknown node.
+func ReadCheckpointResult(path string, opts ReadOptions) (*Result, error) {
+	ckpt, err := kubesim.ReadCheckpoint(path)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]*node.Node, len(ckpt.Nodes))
+	for name, ckptNode := range ckpt.Nodes {
+		if ckptNode.Node == nil {
+			return nil, strongerrors.InvalidArgument(errors.Errorf("node %s is not saved in %s", name, path))
+		}
+		n := node.NewNode(ckptNode.Node)
+		nodes[name] = &n
+	}
+	for _, p := range ckpt.Pods {
+		n, ok := nodes[p.Node]
+		if !ok {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("pod %s/%s bound to unknown node %q in %s", p.Pod.Namespace, p.Pod.Name, p.Node, path))
+		}
+		simPod, err := pod.NewPod(p.Pod, p.BoundAt, p.Status, p.Node)
+		if err != nil {
+			return nil, err
+		}
+		simPod.SetStartupLatency(p.StartupLatency)
+		if err := n.RestorePod(simPod); err != nil {
+			return nil, err
+		}
+	}
+
+	met, err := metrics.BuildMetrics(ckpt.Clock, nodes, queue.NewFIFOQueue())
+	if err != nil {
+		return nil, err
+	}
+	met[metrics.BalanceMetricsKey] = metrics.BuildBalanceMetrics(
+		met[metrics.NodesMetricsKey].(map[string]node.Metrics), metrics.DefaultSaturationThreshold)
+
+	// Read the metrics as written by the JSON formatter.
+	data, err := json.Marshal(met)
+	if err != nil {
+		return nil, err
+	}
+	var line metricsLine
+	if err := json.Unmarshal(data, &line); err != nil {
+		return nil, err
+	}
+
+	reader := newResultReader(opts)
+	if err := reader.read(&line); err != nil {
+		return nil, err
+	}
+
+	return reader.finish(), nil
+}
+
+// resultReader accumulates the metrics of the metrics ticks into a Result.
+type resultReader struct {
+	result  *Result
+	ticks   int
+	balance *balanceReader
+}
+
+func newResultReader(opts ReadOptions) *resultReader {
+	return &resultReader{
+		result: &Result{
+			Outcomes:    map[string]PodOutcome{},
+			Utilization: map[string]map[v1.ResourceName]Utilization{},
+			Balance:     map[v1.ResourceName]Balance{},
+			Hotspots:    []Hotspot{},
+		},
+		balance: newBalanceReader(opts),
+	}
+}
+
+// read reads the metrics of a tick.
+// Returns error if the clock of the metrics is invalid.
+func (r *resultReader) read(line *metricsLine) error {
+	r.ticks++
+
+	clk, err := time.Parse(time.RFC3339, line.Clock)
+	if err != nil {
+		return err
+	}
+	r.balance.read(clk, line.Balance)
+
+	for key, pod := range line.Pods {
+		r.result.Outcomes[key] = PodOutcome{
+			Node:            pod.Node,
+			BoundAt:         pod.BoundAt,
+			ExecutedSeconds: pod.ExecutedSeconds,
+			Status:          pod.Status,
+		}
+	}
+
+	cluster := map[v1.ResourceName]*[3]float64{} // allocatable, request, usage
+	for name, node := range line.Nodes {
+		for rsrc, alloc := range node.Allocatable {
+			req := node.TotalResourceRequest[rsrc]
+			usage := node.TotalResourceUsage[rsrc]
+			amounts := [3]float64{quantityValue(alloc), quantityValue(req), quantityValue(usage)}
+
+			addUtilization(r.result, name, rsrc, amounts)
+
+			sum, ok := cluster[rsrc]
+			if !ok {
+				sum = &[3]float64{}
+				cluster[rsrc] = sum
+			}
+			for i := range amounts {
+				sum[i] += amounts[i]
+			}
+		}
+	}
+	for rsrc, sum := range cluster {
+		addUtilization(r.result, ClusterNode, rsrc, *sum)
+	}
+
+	return nil
+}
+
+// finish returns the Result of the metrics read so far.
+func (r *resultReader) finish() *Result {
+	r.balance.finish(r.result)
+
+	// Average the sums over the ticks.
+	for _, rsrcs := range r.result.Utilization {
+		for rsrc, util := range rsrcs {
+			rsrcs[rsrc] = Utilization{
+				Request: util.Request / float64(r.ticks),
+				Usage:   util.Usage / float64(r.ticks),
+			}
+		}
+	}
+
+	return r.result
+}
+
+// addUtilization adds the utilization of the amounts (allocatable, request, and usage) to the sum
+// in the result.
+func addUtilization(result *Result, node string, rsrc v1.ResourceName, amounts [3]float64) {
+	if amounts[0] == 0 {
+		return
+	}
+
+	rsrcs, ok := result.Utilization[node]
+	if !ok {
+		rsrcs = map[v1.ResourceName]Utilization{}
+		result.Utilization[node] = rsrcs
+	}
+
+	util := rsrcs[rsrc]
+	util.Request += amounts[1] / amounts[0]
+	util.Usage += amounts[2] / amounts[0]
+	rsrcs[rsrc] = util
+}
+
+// quantityValue returns the amount of the quantity in its base unit, keeping milli precision.
+func quantityValue(q resource.Quantity) float64 {
+	return float64(q.MilliValue()) / 1000
+}
+
+func unionPods(a, b map[string]PodOutcome) []string {
+	set := map[string]bool{}
+	for key := range a {
+		set[key] = true
+	}
+	for key := range b {
+		set[key] = true
+	}
+	return sortedSet(set)
+}
+
+func unionNodes(a, b map[string]map[v1.ResourceName]Utilization) []string {
+	set := map[string]bool{}
+	for node := range a {
+		set[node] = true
+	}
+	for node := range b {
+		set[node] = true
+	}
+	return sortedSet(set)
+}
+
+func sortedSet(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func unionResources(a, b map[v1.ResourceName]Utilization) []v1.ResourceName {
+	set := map[v1.ResourceName]bool{}
+	for rsrc := range a {
+		set[rsrc] = true
+	}
+	for rsrc := range b {
+		set[rsrc] = true
+	}
+
+	rsrcs := make([]v1.ResourceName, 0, len(set))
+	for rsrc := range set {
+		rsrcs = append(rsrcs, rsrc)
+	}
+	sort.Slice(rsrcs, func(i, j int) bool { return rsrcs[i] < rsrcs[j] })
+
+	return rsrcs
+}
@@ -0,0 +1,231 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubesim "simulator/pkg"
+	"simulator/pkg/clock"
+	"simulator/pkg/metrics"
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+)
+
+// writeLog writes a metrics log of one tick, with pod-0 on the node and the node's cpu usage.
+func writeLog(t *testing.T, path, nodeName, cpuUsage string) {
+	formatter := metrics.JSONFormatter{}
+	clk := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	met := metrics.Metrics{
+		metrics.ClockKey: clk.ToRFC3339(),
+		metrics.NodesMetricsKey: map[string]node.Metrics{
+			nodeName: {
+				Allocatable:          v1.ResourceList{"cpu": resource.MustParse("4")},
+				TotalResourceRequest: v1.ResourceList{"cpu": resource.MustParse("1")},
+				TotalResourceUsage:   v1.ResourceList{"cpu": resource.MustParse(cpuUsage)},
+			},
+		},
+		metrics.PodsMetricsKey: map[string]pod.Metrics{
+			"default/pod-0": {BoundAt: clk, Node: nodeName, ExecutedSeconds: 10, Status: pod.Ok},
+		},
+		metrics.QueueMetricsKey: queue.Metrics{},
+	}
+
+	str, err := formatter.Format(&met)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(str+"\n"), 0644))
+}
+
+// newCheckpointNode returns a node of 4 cpus saved in a checkpoint.
+func newCheckpointNode(name string) *v1.Node {
+	allocatable := v1.ResourceList{"cpu": resource.MustParse("4")}
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status:     v1.NodeStatus{Capacity: allocatable, Allocatable: allocatable},
+	}
+}
+
+// writeCheckpoint writes the checkpoint gzipped, as kubesim.SaveCheckpoint does.
+func writeCheckpoint(t *testing.T, path string, ckpt *kubesim.Checkpoint) {
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+	writer := gzip.NewWriter(file)
+	assert.NoError(t, json.NewEncoder(writer).Encode(ckpt))
+	assert.NoError(t, writer.Close())
+	assert.NoError(t, file.Close())
+}
+
+func TestReadResultAndCompare(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diff")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pathA := filepath.Join(dir, "a.log")
+	pathB := filepath.Join(dir, "b.log")
+	writeLog(t, pathA, "node-0", "1")
+	writeLog(t, pathB, "node-0", "2")
+
+	a, err := ReadResult(pathA)
+	assert.NoError(t, err)
+	b, err := ReadResult(pathB)
+	assert.NoError(t, err)
+
+	assert.Equal(t, PodOutcome{
+		Node:            "node-0",
+		BoundAt:         "2019-01-01T00:00:00Z",
+		ExecutedSeconds: 10,
+		Status:          "Ok",
+	}, a.Outcomes["default/pod-0"])
+	assert.Equal(t, Utilization{Request: 0.25, Usage: 0.25}, a.Utilization["node-0"]["cpu"])
+	assert.Equal(t, a.Utilization["node-0"], a.Utilization[ClusterNode])
+
+	assert.True(t, Compare(a, a).IsEmpty())
+	assert.Equal(t, &Diff{
+		Placements: []PlacementDiff{},
+		Outcomes:   []OutcomeDiff{},
+		Utilization: []UtilizationDiff{
+			{Node: ClusterNode, Resource: "cpu", A: Utilization{0.25, 0.25}, B: Utilization{0.25, 0.5}},
+			{Node: "node-0", Resource: "cpu", A: Utilization{0.25, 0.25}, B: Utilization{0.25, 0.5}},
+		},
+		Balance: []BalanceDiff{},
+	}, Compare(a, b))
+}
+
+func TestReadResultHotspots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diff")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "metrics.log")
+
+	// node-0 is saturated from 00:00 through 00:06, and node-1 from 00:02 through 00:03.
+	start := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	formatter := metrics.JSONFormatter{}
+	log := ""
+	for i := 0; i < 10; i++ {
+		saturated := []string{}
+		if i <= 6 {
+			saturated = append(saturated, "node-0")
+		}
+		if i == 2 || i == 3 {
+			saturated = append(saturated, "node-1")
+		}
+		met := metrics.Metrics{
+			metrics.ClockKey:        start.Add(time.Duration(i) * time.Minute).ToRFC3339(),
+			metrics.NodesMetricsKey: map[string]node.Metrics{},
+			metrics.PodsMetricsKey:  map[string]pod.Metrics{},
+			metrics.QueueMetricsKey: queue.Metrics{},
+			metrics.BalanceMetricsKey: metrics.BalanceMetrics{"cpu": {
+				Usage:          metrics.UtilizationStats{CoV: 0.5},
+				SaturatedNodes: saturated,
+			}},
+		}
+		str, err := formatter.Format(&met)
+		assert.NoError(t, err)
+		log += str + "\n"
+	}
+	assert.NoError(t, ioutil.WriteFile(path, []byte(log), 0644))
+
+	result, err := ReadResult(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []Hotspot{
+		{Node: "node-0", Resource: "cpu", Since: "2019-01-01T00:00:00Z", Until: "2019-01-01T00:06:00Z"},
+	}, result.Hotspots)
+	assert.Equal(t, Balance{UsageCoV: 0.5, SaturatedNodes: 0.9, Hotspots: 1}, result.Balance["cpu"])
+
+	result, err = ReadResultWithOptions(path, ReadOptions{HotspotDuration: time.Minute})
+	assert.NoError(t, err)
+	assert.Len(t, result.Hotspots, 2)
+	assert.Equal(t, "node-1", result.Hotspots[1].Node)
+
+	other := &Result{Balance: map[v1.ResourceName]Balance{"cpu": {UsageCoV: 0.5, SaturatedNodes: 0.9}}}
+	assert.Equal(t, []BalanceDiff{
+		{Resource: "cpu", A: result.Balance["cpu"], B: other.Balance["cpu"]},
+	}, Compare(result, other).Balance)
+}
+
+func TestReadCheckpointResult(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diff")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint.gz")
+
+	start := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	v1Pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "pod-0",
+			Namespace:   "default",
+			Annotations: map[string]string{"simSpec": "- seconds: 60\n  resourceUsage:\n    cpu: 3\n"},
+		},
+		Spec: v1.PodSpec{Containers: []v1.Container{{
+			Name:      "container",
+			Resources: v1.ResourceRequirements{Requests: v1.ResourceList{"cpu": resource.MustParse("4")}},
+		}}},
+	}
+	ckpt := kubesim.Checkpoint{
+		Clock: start.Add(10 * time.Second),
+		Tick:  10 * time.Second,
+		Nodes: map[string]kubesim.CheckpointNode{
+			"node-0": {Node: newCheckpointNode("node-0")},
+			"node-1": {Node: newCheckpointNode("node-1")},
+		},
+		Pods: []kubesim.CheckpointPod{{Pod: v1Pod, Node: "node-0", BoundAt: start, Status: pod.Ok}},
+	}
+
+	writeCheckpoint(t, path, &ckpt)
+
+	result, err := ReadCheckpointResult(path, ReadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]PodOutcome{
+		"default/pod-0": {Node: "node-0", BoundAt: "2019-01-01T00:00:00Z", ExecutedSeconds: 10, Status: "Ok"},
+	}, result.Outcomes)
+	assert.Equal(t, Utilization{Request: 1, Usage: 0.75}, result.Utilization["node-0"]["cpu"])
+	assert.Equal(t, Utilization{Request: 0.5, Usage: 0.375}, result.Utilization[ClusterNode]["cpu"])
+
+	ckpt.Pods[0].Node = "node-2"
+	writeCheckpoint(t, path, &ckpt)
+
+	_, err = ReadCheckpointResult(path, ReadOptions{})
+	assert.Error(t, err)
+}
+
+func TestComparePlacements(t *testing.T) {
+	a := &Result{Outcomes: map[string]PodOutcome{
+		"default/pod-0": {Node: "node-0", Status: "Ok"},
+		"default/pod-1": {Node: "node-0", Status: "Ok"},
+	}}
+	b := &Result{Outcomes: map[string]PodOutcome{
+		"default/pod-0": {Node: "node-1", Status: "Ok"},
+	}}
+
+	diff := Compare(a, b)
+	assert.Equal(t, []PlacementDiff{
+		{Pod: "default/pod-0", NodeA: "node-0", NodeB: "node-1"},
+		{Pod: "default/pod-1", NodeA: "node-0", NodeB: ""},
+	}, diff.Placements)
+	assert.Len(t, diff.Outcomes, 2)
+	assert.Nil(t, diff.Outcomes[1].B)
+}
@@ -0,0 +1,237 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package export exports a slice of the results of a simulation, i.e., the metrics log or the trace
+// in a range of simulated time and of the pods selected by namespace and labels.
+// The results are streamed, so that slices of huge runs can be inspected without loading them.
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/logfile"
+	"simulator/pkg/metrics"
+	"simulator/pkg/trace"
+	"simulator/pkg/util"
+)
+
+// Filter selects a slice of the results.
+type Filter struct {
+	// Since is the first clock exported, or nil to export from the beginning.
+	Since *clock.Clock
+	// Until is the last clock exported, or nil to export until the end.
+	Until *clock.Clock
+	// Namespace selects the pods in the namespace, or all pods if empty.
+	Namespace string
+	// Selector selects the pods with matching labels, or all pods if nil.
+	Selector labels.Selector
+}
+
+// selectsPods returns whether this Filter selects a subset of the pods.
+func (f *Filter) selectsPods() bool {
+	return f.Namespace != "" || (f.Selector != nil && !f.Selector.Empty())
+}
+
+// matchPod returns whether this Filter selects the pod in the namespace with the labels.
+func (f *Filter) matchPod(namespace string, lbls map[string]string) bool {
+	if f.Namespace != "" && namespace != f.Namespace {
+		return false
+	}
+	return f.Selector == nil || f.Selector.Matches(labels.Set(lbls))
+}
+
+// matchClock returns whether the clock is in the range of this Filter, and whether it is after the
+// range, i.e., the rest of the results can be skipped.
+func (f *Filter) matchClock(clk clock.Clock) (bool, bool) {
+	if f.Until != nil && f.Until.Before(clk) {
+		return false, true
+	}
+	if f.Since != nil && clk.Before(*f.Since) {
+		return false, false
+	}
+	return true, false
+}
+
+// ExportMetrics exports the metrics log at the path src, written with the JSON formatter, to the
+// path dst, compressed and rotated with the options.
+// The metrics at the clocks out of the range of the filter are dropped, and the pods in the remaining
+// metrics are narrowed down to the selected ones; the other metrics (e.g., of nodes) are kept as is.
+// The log may be compressed or rotated (see logfile.Open), and is assumed to be ordered by clocks.
+// Returns the number of exported metrics, or error if failed to read or write a log.
+func ExportMetrics(src, dst string, filter *Filter, opts logfile.Options) (int, error) {
+	file, err := logfile.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	out, err := logfile.NewWriter(dst, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	exported := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64*1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line, done, err := filterMetrics(scanner.Bytes(), filter)
+		if err != nil {
+			out.Close()
+			return 0, strongerrors.InvalidArgument(
+				errors.Errorf("invalid metrics at line %d of %s: %s", lineNum, src, err.Error()))
+		}
+		if done {
+			break
+		}
+		if line == nil {
+			continue
+		}
+
+		if _, err := out.Write(append(line, '\n')); err != nil {
+			out.Close()
+			return 0, err
+		}
+		exported++
+	}
+	if err := scanner.Err(); err != nil {
+		out.Close()
+		return 0, err
+	}
+
+	return exported, out.Close()
+}
+
+// filterMetrics returns the metrics in the JSON line filtered, or nil if dropped, and whether the
+// line is after the range of the filter.
+func filterMetrics(data []byte, filter *Filter) ([]byte, bool, error) {
+	var line map[string]json.RawMessage
+	if err := json.Unmarshal(data, &line); err != nil {
+		return nil, false, err
+	}
+
+	var clk clock.Clock
+	if err := json.Unmarshal(line[metrics.ClockKey], &clk); err != nil {
+		return nil, false, errors.Wrapf(err, "invalid %s", metrics.ClockKey)
+	}
+	if ok, done := filter.matchClock(clk); !ok {
+		return nil, done, nil
+	}
+
+	if !filter.selectsPods() {
+		return data, false, nil
+	}
+
+	var pods map[string]json.RawMessage
+	if err := json.Unmarshal(line[metrics.PodsMetricsKey], &pods); err != nil {
+		return nil, false, errors.Wrapf(err, "invalid %s", metrics.PodsMetricsKey)
+	}
+	for key, raw := range pods {
+		var met struct{ Labels map[string]string }
+		if err := json.Unmarshal(raw, &met); err != nil {
+			return nil, false, errors.Wrapf(err, "invalid metrics of pod %s", key)
+		}
+
+		namespace := strings.SplitN(key, "/", 2)[0]
+		if !filter.matchPod(namespace, met.Labels) {
+			delete(pods, key)
+		}
+	}
+
+	filtered, err := json.Marshal(pods)
+	if err != nil {
+		return nil, false, err
+	}
+	line[metrics.PodsMetricsKey] = filtered
+
+	data, err = json.Marshal(line)
+	return data, false, err
+}
+
+// ExportTrace exports the trace at the path src to the path dst, compressed and rotated with the
+// options.
+// The entries at the clocks out of the range of the filter and the entries of the pods not selected
+// are dropped. Entries without pods (e.g., TerminateSubmitter) are kept if in the range.
+// The pods of Delete and Evict entries are selected by the labels at their last Submit, Update, or
+// Bind entries.
+// The trace may be compressed or rotated (see logfile.Open).
+// Returns the number of exported entries, or error if failed to read or write a trace.
+func ExportTrace(src, dst string, filter *Filter, opts logfile.Options) (int, error) {
+	file, err := logfile.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	rec, err := trace.NewRecorder(dst, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	// podLabels maps the key of each pod seen so far to its labels.
+	podLabels := map[string]map[string]string{}
+
+	exported := 0
+	dec := json.NewDecoder(file)
+	for n := 0; ; n++ {
+		var entry trace.Entry
+		if err := dec.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			rec.Close()
+			return 0, strongerrors.InvalidArgument(
+				errors.Errorf("invalid trace entry %d of %s: %s", n, src, err.Error()))
+		}
+
+		t, err := time.Parse(time.RFC3339, entry.Clock)
+		if err != nil {
+			rec.Close()
+			return 0, strongerrors.InvalidArgument(
+				errors.Errorf("invalid clock of trace entry %d of %s: %s", n, src, err.Error()))
+		}
+
+		namespace, name := entry.PodNamespace, entry.PodName
+		if entry.Pod != nil {
+			namespace, name = entry.Pod.Namespace, entry.Pod.Name
+		}
+		key := util.PodKeyFromNames(namespace, name)
+		if entry.Pod != nil {
+			podLabels[key] = entry.Pod.Labels
+		}
+
+		ok, done := filter.matchClock(clock.NewClock(t))
+		if done {
+			break
+		}
+		if !ok || (name != "" && !filter.matchPod(namespace, podLabels[key])) {
+			continue
+		}
+
+		if err := rec.RecordEntries([]trace.Entry{entry}); err != nil {
+			rec.Close()
+			return 0, err
+		}
+		exported++
+	}
+
+	return exported, rec.Close()
+}
@@ -0,0 +1,211 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/logfile"
+	"simulator/pkg/metrics"
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+	"simulator/pkg/trace"
+)
+
+var start = clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+
+func at(minutes int) clock.Clock {
+	return start.Add(time.Duration(minutes) * time.Minute)
+}
+
+// writeLog writes a metrics log of a tick every minute, with the pods "ns-a/a" labeled app=a and
+// "ns-b/b" labeled app=b.
+func writeLog(t *testing.T, path string, ticks int) {
+	formatter := metrics.JSONFormatter{}
+	lines := ""
+	for i := 0; i < ticks; i++ {
+		met := metrics.Metrics{
+			metrics.ClockKey:        at(i).ToRFC3339(),
+			metrics.NodesMetricsKey: map[string]node.Metrics{"node-0": {RunningPodsNum: 2}},
+			metrics.PodsMetricsKey: map[string]pod.Metrics{
+				"ns-a/a": {BoundAt: start, Node: "node-0", Labels: map[string]string{"app": "a"}},
+				"ns-b/b": {BoundAt: start, Node: "node-0", Labels: map[string]string{"app": "b"}},
+			},
+			metrics.QueueMetricsKey: queue.Metrics{},
+		}
+		str, err := formatter.Format(&met)
+		assert.NoError(t, err)
+		lines += str + "\n"
+	}
+	assert.NoError(t, ioutil.WriteFile(path, []byte(lines), 0644))
+}
+
+// readLog returns the clock and the pod keys of each metrics in the log.
+func readLog(t *testing.T, path string) ([]string, [][]string) {
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	clocks := []string{}
+	pods := [][]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var line struct {
+			Clock string
+			Nodes map[string]node.Metrics
+			Pods  map[string]pod.Metrics
+		}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		assert.Equal(t, int64(2), line.Nodes["node-0"].RunningPodsNum)
+
+		keys := []string{}
+		for key := range line.Pods {
+			keys = append(keys, key)
+		}
+		clocks = append(clocks, line.Clock)
+		pods = append(pods, keys)
+	}
+
+	return clocks, pods
+}
+
+func TestExportMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "kubesim.log")
+	writeLog(t, src, 5)
+
+	since, until := at(1), at(3)
+	testCases := []struct {
+		name   string
+		filter Filter
+		clocks []string
+		pods   []string
+	}{
+		{
+			name:   "all",
+			filter: Filter{},
+			clocks: []string{at(0).ToRFC3339(), at(1).ToRFC3339(), at(2).ToRFC3339(), at(3).ToRFC3339(),
+				at(4).ToRFC3339()},
+		},
+		{
+			name:   "time range",
+			filter: Filter{Since: &since, Until: &until},
+			clocks: []string{at(1).ToRFC3339(), at(2).ToRFC3339(), at(3).ToRFC3339()},
+		},
+		{
+			name:   "namespace",
+			filter: Filter{Until: &since, Namespace: "ns-b"},
+			clocks: []string{at(0).ToRFC3339(), at(1).ToRFC3339()},
+			pods:   []string{"ns-b/b"},
+		},
+		{
+			name:   "selector",
+			filter: Filter{Since: &until, Selector: labels.SelectorFromSet(labels.Set{"app": "a"})},
+			clocks: []string{at(3).ToRFC3339(), at(4).ToRFC3339()},
+			pods:   []string{"ns-a/a"},
+		},
+		{
+			name: "no pods",
+			filter: Filter{
+				Since:     &until,
+				Until:     &until,
+				Namespace: "ns-a",
+				Selector:  labels.SelectorFromSet(labels.Set{"app": "b"}),
+			},
+			clocks: []string{at(3).ToRFC3339()},
+			pods:   []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		dst := filepath.Join(dir, strings.Replace(tc.name, " ", "-", -1)+".log")
+		n, err := ExportMetrics(src, dst, &tc.filter, logfile.Options{})
+		assert.NoError(t, err, tc.name)
+		assert.Equal(t, len(tc.clocks), n, tc.name)
+
+		clocks, pods := readLog(t, dst)
+		assert.Equal(t, tc.clocks, clocks, tc.name)
+		for _, keys := range pods {
+			if tc.pods == nil {
+				assert.Len(t, keys, 2, tc.name)
+			} else {
+				assert.ElementsMatch(t, tc.pods, keys, tc.name)
+			}
+		}
+	}
+}
+
+func TestExportTrace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	newPod := func(namespace, name, app string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    map[string]string{"app": app},
+		}}
+	}
+
+	src := filepath.Join(dir, "trace.jsonl")
+	rec, err := trace.NewRecorder(src, logfile.Options{})
+	assert.NoError(t, err)
+	assert.NoError(t, rec.RecordEntries([]trace.Entry{
+		{Clock: at(0).ToRFC3339(), Kind: trace.Submit, Source: "s", Pod: newPod("ns-a", "a", "a")},
+		{Clock: at(0).ToRFC3339(), Kind: trace.Submit, Source: "s", Pod: newPod("ns-b", "b", "b")},
+		{Clock: at(1).ToRFC3339(), Kind: trace.Bind, Pod: newPod("ns-a", "a", "a")},
+		{Clock: at(1).ToRFC3339(), Kind: trace.Bind, Pod: newPod("ns-b", "b", "b")},
+		{Clock: at(2).ToRFC3339(), Kind: trace.Delete, Source: "s", PodNamespace: "ns-a", PodName: "a"},
+		{Clock: at(2).ToRFC3339(), Kind: trace.Evict, PodNamespace: "ns-b", PodName: "b", NodeName: "node-0"},
+		{Clock: at(3).ToRFC3339(), Kind: trace.TerminateSubmitter, Source: "s"},
+	}))
+	assert.NoError(t, rec.Close())
+
+	since := at(1)
+	dst := filepath.Join(dir, "out.jsonl")
+	n, err := ExportTrace(src, dst, &Filter{
+		Since:    &since,
+		Selector: labels.SelectorFromSet(labels.Set{"app": "b"}),
+	}, logfile.Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	entries, err := trace.ReadTrace(dst)
+	assert.NoError(t, err)
+	kinds := []trace.Kind{}
+	for _, entry := range entries {
+		kinds = append(kinds, entry.Kind)
+	}
+	assert.Equal(t, []trace.Kind{trace.Bind, trace.Evict, trace.TerminateSubmitter}, kinds)
+	assert.Equal(t, "b", entries[0].Pod.Name)
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubesim
+
+import (
+	"github.com/containerd/containerd/log"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
+	"simulator/pkg/submitter"
+)
+
+// SetFastForward sets whether the simulation skips the ticks at which nothing happens, overriding
+// the fastForward field of the config.
+func (k *KubeSim) SetFastForward(enabled bool) {
+	k.fastForward = enabled
+}
+
+// nextClock returns the clock of the next tick, or of the first tick at or after the next wakeup if
+// fast-forwarding.
+// The clock always advances by a multiple of the tick, so that the ticks are the same as without
+// fast-forwarding.
+func (k *KubeSim) nextClock() clock.Clock {
+	next := k.clock.Add(k.tick)
+	if !k.fastForward {
+		return next
+	}
+
+	wakeup, ok := k.nextWakeup()
+	if !ok || !next.Before(wakeup) {
+		return next
+	}
+
+	ticks := (wakeup.Sub(k.clock) + k.tick - 1) / k.tick
+	next = k.clock.Add(ticks * k.tick)
+	log.L.Debugf("Fast-forward to %s", next.ToRFC3339())
+	return next
+}
+
+// nextWakeup returns the earliest clock after the current one at which something may happen: a
+// submitter submits (see submitter.Waker), a scheduler acts (see scheduler.Waker), a pod changes
+// its phase (see node.Node.NextWakeup), a pod held for its backoff is re-activated, the active
+// scheduler is switched, or a node event of the replayed trace is replayed.
+// The second return value is false if the next tick cannot be skipped, because pods are pending, the
+// autoscaler is enabled, or a submitter does not implement submitter.Waker.
+// The metrics and the checkpoints are not wakeups; they are written at the next tick processed.
+func (k *KubeSim) nextWakeup() (clock.Clock, bool) {
+	if _, err := k.pendingPods.Front(); err != queue.ErrEmptyQueue {
+		return k.clock, false
+	}
+	if k.autoscaler != nil {
+		return k.clock, false
+	}
+
+	var next clock.Clock
+	found := false
+	earliest := func(at clock.Clock, ok bool) {
+		if ok && (!found || at.Before(next)) {
+			next, found = at, true
+		}
+	}
+
+	for _, subm := range k.submitters {
+		waker, ok := subm.(submitter.Waker)
+		if !ok {
+			return k.clock, false
+		}
+		earliest(waker.NextWakeup(k.clock))
+	}
+	for _, sq := range k.schedulerQueues() {
+		if waker, ok := sq.scheduler.(scheduler.Waker); ok {
+			earliest(waker.NextWakeup(k.clock))
+		}
+	}
+	for _, node := range k.nodes {
+		earliest(node.NextWakeup(k.clock))
+	}
+	if k.unschedulable != nil {
+		earliest(k.unschedulable.NextWakeup())
+	}
+	if k.replayNodeEvents {
+		earliest(k.replayer.NextNodeEvent(k.clock))
+	}
+
+	k.switcher.mu.Lock()
+	if k.switcher.requested != "" {
+		earliest(k.clock, true)
+	}
+	if len(k.switcher.timed) > 0 {
+		earliest(k.switcher.timed[0].at, true)
+	}
+	k.switcher.mu.Unlock()
+
+	// Nothing happens until the simulation terminates.
+	if !found {
+		return k.clock, false
+	}
+	return next, true
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubesim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"simulator/pkg/metrics"
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
+	"simulator/pkg/workload"
+)
+
+func TestKubeSimFastForward(t *testing.T) {
+	run := func(fastForward bool) ([]metrics.Event, int) {
+		conf := newCheckpointConfig(10)
+		conf.FastForward = fastForward
+		binPacking := scheduler.NewBinPackingScheduler()
+		writer := &recordingWriter{}
+
+		k, err := NewKubeSim(WithConfig(conf), WithScheduler(&binPacking), WithMetricsWriter(writer),
+			WithQueue(queue.NewFIFOQueue()))
+		assert.NoError(t, err)
+		t0 := k.clock
+
+		events := []metrics.Event{}
+		k.AddEventHandler(func(e metrics.Event) error {
+			events = append(events, e)
+			return nil
+		})
+		k.AddSubmitter("Workload", workload.NewSubmitter([]workload.Pod{
+			{SubmitAt: t0, Pod: newCheckpointPod("pod-0")},
+			{SubmitAt: t0.Add(time.Hour + 5*time.Second), Pod: newCheckpointPod("pod-1")},
+		}))
+		assert.NoError(t, k.Run(context.Background()))
+
+		return events, len(writer.metrics)
+	}
+
+	events, writes := run(false)
+	fastEvents, fastWrites := run(true)
+
+	// The same events at the same ticks, with far fewer ticks processed.
+	assert.Equal(t, events, fastEvents)
+	assert.Len(t, events, 6)
+	assert.Equal(t, "2019-01-01T01:00:10Z", events[3].Clock, "not submitted at the next tick")
+	assert.True(t, fastWrites*10 < writes, "%d metrics written with fast-forward, %d without",
+		fastWrites, writes)
+}
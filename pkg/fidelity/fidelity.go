@@ -0,0 +1,279 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fidelity validates the scheduling decisions of the simulator against reference scenarios
+// whose placements by the upstream kube-scheduler are known, to quantify the fidelity of the
+// simulation after each change of a scheduler.
+package fidelity
+
+import (
+	"context"
+	"io/ioutil"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+	"sigs.k8s.io/yaml"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
+	"simulator/pkg/util"
+)
+
+// Scenario is a reference scenario: a cluster of nodes, and the pods submitted to it one by one
+// with the nodes to which the upstream kube-scheduler bound them.
+type Scenario struct {
+	Name  string     `json:"name"`
+	Nodes []*v1.Node `json:"nodes"`
+	Pods  []PodCase  `json:"pods"`
+}
+
+// PodCase is a pod of a Scenario with its expected placement.
+type PodCase struct {
+	Pod *v1.Pod `json:"pod"`
+	// ExpectedNode is the node to which the pod is bound at the end of the scenario, or empty if
+	// the pod is expected to be pending (or preempted).
+	ExpectedNode string `json:"expectedNode"`
+}
+
+// Report is the result of the validation of a scheduler with the scenarios.
+type Report struct {
+	// Pods is the number of pods in all the scenarios, and Matched is the number of them placed as
+	// expected.
+	Pods    int `json:"pods"`
+	Matched int `json:"matched"`
+	// Fidelity is Matched / Pods, or 1 if there are no pods.
+	Fidelity  float64          `json:"fidelity"`
+	Scenarios []ScenarioReport `json:"scenarios"`
+}
+
+// ScenarioReport is the result of the validation with a Scenario.
+type ScenarioReport struct {
+	Name     string  `json:"name"`
+	Pods     int     `json:"pods"`
+	Matched  int     `json:"matched"`
+	Fidelity float64 `json:"fidelity"`
+	// Mismatches are the pods placed differently from the expected ones, in the order of
+	// submission.
+	Mismatches []Mismatch `json:"mismatches"`
+}
+
+// Mismatch is a pod expected to be bound to Expected but bound to Actual by the simulator.
+// A node name is empty if the pod is pending.
+type Mismatch struct {
+	Pod      string `json:"pod"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// ReadScenarios reads the scenarios from the YAML (or JSON) file at the path.
+// Returns error if failed to read or parse the file, or a scenario is invalid.
+func ReadScenarios(path string) ([]Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	scenarios := []Scenario{}
+	if err := yaml.Unmarshal(data, &scenarios); err != nil {
+		return nil, strongerrors.InvalidArgument(
+			errors.Errorf("invalid scenarios %s: %s", path, err.Error()))
+	}
+
+	for i := range scenarios {
+		if err := scenarios[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return scenarios, nil
+}
+
+// validate returns error if this Scenario has no name, duplicate nodes or pods, or pods expected to
+// be bound to unknown nodes.
+// It also fills the namespaces of pods with the default one, and the capacity of nodes with the
+// allocatable if not given.
+func (s *Scenario) validate() error {
+	if s.Name == "" {
+		return strongerrors.InvalidArgument(errors.New("scenario without name"))
+	}
+
+	nodes := map[string]bool{}
+	for _, node := range s.Nodes {
+		if node == nil || node.Name == "" {
+			return strongerrors.InvalidArgument(errors.Errorf("scenario %s: node without name", s.Name))
+		}
+		if nodes[node.Name] {
+			return strongerrors.InvalidArgument(
+				errors.Errorf("scenario %s: duplicate node %s", s.Name, node.Name))
+		}
+		nodes[node.Name] = true
+		if node.Status.Capacity == nil {
+			node.Status.Capacity = node.Status.Allocatable
+		}
+	}
+
+	pods := map[string]bool{}
+	for _, c := range s.Pods {
+		if c.Pod == nil || c.Pod.Name == "" {
+			return strongerrors.InvalidArgument(errors.Errorf("scenario %s: pod without name", s.Name))
+		}
+		if c.Pod.Namespace == "" {
+			c.Pod.Namespace = v1.NamespaceDefault
+		}
+		key := util.PodKeyFromNames(c.Pod.Namespace, c.Pod.Name)
+		if pods[key] {
+			return strongerrors.InvalidArgument(errors.Errorf("scenario %s: duplicate pod %s", s.Name, key))
+		}
+		pods[key] = true
+		if c.ExpectedNode != "" && !nodes[c.ExpectedNode] {
+			return strongerrors.InvalidArgument(
+				errors.Errorf("scenario %s: pod %s expected on unknown node %s", s.Name, key, c.ExpectedNode))
+		}
+	}
+
+	return nil
+}
+
+// Validate runs each scenario with a new scheduler created by newScheduler, and reports the pods
+// placed differently from the expected ones.
+// The pods of a scenario are submitted one by one, each a second after the previous one, and the
+// scheduler is run after each submission until it makes no more decisions, so that the pods
+// preempting others are bound before the next submission.
+// Returns error if failed to create a scheduler or the scheduler failed.
+func Validate(
+	ctx context.Context, scenarios []Scenario, newScheduler func() (scheduler.Scheduler, error),
+) (*Report, error) {
+
+	report := &Report{Scenarios: []ScenarioReport{}}
+	for _, scenario := range scenarios {
+		sched, err := newScheduler()
+		if err != nil {
+			return nil, err
+		}
+
+		placements, err := run(ctx, scenario, sched)
+		if err != nil {
+			return nil, errors.Wrapf(err, "scenario %s", scenario.Name)
+		}
+
+		sr := ScenarioReport{Name: scenario.Name, Pods: len(scenario.Pods), Mismatches: []Mismatch{}}
+		for _, c := range scenario.Pods {
+			key := util.PodKeyFromNames(c.Pod.Namespace, c.Pod.Name)
+			if actual := placements[key]; actual != c.ExpectedNode {
+				sr.Mismatches = append(sr.Mismatches, Mismatch{Pod: key, Expected: c.ExpectedNode, Actual: actual})
+			} else {
+				sr.Matched++
+			}
+		}
+		sr.Fidelity = fidelity(sr.Matched, sr.Pods)
+
+		report.Pods += sr.Pods
+		report.Matched += sr.Matched
+		report.Scenarios = append(report.Scenarios, sr)
+	}
+	report.Fidelity = fidelity(report.Matched, report.Pods)
+
+	return report, nil
+}
+
+// start is the clock at which the first pod of a scenario is submitted.
+var start = clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+
+// run runs the scenario with the scheduler, and returns the map of the keys of the bound pods to
+// their nodes.
+func run(ctx context.Context, scenario Scenario, sched scheduler.Scheduler) (map[string]string, error) {
+	pending := queue.NewPriorityQueue()
+	bound := map[string]*v1.Pod{}
+	lister := nodeLister(scenario.Nodes)
+
+	for i, c := range scenario.Pods {
+		clk := start.Add(time.Duration(i) * time.Second)
+		pod := c.Pod.DeepCopy()
+		// NodeInfo identifies pods by their UIDs, as KubeSim sets on submission.
+		pod.UID = types.UID(util.PodKeyFromNames(pod.Namespace, pod.Name))
+		pod.CreationTimestamp = clk.ToMetaV1()
+		if err := pending.Push(pod); err != nil {
+			return nil, err
+		}
+
+		// Each decision binds or deletes a pod, so the scheduler settles within this many rounds
+		// unless it keeps preempting.
+		for round := 0; round <= len(scenario.Pods); round++ {
+			infoMap, err := nodeInfoMap(scenario.Nodes, bound)
+			if err != nil {
+				return nil, err
+			}
+			events, err := sched.Schedule(ctx, clk, pending, lister, infoMap)
+			if err != nil {
+				return nil, err
+			}
+			if len(events) == 0 {
+				break
+			}
+
+			for _, e := range events {
+				switch e := e.(type) {
+				case *scheduler.BindEvent:
+					p := e.Pod.DeepCopy()
+					p.Spec.NodeName = e.ScheduleResult.SuggestedHost
+					bound[util.PodKeyFromNames(p.Namespace, p.Name)] = p
+				case *scheduler.DeleteEvent:
+					delete(bound, util.PodKeyFromNames(e.PodNamespace, e.PodName))
+				}
+			}
+		}
+	}
+
+	placements := make(map[string]string, len(bound))
+	for key, pod := range bound {
+		placements[key] = pod.Spec.NodeName
+	}
+	return placements, nil
+}
+
+// nodeInfoMap builds the NodeInfo of each node with the pods bound to it.
+func nodeInfoMap(nodes []*v1.Node, bound map[string]*v1.Pod) (map[string]*nodeinfo.NodeInfo, error) {
+	infoMap := make(map[string]*nodeinfo.NodeInfo, len(nodes))
+	for _, node := range nodes {
+		info := nodeinfo.NewNodeInfo()
+		if err := info.SetNode(node); err != nil {
+			return nil, err
+		}
+		infoMap[node.Name] = info
+	}
+	for _, pod := range bound {
+		if info, ok := infoMap[pod.Spec.NodeName]; ok {
+			info.AddPod(pod)
+		}
+	}
+	return infoMap, nil
+}
+
+// nodeLister lists the nodes of a scenario.
+type nodeLister []*v1.Node
+
+func (l nodeLister) List() ([]*v1.Node, error) { return l, nil }
+
+// fidelity returns matched / total, or 1 if total is 0.
+func fidelity(matched, total int) float64 {
+	if total == 0 {
+		return 1
+	}
+	return float64(matched) / float64(total)
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fidelity
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/priorities"
+
+	"simulator/pkg/scheduler"
+)
+
+func TestReadScenarios(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fidelity")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	read := func(content string) ([]Scenario, error) {
+		path := filepath.Join(dir, "scenarios.yaml")
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		return ReadScenarios(path)
+	}
+
+	scenarios, err := read(`
+- name: scenario
+  nodes:
+  - metadata: {name: node-0}
+    status: {allocatable: {cpu: "1"}}
+  pods:
+  - pod: {metadata: {name: pod-0}}
+    expectedNode: node-0
+  - pod: {metadata: {name: pod-1, namespace: ns}}
+`)
+	assert.NoError(t, err)
+	assert.Len(t, scenarios, 1)
+	assert.Equal(t, scenarios[0].Nodes[0].Status.Allocatable, scenarios[0].Nodes[0].Status.Capacity)
+	assert.Equal(t, "default", scenarios[0].Pods[0].Pod.Namespace)
+	assert.Equal(t, "node-0", scenarios[0].Pods[0].ExpectedNode)
+	assert.Equal(t, "ns", scenarios[0].Pods[1].Pod.Namespace)
+	assert.Equal(t, "", scenarios[0].Pods[1].ExpectedNode)
+
+	_, err = read(`
+- name: scenario
+  nodes:
+  - metadata: {name: node-0}
+  pods:
+  - pod: {metadata: {name: pod-0}}
+    expectedNode: node-1
+`)
+	assert.EqualError(t, err, "scenario scenario: pod default/pod-0 expected on unknown node node-1")
+
+	_, err = read(`
+- name: scenario
+  pods:
+  - pod: {metadata: {name: pod-0}}
+  - pod: {metadata: {name: pod-0}}
+`)
+	assert.EqualError(t, err, "scenario scenario: duplicate pod default/pod-0")
+
+	_, err = read(`- nodes: []`)
+	assert.EqualError(t, err, "scenario without name")
+}
+
+func TestValidate(t *testing.T) {
+	scenarios, err := ReadScenarios("../../example/fidelity-scenarios.yaml")
+	assert.NoError(t, err)
+
+	// GeneralPredicates does not check taints.
+	report, err := Validate(context.Background(), scenarios, func() (scheduler.Scheduler, error) {
+		sched := scheduler.NewGenericScheduler( /* preemption enabled */ true)
+		sched.AddPredicate("GeneralPredicates", predicates.GeneralPredicates)
+		sched.AddPrioritizer(priorities.PriorityConfig{
+			Name:   "LeastRequested",
+			Map:    priorities.LeastRequestedPriorityMap,
+			Weight: 1,
+		})
+		return &sched, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 7, report.Pods)
+	assert.Equal(t, 6, report.Matched)
+	assert.InDelta(t, 6.0/7, report.Fidelity, 1e-9)
+	for _, sr := range report.Scenarios {
+		if sr.Name == "taints" {
+			assert.Equal(t, []Mismatch{{Pod: "default/intolerant", Expected: "untainted", Actual: "tainted"}},
+				sr.Mismatches)
+			assert.Equal(t, 0.0, sr.Fidelity)
+		} else {
+			assert.Empty(t, sr.Mismatches, sr.Name)
+		}
+	}
+
+	// The default profile of kube-scheduler places all the pods as expected, including preemption.
+	report, err = Validate(context.Background(), scenarios, func() (scheduler.Scheduler, error) {
+		return scheduler.NewGenericSchedulerFromConfiguration(&scheduler.KubeSchedulerConfiguration{
+			APIVersion: "kubescheduler.config.k8s.io/v1",
+			Kind:       "KubeSchedulerConfiguration",
+		})
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 7, report.Matched)
+	assert.Equal(t, 1.0, report.Fidelity)
+}
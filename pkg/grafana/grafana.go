@@ -0,0 +1,477 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package grafana serves the results database of a simulation (see metrics.SQLiteWriter) through
+// the API of the JSON datasource of Grafana, so that finished runs can be explored in dashboards.
+package grafana
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+
+	// Registers the "sqlite3" driver.
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// The targets are joined with TargetSeparator, which appears in neither node names nor resource
+// names:
+//
+//	ticks:<column>                    pending_pods, met_deadlines, or missed_deadlines
+//	node:<node>:<column>              running_pods, terminating_pods, or failed_pods of the node
+//	node:<node>:<resource>:<column>   allocatable, request, or usage of the resource of the node
+//	cluster:<resource>:<column>       request or usage of the resource over the cluster, as
+//	                                  fractions of the allocatable amount
+//	balance:<resource>:<column>       a column of the balance table (e.g., usage_cov)
+const TargetSeparator = ":"
+
+var (
+	tickColumns    = []string{"pending_pods", "met_deadlines", "missed_deadlines"}
+	nodeColumns    = []string{"running_pods", "terminating_pods", "failed_pods"}
+	resourceColumn = []string{"allocatable", "request", "usage"}
+	clusterColumns = []string{"request", "usage"}
+	balanceColumns = []string{
+		"request_mean", "request_stddev", "request_cov",
+		"usage_mean", "usage_stddev", "usage_cov", "usage_max", "saturated_nodes",
+	}
+)
+
+// Server is an http.Handler serving a results database through the JSON datasource API:
+//
+//	GET  /             health check
+//	POST /search       the targets containing the "target" of the request
+//	POST /metrics      the same targets, as the options of the newer plugin
+//	POST /query        the time series of the targets within the range
+//	POST /annotations  the events of pods of the kinds in the query of the annotation (e.g., Evict)
+type Server struct {
+	db  *sql.DB
+	mux *http.ServeMux
+}
+
+// NewServer creates a new Server of the results database at the path, opened read-only.
+// Returns error if failed to open the database.
+func NewServer(path string) (*Server, error) {
+	if path == "" {
+		return nil, strongerrors.InvalidArgument(errors.New("database path must not be empty"))
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "error opening %s", path)
+	}
+
+	s := &Server{db: db, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+		}
+	})
+	s.mux.HandleFunc("/search", s.post(s.search))
+	s.mux.HandleFunc("/metrics", s.post(s.metrics))
+	s.mux.HandleFunc("/query", s.post(s.query))
+	s.mux.HandleFunc("/annotations", s.post(s.annotations))
+
+	return s, nil
+}
+
+// ServeHTTP implements http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Close closes the database.
+func (s *Server) Close() error {
+	return s.db.Close()
+}
+
+// Range is the time range of a query.
+type Range struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// TimeSeries is the time series of a target, whose data points are pairs of a value and a Unix
+// time in milliseconds.
+type TimeSeries struct {
+	Target     string       `json:"target"`
+	DataPoints [][2]float64 `json:"datapoints"`
+}
+
+// Annotation is an event of a pod shown as an annotation.
+type Annotation struct {
+	Time  int64    `json:"time"`
+	Title string   `json:"title"`
+	Text  string   `json:"text"`
+	Tags  []string `json:"tags"`
+}
+
+// Targets returns the targets in the database, sorted.
+// Returns error if failed to query the database.
+func (s *Server) Targets() ([]string, error) {
+	targets := []string{}
+	for _, c := range tickColumns {
+		targets = append(targets, join("ticks", c))
+	}
+
+	nodes, err := s.distinct(`SELECT DISTINCT node FROM nodes`)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range nodes {
+		for _, c := range nodeColumns {
+			targets = append(targets, join("node", n, c))
+		}
+	}
+
+	rows, err := s.db.Query(`SELECT DISTINCT node, resource FROM node_resources`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	resources := map[string]bool{}
+	for rows.Next() {
+		var n, rsrc string
+		if err := rows.Scan(&n, &rsrc); err != nil {
+			return nil, err
+		}
+		for _, c := range resourceColumn {
+			targets = append(targets, join("node", n, rsrc, c))
+		}
+		resources[rsrc] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for rsrc := range resources {
+		for _, c := range clusterColumns {
+			targets = append(targets, join("cluster", rsrc, c))
+		}
+	}
+
+	balance, err := s.distinct(`SELECT DISTINCT resource FROM balance`)
+	if err != nil {
+		return nil, err
+	}
+	for _, rsrc := range balance {
+		for _, c := range balanceColumns {
+			targets = append(targets, join("balance", rsrc, c))
+		}
+	}
+
+	sort.Strings(targets)
+	return targets, nil
+}
+
+// Query returns the time series of the target within the range, in the order of time.
+// Returns error if the target is invalid or failed to query the database.
+func (s *Server) Query(target string, rng Range) (*TimeSeries, error) {
+	query, args, err := targetQuery(target)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := &TimeSeries{Target: target, DataPoints: [][2]float64{}}
+	for rows.Next() {
+		var clk string
+		var value float64
+		if err := rows.Scan(&clk, &value); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse(time.RFC3339, clk)
+		if err != nil {
+			return nil, err
+		}
+		if !inRange(t, rng) {
+			continue
+		}
+		series.DataPoints = append(series.DataPoints, [2]float64{value, float64(millis(t))})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(series.DataPoints, func(i, j int) bool {
+		return series.DataPoints[i][1] < series.DataPoints[j][1]
+	})
+	return series, nil
+}
+
+// Annotations returns the events of the kinds (all if empty) within the range, in the order of
+// time.
+// Returns error if failed to query the database.
+func (s *Server) Annotations(kinds []string, rng Range) ([]Annotation, error) {
+	rows, err := s.db.Query(`SELECT clock, kind, pod, node FROM events`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	selected := map[string]bool{}
+	for _, k := range kinds {
+		selected[k] = true
+	}
+
+	annotations := []Annotation{}
+	for rows.Next() {
+		var clk, kind, pod, node string
+		if err := rows.Scan(&clk, &kind, &pod, &node); err != nil {
+			return nil, err
+		}
+		if len(selected) > 0 && !selected[kind] {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, clk)
+		if err != nil {
+			return nil, err
+		}
+		if !inRange(t, rng) {
+			continue
+		}
+
+		text := pod
+		if pod == "" { // an event of the node
+			text = node
+		} else if node != "" {
+			text += " on " + node
+		}
+		annotations = append(annotations, Annotation{
+			Time: millis(t), Title: kind, Text: text, Tags: []string{kind},
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(annotations, func(i, j int) bool { return annotations[i].Time < annotations[j].Time })
+	return annotations, nil
+}
+
+// targetQuery returns the SQL query, and its arguments, of the clocks and the values of the target.
+func targetQuery(target string) (string, []interface{}, error) {
+	fields := strings.Split(target, TargetSeparator)
+
+	switch {
+	case fields[0] == "ticks" && len(fields) == 2 && contains(tickColumns, fields[1]):
+		return `SELECT clock, ` + fields[1] + ` FROM ticks`, nil, nil
+	case fields[0] == "node" && len(fields) == 3 && contains(nodeColumns, fields[2]):
+		return `SELECT clock, ` + fields[2] + ` FROM nodes WHERE node = ?`,
+			[]interface{}{fields[1]}, nil
+	case fields[0] == "node" && len(fields) == 4 && contains(resourceColumn, fields[3]):
+		return `SELECT clock, ` + fields[3] + ` FROM node_resources WHERE node = ? AND resource = ?`,
+			[]interface{}{fields[1], fields[2]}, nil
+	case fields[0] == "cluster" && len(fields) == 3 && contains(clusterColumns, fields[2]):
+		return `SELECT clock, SUM(` + fields[2] + `) / SUM(allocatable) FROM node_resources
+			WHERE resource = ? GROUP BY clock HAVING SUM(allocatable) > 0`,
+			[]interface{}{fields[1]}, nil
+	case fields[0] == "balance" && len(fields) == 3 && contains(balanceColumns, fields[2]):
+		return `SELECT clock, ` + fields[2] + ` FROM balance WHERE resource = ?`,
+			[]interface{}{fields[1]}, nil
+	default:
+		return "", nil, strongerrors.InvalidArgument(errors.Errorf("invalid target %q", target))
+	}
+}
+
+// post returns the handler of POST requests with JSON bodies decoded into the requests of f, which
+// returns the value responded as JSON.
+func (s *Server) post(f func(r *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		resp, err := f(r)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if strongerrors.IsInvalidArgument(err) {
+				status = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.L.Warnf("Error writing response to %s: %s", r.URL.Path, err.Error())
+		}
+	}
+}
+
+func (s *Server) search(r *http.Request) (interface{}, error) {
+	req := struct {
+		Target string `json:"target"`
+	}{}
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	return s.matchingTargets(req.Target)
+}
+
+func (s *Server) metrics(r *http.Request) (interface{}, error) {
+	req := struct {
+		Metric string `json:"metric"`
+	}{}
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	targets, err := s.matchingTargets(req.Metric)
+	if err != nil {
+		return nil, err
+	}
+
+	type option struct {
+		Label string `json:"label"`
+		Value string `json:"value"`
+	}
+	options := make([]option, 0, len(targets))
+	for _, t := range targets {
+		options = append(options, option{Label: t, Value: t})
+	}
+	return options, nil
+}
+
+func (s *Server) query(r *http.Request) (interface{}, error) {
+	req := struct {
+		Range   Range `json:"range"`
+		Targets []struct {
+			Target string `json:"target"`
+			Hide   bool   `json:"hide"`
+		} `json:"targets"`
+	}{}
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+
+	series := []*TimeSeries{}
+	for _, t := range req.Targets {
+		if t.Target == "" || t.Hide {
+			continue
+		}
+		ts, err := s.Query(t.Target, req.Range)
+		if err != nil {
+			return nil, err
+		}
+		series = append(series, ts)
+	}
+	return series, nil
+}
+
+func (s *Server) annotations(r *http.Request) (interface{}, error) {
+	req := struct {
+		Range      Range `json:"range"`
+		Annotation struct {
+			Query string `json:"query"`
+		} `json:"annotation"`
+	}{}
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+
+	kinds := []string{}
+	for _, k := range strings.Split(req.Annotation.Query, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			kinds = append(kinds, k)
+		}
+	}
+	return s.Annotations(kinds, req.Range)
+}
+
+// matchingTargets returns the targets containing the substring.
+func (s *Server) matchingTargets(substr string) ([]string, error) {
+	targets, err := s.Targets()
+	if err != nil {
+		return nil, err
+	}
+
+	matching := []string{}
+	for _, t := range targets {
+		if strings.Contains(t, substr) {
+			matching = append(matching, t)
+		}
+	}
+	return matching, nil
+}
+
+// distinct returns the values of the single column of the rows of the query.
+func (s *Server) distinct(query string) ([]string, error) {
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+func decode(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return strongerrors.InvalidArgument(errors.Errorf("invalid request: %s", err.Error()))
+	}
+	return nil
+}
+
+// inRange returns whether the time is within the range, or true if the range is not given.
+func inRange(t time.Time, rng Range) bool {
+	if !rng.From.IsZero() && t.Before(rng.From) {
+		return false
+	}
+	if !rng.To.IsZero() && t.After(rng.To) {
+		return false
+	}
+	return true
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func join(fields ...string) string {
+	return strings.Join(fields, TargetSeparator)
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+var _ = http.Handler(&Server{})
@@ -0,0 +1,134 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grafana
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/metrics"
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+)
+
+func writeResults(t *testing.T, path string, start clock.Clock) {
+	writer, err := metrics.NewSQLiteWriter(path)
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		clk := start.Add(time.Duration(i) * time.Minute)
+		cpu := resource.NewMilliQuantity(int64(1000*i), resource.DecimalSI)
+		assert.NoError(t, writer.Write(&metrics.Metrics{
+			metrics.ClockKey: clk.ToRFC3339(),
+			metrics.NodesMetricsKey: map[string]node.Metrics{
+				"node-0": {
+					Allocatable:          v1.ResourceList{"cpu": resource.MustParse("4")},
+					RunningPodsNum:       int64(i),
+					TotalResourceRequest: v1.ResourceList{"cpu": *cpu},
+					TotalResourceUsage:   v1.ResourceList{"cpu": *cpu},
+				},
+				"node-1": {
+					Allocatable:          v1.ResourceList{"cpu": resource.MustParse("4")},
+					TotalResourceRequest: v1.ResourceList{},
+					TotalResourceUsage:   v1.ResourceList{},
+				},
+			},
+			metrics.PodsMetricsKey:  map[string]pod.Metrics{},
+			metrics.QueueMetricsKey: queue.Metrics{PendingPodsNum: 3 - i},
+		}))
+	}
+	assert.NoError(t, writer.WriteEvents([]metrics.Event{
+		{Clock: start.ToRFC3339(), Kind: metrics.SubmitEvent, Pod: "default/pod-0"},
+		{Clock: start.Add(time.Minute).ToRFC3339(), Kind: metrics.BindEvent, Pod: "default/pod-0", Node: "node-0"},
+	}))
+	assert.NoError(t, writer.Close())
+}
+
+func post(t *testing.T, url, body string, v interface{}) int {
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+	return resp.StatusCode
+}
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grafana")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "results.db")
+	start := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	writeResults(t, path, start)
+
+	server, err := NewServer(path)
+	assert.NoError(t, err)
+	defer server.Close()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	targets := []string{}
+	assert.Equal(t, http.StatusOK, post(t, ts.URL+"/search", `{"target": "cluster"}`, &targets))
+	assert.Equal(t, []string{"cluster:cpu:request", "cluster:cpu:usage"}, targets)
+
+	targets = []string{}
+	assert.Equal(t, http.StatusOK, post(t, ts.URL+"/search", `{"target": ""}`, &targets))
+	assert.Contains(t, targets, "ticks:pending_pods")
+	assert.Contains(t, targets, "node:node-1:running_pods")
+	assert.Contains(t, targets, "node:node-0:cpu:allocatable")
+
+	series := []TimeSeries{}
+	assert.Equal(t, http.StatusOK, post(t, ts.URL+"/query", `{
+		"range": {"from": "2019-01-01T00:01:00.000Z", "to": "2019-01-01T01:00:00.000Z"},
+		"targets": [{"target": "ticks:pending_pods"}, {"target": "cluster:cpu:usage"}, {"target": ""}]
+	}`, &series))
+	ms := func(clk clock.Clock) float64 { return float64(clk.ToMetaV1().UnixNano() / int64(time.Millisecond)) }
+	t1, t2 := start.Add(time.Minute), start.Add(2*time.Minute)
+	assert.Equal(t, []TimeSeries{
+		{Target: "ticks:pending_pods", DataPoints: [][2]float64{{2, ms(t1)}, {1, ms(t2)}}},
+		{Target: "cluster:cpu:usage", DataPoints: [][2]float64{{0.125, ms(t1)}, {0.25, ms(t2)}}},
+	}, series)
+
+	assert.Equal(t, http.StatusBadRequest,
+		post(t, ts.URL+"/query", `{"targets": [{"target": "node:node-0:cpu:limit"}]}`, nil))
+
+	annotations := []Annotation{}
+	assert.Equal(t, http.StatusOK,
+		post(t, ts.URL+"/annotations", `{"annotation": {"query": "Bind"}}`, &annotations))
+	assert.Equal(t, []Annotation{
+		{Time: int64(ms(t1)), Title: "Bind", Text: "default/pod-0 on node-0", Tags: []string{"Bind"}},
+	}, annotations)
+}
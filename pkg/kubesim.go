@@ -17,6 +17,10 @@ package kubesim
 import (
 	"context"
 	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
 	"time"
 
 	"github.com/containerd/containerd/log"
@@ -25,46 +29,130 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	podutil "k8s.io/kubernetes/pkg/api/v1/pod"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
 	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
 
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/clock"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/config"
-	l "github.com/pfnet-research/k8s-cluster-simulator/pkg/log"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/metrics"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/node"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/pod"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/queue"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/scheduler"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/submitter"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/util"
+	"simulator/pkg/api"
+	"simulator/pkg/autoscaler"
+	"simulator/pkg/clock"
+	"simulator/pkg/config"
+	l "simulator/pkg/log"
+	"simulator/pkg/metrics"
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+	"simulator/pkg/reservation"
+	"simulator/pkg/scheduler"
+	"simulator/pkg/submitter"
+	"simulator/pkg/trace"
+	"simulator/pkg/util"
+	"simulator/pkg/workload"
 )
 
 // KubeSim represents a simulated kubernetes cluster.
 type KubeSim struct {
 	tick  time.Duration
 	clock clock.Clock
+	// realTime paces the simulation to the wall clock multiplied by speedFactor.
+	realTime    bool
+	speedFactor float64
+	// fastForward skips the ticks at which nothing happens (see nextClock).
+	fastForward bool
+	// prevClock is the clock of the tick processed last.
+	prevClock clock.Clock
 
 	nodes       map[string]*node.Node
 	pendingPods queue.PodQueue
 	boundPods   map[string]*pod.Pod
-
-	submitters map[string]submitter.Submitter
-	scheduler  scheduler.Scheduler
+	// nodeInfoSnapshot is the NodeInfo of each node given to the schedulers, copied from the cache
+	// of the node only when it has changed (see updateNodeInfoSnapshot).
+	nodeInfoSnapshot map[string]*nodeinfo.NodeInfo
+	// conf is the config of the node-level settings of the nodes added by AddNode.
+	conf *config.Config
+
+	submitters   map[string]submitter.Submitter
+	scheduler    scheduler.Scheduler
+	switcher     *schedulerSwitcher
+	reservations *reservation.Store
+	// routing routes the pods to the queues of the schedulers added by AddScheduler, or is nil if
+	// none is added; routed are those schedulers by their names.
+	routing *queue.RoutingQueue
+	routed  map[string]scheduler.Scheduler
+	// podsPerTick is the maximum number of pods that the scheduler tries to schedule at each tick,
+	// or 0 if unlimited.
+	podsPerTick int
+	// unschedulable holds the pods that the scheduler failed to schedule for their backoffs, or is
+	// nil if the backoff is disabled.
+	unschedulable *queue.UnschedulablePods
+	// submittedPods is the number of the pods submitted by the submitters.
+	submittedPods int
+	// requeuePreempted pushes the pods preempted by the scheduler back to the queue.
+	requeuePreempted bool
+	// rand is the random number generator of the simulation seeded by the config, from which the
+	// schedulers (see scheduler.Randomized) and the generators draw.
+	rand *rand.Rand
+	// generated are the submitters of the synthetic workloads in the config.
+	generated []*workload.Submitter
+	// autoscaler scales the node groups at each tick, or nil if disabled.
+	autoscaler *autoscaler.Autoscaler
 
 	metricsWriters []metrics.Writer
-	metricsTick    time.Duration
+	// eventHandlers are invoked with the events written to the metrics writers.
+	eventHandlers []metrics.EventHandler
+	metricsTick   time.Duration
+	// metricsClock is the clock at which the metrics were written last.
+	metricsClock clock.Clock
+	deadlines    metrics.DeadlineTracker
+	// saturationThreshold is the utilization at or above which a node is saturated (see
+	// metrics.BuildBalanceMetrics).
+	saturationThreshold float64
+	// priorityClasses resolve the priorities of the submitted pods.
+	priorityClasses *pod.PriorityClasses
+	// namespaces admit the submitted pods by the LimitRanges and the ResourceQuotas of their
+	// namespaces.
+	namespaces *pod.Namespaces
+	// quotaWaiting maps the keys of the pods admitted by the ResourceQuotas of their namespaces and
+	// not bound yet to their charges.
+	quotaWaiting map[string]quotaCharge
+	// quotaUsed is the usage of the ResourceQuotas by namespace, or nil if not computed since the
+	// last submission (see quotaUsage).
+	quotaUsed map[string]v1.ResourceList
+	// api serves the metrics written last on apiAddr during Run, or nil if disabled.
+	api     *api.Server
+	apiAddr string
+
+	checkpointFile  string
+	checkpointTick  time.Duration
+	checkpointClock clock.Clock
+
+	trace *trace.Recorder
+	// source is the name of the submitter being called, with which its node changes are recorded in
+	// the trace.
+	source string
+	// replayer replays the trace given by WithReplayer, or is nil if none; replayNodeEvents is
+	// whether its node changes made outside the submitters and its pods killed by their nodes are
+	// replayed, i.e., its scheduling decisions are.
+	replayer         *trace.Replayer
+	replayNodeEvents bool
 }
 
-// NewKubeSim creates a new KubeSim with the given config, queue, and scheduler.
+// NewKubeSim creates a new KubeSim configured with the options (see WithConfig, WithNodes,
+// WithQueue, WithScheduler, WithClock, WithMetricsWriter, and WithSubmitter).
+// If the config has schedulerConfig, the scheduler built from it is used if WithScheduler is not
+// given, or registered with KubeSchedulerConfigName otherwise.
+// The level of the global logger is set only with WithGlobalLogLevel.
 // Returns error if the configuration failed.
-func NewKubeSim(
-	conf *config.Config, queue queue.PodQueue, sched scheduler.Scheduler,
-) (*KubeSim, error) {
+func NewKubeSim(opts ...Option) (*KubeSim, error) {
+	o := buildOptions(opts)
+	conf, queue, sched := o.conf, o.queue, o.scheduler
 
 	log.G(context.TODO()).Debugf("Config: %+v", *conf)
 
-	if err := configLog(conf.LogLevel); err != nil {
+	if err := configLog(conf.LogLevel, o.globalLogLevel); err != nil {
 		return nil, errors.Errorf("Error configuring logging: %s", err.Error())
 	}
 
@@ -72,61 +160,210 @@ func NewKubeSim(
 	if err != nil {
 		return nil, err
 	}
+	if o.clock != nil {
+		clk = *o.clock
+	}
 
-	nodes, err := buildCluster(conf)
+	nodes, err := buildCluster(conf, clk)
 	if err != nil {
 		return nil, err
 	}
+	for _, nodeV1 := range o.nodes {
+		if _, ok := nodes[nodeV1.Name]; ok {
+			return nil, strongerrors.InvalidArgument(errors.Errorf("duplicate node %s", nodeV1.Name))
+		}
+		nodeSim, err := buildNodeFromV1(conf, nodeV1, nil, clk)
+		if err != nil {
+			return nil, err
+		}
+		nodes[nodeV1.Name] = nodeSim
+	}
 
 	metricsTick := conf.Tick
 	if conf.MetricsTick != 0 {
 		metricsTick = conf.MetricsTick
 	}
 
+	checkpointTick := defaultCheckpointTick
+	if conf.CheckpointTick != 0 {
+		checkpointTick = conf.CheckpointTick
+	}
+
 	metricsWriters, err := buildMetricsWriters(conf)
 	if err != nil {
 		return nil, err
 	}
+	metricsWriters = append(metricsWriters, o.writers...)
 
-	return &KubeSim{
-		tick:  time.Duration(conf.Tick) * time.Second,
-		clock: clk,
+	clockMode, err := config.BuildClockMode(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	apiAddr, err := config.BuildAPIAddress(conf.APIPort)
+	if err != nil {
+		return nil, err
+	}
+	var apiServer *api.Server
+	if apiAddr != "" {
+		apiServer = api.NewServer()
+		metricsWriters = append(metricsWriters, apiServer)
+	}
+
+	reservations, err := buildReservations(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	saturationThreshold, err := config.BuildSaturationThreshold(conf.SaturationThreshold)
+	if err != nil {
+		return nil, err
+	}
+
+	priorityClasses, err := config.BuildPriorityClasses(conf.PriorityClasses)
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces, err := config.BuildNamespaces(conf.Namespaces)
+	if err != nil {
+		return nil, err
+	}
+
+	podsPerTick, err := config.BuildPodsPerTick(conf.PodsPerTick)
+	if err != nil {
+		return nil, err
+	}
+
+	queueName := ""
+	if queue == nil {
+		if queue, err = config.BuildQueue(conf.Queue); err != nil {
+			return nil, err
+		}
+		queueName = config.QueueName(conf.Queue)
+	}
+
+	unschedulable, err := buildUnschedulablePods(conf, queue)
+	if err != nil {
+		return nil, err
+	}
+
+	configSched, err := buildScheduler(conf)
+	if err != nil {
+		return nil, err
+	}
+	if sched == nil {
+		if configSched == nil {
+			return nil, strongerrors.InvalidArgument(errors.New("neither WithScheduler nor schedulerConfig given"))
+		}
+		sched, configSched = configSched, nil
+	}
+
+	kubesim := &KubeSim{
+		tick:        time.Duration(conf.Tick) * time.Second,
+		clock:       clk,
+		realTime:    clockMode.RealTime,
+		speedFactor: clockMode.SpeedFactor,
+		fastForward: clockMode.FastForward,
 
 		nodes:       nodes,
 		pendingPods: queue,
 		boundPods:   map[string]*pod.Pod{},
+		conf:        conf,
 
-		submitters: map[string]submitter.Submitter{},
-		scheduler:  sched,
+		submitters:   map[string]submitter.Submitter{},
+		scheduler:    sched,
+		switcher:     newSchedulerSwitcher(sched),
+		routed:       map[string]scheduler.Scheduler{},
+		reservations: reservations,
+
+		podsPerTick:      podsPerTick,
+		unschedulable:    unschedulable,
+		requeuePreempted: conf.RequeuePreemptedPods,
+		rand:             rand.New(rand.NewSource(conf.Seed)),
 
 		metricsTick:    time.Duration(metricsTick) * time.Second,
+		metricsClock:   clk,
 		metricsWriters: metricsWriters,
-	}, nil
+
+		saturationThreshold: saturationThreshold,
+		priorityClasses:     priorityClasses,
+		namespaces:          namespaces,
+		quotaWaiting:        map[string]quotaCharge{},
+		api:                 apiServer,
+		apiAddr:             apiAddr,
+
+		checkpointFile:  conf.CheckpointFile,
+		checkpointTick:  time.Duration(checkpointTick) * time.Second,
+		checkpointClock: clk,
+
+		replayer: o.replayer,
+	}
+	if o.replayer != nil {
+		kubesim.replayNodeEvents = sched == o.replayer.Scheduler()
+		for name, sub := range o.replayer.Submitters() {
+			kubesim.AddSubmitter(name, sub)
+		}
+	}
+
+	kubesim.deadlines.SetQueue(queueName)
+	kubesim.randomize(sched)
+	for _, sub := range o.submitters {
+		kubesim.AddSubmitter(sub.name, sub.submitter)
+	}
+	if configSched != nil {
+		kubesim.RegisterScheduler(KubeSchedulerConfigName, configSched)
+	}
+	if err := buildSchedulerSwitches(kubesim, conf); err != nil {
+		return nil, err
+	}
+	if o.replayer == nil {
+		// The generated pods are replayed by the submitters of the replayer otherwise.
+		if err := buildGenerators(kubesim, conf); err != nil {
+			return nil, err
+		}
+	}
+	if err := buildAutoscaler(kubesim, conf); err != nil {
+		return nil, err
+	}
+	if o.replayer == nil {
+		// The faults are replayed by the submitters of the replayer otherwise.
+		if err := buildFaults(kubesim, conf); err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.TraceFile != "" {
+		opts := config.BuildFileOptions(conf.TraceCompression, conf.TraceMaxSize)
+		if kubesim.trace, err = trace.NewRecorder(conf.TraceFile, opts); err != nil {
+			return nil, err
+		}
+		if conf.TraceAnonymization != nil {
+			kubesim.trace.SetAnonymizer(config.BuildAnonymizer(conf.TraceAnonymization))
+		}
+		log.L.Infof("Trace recorded to %s", conf.TraceFile)
+	}
+
+	return kubesim, nil
 }
 
 // NewKubeSimFromConfigPath creates a new KubeSim with config from confPath (excluding file
-// extension), queue, and scheduler.
+// extension) and the other options.
 // Returns error if the configuration failed.
-func NewKubeSimFromConfigPath(
-	confPath string, queue queue.PodQueue, sched scheduler.Scheduler,
-) (*KubeSim, error) {
-
+func NewKubeSimFromConfigPath(confPath string, opts ...Option) (*KubeSim, error) {
 	conf, err := readConfig(confPath)
 	if err != nil {
 		return nil, errors.Errorf("Error reading config: %s", err.Error())
 	}
 
-	return NewKubeSim(conf, queue, sched)
+	return NewKubeSim(append([]Option{WithConfig(conf)}, opts...)...)
 }
 
 // NewKubeSimFromConfigPathOrDie creates a new KubeSim with config from confPath (excluding file
-// extension), queue, and scheduler.
+// extension) and the other options.
 // If an error occurs during the initialization, it panics and stops the execution.
-func NewKubeSimFromConfigPathOrDie(
-	confPath string, queue queue.PodQueue, sched scheduler.Scheduler,
-) *KubeSim {
-
-	kubesim, err := NewKubeSimFromConfigPath(confPath, queue, sched)
+func NewKubeSimFromConfigPathOrDie(confPath string, opts ...Option) *KubeSim {
+	kubesim, err := NewKubeSimFromConfigPath(confPath, opts...)
 	if err != nil {
 		log.L.Fatal(err)
 	}
@@ -139,22 +376,101 @@ func (k *KubeSim) AddSubmitter(name string, submitter submitter.Submitter) {
 	k.submitters[name] = submitter
 }
 
+// AddMetricsWriter adds the new metrics writer to this KubeSim, in addition to the ones of the
+// config and WithMetricsWriter.
+// It is closed at the end of Run if it implements io.Closer.
+func (k *KubeSim) AddMetricsWriter(writer metrics.Writer) {
+	k.metricsWriters = append(k.metricsWriters, writer)
+}
+
+// AddEventHandler adds the handler invoked with each event of pods and nodes (e.g., the submission,
+// binding, and completion of a pod, and the addition of a node) at the tick it happens.
+// The nodes of the config and WithNodes are not added during the simulation, so no events of them.
+func (k *KubeSim) AddEventHandler(handler metrics.EventHandler) {
+	k.eventHandlers = append(k.eventHandlers, handler)
+}
+
+// AddReservation adds the new reservation to this KubeSim.
+// Returns error if the reservation is invalid, or one with the same name already exists.
+func (k *KubeSim) AddReservation(r *reservation.Reservation) error {
+	return k.reservations.Add(r)
+}
+
+// Reservations returns the reservation.Store of this KubeSim.
+// Once the store has a reservation, its predicate is registered with the schedulers filtering nodes
+// by predicates (e.g., the built-in schedulers) under reservation.PredicateName, so that they
+// respect the reservations.
+func (k *KubeSim) Reservations() *reservation.Store {
+	return k.reservations
+}
+
+// predicateAdder is a scheduler filtering nodes by the predicates added to it.
+type predicateAdder interface {
+	AddPredicate(name string, predicate predicates.FitPredicate)
+}
+
+// addReservationPredicate registers the predicate of the reservations with the scheduler if it is
+// a predicateAdder and any reservation exists.
+func (k *KubeSim) addReservationPredicate(sched scheduler.Scheduler) {
+	if k.reservations.Len() == 0 {
+		return
+	}
+	if adder, ok := sched.(predicateAdder); ok {
+		adder.AddPredicate(reservation.PredicateName, k.reservations.Predicate)
+	}
+}
+
 // Run executes the main loop, which invokes submitters and the scheduler, and binds pods to the
 // selected nodes.
 // This method blocks until ctx is done or this KubeSim finishes processing all pods.
 // 开始运行循环
 func (k *KubeSim) Run(ctx context.Context) error {
-	preMetricsClock := k.clock
-	met, err := metrics.BuildMetrics(k.clock, k.nodes, k.pendingPods)
+	return k.RunUntil(ctx, nil)
+}
+
+// RunUntil executes the main loop like Run, and also ends it at the start of the first tick at
+// which cond holds, if not nil (see Condition).
+func (k *KubeSim) RunUntil(ctx context.Context, cond Condition) error {
+	if k.trace != nil {
+		defer func() {
+			if err := k.trace.Close(); err != nil {
+				log.L.Errorf("Error closing trace: %s", err.Error())
+			}
+		}()
+	}
+	defer k.closeMetricsWriters()
+
+	met, err := k.buildMetrics()
 	if err != nil {
 		return err
 	}
+	if k.api != nil {
+		if err := k.api.Listen(k.apiAddr); err != nil {
+			return err
+		}
+		if err := k.api.Write(&met); err != nil {
+			return err
+		}
+	}
 
 	submitterAddedEver := len(k.submitters) > 0
+	wallStart, simStart := time.Now(), k.clock
+	k.prevClock = k.clock.Add(-k.tick)
 
-	for {
+	for ticks := 0; ; ticks++ {
 		if k.toTerminate(submitterAddedEver) {
 			log.L.Debug("Terminate KubeSim")
+			// The last pods have completed since the last tick.
+			if err = k.recordCompletedPods(); err != nil {
+				return err
+			}
+			break
+		}
+		if cond != nil && cond(k.runState(ticks, met, submitterAddedEver)) {
+			log.L.Debugf("Terminate KubeSim by the condition at %s", k.clock.ToRFC3339())
+			if err = k.recordCompletedPods(); err != nil {
+				return err
+			}
 			break
 		}
 		submitterAddedEver = submitterAddedEver || len(k.submitters) > 0
@@ -165,22 +481,34 @@ func (k *KubeSim) Run(ctx context.Context) error {
 		default:
 			log.L.Debugf("Clock %s", k.clock.ToRFC3339())
 
-			if k.submit(met) != nil {
+			if err = k.submit(ctx, met); err != nil {
+				return err
+			}
+
+			if err = k.schedule(ctx); err != nil {
 				return err
 			}
 
-			if k.schedule() != nil {
+			if err = k.evictPods(); err != nil {
+				return err
+			}
+
+			if err = k.recordCompletedPods(); err != nil {
+				return err
+			}
+
+			if err = k.autoscale(); err != nil {
 				return err
 			}
 
 			// Rebuild metrics every tick for submitters to use.
-			met, err = metrics.BuildMetrics(k.clock, k.nodes, k.pendingPods)
+			met, err = k.buildMetrics()
 			if err != nil {
 				return err
 			}
 
-			if k.clock.Sub(preMetricsClock) > k.metricsTick {
-				preMetricsClock = k.clock
+			if k.clock.Sub(k.metricsClock) > k.metricsTick {
+				k.metricsClock = k.clock
 				// 此处查看metricsWriters
 				if err = k.writeMetrics(&met); err != nil {
 					return err
@@ -189,55 +517,149 @@ func (k *KubeSim) Run(ctx context.Context) error {
 				k.gcTerminatedPodsInNodes()
 			}
 
-			k.clock = k.clock.Add(k.tick)
+			k.prevClock = k.clock
+			k.clock = k.nextClock()
+			if k.realTime {
+				elapsed := time.Duration(float64(k.clock.Sub(simStart)) / k.speedFactor)
+				if err = waitUntil(ctx, wallStart.Add(elapsed)); err != nil {
+					return err
+				}
+			}
+
+			if k.checkpointFile != "" && k.clock.Sub(k.checkpointClock) >= k.checkpointTick {
+				k.checkpointClock = k.clock
+				if err = k.SaveCheckpoint(k.checkpointFile); err != nil {
+					return err
+				}
+			}
 		}
 	}
 
 	return nil
 }
 
+// SetRealTime sets whether the simulation is paced to the wall clock, overriding the realTime field
+// of the config.
+func (k *KubeSim) SetRealTime(enabled bool) {
+	k.realTime = enabled
+}
+
+// SetSpeedFactor sets the ratio of the simulated time to the wall-clock time of the simulation
+// paced to the wall clock, overriding the speedFactor field of the config.
+// Returns error if the factor is not positive.
+func (k *KubeSim) SetSpeedFactor(factor float64) error {
+	if !(factor > 0) || math.IsInf(factor, 0) {
+		return strongerrors.InvalidArgument(errors.Errorf("invalid speed factor %v", factor))
+	}
+	k.speedFactor = factor
+	return nil
+}
+
+// waitUntil waits until the wall clock reaches the time, or returns the error of the context if it
+// is done before.
+func waitUntil(ctx context.Context, t time.Time) error {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 // List implements "k8s.io/pkg/scheduler/algorithm".NodeLister interface.
+// The nodes are sorted by their names, so that the schedulers visit them in the same order in
+// every run.
 // Never returns an error.
 func (k *KubeSim) List() ([]*v1.Node, error) {
 	nodes := make([]*v1.Node, 0, len(k.nodes))
-	for _, node := range k.nodes {
-		nodes = append(nodes, node.ToV1())
+	for _, name := range k.nodeNames() {
+		nodes = append(nodes, k.nodes[name].ToV1())
 	}
 	return nodes, nil
 }
 
+// nodeNames returns the names of the nodes in ascending order.
+func (k *KubeSim) nodeNames() []string {
+	names := make([]string, 0, len(k.nodes))
+	for name := range k.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ListPods implements submitter.PodLister interface.
+// The pods deleted by the submitters are listed until their grace periods end, as well as the
+// evicted pods and the pods that have failed to start.
+// The pods are sorted by their keys.
+// Never returns an error.
+func (k *KubeSim) ListPods(selector labels.Selector) ([]*v1.Pod, error) {
+	keys := make([]string, 0, len(k.boundPods))
+	for key := range k.boundPods {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pods := make([]*v1.Pod, 0, len(keys))
+	for _, key := range keys {
+		p := k.boundPods[key]
+		if p.IsDeleted(k.clock) && !p.IsEvicted() && !p.IsOOMKilled() {
+			continue
+		}
+		if !selector.Matches(labels.Set(p.ToV1().Labels)) {
+			continue
+		}
+
+		podV1 := p.ToV1().DeepCopy()
+		podV1.Status = p.BuildStatus(k.clock)
+		pods = append(pods, podV1)
+	}
+
+	return pods, nil
+}
+
+var _ = submitter.PodLister(&KubeSim{})
+
 // readConfig reads and parses a config from the path (excluding file extension).
+// A new viper instance is used, so that reading a config does not affect the global one.
 func readConfig(path string) (*config.Config, error) {
-	viper.SetConfigName(path)
-	viper.AddConfigPath(".")
+	v := viper.New()
+	v.SetConfigName(path)
+	v.AddConfigPath(".")
 
-	if err := viper.ReadInConfig(); err != nil {
+	if err := v.ReadInConfig(); err != nil {
 		return nil, err
 	}
-	log.G(context.TODO()).Debugf("Config file %s", viper.ConfigFileUsed())
+	log.G(context.TODO()).Debugf("Config file %s", v.ConfigFileUsed())
 
 	var conf = config.Config{
-		LogLevel: "info",
-		Tick:     10,
+		Tick: 10,
 	}
 
-	if err := viper.Unmarshal(&conf); err != nil {
+	if err := v.Unmarshal(&conf); err != nil {
 		return nil, err
 	}
 
 	return &conf, nil
 }
 
-func configLog(logLevel string) error {
-	level, err := log.ParseLevel(logLevel) // if logLevel == "" then level <- info
+// configLog validates the log level, info if empty, and sets the level of the global logger to it if
+// global.
+func configLog(logLevel string, global bool) error {
+	if logLevel == "" {
+		logLevel = "info"
+	}
+	level, err := log.ParseLevel(logLevel)
 	if err != nil {
 		return strongerrors.InvalidArgument(
-			errors.Errorf("Log level %q not supported: %s", level, err.Error()))
+			errors.Errorf("Log level %q not supported: %s", logLevel, err.Error()))
+	}
+	if global {
+		logrus.SetLevel(level)
 	}
-	logrus.SetLevel(level)
-
-	logger := log.L
-	log.L = logger
 
 	return nil
 }
@@ -256,21 +678,105 @@ func buildClock(startClock string) (clock.Clock, error) {
 	return clk, nil
 }
 
-func buildCluster(conf *config.Config) (map[string]*node.Node, error) {
+func buildCluster(conf *config.Config, clk clock.Clock) (map[string]*node.Node, error) {
 	nodes := map[string]*node.Node{}
 	for _, nodeConf := range conf.Cluster {
-		nodeV1, err := config.BuildNode(nodeConf, conf.StartClock)
+		nodeSim, err := buildNode(conf, nodeConf, clk)
 		if err != nil {
 			return nil, err
 		}
+		nodes[nodeSim.ToV1().Name] = nodeSim
+	}
+
+	return nodes, nil
+}
 
-		nodeSim := node.NewNode(nodeV1)
-		nodes[nodeV1.Name] = &nodeSim
+// buildNode creates a node with the NodeConfig, started at the clock with its system pods.
+func buildNode(conf *config.Config, nodeConf config.NodeConfig, clk clock.Clock) (*node.Node, error) {
+	maxPods, err := config.BuildMaxPods(conf.MaxPods)
+	if err != nil {
+		return nil, err
+	}
 
-		log.L.Debugf("Node %s created: %v", nodeV1.Name, nodeV1)
+	nodeV1, err := config.BuildNode(nodeConf, clk.ToRFC3339(), maxPods)
+	if err != nil {
+		return nil, err
+	}
+	systemPods, err := config.BuildSystemPods(nodeConf.SystemPods, nodeV1.Name)
+	if err != nil {
+		return nil, err
 	}
 
-	return nodes, nil
+	return newNode(conf, nodeV1, systemPods, clk)
+}
+
+// buildNodeFromV1 creates a node from a copy of the v1.Node given by WithNodes or AddNode, started
+// at the clock with the system pods.
+func buildNodeFromV1(
+	conf *config.Config, nodeV1 *v1.Node, systemPods []*v1.Pod, clk clock.Clock,
+) (*node.Node, error) {
+
+	maxPods, err := config.BuildMaxPods(conf.MaxPods)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeV1 = nodeV1.DeepCopy()
+	config.SetHostnameLabel(&nodeV1.ObjectMeta)
+	if nodeV1.Status.Allocatable == nil {
+		nodeV1.Status.Allocatable = v1.ResourceList{}
+	}
+	if _, ok := nodeV1.Status.Allocatable[v1.ResourcePods]; !ok {
+		nodeV1.Status.Allocatable[v1.ResourcePods] = *resource.NewQuantity(maxPods, resource.DecimalSI)
+	}
+	if nodeV1.Status.Capacity == nil {
+		nodeV1.Status.Capacity = nodeV1.Status.Allocatable.DeepCopy()
+	}
+
+	return newNode(conf, nodeV1, systemPods, clk)
+}
+
+// newNode creates a node of the v1.Node with the node-level settings of the config, started at the
+// clock with the system pods.
+func newNode(
+	conf *config.Config, nodeV1 *v1.Node, systemPods []*v1.Pod, clk clock.Clock,
+) (*node.Node, error) {
+
+	noise, err := config.BuildUsageNoise(conf.UsageNoise)
+	if err != nil {
+		return nil, err
+	}
+	if noise.Seed == 0 {
+		noise.Seed = conf.Seed
+	}
+	ratios, eviction, err := config.BuildOvercommit(conf.Overcommit)
+	if err != nil {
+		return nil, err
+	}
+	imageSizes, err := config.BuildImageSizes(conf.Images)
+	if err != nil {
+		return nil, err
+	}
+	startup, err := config.BuildStartupLatency(conf.StartupLatency)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeSim := node.NewNode(nodeV1)
+	nodeSim.SetUsageNoise(noise)
+	nodeSim.Overcommit(ratios)
+	nodeSim.SetEvictionPolicy(eviction)
+	nodeSim.SetImageSizes(imageSizes)
+	nodeSim.SetStartupLatency(startup)
+
+	for _, pod := range systemPods {
+		if _, err := nodeSim.AddSystemPod(clk, pod); err != nil {
+			return nil, err
+		}
+	}
+
+	log.L.Debugf("Node %s created: %v", nodeV1.Name, nodeV1)
+	return &nodeSim, nil
 }
 
 // 返回writers
@@ -291,16 +797,171 @@ func buildMetricsWriters(conf *config.Config) ([]metrics.Writer, error) {
 		writers = append(writers, writer)
 	}
 
+	if conf.ResultsDB != "" {
+		writer, err := metrics.NewSQLiteWriter(conf.ResultsDB)
+		if err != nil {
+			return []metrics.Writer{}, err
+		}
+		log.L.Infof("Metrics and events written to %s", conf.ResultsDB)
+		writers = append(writers, writer)
+	}
+
+	if conf.ParquetDir != "" {
+		writer, err := metrics.NewParquetWriter(conf.ParquetDir)
+		if err != nil {
+			return []metrics.Writer{}, err
+		}
+		log.L.Infof("Node metrics and pod outcomes written to %s", conf.ParquetDir)
+		writers = append(writers, writer)
+	}
+
+	if conf.TimelineFile != "" {
+		writer, err := metrics.NewTimelineWriter(conf.TimelineFile)
+		if err != nil {
+			return []metrics.Writer{}, err
+		}
+		log.L.Infof("Timeline written to %s", conf.TimelineFile)
+		writers = append(writers, writer)
+	}
+
+	if conf.SummaryFile != "" {
+		writer, err := metrics.NewSummaryWriter(conf.SummaryFile, conf.SummaryTableFile)
+		if err != nil {
+			return []metrics.Writer{}, err
+		}
+		log.L.Infof("Summary written to %s", conf.SummaryFile)
+		writers = append(writers, writer)
+	} else if conf.SummaryTableFile != "" {
+		return []metrics.Writer{}, strongerrors.InvalidArgument(
+			errors.New("summaryTableFile requires summaryFile"))
+	}
+
+	if conf.EventLogFile != "" {
+		writer, err := metrics.NewEventLogWriter(
+			conf.EventLogFile, config.BuildFileOptions(conf.EventLogCompression, conf.EventLogMaxSize))
+		if err != nil {
+			return []metrics.Writer{}, err
+		}
+		log.L.Infof("Events written to %s", conf.EventLogFile)
+		writers = append(writers, writer)
+	}
+
 	return writers, nil
 }
 
+func buildReservations(conf *config.Config) (*reservation.Store, error) {
+	store := reservation.NewStore()
+	for _, resvConf := range conf.Reservations {
+		resv, err := config.BuildReservation(resvConf)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := store.Add(resv); err != nil {
+			return nil, err
+		}
+
+		log.L.Debugf("Reservation %s created: %v", resv.Name, resv)
+	}
+
+	return store, nil
+}
+
+// buildGenerators adds the submitters of the synthetic workloads in the config, submitted from
+// the clock of the KubeSim.
+// The generators without their own seeds are seeded by the random number generator of the KubeSim,
+// in the order of the config.
+func buildGenerators(k *KubeSim, conf *config.Config) error {
+	generators, err := config.BuildGenerators(conf.Generators)
+	if err != nil {
+		return err
+	}
+
+	for _, gen := range generators {
+		if gen.Seed == 0 {
+			gen.Seed = k.rand.Int63()
+		}
+		pods, err := gen.Generate(k.clock)
+		if err != nil {
+			return err
+		}
+		sub := workload.NewSubmitter(pods)
+		k.AddSubmitter(gen.Name, sub)
+		k.generated = append(k.generated, sub)
+	}
+
+	return nil
+}
+
+// FaultInjectorName is the name of the submitter injecting the faults of the config.
+const FaultInjectorName = "faults"
+
+// buildFaults adds the submitter injecting the faults in the config into the nodes.
+func buildFaults(k *KubeSim, conf *config.Config) error {
+	faults, err := config.BuildFaults(conf.Faults)
+	if err != nil || len(faults) == 0 {
+		return err
+	}
+	injector, err := submitter.NewFaultInjector(faults)
+	if err != nil {
+		return err
+	}
+	k.AddSubmitter(FaultInjectorName, injector)
+
+	return nil
+}
+
+// buildAutoscaler sets the autoscaler in the config, adding the initial nodes of its node groups.
+func buildAutoscaler(k *KubeSim, conf *config.Config) error {
+	maxPods, err := config.BuildMaxPods(conf.MaxPods)
+	if err != nil {
+		return err
+	}
+	a, err := config.BuildAutoscaler(conf.Autoscaler, k.clock.ToRFC3339(), maxPods)
+	if err != nil || a == nil {
+		return err
+	}
+	if _, ok := k.pendingPods.(queue.Lister); !ok {
+		return strongerrors.InvalidArgument(errors.New("autoscaler requires a queue implementing queue.Lister"))
+	}
+
+	k.autoscaler = a
+	return a.Start(k)
+}
+
+// autoscale scales the node groups of the autoscaler by the pods left in the queue by the scheduler,
+// or applies the node changes of the replayed trace instead if replayNodeEvents.
+func (k *KubeSim) autoscale() error {
+	if k.replayNodeEvents {
+		if err := k.replayer.ApplyNodeChanges(k.clock, k); err != nil {
+			return err
+		}
+		if k.autoscaler != nil {
+			k.autoscaler.Observe(k.nodes)
+		}
+		return nil
+	}
+	if k.autoscaler == nil {
+		return nil
+	}
+
+	pending := k.pendingPods.(queue.Lister).List()
+	if k.unschedulable != nil {
+		pending = append(pending, k.unschedulable.List()...)
+	}
+	return k.autoscaler.Autoscale(k.clock, pending, k.nodes, k)
+}
+
 // toTerminate determines whether the main loop of this KubeSim can be terminated,
 // because all submitters are terminated, no pods are running on the cluster, and there are no
-// pending pods in the queue.
+// pending pods in the queue or held for their backoffs.
 func (k *KubeSim) toTerminate(submitterAddedEver bool) bool {
+	if k.unschedulable != nil && k.unschedulable.Len() > 0 {
+		return false
+	}
 	if _, err := k.pendingPods.Front(); err == queue.ErrEmptyQueue { // queue is empty
-		for _, node := range k.nodes { // cluster is empty
-			if node.PodsNum(k.clock) > 0 {
+		for _, node := range k.nodes { // cluster is empty except for system pods
+			if node.WorkloadPodsNum(k.clock) > 0 {
 				return false
 			}
 		}
@@ -313,31 +974,70 @@ func (k *KubeSim) toTerminate(submitterAddedEver bool) bool {
 	return false
 }
 
-func (k *KubeSim) submit(metrics metrics.Metrics) error {
-	for name, subm := range k.submitters {
-		events, err := subm.Submit(k.clock, k, metrics)
+func (k *KubeSim) submit(ctx context.Context, met metrics.Metrics) error {
+	// The submitters are called in the order of their names, so that their pods are queued in the
+	// same order in every run.
+	names := make([]string, 0, len(k.submitters))
+	for name := range k.submitters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	k.quotaUsed = nil
+	for _, name := range names {
+		subm := k.submitters[name]
+		k.source = name
+		events, err := subm.Submit(ctx, k.clock, k, met)
+		k.source = ""
 		if err != nil {
 			return err
 		}
 
+		if k.trace != nil {
+			if err := k.trace.RecordSubmitterEvents(k.clock, name, events); err != nil {
+				return err
+			}
+		}
+		if err := k.writeEvents(k.submitterEventsToMetrics(events)); err != nil {
+			return err
+		}
+
+		rejected := []metrics.Event{}
 		for _, e := range events {
 			if submitted, ok := e.(*submitter.SubmitEvent); ok {
-				pod := submitted.Pod
-				pod.UID = types.UID(pod.Name) // FIXME
-				pod.CreationTimestamp = k.clock.ToMetaV1()
-				pod.Status.Phase = v1.PodPending
+				v1Pod := submitted.Pod
+				v1Pod.UID = types.UID(v1Pod.Name) // FIXME
+				v1Pod.CreationTimestamp = k.clock.ToMetaV1()
+				v1Pod.Status.Phase = v1.PodPending
 
-				log.L.Tracef("Submitter %s: Submit %v", name, pod)
+				log.L.Tracef("Submitter %s: Submit %v", name, v1Pod)
 
 				if l.IsDebugEnabled() {
-					key, err := util.PodKey(pod)
+					key, err := util.PodKey(v1Pod)
 					if err != nil {
 						return err
 					}
 					log.L.Debugf("Submitter %s: Submit %s", name, key)
 				}
 
-				err := k.pendingPods.Push(pod)
+				if k.unschedulable != nil {
+					k.unschedulable.Forget(util.PodKeyFromNames(v1Pod.Namespace, v1Pod.Name))
+				}
+				k.submittedPods++
+				if err := pod.AdmitDeviceResources(v1Pod); err != nil {
+					rejected = append(rejected, *k.rejectPod(v1Pod, pod.InvalidDeviceResourcesReason, err))
+					continue
+				}
+				if err := k.priorityClasses.Admit(v1Pod); err != nil {
+					rejected = append(rejected, *k.rejectPod(v1Pod, pod.PriorityClassNotFoundReason, err))
+					continue
+				}
+				if reject := k.admitToNamespace(v1Pod); reject != nil {
+					rejected = append(rejected, *reject)
+					continue
+				}
+				k.deadlines.Watch(v1Pod, k.routedName(v1Pod))
+				err := k.pendingPods.Push(v1Pod)
 				if err != nil {
 					return err
 				}
@@ -345,22 +1045,48 @@ func (k *KubeSim) submit(metrics metrics.Metrics) error {
 				log.L.Debugf("Submitter %s: Delete %s",
 					name, util.PodKeyFromNames(del.PodNamespace, del.PodName))
 
-				if delFromQ := k.pendingPods.Delete(del.PodNamespace, del.PodName); !delFromQ {
+				if delFromQ := k.pendingPods.Delete(del.PodNamespace, del.PodName); !delFromQ &&
+					!k.deleteUnschedulable(del.PodNamespace, del.PodName) {
 					k.deletePodFromNode(del.PodNamespace, del.PodName)
+				} else {
+					k.forgetPod(del.PodNamespace, del.PodName)
 				}
+				k.releaseQuota(util.PodKeyFromNames(del.PodNamespace, del.PodName))
 			} else if up, ok := e.(*submitter.UpdateEvent); ok {
 				log.L.Tracef("Submitter %s: Update %s to %v",
 					name, util.PodKeyFromNames(up.PodNamespace, up.PodName), up.NewPod)
 				log.L.Debugf("Submitter %s: Update %s",
 					name, util.PodKeyFromNames(up.PodNamespace, up.PodName))
 
-				if err := k.pendingPods.Update(up.PodNamespace, up.PodName, up.NewPod); err != nil {
+				if err := k.priorityClasses.Admit(up.NewPod); err != nil {
+					log.L.Warnf("Error updating pod: %s", err.Error())
+					continue
+				}
+				if err := pod.AdmitDeviceResources(up.NewPod); err != nil {
+					log.L.Warnf("Error updating pod: %s", err.Error())
+					continue
+				}
+				if err := k.namespaces.ApplyLimitRange(up.NewPod); err != nil {
+					// The pod keeps its spec before the update.
+					log.L.Warnf("Error updating pod: %s", err.Error())
+					rejected = append(rejected, *k.rejectPod(up.NewPod, pod.LimitRangeViolatedReason, err))
+					continue
+				}
+				err := k.pendingPods.Update(up.PodNamespace, up.PodName, up.NewPod)
+				if _, ok := err.(*queue.ErrNoMatchingPod); ok && k.unschedulable != nil {
+					err = k.unschedulable.Update(up.PodNamespace, up.PodName, up.NewPod)
+				}
+				if err != nil {
 					if e, ok := err.(*queue.ErrNoMatchingPod); ok {
 						log.L.Warnf("Error updating pod: %s", e.Error())
 					} else {
 						return err
 					}
 				}
+				key := util.PodKeyFromNames(up.PodNamespace, up.PodName)
+				if _, ok := k.quotaWaiting[key]; ok && err == nil {
+					k.chargeQuotaFor(up.NewPod)
+				}
 			} else if _, ok := e.(*submitter.TerminateSubmitterEvent); ok {
 				log.L.Debugf("Submitter %s: Terminate", name)
 				delete(k.submitters, name)
@@ -368,28 +1094,72 @@ func (k *KubeSim) submit(metrics metrics.Metrics) error {
 				log.L.Panic("Unknown submitter event")
 			}
 		}
+		if err := k.writeEvents(rejected); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (k *KubeSim) schedule() error {
-	// Build up-to-date NodeInfo.
-	nodeInfoMap := make(map[string]*nodeinfo.NodeInfo, len(k.nodes))
-	for name, node := range k.nodes {
-		info, err := node.ToNodeInfo(k.clock)
-		if err != nil {
+func (k *KubeSim) schedule(ctx context.Context) error {
+	if err := k.switchScheduler(); err != nil {
+		return err
+	}
+	k.reservations.SetClock(k.clock)
+	if err := k.reactivatePods(); err != nil {
+		return err
+	}
+
+	// The schedulers share the nodes, so each of them sees the pods bound by the previous ones.
+	for _, sq := range k.schedulerQueues() {
+		k.addReservationPredicate(sq.scheduler)
+		if err := k.scheduleWith(ctx, sq.scheduler, sq.queue); err != nil {
 			return err
 		}
-		nodeInfoMap[name] = info
 	}
 
-	// The scheduler makes scheduling decision.
-	events, err := k.scheduler.Schedule(k.clock, k.pendingPods, k, nodeInfoMap)
+	if err := k.writeEvents(k.unschedulableEvents()); err != nil {
+		return err
+	}
+	failed, err := k.backOffPods()
+	if err != nil {
+		return err
+	}
+	return k.writeEvents(failed)
+}
+
+// scheduleWith lets the scheduler schedule the pods in the queue, and binds and deletes the pods by
+// its decisions.
+func (k *KubeSim) scheduleWith(ctx context.Context, sched scheduler.Scheduler, podQueue queue.PodQueue) error {
+	nodeInfoMap, err := k.updateNodeInfoSnapshot()
 	if err != nil {
 		return err
 	}
 
+	if observer, ok := podQueue.(queue.AllocationObserver); ok {
+		observeAllocation(observer, nodeInfoMap)
+	}
+
+	// The scheduler makes scheduling decision, for at most podsPerTick pods if limited.
+	pendingPods := podQueue
+	if k.podsPerTick > 0 {
+		pendingPods = queue.NewThrottledQueue(podQueue, k.podsPerTick)
+	}
+	events, err := sched.Schedule(ctx, k.clock, pendingPods, k, nodeInfoMap)
+	if err != nil {
+		return err
+	}
+
+	if k.trace != nil {
+		if err := k.trace.RecordSchedulerEvents(k.clock, events); err != nil {
+			return err
+		}
+	}
+	if err := k.writeEvents(k.schedulerEventsToMetrics(events)); err != nil {
+		return err
+	}
+
 	// Do the actual scheduling process for each event.
 	for _, e := range events {
 		if bind, ok := e.(*scheduler.BindEvent); ok {
@@ -410,8 +1180,17 @@ func (k *KubeSim) schedule() error {
 				return err
 			}
 			k.boundPods[key] = pod
+			k.releaseQuota(key)
+			if k.unschedulable != nil {
+				k.unschedulable.Forget(key)
+			}
 		} else if del, ok := e.(*scheduler.DeleteEvent); ok {
 			k.deletePodFromNode(del.PodNamespace, del.PodName)
+			if k.requeuePreempted {
+				if err := k.requeuePod(del.PodNamespace, del.PodName); err != nil {
+					return err
+				}
+			}
 		} else {
 			log.L.Panic("Unknown scheduler event")
 		}
@@ -420,6 +1199,223 @@ func (k *KubeSim) schedule() error {
 	return nil
 }
 
+// updateNodeInfoSnapshot updates the snapshot of the NodeInfo of the nodes to the current clock,
+// copying the cached NodeInfo of a node only if it has changed since the last snapshot, or the
+// scheduler has modified its copy (e.g., by assuming pods on it), as the scheduler cache of
+// kube-scheduler does.
+// Returns the snapshot, which the scheduler may modify.
+func (k *KubeSim) updateNodeInfoSnapshot() (map[string]*nodeinfo.NodeInfo, error) {
+	if k.nodeInfoSnapshot == nil {
+		k.nodeInfoSnapshot = make(map[string]*nodeinfo.NodeInfo, len(k.nodes))
+	}
+
+	for name, n := range k.nodes {
+		info, err := n.NodeInfo(k.clock)
+		if err != nil {
+			return nil, err
+		}
+		if snapshot, ok := k.nodeInfoSnapshot[name]; !ok || snapshot.GetGeneration() != info.GetGeneration() {
+			k.nodeInfoSnapshot[name] = info.Clone()
+		}
+	}
+	for name := range k.nodeInfoSnapshot {
+		if _, ok := k.nodes[name]; !ok {
+			delete(k.nodeInfoSnapshot, name)
+		}
+	}
+	node.SetImageStates(k.nodeInfoSnapshot)
+
+	return k.nodeInfoSnapshot, nil
+}
+
+// observeAllocation lets the queue observe the allocatable resources of the nodes and the pods
+// running on them.
+func observeAllocation(observer queue.AllocationObserver, nodeInfoMap map[string]*nodeinfo.NodeInfo) {
+	capacity := v1.ResourceList{}
+	pods := []*v1.Pod{}
+	for _, info := range nodeInfoMap {
+		capacity = util.ResourceListSum(capacity, info.Node().Status.Allocatable)
+		pods = append(pods, info.Pods()...)
+	}
+
+	observer.ObserveAllocation(capacity, pods)
+}
+
+// unschedulableEvents returns the events of the pods in the queue that the scheduler failed to
+// schedule for the first time since they were queued, i.e., whose PodScheduled condition turned
+// false at the current clock.
+func (k *KubeSim) unschedulableEvents() []metrics.Event {
+	lister, ok := k.pendingPods.(queue.Lister)
+	if !ok {
+		return nil
+	}
+
+	events := []metrics.Event{}
+	now := k.clock.ToMetaV1()
+	for _, pod := range lister.List() {
+		_, cond := podutil.GetPodCondition(&pod.Status, v1.PodScheduled)
+		if cond == nil || cond.Status != v1.ConditionFalse || !cond.LastTransitionTime.Equal(&now) {
+			continue
+		}
+		events = append(events, metrics.Event{
+			Clock: k.clock.ToRFC3339(),
+			Kind:  metrics.UnschedulableEvent,
+			Pod:   util.PodKeyFromNames(pod.Namespace, pod.Name),
+		})
+	}
+
+	return events
+}
+
+// evictPods kills the pods using more memory than their limits (see node.Node.OOMKillPods), evicts
+// the pods not tolerating the NoExecute taints of their nodes, which are pushed back to the queue as
+// their controllers would recreate them (see node.Node.EvictIntolerantPods), and the pods on the
+// nodes under memory pressure by their actual usage (see node.Node.EvictPods).
+// The pods killed at the clock in the replayed trace are killed first if replayNodeEvents.
+func (k *KubeSim) evictPods() error {
+	events := []metrics.Event{}
+	if k.replayNodeEvents {
+		for _, kill := range k.replayer.Kills(k.clock) {
+			if err := k.replayKill(kill, &events); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, name := range k.nodeNames() {
+		for _, pod := range k.nodes[name].OOMKillPods(k.clock) {
+			if err := k.killed(trace.OOMKill, pod, name, &events); err != nil {
+				return err
+			}
+		}
+		for _, pod := range k.nodes[name].EvictIntolerantPods(k.clock) {
+			if err := k.killed(trace.TaintEvict, pod, name, &events); err != nil {
+				return err
+			}
+		}
+		for _, pod := range k.nodes[name].EvictPods(k.clock) {
+			if err := k.killed(trace.PressureEvict, pod, name, &events); err != nil {
+				return err
+			}
+		}
+	}
+
+	return k.writeEvents(events)
+}
+
+// replayKill kills the pod killed by its node in the replayed trace, appending its event to events.
+// The kill is skipped with a warning if the pod is not running on the node, i.e., the replay has
+// diverged.
+func (k *KubeSim) replayKill(kill trace.Entry, events *[]metrics.Event) error {
+	key := util.PodKeyFromNames(kill.PodNamespace, kill.PodName)
+	nodeSim, ok := k.nodes[kill.NodeName]
+	if !ok {
+		log.L.Warnf("Replay diverged: no node %s of pod %s to kill at %s", kill.NodeName, key, k.clock.ToRFC3339())
+		return nil
+	}
+
+	var killed *pod.Pod
+	switch kill.Kind {
+	case trace.OOMKill:
+		killed = nodeSim.OOMKillPod(k.clock, kill.PodNamespace, kill.PodName)
+	case trace.TaintEvict:
+		killed = nodeSim.EvictIntolerantPod(k.clock, kill.PodNamespace, kill.PodName)
+	default: // trace.PressureEvict
+		killed = nodeSim.EvictPod(k.clock, kill.PodNamespace, kill.PodName)
+	}
+	if killed == nil {
+		log.L.Warnf("Replay diverged: pod %s to kill is not running on node %s at %s",
+			key, kill.NodeName, k.clock.ToRFC3339())
+		return nil
+	}
+
+	return k.killed(kill.Kind, killed, kill.NodeName, events)
+}
+
+// killEventKinds maps the kind of each trace entry of a pod killed by its node to its event kind.
+var killEventKinds = map[trace.Kind]metrics.EventKind{
+	trace.OOMKill:       metrics.OOMKillEvent,
+	trace.TaintEvict:    metrics.TaintEvictEvent,
+	trace.PressureEvict: metrics.PressureEvictEvent,
+}
+
+// killed records the pod killed by the node in the trace, appending its event to events, and pushes
+// it back to the queue if evicted by the NoExecute taints of the node.
+func (k *KubeSim) killed(kind trace.Kind, killed *pod.Pod, nodeName string, events *[]metrics.Event) error {
+	namespace, name := killed.ToV1().Namespace, killed.ToV1().Name
+	if err := k.recordNodeEvent(trace.Entry{
+		Kind: kind, PodNamespace: namespace, PodName: name, NodeName: nodeName,
+	}); err != nil {
+		return err
+	}
+
+	*events = append(*events, metrics.Event{
+		Clock: k.clock.ToRFC3339(),
+		Kind:  killEventKinds[kind],
+		Pod:   util.PodKeyFromNames(namespace, name),
+		Node:  nodeName,
+	})
+
+	if kind == trace.TaintEvict {
+		return k.requeuePod(namespace, name)
+	}
+	return nil
+}
+
+// recordNodeEvent records the node change or the pod killed by its node in the trace, if recorded,
+// with the submitter being called as its source.
+func (k *KubeSim) recordNodeEvent(entry trace.Entry) error {
+	if k.trace == nil {
+		return nil
+	}
+	return k.trace.RecordNodeEvent(k.clock, k.source, entry)
+}
+
+// recordCompletedPods writes the events of the pods that finished their execution since the last
+// tick (see node.Node.CompletedPods).
+func (k *KubeSim) recordCompletedPods() error {
+	events := []metrics.Event{}
+	for _, name := range k.nodeNames() {
+		for _, pod := range k.nodes[name].CompletedPods(k.prevClock, k.clock) {
+			events = append(events, metrics.Event{
+				Clock: k.clock.ToRFC3339(),
+				Kind:  metrics.CompleteEvent,
+				Pod:   util.PodKeyFromNames(pod.ToV1().Namespace, pod.ToV1().Name),
+				Node:  name,
+			})
+		}
+	}
+
+	return k.writeEvents(events)
+}
+
+// buildMetrics builds a metrics of the cluster at the current clock, including the metrics of the
+// scheduler if it implements scheduler.MetricsReporter, and the deadline metrics of finished pods.
+func (k *KubeSim) buildMetrics() (metrics.Metrics, error) {
+	met, err := metrics.BuildMetrics(k.clock, k.nodes, k.pendingPods)
+	if err != nil {
+		return metrics.Metrics{}, err
+	}
+
+	if reporter, ok := k.scheduler.(scheduler.MetricsReporter); ok {
+		met[metrics.SchedulerMetricsKey] = reporter.Metrics()
+	}
+	met[metrics.DeadlineMetricsKey] = k.deadlines.Observe(k.clock, k.nodes, k.ActiveSchedulerName())
+	met[metrics.BalanceMetricsKey] = metrics.BuildBalanceMetrics(
+		met[metrics.NodesMetricsKey].(map[string]node.Metrics), k.saturationThreshold)
+	if name, ok := k.switcher.activeName(); ok {
+		met[metrics.ActiveSchedulerKey] = name
+	}
+	if k.autoscaler != nil {
+		met[metrics.AutoscalerMetricsKey] = k.autoscaler.Metrics()
+	}
+	if k.unschedulable != nil {
+		met[metrics.BackoffMetricsKey] = k.unschedulable.Metrics()
+	}
+
+	return met, nil
+}
+
 func (k *KubeSim) writeMetrics(met *metrics.Metrics) error {
 	for _, writer := range k.metricsWriters {
 		if err := writer.Write(met); err != nil {
@@ -430,18 +1426,158 @@ func (k *KubeSim) writeMetrics(met *metrics.Metrics) error {
 	return nil
 }
 
+// writeEvents writes the events to the metrics writers that implement metrics.EventWriter, then
+// invokes the event handlers with them.
+func (k *KubeSim) writeEvents(events []metrics.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	k.observeClusterChange(events)
+
+	for _, writer := range k.metricsWriters {
+		if ew, ok := writer.(metrics.EventWriter); ok {
+			if err := ew.WriteEvents(events); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, e := range events {
+		for _, handler := range k.eventHandlers {
+			if err := handler(e); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (k *KubeSim) submitterEventsToMetrics(events []submitter.Event) []metrics.Event {
+	met := make([]metrics.Event, 0, len(events))
+	clk := k.clock.ToRFC3339()
+
+	for _, e := range events {
+		switch ev := e.(type) {
+		case *submitter.SubmitEvent:
+			met = append(met, metrics.Event{
+				Clock: clk,
+				Kind:  metrics.SubmitEvent,
+				Pod:   util.PodKeyFromNames(ev.Pod.Namespace, ev.Pod.Name),
+			})
+		case *submitter.DeleteEvent:
+			key := util.PodKeyFromNames(ev.PodNamespace, ev.PodName)
+			nodeName := ""
+			if pod, ok := k.boundPods[key]; ok {
+				nodeName = pod.ToV1().Spec.NodeName
+			}
+			met = append(met, metrics.Event{Clock: clk, Kind: metrics.DeleteEvent, Pod: key, Node: nodeName})
+		case *submitter.UpdateEvent:
+			met = append(met, metrics.Event{
+				Clock: clk,
+				Kind:  metrics.UpdateEvent,
+				Pod:   util.PodKeyFromNames(ev.PodNamespace, ev.PodName),
+			})
+		}
+	}
+
+	return met
+}
+
+func (k *KubeSim) schedulerEventsToMetrics(events []scheduler.Event) []metrics.Event {
+	met := make([]metrics.Event, 0, len(events))
+	clk := k.clock.ToRFC3339()
+
+	for _, e := range events {
+		switch ev := e.(type) {
+		case *scheduler.BindEvent:
+			met = append(met, metrics.Event{
+				Clock: clk,
+				Kind:  metrics.BindEvent,
+				Pod:   util.PodKeyFromNames(ev.Pod.Namespace, ev.Pod.Name),
+				Node:  ev.ScheduleResult.SuggestedHost,
+			})
+		case *scheduler.DeleteEvent:
+			met = append(met, metrics.Event{
+				Clock: clk,
+				Kind:  metrics.EvictEvent,
+				Pod:   util.PodKeyFromNames(ev.PodNamespace, ev.PodName),
+				Node:  ev.NodeName,
+			})
+		}
+	}
+
+	return met
+}
+
+// closeMetricsWriters closes the metrics writers that implement io.Closer.
+func (k *KubeSim) closeMetricsWriters() {
+	for _, writer := range k.metricsWriters {
+		if closer, ok := writer.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.L.Errorf("Error closing metrics writer: %s", err.Error())
+			}
+		}
+	}
+}
+
 func (k *KubeSim) gcTerminatedPodsInNodes() {
-	for _, node := range k.nodes {
-		node.GCTerminatedPods(k.clock)
+	for _, name := range k.nodeNames() {
+		k.deadlines.Record(k.clock, k.nodes[name].GCTerminatedPods(k.clock), k.ActiveSchedulerName())
+	}
+}
+
+// requeuePod pushes a pending copy of the bound pod back to the queue.
+func (k *KubeSim) requeuePod(podNamespace, podName string) error {
+	key := util.PodKeyFromNames(podNamespace, podName)
+	bound, ok := k.boundPods[key]
+	if !ok {
+		return nil
+	}
+
+	pod := bound.ToV1().DeepCopy()
+	pod.Spec.NodeName = ""
+	pod.Status = v1.PodStatus{Phase: v1.PodPending}
+	log.L.Debugf("Pod %s pushed back to the queue", key)
+	k.chargeQuotaFor(pod)
+
+	return k.pendingPods.Push(pod)
+}
+
+// forgetPod lets the schedulers implementing scheduler.Forgetter forget the pod deleted before
+// bound.
+func (k *KubeSim) forgetPod(podNamespace, podName string) {
+	k.switcher.mu.Lock()
+	scheds := make([]scheduler.Scheduler, 0, len(k.switcher.schedulers)+len(k.routed))
+	for _, sched := range k.switcher.schedulers {
+		scheds = append(scheds, sched)
+	}
+	k.switcher.mu.Unlock()
+	for _, sched := range k.routed {
+		scheds = append(scheds, sched)
+	}
+
+	for _, sched := range scheds {
+		if forgetter, ok := sched.(scheduler.Forgetter); ok {
+			forgetter.Forget(podNamespace, podName)
+		}
 	}
 }
 
 func (k *KubeSim) deletePodFromNode(podNamespace, podName string) {
 	key := util.PodKeyFromNames(podNamespace, podName)
+	if _, ok := k.boundPods[key]; !ok { // e.g., garbage-collected before a checkpoint
+		log.L.Warnf("No bound pod %s to delete", key)
+		return
+	}
 	k.boundPods[key].Delete(k.clock)
 
 	nodeName := k.boundPods[key].ToV1().Spec.NodeName
-	deletedFromNode := k.nodes[nodeName].DeletePod(k.clock, podNamespace, podName) // nolint
+	node, ok := k.nodes[nodeName]
+	if !ok { // deleted by DeleteNode
+		return
+	}
+	deletedFromNode := node.DeletePod(k.clock, podNamespace, podName) // nolint
 
 	if !deletedFromNode { // nolint
 		//
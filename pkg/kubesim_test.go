@@ -0,0 +1,508 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubesim
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/config"
+	"simulator/pkg/logfile"
+	"simulator/pkg/metrics"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
+	"simulator/pkg/submitter"
+	"simulator/pkg/trace"
+)
+
+func TestKubeSimPodsPerTick(t *testing.T) {
+	conf := newCheckpointConfig(10)
+	conf.PodsPerTick = 1
+	binPacking := scheduler.NewBinPackingScheduler()
+	writer := &recordingWriter{}
+
+	k, err := NewKubeSim(WithConfig(conf), WithScheduler(&binPacking), WithMetricsWriter(writer))
+	assert.NoError(t, err)
+	t0 := k.clock
+
+	k.AddSubmitter("OneShot", &oneShotSubmitter{pods: []*v1.Pod{
+		newCheckpointPod("pod-0"), newCheckpointPod("pod-1"),
+	}})
+	assert.NoError(t, k.Run(context.Background()))
+
+	// One pod is scheduled at each tick.
+	assert.NotEmpty(t, writer.metrics)
+	podsMet := writer.metrics[0][metrics.PodsMetricsKey].(map[string]pod.Metrics)
+	boundAt := []clock.Clock{podsMet["default/pod-0"].BoundAt, podsMet["default/pod-1"].BoundAt}
+	assert.ElementsMatch(t, []clock.Clock{t0, t0.Add(10 * time.Second)}, boundAt)
+
+	conf.PodsPerTick = -1
+	_, err = NewKubeSim(WithConfig(conf), WithScheduler(&binPacking))
+	assert.EqualError(t, err, "invalid podsPerTick -1")
+}
+
+// chainSubmitter submits the next pod after the previous one has succeeded, then terminates.
+type chainSubmitter struct {
+	pods      []*v1.Pod
+	submitted int
+	phases    []v1.PodPhase
+}
+
+func (s *chainSubmitter) Submit(
+	_ context.Context, _ clock.Clock, nodeLister algorithm.NodeLister, _ metrics.Metrics,
+) ([]submitter.Event, error) {
+
+	pods, err := nodeLister.(submitter.PodLister).ListPods(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	if len(pods) > 0 {
+		s.phases = append(s.phases, pods[len(pods)-1].Status.Phase)
+	}
+
+	if len(pods) == s.submitted && (len(pods) == 0 || pods[len(pods)-1].Status.Phase == v1.PodSucceeded) {
+		if s.submitted == len(s.pods) {
+			return []submitter.Event{&submitter.TerminateSubmitterEvent{}}, nil
+		}
+		s.submitted++
+		return []submitter.Event{&submitter.SubmitEvent{Pod: s.pods[s.submitted-1]}}, nil
+	}
+
+	return []submitter.Event{}, nil
+}
+
+func TestKubeSimListPods(t *testing.T) {
+	binPacking := scheduler.NewBinPackingScheduler()
+	k, err := NewKubeSim(WithConfig(newCheckpointConfig(10)), WithScheduler(&binPacking))
+	assert.NoError(t, err)
+	t0 := k.clock
+
+	pod0, pod1 := newCheckpointPod("pod-0"), newCheckpointPod("pod-1")
+	pod1.Labels = map[string]string{"app": "web"}
+	subm := &chainSubmitter{pods: []*v1.Pod{pod0, pod1}}
+	k.AddSubmitter("Chain", subm)
+	assert.NoError(t, k.Run(context.Background()))
+
+	assert.Contains(t, subm.phases, v1.PodRunning)
+	assert.Equal(t, v1.PodSucceeded, subm.phases[len(subm.phases)-1])
+
+	pods, err := k.ListPods(labels.Everything())
+	assert.NoError(t, err)
+	assert.Len(t, pods, 2)
+	assert.Equal(t, "pod-0", pods[0].Name)
+	assert.Equal(t, v1.PodSucceeded, pods[0].Status.Phase)
+	// pod-1 is submitted and bound once pod-0 has run for 60 seconds.
+	assert.Equal(t, t0.Add(60*time.Second).ToMetaV1(), *pods[1].Status.StartTime)
+
+	pods, err = k.ListPods(labels.SelectorFromSet(labels.Set{"app": "web"}))
+	assert.NoError(t, err)
+	assert.Len(t, pods, 1)
+	assert.Equal(t, "pod-1", pods[0].Name)
+
+	nodes, _ := k.List()
+	info, err := k.nodes[nodes[0].Name].ToNodeInfo(k.clock)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), info.RequestedResource().MilliCPU, "the resources are not released")
+}
+
+// stagedSubmitter submits the pods of each stage at each call, then terminates.
+type stagedSubmitter struct {
+	stages [][]*v1.Pod
+}
+
+func (s *stagedSubmitter) Submit(
+	_ context.Context, _ clock.Clock, _ algorithm.NodeLister, _ metrics.Metrics,
+) ([]submitter.Event, error) {
+
+	if len(s.stages) == 0 {
+		return []submitter.Event{&submitter.TerminateSubmitterEvent{}}, nil
+	}
+
+	events := []submitter.Event{}
+	for _, p := range s.stages[0] {
+		events = append(events, &submitter.SubmitEvent{Pod: p})
+	}
+	s.stages = s.stages[1:]
+	return events, nil
+}
+
+func TestKubeSimRequeuePreemptedPods(t *testing.T) {
+	for _, requeue := range []bool{false, true} {
+		conf := newCheckpointConfig(10)
+		conf.RequeuePreemptedPods = requeue
+		sched := scheduler.NewGenericScheduler(true)
+		sched.AddPredicate(predicates.PodFitsResourcesPred, predicates.PodFitsResources)
+
+		k, err := NewKubeSim(WithConfig(conf), WithScheduler(&sched))
+		assert.NoError(t, err)
+		t0 := k.clock
+
+		// The high-priority pod preempts one of the low-priority pods filling the node.
+		high := newCheckpointPod("high")
+		priority := int32(100)
+		high.Spec.Priority = &priority
+		k.AddSubmitter("Staged", &stagedSubmitter{stages: [][]*v1.Pod{
+			{newCheckpointPod("low-0"), newCheckpointPod("low-1")},
+			{high},
+		}})
+		assert.NoError(t, k.Run(context.Background()))
+
+		pods, err := k.ListPods(labels.Everything())
+		assert.NoError(t, err)
+		rebound := 0
+		for _, p := range pods {
+			if p.Name != "high" && p.Status.StartTime.After(t0.ToMetaV1().Time) {
+				rebound++
+			}
+		}
+		if requeue {
+			assert.Equal(t, 1, rebound, "the preempted pod is not bound again")
+		} else {
+			assert.Equal(t, 0, rebound)
+			assert.Len(t, pods, 2)
+		}
+	}
+}
+
+func TestKubeSimEventHandler(t *testing.T) {
+	binPacking := scheduler.NewBinPackingScheduler()
+	k, err := NewKubeSim(WithConfig(newCheckpointConfig(10)), WithScheduler(&binPacking),
+		WithQueue(queue.NewFIFOQueue()))
+	assert.NoError(t, err)
+	t0 := k.clock
+
+	events := []metrics.Event{}
+	k.AddEventHandler(func(e metrics.Event) error {
+		events = append(events, e)
+		return nil
+	})
+	// pod-2 waits for pod-0 and pod-1 to complete.
+	k.AddSubmitter("Staged", &stagedSubmitter{stages: [][]*v1.Pod{
+		{newCheckpointPod("pod-0"), newCheckpointPod("pod-1"), newCheckpointPod("pod-2")},
+	}})
+	assert.NoError(t, k.Run(context.Background()))
+
+	str := func(d time.Duration) string { return t0.Add(d).ToRFC3339() }
+	assert.Equal(t, []metrics.Event{
+		{Clock: str(0), Kind: metrics.SubmitEvent, Pod: "default/pod-0"},
+		{Clock: str(0), Kind: metrics.SubmitEvent, Pod: "default/pod-1"},
+		{Clock: str(0), Kind: metrics.SubmitEvent, Pod: "default/pod-2"},
+		{Clock: str(0), Kind: metrics.BindEvent, Pod: "default/pod-0", Node: "node-0"},
+		{Clock: str(0), Kind: metrics.BindEvent, Pod: "default/pod-1", Node: "node-0"},
+		{Clock: str(0), Kind: metrics.UnschedulableEvent, Pod: "default/pod-2"},
+		{Clock: str(60 * time.Second), Kind: metrics.BindEvent, Pod: "default/pod-2", Node: "node-0"},
+		{Clock: str(60 * time.Second), Kind: metrics.CompleteEvent, Pod: "default/pod-0", Node: "node-0"},
+		{Clock: str(60 * time.Second), Kind: metrics.CompleteEvent, Pod: "default/pod-1", Node: "node-0"},
+		{Clock: str(120 * time.Second), Kind: metrics.CompleteEvent, Pod: "default/pod-2", Node: "node-0"},
+	}, events)
+
+	// An error of the handler stops the simulation.
+	k, err = NewKubeSim(WithConfig(newCheckpointConfig(10)), WithScheduler(&binPacking))
+	assert.NoError(t, err)
+	k.AddEventHandler(func(e metrics.Event) error { return fmt.Errorf("stop at %s", e.Kind) })
+	k.AddSubmitter("Staged", &stagedSubmitter{stages: [][]*v1.Pod{{newCheckpointPod("pod-0")}}})
+	assert.EqualError(t, k.Run(context.Background()), "stop at Submit")
+}
+
+func TestKubeSimEventLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "events")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The event log is compressed and rotated as configured.
+	conf := newCheckpointConfig(10)
+	conf.EventLogFile = filepath.Join(dir, "events.jsonl.gz")
+	conf.EventLogCompression = "gzip"
+	conf.EventLogMaxSize = 1
+	binPacking := scheduler.NewBinPackingScheduler()
+	k, err := NewKubeSim(WithConfig(conf), WithScheduler(&binPacking))
+	assert.NoError(t, err)
+	k.AddSubmitter("Staged", &stagedSubmitter{stages: [][]*v1.Pod{{newCheckpointPod("pod-0")}}})
+	assert.NoError(t, k.Run(context.Background()))
+
+	_, err = os.Stat(filepath.Join(dir, "events.jsonl.0000.gz"))
+	assert.NoError(t, err)
+	file, err := logfile.Open(conf.EventLogFile)
+	assert.NoError(t, err)
+	defer file.Close()
+	lines, err := ioutil.ReadAll(file)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(string(lines), "\n"))
+}
+
+func TestKubeSimSpeedFactor(t *testing.T) {
+	conf := newCheckpointConfig(10)
+	conf.ClockMode = config.RealTimeClockMode
+	conf.SpeedFactor = 600
+	binPacking := scheduler.NewBinPackingScheduler()
+	k, err := NewKubeSim(WithConfig(conf), WithScheduler(&binPacking))
+	assert.NoError(t, err)
+	t0 := k.clock
+
+	k.AddSubmitter("Staged", &stagedSubmitter{stages: [][]*v1.Pod{{newCheckpointPod("pod-0")}}})
+	start := time.Now()
+	assert.NoError(t, k.Run(context.Background()))
+
+	// The simulated time passes 600 times faster than the wall clock.
+	elapsed := time.Since(start)
+	simulated := k.clock.Sub(t0)
+	assert.True(t, elapsed >= simulated/600-10*time.Millisecond, "%s elapsed for %s", elapsed, simulated)
+	assert.True(t, elapsed < simulated/60, "%s elapsed for %s", elapsed, simulated)
+
+	assert.EqualError(t, k.SetSpeedFactor(0), "invalid speed factor 0")
+}
+
+func TestKubeSimSeed(t *testing.T) {
+	run := func(seed int64) []string {
+		conf := newCheckpointConfig(10)
+		conf.Seed = seed
+		for i := 1; i < 4; i++ {
+			node := conf.Cluster[0]
+			node.Metadata.Name = fmt.Sprintf("node-%d", i)
+			conf.Cluster = append(conf.Cluster, node)
+		}
+		conf.UsageNoise = &config.UsageNoiseConfig{Model: "uniform", Amplitude: 0.2}
+		conf.Generators = []config.GeneratorConfig{{
+			Name:     "batch",
+			Count:    20,
+			Arrival:  "poisson",
+			Rate:     0.2,
+			CPU:      config.DistributionConfig{Distribution: "uniform", Min: "100m", Max: "1"},
+			Memory:   config.DistributionConfig{Value: "100Mi"},
+			Duration: config.DistributionConfig{Distribution: "exponential", Mean: "60", Max: "300"},
+		}}
+
+		// The generic scheduler with no prioritizers breaks the ties between all the nodes.
+		generic := scheduler.NewGenericScheduler(false)
+		writer := &recordingWriter{}
+		k, err := NewKubeSim(WithConfig(conf), WithScheduler(&generic), WithMetricsWriter(writer))
+		assert.NoError(t, err)
+		assert.NoError(t, k.Run(context.Background()))
+
+		formatter := metrics.JSONFormatter{}
+		lines := make([]string, 0, len(writer.metrics))
+		for i := range writer.metrics {
+			line, err := formatter.Format(&writer.metrics[i])
+			assert.NoError(t, err)
+			lines = append(lines, line)
+		}
+		return lines
+	}
+
+	lines := run(1)
+	assert.NotEmpty(t, lines)
+	assert.Equal(t, lines, run(1))
+	assert.NotEqual(t, lines, run(2))
+}
+
+func TestKubeSimExtendedResources(t *testing.T) {
+	conf := newCheckpointConfig(10)
+	gpuNode := conf.Cluster[0]
+	gpuNode.Metadata.Name = "node-1"
+	gpuNode.Status.Allocatable = map[v1.ResourceName]string{
+		"cpu": "2", "memory": "4Gi", "pods": "10", "nvidia.com/gpu": "1",
+	}
+	conf.Cluster = append(conf.Cluster, gpuNode)
+	sched := scheduler.NewGenericScheduler(true)
+	sched.AddPredicate(predicates.PodFitsResourcesPred, predicates.PodFitsResources)
+
+	k, err := NewKubeSim(WithConfig(conf), WithScheduler(&sched))
+	assert.NoError(t, err)
+	t0 := k.clock
+
+	// A GPU pod with only the limit requests the GPU, so the second one waits for the first.
+	gpuPods := []*v1.Pod{newCheckpointPod("gpu-0"), newCheckpointPod("gpu-1")}
+	for _, p := range gpuPods {
+		p.Spec.Containers[0].Resources.Limits = v1.ResourceList{"nvidia.com/gpu": resource.MustParse("1")}
+	}
+	k.AddSubmitter("Staged", &stagedSubmitter{stages: [][]*v1.Pod{gpuPods}})
+	assert.NoError(t, k.Run(context.Background()))
+
+	pods, err := k.ListPods(labels.Everything())
+	assert.NoError(t, err)
+	assert.Len(t, pods, 2)
+	startTimes := []time.Time{}
+	for _, p := range pods {
+		assert.Equal(t, "node-1", p.Spec.NodeName)
+		startTimes = append(startTimes, p.Status.StartTime.Time)
+	}
+	assert.ElementsMatch(t, []time.Time{t0.ToMetaV1().Time, t0.Add(60 * time.Second).ToMetaV1().Time}, startTimes)
+
+	// A pod of a non-integer GPU request is rejected, and such an update is ignored.
+	k, err = NewKubeSim(WithConfig(conf), WithScheduler(&sched))
+	assert.NoError(t, err)
+	rejected := []string{}
+	k.AddEventHandler(func(e metrics.Event) error {
+		if e.Kind == metrics.RejectEvent {
+			rejected = append(rejected, e.Pod)
+		}
+		return nil
+	})
+	half := newCheckpointPod("gpu-half")
+	half.Spec.Containers[0].Resources.Requests["nvidia.com/gpu"] = resource.MustParse("500m")
+	whole := newCheckpointPod("gpu-whole")
+	whole.Spec.Containers[0].Resources.Limits = v1.ResourceList{"nvidia.com/gpu": resource.MustParse("1")}
+	update := whole.DeepCopy()
+	update.Spec.Containers[0].Resources.Limits["nvidia.com/gpu"] = resource.MustParse("500m")
+	k.AddSubmitter("Step", &stepSubmitter{steps: []func() []submitter.Event{func() []submitter.Event {
+		return []submitter.Event{
+			&submitter.SubmitEvent{Pod: half},
+			&submitter.SubmitEvent{Pod: whole},
+			&submitter.UpdateEvent{PodNamespace: "default", PodName: "gpu-whole", NewPod: update},
+		}
+	}}})
+	assert.NoError(t, k.Run(context.Background()))
+
+	assert.Equal(t, []string{"default/gpu-half"}, rejected)
+	assert.Equal(t, v1.PodFailed, half.Status.Phase)
+	assert.Equal(t, pod.InvalidDeviceResourcesReason, half.Status.Reason)
+	pods, err = k.ListPods(labels.Everything())
+	assert.NoError(t, err)
+	assert.Len(t, pods, 1)
+	assert.Equal(t, v1.PodSucceeded, pods[0].Status.Phase)
+	gpu := pods[0].Spec.Containers[0].Resources.Requests["nvidia.com/gpu"]
+	assert.Equal(t, "1", gpu.String())
+}
+
+func TestKubeSimReservations(t *testing.T) {
+	conf := newCheckpointConfig(10)
+	conf.Reservations = []config.ReservationConfig{{
+		Name:     "maintenance",
+		NodeName: "node-0",
+		Resource: map[v1.ResourceName]string{"cpu": "2"},
+		Start:    "2019-01-01T00:00:30Z",
+		End:      "2019-01-01T00:01:30Z",
+	}}
+	binPacking := scheduler.NewBinPackingScheduler()
+	k, err := NewKubeSim(WithConfig(conf), WithScheduler(&binPacking))
+	assert.NoError(t, err)
+	t0 := k.clock
+
+	// The predicate is registered without the user, and the pod running into the reservation waits
+	// until it ends.
+	k.AddSubmitter("OneShot", &oneShotSubmitter{pods: []*v1.Pod{newCheckpointPod("pod-0")}})
+	assert.NoError(t, k.Run(context.Background()))
+
+	pods, err := k.ListPods(labels.Everything())
+	assert.NoError(t, err)
+	assert.Len(t, pods, 1)
+	assert.Equal(t, v1.PodSucceeded, pods[0].Status.Phase)
+	assert.Equal(t, t0.Add(90*time.Second).ToMetaV1().Time, pods[0].Status.StartTime.Time)
+}
+
+func TestKubeSimNodeInfoSnapshot(t *testing.T) {
+	conf := newCheckpointConfig(10)
+	node1 := conf.Cluster[0]
+	node1.Metadata.Name = "node-1"
+	conf.Cluster = append(conf.Cluster, node1)
+	binPacking := scheduler.NewBinPackingScheduler()
+	k, err := NewKubeSim(WithConfig(conf), WithScheduler(&binPacking))
+	assert.NoError(t, err)
+
+	snapshot, err := k.updateNodeInfoSnapshot()
+	assert.NoError(t, err)
+	info0, info1 := snapshot["node-0"], snapshot["node-1"]
+
+	// The copies of the unchanged nodes are reused, while the modified one is copied again.
+	info0.AddPod(newCheckpointPod("assumed"))
+	k.clock = k.clock.Add(10 * time.Second)
+	snapshot, err = k.updateNodeInfoSnapshot()
+	assert.NoError(t, err)
+	assert.True(t, info1 == snapshot["node-1"])
+	assert.False(t, info0 == snapshot["node-0"])
+	assert.Len(t, snapshot["node-0"].Pods(), 0)
+
+	// So is the node a pod is bound to.
+	_, err = k.nodes["node-1"].BindPod(k.clock, newCheckpointPod("pod-0"))
+	assert.NoError(t, err)
+	snapshot, err = k.updateNodeInfoSnapshot()
+	assert.NoError(t, err)
+	assert.False(t, info1 == snapshot["node-1"])
+	assert.Len(t, snapshot["node-1"].Pods(), 1)
+
+	assert.NoError(t, k.DeleteNode("node-0"))
+	snapshot, err = k.updateNodeInfoSnapshot()
+	assert.NoError(t, err)
+	assert.Len(t, snapshot, 1)
+}
+
+func TestKubeSimReplayGenerators(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	conf := newCheckpointConfig(10)
+	conf.TraceFile = filepath.Join(dir, "trace.jsonl")
+	conf.Generators = []config.GeneratorConfig{{
+		Name:     "batch",
+		Count:    10,
+		Arrival:  "poisson",
+		Rate:     0.2,
+		CPU:      config.DistributionConfig{Distribution: "uniform", Min: "100m", Max: "1"},
+		Memory:   config.DistributionConfig{Value: "100Mi"},
+		Duration: config.DistributionConfig{Distribution: "exponential", Mean: "60", Max: "300"},
+	}}
+
+	// run runs the simulation and returns the KubeSim, and the nodes and the start times of the pods.
+	run := func(opts ...Option) (*KubeSim, map[string]string) {
+		k, err := NewKubeSim(append([]Option{WithConfig(conf)}, opts...)...)
+		assert.NoError(t, err)
+		assert.NoError(t, k.Run(context.Background()))
+
+		pods, err := k.ListPods(labels.Everything())
+		assert.NoError(t, err)
+		placements := map[string]string{}
+		for _, p := range pods {
+			assert.Equal(t, v1.PodSucceeded, p.Status.Phase, p.Name)
+			placements[p.Name] = p.Spec.NodeName + " " + p.Status.StartTime.UTC().Format(time.RFC3339)
+		}
+		return k, placements
+	}
+
+	binPacking := scheduler.NewBinPackingScheduler()
+	_, placements := run(WithScheduler(&binPacking))
+	assert.Len(t, placements, 10)
+
+	// The generated pods are replayed instead of generated again, with the recorded or another
+	// scheduler.
+	conf.TraceFile = ""
+	replayer, err := trace.NewReplayerFromFile(filepath.Join(dir, "trace.jsonl"))
+	assert.NoError(t, err)
+	k, replayed := run(WithScheduler(replayer.Scheduler()), WithReplayer(replayer))
+	assert.Empty(t, k.generated)
+	assert.Equal(t, placements, replayed)
+
+	replayer, err = trace.NewReplayerFromFile(filepath.Join(dir, "trace.jsonl"))
+	assert.NoError(t, err)
+	binPacking = scheduler.NewBinPackingScheduler()
+	k, replayed = run(WithScheduler(&binPacking), WithReplayer(replayer))
+	assert.Empty(t, k.generated)
+	assert.Len(t, replayed, 10)
+}
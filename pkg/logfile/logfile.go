@@ -0,0 +1,428 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logfile writes line-oriented output files (e.g., metrics logs and traces) of long
+// simulations with optional compression and size-based rotation, and reads them back.
+//
+// A rotated file at path is split into segments named <path>.0000, <path>.0001, ... (keeping the
+// extension of the compression, e.g., kubesim-trace.jsonl.0000.gz for kubesim-trace.jsonl.gz), and
+// an index of the segments is kept at <path>.index.
+// The index lists the segment being written as incomplete, so that the lines written before a
+// crash or an interruption can still be read.
+package logfile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+const (
+	// NoCompression writes files uncompressed.
+	NoCompression = ""
+	// Gzip compresses files with gzip.
+	Gzip = "gzip"
+	// Zstd compresses files with Zstandard.
+	Zstd = "zstd"
+
+	// IndexSuffix is appended to the path of a rotated file to name its index.
+	IndexSuffix = ".index"
+
+	// flushSize is the amount of uncompressed bytes after which the written lines are flushed to
+	// the file, so that they remain readable if the file is not closed.
+	flushSize = 1 << 20
+)
+
+// Options are the options of a Writer.
+type Options struct {
+	// Compression is NoCompression, Gzip, or Zstd.
+	Compression string
+	// MaxSize is the uncompressed size in bytes of a segment after which the file is rotated, or 0
+	// not to rotate the file.
+	MaxSize int64
+}
+
+// Index is the index of the segments of a rotated file, in the order they were written.
+type Index struct {
+	Compression string    `json:"compression"`
+	Segments    []Segment `json:"segments"`
+}
+
+// Segment is a segment of a rotated file.
+type Segment struct {
+	// File is the name of the segment, in the directory of the index.
+	File string `json:"file"`
+	// Lines is the number of lines in the segment, if complete.
+	Lines int64 `json:"lines"`
+	// Complete is whether the segment has been closed.
+	Complete bool `json:"complete"`
+}
+
+// compressor is implemented by *gzip.Writer and *zstd.Encoder.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// Writer is an io.WriteCloser that writes lines to a file with the Options.
+// Each Write should end with a newline, so that the file is rotated only at the end of lines.
+type Writer struct {
+	path       string
+	opts       Options
+	index      Index
+	compressed string // extension of compressed file names, or empty
+
+	file *os.File
+	buf  *bufio.Writer
+	comp compressor
+
+	// size, lines, and unflushed bytes of the current segment
+	size      int64
+	lines     int64
+	unflushed int64
+}
+
+// NewWriter creates a new Writer of the file at the path with the options.
+// The file will be truncated if it exists.
+// Returns error if the options are invalid or failed to create the file.
+func NewWriter(path string, opts Options) (*Writer, error) {
+	if path == "" {
+		return nil, strongerrors.InvalidArgument(errors.New("file path must not be empty"))
+	}
+	if opts.MaxSize < 0 {
+		return nil, strongerrors.InvalidArgument(errors.Errorf("negative max size %d", opts.MaxSize))
+	}
+
+	w := &Writer{path: path, opts: opts, index: Index{Compression: opts.Compression}}
+	switch opts.Compression {
+	case NoCompression:
+	case Gzip:
+		w.compressed = ".gz"
+	case Zstd:
+		w.compressed = ".zst"
+	default:
+		return nil, strongerrors.InvalidArgument(
+			errors.Errorf("compression %q is not supported", opts.Compression))
+	}
+
+	// An index left by a rotated file at the path would be read instead of the file.
+	if opts.MaxSize == 0 {
+		if err := os.Remove(path + IndexSuffix); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Name returns the path of the file, whose index is at Name()+IndexSuffix if rotated.
+func (w *Writer) Name() string { return w.path }
+
+// Write implements io.Writer interface.
+// The file is rotated after the write if the current segment exceeds Options.MaxSize and p ends
+// with a newline.
+func (w *Writer) Write(p []byte) (int, error) {
+	n, err := w.out().Write(p)
+	w.size += int64(n)
+	w.unflushed += int64(n)
+	w.lines += int64(bytes.Count(p[:n], []byte{'\n'}))
+	if err != nil {
+		return n, err
+	}
+
+	atLineEnd := n > 0 && p[n-1] == '\n'
+	if w.opts.MaxSize > 0 && w.size >= w.opts.MaxSize && atLineEnd {
+		return n, w.rotate()
+	}
+	if w.unflushed >= flushSize && atLineEnd {
+		return n, w.Flush()
+	}
+
+	return n, nil
+}
+
+// Flush writes the buffered lines to the file, so that they can be read before Close.
+func (w *Writer) Flush() error {
+	if w.comp != nil {
+		if err := w.comp.Flush(); err != nil {
+			return err
+		}
+	}
+	w.unflushed = 0
+
+	return w.buf.Flush()
+}
+
+// Close closes the file, and marks the last segment complete in the index if rotated.
+func (w *Writer) Close() error {
+	return w.closeSegment()
+}
+
+func (w *Writer) out() io.Writer {
+	if w.comp != nil {
+		return w.comp
+	}
+	return w.buf
+}
+
+func (w *Writer) rotate() error {
+	if err := w.closeSegment(); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+// open creates the next segment, or the file if not rotated.
+func (w *Writer) open() error {
+	path := w.path
+	if w.opts.MaxSize > 0 {
+		path = segmentPath(w.path, w.compressed, len(w.index.Segments))
+		w.index.Segments = append(w.index.Segments, Segment{File: filepath.Base(path)})
+		if err := w.writeIndex(); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	w.file = file
+	w.buf = bufio.NewWriter(file)
+	w.comp = nil
+	w.size, w.lines, w.unflushed = 0, 0, 0
+
+	switch w.opts.Compression {
+	case Gzip:
+		w.comp = gzip.NewWriter(w.buf)
+	case Zstd:
+		if w.comp, err = zstd.NewWriter(w.buf); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *Writer) closeSegment() error {
+	if w.comp != nil {
+		if err := w.comp.Close(); err != nil {
+			w.file.Close()
+			return err
+		}
+	}
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	if w.opts.MaxSize > 0 {
+		last := &w.index.Segments[len(w.index.Segments)-1]
+		last.Lines = w.lines
+		last.Complete = true
+		return w.writeIndex()
+	}
+
+	return nil
+}
+
+// writeIndex replaces the index file atomically.
+func (w *Writer) writeIndex() error {
+	data, err := json.MarshalIndent(&w.index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := w.path + IndexSuffix + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.path+IndexSuffix)
+}
+
+// segmentPath returns the path of the n-th segment of the file at the path, inserting the number
+// before the extension of the compression.
+func segmentPath(path, compressed string, n int) string {
+	stem := path
+	if compressed != "" && strings.HasSuffix(path, compressed) {
+		stem = strings.TrimSuffix(path, compressed)
+	}
+	return fmt.Sprintf("%s.%04d%s", stem, n, compressed)
+}
+
+// Open opens the file at the path written by a Writer, or any plain, gzip, or Zstandard file, and
+// returns a reader of its decompressed lines.
+// If <path>.index exists, the segments listed in it are read in order.
+// The lines of a file or an incomplete segment are read up to the last complete one, so that a
+// file not closed (e.g., by a crash) can still be read.
+// Returns error if failed to open the file or its index.
+func Open(path string) (io.ReadCloser, error) {
+	data, err := ioutil.ReadFile(path + IndexSuffix)
+	if os.IsNotExist(err) {
+		return openSegment(path, false, true)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, strongerrors.InvalidArgument(
+			errors.Errorf("invalid index %s: %s", path+IndexSuffix, err.Error()))
+	}
+
+	return &segmentsReader{dir: filepath.Dir(path), segments: index.Segments}, nil
+}
+
+// openSegment opens the file at the path, detecting its compression.
+// If complete is false, the file may end with a truncated line or compressed stream, which is
+// dropped; the last line without a newline at the end of the file is kept if keepLast is true.
+func openSegment(path string, complete, keepLast bool) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bufio.NewReader(file)
+	magic, _ := buf.Peek(4)
+
+	var reader io.Reader = buf
+	closeReader := func() {}
+	if bytes.HasPrefix(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(buf)
+		if err != nil {
+			file.Close()
+			return nil, errors.Wrapf(err, "error reading %s", path)
+		}
+		reader = gz
+	} else if bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}) {
+		dec, err := zstd.NewReader(buf)
+		if err != nil {
+			file.Close()
+			return nil, errors.Wrapf(err, "error reading %s", path)
+		}
+		reader = dec
+		closeReader = dec.Close
+	}
+
+	if !complete {
+		reader = &lineReader{reader: bufio.NewReader(reader), keepLast: keepLast}
+	}
+
+	return &segmentReader{Reader: reader, file: file, closeReader: closeReader}, nil
+}
+
+type segmentReader struct {
+	io.Reader
+	file        *os.File
+	closeReader func()
+}
+
+func (r *segmentReader) Close() error {
+	r.closeReader()
+	return r.file.Close()
+}
+
+// lineReader reads complete lines, and ends at a truncated line or an error.
+type lineReader struct {
+	reader *bufio.Reader
+	// keepLast is whether to read the last line without a newline at the end of the reader.
+	keepLast bool
+	line     []byte
+	done     bool
+}
+
+func (r *lineReader) Read(p []byte) (int, error) {
+	for len(r.line) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		line, err := r.reader.ReadBytes('\n')
+		if err != nil {
+			// The rest after the last complete line is truncated, unless the reader ended normally.
+			r.done = true
+			if err != io.EOF || !r.keepLast {
+				continue
+			}
+		}
+		r.line = line
+	}
+
+	n := copy(p, r.line)
+	r.line = r.line[n:]
+	return n, nil
+}
+
+// segmentsReader reads the segments of a rotated file in order.
+type segmentsReader struct {
+	dir      string
+	segments []Segment
+	current  io.ReadCloser
+}
+
+func (r *segmentsReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.segments) == 0 {
+				return 0, io.EOF
+			}
+
+			seg := r.segments[0]
+			r.segments = r.segments[1:]
+			current, err := openSegment(filepath.Join(r.dir, seg.File), seg.Complete, false)
+			if err != nil {
+				return 0, err
+			}
+			r.current = current
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			err = r.current.Close()
+			r.current = nil
+			if n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *segmentsReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
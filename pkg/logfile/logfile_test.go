@@ -0,0 +1,116 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeLines(t *testing.T, w *Writer, from, to int) string {
+	expected := ""
+	for i := from; i < to; i++ {
+		line := fmt.Sprintf("{\"line\": %d}\n", i)
+		_, err := w.Write([]byte(line))
+		assert.NoError(t, err)
+		expected += line
+	}
+	return expected
+}
+
+func readAll(t *testing.T, path string) string {
+	reader, err := Open(path)
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logfile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, compression := range []string{NoCompression, Gzip, Zstd} {
+		for _, maxSize := range []int64{0, 100} {
+			path := filepath.Join(dir, fmt.Sprintf("log-%s-%d.jsonl", compression, maxSize))
+			w, err := NewWriter(path, Options{Compression: compression, MaxSize: maxSize})
+			assert.NoError(t, err)
+
+			expected := writeLines(t, w, 0, 50)
+			assert.NoError(t, w.Close())
+
+			assert.Equal(t, expected, readAll(t, path), "%s %d", compression, maxSize)
+		}
+	}
+}
+
+func TestWriterRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logfile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "trace.jsonl.gz")
+
+	w, err := NewWriter(path, Options{Compression: Gzip, MaxSize: 30})
+	assert.NoError(t, err)
+	writeLines(t, w, 0, 5) // 14 bytes per line
+	assert.NoError(t, w.Close())
+
+	data, err := ioutil.ReadFile(path + IndexSuffix)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"compression": "gzip", "segments": [
+		{"file": "trace.jsonl.0000.gz", "lines": 3, "complete": true},
+		{"file": "trace.jsonl.0001.gz", "lines": 2, "complete": true}
+	]}`, string(data))
+
+	_, err = os.Stat(filepath.Join(dir, "trace.jsonl.0001.gz"))
+	assert.NoError(t, err)
+}
+
+func TestReadIncompleteSegment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logfile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, compression := range []string{NoCompression, Gzip, Zstd} {
+		path := filepath.Join(dir, "log-"+compression)
+		w, err := NewWriter(path, Options{Compression: compression, MaxSize: 100})
+		assert.NoError(t, err)
+
+		expected := writeLines(t, w, 0, 10)
+		assert.NoError(t, w.Flush())
+		// Neither flushed nor closed, as if the simulation crashed.
+		_, err = w.Write([]byte(`{"truncated"`))
+		assert.NoError(t, err)
+		assert.NoError(t, w.buf.Flush())
+
+		assert.Equal(t, expected, readAll(t, path), compression)
+	}
+}
+
+func TestNewWriterInvalidOptions(t *testing.T) {
+	_, err := NewWriter("", Options{})
+	assert.Error(t, err)
+
+	_, err = NewWriter(filepath.Join(os.TempDir(), "logfile-invalid"), Options{Compression: "xz"})
+	assert.EqualError(t, err, `compression "xz" is not supported`)
+}
@@ -0,0 +1,128 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"math"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"simulator/pkg/node"
+)
+
+// DefaultSaturationThreshold is the default utilization of a resource by the usage at or above
+// which a node is saturated.
+const DefaultSaturationThreshold = 0.9
+
+// BalanceMetrics maps each resource of the nodes to the statistics of its utilization over the
+// nodes, to compare how evenly policies spread the load.
+type BalanceMetrics map[v1.ResourceName]ResourceBalance
+
+// ResourceBalance is the statistics of the utilization of a resource over the nodes.
+type ResourceBalance struct {
+	// Request is the statistics of the fractions of the allocatable amount requested.
+	Request UtilizationStats
+	// Usage is the statistics of the fractions of the capacity used.
+	Usage UtilizationStats
+	// SaturatedNodes are the names of the nodes whose utilization by the usage is at or above the
+	// saturation threshold, in sorted order.
+	SaturatedNodes []string
+}
+
+// UtilizationStats is the mean, the standard deviation, the coefficient of variation (StdDev /
+// Mean, or 0 if Mean is 0), and the maximum of the utilization of a resource over the nodes.
+type UtilizationStats struct {
+	Mean   float64
+	StdDev float64
+	CoV    float64
+	Max    float64
+}
+
+// BuildBalanceMetrics builds a BalanceMetrics of the nodes from their metrics, with the saturation
+// threshold.
+// The pods resource, which has no usage, is excluded, as well as the resources that a node does not
+// have.
+func BuildBalanceMetrics(nodes map[string]node.Metrics, threshold float64) BalanceMetrics {
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	requests := map[v1.ResourceName][]float64{}
+	usages := map[v1.ResourceName][]float64{}
+	saturated := map[v1.ResourceName][]string{}
+	for _, name := range names {
+		met := nodes[name]
+		for rsrc, alloc := range met.Allocatable {
+			if rsrc == v1.ResourcePods || alloc.IsZero() {
+				continue
+			}
+			capacity, ok := met.Capacity[rsrc]
+			if !ok || capacity.IsZero() {
+				capacity = alloc
+			}
+
+			usage := fraction(met.TotalResourceUsage[rsrc], capacity)
+			requests[rsrc] = append(requests[rsrc], fraction(met.TotalResourceRequest[rsrc], alloc))
+			usages[rsrc] = append(usages[rsrc], usage)
+			if usage >= threshold {
+				saturated[rsrc] = append(saturated[rsrc], name)
+			}
+		}
+	}
+
+	balance := BalanceMetrics{}
+	for rsrc := range requests {
+		balance[rsrc] = ResourceBalance{
+			Request:        buildUtilizationStats(requests[rsrc]),
+			Usage:          buildUtilizationStats(usages[rsrc]),
+			SaturatedNodes: append([]string{}, saturated[rsrc]...),
+		}
+	}
+
+	return balance
+}
+
+func buildUtilizationStats(utils []float64) UtilizationStats {
+	stats := UtilizationStats{}
+	if len(utils) == 0 {
+		return stats
+	}
+
+	for _, u := range utils {
+		stats.Mean += u
+		stats.Max = math.Max(stats.Max, u)
+	}
+	stats.Mean /= float64(len(utils))
+
+	for _, u := range utils {
+		stats.StdDev += (u - stats.Mean) * (u - stats.Mean)
+	}
+	stats.StdDev = math.Sqrt(stats.StdDev / float64(len(utils)))
+
+	if stats.Mean > 0 {
+		stats.CoV = stats.StdDev / stats.Mean
+	}
+
+	return stats
+}
+
+// fraction returns q / total, keeping milli precision.
+func fraction(q, total resource.Quantity) float64 {
+	return float64(q.MilliValue()) / float64(total.MilliValue())
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"simulator/pkg/node"
+)
+
+func TestBuildBalanceMetrics(t *testing.T) {
+	resources := func(cpu, memory string) v1.ResourceList {
+		return v1.ResourceList{"cpu": resource.MustParse(cpu), "memory": resource.MustParse(memory)}
+	}
+	nodes := map[string]node.Metrics{
+		"node-0": {
+			Allocatable:          v1.ResourceList{"cpu": resource.MustParse("4"), "pods": resource.MustParse("10")},
+			TotalResourceRequest: v1.ResourceList{"cpu": resource.MustParse("4")},
+			TotalResourceUsage:   v1.ResourceList{"cpu": resource.MustParse("3600m")},
+		},
+		"node-1": {
+			// Overcommitted by twice: the usage is relative to the capacity.
+			Allocatable:          resources("8", "8Gi"),
+			Capacity:             resources("4", "4Gi"),
+			TotalResourceRequest: resources("4", "2Gi"),
+			TotalResourceUsage:   resources("2", "4Gi"),
+		},
+		"node-2": {
+			Allocatable: resources("4", "4Gi"),
+		},
+	}
+
+	balance := BuildBalanceMetrics(nodes, 0.9)
+	assert.Len(t, balance, 2)
+
+	cpu := balance["cpu"]
+	assert.InDelta(t, 0.5, cpu.Request.Mean, 1e-9)
+	assert.Equal(t, 1.0, cpu.Request.Max)
+	assert.InDelta(t, 0.4082, cpu.Request.StdDev, 1e-4)
+	assert.InDelta(t, 0.8165, cpu.Request.CoV, 1e-4)
+	assert.InDelta(t, (0.9+0.5)/3, cpu.Usage.Mean, 1e-9)
+	assert.Equal(t, []string{"node-0"}, cpu.SaturatedNodes)
+
+	memory := balance["memory"]
+	assert.InDelta(t, 0.125, memory.Request.Mean, 1e-9)
+	assert.InDelta(t, 0.5, memory.Usage.Mean, 1e-9)
+	assert.Equal(t, 1.0, memory.Usage.Max)
+	assert.Equal(t, []string{"node-1"}, memory.SaturatedNodes)
+
+	// No load.
+	balance = BuildBalanceMetrics(map[string]node.Metrics{"node-2": nodes["node-2"]}, 0.9)
+	assert.Equal(t, ResourceBalance{SaturatedNodes: []string{}}, balance["cpu"])
+}
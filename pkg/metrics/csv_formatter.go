@@ -0,0 +1,163 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"encoding/csv"
+	"sort"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+	"simulator/pkg/util"
+)
+
+// CSVHeader is the header of the rows written by CSVFormatter.
+var CSVHeader = []string{
+	"clock", "kind", "name", "node", "status", "pods",
+	"cpu_request", "cpu_usage", "cpu_allocatable",
+	"memory_request", "memory_usage", "memory_allocatable",
+	"pending_pods", "scheduling_latency_seconds",
+	"gpu_request", "gpu_usage", "gpu_allocatable",
+}
+
+// CSVFormatter is a Formatter that formats metrics to CSV rows, one row per node, pod, and queue,
+// preceded by CSVHeader in the first metrics formatted.
+// The cpu is in millicores, the memory is in bytes, and the GPUs (util.ResourceGPU) are in milli-GPUs;
+// the columns not applicable to the kind of a row are empty.
+type CSVFormatter struct {
+	headerWritten bool
+}
+
+// Format implements Formatter interface.
+// It formats the given metrics to CSV rows, without newline at the end.
+// Returns error if the given metrics does not have valid structure.
+func (c *CSVFormatter) Format(metrics *Metrics) (string, error) {
+	if err := validateMetrics(metrics); err != nil {
+		return "", err
+	}
+
+	clk := (*metrics)[ClockKey].(string)
+	rows := [][]string{}
+	if !c.headerWritten {
+		rows = append(rows, CSVHeader)
+	}
+
+	nodesMet := (*metrics)[NodesMetricsKey].(map[string]node.Metrics)
+	for _, name := range sortedNodeNames(nodesMet) {
+		met := nodesMet[name]
+		rows = append(rows, []string{
+			clk, "node", name, "", "", strconv.FormatInt(met.RunningPodsNum, 10),
+			milliString(met.TotalResourceRequest, v1.ResourceCPU),
+			milliString(met.TotalResourceUsage, v1.ResourceCPU),
+			milliString(met.Allocatable, v1.ResourceCPU),
+			valueString(met.TotalResourceRequest, v1.ResourceMemory),
+			valueString(met.TotalResourceUsage, v1.ResourceMemory),
+			valueString(met.Allocatable, v1.ResourceMemory),
+			"", "",
+			milliString(met.TotalResourceRequest, util.ResourceGPU),
+			milliString(met.TotalResourceUsage, util.ResourceGPU),
+			milliString(met.Allocatable, util.ResourceGPU),
+		})
+	}
+
+	podsMet := (*metrics)[PodsMetricsKey].(map[string]pod.Metrics)
+	for _, name := range sortedPodNames(podsMet) {
+		met := podsMet[name]
+		rows = append(rows, []string{
+			clk, "pod", name, met.Node, met.Status.String(), "",
+			milliString(met.ResourceRequest, v1.ResourceCPU),
+			milliString(met.ResourceUsage, v1.ResourceCPU),
+			"",
+			valueString(met.ResourceRequest, v1.ResourceMemory),
+			valueString(met.ResourceUsage, v1.ResourceMemory),
+			"",
+			"", strconv.FormatFloat(met.SchedulingLatencySeconds, 'f', -1, 64),
+			milliString(met.ResourceRequest, util.ResourceGPU),
+			milliString(met.ResourceUsage, util.ResourceGPU),
+			"",
+		})
+	}
+
+	queueMet := (*metrics)[QueueMetricsKey].(queue.Metrics)
+	rows = append(rows, []string{
+		clk, "queue", "", "", "", "", "", "", "", "", "", "",
+		strconv.Itoa(queueMet.PendingPodsNum), "", "", "", "",
+	})
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll(rows); err != nil {
+		return "", err
+	}
+	c.headerWritten = true
+
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+var _ = Formatter(&CSVFormatter{})
+
+// sortedNodeNames returns the names of the nodes in the metrics in ascending order.
+func sortedNodeNames(metrics map[string]node.Metrics) []string {
+	nodes := make([]string, 0, len(metrics))
+	for name := range metrics {
+		nodes = append(nodes, name)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// sortedPodNames returns the keys of the pods in the metrics in ascending order.
+func sortedPodNames(metrics map[string]pod.Metrics) []string {
+	pods := make([]string, 0, len(metrics))
+	for name := range metrics {
+		pods = append(pods, name)
+	}
+	sort.Strings(pods)
+	return pods
+}
+
+// sortedResourceNames returns the resources in the list in ascending order.
+func sortedResourceNames(rl v1.ResourceList) []v1.ResourceName {
+	rsrcs := make([]v1.ResourceName, 0, len(rl))
+	for rsrc := range rl {
+		rsrcs = append(rsrcs, rsrc)
+	}
+	sort.Slice(rsrcs, func(i, j int) bool { return rsrcs[i] < rsrcs[j] })
+	return rsrcs
+}
+
+// milliString returns the resource in the list in milli-units, or empty if not in the list.
+func milliString(rl v1.ResourceList, rsrc v1.ResourceName) string {
+	q, ok := rl[rsrc]
+	if !ok {
+		return ""
+	}
+	return strconv.FormatInt(q.MilliValue(), 10)
+}
+
+// valueString returns the resource in the list in units, or empty if not in the list.
+func valueString(rl v1.ResourceList, rsrc v1.ResourceName) string {
+	q, ok := rl[rsrc]
+	if !ok {
+		return ""
+	}
+	return strconv.FormatInt(q.Value(), 10)
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/logfile"
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+)
+
+func TestCSVFormatter(t *testing.T) {
+	clk := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	met := &Metrics{
+		ClockKey: clk.ToRFC3339(),
+		NodesMetricsKey: map[string]node.Metrics{
+			"node-0": {
+				Allocatable: v1.ResourceList{
+					"cpu": resource.MustParse("4"), "memory": resource.MustParse("1Ki"), "nvidia.com/gpu": resource.MustParse("2"),
+				},
+				TotalResourceRequest: v1.ResourceList{
+					"cpu": resource.MustParse("1"), "memory": resource.MustParse("512"), "nvidia.com/gpu": resource.MustParse("1"),
+				},
+				TotalResourceUsage: v1.ResourceList{"cpu": resource.MustParse("500m"), "nvidia.com/gpu": resource.MustParse("800m")},
+				RunningPodsNum:     1,
+			},
+		},
+		PodsMetricsKey: map[string]pod.Metrics{
+			"default/pod-0": {
+				ResourceRequest: v1.ResourceList{
+					"cpu": resource.MustParse("1"), "memory": resource.MustParse("512"), "nvidia.com/gpu": resource.MustParse("1"),
+				},
+				ResourceUsage:            v1.ResourceList{"cpu": resource.MustParse("500m"), "nvidia.com/gpu": resource.MustParse("800m")},
+				Node:                     "node-0",
+				Status:                   pod.Ok,
+				SchedulingLatencySeconds: 1.5,
+			},
+		},
+		QueueMetricsKey: queue.Metrics{PendingPodsNum: 2},
+	}
+
+	formatter := &CSVFormatter{}
+	str, err := formatter.Format(met)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Join([]string{
+		"clock,kind,name,node,status,pods,cpu_request,cpu_usage,cpu_allocatable," +
+			"memory_request,memory_usage,memory_allocatable,pending_pods,scheduling_latency_seconds," +
+			"gpu_request,gpu_usage,gpu_allocatable",
+		"2019-01-01T00:00:00Z,node,node-0,,,1,1000,500,4000,512,,1024,,,1000,800,2000",
+		"2019-01-01T00:00:00Z,pod,default/pod-0,node-0,Ok,,1000,500,,512,,,,1.5,1000,800,",
+		"2019-01-01T00:00:00Z,queue,,,,,,,,,,,2,,,,",
+	}, "\n"), str)
+
+	// The header is written only once.
+	str, err = formatter.Format(met)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(str, "2019-01-01T00:00:00Z,node,node-0,"))
+
+	_, err = formatter.Format(&Metrics{})
+	assert.Error(t, err)
+}
+
+func TestFileWriterFlushInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "kubesim.log")
+	writer, err := NewFileWriter(path, &JSONFormatter{}, logfile.Options{})
+	assert.NoError(t, err)
+	writer.SetFlushInterval(time.Hour)
+
+	lines := func() int {
+		data, err := ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		return strings.Count(string(data), "\n")
+	}
+
+	// The first metrics is flushed, and the following ones are buffered until the interval elapses
+	// or the writer is closed.
+	assert.NoError(t, writer.Write(&Metrics{ClockKey: "t0"}))
+	assert.Equal(t, 1, lines())
+	assert.NoError(t, writer.Write(&Metrics{ClockKey: "t1"}))
+	assert.Equal(t, 1, lines())
+	assert.NoError(t, writer.Close())
+	assert.Equal(t, 2, lines())
+}
@@ -0,0 +1,187 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+	"simulator/pkg/util"
+)
+
+// DeadlineMetrics represents the numbers of pods that met or missed their deadlines (see
+// pod.DeadlineAnnotation), accumulated since the simulation started.
+// A pod meets its deadline if it finishes spontaneously by the deadline, and misses it as soon as
+// the deadline passes without that, whether the pod is pending, running, or has been deleted,
+// evicted, or preempted.
+type DeadlineMetrics struct {
+	MetDeadlines    int64
+	MissedDeadlines int64
+	// MissRate is MissedDeadlines / (MetDeadlines + MissedDeadlines).
+	MissRate float64
+	// Queue is the kind of the queue of the pending pods followed by its order if any (e.g.,
+	// "priority/edf"), or empty if the queue was not built from the config.
+	Queue string `json:",omitempty"`
+	// Schedulers maps the name of each scheduler to the DeadlineMetrics of the pods that met or
+	// missed their deadlines while it was active, or that had it as their schedulerName if routed.
+	Schedulers map[string]DeadlineMetrics `json:",omitempty"`
+}
+
+// WatchedDeadline is the deadline of a pod that has neither met nor missed it yet.
+type WatchedDeadline struct {
+	Deadline clock.Clock
+	// Scheduler is the name of the scheduler to which the pod is routed by its schedulerName, or
+	// empty if scheduled by the active one.
+	Scheduler string `json:",omitempty"`
+}
+
+// DeadlineTracker accumulates DeadlineMetrics over the pods it watches.
+type DeadlineTracker struct {
+	met     DeadlineMetrics
+	watched map[string]WatchedDeadline
+}
+
+// NewDeadlineTracker creates a new DeadlineTracker that has already recorded the given
+// DeadlineMetrics and watches the given deadlines, e.g., restored from a checkpoint.
+func NewDeadlineTracker(recorded DeadlineMetrics, watched map[string]WatchedDeadline) DeadlineTracker {
+	t := DeadlineTracker{met: recorded.copy(), watched: map[string]WatchedDeadline{}}
+	for key, w := range watched {
+		t.watched[key] = w
+	}
+	return t
+}
+
+// SetQueue sets the name of the queue reported in DeadlineMetrics.Queue.
+func (t *DeadlineTracker) SetQueue(name string) {
+	t.met.Queue = name
+}
+
+// Recorded returns the DeadlineMetrics of the pods recorded so far.
+func (t *DeadlineTracker) Recorded() DeadlineMetrics {
+	return t.met.copy()
+}
+
+// Watched returns the deadlines watched, keyed by the pods.
+func (t *DeadlineTracker) Watched() map[string]WatchedDeadline {
+	watched := make(map[string]WatchedDeadline, len(t.watched))
+	for key, w := range t.watched {
+		watched[key] = w
+	}
+	return watched
+}
+
+// Watch starts watching the deadline of the given submitted pod, routed to the given scheduler or
+// scheduled by the active one if empty.
+// Pods without valid deadlines are ignored.
+func (t *DeadlineTracker) Watch(v1Pod *v1.Pod, scheduler string) {
+	deadline, ok, err := pod.Deadline(v1Pod)
+	if err != nil || !ok {
+		return
+	}
+	if t.watched == nil {
+		t.watched = map[string]WatchedDeadline{}
+	}
+	t.watched[util.PodKeyFromNames(v1Pod.Namespace, v1Pod.Name)] = WatchedDeadline{
+		Deadline:  deadline,
+		Scheduler: scheduler,
+	}
+}
+
+// Rename moves the watched deadline of the pod of oldKey to the pod of newKey, e.g., the pod
+// recreated for a preempted one.
+func (t *DeadlineTracker) Rename(oldKey, newKey string) {
+	if w, ok := t.watched[oldKey]; ok {
+		delete(t.watched, oldKey)
+		t.watched[newKey] = w
+	}
+}
+
+// Record records whether each of the given pods finished spontaneously by its deadline at the
+// given clock, charging the given active scheduler unless the pod is routed.
+// Pods not watched or not finished spontaneously are ignored.
+func (t *DeadlineTracker) Record(clock clock.Clock, pods []*pod.Pod, active string) {
+	for _, p := range pods {
+		v1Pod := p.ToV1()
+		key := util.PodKeyFromNames(v1Pod.Namespace, v1Pod.Name)
+		w, ok := t.watched[key]
+		if !ok {
+			continue
+		}
+		met, finished := p.MetDeadline(clock)
+		if !finished {
+			continue
+		}
+
+		delete(t.watched, key)
+		t.met.add(schedulerOf(w, active), met)
+	}
+}
+
+// Observe records the pods finished on the nodes, then records as missed the deadlines watched
+// before the given clock, and returns the DeadlineMetrics accumulated so far.
+func (t *DeadlineTracker) Observe(clock clock.Clock, nodes map[string]*node.Node, active string) DeadlineMetrics {
+	for _, node := range nodes {
+		t.Record(clock, node.PodList(), active)
+	}
+
+	for key, w := range t.watched {
+		if w.Deadline.Before(clock) {
+			delete(t.watched, key)
+			t.met.add(schedulerOf(w, active), false)
+		}
+	}
+
+	return t.Recorded()
+}
+
+func schedulerOf(w WatchedDeadline, active string) string {
+	if w.Scheduler != "" {
+		return w.Scheduler
+	}
+	return active
+}
+
+func (met *DeadlineMetrics) add(scheduler string, ok bool) {
+	met.count(ok)
+
+	if met.Schedulers == nil {
+		met.Schedulers = map[string]DeadlineMetrics{}
+	}
+	sched := met.Schedulers[scheduler]
+	sched.count(ok)
+	met.Schedulers[scheduler] = sched
+}
+
+func (met *DeadlineMetrics) count(ok bool) {
+	if ok {
+		met.MetDeadlines++
+	} else {
+		met.MissedDeadlines++
+	}
+	met.MissRate = float64(met.MissedDeadlines) / float64(met.MetDeadlines+met.MissedDeadlines)
+}
+
+func (met DeadlineMetrics) copy() DeadlineMetrics {
+	if met.Schedulers != nil {
+		schedulers := make(map[string]DeadlineMetrics, len(met.Schedulers))
+		for name, sched := range met.Schedulers {
+			schedulers[name] = sched
+		}
+		met.Schedulers = schedulers
+	}
+	return met
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/pod"
+)
+
+func newDeadlinePod(name, schedulerName string, seconds string, created clock.Clock) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			CreationTimestamp: created.ToMetaV1(),
+			Annotations: map[string]string{
+				"simSpec":              "- seconds: " + seconds + "\n  resourceUsage:\n    cpu: 1\n",
+				pod.DeadlineAnnotation: "1m",
+			},
+		},
+		Spec: v1.PodSpec{SchedulerName: schedulerName},
+	}
+}
+
+func TestDeadlineTracker(t *testing.T) {
+	start := clock.NewClock(time.Now())
+	tracker := NewDeadlineTracker(DeadlineMetrics{}, nil)
+	tracker.SetQueue("priority/edf")
+
+	short := newDeadlinePod("short", "", "30", start)
+	long := newDeadlinePod("long", "", "100", start)
+	pending := newDeadlinePod("pending", "batch", "10", start)
+	none := newDeadlinePod("none", "", "10", start)
+	delete(none.Annotations, pod.DeadlineAnnotation)
+	tracker.Watch(short, "")
+	tracker.Watch(long, "")
+	tracker.Watch(pending, "batch")
+	tracker.Watch(none, "")
+	assert.Len(t, tracker.Watched(), 3)
+
+	shortPod, err := pod.NewPod(short, start, pod.Ok, "node-0")
+	assert.NoError(t, err)
+	longPod, err := pod.NewPod(long, start, pod.Ok, "node-0")
+	assert.NoError(t, err)
+
+	// Only the short pod has finished, by its deadline.
+	tracker.Record(start.Add(50*time.Second), []*pod.Pod{shortPod, longPod}, "default")
+	assert.Equal(t, DeadlineMetrics{
+		MetDeadlines: 1,
+		Queue:        "priority/edf",
+		Schedulers:   map[string]DeadlineMetrics{"default": {MetDeadlines: 1}},
+	}, tracker.Observe(start.Add(50*time.Second), nil, "default"))
+
+	// The long pod misses its deadline while running, and the pending one while pending.
+	met := tracker.Observe(start.Add(70*time.Second), nil, "other")
+	assert.Equal(t, int64(1), met.MetDeadlines)
+	assert.Equal(t, int64(2), met.MissedDeadlines)
+	assert.InDelta(t, 2.0/3, met.MissRate, 1e-9)
+	assert.Equal(t, map[string]DeadlineMetrics{
+		"default": {MetDeadlines: 1},
+		"other":   {MissedDeadlines: 1, MissRate: 1},
+		"batch":   {MissedDeadlines: 1, MissRate: 1},
+	}, met.Schedulers)
+	assert.Empty(t, tracker.Watched())
+
+	// Misses are counted once, even though the long pod finishes later.
+	tracker.Record(start.Add(100*time.Second), []*pod.Pod{longPod}, "default")
+	assert.Equal(t, met, tracker.Observe(start.Add(100*time.Second), nil, "default"))
+}
+
+func TestDeadlineTrackerRestore(t *testing.T) {
+	start := clock.NewClock(time.Now())
+	tracker := NewDeadlineTracker(DeadlineMetrics{}, nil)
+	tracker.Watch(newDeadlinePod("pod-0", "", "10", start), "")
+	tracker.Rename("default/pod-0", "default/pod-0-x")
+	watched := tracker.Watched()
+	assert.Equal(t, map[string]WatchedDeadline{"default/pod-0-x": {Deadline: start.Add(time.Minute)}}, watched)
+
+	restored := NewDeadlineTracker(DeadlineMetrics{MetDeadlines: 1}, watched)
+	met := restored.Observe(start.Add(2*time.Minute), nil, "default")
+	assert.Equal(t, int64(1), met.MetDeadlines)
+	assert.Equal(t, int64(1), met.MissedDeadlines)
+	assert.Len(t, watched, 1)
+}
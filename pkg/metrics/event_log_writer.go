@@ -0,0 +1,79 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"encoding/json"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+
+	"simulator/pkg/logfile"
+)
+
+// EventLogWriter is a Writer that writes the events of pods and nodes to a file, one JSON object
+// per line in the order of the events, so that the full event log can be analyzed after the
+// simulation.
+// The metrics are not written; the file is flushed at every metrics tick.
+type EventLogWriter struct {
+	file *logfile.Writer
+}
+
+// NewEventLogWriter creates a new EventLogWriter with a file at the given path, which is compressed
+// and rotated with the options.
+// The file will be truncated if it exists.
+// Returns error if failed to create the file.
+func NewEventLogWriter(path string, opts logfile.Options) (*EventLogWriter, error) {
+	if path == "" {
+		return nil, strongerrors.InvalidArgument(errors.New("event log path must not be empty"))
+	}
+
+	file, err := logfile.NewWriter(path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventLogWriter{file: file}, nil
+}
+
+// Write implements Writer interface.
+// Flushes the events written so far, to keep the file readable while the simulation is running.
+func (w *EventLogWriter) Write(metrics *Metrics) error {
+	return w.file.Flush()
+}
+
+// WriteEvents implements EventWriter interface.
+// Returns error if failed to write the events.
+func (w *EventLogWriter) WriteEvents(events []Event) error {
+	for _, e := range events {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err := w.file.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close closes the file.
+func (w *EventLogWriter) Close() error {
+	return w.file.Close()
+}
+
+var _ = Writer(&EventLogWriter{})
+var _ = EventWriter(&EventLogWriter{})
@@ -0,0 +1,56 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"simulator/pkg/logfile"
+)
+
+func TestEventLogWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.jsonl")
+	writer, err := NewEventLogWriter(path, logfile.Options{})
+	assert.NoError(t, err)
+
+	clk := "2019-01-01T00:00:00Z"
+	assert.NoError(t, writer.WriteEvents([]Event{
+		{Clock: clk, Kind: SubmitEvent, Pod: "default/pod-0"},
+		{Clock: clk, Kind: BindEvent, Pod: "default/pod-0", Node: "node-0"},
+	}))
+	assert.NoError(t, writer.Write(&Metrics{}))
+	assert.NoError(t, writer.WriteEvents([]Event{{Clock: clk, Kind: NodeDeleteEvent, Node: "node-0"}}))
+	assert.NoError(t, writer.Close())
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		`{"Clock":"2019-01-01T00:00:00Z","Kind":"Submit","Pod":"default/pod-0","Node":""}
+{"Clock":"2019-01-01T00:00:00Z","Kind":"Bind","Pod":"default/pod-0","Node":"node-0"}
+{"Clock":"2019-01-01T00:00:00Z","Kind":"NodeDelete","Pod":"","Node":"node-0"}
+`, string(data))
+
+	_, err = NewEventLogWriter("", logfile.Options{})
+	assert.EqualError(t, err, "event log path must not be empty")
+}
@@ -15,44 +15,72 @@
 package metrics
 
 import (
+	"io"
 	"os"
 	"strings"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+
+	"simulator/pkg/logfile"
 )
 
 // FileWriter is a Writer that writes metrics to a file.
 type FileWriter struct {
-	file      *os.File
+	name string
+	// file is os.Stdout, os.Stderr, or a *logfile.Writer.
+	file      io.Writer
 	formatter Formatter
+
+	// flushInterval is the minimum interval of wall-clock time between flushes of the file.
+	flushInterval time.Duration
+	lastFlush     time.Time
 }
 
 // NewFileWriter creates a new FileWriter with an output device or file at the given path, and the formatter that
 // formats metrics to a string
 // If /dev/stdout or stdout is given, the standard out is set.
 // If /dev/stderr or stderr is given, the standard error is set.
-// Otherwise, the file of a given path is set and it will be truncated if it exists.
-// Returns error if failed to create a file.
-func NewFileWriter(dest string, formatter Formatter) (*FileWriter, error) {
-	var file *os.File
+// Otherwise, the file of a given path is set and it will be truncated if it exists; the file is
+// compressed and rotated with the options.
+// Returns error if failed to create a file, or the options are given for an output device.
+func NewFileWriter(dest string, formatter Formatter, opts logfile.Options) (*FileWriter, error) {
+	var file io.Writer
+	var name string
 	if dest == "/dev/stdout" || strings.ToLower(dest) == "stdout" {
-		file = os.Stdout
+		file, name = os.Stdout, os.Stdout.Name()
 	} else if dest == "/dev/stderr" || strings.ToLower(dest) == "stderr" {
-		file = os.Stderr
+		file, name = os.Stderr, os.Stderr.Name()
 	} else {
-		f, err := os.Create(dest)
+		f, err := logfile.NewWriter(dest, opts)
 		if err != nil {
 			return nil, err
 		}
-		file = f
+		file, name = f, f.Name()
+	}
+
+	if _, ok := file.(*logfile.Writer); !ok && opts != (logfile.Options{}) {
+		return nil, strongerrors.InvalidArgument(
+			errors.Errorf("compression and rotation are not supported for %s", dest))
 	}
 
 	return &FileWriter{
+		name:      name,
 		file:      file,
 		formatter: formatter,
 	}, nil
 }
 
 // FileName returns the name of file underlying this FileWriter.
-func (w *FileWriter) FileName() string { return w.file.Name() }
+func (w *FileWriter) FileName() string { return w.name }
+
+// SetFlushInterval sets the minimum interval of wall-clock time between flushes of the file, so
+// that a long simulation writing metrics every tick does not flush them every time.
+// The file is flushed on every write if 0 (default), and always on Close.
+func (w *FileWriter) SetFlushInterval(interval time.Duration) {
+	w.flushInterval = interval
+}
 
 // Write implements Writer interface.
 // Returns error if failed to format with the underlying formatter.
@@ -61,13 +89,30 @@ func (w *FileWriter) Write(metrics *Metrics) error {
 	if err != nil {
 		return err
 	}
-	_, err = w.file.WriteString(str)
-	if err != nil {
+	// Written at once, so that a rotated file is split only between metrics.
+	if _, err = w.file.Write([]byte(str + "\n")); err != nil {
 		return err
 	}
-	_, err = w.file.Write([]byte{'\n'})
 
-	return err
+	// Keep the file readable while the simulation is running.
+	if f, ok := w.file.(*logfile.Writer); ok {
+		now := time.Now()
+		if w.flushInterval > 0 && now.Sub(w.lastFlush) < w.flushInterval {
+			return nil
+		}
+		w.lastFlush = now
+		return f.Flush()
+	}
+
+	return nil
+}
+
+// Close closes the underlying file, unless it is an output device.
+func (w *FileWriter) Close() error {
+	if f, ok := w.file.(*logfile.Writer); ok {
+		return f.Close()
+	}
+	return nil
 }
 
 var _ = Writer(&FileWriter{})
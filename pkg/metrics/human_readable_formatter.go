@@ -17,9 +17,9 @@ package metrics
 import (
 	"fmt"
 
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/node"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/pod"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/queue"
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
 )
 
 // HumanReadableFormatter is a Foramtter that formats metrics in a human-readable style.
@@ -81,9 +81,11 @@ func validateMetrics(metrics *Metrics) error {
 func (h *HumanReadableFormatter) formatNodesMetrics(metrics map[string]node.Metrics) string {
 	str := ""
 
-	for name, met := range metrics {
+	for _, name := range sortedNodeNames(metrics) {
+		met := metrics[name]
 		str += fmt.Sprintf("    %s: Pods %d(%d)/%d", name, met.RunningPodsNum, met.TerminatingPodsNum, met.Allocatable.Pods().Value())
-		for rsrc, alloc := range met.Allocatable {
+		for _, rsrc := range sortedResourceNames(met.Allocatable) {
+			alloc := met.Allocatable[rsrc]
 			if rsrc == "pods" {
 				continue
 			}
@@ -108,11 +110,13 @@ func (h *HumanReadableFormatter) formatNodesMetrics(metrics map[string]node.Metr
 func (h *HumanReadableFormatter) formatPodsMetrics(metrics map[string]pod.Metrics) string {
 	str := ""
 
-	for name, met := range metrics {
+	for _, name := range sortedPodNames(metrics) {
+		met := metrics[name]
 		str += fmt.Sprintf("    %s: prio %d, bound at %s on %s, status %s, elapsed %d s",
 			name, met.Priority, met.BoundAt.ToRFC3339(), met.Node, met.Status, met.ExecutedSeconds)
 
-		for rsrc, req := range met.ResourceRequest {
+		for _, rsrc := range sortedResourceNames(met.ResourceRequest) {
+			req := met.ResourceRequest[rsrc]
 			lim := met.ResourceLimit[rsrc] // !ok -> usage == 0
 			usage := met.ResourceUsage[rsrc]
 
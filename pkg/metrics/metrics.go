@@ -15,11 +15,11 @@
 package metrics
 
 import (
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/clock"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/node"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/pod"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/queue"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/util"
+	"simulator/pkg/clock"
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+	"simulator/pkg/util"
 )
 
 // Metrics represents a metrics at one time point, in the following structure.
@@ -27,6 +27,12 @@ import (
 //   Metrics[NodesMetricsKey] = map from node name to node.Metrics
 //   Metrics[PodsMetricsKey] = map from pod name to pod.Metrics
 // 	 Metrics[QueueMetricsKey] = queue.Metrics
+//   Metrics[SchedulerMetricsKey] = scheduler.Metrics (only if the scheduler reports its metrics)
+//   Metrics[DeadlineMetricsKey] = DeadlineMetrics
+//   Metrics[BalanceMetricsKey] = BalanceMetrics
+//   Metrics[ActiveSchedulerKey] = name of the active scheduler (only if multiple are registered)
+//   Metrics[AutoscalerMetricsKey] = map from node group name to autoscaler.GroupMetrics (if enabled)
+//   Metrics[BackoffMetricsKey] = queue.BackoffMetrics (if the backoff is enabled)
 type Metrics map[string]interface{}
 
 const (
@@ -38,6 +44,18 @@ const (
 	PodsMetricsKey = "Pods"
 	// QueueMetricsKey is the key associated to a queue.Metrics.
 	QueueMetricsKey = "Queue"
+	// SchedulerMetricsKey is the key associated to a scheduler.Metrics.
+	SchedulerMetricsKey = "Scheduler"
+	// DeadlineMetricsKey is the key associated to a DeadlineMetrics.
+	DeadlineMetricsKey = "Deadline"
+	// BalanceMetricsKey is the key associated to a BalanceMetrics.
+	BalanceMetricsKey = "Balance"
+	// ActiveSchedulerKey is the key associated to the name of the active scheduler.
+	ActiveSchedulerKey = "ActiveScheduler"
+	// AutoscalerMetricsKey is the key associated to a map of autoscaler.GroupMetrics.
+	AutoscalerMetricsKey = "Autoscaler"
+	// BackoffMetricsKey is the key associated to a queue.BackoffMetrics.
+	BackoffMetricsKey = "Backoff"
 )
 
 // BuildMetrics builds a Metrics at the given clock.
@@ -79,3 +97,79 @@ type Writer interface {
 	// Write writes the given metrics to some location(s).
 	Write(metrics *Metrics) error
 }
+
+// EventKind is the kind of an Event.
+type EventKind string
+
+const (
+	// SubmitEvent is the submission of a pod by a submitter.
+	SubmitEvent EventKind = "Submit"
+	// DeleteEvent is the deletion of a pod by a submitter.
+	DeleteEvent EventKind = "Delete"
+	// UpdateEvent is the update of a pending pod by a submitter.
+	UpdateEvent EventKind = "Update"
+	// BindEvent is the binding of a pod to a node by the scheduler.
+	BindEvent EventKind = "Bind"
+	// EvictEvent is the deletion of a pod from a node by the scheduler (e.g., preemption).
+	EvictEvent EventKind = "Evict"
+	// PressureEvictEvent is the eviction of a pod by its node under resource pressure.
+	PressureEvictEvent EventKind = "PressureEvict"
+	// NodeEvictEvent is the eviction of a pod by the deletion of its node.
+	NodeEvictEvent EventKind = "NodeEvict"
+	// TaintEvictEvent is the eviction of a pod by the NoExecute taints of its node.
+	TaintEvictEvent EventKind = "TaintEvict"
+	// OOMKillEvent is the kill of a pod by the OOM killer, since it used more memory than its limit.
+	OOMKillEvent EventKind = "OOMKill"
+	// UnschedulableEvent is the first failure of the scheduler to schedule a pod since it was queued.
+	UnschedulableEvent EventKind = "Unschedulable"
+	// SchedulingFailedEvent is the failure of a pending pod that the scheduler failed to schedule
+	// more than the max retries of the backoff.
+	SchedulingFailedEvent EventKind = "SchedulingFailed"
+	// RejectEvent is the rejection of a submitted pod by the LimitRange or the ResourceQuota of its
+	// namespace, since its PriorityClass does not exist, or since its device resources are invalid,
+	// or of an update of a pod by the LimitRange.
+	RejectEvent EventKind = "Reject"
+	// CompleteEvent is the termination of a pod that finished its execution on its node.
+	CompleteEvent EventKind = "Complete"
+	// NodeAddEvent is the addition of a node to the cluster during the simulation.
+	NodeAddEvent EventKind = "NodeAdd"
+	// NodeDeleteEvent is the deletion of a node from the cluster during the simulation.
+	NodeDeleteEvent EventKind = "NodeDelete"
+	// NodeNotReadyEvent is the transition of a node to not ready.
+	NodeNotReadyEvent EventKind = "NodeNotReady"
+	// NodeReadyEvent is the transition of a node back to ready.
+	NodeReadyEvent EventKind = "NodeReady"
+	// NodeDegradeEvent is the change of the capacity of a node by its degradation or recovery.
+	NodeDegradeEvent EventKind = "NodeDegrade"
+)
+
+// Event represents an event of a pod or a node.
+type Event struct {
+	Clock string
+	Kind  EventKind
+	// Pod is the key of the pod (namespace/name), or empty for the events of nodes.
+	Pod string
+	// Node is the name of the node, or empty if unknown.
+	Node string
+}
+
+// IsNodeEvent returns whether this Event is an event of a node, not of a pod.
+func (e Event) IsNodeEvent() bool {
+	switch e.Kind {
+	case NodeAddEvent, NodeDeleteEvent, NodeNotReadyEvent, NodeReadyEvent, NodeDegradeEvent:
+		return true
+	}
+	return false
+}
+
+// EventWriter is an optional interface that a Writer can implement to also receive the events of
+// pods at every tick, not only at metrics ticks.
+type EventWriter interface {
+	// WriteEvents writes the given events to some location(s).
+	WriteEvents(events []Event) error
+}
+
+// EventHandler is a callback invoked with each event at the tick it happens, in the order of the
+// events, so that external code can react to them during the simulation.
+// Returning error stops the simulation.
+type EventHandler func(event Event) error
@@ -0,0 +1,318 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+)
+
+const (
+	// ParquetNodesFile is the name of the file of node metrics written by ParquetWriter.
+	ParquetNodesFile = "nodes.parquet"
+	// ParquetPodsFile is the name of the file of pod outcomes written by ParquetWriter.
+	ParquetPodsFile = "pods.parquet"
+
+	// unscheduledStatus is the status of a pod outcome of a pod deleted before being bound.
+	unscheduledStatus = "Unscheduled"
+)
+
+// NodeRow is a row of ParquetNodesFile, i.e., the metrics of a node at a metrics tick.
+// Resource amounts are in their base units (e.g., cores for cpu, and bytes for memory).
+type NodeRow struct {
+	Clock           int64              `parquet:"name=clock, type=TIMESTAMP_MILLIS"`
+	Node            string             `parquet:"name=node, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	RunningPods     int64              `parquet:"name=running_pods, type=INT64"`
+	TerminatingPods int64              `parquet:"name=terminating_pods, type=INT64"`
+	FailedPods      int64              `parquet:"name=failed_pods, type=INT64"`
+	Allocatable     map[string]float64 `parquet:"name=allocatable, type=MAP, keytype=UTF8, valuetype=DOUBLE"`
+	Request         map[string]float64 `parquet:"name=request, type=MAP, keytype=UTF8, valuetype=DOUBLE"`
+	Usage           map[string]float64 `parquet:"name=usage, type=MAP, keytype=UTF8, valuetype=DOUBLE"`
+}
+
+// PodRow is a row of ParquetPodsFile, i.e., the outcome of a pod.
+// A pod's row is written once it is no longer running or terminating at a metrics tick, or has been
+// deleted before being bound; the rows of the other pods are written at Close.
+type PodRow struct {
+	Pod         string `parquet:"name=pod, type=UTF8"`
+	Node        string `parquet:"name=node, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	Priority    int32  `parquet:"name=priority, type=INT32"`
+	Status      string `parquet:"name=status, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	SubmittedAt *int64 `parquet:"name=submitted_at, type=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+	BoundAt     *int64 `parquet:"name=bound_at, type=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+	DeletedAt   *int64 `parquet:"name=deleted_at, type=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+	// StartedAt is the clock at which the pod started its execution after the startup latency.
+	StartedAt *int64 `parquet:"name=started_at, type=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+	// LastSeen is the last metrics tick at which the pod was running or terminating.
+	LastSeen        *int64             `parquet:"name=last_seen, type=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+	ExecutedSeconds int32              `parquet:"name=executed_seconds, type=INT32"`
+	Request         map[string]float64 `parquet:"name=request, type=MAP, keytype=UTF8, valuetype=DOUBLE"`
+	Usage           map[string]float64 `parquet:"name=usage, type=MAP, keytype=UTF8, valuetype=DOUBLE"`
+}
+
+// ParquetWriter is a Writer that writes the metrics of nodes at every metrics tick, and the
+// outcomes of pods, to Parquet files in a directory (see NodeRow and PodRow).
+type ParquetWriter struct {
+	nodes *parquetFile
+	pods  *parquetFile
+
+	// outcomes of the pods not written yet
+	outcomes map[string]*PodRow
+	// running is the set of pods running or terminating at the last Write.
+	running map[string]bool
+}
+
+type parquetFile struct {
+	file   source.ParquetFile
+	writer *writer.ParquetWriter
+}
+
+// NewParquetWriter creates a new ParquetWriter writing ParquetNodesFile and ParquetPodsFile in the
+// directory.
+// The directory is created if it does not exist, and the files will be truncated if they exist.
+// Returns error if failed to create the files.
+func NewParquetWriter(dir string) (*ParquetWriter, error) {
+	if dir == "" {
+		return nil, strongerrors.InvalidArgument(errors.New("directory must not be empty"))
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	nodes, err := newParquetFile(filepath.Join(dir, ParquetNodesFile), new(NodeRow))
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := newParquetFile(filepath.Join(dir, ParquetPodsFile), new(PodRow))
+	if err != nil {
+		nodes.file.Close()
+		return nil, err
+	}
+
+	return &ParquetWriter{
+		nodes:    nodes,
+		pods:     pods,
+		outcomes: map[string]*PodRow{},
+		running:  map[string]bool{},
+	}, nil
+}
+
+func newParquetFile(path string, schema interface{}) (*parquetFile, error) {
+	file, err := local.NewLocalFileWriter(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := writer.NewParquetWriter(file, schema, 1)
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrapf(err, "error creating parquet writer of %s", path)
+	}
+	w.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	return &parquetFile{file: file, writer: w}, nil
+}
+
+func (f *parquetFile) close() error {
+	if err := f.writer.WriteStop(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+// Write implements Writer interface.
+// Returns error if the given metrics does not have valid structure, or failed to write.
+func (w *ParquetWriter) Write(metrics *Metrics) error {
+	if err := validateMetrics(metrics); err != nil {
+		return err
+	}
+
+	clk, err := parseClockMillis((*metrics)[ClockKey].(string))
+	if err != nil {
+		return err
+	}
+
+	nodesMet := (*metrics)[NodesMetricsKey].(map[string]node.Metrics)
+	names := make([]string, 0, len(nodesMet))
+	for name := range nodesMet {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		met := nodesMet[name]
+		row := &NodeRow{
+			Clock:           clk,
+			Node:            name,
+			RunningPods:     met.RunningPodsNum,
+			TerminatingPods: met.TerminatingPodsNum,
+			FailedPods:      met.FailedPodsNum,
+			Allocatable:     resourceValues(met.Allocatable),
+			Request:         resourceValues(met.TotalResourceRequest),
+			Usage:           resourceValues(met.TotalResourceUsage),
+		}
+		if err := w.nodes.writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	podsMet := (*metrics)[PodsMetricsKey].(map[string]pod.Metrics)
+	running := make(map[string]bool, len(podsMet))
+	for key, met := range podsMet {
+		outcome := w.outcome(key)
+		boundAt := met.BoundAt.ToMetaV1().UnixNano() / int64(time.Millisecond)
+		startedAt := met.StartedAt.ToMetaV1().UnixNano() / int64(time.Millisecond)
+		lastSeen := clk
+
+		outcome.Node = met.Node
+		outcome.Priority = met.Priority
+		outcome.Status = met.Status.String()
+		outcome.BoundAt = &boundAt
+		outcome.StartedAt = &startedAt
+		outcome.LastSeen = &lastSeen
+		outcome.ExecutedSeconds = met.ExecutedSeconds
+		outcome.Request = resourceValues(met.ResourceRequest)
+		outcome.Usage = resourceValues(met.ResourceUsage)
+
+		running[key] = true
+	}
+
+	// The pods no longer running have finished.
+	finished := []string{}
+	for key := range w.running {
+		if !running[key] {
+			finished = append(finished, key)
+		}
+	}
+	// So have the pods deleted before being bound.
+	for key, outcome := range w.outcomes {
+		if outcome.Status == unscheduledStatus {
+			finished = append(finished, key)
+		}
+	}
+	w.running = running
+
+	return w.writeOutcomes(finished)
+}
+
+// WriteEvents implements EventWriter interface.
+// The events fill the submission, binding, and deletion clocks of the pod outcomes.
+// Returns error if an event has an invalid clock.
+func (w *ParquetWriter) WriteEvents(events []Event) error {
+	for _, e := range events {
+		if e.IsNodeEvent() {
+			continue
+		}
+		clk, err := parseClockMillis(e.Clock)
+		if err != nil {
+			return err
+		}
+
+		outcome := w.outcome(e.Pod)
+		switch e.Kind {
+		case SubmitEvent:
+			outcome.SubmittedAt = &clk
+		case BindEvent:
+			outcome.BoundAt = &clk
+			outcome.Node = e.Node
+		case DeleteEvent, EvictEvent, PressureEvictEvent, NodeEvictEvent, TaintEvictEvent,
+			OOMKillEvent, SchedulingFailedEvent, RejectEvent:
+			outcome.DeletedAt = &clk
+			if outcome.BoundAt == nil {
+				outcome.Status = unscheduledStatus
+			}
+		}
+	}
+
+	return nil
+}
+
+// Close writes the outcomes of the remaining pods, and closes the files.
+func (w *ParquetWriter) Close() error {
+	keys := make([]string, 0, len(w.outcomes))
+	for key := range w.outcomes {
+		keys = append(keys, key)
+	}
+	err := w.writeOutcomes(keys)
+
+	if e := w.nodes.close(); err == nil {
+		err = e
+	}
+	if e := w.pods.close(); err == nil {
+		err = e
+	}
+
+	return err
+}
+
+func (w *ParquetWriter) outcome(key string) *PodRow {
+	outcome, ok := w.outcomes[key]
+	if !ok {
+		outcome = &PodRow{Pod: key}
+		w.outcomes[key] = outcome
+	}
+	return outcome
+}
+
+func (w *ParquetWriter) writeOutcomes(keys []string) error {
+	sort.Strings(keys)
+	for _, key := range keys {
+		outcome, ok := w.outcomes[key]
+		if !ok {
+			continue
+		}
+		if err := w.pods.writer.Write(outcome); err != nil {
+			return err
+		}
+		delete(w.outcomes, key)
+	}
+
+	return nil
+}
+
+func parseClockMillis(clk string) (int64, error) {
+	t, err := time.Parse(time.RFC3339, clk)
+	if err != nil {
+		return 0, strongerrors.InvalidArgument(errors.Errorf("invalid clock %q: %s", clk, err.Error()))
+	}
+	return t.UnixNano() / int64(time.Millisecond), nil
+}
+
+func resourceValues(resources v1.ResourceList) map[string]float64 {
+	values := make(map[string]float64, len(resources))
+	for rsrc, q := range resources {
+		values[string(rsrc)] = quantityValue(q)
+	}
+	return values
+}
+
+var _ = Writer(&ParquetWriter{})
+var _ = EventWriter(&ParquetWriter{})
@@ -0,0 +1,122 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+)
+
+func readParquet(t *testing.T, path string, rows interface{}, schema interface{}) {
+	file, err := local.NewLocalFileReader(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	r, err := reader.NewParquetReader(file, schema, 1)
+	assert.NoError(t, err)
+	defer r.ReadStop()
+
+	assert.NoError(t, r.Read(rows))
+}
+
+func TestParquetWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writer, err := NewParquetWriter(dir)
+	assert.NoError(t, err)
+
+	t0 := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	t1 := t0.Add(time.Minute)
+	millis := func(clk clock.Clock) int64 { return clk.ToMetaV1().UnixNano() / int64(time.Millisecond) }
+
+	nodesMet := map[string]node.Metrics{
+		"node-0": {
+			Allocatable:          v1.ResourceList{"cpu": resource.MustParse("4")},
+			TotalResourceRequest: v1.ResourceList{"cpu": resource.MustParse("500m")},
+			TotalResourceUsage:   v1.ResourceList{},
+		},
+	}
+
+	assert.NoError(t, writer.WriteEvents([]Event{
+		{Clock: t0.ToRFC3339(), Kind: SubmitEvent, Pod: "default/pod-0"},
+		{Clock: t0.ToRFC3339(), Kind: SubmitEvent, Pod: "default/pod-1"},
+		{Clock: t0.ToRFC3339(), Kind: BindEvent, Pod: "default/pod-0", Node: "node-0"},
+		{Clock: t0.ToRFC3339(), Kind: DeleteEvent, Pod: "default/pod-1"},
+	}))
+	assert.NoError(t, writer.Write(&Metrics{
+		ClockKey:        t0.ToRFC3339(),
+		NodesMetricsKey: nodesMet,
+		PodsMetricsKey: map[string]pod.Metrics{
+			"default/pod-0": {
+				ResourceRequest: v1.ResourceList{"cpu": resource.MustParse("500m")},
+				BoundAt:         t0,
+				StartedAt:       t0.Add(5 * time.Second),
+				Node:            "node-0",
+				ExecutedSeconds: 30,
+				Status:          pod.Ok,
+			},
+		},
+		QueueMetricsKey: queue.Metrics{},
+	}))
+	// pod-0 has finished.
+	assert.NoError(t, writer.Write(&Metrics{
+		ClockKey:        t1.ToRFC3339(),
+		NodesMetricsKey: nodesMet,
+		PodsMetricsKey:  map[string]pod.Metrics{},
+		QueueMetricsKey: queue.Metrics{},
+	}))
+	assert.NoError(t, writer.Close())
+
+	nodes := make([]NodeRow, 2)
+	readParquet(t, filepath.Join(dir, ParquetNodesFile), &nodes, new(NodeRow))
+	assert.Equal(t, millis(t0), nodes[0].Clock)
+	assert.Equal(t, millis(t1), nodes[1].Clock)
+	assert.Equal(t, "node-0", nodes[1].Node)
+	assert.Equal(t, 4.0, nodes[1].Allocatable["cpu"])
+	assert.Equal(t, 0.5, nodes[1].Request["cpu"])
+
+	pods := make([]PodRow, 2)
+	readParquet(t, filepath.Join(dir, ParquetPodsFile), &pods, new(PodRow))
+
+	assert.Equal(t, "default/pod-1", pods[0].Pod)
+	assert.Equal(t, "Unscheduled", pods[0].Status)
+	assert.Nil(t, pods[0].BoundAt)
+	assert.Equal(t, millis(t0), *pods[0].DeletedAt)
+
+	assert.Equal(t, "default/pod-0", pods[1].Pod)
+	assert.Equal(t, "Ok", pods[1].Status)
+	assert.Equal(t, "node-0", pods[1].Node)
+	assert.Equal(t, millis(t0), *pods[1].SubmittedAt)
+	assert.Equal(t, millis(t0)+5000, *pods[1].StartedAt)
+	assert.Equal(t, millis(t0), *pods[1].LastSeen)
+	assert.Equal(t, int32(30), pods[1].ExecutedSeconds)
+	assert.Equal(t, 0.5, pods[1].Request["cpu"])
+}
@@ -0,0 +1,294 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"database/sql"
+	"os"
+	"sort"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	// Registers the "sqlite3" driver.
+	_ "github.com/mattn/go-sqlite3"
+
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+)
+
+// sqliteSchema creates the tables of a results database.
+// Resource amounts are in their base units (e.g., cores for cpu, and bytes for memory).
+const sqliteSchema = `
+CREATE TABLE ticks (
+	clock            TEXT PRIMARY KEY,
+	pending_pods     INTEGER NOT NULL,
+	met_deadlines    INTEGER NOT NULL,
+	missed_deadlines INTEGER NOT NULL,
+	active_scheduler TEXT
+);
+CREATE TABLE nodes (
+	clock            TEXT NOT NULL,
+	node             TEXT NOT NULL,
+	running_pods     INTEGER NOT NULL,
+	terminating_pods INTEGER NOT NULL,
+	failed_pods      INTEGER NOT NULL,
+	PRIMARY KEY (clock, node)
+);
+CREATE TABLE node_resources (
+	clock       TEXT NOT NULL,
+	node        TEXT NOT NULL,
+	resource    TEXT NOT NULL,
+	allocatable REAL NOT NULL,
+	request     REAL NOT NULL,
+	usage       REAL NOT NULL,
+	PRIMARY KEY (clock, node, resource)
+);
+CREATE TABLE balance (
+	clock           TEXT NOT NULL,
+	resource        TEXT NOT NULL,
+	request_mean    REAL NOT NULL,
+	request_stddev  REAL NOT NULL,
+	request_cov     REAL NOT NULL,
+	usage_mean      REAL NOT NULL,
+	usage_stddev    REAL NOT NULL,
+	usage_cov       REAL NOT NULL,
+	usage_max       REAL NOT NULL,
+	saturated_nodes INTEGER NOT NULL,
+	PRIMARY KEY (clock, resource)
+);
+CREATE TABLE pods (
+	clock            TEXT NOT NULL,
+	pod              TEXT NOT NULL,
+	node             TEXT NOT NULL,
+	bound_at         TEXT NOT NULL,
+	started_at       TEXT NOT NULL,
+	executed_seconds INTEGER NOT NULL,
+	priority         INTEGER NOT NULL,
+	status           TEXT NOT NULL,
+	PRIMARY KEY (clock, pod)
+);
+CREATE TABLE pod_resources (
+	clock    TEXT NOT NULL,
+	pod      TEXT NOT NULL,
+	resource TEXT NOT NULL,
+	request  REAL NOT NULL,
+	"limit"  REAL NOT NULL,
+	usage    REAL NOT NULL,
+	PRIMARY KEY (clock, pod, resource)
+);
+CREATE TABLE events (
+	clock TEXT NOT NULL,
+	kind  TEXT NOT NULL,
+	pod   TEXT NOT NULL,
+	node  TEXT NOT NULL
+);
+CREATE INDEX events_pod ON events (pod);
+`
+
+// SQLiteWriter is a Writer that writes metrics and events to a SQLite database, so that the
+// results can be analyzed with SQL.
+// The database has the following tables, which can be joined on the clock, node, and pod columns.
+//
+//	ticks: the queue and deadline metrics at each tick
+//	nodes, node_resources: the metrics of each node at each tick
+//	balance: the balance of the utilization of each resource over the nodes at each tick
+//	pods, pod_resources: the metrics of each pod running or terminating at each tick
+//	events: the events of pods and nodes (see EventWriter)
+type SQLiteWriter struct {
+	db *sql.DB
+	// events buffered until the next Write
+	events []Event
+}
+
+// NewSQLiteWriter creates a new SQLiteWriter with a database file at the given path.
+// The file will be replaced if it exists.
+// Returns error if failed to create the database.
+func NewSQLiteWriter(path string) (*SQLiteWriter, error) {
+	if path == "" {
+		return nil, strongerrors.InvalidArgument(errors.New("database path must not be empty"))
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "error creating tables in %s", path)
+	}
+
+	return &SQLiteWriter{db: db}, nil
+}
+
+// Write implements Writer interface.
+// The metrics and the events buffered since the last Write are inserted in one transaction.
+// The metrics replace those written before at the same clock.
+// Returns error if the given metrics does not have valid structure, or failed to insert.
+func (w *SQLiteWriter) Write(metrics *Metrics) error {
+	if err := validateMetrics(metrics); err != nil {
+		return err
+	}
+
+	return w.transact(func(tx *sql.Tx) error {
+		if err := insertMetrics(tx, metrics); err != nil {
+			return err
+		}
+		return w.flushEvents(tx)
+	})
+}
+
+// WriteEvents implements EventWriter interface.
+// The events are buffered and inserted at the next Write or Close.
+func (w *SQLiteWriter) WriteEvents(events []Event) error {
+	w.events = append(w.events, events...)
+	return nil
+}
+
+// Close inserts the buffered events and closes the database.
+func (w *SQLiteWriter) Close() error {
+	if err := w.transact(w.flushEvents); err != nil {
+		w.db.Close()
+		return err
+	}
+	return w.db.Close()
+}
+
+func (w *SQLiteWriter) transact(f func(tx *sql.Tx) error) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := f(tx); err != nil {
+		tx.Rollback() // nolint
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (w *SQLiteWriter) flushEvents(tx *sql.Tx) error {
+	for _, e := range w.events {
+		if _, err := tx.Exec(`INSERT INTO events VALUES (?, ?, ?, ?)`,
+			e.Clock, e.Kind, e.Pod, e.Node); err != nil {
+			return err
+		}
+	}
+	w.events = nil
+
+	return nil
+}
+
+// metricsTables are the tables of the metrics at each tick, keyed by the clock.
+var metricsTables = []string{"ticks", "nodes", "node_resources", "balance", "pods", "pod_resources"}
+
+func insertMetrics(tx *sql.Tx, metrics *Metrics) error {
+	clk := (*metrics)[ClockKey].(string)
+
+	// The metrics written again at the same clock, e.g., at the end of a simulation or after
+	// resuming from a checkpoint, replace the earlier ones.
+	for _, table := range metricsTables {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE clock = ?`, clk); err != nil {
+			return err
+		}
+	}
+
+	queueMet := (*metrics)[QueueMetricsKey].(queue.Metrics)
+	deadlineMet, _ := (*metrics)[DeadlineMetricsKey].(DeadlineMetrics)
+	var activeScheduler interface{} // NULL unless multiple schedulers are registered
+	if name, ok := (*metrics)[ActiveSchedulerKey].(string); ok {
+		activeScheduler = name
+	}
+	if _, err := tx.Exec(`INSERT INTO ticks VALUES (?, ?, ?, ?, ?)`,
+		clk, queueMet.PendingPodsNum, deadlineMet.MetDeadlines, deadlineMet.MissedDeadlines,
+		activeScheduler); err != nil {
+		return err
+	}
+
+	nodesMet := (*metrics)[NodesMetricsKey].(map[string]node.Metrics)
+	for _, name := range sortedNodeNames(nodesMet) {
+		met := nodesMet[name]
+		if _, err := tx.Exec(`INSERT INTO nodes VALUES (?, ?, ?, ?, ?)`,
+			clk, name, met.RunningPodsNum, met.TerminatingPodsNum, met.FailedPodsNum); err != nil {
+			return err
+		}
+
+		for _, rsrc := range sortedResourceNames(met.Allocatable) {
+			alloc := met.Allocatable[rsrc]
+			req := met.TotalResourceRequest[rsrc]
+			usage := met.TotalResourceUsage[rsrc]
+			if _, err := tx.Exec(`INSERT INTO node_resources VALUES (?, ?, ?, ?, ?, ?)`,
+				clk, name, string(rsrc),
+				quantityValue(alloc), quantityValue(req), quantityValue(usage)); err != nil {
+				return err
+			}
+		}
+	}
+
+	balance, _ := (*metrics)[BalanceMetricsKey].(BalanceMetrics)
+	rsrcs := make([]v1.ResourceName, 0, len(balance))
+	for rsrc := range balance {
+		rsrcs = append(rsrcs, rsrc)
+	}
+	sort.Slice(rsrcs, func(i, j int) bool { return rsrcs[i] < rsrcs[j] })
+	for _, rsrc := range rsrcs {
+		b := balance[rsrc]
+		if _, err := tx.Exec(`INSERT INTO balance VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			clk, string(rsrc), b.Request.Mean, b.Request.StdDev, b.Request.CoV,
+			b.Usage.Mean, b.Usage.StdDev, b.Usage.CoV, b.Usage.Max, len(b.SaturatedNodes)); err != nil {
+			return err
+		}
+	}
+
+	podsMet := (*metrics)[PodsMetricsKey].(map[string]pod.Metrics)
+	for _, key := range sortedPodNames(podsMet) {
+		met := podsMet[key]
+		if _, err := tx.Exec(`INSERT INTO pods VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			clk, key, met.Node, met.BoundAt.ToRFC3339(), met.StartedAt.ToRFC3339(), met.ExecutedSeconds,
+			met.Priority, met.Status.String()); err != nil {
+			return err
+		}
+
+		for _, rsrc := range sortedResourceNames(met.ResourceRequest) {
+			req := met.ResourceRequest[rsrc]
+			lim := met.ResourceLimit[rsrc] // !ok -> lim == 0
+			usage := met.ResourceUsage[rsrc]
+			if _, err := tx.Exec(`INSERT INTO pod_resources VALUES (?, ?, ?, ?, ?, ?)`,
+				clk, key, string(rsrc),
+				quantityValue(req), quantityValue(lim), quantityValue(usage)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// quantityValue returns the amount of the quantity in its base unit, keeping milli precision.
+func quantityValue(q resource.Quantity) float64 {
+	return float64(q.MilliValue()) / 1000
+}
+
+var _ = Writer(&SQLiteWriter{})
+var _ = EventWriter(&SQLiteWriter{})
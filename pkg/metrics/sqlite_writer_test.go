@@ -0,0 +1,127 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+)
+
+func TestSQLiteWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "results.db")
+
+	writer, err := NewSQLiteWriter(path)
+	assert.NoError(t, err)
+
+	clk := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	met := Metrics{
+		ClockKey: clk.ToRFC3339(),
+		NodesMetricsKey: map[string]node.Metrics{
+			"node-0": {
+				Allocatable: v1.ResourceList{
+					"cpu":    resource.MustParse("4"),
+					"memory": resource.MustParse("1Gi"),
+				},
+				RunningPodsNum:       1,
+				TotalResourceRequest: v1.ResourceList{"cpu": resource.MustParse("500m")},
+				TotalResourceUsage:   v1.ResourceList{"cpu": resource.MustParse("250m")},
+			},
+		},
+		PodsMetricsKey: map[string]pod.Metrics{
+			"default/pod-0": {
+				ResourceRequest: v1.ResourceList{"cpu": resource.MustParse("500m")},
+				ResourceUsage:   v1.ResourceList{"cpu": resource.MustParse("250m")},
+				BoundAt:         clk,
+				Node:            "node-0",
+				Status:          pod.Ok,
+			},
+		},
+		QueueMetricsKey:    queue.Metrics{PendingPodsNum: 2},
+		DeadlineMetricsKey: DeadlineMetrics{MetDeadlines: 3, MissedDeadlines: 1},
+		BalanceMetricsKey: BalanceMetrics{"cpu": {
+			Usage:          UtilizationStats{Mean: 0.5, StdDev: 0.25, CoV: 0.5, Max: 0.95},
+			SaturatedNodes: []string{"node-0"},
+		}},
+	}
+
+	assert.NoError(t, writer.WriteEvents([]Event{
+		{Clock: clk.ToRFC3339(), Kind: BindEvent, Pod: "default/pod-0", Node: "node-0"},
+	}))
+	assert.NoError(t, writer.Write(&met))
+	assert.NoError(t, writer.WriteEvents([]Event{
+		{Clock: clk.ToRFC3339(), Kind: DeleteEvent, Pod: "default/pod-0", Node: "node-0"},
+	}))
+	// Written again at the same clock, e.g., at the end of the simulation.
+	assert.NoError(t, writer.Write(&met))
+	assert.NoError(t, writer.Close())
+
+	db, err := sql.Open("sqlite3", path)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	var ticks, pods int
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM ticks`).Scan(&ticks))
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM pods`).Scan(&pods))
+	assert.Equal(t, 1, ticks)
+	assert.Equal(t, 1, pods)
+
+	var pending, missed int
+	var activeScheduler sql.NullString
+	assert.NoError(t, db.QueryRow(
+		`SELECT pending_pods, missed_deadlines, active_scheduler FROM ticks`).Scan(
+		&pending, &missed, &activeScheduler))
+	assert.Equal(t, 2, pending)
+	assert.Equal(t, 1, missed)
+	assert.False(t, activeScheduler.Valid)
+
+	var alloc, usage float64
+	assert.NoError(t, db.QueryRow(
+		`SELECT allocatable, usage FROM node_resources WHERE node = 'node-0' AND resource = 'cpu'`).Scan(
+		&alloc, &usage))
+	assert.Equal(t, 4.0, alloc)
+	assert.Equal(t, 0.25, usage)
+
+	var cov float64
+	var saturated int
+	assert.NoError(t, db.QueryRow(
+		`SELECT usage_cov, saturated_nodes FROM balance WHERE resource = 'cpu'`).Scan(&cov, &saturated))
+	assert.Equal(t, 0.5, cov)
+	assert.Equal(t, 1, saturated)
+
+	// Pods can be joined with their events.
+	var status string
+	var events int
+	assert.NoError(t, db.QueryRow(`
+		SELECT pods.status, COUNT(*) FROM pods JOIN events ON pods.pod = events.pod
+		GROUP BY pods.pod`).Scan(&status, &events))
+	assert.Equal(t, "Ok", status)
+	assert.Equal(t, 2, events)
+}
@@ -0,0 +1,402 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+
+	"simulator/pkg/node"
+)
+
+// Summary is the report of the simulation written by SummaryWriter at its end.
+// Clocks are in RFC3339 format.
+type Summary struct {
+	// Start and End are the first and the last clocks of the metrics and the events.
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// MakespanSeconds is the duration from the first submission of a pod to the last completion, or
+	// 0 if no pods completed.
+	MakespanSeconds float64     `json:"makespanSeconds"`
+	Pods            PodsSummary `json:"pods"`
+	// QueueingDelay is the distribution of the durations from the submission of a pod, or its last
+	// eviction, to its binding.
+	QueueingDelay DelaySummary `json:"queueingDelay"`
+	// Preemptions is the number of pods evicted by the scheduler to preempt them.
+	Preemptions int `json:"preemptions"`
+	// Evictions maps PressureEvictEvent, NodeEvictEvent, and TaintEvictEvent to the number of the
+	// pods evicted by them.
+	Evictions map[EventKind]int `json:"evictions"`
+	// Nodes are the utilization of the nodes over time, sorted by their names.
+	Nodes []NodeSummary `json:"nodes"`
+}
+
+// PodsSummary is the numbers of pods by their outcomes.
+type PodsSummary struct {
+	Submitted int `json:"submitted"`
+	// Scheduled is the number of the submitted pods bound to nodes.
+	Scheduled int `json:"scheduled"`
+	Completed int `json:"completed"`
+	// Failed is the number of the pods given up by the backoff (see SchedulingFailedEvent).
+	Failed int `json:"failed"`
+	// Rejected is the number of the submissions and the updates of the pods rejected (see
+	// RejectEvent).
+	Rejected int `json:"rejected"`
+	// Deleted is the number of the pods deleted by the submitters.
+	Deleted int `json:"deleted"`
+	// OOMKilled is the number of the pods killed by the OOM killer (see OOMKillEvent).
+	OOMKilled int `json:"oomKilled"`
+	// Pending is the number of the submitted pods neither bound, failed, rejected, nor deleted at
+	// the end.
+	Pending int `json:"pending"`
+}
+
+// DelaySummary is the distribution of durations, in seconds.
+type DelaySummary struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+// NodeSummary is the utilization of a node over time.
+type NodeSummary struct {
+	Node string `json:"node"`
+	// MeanRequest and MeanUsage are the fractions of the allocatable amount of each resource
+	// requested and used by the pods on the node, averaged over the metrics ticks, and PeakUsage is
+	// their maximum.
+	MeanRequest map[string]float64 `json:"meanRequest"`
+	MeanUsage   map[string]float64 `json:"meanUsage"`
+	PeakUsage   map[string]float64 `json:"peakUsage"`
+	// Samples are the fractions at each metrics tick.
+	Samples []UtilizationSample `json:"samples"`
+}
+
+// UtilizationSample is the fractions of the allocatable amount of each resource requested and used
+// at a metrics tick.
+type UtilizationSample struct {
+	Clock   string             `json:"clock"`
+	Request map[string]float64 `json:"request"`
+	Usage   map[string]float64 `json:"usage"`
+}
+
+// SummaryWriter is a Writer that builds the Summary of the simulation from the events of pods and
+// the metrics, and writes it to a JSON file, and optionally to a file in a human-readable table,
+// at Close, i.e., when the simulation finishes or its context is done.
+type SummaryWriter struct {
+	file      *os.File
+	tableFile *os.File
+
+	summary Summary
+	nodes   map[string]*NodeSummary
+	// pending is the set of the submitted pods not bound, failed, nor deleted yet.
+	pending map[string]bool
+	// queuedAt maps the key of each pod waiting to be bound to the clock since which it waits.
+	queuedAt     map[string]time.Time
+	delays       []float64
+	firstSubmit  *time.Time
+	lastComplete *time.Time
+}
+
+// NewSummaryWriter creates a new SummaryWriter with a file at the given path, and a file of the
+// table at tablePath unless empty.
+// The files will be truncated if they exist.
+// Returns error if failed to create the files.
+func NewSummaryWriter(path, tablePath string) (*SummaryWriter, error) {
+	if path == "" {
+		return nil, strongerrors.InvalidArgument(errors.New("summary path must not be empty"))
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	var tableFile *os.File
+	if tablePath != "" {
+		if tableFile, err = os.Create(tablePath); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	return &SummaryWriter{
+		file:      file,
+		tableFile: tableFile,
+		summary:   Summary{Evictions: map[EventKind]int{}},
+		nodes:     map[string]*NodeSummary{},
+		pending:   map[string]bool{},
+		queuedAt:  map[string]time.Time{},
+	}, nil
+}
+
+// Write implements Writer interface.
+// Returns error if the given metrics does not have valid structure.
+func (w *SummaryWriter) Write(metrics *Metrics) error {
+	if err := validateMetrics(metrics); err != nil {
+		return err
+	}
+
+	clk := (*metrics)[ClockKey].(string)
+	w.observe(clk)
+
+	for name, met := range (*metrics)[NodesMetricsKey].(map[string]node.Metrics) {
+		ns, ok := w.nodes[name]
+		if !ok {
+			ns = &NodeSummary{Node: name, Samples: []UtilizationSample{}}
+			w.nodes[name] = ns
+		}
+		ns.Samples = append(ns.Samples, UtilizationSample{
+			Clock:   clk,
+			Request: resourceFractions(met.TotalResourceRequest, met.Allocatable),
+			Usage:   resourceFractions(met.TotalResourceUsage, met.Allocatable),
+		})
+	}
+
+	return nil
+}
+
+// WriteEvents implements EventWriter interface.
+// Returns error if the clock of an event is invalid.
+func (w *SummaryWriter) WriteEvents(events []Event) error {
+	for _, e := range events {
+		w.observe(e.Clock)
+		if e.IsNodeEvent() {
+			continue
+		}
+
+		clk, err := time.Parse(time.RFC3339, e.Clock)
+		if err != nil {
+			return strongerrors.InvalidArgument(
+				errors.Errorf("invalid clock %q of event: %s", e.Clock, err.Error()))
+		}
+
+		switch e.Kind {
+		case SubmitEvent:
+			w.summary.Pods.Submitted++
+			w.pending[e.Pod] = true
+			w.queuedAt[e.Pod] = clk
+			if w.firstSubmit == nil {
+				w.firstSubmit = &clk
+			}
+		case BindEvent:
+			if w.pending[e.Pod] {
+				w.summary.Pods.Scheduled++
+				delete(w.pending, e.Pod)
+			}
+			if queued, ok := w.queuedAt[e.Pod]; ok {
+				w.delays = append(w.delays, clk.Sub(queued).Seconds())
+				delete(w.queuedAt, e.Pod)
+			}
+		case CompleteEvent:
+			w.summary.Pods.Completed++
+			w.lastComplete = &clk
+		case SchedulingFailedEvent:
+			w.summary.Pods.Failed++
+			delete(w.pending, e.Pod)
+			delete(w.queuedAt, e.Pod)
+		case RejectEvent:
+			w.summary.Pods.Rejected++
+			delete(w.pending, e.Pod)
+			delete(w.queuedAt, e.Pod)
+		case DeleteEvent:
+			w.summary.Pods.Deleted++
+			delete(w.pending, e.Pod)
+			delete(w.queuedAt, e.Pod)
+		case OOMKillEvent:
+			w.summary.Pods.OOMKilled++
+		case EvictEvent:
+			w.summary.Preemptions++
+			w.queuedAt[e.Pod] = clk
+		case PressureEvictEvent, NodeEvictEvent, TaintEvictEvent:
+			w.summary.Evictions[e.Kind]++
+			w.queuedAt[e.Pod] = clk
+		}
+	}
+
+	return nil
+}
+
+// Summary returns the Summary of the metrics and the events written so far.
+func (w *SummaryWriter) Summary() Summary {
+	summary := w.summary
+	summary.Evictions = make(map[EventKind]int, len(w.summary.Evictions))
+	for kind, n := range w.summary.Evictions {
+		summary.Evictions[kind] = n
+	}
+
+	summary.Pods.Pending = len(w.pending)
+	if w.firstSubmit != nil && w.lastComplete != nil {
+		summary.MakespanSeconds = w.lastComplete.Sub(*w.firstSubmit).Seconds()
+	}
+	summary.QueueingDelay = summarizeDelays(w.delays)
+
+	summary.Nodes = make([]NodeSummary, 0, len(w.nodes))
+	for _, ns := range w.nodes {
+		summary.Nodes = append(summary.Nodes, summarizeNode(ns))
+	}
+	sort.Slice(summary.Nodes, func(i, j int) bool {
+		return summary.Nodes[i].Node < summary.Nodes[j].Node
+	})
+
+	return summary
+}
+
+// Close writes the Summary to the files, and closes them.
+func (w *SummaryWriter) Close() error {
+	summary := w.Summary()
+
+	if w.tableFile != nil {
+		if _, err := w.tableFile.WriteString(summary.Table()); err != nil {
+			w.tableFile.Close()
+			w.file.Close()
+			return err
+		}
+		if err := w.tableFile.Close(); err != nil {
+			w.file.Close()
+			return err
+		}
+	}
+
+	if err := json.NewEncoder(w.file).Encode(&summary); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// observe extends the range of the Summary to the clock.
+func (w *SummaryWriter) observe(clk string) {
+	if w.summary.Start == "" {
+		w.summary.Start = clk
+	}
+	w.summary.End = clk
+}
+
+// summarizeDelays returns the distribution of the delays, with the nearest-rank percentiles.
+func summarizeDelays(delays []float64) DelaySummary {
+	if len(delays) == 0 {
+		return DelaySummary{}
+	}
+
+	sorted := append([]float64{}, delays...)
+	sort.Float64s(sorted)
+	sum := 0.0
+	for _, d := range sorted {
+		sum += d
+	}
+	percentile := func(p float64) float64 {
+		return sorted[int(math.Ceil(p*float64(len(sorted))))-1]
+	}
+
+	return DelaySummary{
+		Count: len(sorted),
+		Mean:  sum / float64(len(sorted)),
+		P95:   percentile(0.95),
+		P99:   percentile(0.99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+// summarizeNode returns the NodeSummary with the means and the peaks of its samples.
+func summarizeNode(ns *NodeSummary) NodeSummary {
+	summary := NodeSummary{
+		Node:        ns.Node,
+		MeanRequest: map[string]float64{},
+		MeanUsage:   map[string]float64{},
+		PeakUsage:   map[string]float64{},
+		Samples:     ns.Samples,
+	}
+
+	for _, s := range ns.Samples {
+		for rsrc, f := range s.Request {
+			summary.MeanRequest[rsrc] += f / float64(len(ns.Samples))
+		}
+		for rsrc, f := range s.Usage {
+			summary.MeanUsage[rsrc] += f / float64(len(ns.Samples))
+			summary.PeakUsage[rsrc] = math.Max(summary.PeakUsage[rsrc], f)
+		}
+	}
+
+	return summary
+}
+
+// Table formats this Summary in a human-readable table, without the samples of the nodes.
+func (s *Summary) Table() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Simulation %s - %s, makespan %.0fs\n\n", s.Start, s.End, s.MakespanSeconds)
+
+	b.WriteString("Submitted Scheduled Completed Failed   Rejected Deleted  OOMKilled Pending \n")
+	b.WriteString("----------------------------------------------------------------------------\n")
+	fmt.Fprintf(&b, "%-9d %-9d %-9d %-8d %-8d %-8d %-9d %-8d\n\n", s.Pods.Submitted, s.Pods.Scheduled,
+		s.Pods.Completed, s.Pods.Failed, s.Pods.Rejected, s.Pods.Deleted, s.Pods.OOMKilled,
+		s.Pods.Pending)
+
+	d := s.QueueingDelay
+	b.WriteString("Queueing delay (s) Count    Mean     P95      P99      Max     \n")
+	b.WriteString("----------------------------------------------------------------\n")
+	fmt.Fprintf(&b, "                   %-8d %-8.1f %-8.1f %-8.1f %-8.1f\n\n", d.Count, d.Mean, d.P95, d.P99, d.Max)
+
+	b.WriteString("Preemptions PressureEvict NodeEvict TaintEvict \n")
+	b.WriteString("-----------------------------------------------\n")
+	fmt.Fprintf(&b, "%-11d %-13d %-9d %-10d\n\n", s.Preemptions, s.Evictions[PressureEvictEvent],
+		s.Evictions[NodeEvictEvent], s.Evictions[TaintEvictEvent])
+
+	rsrcSet := map[string]bool{}
+	for _, ns := range s.Nodes {
+		for rsrc := range ns.MeanRequest {
+			rsrcSet[rsrc] = true
+		}
+	}
+	rsrcs := make([]string, 0, len(rsrcSet))
+	for rsrc := range rsrcSet {
+		rsrcs = append(rsrcs, rsrc)
+	}
+	sort.Strings(rsrcs)
+
+	b.WriteString("Node             ")
+	line := ""
+	for _, rsrc := range rsrcs {
+		fmt.Fprintf(&b, "%-27s ", rsrc+" (%)")
+		line += "----------------------------"
+	}
+	b.WriteString("\n                 ")
+	for range rsrcs {
+		b.WriteString("Request  Usage    PeakUsage ")
+	}
+	b.WriteString("\n-----------------" + line + "\n")
+	for _, ns := range s.Nodes {
+		fmt.Fprintf(&b, "%-16s ", ns.Node)
+		for _, rsrc := range rsrcs {
+			fmt.Fprintf(&b, "%-8.1f %-8.1f %-9.1f ",
+				100*ns.MeanRequest[rsrc], 100*ns.MeanUsage[rsrc], 100*ns.PeakUsage[rsrc])
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+var _ = Writer(&SummaryWriter{})
+var _ = EventWriter(&SummaryWriter{})
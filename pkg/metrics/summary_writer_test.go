@@ -0,0 +1,123 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+)
+
+func TestSummaryWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "summary.json")
+	tablePath := filepath.Join(dir, "summary.txt")
+	writer, err := NewSummaryWriter(path, tablePath)
+	assert.NoError(t, err)
+
+	t0 := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	at := func(seconds int) string { return t0.Add(time.Duration(seconds) * time.Second).ToRFC3339() }
+	nodeMetrics := func(request, usage string) map[string]node.Metrics {
+		return map[string]node.Metrics{"node-0": {
+			Allocatable:          v1.ResourceList{"cpu": resource.MustParse("4")},
+			TotalResourceRequest: v1.ResourceList{"cpu": resource.MustParse(request)},
+			TotalResourceUsage:   v1.ResourceList{"cpu": resource.MustParse(usage)},
+		}}
+	}
+
+	// pod-1 is preempted and bound again, pod-3 is deleted, and pod-4 is still queued at the end.
+	assert.NoError(t, writer.WriteEvents([]Event{
+		{Clock: at(0), Kind: SubmitEvent, Pod: "default/pod-0"},
+		{Clock: at(0), Kind: SubmitEvent, Pod: "default/pod-1"},
+		{Clock: at(0), Kind: SubmitEvent, Pod: "default/pod-2"},
+		{Clock: at(0), Kind: SubmitEvent, Pod: "default/pod-3"},
+		{Clock: at(10), Kind: BindEvent, Pod: "default/pod-0", Node: "node-0"},
+		{Clock: at(10), Kind: BindEvent, Pod: "default/pod-1", Node: "node-0"},
+	}))
+	assert.NoError(t, writer.Write(&Metrics{
+		ClockKey:        at(10),
+		NodesMetricsKey: nodeMetrics("2", "1"),
+		PodsMetricsKey:  map[string]pod.Metrics{},
+		QueueMetricsKey: queue.Metrics{},
+	}))
+	assert.NoError(t, writer.WriteEvents([]Event{
+		{Clock: at(20), Kind: DeleteEvent, Pod: "default/pod-3"},
+		{Clock: at(30), Kind: EvictEvent, Pod: "default/pod-1", Node: "node-0"},
+		{Clock: at(30), Kind: BindEvent, Pod: "default/pod-2", Node: "node-0"},
+		{Clock: at(40), Kind: BindEvent, Pod: "default/pod-1", Node: "node-0"},
+		{Clock: at(40), Kind: NodeAddEvent, Node: "node-1"},
+		{Clock: at(50), Kind: SubmitEvent, Pod: "default/pod-4"},
+	}))
+	assert.NoError(t, writer.Write(&Metrics{
+		ClockKey:        at(60),
+		NodesMetricsKey: nodeMetrics("4", "3"),
+		PodsMetricsKey:  map[string]pod.Metrics{},
+		QueueMetricsKey: queue.Metrics{},
+	}))
+	assert.NoError(t, writer.WriteEvents([]Event{
+		{Clock: at(70), Kind: CompleteEvent, Pod: "default/pod-0", Node: "node-0"},
+		{Clock: at(80), Kind: TaintEvictEvent, Pod: "default/pod-2", Node: "node-0"},
+	}))
+	assert.NoError(t, writer.Close())
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	summary := Summary{}
+	assert.NoError(t, json.Unmarshal(data, &summary))
+
+	assert.Equal(t, at(0), summary.Start)
+	assert.Equal(t, at(80), summary.End)
+	assert.Equal(t, 70.0, summary.MakespanSeconds)
+	assert.Equal(t, PodsSummary{Submitted: 5, Scheduled: 3, Completed: 1, Deleted: 1, Pending: 1}, summary.Pods)
+	assert.Equal(t, DelaySummary{Count: 4, Mean: 15, P95: 30, P99: 30, Max: 30}, summary.QueueingDelay)
+	assert.Equal(t, 1, summary.Preemptions)
+	assert.Equal(t, map[EventKind]int{TaintEvictEvent: 1}, summary.Evictions)
+
+	assert.Len(t, summary.Nodes, 1)
+	ns := summary.Nodes[0]
+	assert.Equal(t, "node-0", ns.Node)
+	assert.Equal(t, map[string]float64{"cpu": 0.75}, ns.MeanRequest)
+	assert.Equal(t, map[string]float64{"cpu": 0.5}, ns.MeanUsage)
+	assert.Equal(t, map[string]float64{"cpu": 0.75}, ns.PeakUsage)
+	assert.Equal(t, []UtilizationSample{
+		{Clock: at(10), Request: map[string]float64{"cpu": 0.5}, Usage: map[string]float64{"cpu": 0.25}},
+		{Clock: at(60), Request: map[string]float64{"cpu": 1}, Usage: map[string]float64{"cpu": 0.75}},
+	}, ns.Samples)
+
+	table, err := ioutil.ReadFile(tablePath)
+	assert.NoError(t, err)
+	assert.Equal(t, summary.Table(), string(table))
+	assert.True(t, strings.Contains(string(table), "makespan 70s"))
+	assert.True(t, strings.Contains(string(table), "node-0           75.0     50.0     75.0"))
+
+	_, err = NewSummaryWriter("", "")
+	assert.EqualError(t, err, "summary path must not be empty")
+}
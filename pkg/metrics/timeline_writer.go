@@ -0,0 +1,309 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+)
+
+// Timeline is the dataset written by TimelineWriter, for rendering the pods in Gantt charts and
+// the nodes in utilization heatmaps.
+// Clocks are in RFC3339 format.
+type Timeline struct {
+	// Start and End are the first and the last clocks of the metrics and the events.
+	Start string         `json:"start"`
+	End   string         `json:"end"`
+	Pods  []PodTimeline  `json:"pods"`
+	Nodes []NodeTimeline `json:"nodes"`
+}
+
+// PodState is the state of a pod in an interval of its timeline.
+type PodState string
+
+const (
+	// QueuedState is from the submission of a pod to its binding (or deletion).
+	QueuedState PodState = "Queued"
+	// BoundState is from the binding to the start of the execution after the startup latency.
+	BoundState PodState = "Bound"
+	// RunningState is from the start of the execution to the completion or the deletion.
+	RunningState PodState = "Running"
+	// TerminatingState is from the deletion (or eviction) of a bound pod to the end of its grace
+	// period.
+	TerminatingState PodState = "Terminating"
+)
+
+// PodTimeline is the timeline of a pod, sorted by the keys of pods in Timeline.
+type PodTimeline struct {
+	Pod string `json:"pod"`
+	// Node is the node to which the pod was bound last, or empty if never bound.
+	Node     string `json:"node"`
+	Priority int32  `json:"priority"`
+	// Status is the status of the pod at the last metrics tick at which it was observed,
+	// Unscheduled if it was deleted before being bound, or Pending if it was still queued at the
+	// end.
+	Status string `json:"status"`
+	// Intervals are the consecutive states of the pod, in the order of time.
+	// A pod resubmitted with the same name after its termination starts again from QueuedState.
+	Intervals []PodInterval `json:"intervals"`
+}
+
+// PodInterval is an interval in which a pod is in the state.
+type PodInterval struct {
+	State PodState `json:"state"`
+	Start string   `json:"start"`
+	// End is empty if the pod was still in the state at the end.
+	End string `json:"end,omitempty"`
+	// Node is the node of the pod in the states other than QueuedState.
+	Node string `json:"node,omitempty"`
+}
+
+// NodeTimeline is the occupancy of a node over time, sorted by the names of nodes in Timeline.
+type NodeTimeline struct {
+	Node string `json:"node"`
+	// Allocatable is the allocatable amount of each resource at the last metrics tick, in its base
+	// unit (e.g., cores for cpu, and bytes for memory).
+	Allocatable map[string]float64 `json:"allocatable"`
+	Samples     []NodeSample       `json:"samples"`
+}
+
+// NodeSample is the occupancy of a node at a metrics tick.
+type NodeSample struct {
+	Clock string `json:"clock"`
+	// Pods is the number of running pods, and TerminatingPods is the number of terminating ones.
+	Pods            int64 `json:"pods"`
+	TerminatingPods int64 `json:"terminatingPods"`
+	// Request and Usage are the fractions of the allocatable amount of each resource requested and
+	// used by the pods on the node.
+	Request map[string]float64 `json:"request"`
+	Usage   map[string]float64 `json:"usage"`
+}
+
+// TimelineWriter is a Writer that builds the Timeline of the simulation from the events of pods and
+// the metrics, and writes it to a JSON file at Close.
+// The transitions by events (submission, binding, and deletion) have the exact clocks, and so does
+// the start of the execution; the completion of a pod and the end of its grace period are observed
+// at the first metrics tick at which it is no longer running or terminating.
+type TimelineWriter struct {
+	file *os.File
+
+	timeline Timeline
+	pods     map[string]*podTimeline
+	nodes    map[string]*NodeTimeline
+}
+
+// podTimeline is a PodTimeline being built, with its current interval.
+type podTimeline struct {
+	PodTimeline
+	current *PodInterval
+}
+
+// NewTimelineWriter creates a new TimelineWriter with a file at the given path.
+// The file will be truncated if it exists.
+// Returns error if failed to create the file.
+func NewTimelineWriter(path string) (*TimelineWriter, error) {
+	if path == "" {
+		return nil, strongerrors.InvalidArgument(errors.New("timeline path must not be empty"))
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TimelineWriter{
+		file:  file,
+		pods:  map[string]*podTimeline{},
+		nodes: map[string]*NodeTimeline{},
+	}, nil
+}
+
+// Write implements Writer interface.
+// Returns error if the given metrics does not have valid structure.
+func (w *TimelineWriter) Write(metrics *Metrics) error {
+	if err := validateMetrics(metrics); err != nil {
+		return err
+	}
+
+	clkStr := (*metrics)[ClockKey].(string)
+	t, err := time.Parse(time.RFC3339, clkStr)
+	if err != nil {
+		return strongerrors.InvalidArgument(errors.Errorf("invalid clock %q: %s", clkStr, err.Error()))
+	}
+	clk := clock.NewClock(t)
+	w.observe(clkStr)
+
+	for name, met := range (*metrics)[NodesMetricsKey].(map[string]node.Metrics) {
+		nt, ok := w.nodes[name]
+		if !ok {
+			nt = &NodeTimeline{Node: name, Samples: []NodeSample{}}
+			w.nodes[name] = nt
+		}
+		nt.Allocatable = resourceValues(met.Allocatable)
+		nt.Samples = append(nt.Samples, NodeSample{
+			Clock:           clkStr,
+			Pods:            met.RunningPodsNum,
+			TerminatingPods: met.TerminatingPodsNum,
+			Request:         resourceFractions(met.TotalResourceRequest, met.Allocatable),
+			Usage:           resourceFractions(met.TotalResourceUsage, met.Allocatable),
+		})
+	}
+
+	podsMet := (*metrics)[PodsMetricsKey].(map[string]pod.Metrics)
+	for key, met := range podsMet {
+		pt := w.pod(key)
+		pt.Priority = met.Priority
+		pt.Status = met.Status.String()
+		if pt.current != nil && pt.current.State == BoundState && !clk.Before(met.StartedAt) {
+			w.transit(pt, RunningState, met.StartedAt.ToRFC3339(), pt.current.Node)
+		}
+	}
+
+	// The bound pods no longer running or terminating have terminated.
+	for key, pt := range w.pods {
+		if _, ok := podsMet[key]; ok || pt.current == nil || pt.current.State == QueuedState {
+			continue
+		}
+		w.transit(pt, "", clkStr, "")
+	}
+
+	return nil
+}
+
+// WriteEvents implements EventWriter interface.
+// The events make the transitions of the states of the pods.
+func (w *TimelineWriter) WriteEvents(events []Event) error {
+	for _, e := range events {
+		w.observe(e.Clock)
+		if e.IsNodeEvent() {
+			continue
+		}
+
+		pt := w.pod(e.Pod)
+		switch e.Kind {
+		case SubmitEvent:
+			pt.Status = pendingStatus
+			w.transit(pt, QueuedState, e.Clock, "")
+		case BindEvent:
+			pt.Node = e.Node
+			w.transit(pt, BoundState, e.Clock, e.Node)
+		case DeleteEvent, EvictEvent, PressureEvictEvent, NodeEvictEvent, TaintEvictEvent,
+			OOMKillEvent, SchedulingFailedEvent, RejectEvent:
+			if pt.current == nil || pt.current.State == TerminatingState {
+				continue
+			}
+			if pt.current.State == QueuedState {
+				pt.Status = unscheduledStatus
+				w.transit(pt, "", e.Clock, "")
+			} else {
+				w.transit(pt, TerminatingState, e.Clock, pt.current.Node)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Close writes the Timeline to the file, and closes it.
+func (w *TimelineWriter) Close() error {
+	w.timeline.Pods = make([]PodTimeline, 0, len(w.pods))
+	for _, pt := range w.pods {
+		if pt.current != nil {
+			pt.Intervals = append(pt.Intervals, *pt.current)
+		}
+		w.timeline.Pods = append(w.timeline.Pods, pt.PodTimeline)
+	}
+	sort.Slice(w.timeline.Pods, func(i, j int) bool {
+		return w.timeline.Pods[i].Pod < w.timeline.Pods[j].Pod
+	})
+
+	w.timeline.Nodes = make([]NodeTimeline, 0, len(w.nodes))
+	for _, nt := range w.nodes {
+		w.timeline.Nodes = append(w.timeline.Nodes, *nt)
+	}
+	sort.Slice(w.timeline.Nodes, func(i, j int) bool {
+		return w.timeline.Nodes[i].Node < w.timeline.Nodes[j].Node
+	})
+
+	if err := json.NewEncoder(w.file).Encode(&w.timeline); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// pendingStatus is the status of a pod still queued.
+const pendingStatus = "Pending"
+
+func (w *TimelineWriter) pod(key string) *podTimeline {
+	pt, ok := w.pods[key]
+	if !ok {
+		pt = &podTimeline{PodTimeline: PodTimeline{Pod: key, Intervals: []PodInterval{}}}
+		w.pods[key] = pt
+	}
+	return pt
+}
+
+// transit ends the current interval of the pod at the clock, and starts the next one in the state,
+// or none if the state is empty.
+// An interval ending at its start is dropped.
+func (w *TimelineWriter) transit(pt *podTimeline, state PodState, clk, node string) {
+	if cur := pt.current; cur != nil {
+		cur.End = clk
+		if cur.Start != cur.End {
+			pt.Intervals = append(pt.Intervals, *cur)
+		}
+		pt.current = nil
+	}
+
+	if state != "" {
+		pt.current = &PodInterval{State: state, Start: clk, Node: node}
+	}
+}
+
+// observe extends the range of the Timeline to the clock.
+func (w *TimelineWriter) observe(clk string) {
+	if w.timeline.Start == "" {
+		w.timeline.Start = clk
+	}
+	w.timeline.End = clk
+}
+
+// resourceFractions returns the fraction of the allocatable amount of each resource in the amounts.
+// The resources not allocatable are omitted.
+func resourceFractions(amounts, allocatable v1.ResourceList) map[string]float64 {
+	fractions := make(map[string]float64, len(allocatable))
+	for rsrc, alloc := range allocatable {
+		if alloc.IsZero() {
+			continue
+		}
+		q := amounts[rsrc]
+		fractions[string(rsrc)] = quantityValue(q) / quantityValue(alloc)
+	}
+	return fractions
+}
+
+var _ = Writer(&TimelineWriter{})
+var _ = EventWriter(&TimelineWriter{})
@@ -0,0 +1,149 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/node"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+)
+
+func TestTimelineWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "timeline.json")
+	writer, err := NewTimelineWriter(path)
+	assert.NoError(t, err)
+
+	t0 := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	t1 := t0.Add(time.Minute)
+	t2 := t1.Add(time.Minute)
+	str := func(clk clock.Clock) string { return clk.ToRFC3339() }
+
+	nodesMet := map[string]node.Metrics{
+		"node-0": {
+			Allocatable:          v1.ResourceList{"cpu": resource.MustParse("4")},
+			TotalResourceRequest: v1.ResourceList{"cpu": resource.MustParse("1")},
+			TotalResourceUsage:   v1.ResourceList{"cpu": resource.MustParse("500m")},
+			RunningPodsNum:       1,
+		},
+	}
+	running := pod.Metrics{
+		BoundAt:   t0.Add(10 * time.Second),
+		StartedAt: t0.Add(15 * time.Second),
+		Node:      "node-0",
+		Priority:  10,
+		Status:    pod.Ok,
+	}
+
+	assert.NoError(t, writer.WriteEvents([]Event{
+		{Clock: str(t0), Kind: SubmitEvent, Pod: "default/pod-0"},
+		{Clock: str(t0), Kind: SubmitEvent, Pod: "default/pod-1"},
+		{Clock: str(t0), Kind: SubmitEvent, Pod: "default/pod-2"},
+		{Clock: str(t0.Add(5 * time.Second)), Kind: DeleteEvent, Pod: "default/pod-1"},
+		{Clock: str(t0.Add(10 * time.Second)), Kind: BindEvent, Pod: "default/pod-0", Node: "node-0"},
+		{Clock: str(t0.Add(10 * time.Second)), Kind: BindEvent, Pod: "default/pod-2", Node: "node-0"},
+	}))
+	assert.NoError(t, writer.Write(&Metrics{
+		ClockKey:        str(t0.Add(20 * time.Second)),
+		NodesMetricsKey: nodesMet,
+		PodsMetricsKey:  map[string]pod.Metrics{"default/pod-0": running, "default/pod-2": running},
+		QueueMetricsKey: queue.Metrics{},
+	}))
+	// pod-0 is deleted and terminating, and pod-2 has completed.
+	assert.NoError(t, writer.WriteEvents([]Event{
+		{Clock: str(t1), Kind: DeleteEvent, Pod: "default/pod-0", Node: "node-0"},
+	}))
+	deleted := running
+	deleted.Status = pod.Deleted
+	assert.NoError(t, writer.Write(&Metrics{
+		ClockKey:        str(t1),
+		NodesMetricsKey: nodesMet,
+		PodsMetricsKey:  map[string]pod.Metrics{"default/pod-0": deleted},
+		QueueMetricsKey: queue.Metrics{},
+	}))
+	assert.NoError(t, writer.Write(&Metrics{
+		ClockKey:        str(t2),
+		NodesMetricsKey: nodesMet,
+		PodsMetricsKey:  map[string]pod.Metrics{},
+		QueueMetricsKey: queue.Metrics{},
+	}))
+	// pod-1 is resubmitted, and still queued at the end.
+	assert.NoError(t, writer.WriteEvents([]Event{
+		{Clock: str(t2), Kind: SubmitEvent, Pod: "default/pod-1"},
+	}))
+	assert.NoError(t, writer.Close())
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	timeline := Timeline{}
+	assert.NoError(t, json.Unmarshal(data, &timeline))
+
+	assert.Equal(t, str(t0), timeline.Start)
+	assert.Equal(t, str(t2), timeline.End)
+	assert.Equal(t, []PodTimeline{
+		{
+			Pod: "default/pod-0", Node: "node-0", Priority: 10, Status: "Deleted",
+			Intervals: []PodInterval{
+				{State: QueuedState, Start: str(t0), End: str(t0.Add(10 * time.Second))},
+				{State: BoundState, Start: str(t0.Add(10 * time.Second)), End: str(t0.Add(15 * time.Second)),
+					Node: "node-0"},
+				{State: RunningState, Start: str(t0.Add(15 * time.Second)), End: str(t1), Node: "node-0"},
+				{State: TerminatingState, Start: str(t1), End: str(t2), Node: "node-0"},
+			},
+		},
+		{
+			Pod: "default/pod-1", Status: "Pending",
+			Intervals: []PodInterval{
+				{State: QueuedState, Start: str(t0), End: str(t0.Add(5 * time.Second))},
+				{State: QueuedState, Start: str(t2)},
+			},
+		},
+		{
+			Pod: "default/pod-2", Node: "node-0", Priority: 10, Status: "Ok",
+			Intervals: []PodInterval{
+				{State: QueuedState, Start: str(t0), End: str(t0.Add(10 * time.Second))},
+				{State: BoundState, Start: str(t0.Add(10 * time.Second)), End: str(t0.Add(15 * time.Second)),
+					Node: "node-0"},
+				{State: RunningState, Start: str(t0.Add(15 * time.Second)), End: str(t1), Node: "node-0"},
+			},
+		},
+	}, timeline.Pods)
+
+	assert.Len(t, timeline.Nodes, 1)
+	assert.Equal(t, "node-0", timeline.Nodes[0].Node)
+	assert.Equal(t, map[string]float64{"cpu": 4}, timeline.Nodes[0].Allocatable)
+	assert.Len(t, timeline.Nodes[0].Samples, 3)
+	assert.Equal(t, NodeSample{
+		Clock:   str(t1),
+		Pods:    1,
+		Request: map[string]float64{"cpu": 0.25},
+		Usage:   map[string]float64{"cpu": 0.125},
+	}, timeline.Nodes[0].Samples[1])
+}
@@ -0,0 +1,285 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/pod"
+	"simulator/pkg/util"
+)
+
+// EvictionPolicy is the policy of the node-pressure eviction of pods, like the hard eviction
+// threshold of memory.available of the kubelet.
+// CPU is compressible, so its usage beyond the capacity does not trigger evictions.
+type EvictionPolicy struct {
+	// MemoryAvailable is the threshold of the memory available on a node, i.e., its capacity minus
+	// the memory usage of its pods, below which the pods are evicted.
+	MemoryAvailable resource.Quantity
+	// PressureTransitionPeriod is the duration for which a node keeps the MemoryPressure condition
+	// after it observed the pressure last.
+	PressureTransitionPeriod time.Duration
+}
+
+// DefaultPressureTransitionPeriod is the default EvictionPolicy.PressureTransitionPeriod, which is
+// the default of the kubelet.
+const DefaultPressureTransitionPeriod = 5 * time.Minute
+
+// Overcommit sets the allocatable resources of this Node, on which pods are scheduled by their
+// requests, to its capacity multiplied by the ratio of each resource.
+// The actual usage of the pods is still bounded by the capacity (see EvictPods).
+func (node *Node) Overcommit(ratios map[v1.ResourceName]float64) {
+	allocatable := node.v1.Status.Allocatable.DeepCopy()
+	for rsrc, ratio := range ratios {
+		if capacity, ok := node.v1.Status.Capacity[rsrc]; ok {
+			allocatable[rsrc] = scaleQuantity(rsrc, capacity, ratio)
+		}
+	}
+	node.v1.Status.Allocatable = allocatable
+	node.invalidateNodeInfo()
+}
+
+// scaleQuantity returns the quantity of the resource multiplied by the ratio, rounded down to a
+// millicore for cpu or to an integer for the others.
+func scaleQuantity(rsrc v1.ResourceName, q resource.Quantity, ratio float64) resource.Quantity {
+	if rsrc == v1.ResourceCPU {
+		return *resource.NewMilliQuantity(int64(math.Floor(float64(q.MilliValue())*ratio)), q.Format)
+	}
+	return *resource.NewQuantity(int64(math.Floor(float64(q.Value())*ratio)), q.Format)
+}
+
+// SetEvictionPolicy sets the policy of the node-pressure eviction of this Node, or disables the
+// eviction if nil.
+func (node *Node) SetEvictionPolicy(policy *EvictionPolicy) {
+	node.eviction = policy
+}
+
+// EvictPods evicts the running pods on this Node at the given clock while the memory available is
+// below the threshold of the eviction policy, in the order of the kubelet: the pods using more
+// memory than requested first, then the pods with lower priorities, then the pods of lower QoS
+// classes (BestEffort, Burstable, then Guaranteed), then the pods using more memory beyond their
+// requests.
+// Neither the system pods nor the pods with system-critical priorities are evicted.
+// It also updates the MemoryPressure condition of this Node.
+// Returns the evicted pods.
+func (node *Node) EvictPods(clock clock.Clock) []*pod.Pod {
+	if node.eviction == nil {
+		return nil
+	}
+
+	capacity := node.v1.Status.Capacity.Memory().Value()
+	threshold := node.eviction.MemoryAvailable.Value()
+	usage := node.totalResourceUsage(clock)
+	used := usage.Memory().Value()
+
+	evicted := []*pod.Pod{}
+	if capacity-used < threshold {
+		for _, victim := range node.evictionCandidates(clock) {
+			if capacity-used >= threshold {
+				break
+			}
+			victimUsage := victim.ResourceUsage(clock)
+			used -= victimUsage.Memory().Value()
+			victim.Evict(clock)
+			evicted = append(evicted, victim)
+			node.invalidateNodeInfo()
+
+			log.L.Debugf("Node %s: Pod %s evicted under memory pressure",
+				node.ToV1().Name, util.PodKeyFromNames(victim.ToV1().Namespace, victim.ToV1().Name))
+		}
+		node.memoryPressureAt = &clock
+	}
+
+	node.updateMemoryPressureCondition(clock)
+	return evicted
+}
+
+// OOMKillPods kills the running pods on this Node using more memory than their limits at the given
+// clock, like the OOM killer of the kernel, regardless of the eviction policy.
+// Returns the killed pods, in the order of their keys.
+func (node *Node) OOMKillPods(clock clock.Clock) []*pod.Pod {
+	keys := make([]string, 0, len(node.pods))
+	for key, p := range node.pods {
+		if p.ExceedsMemoryLimit(clock) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	killed := make([]*pod.Pod, 0, len(keys))
+	for _, key := range keys {
+		p := node.pods[key]
+		p.OOMKill(clock)
+		killed = append(killed, p)
+		node.invalidateNodeInfo()
+
+		log.L.Debugf("Node %s: Pod %s OOM-killed", node.ToV1().Name, key)
+	}
+
+	return killed
+}
+
+// OOMKillPod kills the running pod of the name on this Node at the given clock, like OOMKillPods,
+// e.g., to replay a recorded kill.
+// Returns the killed pod, or nil if no such pod is running.
+func (node *Node) OOMKillPod(clock clock.Clock, namespace, name string) *pod.Pod {
+	p := node.runningPod(clock, namespace, name)
+	if p == nil {
+		return nil
+	}
+
+	p.OOMKill(clock)
+	node.invalidateNodeInfo()
+	return p
+}
+
+// EvictPod evicts the running pod of the name on this Node under memory pressure at the given
+// clock, like EvictPods, e.g., to replay a recorded eviction.
+// It also updates the MemoryPressure condition of this Node, observing the pressure at the clock.
+// Returns the evicted pod, or nil if no such pod is running.
+func (node *Node) EvictPod(clock clock.Clock, namespace, name string) *pod.Pod {
+	p := node.runningPod(clock, namespace, name)
+	if p == nil {
+		return nil
+	}
+
+	p.Evict(clock)
+	node.invalidateNodeInfo()
+	node.memoryPressureAt = &clock
+	node.updateMemoryPressureCondition(clock)
+	return p
+}
+
+// runningPod returns the running pod of the name on this Node, or nil if none.
+func (node *Node) runningPod(clock clock.Clock, namespace, name string) *pod.Pod {
+	p, ok := node.pods[util.PodKeyFromNames(namespace, name)]
+	if !ok || !p.IsRunning(clock) {
+		return nil
+	}
+	return p
+}
+
+// MemoryPressureAt returns the clock at which this Node observed memory pressure last.
+// The second return value is false if never.
+func (node *Node) MemoryPressureAt() (clock.Clock, bool) {
+	if node.memoryPressureAt == nil {
+		return clock.Clock{}, false
+	}
+	return *node.memoryPressureAt, true
+}
+
+// RestoreMemoryPressure restores the clock at which this Node observed memory pressure last, saved
+// in a checkpoint, and updates the MemoryPressure condition at the clock now.
+func (node *Node) RestoreMemoryPressure(at, now clock.Clock) {
+	node.memoryPressureAt = &at
+	node.updateMemoryPressureCondition(now)
+}
+
+// evictionCandidates returns the running pods on this Node in the order of eviction.
+func (node *Node) evictionCandidates(clock clock.Clock) []*pod.Pod {
+	type candidate struct {
+		pod      *pod.Pod
+		key      string
+		priority int32
+		qosRank  int
+		// overage is the memory usage beyond the request.
+		overage int64
+	}
+
+	candidates := []candidate{}
+	for key, p := range node.pods {
+		if !p.IsRunning(clock) || node.systemPods[key] || pod.IsCritical(p.ToV1()) {
+			continue
+		}
+		req := p.TotalResourceRequests()
+		usage := p.ResourceUsage(clock)
+		candidates = append(candidates, candidate{
+			pod:      p,
+			key:      key,
+			priority: util.PodPriority(p.ToV1()),
+			qosRank:  p.QOSRank(),
+			overage:  usage.Memory().Value() - req.Memory().Value(),
+		})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		ci, cj := candidates[i], candidates[j]
+		if (ci.overage > 0) != (cj.overage > 0) {
+			return ci.overage > 0
+		}
+		if ci.priority != cj.priority {
+			return ci.priority < cj.priority
+		}
+		if ci.qosRank != cj.qosRank {
+			return ci.qosRank < cj.qosRank
+		}
+		if ci.overage != cj.overage {
+			return ci.overage > cj.overage
+		}
+		return ci.key < cj.key
+	})
+
+	pods := make([]*pod.Pod, 0, len(candidates))
+	for _, c := range candidates {
+		pods = append(pods, c.pod)
+	}
+	return pods
+}
+
+// updateMemoryPressureCondition updates the MemoryPressure condition of this Node at the clock.
+func (node *Node) updateMemoryPressureCondition(clk clock.Clock) {
+	pressure := node.memoryPressureAt != nil && node.eviction != nil &&
+		clk.Sub(*node.memoryPressureAt) < node.eviction.PressureTransitionPeriod
+
+	status, reason, message := v1.ConditionFalse, "KubeletHasSufficientMemory",
+		"kubelet has sufficient memory available"
+	if pressure {
+		status, reason, message = v1.ConditionTrue, "KubeletHasInsufficientMemory",
+			"kubelet has insufficient memory available"
+	}
+
+	conditions := node.v1.Status.Conditions
+	for i := range conditions {
+		if conditions[i].Type != v1.NodeMemoryPressure {
+			continue
+		}
+		if conditions[i].Status != status {
+			conditions[i].LastTransitionTime = clk.ToMetaV1()
+			node.invalidateNodeInfo()
+		}
+		conditions[i].Status = status
+		conditions[i].Reason = reason
+		conditions[i].Message = message
+		conditions[i].LastHeartbeatTime = clk.ToMetaV1()
+		return
+	}
+
+	node.invalidateNodeInfo()
+	node.v1.Status.Conditions = append(conditions, v1.NodeCondition{
+		Type:               v1.NodeMemoryPressure,
+		Status:             status,
+		LastHeartbeatTime:  clk.ToMetaV1(),
+		LastTransitionTime: clk.ToMetaV1(),
+		Reason:             reason,
+		Message:            message,
+	})
+}
@@ -0,0 +1,234 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"simulator/pkg/clock"
+)
+
+func newEvictionNode() *Node {
+	capacity := v1.ResourceList{
+		"cpu":    resource.MustParse("4"),
+		"memory": resource.MustParse("4Gi"),
+		"pods":   resource.MustParse("10"),
+	}
+	node := NewNode(&v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-0"},
+		Status:     v1.NodeStatus{Capacity: capacity, Allocatable: capacity},
+	})
+	return &node
+}
+
+func newEvictionPod(name string, priority int32, request, usage string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Annotations: map[string]string{
+				"simSpec": "- seconds: 600\n  resourceUsage:\n    memory: " + usage + "\n",
+			},
+		},
+		Spec: v1.PodSpec{
+			Priority: &priority,
+			Containers: []v1.Container{{
+				Name: "container",
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{"memory": resource.MustParse(request)},
+				},
+			}},
+		},
+	}
+}
+
+func TestNodeOvercommit(t *testing.T) {
+	node := newEvictionNode()
+	node.Overcommit(map[v1.ResourceName]float64{"cpu": 1.5, "memory": 2, "nvidia.com/gpu": 2})
+
+	status := node.ToV1().Status
+	assert.Equal(t, "6", resourceString(status.Allocatable, "cpu"))
+	assert.Equal(t, "8Gi", resourceString(status.Allocatable, "memory"))
+	assert.Equal(t, "10", resourceString(status.Allocatable, "pods"))
+	assert.Equal(t, "", resourceString(status.Allocatable, "nvidia.com/gpu"))
+	assert.Equal(t, "4", resourceString(status.Capacity, "cpu"))
+	assert.Equal(t, "4Gi", resourceString(status.Capacity, "memory"))
+}
+
+func TestNodeEvictPods(t *testing.T) {
+	start := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	node := newEvictionNode()
+	node.Overcommit(map[v1.ResourceName]float64{"memory": 2})
+
+	// Disabled by default.
+	for _, p := range []*v1.Pod{
+		newEvictionPod("high-within", 10, "2Gi", "1536Mi"),
+		newEvictionPod("low-within", 0, "1Gi", "1Gi"),
+		newEvictionPod("high-over", 10, "512Mi", "1Gi"),
+		newEvictionPod("low-over", 0, "512Mi", "768Mi"),
+	} {
+		_, err := node.BindPod(start, p)
+		assert.NoError(t, err)
+	}
+	clk := start.Add(10 * time.Second)
+	assert.Empty(t, node.EvictPods(clk))
+
+	node.SetEvictionPolicy(&EvictionPolicy{
+		MemoryAvailable:          resource.MustParse("1Gi"),
+		PressureTransitionPeriod: DefaultPressureTransitionPeriod,
+	})
+	_, ok := node.MemoryPressureAt()
+	assert.False(t, ok)
+
+	// 4.25Gi used: the pods over their requests are evicted first, in the order of priority, until
+	// 1Gi is available.
+	evicted := node.EvictPods(clk)
+	names := []string{}
+	for _, p := range evicted {
+		names = append(names, p.ToV1().Name)
+		assert.True(t, p.IsEvicted())
+		assert.Equal(t, "Evicted", p.BuildStatus(clk).Reason)
+	}
+	assert.Equal(t, []string{"low-over", "high-over"}, names)
+
+	at, ok := node.MemoryPressureAt()
+	assert.True(t, ok)
+	assert.Equal(t, clk, at)
+	assert.Equal(t, v1.ConditionTrue, memoryPressureCondition(node).Status)
+
+	met := node.Metrics(clk)
+	assert.Equal(t, int64(2), met.RunningPodsNum)
+	assert.Equal(t, int64(2), met.EvictedPodsNum)
+	assert.Equal(t, "4Gi", resourceString(met.Capacity, "memory"))
+	assert.Equal(t, "8Gi", resourceString(met.Allocatable, "memory"))
+
+	// The condition lasts for the transition period.
+	clk = clk.Add(time.Minute)
+	assert.Empty(t, node.EvictPods(clk))
+	assert.Equal(t, v1.ConditionTrue, memoryPressureCondition(node).Status)
+	clk = clk.Add(DefaultPressureTransitionPeriod)
+	assert.Empty(t, node.EvictPods(clk))
+	assert.Equal(t, v1.ConditionFalse, memoryPressureCondition(node).Status)
+}
+
+func TestNodeEvictPodsByQOS(t *testing.T) {
+	start := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	node := newEvictionNode()
+	node.Overcommit(map[v1.ResourceName]float64{"memory": 2})
+	node.SetEvictionPolicy(&EvictionPolicy{PressureTransitionPeriod: DefaultPressureTransitionPeriod})
+
+	guaranteed := newEvictionPod("guaranteed", 0, "2Gi", "2Gi")
+	guaranteed.Spec.Containers[0].Resources.Requests["cpu"] = resource.MustParse("1")
+	guaranteed.Spec.Containers[0].Resources.Limits = guaranteed.Spec.Containers[0].Resources.Requests
+	burstable := newEvictionPod("burstable", 0, "3Gi", "3Gi")
+	for _, p := range []*v1.Pod{guaranteed, burstable} {
+		_, err := node.BindPod(start, p)
+		assert.NoError(t, err)
+	}
+
+	// Neither uses more memory than requested, with the same priority.
+	clk := start.Add(10 * time.Second)
+	met := node.Metrics(clk)
+	assert.Equal(t, map[v1.PodQOSClass]int64{v1.PodQOSGuaranteed: 1, v1.PodQOSBurstable: 1},
+		met.QOSRunningPodsNum)
+	assert.Equal(t, "2Gi", resourceString(met.QOSResourceUsage[v1.PodQOSGuaranteed], "memory"))
+	assert.Equal(t, "3Gi", resourceString(met.QOSResourceUsage[v1.PodQOSBurstable], "memory"))
+
+	evicted := node.EvictPods(clk)
+	if assert.Len(t, evicted, 1) {
+		assert.Equal(t, "burstable", evicted[0].ToV1().Name)
+	}
+}
+
+func TestNodeEvictPodsExceptCritical(t *testing.T) {
+	start := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	node := newEvictionNode()
+	node.Overcommit(map[v1.ResourceName]float64{"memory": 2})
+	node.SetEvictionPolicy(&EvictionPolicy{PressureTransitionPeriod: DefaultPressureTransitionPeriod})
+
+	// The critical pod uses more memory beyond its request than the other.
+	for _, p := range []*v1.Pod{
+		newEvictionPod("critical", 2000000000, "1Gi", "3Gi"),
+		newEvictionPod("low", 0, "1Gi", "1536Mi"),
+	} {
+		_, err := node.BindPod(start, p)
+		assert.NoError(t, err)
+	}
+
+	evicted := node.EvictPods(start.Add(10 * time.Second))
+	if assert.Len(t, evicted, 1) {
+		assert.Equal(t, "low", evicted[0].ToV1().Name)
+	}
+}
+
+func TestNodeOOMKillPods(t *testing.T) {
+	start := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	node := newEvictionNode()
+
+	// The limited pod uses more memory than its limit after its first phase.
+	limited := newEvictionPod("limited", 0, "1Gi", "512Mi")
+	limited.Annotations["simSpec"] = "- seconds: 60\n  resourceUsage:\n    memory: 512Mi\n" +
+		"- seconds: 600\n  resourceUsage:\n    memory: 2Gi\n"
+	limited.Spec.Containers[0].Resources.Limits = v1.ResourceList{"memory": resource.MustParse("1Gi")}
+	for _, p := range []*v1.Pod{limited, newEvictionPod("unlimited", 0, "1Gi", "2Gi")} {
+		_, err := node.BindPod(start, p)
+		assert.NoError(t, err)
+	}
+
+	clk := start.Add(10 * time.Second)
+	assert.Empty(t, node.OOMKillPods(clk))
+	next, ok := node.Pod("default", "limited").NextTransition(clk)
+	assert.True(t, ok)
+	assert.Equal(t, start.Add(60*time.Second), next)
+
+	// Killed regardless of the eviction policy, which is disabled.
+	clk = start.Add(60 * time.Second)
+	killed := node.OOMKillPods(clk)
+	if assert.Len(t, killed, 1) {
+		assert.Equal(t, "limited", killed[0].ToV1().Name)
+		assert.True(t, killed[0].IsOOMKilled())
+		assert.True(t, killed[0].IsDeleted(clk))
+		status := killed[0].BuildStatus(clk)
+		assert.Equal(t, v1.PodFailed, status.Phase)
+		assert.Equal(t, "OOMKilled", status.Reason)
+	}
+
+	met := node.Metrics(clk)
+	assert.Equal(t, int64(1), met.RunningPodsNum)
+	assert.Equal(t, "2Gi", resourceString(met.TotalResourceUsage, "memory"))
+}
+
+func memoryPressureCondition(node *Node) v1.NodeCondition {
+	for _, cond := range node.ToV1().Status.Conditions {
+		if cond.Type == v1.NodeMemoryPressure {
+			return cond
+		}
+	}
+	return v1.NodeCondition{}
+}
+
+func resourceString(rl v1.ResourceList, rsrc v1.ResourceName) string {
+	q, ok := rl[rsrc]
+	if !ok {
+		return ""
+	}
+	return q.String()
+}
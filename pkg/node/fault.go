@@ -0,0 +1,151 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"math"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/api"
+
+	"simulator/pkg/clock"
+)
+
+// IsReady returns whether the Ready condition of this Node is true.
+func (node *Node) IsReady() bool {
+	for _, c := range node.v1.Status.Conditions {
+		if c.Type == v1.NodeReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// SetReady sets the Ready condition of this Node at the given clock, and taints it with the
+// node.kubernetes.io/not-ready NoSchedule and NoExecute taints while not ready, as the node
+// lifecycle controller does, so that no pods are scheduled onto it and the running pods not
+// tolerating the taint are evicted (see EvictIntolerantPods).
+// Returns false if the condition is unchanged.
+func (node *Node) SetReady(clk clock.Clock, ready bool) bool {
+	if node.IsReady() == ready {
+		return false
+	}
+
+	status, reason, message := v1.ConditionFalse, "KubeletNotReady", "kubelet is not posting ready status"
+	if ready {
+		status, reason, message = v1.ConditionTrue, "KubeletReady", "kubelet is posting ready status"
+	}
+	condition := v1.NodeCondition{
+		Type:               v1.NodeReady,
+		Status:             status,
+		LastHeartbeatTime:  clk.ToMetaV1(),
+		LastTransitionTime: clk.ToMetaV1(),
+		Reason:             reason,
+		Message:            message,
+	}
+
+	updated := false
+	for i := range node.v1.Status.Conditions {
+		if node.v1.Status.Conditions[i].Type == v1.NodeReady {
+			node.v1.Status.Conditions[i] = condition
+			updated = true
+		}
+	}
+	if !updated {
+		node.v1.Status.Conditions = append(node.v1.Status.Conditions, condition)
+	}
+	node.invalidateNodeInfo()
+
+	for _, effect := range []v1.TaintEffect{v1.TaintEffectNoSchedule, v1.TaintEffectNoExecute} {
+		if ready {
+			node.RemoveTaint(schedulerapi.TaintNodeNotReady, effect)
+		} else {
+			node.AddTaint(clk, v1.Taint{Key: schedulerapi.TaintNodeNotReady, Effect: effect})
+		}
+	}
+
+	return true
+}
+
+// ValidateDegradation returns error if a ratio of the degradation is not in [0, 1].
+func ValidateDegradation(ratios map[v1.ResourceName]float64) error {
+	for rsrc, ratio := range ratios {
+		if ratio < 0 || ratio > 1 || math.IsNaN(ratio) {
+			return strongerrors.InvalidArgument(
+				errors.Errorf("invalid ratio of degradation of %s: %v", rsrc, ratio))
+		}
+	}
+
+	return nil
+}
+
+// Degrade reduces the capacity and the allocatable resources of this Node to those before any
+// degradation multiplied by the ratio of each resource (e.g., cpu: 0.5 for a half of the cpus),
+// or restores them if ratios is empty.
+// The running pods keep running; the scheduler sees the reduced allocatable resources, and the
+// usage of the pods is bounded by the reduced capacity (see EvictPods).
+func (node *Node) Degrade(ratios map[v1.ResourceName]float64) {
+	node.invalidateNodeInfo()
+	if node.undegraded != nil {
+		node.v1.Status.Capacity = node.undegraded.Capacity.DeepCopy()
+		node.v1.Status.Allocatable = node.undegraded.Allocatable.DeepCopy()
+		node.undegraded = nil
+	}
+	if len(ratios) == 0 {
+		return
+	}
+
+	node.undegraded = &v1.NodeStatus{
+		Capacity:    node.v1.Status.Capacity.DeepCopy(),
+		Allocatable: node.v1.Status.Allocatable.DeepCopy(),
+	}
+	capacity := node.v1.Status.Capacity.DeepCopy()
+	allocatable := node.v1.Status.Allocatable.DeepCopy()
+	for rsrc, ratio := range ratios {
+		if q, ok := capacity[rsrc]; ok {
+			capacity[rsrc] = scaleQuantity(rsrc, q, ratio)
+		}
+		if q, ok := allocatable[rsrc]; ok {
+			allocatable[rsrc] = scaleQuantity(rsrc, q, ratio)
+		}
+	}
+	node.v1.Status.Capacity = capacity
+	node.v1.Status.Allocatable = allocatable
+}
+
+// IsDegraded returns whether this Node is degraded by Degrade.
+func (node *Node) IsDegraded() bool {
+	return node.undegraded != nil
+}
+
+// Undegraded returns a copy of the capacity and the allocatable resources of this Node before its
+// degradation, or nil if not degraded.
+func (node *Node) Undegraded() *v1.NodeStatus {
+	if node.undegraded == nil {
+		return nil
+	}
+	return node.undegraded.DeepCopy()
+}
+
+// RestoreResources restores the capacity and the allocatable resources of this Node, and those
+// before its degradation unless undegraded is nil, saved in a checkpoint.
+func (node *Node) RestoreResources(capacity, allocatable v1.ResourceList, undegraded *v1.NodeStatus) {
+	node.v1.Status.Capacity = capacity
+	node.v1.Status.Allocatable = allocatable
+	node.undegraded = undegraded
+	node.invalidateNodeInfo()
+}
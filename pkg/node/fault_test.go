@@ -0,0 +1,80 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	schedulerapi "k8s.io/kubernetes/pkg/scheduler/api"
+
+	"simulator/pkg/clock"
+)
+
+func TestNodeSetReady(t *testing.T) {
+	start := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	node := newEvictionNode()
+	assert.False(t, node.IsReady())
+
+	assert.True(t, node.SetReady(start, true))
+	assert.False(t, node.SetReady(start, true))
+	assert.True(t, node.IsReady())
+	assert.Empty(t, node.Taints())
+
+	clk := start.Add(10 * time.Second)
+	assert.True(t, node.SetReady(clk, false))
+	assert.False(t, node.IsReady())
+	assert.Len(t, node.ToV1().Status.Conditions, 1)
+	assert.Equal(t, clk.ToMetaV1(), node.ToV1().Status.Conditions[0].LastTransitionTime)
+	taints := node.Taints()
+	assert.Len(t, taints, 2)
+	for _, taint := range taints {
+		assert.Equal(t, schedulerapi.TaintNodeNotReady, taint.Key)
+	}
+
+	assert.True(t, node.SetReady(clk, true))
+	assert.Empty(t, node.Taints())
+}
+
+func TestNodeDegrade(t *testing.T) {
+	node := newEvictionNode()
+	node.Overcommit(map[v1.ResourceName]float64{"cpu": 1.5})
+
+	node.Degrade(map[v1.ResourceName]float64{"cpu": 0.5, "nvidia.com/gpu": 0.5})
+	assert.True(t, node.IsDegraded())
+	status := node.ToV1().Status
+	assert.Equal(t, "2", resourceString(status.Capacity, "cpu"))
+	assert.Equal(t, "3", resourceString(status.Allocatable, "cpu"))
+	assert.Equal(t, "4Gi", resourceString(status.Allocatable, "memory"))
+	assert.Equal(t, "", resourceString(status.Allocatable, "nvidia.com/gpu"))
+
+	// A degradation replaces the previous one, rather than compounding it.
+	node.Degrade(map[v1.ResourceName]float64{"cpu": 0.25})
+	status = node.ToV1().Status
+	assert.Equal(t, "1", resourceString(status.Capacity, "cpu"))
+	assert.Equal(t, "1500m", resourceString(status.Allocatable, "cpu"))
+
+	node.Degrade(nil)
+	assert.False(t, node.IsDegraded())
+	status = node.ToV1().Status
+	assert.Equal(t, "4", resourceString(status.Capacity, "cpu"))
+	assert.Equal(t, "6", resourceString(status.Allocatable, "cpu"))
+
+	assert.NoError(t, ValidateDegradation(map[v1.ResourceName]float64{"cpu": 0, "memory": 1}))
+	assert.EqualError(t, ValidateDegradation(map[v1.ResourceName]float64{"cpu": 1.5}),
+		"invalid ratio of degradation of cpu: 1.5")
+}
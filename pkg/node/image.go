@@ -0,0 +1,217 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+	"k8s.io/kubernetes/pkg/util/parsers"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/pod"
+)
+
+// SetImageSizes sets the sizes in bytes of the images that the pods bound to this Node may pull,
+// keyed by their names.
+// An image not in sizes is recorded with size 0.
+func (node *Node) SetImageSizes(sizes map[string]int64) {
+	node.imageSizes = make(map[string]int64, len(sizes))
+	for name, size := range sizes {
+		node.imageSizes[NormalizedImageName(name)] = size
+	}
+}
+
+// Images returns the images that this Node has pulled by the given clock, including the ones seeded
+// by its configuration, in the v1.NodeStatus.Images representation.
+// The images still being pulled are not included (see ImagePulls).
+func (node *Node) Images(clk clock.Clock) []v1.ContainerImage {
+	node.completeImagePulls(clk)
+	return node.v1.Status.Images
+}
+
+// RestoreImages restores the images that this Node has pulled, saved in a checkpoint.
+func (node *Node) RestoreImages(images []v1.ContainerImage) {
+	node.v1.Status.Images = images
+}
+
+// ImagePulls returns the images that this Node is pulling, mapped to the clocks at which the pulls
+// complete.
+func (node *Node) ImagePulls() map[string]clock.Clock {
+	pulls := make(map[string]clock.Clock, len(node.imageReadyAt))
+	for name, readyAt := range node.imageReadyAt {
+		pulls[name] = readyAt
+	}
+	return pulls
+}
+
+// RestoreImagePulls restores the images that this Node is pulling, saved in a checkpoint.
+func (node *Node) RestoreImagePulls(pulls map[string]clock.Clock) {
+	node.imageReadyAt = make(map[string]clock.Clock, len(pulls))
+	for name, readyAt := range pulls {
+		node.imageReadyAt[name] = readyAt
+		if node.pullingUntil.Before(readyAt) {
+			node.pullingUntil = readyAt
+		}
+	}
+}
+
+// HasImage returns whether this Node has pulled the image by the given clock.
+func (node *Node) HasImage(clk clock.Clock, name string) bool {
+	node.completeImagePulls(clk)
+	_, ok := node.imageIndex(NormalizedImageName(name))
+	return ok
+}
+
+// pullImages starts to pull the images of the containers of the pod that this Node neither has nor
+// is pulling at the given clock with the startup model.
+// The images are pulled one at a time, like the kubelet with serialized image pulls, and never
+// removed, i.e., the image garbage collection of the kubelet is not simulated.
+// Returns the clock at which all the images of the pod are available.
+func (node *Node) pullImages(clk clock.Clock, v1Pod *v1.Pod, startup pod.StartupLatency) clock.Clock {
+	node.completeImagePulls(clk)
+
+	pulledAt := clk
+	containers := append(append([]v1.Container{}, v1Pod.Spec.InitContainers...), v1Pod.Spec.Containers...)
+	for _, container := range containers {
+		if container.Image == "" {
+			continue
+		}
+		name := NormalizedImageName(container.Image)
+		if _, ok := node.imageIndex(name); ok {
+			continue
+		}
+		// The image may be still being pulled for another pod.
+		if readyAt, ok := node.imageReadyAt[name]; ok {
+			if pulledAt.Before(readyAt) {
+				pulledAt = readyAt
+			}
+			continue
+		}
+
+		start := clk
+		if start.Before(node.pullingUntil) {
+			start = node.pullingUntil
+		}
+		readyAt := start.Add(startup.PullDuration(node.imageSizes[name]))
+		node.pullingUntil = readyAt
+		node.imageReadyAt[name] = readyAt
+		if pulledAt.Before(readyAt) {
+			pulledAt = readyAt
+		}
+	}
+
+	return pulledAt
+}
+
+// completeImagePulls adds the images whose pulls complete by the given clock to the
+// v1.NodeStatus.Images of this Node, in the order of the completion, so that the scheduler sees
+// only the images present on this Node.
+func (node *Node) completeImagePulls(clk clock.Clock) {
+	names := []string{}
+	for name, readyAt := range node.imageReadyAt {
+		if !clk.Before(readyAt) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ai, aj := node.imageReadyAt[names[i]], node.imageReadyAt[names[j]]
+		if ai.Before(aj) || aj.Before(ai) {
+			return ai.Before(aj)
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		node.v1.Status.Images = append(node.v1.Status.Images, v1.ContainerImage{
+			Names:     []string{name},
+			SizeBytes: node.imageSizes[name],
+		})
+		delete(node.imageReadyAt, name)
+	}
+	node.invalidateNodeInfo()
+}
+
+// imageIndex returns the index of the image with the normalized name in the v1.NodeStatus.Images
+// of this Node.
+// The second return value is false if not found.
+func (node *Node) imageIndex(name string) (int, bool) {
+	for i, image := range node.v1.Status.Images {
+		for _, n := range image.Names {
+			if NormalizedImageName(n) == name {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// SetImageStates sets the states of the images on each of the nodes in nodeInfoMap, with the number
+// of the nodes having each image, from the v1.NodeStatus.Images of the nodes.
+// This is what the scheduler cache of kube-scheduler does, and what the image-locality priority
+// relies on.
+func SetImageStates(nodeInfoMap map[string]*nodeinfo.NodeInfo) {
+	numNodes := map[string]int{}
+	for _, info := range nodeInfoMap {
+		for name := range normalizedImageNames(info.Node()) {
+			numNodes[name]++
+		}
+	}
+
+	for _, info := range nodeInfoMap {
+		states := map[string]*nodeinfo.ImageStateSummary{}
+		if info.Node() != nil {
+			for _, image := range info.Node().Status.Images {
+				for _, name := range image.Names {
+					name = NormalizedImageName(name)
+					states[name] = &nodeinfo.ImageStateSummary{
+						Size:     image.SizeBytes,
+						NumNodes: numNodes[name],
+					}
+				}
+			}
+		}
+		info.SetImageStates(states)
+	}
+}
+
+// normalizedImageNames returns the set of the normalized names of the images of the node.
+func normalizedImageNames(node *v1.Node) map[string]bool {
+	names := map[string]bool{}
+	if node == nil {
+		return names
+	}
+	for _, image := range node.Status.Images {
+		for _, name := range image.Names {
+			names[NormalizedImageName(name)] = true
+		}
+	}
+
+	return names
+}
+
+// NormalizedImageName returns the name of the image with the default tag "latest" if not tagged, in
+// the same way as the ImageLocality priority of kube-scheduler.
+func NormalizedImageName(name string) string {
+	if strings.LastIndex(name, ":") <= strings.LastIndex(name, "/") {
+		name = name + ":" + parsers.DefaultImageTag
+	}
+	return name
+}
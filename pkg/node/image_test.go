@@ -0,0 +1,123 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/pod"
+)
+
+func TestNodePullImages(t *testing.T) {
+	clk := clock.NewClock(time.Now())
+	node := newEvictionNode()
+	node.v1.Status.Images = []v1.ContainerImage{{Names: []string{"seeded:1.0"}, SizeBytes: 10}}
+	node.SetImageSizes(map[string]int64{"app": 100 << 20})
+	node.SetStartupLatency(pod.StartupLatency{ImagePullBandwidth: 10 << 20})
+
+	v1Pod := newEvictionPod("pod-0", 0, "1Gi", "1Gi")
+	v1Pod.Spec.Containers[0].Image = "app"
+	v1Pod.Spec.InitContainers = []v1.Container{{Name: "init", Image: "seeded:1.0"}}
+	_, err := node.BindPod(clk, v1Pod)
+	assert.NoError(t, err)
+
+	// The image is not present until its pull completes in 10s.
+	assert.Equal(t, []v1.ContainerImage{{Names: []string{"seeded:1.0"}, SizeBytes: 10}}, node.Images(clk))
+	assert.False(t, node.HasImage(clk.Add(9*time.Second), "app:latest"))
+	assert.Equal(t, map[string]clock.Clock{"app:latest": clk.Add(10 * time.Second)}, node.ImagePulls())
+	info, err := node.ToNodeInfo(clk)
+	assert.NoError(t, err)
+	assert.Len(t, info.Node().Status.Images, 1)
+
+	clk = clk.Add(10 * time.Second)
+	assert.Equal(t, []v1.ContainerImage{
+		{Names: []string{"seeded:1.0"}, SizeBytes: 10},
+		{Names: []string{"app:latest"}, SizeBytes: 100 << 20},
+	}, node.Images(clk))
+	assert.True(t, node.HasImage(clk, "app:latest"))
+	assert.Empty(t, node.ImagePulls())
+
+	// A pod that fails to start pulls nothing.
+	v1Pod = newEvictionPod("pod-1", 0, "8Gi", "1Gi")
+	v1Pod.Spec.Containers[0].Image = "registry:5000/huge"
+	_, err = node.BindPod(clk, v1Pod)
+	assert.NoError(t, err)
+	assert.False(t, node.HasImage(clk.Add(time.Hour), "registry:5000/huge"))
+}
+
+func TestNodeStartupLatency(t *testing.T) {
+	clk := clock.NewClock(time.Now())
+	node := newEvictionNode()
+	node.SetImageSizes(map[string]int64{"app": 100 << 20, "sidecar": 50 << 20})
+	node.SetStartupLatency(pod.StartupLatency{
+		Bind:               time.Second,
+		ImagePullBandwidth: 10 << 20,
+		Init:               2 * time.Second,
+	})
+
+	bind := func(name string, images ...string) *pod.Pod {
+		v1Pod := newEvictionPod(name, 0, "1Mi", "1Mi")
+		v1Pod.Spec.Containers = nil
+		for _, image := range images {
+			v1Pod.Spec.Containers = append(v1Pod.Spec.Containers, v1.Container{Name: image, Image: image})
+		}
+		simPod, err := node.BindPod(clk, v1Pod)
+		assert.NoError(t, err)
+		return simPod
+	}
+
+	// The images are pulled one at a time: app in [1s, 11s), and sidecar in [11s, 16s).
+	assert.Equal(t, 13*time.Second, bind("pod-0", "app").StartupLatency())
+	assert.Equal(t, 18*time.Second, bind("pod-1", "sidecar").StartupLatency())
+	// app is still being pulled.
+	assert.Equal(t, 13*time.Second, bind("pod-2", "app").StartupLatency())
+	assert.Equal(t, int64(3), node.Metrics(clk).StartingPodsNum)
+
+	clk = clk.Add(time.Minute)
+	assert.Equal(t, 3*time.Second, bind("pod-3", "app", "sidecar").StartupLatency())
+	assert.Equal(t, int64(1), node.Metrics(clk).StartingPodsNum)
+}
+
+func TestSetImageStates(t *testing.T) {
+	infoMap := map[string]*nodeinfo.NodeInfo{}
+	for name, images := range map[string][]string{
+		"node-0": {"a:1.0", "b"},
+		"node-1": {"a:1.0"},
+	} {
+		node := &v1.Node{}
+		node.Name = name
+		for _, image := range images {
+			node.Status.Images = append(node.Status.Images, v1.ContainerImage{Names: []string{image}, SizeBytes: 10})
+		}
+		info := nodeinfo.NewNodeInfo()
+		assert.NoError(t, info.SetNode(node))
+		infoMap[name] = info
+	}
+
+	SetImageStates(infoMap)
+	assert.Equal(t, map[string]*nodeinfo.ImageStateSummary{
+		"a:1.0":    {Size: 10, NumNodes: 2},
+		"b:latest": {Size: 10, NumNodes: 1},
+	}, infoMap["node-0"].ImageStates())
+	assert.Equal(t, map[string]*nodeinfo.ImageStateSummary{
+		"a:1.0": {Size: 10, NumNodes: 2},
+	}, infoMap["node-1"].ImageStates())
+}
@@ -15,19 +15,47 @@
 package node
 
 import (
+	"sort"
+
 	"github.com/containerd/containerd/log"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
 
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/clock"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/pod"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/util"
+	"simulator/pkg/clock"
+	"simulator/pkg/pod"
+	"simulator/pkg/util"
 )
 
 // Node represents a simulated computing node.
 type Node struct {
 	v1   *v1.Node
 	pods map[string]*pod.Pod
+	// usageNoise is the default noise model of the resource usage of the pods on this Node.
+	usageNoise pod.UsageNoise
+	// eviction is the policy of the node-pressure eviction, or nil if disabled.
+	eviction *EvictionPolicy
+	// memoryPressureAt is the clock at which this Node observed memory pressure last.
+	memoryPressureAt *clock.Clock
+	// systemPods are the keys of the system pods on this Node (see AddSystemPod).
+	systemPods map[string]bool
+	// imageSizes are the sizes in bytes of the images pulled by the pods (see SetImageSizes).
+	imageSizes map[string]int64
+	// startup is the model of the startup latency of the pods (see SetStartupLatency).
+	startup pod.StartupLatency
+	// imageReadyAt maps each image being pulled by this Node to the clock at which the pull
+	// completes (see completeImagePulls).
+	imageReadyAt map[string]clock.Clock
+	// pullingUntil is the clock until which this Node is pulling images, one at a time.
+	pullingUntil clock.Clock
+	// undegraded is the capacity and the allocatable resources of this Node before its degradation,
+	// or nil if not degraded (see Degrade).
+	undegraded *v1.NodeStatus
+	// info is the cached NodeInfo of this Node built at infoBuiltAt, or nil if invalidated, which
+	// expires at infoExpiresAt unless nil (see NodeInfo).
+	info          *nodeinfo.NodeInfo
+	infoBuiltAt   clock.Clock
+	infoExpiresAt *clock.Clock
 }
 
 // Metrics is a metrics of a Node at one point of time.
@@ -38,41 +66,84 @@ type Metrics struct {
 	FailedPodsNum        int64
 	TotalResourceRequest v1.ResourceList
 	TotalResourceUsage   v1.ResourceList
+
+	// StartingPodsNum is the number of the running pods that have not started their execution
+	// after the startup latency.
+	StartingPodsNum int64
+
+	// Capacity is the capacity of the node, which is smaller than Allocatable if overcommitted.
+	// TotalResourceUsage is bounded by Capacity, while TotalResourceRequest by Allocatable.
+	// TotalResourceRequest includes the pods resource, the number of running or terminating pods, so
+	// that the utilization of the pod count can be compared with Allocatable.
+	Capacity v1.ResourceList
+	// EvictedPodsNum is the number of pods evicted under resource pressure and not garbage-collected
+	// yet.
+	EvictedPodsNum int64
+
+	// QOSRunningPodsNum and QOSResourceUsage are the number and the total resource usage of the
+	// running pods of each QoS class.
+	QOSRunningPodsNum map[v1.PodQOSClass]int64
+	QOSResourceUsage  map[v1.PodQOSClass]v1.ResourceList
 }
 
 // NewNode creates a new Node with the given v1.Node.
 func NewNode(node *v1.Node) Node {
 	return Node{
-		v1:   node,
-		pods: map[string]*pod.Pod{},
+		v1:           node,
+		pods:         map[string]*pod.Pod{},
+		systemPods:   map[string]bool{},
+		imageReadyAt: map[string]clock.Clock{},
 	}
 }
 
+// SetUsageNoise sets the default noise model of the resource usage of the pods bound to this Node
+// (see pod.Pod.SetDefaultUsageNoise).
+func (node *Node) SetUsageNoise(noise pod.UsageNoise) {
+	node.usageNoise = noise
+}
+
+// SetStartupLatency sets the model of the latency from the binding of each pod to this Node to the
+// start of its execution (see pod.StartupLatency).
+func (node *Node) SetStartupLatency(startup pod.StartupLatency) {
+	node.startup = startup
+}
+
 // ToV1 returns *v1.Node representation of this Node.
 func (node *Node) ToV1() *v1.Node {
 	return node.v1
 }
 
-// ToNodeInfo creates *nodeinfo.NodeInfo object from this Node.
+// ToNodeInfo creates *nodeinfo.NodeInfo object from this Node, as a copy of its cache (see
+// NodeInfo).
+// The UsageAnnotation of the node is updated to the resource usage at the given clock.
 func (node *Node) ToNodeInfo(clock clock.Clock) (*nodeinfo.NodeInfo, error) {
-	pods := node.runningAndTerminatingPodsV1WithStatus(clock)
-	nodeInfo := nodeinfo.NewNodeInfo(pods...)
-	err := nodeInfo.SetNode(node.ToV1())
+	nodeInfo, err := node.NodeInfo(clock)
 	if err != nil {
 		return nil, err
 	}
-	return nodeInfo, nil
+	return nodeInfo.Clone(), nil
 }
 
 // Metrics returns the Metrics of this Node at the given clock.
 func (node *Node) Metrics(clock clock.Clock) Metrics {
+	qosNum, qosUsage := node.qosMetrics(clock)
+	request := node.totalResourceRequest(clock)
+	request[v1.ResourcePods] = *resource.NewQuantity(node.PodsNum(clock), resource.DecimalSI)
+
 	return Metrics{
 		Allocatable:          node.ToV1().Status.Allocatable,
 		RunningPodsNum:       node.runningPodsNum(clock),
 		TerminatingPodsNum:   node.terminatingPodsNum(clock),
+		StartingPodsNum:      node.startingPodsNum(clock),
 		FailedPodsNum:        node.bindingFailedPodsNum(),
-		TotalResourceRequest: node.totalResourceRequest(clock),
+		TotalResourceRequest: request,
 		TotalResourceUsage:   node.totalResourceUsage(clock),
+
+		Capacity:       node.ToV1().Status.Capacity,
+		EvictedPodsNum: node.evictedPodsNum(),
+
+		QOSRunningPodsNum: qosNum,
+		QOSResourceUsage:  qosUsage,
 	}
 }
 
@@ -81,6 +152,11 @@ func (node *Node) Metrics(clock clock.Clock) Metrics {
 // Returns the bound pod in pod.Pod representation, or error if the pod has invalid name or failed
 // to create a simulated pod.
 func (node *Node) BindPod(clock clock.Clock, v1Pod *v1.Pod) (*pod.Pod, error) {
+	return node.bindPod(clock, v1Pod, node.startup)
+}
+
+// bindPod binds the pod, which starts after the latency of the startup model.
+func (node *Node) bindPod(clock clock.Clock, v1Pod *v1.Pod, startup pod.StartupLatency) (*pod.Pod, error) {
 	key, err := util.PodKey(v1Pod)
 	if err != nil {
 		return nil, err
@@ -93,7 +169,7 @@ func (node *Node) BindPod(clock clock.Clock, v1Pod *v1.Pod) (*pod.Pod, error) {
 	allocatable := node.ToV1().Status.Allocatable
 	var podStatus pod.Status
 
-	if !util.ResourceListGE(allocatable, newTotalReq) || node.runningPodsNum(clock) >= allocatable.Pods().Value() {
+	if !util.ResourceListGE(allocatable, newTotalReq) || node.PodsNum(clock) >= allocatable.Pods().Value() {
 		podStatus = pod.OverCapacity
 	} else {
 		podStatus = pod.Ok
@@ -104,12 +180,55 @@ func (node *Node) BindPod(clock clock.Clock, v1Pod *v1.Pod) (*pod.Pod, error) {
 	if err != nil {
 		return nil, err
 	}
+	simPod.SetDefaultUsageNoise(node.usageNoise)
+	if podStatus == pod.Ok {
+		pulledAt := node.pullImages(clock.Add(startup.Bind), v1Pod, startup)
+		startAt := pulledAt.Add(simPod.InitDuration(startup.Init))
+		simPod.SetStartupLatency(startAt.Sub(clock))
+	}
 	v1Pod.Status = simPod.BuildStatus(clock)
 	node.pods[key] = simPod
+	if podStatus == pod.Ok {
+		node.addToNodeInfo(clock, simPod)
+	}
+
+	return simPod, nil
+}
+
+// AddSystemPod binds the system pod, which runs on this Node from its startup, at the given clock.
+// A system pod is never evicted, since it is added whenever the Node is created (also when restored
+// from a checkpoint), and starts with no startup latency.
+// Returns the bound pod, or error if the pod has invalid name or failed to create a simulated pod.
+func (node *Node) AddSystemPod(clock clock.Clock, v1Pod *v1.Pod) (*pod.Pod, error) {
+	simPod, err := node.bindPod(clock, v1Pod, pod.StartupLatency{})
+	if err != nil {
+		return nil, err
+	}
+	node.systemPods[util.PodKeyFromNames(v1Pod.Namespace, v1Pod.Name)] = true
 
 	return simPod, nil
 }
 
+// IsSystemPod returns whether the pod is a system pod added by AddSystemPod.
+func (node *Node) IsSystemPod(namespace, name string) bool {
+	return node.systemPods[util.PodKeyFromNames(namespace, name)]
+}
+
+// RestorePod adds the pod, restored from a checkpoint with its binding clock and status, to this
+// Node.
+// Returns error if the pod has invalid name.
+func (node *Node) RestorePod(pod *pod.Pod) error {
+	key, err := util.PodKey(pod.ToV1())
+	if err != nil {
+		return err
+	}
+	pod.SetDefaultUsageNoise(node.usageNoise)
+	node.pods[key] = pod
+	node.invalidateNodeInfo()
+
+	return nil
+}
+
 // DeletePod start deleting the given pod from this Node.
 // Returns true if the pod is found in this Node, or false otherwise.
 func (node *Node) DeletePod(clock clock.Clock, podNamespace, podName string) bool {
@@ -117,6 +236,7 @@ func (node *Node) DeletePod(clock clock.Clock, podNamespace, podName string) boo
 	pod, ok := node.pods[key]
 	if ok {
 		pod.Delete(clock)
+		node.invalidateNodeInfo()
 	}
 
 	return ok
@@ -152,13 +272,70 @@ func (node *Node) PodsNum(clock clock.Clock) int64 {
 	return node.runningPodsNum(clock) + node.terminatingPodsNum(clock)
 }
 
+// WorkloadPodsNum returns the number of running or terminating pods on this Node at the given clock,
+// excluding the system pods.
+func (node *Node) WorkloadPodsNum(clock clock.Clock) int64 {
+	num := node.PodsNum(clock)
+	for key := range node.systemPods {
+		if pod, ok := node.pods[key]; ok && (pod.IsRunning(clock) || pod.IsTerminating(clock)) {
+			num--
+		}
+	}
+
+	return num
+}
+
 // GCTerminatedPods deletes terminated or deleted pods at the given clock from this Node.
-func (node *Node) GCTerminatedPods(clock clock.Clock) {
+// Returns the deleted pods.
+func (node *Node) GCTerminatedPods(clock clock.Clock) []*pod.Pod {
+	deleted := []*pod.Pod{}
 	for name, pod := range node.pods {
 		if pod.IsTerminated(clock) || pod.IsDeleted(clock) {
 			delete(node.pods, name)
+			deleted = append(deleted, pod)
 		}
 	}
+	return deleted
+}
+
+// CompletedPods returns the pods on this Node that finished their execution after the clock since and
+// by the clock until, in the order of their keys.
+// The pods deleted or evicted before they finished are not included.
+func (node *Node) CompletedPods(since, until clock.Clock) []*pod.Pod {
+	keys := make([]string, 0, len(node.pods))
+	for key, p := range node.pods {
+		if p.IsTerminated(until) && !p.IsTerminated(since) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	pods := make([]*pod.Pod, 0, len(keys))
+	for _, key := range keys {
+		pods = append(pods, node.pods[key])
+	}
+	return pods
+}
+
+// NextWakeup returns the earliest clock after the given one at which the pods on this Node change
+// by themselves: a pod starts, finishes, ends its grace period, or is evicted by the NoExecute
+// taints after its tolerationSeconds.
+// With the node-pressure eviction, it is the given clock, since the usage of the pods may change
+// at any tick.
+// The second return value is false if nothing changes.
+func (node *Node) NextWakeup(clk clock.Clock) (clock.Clock, bool) {
+	if node.eviction != nil {
+		return clk, true
+	}
+
+	next, found := node.nextTaintEviction(clk)
+	for _, p := range node.pods {
+		if at, ok := p.NextTransition(clk); ok && (!found || at.Before(next)) {
+			next, found = at, true
+		}
+	}
+
+	return next, found
 }
 
 // runningAndTerminatingPodsV1WithStatus returns all running or terminating pods on this Node in
@@ -213,6 +390,18 @@ func (node *Node) terminatingPodsNum(clock clock.Clock) int64 {
 	return num
 }
 
+// startingPodsNum returns the number of all starting pods on this Node at the given clock.
+func (node *Node) startingPodsNum(clock clock.Clock) int64 {
+	num := int64(0)
+	for _, pod := range node.pods {
+		if pod.IsStarting(clock) {
+			num++
+		}
+	}
+
+	return num
+}
+
 // bindingFailedPodsNum returns the number of pods that failed to be started on this Node.
 func (node *Node) bindingFailedPodsNum() int64 {
 	num := int64(0)
@@ -225,6 +414,37 @@ func (node *Node) bindingFailedPodsNum() int64 {
 	return num
 }
 
+// evictedPodsNum returns the number of pods evicted from this Node.
+func (node *Node) evictedPodsNum() int64 {
+	num := int64(0)
+	for _, pod := range node.pods {
+		if pod.IsEvicted() {
+			num++
+		}
+	}
+
+	return num
+}
+
+// qosMetrics returns the number and the total resource usage of the running pods of each QoS class
+// on this Node at the given clock.
+func (node *Node) qosMetrics(clock clock.Clock) (map[v1.PodQOSClass]int64, map[v1.PodQOSClass]v1.ResourceList) {
+	num := map[v1.PodQOSClass]int64{}
+	usage := map[v1.PodQOSClass]v1.ResourceList{}
+	for _, pod := range node.pods {
+		if pod.IsRunning(clock) {
+			qos := pod.QOSClass()
+			num[qos]++
+			if _, ok := usage[qos]; !ok {
+				usage[qos] = v1.ResourceList{}
+			}
+			usage[qos] = util.ResourceListSum(usage[qos], pod.ResourceUsage(clock))
+		}
+	}
+
+	return num, usage
+}
+
 // totalResourceUsage calculates the total resource usage (not request) of all running or
 // terminating pods at the given clock.
 func (node *Node) totalResourceUsage(clock clock.Clock) v1.ResourceList {
@@ -0,0 +1,76 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/pod"
+)
+
+// NodeInfo returns the NodeInfo of this Node at the given clock from its cache, which is updated
+// incrementally instead of being built at every clock: a pod bound to this Node is added to it, and
+// it is rebuilt only once the pods or the status of this Node change otherwise, i.e., a pod starts,
+// finishes, is deleted, or is evicted, or a taint, a condition, or the allocatable resources change.
+// The UsageAnnotation of the node is updated to the resource usage at the given clock.
+// The returned NodeInfo is shared with the later calls and must not be modified; use ToNodeInfo for
+// a copy to modify (e.g., to assume pods on it).
+func (node *Node) NodeInfo(clk clock.Clock) (*nodeinfo.NodeInfo, error) {
+	node.completeImagePulls(clk)
+	node.updateUsageAnnotation(clk)
+	if node.info != nil && !clk.Before(node.infoBuiltAt) &&
+		(node.infoExpiresAt == nil || clk.Before(*node.infoExpiresAt)) {
+		return node.info, nil
+	}
+
+	info := nodeinfo.NewNodeInfo(node.runningAndTerminatingPodsV1WithStatus(clk)...)
+	if err := info.SetNode(node.ToV1()); err != nil {
+		return nil, err
+	}
+	node.info = info
+	node.infoBuiltAt = clk
+	node.infoExpiresAt = nil
+	for _, p := range node.pods {
+		if p.IsRunning(clk) || p.IsTerminating(clk) {
+			node.expireNodeInfoAt(clk, p)
+		}
+	}
+
+	return info, nil
+}
+
+// addToNodeInfo adds the pod bound at the given clock to the cached NodeInfo of this Node, if any.
+func (node *Node) addToNodeInfo(clk clock.Clock, p *pod.Pod) {
+	if node.info == nil {
+		return
+	}
+	node.info.AddPod(p.ToV1())
+	node.expireNodeInfoAt(clk, p)
+}
+
+// expireNodeInfoAt makes the cached NodeInfo of this Node expire by the clock at which the pod
+// changes its phase next after the given clock.
+func (node *Node) expireNodeInfoAt(clk clock.Clock, p *pod.Pod) {
+	if at, ok := p.NextTransition(clk); ok && (node.infoExpiresAt == nil || at.Before(*node.infoExpiresAt)) {
+		node.infoExpiresAt = &at
+	}
+}
+
+// invalidateNodeInfo discards the cached NodeInfo of this Node, which is rebuilt at the next
+// NodeInfo.
+func (node *Node) invalidateNodeInfo() {
+	node.info = nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/clock"
+)
+
+func TestNodeInfoCache(t *testing.T) {
+	clk := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	node := newEvictionNode()
+
+	info, err := node.NodeInfo(clk)
+	assert.NoError(t, err)
+	assert.Len(t, info.Pods(), 0)
+
+	// A bound pod is added to the cache, which is reused until the pod finishes.
+	_, err = node.BindPod(clk, newEvictionPod("pod-0", 0, "1Gi", "1Gi"))
+	assert.NoError(t, err)
+	cached, err := node.NodeInfo(clk.Add(10 * time.Second))
+	assert.NoError(t, err)
+	assert.True(t, info == cached)
+	assert.Len(t, cached.Pods(), 1)
+	assert.Equal(t, int64(1<<30), cached.RequestedResource().Memory)
+
+	generation := cached.GetGeneration()
+	cached, err = node.NodeInfo(clk.Add(20 * time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, generation, cached.GetGeneration())
+
+	// The copy does not share the modifications.
+	copied, err := node.ToNodeInfo(clk.Add(20 * time.Second))
+	assert.NoError(t, err)
+	copied.AddPod(newEvictionPod("pod-1", 0, "1Gi", "1Gi"))
+	assert.Len(t, cached.Pods(), 1)
+
+	info, err = node.NodeInfo(clk.Add(600 * time.Second))
+	assert.NoError(t, err)
+	assert.False(t, info == cached)
+	assert.Len(t, info.Pods(), 0)
+
+	// A taint invalidates the cache.
+	node.AddTaint(clk, v1.Taint{Key: "k", Effect: v1.TaintEffectNoSchedule})
+	cached, err = node.NodeInfo(clk.Add(600 * time.Second))
+	assert.NoError(t, err)
+	assert.False(t, info == cached)
+	taints, err := cached.Taints()
+	assert.NoError(t, err)
+	assert.Len(t, taints, 1)
+
+	// So does a deletion.
+	_, err = node.BindPod(clk.Add(600*time.Second), newEvictionPod("pod-1", 0, "1Gi", "1Gi"))
+	assert.NoError(t, err)
+	info, err = node.NodeInfo(clk.Add(610 * time.Second))
+	assert.NoError(t, err)
+	assert.Len(t, info.Pods(), 1)
+	assert.True(t, node.DeletePod(clk.Add(610*time.Second), "default", "pod-1"))
+	cached, err = node.NodeInfo(clk.Add(610 * time.Second))
+	assert.NoError(t, err)
+	assert.False(t, info == cached)
+	assert.NotNil(t, cached.Pods()[0].DeletionTimestamp)
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"simulator/pkg/clock"
+)
+
+func TestNodeMaxPods(t *testing.T) {
+	clk := clock.NewClock(time.Now())
+	node := newEvictionNode()
+	node.v1.Status.Allocatable = v1.ResourceList{"memory": resource.MustParse("4Gi"), "pods": resource.MustParse("2")}
+
+	for _, name := range []string{"pod-0", "pod-1"} {
+		simPod, err := node.BindPod(clk, newEvictionPod(name, 0, "1Gi", "1Gi"))
+		assert.NoError(t, err)
+		assert.False(t, simPod.HasFailedToStart())
+	}
+	// A terminating pod still counts.
+	assert.True(t, node.DeletePod(clk, "default", "pod-1"))
+	simPod, err := node.BindPod(clk, newEvictionPod("pod-2", 0, "1Gi", "1Gi"))
+	assert.NoError(t, err)
+	assert.True(t, simPod.HasFailedToStart())
+
+	met := node.Metrics(clk)
+	assert.Equal(t, "2", resourceString(met.TotalResourceRequest, v1.ResourcePods))
+	assert.Equal(t, "2Gi", resourceString(met.TotalResourceRequest, v1.ResourceMemory))
+}
@@ -0,0 +1,231 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"sort"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	v1helper "k8s.io/kubernetes/pkg/apis/core/v1/helper"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/pod"
+	"simulator/pkg/util"
+)
+
+// ValidateTaint returns error if the taint has no key or its effect is not supported.
+func ValidateTaint(taint v1.Taint) error {
+	if taint.Key == "" {
+		return strongerrors.InvalidArgument(errors.New("empty key of taint"))
+	}
+	switch taint.Effect {
+	case v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+	default:
+		return strongerrors.InvalidArgument(
+			errors.Errorf("invalid effect %q of taint %s", taint.Effect, taint.Key))
+	}
+
+	return nil
+}
+
+// Taints returns the taints of this Node.
+func (node *Node) Taints() []v1.Taint {
+	return node.v1.Spec.Taints
+}
+
+// AddTaint adds the taint to this Node at the given clock, replacing the one of the same key and
+// effect.
+// The clock is recorded as the TimeAdded of a NoExecute taint, from which the pods tolerating it
+// for a limited time are counted (see EvictIntolerantPods).
+func (node *Node) AddTaint(clk clock.Clock, taint v1.Taint) {
+	if taint.Effect == v1.TaintEffectNoExecute {
+		added := clk.ToMetaV1()
+		taint.TimeAdded = &added
+	} else {
+		taint.TimeAdded = nil
+	}
+
+	taints := make([]v1.Taint, 0, len(node.v1.Spec.Taints)+1)
+	for _, t := range node.v1.Spec.Taints {
+		if !t.MatchTaint(&taint) {
+			taints = append(taints, t)
+		}
+	}
+	node.v1.Spec.Taints = append(taints, taint)
+	node.invalidateNodeInfo()
+}
+
+// RemoveTaint removes the taint of the key and the effect from this Node.
+// Returns true if the taint is found, or false otherwise.
+func (node *Node) RemoveTaint(key string, effect v1.TaintEffect) bool {
+	target := v1.Taint{Key: key, Effect: effect}
+	taints := make([]v1.Taint, 0, len(node.v1.Spec.Taints))
+	for _, t := range node.v1.Spec.Taints {
+		if !t.MatchTaint(&target) {
+			taints = append(taints, t)
+		}
+	}
+	found := len(taints) < len(node.v1.Spec.Taints)
+	node.v1.Spec.Taints = taints
+	node.invalidateNodeInfo()
+
+	return found
+}
+
+// EvictIntolerantPods deletes the running pods on this Node that do not tolerate its NoExecute
+// taints at the given clock, like the taint manager of the node lifecycle controller.
+// A pod tolerating the taints for a limited time (i.e., with tolerationSeconds) is deleted once the
+// shortest of the times has passed since the later of its binding and the latest TimeAdded of the
+// taints.
+// The deleted pods terminate in their grace periods. The system pods are not deleted, like
+// DaemonSet pods, which tolerate the taints of their nodes.
+// Returns the deleted pods, sorted by their keys.
+func (node *Node) EvictIntolerantPods(clk clock.Clock) []*pod.Pod {
+	taints, addedAt := node.noExecuteTaints()
+	if len(taints) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(node.pods))
+	for key := range node.pods {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	evicted := []*pod.Pod{}
+	for _, key := range keys {
+		p := node.pods[key]
+		if !p.IsRunning(clk) || node.systemPods[key] {
+			continue
+		}
+
+		if at, ok := taintEvictionAt(p, taints, addedAt); !ok || clk.Before(at) {
+			continue
+		}
+
+		p.Delete(clk)
+		evicted = append(evicted, p)
+		node.invalidateNodeInfo()
+
+		log.L.Debugf("Node %s: Pod %s evicted by NoExecute taints", node.ToV1().Name, key)
+	}
+
+	return evicted
+}
+
+// EvictIntolerantPod deletes the running pod of the name on this Node at the given clock, like
+// EvictIntolerantPods, e.g., to replay a recorded eviction.
+// Returns the deleted pod, or nil if no such pod is running or it is a system pod.
+func (node *Node) EvictIntolerantPod(clk clock.Clock, namespace, name string) *pod.Pod {
+	p := node.runningPod(clk, namespace, name)
+	if p == nil || node.systemPods[util.PodKeyFromNames(namespace, name)] {
+		return nil
+	}
+
+	p.Delete(clk)
+	node.invalidateNodeInfo()
+	return p
+}
+
+// nextTaintEviction returns the earliest clock after the given one at which a running pod on this
+// Node is evicted by the NoExecute taints after its tolerationSeconds.
+// The second return value is false if none is.
+func (node *Node) nextTaintEviction(clk clock.Clock) (clock.Clock, bool) {
+	taints, addedAt := node.noExecuteTaints()
+	if len(taints) == 0 {
+		return clock.Clock{}, false
+	}
+
+	var next clock.Clock
+	found := false
+	for key, p := range node.pods {
+		if !p.IsRunning(clk) || node.systemPods[key] {
+			continue
+		}
+		if at, ok := taintEvictionAt(p, taints, addedAt); ok && clk.Before(at) && (!found || at.Before(next)) {
+			next, found = at, true
+		}
+	}
+
+	return next, found
+}
+
+// noExecuteTaints returns the NoExecute taints of this Node, and the latest clock at which one of
+// them was added, or nil if unknown.
+func (node *Node) noExecuteTaints() ([]v1.Taint, *clock.Clock) {
+	taints := []v1.Taint{}
+	var addedAt *clock.Clock
+	for _, t := range node.v1.Spec.Taints {
+		if t.Effect != v1.TaintEffectNoExecute {
+			continue
+		}
+		taints = append(taints, t)
+		if t.TimeAdded != nil {
+			added := clock.NewClockWithMetaV1(*t.TimeAdded)
+			if addedAt == nil || addedAt.Before(added) {
+				addedAt = &added
+			}
+		}
+	}
+
+	return taints, addedAt
+}
+
+// taintEvictionAt returns the clock from which the pod is evicted by the NoExecute taints added at
+// the clock addedAt, i.e., its binding if it does not tolerate them, or the end of its
+// tolerationSeconds since the later of its binding and addedAt.
+// The second return value is false if the pod tolerates the taints forever.
+func taintEvictionAt(p *pod.Pod, taints []v1.Taint, addedAt *clock.Clock) (clock.Clock, bool) {
+	tolerated, tolerations := v1helper.GetMatchingTolerations(taints, p.ToV1().Spec.Tolerations)
+	if !tolerated {
+		return p.BoundAt(), true
+	}
+
+	period, limited := minTolerationPeriod(tolerations)
+	if !limited {
+		return clock.Clock{}, false
+	}
+	since := p.BoundAt()
+	if addedAt != nil && since.Before(*addedAt) {
+		since = *addedAt
+	}
+
+	return since.Add(period), true
+}
+
+// minTolerationPeriod returns the shortest period for which the tolerations tolerate the taints.
+// The second return value is false if they tolerate the taints forever.
+func minTolerationPeriod(tolerations []v1.Toleration) (time.Duration, bool) {
+	var period time.Duration
+	limited := false
+	for _, t := range tolerations {
+		if t.TolerationSeconds == nil {
+			continue
+		}
+		seconds := time.Duration(*t.TolerationSeconds) * time.Second
+		if seconds < 0 {
+			seconds = 0
+		}
+		if !limited || seconds < period {
+			period, limited = seconds, true
+		}
+	}
+
+	return period, limited
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/clock"
+)
+
+func TestNodeTaints(t *testing.T) {
+	start := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	node := newEvictionNode()
+
+	node.AddTaint(start, v1.Taint{Key: "gpu", Effect: v1.TaintEffectNoSchedule})
+	node.AddTaint(start, v1.Taint{Key: "gpu", Value: "v100", Effect: v1.TaintEffectNoSchedule})
+	node.AddTaint(start, v1.Taint{Key: "gpu", Effect: v1.TaintEffectNoExecute})
+	taints := node.Taints()
+	assert.Len(t, taints, 2)
+	assert.Equal(t, "v100", taints[0].Value)
+	assert.Nil(t, taints[0].TimeAdded)
+	assert.Equal(t, start, clock.NewClockWithMetaV1(*taints[1].TimeAdded))
+
+	assert.True(t, node.RemoveTaint("gpu", v1.TaintEffectNoExecute))
+	assert.False(t, node.RemoveTaint("gpu", v1.TaintEffectNoExecute))
+	assert.Len(t, node.Taints(), 1)
+
+	assert.NoError(t, ValidateTaint(v1.Taint{Key: "gpu", Effect: v1.TaintEffectPreferNoSchedule}))
+	assert.EqualError(t, ValidateTaint(v1.Taint{Effect: v1.TaintEffectNoSchedule}), "empty key of taint")
+	assert.EqualError(t, ValidateTaint(v1.Taint{Key: "gpu"}), `invalid effect "" of taint gpu`)
+}
+
+func TestNodeEvictIntolerantPods(t *testing.T) {
+	start := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	node := newEvictionNode()
+
+	seconds := int64(60)
+	tolerateForever := v1.Toleration{Key: "maintenance", Operator: v1.TolerationOpExists}
+	tolerateMinute := v1.Toleration{
+		Key: "maintenance", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoExecute,
+		TolerationSeconds: &seconds,
+	}
+	for name, tolerations := range map[string][]v1.Toleration{
+		"intolerant": nil,
+		"forever":    {tolerateForever},
+		"minute":     {tolerateMinute},
+	} {
+		p := newEvictionPod(name, 0, "512Mi", "512Mi")
+		p.Spec.Tolerations = tolerations
+		_, err := node.BindPod(start, p)
+		assert.NoError(t, err)
+	}
+	system := newEvictionPod("system", 0, "512Mi", "512Mi")
+	_, err := node.AddSystemPod(start, system)
+	assert.NoError(t, err)
+
+	// NoSchedule taints do not evict the running pods.
+	clk := start.Add(10 * time.Second)
+	node.AddTaint(clk, v1.Taint{Key: "gpu", Effect: v1.TaintEffectNoSchedule})
+	assert.Empty(t, node.EvictIntolerantPods(clk))
+
+	node.AddTaint(clk, v1.Taint{Key: "maintenance", Effect: v1.TaintEffectNoExecute})
+	evicted := node.EvictIntolerantPods(clk)
+	assert.Len(t, evicted, 1)
+	assert.Equal(t, "intolerant", evicted[0].ToV1().Name)
+	assert.True(t, evicted[0].IsTerminating(clk))
+
+	// The grace period of the evicted pod ends, then the tolerating pod is evicted.
+	wakeup, ok := node.NextWakeup(clk)
+	assert.True(t, ok)
+	assert.Equal(t, clk.Add(30*time.Second), wakeup)
+	wakeup, _ = node.NextWakeup(wakeup)
+	assert.Equal(t, clk.Add(60*time.Second), wakeup)
+
+	// The tolerationSeconds is counted from the clock at which the taint was added.
+	assert.Empty(t, node.EvictIntolerantPods(clk.Add(59*time.Second)))
+	evicted = node.EvictIntolerantPods(clk.Add(60 * time.Second))
+	assert.Len(t, evicted, 1)
+	assert.Equal(t, "minute", evicted[0].ToV1().Name)
+
+	assert.Empty(t, node.EvictIntolerantPods(clk.Add(5*time.Minute)))
+	assert.True(t, node.Pod("default", "forever").IsRunning(clk.Add(5*time.Minute)))
+	assert.True(t, node.Pod("default", "system").IsRunning(clk.Add(5*time.Minute)))
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"encoding/json"
+
+	"github.com/containerd/containerd/log"
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/clock"
+)
+
+// UsageAnnotation is the annotation key of a node that holds the total resource usage (not request)
+// of the running and terminating pods on it, as a JSON object of quantities (e.g.,
+// {"cpu":"1500m","memory":"3Gi"}).
+// It is updated at each clock the node is passed to the scheduler (see ToNodeInfo), so that
+// scheduler plugins can place pods by the actual utilization rather than the requests (see
+// ResourceUsageOf).
+const UsageAnnotation = "simulator/node-usage"
+
+// ResourceUsageOf returns the total resource usage of the pods on the node in its UsageAnnotation.
+// The second return value is false if the node does not have a valid annotation.
+func ResourceUsageOf(node *v1.Node) (v1.ResourceList, bool) {
+	annot, ok := node.Annotations[UsageAnnotation]
+	if !ok {
+		return nil, false
+	}
+
+	usage := v1.ResourceList{}
+	if err := json.Unmarshal([]byte(annot), &usage); err != nil {
+		return nil, false
+	}
+
+	return usage, true
+}
+
+// updateUsageAnnotation sets the UsageAnnotation of this Node to the total resource usage of its
+// pods at the given clock.
+func (node *Node) updateUsageAnnotation(clock clock.Clock) {
+	usage, err := json.Marshal(node.totalResourceUsage(clock))
+	if err != nil {
+		log.L.Warnf("Node %s: failed to encode the resource usage: %s", node.v1.Name, err.Error())
+		return
+	}
+
+	if node.v1.Annotations == nil {
+		node.v1.Annotations = map[string]string{}
+	}
+	node.v1.Annotations[UsageAnnotation] = string(usage)
+}
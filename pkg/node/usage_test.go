@@ -0,0 +1,55 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/clock"
+)
+
+func TestNodeUsageAnnotation(t *testing.T) {
+	clk := clock.NewClock(time.Now())
+	node := newEvictionNode()
+
+	_, ok := ResourceUsageOf(node.ToV1())
+	assert.False(t, ok)
+
+	_, err := node.BindPod(clk, newEvictionPod("pod-0", 0, "2Gi", "1Gi"))
+	assert.NoError(t, err)
+	_, err = node.BindPod(clk, newEvictionPod("pod-1", 0, "1Gi", "512Mi"))
+	assert.NoError(t, err)
+
+	info, err := node.ToNodeInfo(clk)
+	assert.NoError(t, err)
+	usage, ok := ResourceUsageOf(info.Node())
+	assert.True(t, ok)
+	assert.Equal(t, "1536Mi", resourceString(usage, v1.ResourceMemory))
+
+	// The annotation follows the clock, after the pods finish.
+	info, err = node.ToNodeInfo(clk.Add(time.Hour))
+	assert.NoError(t, err)
+	usage, ok = ResourceUsageOf(info.Node())
+	assert.True(t, ok)
+	assert.Equal(t, "", resourceString(usage, v1.ResourceMemory))
+
+	node.ToV1().Annotations[UsageAnnotation] = "invalid"
+	_, ok = ResourceUsageOf(node.ToV1())
+	assert.False(t, ok)
+}
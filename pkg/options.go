@@ -0,0 +1,151 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubesim
+
+import (
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/config"
+	"simulator/pkg/metrics"
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
+	"simulator/pkg/submitter"
+	"simulator/pkg/trace"
+)
+
+// defaultTick is the tick in seconds of a KubeSim whose config has no tick.
+const defaultTick = 10
+
+// Option configures a KubeSim created with NewKubeSim.
+type Option func(*options)
+
+type options struct {
+	conf       *config.Config
+	nodes      []*v1.Node
+	queue      queue.PodQueue
+	scheduler  scheduler.Scheduler
+	clock      *clock.Clock
+	writers    []metrics.Writer
+	submitters []namedSubmitter
+	// globalLogLevel is whether the level of the global logger is set (see WithGlobalLogLevel).
+	globalLogLevel bool
+	replayer       *trace.Replayer
+}
+
+type namedSubmitter struct {
+	name      string
+	submitter submitter.Submitter
+}
+
+// WithConfig configures the KubeSim with the config, e.g., read from a file with
+// NewKubeSimFromConfigPath.
+// The other options override or add to the config.
+func WithConfig(conf *config.Config) Option {
+	return func(o *options) {
+		o.conf = conf
+	}
+}
+
+// WithNodes adds the nodes to the cluster, in addition to those of the config.
+// The nodes are copied, and get the node-level settings of the config (e.g., overcommit and usage
+// noise). Their capacity defaults to their allocatable resources.
+func WithNodes(nodes ...*v1.Node) Option {
+	return func(o *options) {
+		o.nodes = append(o.nodes, nodes...)
+	}
+}
+
+// WithQueue sets the queue of the pending pods (default: the queue of the config, or
+// queue.NewPriorityQueue()).
+func WithQueue(queue queue.PodQueue) Option {
+	return func(o *options) {
+		o.queue = queue
+	}
+}
+
+// WithScheduler sets the scheduler.
+// If the config has schedulerConfig, the scheduler built from it is registered with
+// KubeSchedulerConfigName; without this option, it is the scheduler.
+func WithScheduler(sched scheduler.Scheduler) Option {
+	return func(o *options) {
+		o.scheduler = sched
+	}
+}
+
+// WithClock sets the clock at which the simulation starts, overriding startClock of the config
+// (default: the current time).
+func WithClock(clk clock.Clock) Option {
+	return func(o *options) {
+		o.clock = &clk
+	}
+}
+
+// WithMetricsWriter adds the writer of the metrics, in addition to the metrics loggers of the
+// config. The writer also receives the events if it implements metrics.EventWriter.
+func WithMetricsWriter(writer metrics.Writer) Option {
+	return func(o *options) {
+		o.writers = append(o.writers, writer)
+	}
+}
+
+// WithSubmitter adds the submitter with the name, as AddSubmitter does.
+// It is needed to restore the state of the submitter from a snapshot with NewKubeSimFromSnapshot.
+func WithSubmitter(name string, subm submitter.Submitter) Option {
+	return func(o *options) {
+		o.submitters = append(o.submitters, namedSubmitter{name: name, submitter: subm})
+	}
+}
+
+// WithGlobalLogLevel sets the level of the global logger to the logLevel of the config (default:
+// info), which is left as is without this option, e.g., for a program embedding the KubeSim.
+func WithGlobalLogLevel() Option {
+	return func(o *options) {
+		o.globalLogLevel = true
+	}
+}
+
+// WithReplayer makes the KubeSim replay the trace of the replayer, with the config of the recorded
+// run: the submitters of the replayer are added with the names of the recorded ones, and replay
+// their events and node changes in place of the generators and the faults of the config.
+// With the scheduler of the replayer given by WithScheduler, the recorded scheduling decisions are
+// replayed as well, and so are the other node changes (e.g., by the autoscaler, which does not scale
+// the node groups by itself) and the pods killed by their nodes (before the evictions of the
+// KubeSim); with another scheduler, the recorded submissions are re-scheduled, and the autoscaler
+// and the evictions act on the new decisions.
+func WithReplayer(replayer *trace.Replayer) Option {
+	return func(o *options) {
+		o.replayer = replayer
+	}
+}
+
+// buildOptions applies the options over the defaults.
+func buildOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.conf == nil {
+		o.conf = &config.Config{}
+	}
+	if o.conf.Tick == 0 {
+		conf := *o.conf
+		conf.Tick = defaultTick
+		o.conf = &conf
+	}
+
+	return o
+}
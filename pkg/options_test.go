@@ -0,0 +1,142 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubesim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/config"
+	"simulator/pkg/metrics"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
+	"simulator/pkg/submitter"
+)
+
+// oneShotSubmitter submits the pods at the first call, then terminates.
+type oneShotSubmitter struct {
+	pods []*v1.Pod
+	done bool
+}
+
+func (s *oneShotSubmitter) Submit(
+	_ context.Context, _ clock.Clock, _ algorithm.NodeLister, _ metrics.Metrics,
+) ([]submitter.Event, error) {
+
+	events := []submitter.Event{}
+	if !s.done {
+		for _, p := range s.pods {
+			events = append(events, &submitter.SubmitEvent{Pod: p})
+		}
+		s.done = true
+	}
+	return append(events, &submitter.TerminateSubmitterEvent{}), nil
+}
+
+type recordingWriter struct {
+	metrics []metrics.Metrics
+}
+
+func (w *recordingWriter) Write(met *metrics.Metrics) error {
+	w.metrics = append(w.metrics, *met)
+	return nil
+}
+
+func TestNewKubeSimWithOptions(t *testing.T) {
+	t0 := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-0"},
+		Status: v1.NodeStatus{Allocatable: v1.ResourceList{
+			"cpu": resource.MustParse("2"), "memory": resource.MustParse("4Gi"),
+		}},
+	}
+	binPacking := scheduler.NewBinPackingScheduler()
+	writer := &recordingWriter{}
+
+	// No config is needed.
+	k, err := NewKubeSim(WithNodes(node), WithClock(t0), WithScheduler(&binPacking),
+		WithMetricsWriter(writer))
+	assert.NoError(t, err)
+	assert.Equal(t, defaultTick*time.Second, k.tick)
+	assert.IsType(t, &queue.PriorityQueue{}, k.pendingPods)
+	assert.Nil(t, node.Status.Capacity, "the given node is modified")
+
+	nodes, _ := k.List()
+	assert.Len(t, nodes, 1)
+	assert.Equal(t, "2", nodes[0].Status.Capacity.Cpu().String())
+	assert.Equal(t, int64(config.DefaultMaxPods), nodes[0].Status.Allocatable.Pods().Value())
+
+	k.AddSubmitter("OneShot", &oneShotSubmitter{pods: []*v1.Pod{newCheckpointPod("pod-0")}})
+	assert.NoError(t, k.Run(context.Background()))
+
+	assert.NotEmpty(t, writer.metrics)
+	assert.Equal(t, t0.Add(2*k.tick).ToRFC3339(), writer.metrics[0][metrics.ClockKey])
+	podsMet := writer.metrics[0][metrics.PodsMetricsKey].(map[string]pod.Metrics)
+	assert.Equal(t, "node-0", podsMet["default/pod-0"].Node)
+}
+
+func TestNewKubeSimOptionErrors(t *testing.T) {
+	_, err := NewKubeSim(WithNodes(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-0"}}))
+	assert.EqualError(t, err, "neither WithScheduler nor schedulerConfig given")
+
+	binPacking := scheduler.NewBinPackingScheduler()
+	_, err = NewKubeSim(WithConfig(newCheckpointConfig(10)), WithScheduler(&binPacking),
+		WithNodes(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-0"}}))
+	assert.EqualError(t, err, "duplicate node node-0")
+
+	_, err = NewKubeSim(WithConfig(&config.Config{Queue: &config.QueueConfig{Kind: "lifo"}}),
+		WithScheduler(&binPacking))
+	assert.EqualError(t, err, `queue kind "lifo" is not supported`)
+
+	// WithQueue overrides the queue of the config.
+	k, err := NewKubeSim(WithConfig(&config.Config{Queue: &config.QueueConfig{Kind: "fairshare"}}),
+		WithScheduler(&binPacking))
+	assert.NoError(t, err)
+	assert.IsType(t, &queue.FairShareQueue{}, k.pendingPods)
+	k, err = NewKubeSim(WithConfig(&config.Config{Queue: &config.QueueConfig{Kind: "fairshare"}}),
+		WithScheduler(&binPacking), WithQueue(queue.NewFIFOQueue()))
+	assert.NoError(t, err)
+	assert.IsType(t, &queue.FIFOQueue{}, k.pendingPods)
+}
+
+func TestNewKubeSimGlobalLogLevel(t *testing.T) {
+	level := logrus.GetLevel()
+	defer logrus.SetLevel(level)
+	logrus.SetLevel(logrus.WarnLevel)
+
+	// The global level is left as is without WithGlobalLogLevel.
+	binPacking := scheduler.NewBinPackingScheduler()
+	_, err := NewKubeSim(WithConfig(&config.Config{LogLevel: "debug"}), WithScheduler(&binPacking))
+	assert.NoError(t, err)
+	assert.Equal(t, logrus.WarnLevel, logrus.GetLevel())
+
+	_, err = NewKubeSim(WithConfig(&config.Config{LogLevel: "debug"}), WithScheduler(&binPacking),
+		WithGlobalLogLevel())
+	assert.NoError(t, err)
+	assert.Equal(t, logrus.DebugLevel, logrus.GetLevel())
+
+	_, err = NewKubeSim(WithConfig(&config.Config{LogLevel: "verbose"}), WithScheduler(&binPacking))
+	assert.Error(t, err)
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pod
+
+import (
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/clock"
+)
+
+// DeadlineAnnotation is the annotation key of a pod that specifies the deadline by which the pod
+// should finish, either in RFC3339 format or as a duration after the creation of the pod (e.g.,
+// "30m").
+const DeadlineAnnotation = "simulator/deadline"
+
+// Deadline returns the deadline of the given pod.
+// The second return value is false if the pod does not have the DeadlineAnnotation.
+// Returns error if failed to parse the annotation.
+func Deadline(pod *v1.Pod) (clock.Clock, bool, error) {
+	annot, ok := pod.Annotations[DeadlineAnnotation]
+	if !ok {
+		return clock.Clock{}, false, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, annot); err == nil {
+		return clock.NewClock(t), true, nil
+	}
+
+	dur, err := time.ParseDuration(annot)
+	if err != nil {
+		return clock.Clock{}, false, strongerrors.InvalidArgument(
+			errors.Errorf("invalid %s annotation %q", DeadlineAnnotation, annot))
+	}
+
+	return clock.NewClockWithMetaV1(pod.CreationTimestamp).Add(dur), true, nil
+}
+
+// MetDeadline returns whether this Pod finished by its deadline.
+// The second return value is false if this Pod does not have a valid deadline or has not finished
+// spontaneously at the given clock.
+func (pod *Pod) MetDeadline(clock clock.Clock) (bool, bool) {
+	if !pod.IsTerminated(clock) {
+		return false, false
+	}
+
+	deadline, ok, err := Deadline(pod.ToV1())
+	if err != nil || !ok {
+		return false, false
+	}
+
+	return !deadline.Before(pod.finishAt()), true
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pod
+
+import (
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	v1helper "k8s.io/kubernetes/pkg/apis/core/v1/helper"
+)
+
+// InvalidDeviceResourcesReason is the reason of a pod rejected since its device resources are
+// invalid (see AdmitDeviceResources).
+const InvalidDeviceResourcesReason = "InvalidDeviceResources"
+
+// IsDeviceResource returns whether the resource is allocated to pods exclusively and cannot be
+// overcommitted, i.e., an extended resource (e.g., nvidia.com/gpu) or hugepages.
+func IsDeviceResource(rsrc v1.ResourceName) bool {
+	return !v1helper.IsOvercommitAllowed(rsrc)
+}
+
+// AdmitDeviceResources admits the device resources (see IsDeviceResource) of the containers of the
+// pod, like the API server: the request of a device resource defaults to its limit, and its limit
+// to its request, since workloads converted from traces often have only the requests.
+// Returns error if a request differs from its limit, or an extended resource is not an integer.
+func AdmitDeviceResources(v1Pod *v1.Pod) error {
+	for i := range v1Pod.Spec.Containers {
+		c := &v1Pod.Spec.Containers[i]
+
+		for rsrc, limit := range c.Resources.Limits {
+			if !IsDeviceResource(rsrc) {
+				continue
+			}
+			if _, ok := c.Resources.Requests[rsrc]; !ok {
+				if c.Resources.Requests == nil {
+					c.Resources.Requests = v1.ResourceList{}
+				}
+				c.Resources.Requests[rsrc] = limit.DeepCopy()
+			}
+		}
+
+		for rsrc, req := range c.Resources.Requests {
+			if !IsDeviceResource(rsrc) {
+				continue
+			}
+			if v1helper.IsExtendedResourceName(rsrc) && req.MilliValue()%1000 != 0 {
+				return strongerrors.InvalidArgument(errors.Errorf(
+					"non-integer %s request %s of container %s", rsrc, req.String(), c.Name))
+			}
+			limit, ok := c.Resources.Limits[rsrc]
+			if !ok {
+				if c.Resources.Limits == nil {
+					c.Resources.Limits = v1.ResourceList{}
+				}
+				c.Resources.Limits[rsrc] = req.DeepCopy()
+			} else if limit.Cmp(req) != 0 {
+				return strongerrors.InvalidArgument(errors.Errorf(
+					"%s request %s of container %s differs from its limit %s",
+					rsrc, req.String(), c.Name, limit.String()))
+			}
+		}
+	}
+
+	return nil
+}
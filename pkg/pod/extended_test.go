@@ -0,0 +1,92 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pod
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"simulator/pkg/clock"
+)
+
+func TestIsDeviceResource(t *testing.T) {
+	assert.True(t, IsDeviceResource("nvidia.com/gpu"))
+	assert.True(t, IsDeviceResource("hugepages-2Mi"))
+	assert.False(t, IsDeviceResource(v1.ResourceCPU))
+	assert.False(t, IsDeviceResource(v1.ResourceMemory))
+}
+
+func TestAdmitDeviceResources(t *testing.T) {
+	newPod := func(containers ...v1.ResourceRequirements) *v1.Pod {
+		pod := &v1.Pod{}
+		for i, resources := range containers {
+			pod.Spec.Containers = append(pod.Spec.Containers,
+				v1.Container{Name: "c" + strconv.Itoa(i), Resources: resources})
+		}
+		return pod
+	}
+	gpus := func(n string) v1.ResourceList {
+		return v1.ResourceList{"nvidia.com/gpu": resource.MustParse(n)}
+	}
+
+	// The request defaults to the limit, and the limit to the request.
+	pod := newPod(v1.ResourceRequirements{Limits: gpus("2")}, v1.ResourceRequirements{Requests: gpus("1")})
+	assert.NoError(t, AdmitDeviceResources(pod))
+	assert.Equal(t, gpus("2"), pod.Spec.Containers[0].Resources.Requests)
+	assert.Equal(t, gpus("1"), pod.Spec.Containers[1].Resources.Limits)
+
+	// cpu is not defaulted.
+	pod = newPod(v1.ResourceRequirements{Limits: v1.ResourceList{"cpu": resource.MustParse("1")}})
+	assert.NoError(t, AdmitDeviceResources(pod))
+	assert.Nil(t, pod.Spec.Containers[0].Resources.Requests)
+
+	pod = newPod(v1.ResourceRequirements{Requests: gpus("500m")})
+	assert.EqualError(t, AdmitDeviceResources(pod), "non-integer nvidia.com/gpu request 500m of container c0")
+	pod = newPod(v1.ResourceRequirements{Requests: gpus("1"), Limits: gpus("2")})
+	assert.EqualError(t, AdmitDeviceResources(pod),
+		"nvidia.com/gpu request 1 of container c0 differs from its limit 2")
+}
+
+func TestPodDeviceResourceUsage(t *testing.T) {
+	start := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	v1Pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod",
+			Namespace: "default",
+			Annotations: map[string]string{"simSpec": `
+- seconds: 100
+  resourceUsage:
+    cpu: 2
+    nvidia.com/gpu: 3
+`},
+		},
+		Spec: v1.PodSpec{Containers: []v1.Container{{Resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{"cpu": resource.MustParse("1"), "nvidia.com/gpu": resource.MustParse("2")},
+		}}}},
+	}
+
+	// The GPU usage is bounded by the GPUs allocated to the pod, unlike the cpu usage without limits.
+	simPod, err := NewPod(v1Pod, start, Ok, "node")
+	assert.NoError(t, err)
+	usage := simPod.ResourceUsage(start.Add(10 * time.Second))
+	assert.Equal(t, "2", resourceString(usage, v1.ResourceCPU))
+	assert.Equal(t, "2", resourceString(usage, "nvidia.com/gpu"))
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pod
+
+import (
+	"strconv"
+
+	"github.com/containerd/containerd/log"
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/util"
+)
+
+const (
+	// GroupNameLabel is the label key of a pod that names the pod group the pod belongs to.
+	// Same as the one of the coscheduling plugin in kubernetes-sigs/scheduler-plugins.
+	GroupNameLabel = "pod-group.scheduling.sigs.k8s.io/name"
+
+	// GroupMinAvailableLabel is the label key of a pod that specifies the minimum number of pods in
+	// the pod group that must be scheduled together (minMember).
+	GroupMinAvailableLabel = "pod-group.scheduling.sigs.k8s.io/min-available"
+)
+
+// GroupOf returns the key of the pod group of the given pod (namespace/name), and its
+// minAvailable, which is 1 if the GroupMinAvailableLabel is invalid.
+// Returns empty string if the pod does not belong to any group.
+func GroupOf(pod *v1.Pod) (string, int) {
+	name, ok := pod.Labels[GroupNameLabel]
+	if !ok || name == "" {
+		return "", 0
+	}
+
+	minAvailable, err := strconv.Atoi(pod.Labels[GroupMinAvailableLabel])
+	if err != nil {
+		log.L.Warnf("Invalid %s label of pod %s", GroupMinAvailableLabel,
+			util.PodKeyFromNames(pod.Namespace, pod.Name))
+		minAvailable = 1
+	}
+
+	return util.PodKeyFromNames(pod.Namespace, name), minAvailable
+}
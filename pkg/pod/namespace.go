@@ -0,0 +1,308 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pod
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	v1helper "k8s.io/kubernetes/pkg/apis/core/v1/helper"
+
+	"simulator/pkg/util"
+)
+
+// LimitRange is the LimitRange of the containers of the pods in a namespace.
+type LimitRange struct {
+	// Default is the default limit of each resource of a container not limiting it.
+	Default v1.ResourceList
+	// DefaultRequest is the default request of each resource of a container not requesting it.
+	// A resource not in it defaults to Default.
+	DefaultRequest v1.ResourceList
+	// Min is the minimum request of each resource of a container.
+	Min v1.ResourceList
+	// Max is the maximum limit of each resource of a container.
+	Max v1.ResourceList
+}
+
+// Namespace is a namespace of pods with its ResourceQuota and LimitRange.
+type Namespace struct {
+	Name string
+	// Quota is the hard limits of the ResourceQuota of the total usage of the pods in this Namespace
+	// (see QuotaUsage), or nil if unlimited.
+	Quota v1.ResourceList
+	// LimitRange is the LimitRange of the containers, or nil if unlimited.
+	LimitRange *LimitRange
+}
+
+// QuotaExceededReason is the reason of a pod rejected since it exceeds the ResourceQuota of its
+// namespace.
+const QuotaExceededReason = "QuotaExceeded"
+
+// LimitRangeViolatedReason is the reason of a pod rejected since it violates the LimitRange of its
+// namespace.
+const LimitRangeViolatedReason = "LimitRangeViolated"
+
+// computeQuotaResources are the compute resources tracked by a ResourceQuota as requests.<name> or
+// <name>, and as limits.<name>.
+var computeQuotaResources = []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory, v1.ResourceEphemeralStorage}
+
+// Namespaces admits the pods by the LimitRanges and the ResourceQuotas of their namespaces, like the
+// LimitRanger and the ResourceQuota admission controllers.
+// The pods of the namespaces not in it are unlimited.
+type Namespaces struct {
+	namespaces map[string]Namespace
+}
+
+// NewNamespaces creates a new Namespaces of the namespaces.
+// The Default of a LimitRange defaults to its Max, as in Kubernetes.
+// Returns error if a namespace has an empty or duplicate name, its ResourceQuota has a resource not
+// supported, or its LimitRange has a default less than the minimum or greater than the maximum.
+func NewNamespaces(namespaces []Namespace) (*Namespaces, error) {
+	ns := &Namespaces{namespaces: map[string]Namespace{}}
+	for _, n := range namespaces {
+		if n.Name == "" {
+			return nil, strongerrors.InvalidArgument(errors.New("name of a namespace must not be empty"))
+		}
+		if _, ok := ns.namespaces[n.Name]; ok {
+			return nil, strongerrors.InvalidArgument(errors.Errorf("duplicate namespace %s", n.Name))
+		}
+		for rsrc := range n.Quota {
+			if !isQuotaResource(rsrc) {
+				return nil, strongerrors.InvalidArgument(
+					errors.Errorf("resource %s of ResourceQuota of namespace %s is not supported", rsrc, n.Name))
+			}
+		}
+		if n.LimitRange != nil {
+			lr, err := normalizeLimitRange(*n.LimitRange)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid LimitRange of namespace %s", n.Name)
+			}
+			n.LimitRange = &lr
+		}
+		ns.namespaces[n.Name] = n
+	}
+
+	return ns, nil
+}
+
+// HasQuota returns whether the namespace has a ResourceQuota.
+func (ns *Namespaces) HasQuota(namespace string) bool {
+	return ns.namespaces[namespace].Quota != nil
+}
+
+// ApplyLimitRange sets the default limits and requests of the LimitRange of the namespace of the
+// pod to its containers not specifying them, after the requests not specified default to the limits
+// as in the API server.
+// Returns error if a container of the pod violates the minimum or the maximum of the LimitRange.
+func (ns *Namespaces) ApplyLimitRange(v1Pod *v1.Pod) error {
+	lr := ns.namespaces[v1Pod.Namespace].LimitRange
+	if lr == nil {
+		return nil
+	}
+
+	for i := range v1Pod.Spec.Containers {
+		c := &v1Pod.Spec.Containers[i]
+		defaultResources(&c.Resources.Requests, c.Resources.Limits)
+		defaultResources(&c.Resources.Limits, lr.Default)
+		defaultResources(&c.Resources.Requests, lr.DefaultRequest)
+
+		for _, rsrc := range sortedResourceNames(lr.Min) {
+			min := lr.Min[rsrc]
+			req, ok := c.Resources.Requests[rsrc]
+			if !ok {
+				return strongerrors.Forbidden(errors.Errorf(
+					"minimum %s usage per container is %s, but container %s has no request",
+					rsrc, min.String(), c.Name))
+			}
+			if req.Cmp(min) < 0 {
+				return strongerrors.Forbidden(errors.Errorf(
+					"minimum %s usage per container is %s, but request of container %s is %s",
+					rsrc, min.String(), c.Name, req.String()))
+			}
+		}
+		for _, rsrc := range sortedResourceNames(lr.Max) {
+			max := lr.Max[rsrc]
+			limit, ok := c.Resources.Limits[rsrc]
+			if !ok {
+				return strongerrors.Forbidden(errors.Errorf(
+					"maximum %s usage per container is %s, but container %s has no limit",
+					rsrc, max.String(), c.Name))
+			}
+			if limit.Cmp(max) > 0 {
+				return strongerrors.Forbidden(errors.Errorf(
+					"maximum %s usage per container is %s, but limit of container %s is %s",
+					rsrc, max.String(), c.Name, limit.String()))
+			}
+		}
+	}
+
+	return nil
+}
+
+// CheckQuota returns the usage of the ResourceQuota of the namespace of the pod by the pod (see
+// QuotaUsage), given the usage by the other pods in the namespace.
+// Returns nil without error if the namespace has no ResourceQuota, or error if the pod exceeds it,
+// or a container of the pod does not specify a compute resource that it tracks.
+func (ns *Namespaces) CheckQuota(v1Pod *v1.Pod, used v1.ResourceList) (v1.ResourceList, error) {
+	hard := ns.namespaces[v1Pod.Namespace].Quota
+	if hard == nil {
+		return nil, nil
+	}
+
+	for _, c := range v1Pod.Spec.Containers {
+		for _, rsrc := range computeQuotaResources {
+			_, requested := c.Resources.Requests[rsrc]
+			_, limited := c.Resources.Limits[rsrc]
+			if !requested && (hasResource(hard, rsrc) || hasResource(hard, "requests."+rsrc)) {
+				return nil, strongerrors.Forbidden(errors.Errorf(
+					"failed quota: container %s must specify requests.%s", c.Name, rsrc))
+			}
+			if !limited && hasResource(hard, "limits."+rsrc) {
+				return nil, strongerrors.Forbidden(errors.Errorf(
+					"failed quota: container %s must specify limits.%s", c.Name, rsrc))
+			}
+		}
+	}
+
+	usage := QuotaUsage(v1Pod)
+	exceeded := []string{}
+	for _, rsrc := range sortedResourceNames(hard) {
+		req, ok := usage[rsrc]
+		if !ok {
+			continue
+		}
+		total := used[rsrc].DeepCopy()
+		total.Add(req)
+		if limit := hard[rsrc]; total.Cmp(limit) > 0 {
+			u := used[rsrc]
+			exceeded = append(exceeded, fmt.Sprintf("%s (requested %s, used %s, limited %s)",
+				rsrc, req.String(), u.String(), limit.String()))
+		}
+	}
+	if len(exceeded) > 0 {
+		return nil, strongerrors.Forbidden(
+			errors.Errorf("exceeded quota: %s", strings.Join(exceeded, ", ")))
+	}
+
+	return usage, nil
+}
+
+// QuotaUsage returns the usage of a ResourceQuota by the pod: 1 of pods and count/pods, the total
+// requests of the compute resources as requests.<name> and <name>, their total limits as
+// limits.<name>, and the total requests of the extended resources and hugepages as
+// requests.<name>.
+func QuotaUsage(v1Pod *v1.Pod) v1.ResourceList {
+	usage := v1.ResourceList{}
+	usage[v1.ResourcePods] = *resource.NewQuantity(1, resource.DecimalSI)
+	usage["count/pods"] = *resource.NewQuantity(1, resource.DecimalSI)
+
+	requests := util.PodTotalResourceRequests(v1Pod)
+	limits := v1.ResourceList{}
+	for _, c := range v1Pod.Spec.Containers {
+		limits = util.ResourceListSum(limits, c.Resources.Limits)
+	}
+
+	for _, rsrc := range computeQuotaResources {
+		if q, ok := requests[rsrc]; ok {
+			usage[rsrc] = q.DeepCopy()
+			usage["requests."+rsrc] = q.DeepCopy()
+		}
+		if q, ok := limits[rsrc]; ok {
+			usage["limits."+rsrc] = q.DeepCopy()
+		}
+	}
+	for rsrc, q := range requests {
+		if IsDeviceResource(rsrc) {
+			usage["requests."+rsrc] = q.DeepCopy()
+		}
+	}
+
+	return usage
+}
+
+// isQuotaResource returns whether the resource is supported by ResourceQuotas (see QuotaUsage).
+func isQuotaResource(rsrc v1.ResourceName) bool {
+	if rsrc == v1.ResourcePods || rsrc == "count/pods" {
+		return true
+	}
+	for _, compute := range computeQuotaResources {
+		if rsrc == compute || rsrc == "requests."+compute || rsrc == "limits."+compute {
+			return true
+		}
+	}
+
+	name := v1.ResourceName(strings.TrimPrefix(string(rsrc), "requests."))
+	return name != rsrc && (v1helper.IsExtendedResourceName(name) || v1helper.IsHugePageResourceName(name))
+}
+
+// normalizeLimitRange defaults the Default of the LimitRange to its Max, and its DefaultRequest to
+// its Default.
+// Returns error if a default is less than the minimum or greater than the maximum.
+func normalizeLimitRange(lr LimitRange) (LimitRange, error) {
+	lr.Default = lr.Default.DeepCopy()
+	lr.DefaultRequest = lr.DefaultRequest.DeepCopy()
+	defaultResources(&lr.Default, lr.Max)
+	defaultResources(&lr.DefaultRequest, lr.Default)
+
+	for _, defaults := range []v1.ResourceList{lr.Default, lr.DefaultRequest} {
+		for _, rsrc := range sortedResourceNames(defaults) {
+			q := defaults[rsrc]
+			if min, ok := lr.Min[rsrc]; ok && q.Cmp(min) < 0 {
+				return LimitRange{}, strongerrors.InvalidArgument(errors.Errorf(
+					"default %s %s is less than the minimum %s", rsrc, q.String(), min.String()))
+			}
+			if max, ok := lr.Max[rsrc]; ok && q.Cmp(max) > 0 {
+				return LimitRange{}, strongerrors.InvalidArgument(errors.Errorf(
+					"default %s %s is greater than the maximum %s", rsrc, q.String(), max.String()))
+			}
+		}
+	}
+
+	return lr, nil
+}
+
+// hasResource returns whether the list has the resource.
+func hasResource(list v1.ResourceList, rsrc v1.ResourceName) bool {
+	_, ok := list[rsrc]
+	return ok
+}
+
+// defaultResources sets the resources not in the list to the defaults.
+func defaultResources(list *v1.ResourceList, defaults v1.ResourceList) {
+	for rsrc, q := range defaults {
+		if _, ok := (*list)[rsrc]; ok {
+			continue
+		}
+		if *list == nil {
+			*list = v1.ResourceList{}
+		}
+		(*list)[rsrc] = q.DeepCopy()
+	}
+}
+
+// sortedResourceNames returns the names of the resources in the list in order.
+func sortedResourceNames(list v1.ResourceList) []v1.ResourceName {
+	names := make([]v1.ResourceName, 0, len(list))
+	for rsrc := range list {
+		names = append(names, rsrc)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pod
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newNamespacePod(namespace string, requests, limits v1.ResourceList) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: namespace},
+		Spec: v1.PodSpec{Containers: []v1.Container{{
+			Name:      "container",
+			Resources: v1.ResourceRequirements{Requests: requests, Limits: limits},
+		}}},
+	}
+}
+
+func TestNewNamespaces(t *testing.T) {
+	_, err := NewNamespaces([]Namespace{{Name: ""}})
+	assert.EqualError(t, err, "name of a namespace must not be empty")
+	_, err = NewNamespaces([]Namespace{{Name: "a"}, {Name: "a"}})
+	assert.EqualError(t, err, "duplicate namespace a")
+	_, err = NewNamespaces([]Namespace{{Name: "a", Quota: v1.ResourceList{"services": resource.MustParse("1")}}})
+	assert.EqualError(t, err, "resource services of ResourceQuota of namespace a is not supported")
+	_, err = NewNamespaces([]Namespace{{Name: "a", LimitRange: &LimitRange{
+		Min: v1.ResourceList{"cpu": resource.MustParse("1")},
+		Max: v1.ResourceList{"cpu": resource.MustParse("500m")},
+	}}})
+	assert.EqualError(t, err,
+		"invalid LimitRange of namespace a: default cpu 500m is less than the minimum 1")
+}
+
+func TestNamespacesApplyLimitRange(t *testing.T) {
+	ns, err := NewNamespaces([]Namespace{{Name: "limited", LimitRange: &LimitRange{
+		Default:        v1.ResourceList{"cpu": resource.MustParse("1"), "memory": resource.MustParse("1Gi")},
+		DefaultRequest: v1.ResourceList{"cpu": resource.MustParse("500m")},
+		Min:            v1.ResourceList{"cpu": resource.MustParse("100m")},
+		Max:            v1.ResourceList{"memory": resource.MustParse("2Gi")},
+	}}})
+	assert.NoError(t, err)
+
+	// The requests default to the limits of the container before the defaults of the LimitRange.
+	v1Pod := newNamespacePod("limited", nil, v1.ResourceList{"memory": resource.MustParse("2Gi")})
+	assert.NoError(t, ns.ApplyLimitRange(v1Pod))
+	res := v1Pod.Spec.Containers[0].Resources
+	assert.Equal(t, "500m", resourceString(res.Requests, v1.ResourceCPU))
+	assert.Equal(t, "2Gi", resourceString(res.Requests, v1.ResourceMemory))
+	assert.Equal(t, "1", resourceString(res.Limits, v1.ResourceCPU))
+	assert.Equal(t, "2Gi", resourceString(res.Limits, v1.ResourceMemory))
+
+	v1Pod = newNamespacePod("limited", v1.ResourceList{"cpu": resource.MustParse("50m")}, nil)
+	assert.EqualError(t, ns.ApplyLimitRange(v1Pod),
+		"minimum cpu usage per container is 100m, but request of container container is 50m")
+	v1Pod = newNamespacePod("limited", nil, v1.ResourceList{"memory": resource.MustParse("4Gi")})
+	assert.EqualError(t, ns.ApplyLimitRange(v1Pod),
+		"maximum memory usage per container is 2Gi, but limit of container container is 4Gi")
+
+	// The pods of the other namespaces are not limited.
+	v1Pod = newNamespacePod("default", nil, nil)
+	assert.NoError(t, ns.ApplyLimitRange(v1Pod))
+	assert.Nil(t, v1Pod.Spec.Containers[0].Resources.Requests)
+}
+
+func TestNamespacesCheckQuota(t *testing.T) {
+	ns, err := NewNamespaces([]Namespace{{Name: "quota", Quota: v1.ResourceList{
+		"pods":                    resource.MustParse("2"),
+		"requests.cpu":            resource.MustParse("2"),
+		"limits.memory":           resource.MustParse("4Gi"),
+		"requests.nvidia.com/gpu": resource.MustParse("1"),
+	}}})
+	assert.NoError(t, err)
+	assert.True(t, ns.HasQuota("quota"))
+	assert.False(t, ns.HasQuota("default"))
+
+	v1Pod := newNamespacePod("quota",
+		v1.ResourceList{"cpu": resource.MustParse("1"), "nvidia.com/gpu": resource.MustParse("1")},
+		v1.ResourceList{"memory": resource.MustParse("1Gi"), "nvidia.com/gpu": resource.MustParse("1")})
+	usage, err := ns.CheckQuota(v1Pod, v1.ResourceList{})
+	assert.NoError(t, err)
+	assert.Equal(t, QuotaUsage(v1Pod), usage)
+	assert.Equal(t, "1", resourceString(usage, "requests.nvidia.com/gpu"))
+	assert.Equal(t, "1Gi", resourceString(usage, "limits.memory"))
+
+	_, err = ns.CheckQuota(v1Pod, usage)
+	assert.EqualError(t, err, "exceeded quota: requests.nvidia.com/gpu (requested 1, used 1, limited 1)")
+
+	v1Pod = newNamespacePod("quota", v1.ResourceList{"cpu": resource.MustParse("1")}, nil)
+	_, err = ns.CheckQuota(v1Pod, v1.ResourceList{})
+	assert.EqualError(t, err, "failed quota: container container must specify limits.memory")
+
+	// The pods of the other namespaces are not charged.
+	usage, err = ns.CheckQuota(newNamespacePod("default", nil, nil), v1.ResourceList{})
+	assert.NoError(t, err)
+	assert.Nil(t, usage)
+}
+
+func TestQuotaUsage(t *testing.T) {
+	usage := QuotaUsage(newNamespacePod("default",
+		v1.ResourceList{"cpu": resource.MustParse("500m"), "memory": resource.MustParse("1Gi")},
+		v1.ResourceList{"memory": resource.MustParse("2Gi")}))
+
+	assert.Equal(t, "1", resourceString(usage, "pods"))
+	assert.Equal(t, "1", resourceString(usage, "count/pods"))
+	assert.Equal(t, "500m", resourceString(usage, "cpu"))
+	assert.Equal(t, "500m", resourceString(usage, "requests.cpu"))
+	assert.Equal(t, "1Gi", resourceString(usage, "requests.memory"))
+	assert.Equal(t, "2Gi", resourceString(usage, "limits.memory"))
+	assert.Equal(t, "", resourceString(usage, "limits.cpu"))
+}
@@ -0,0 +1,180 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pod
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"simulator/pkg/clock"
+)
+
+// UsageNoiseAnnotation is the annotation key of a pod that selects the noise model of its resource
+// usage, overriding the default of the simulation, as "<model>:<amplitude>" (e.g., "gaussian:0.1")
+// or "none".
+const UsageNoiseAnnotation = "simulator/usage-noise"
+
+// NoiseModel is a distribution of the multiplicative factor applied to the declared usage.
+type NoiseModel string
+
+const (
+	// NoNoise keeps the declared usage.
+	NoNoise NoiseModel = "none"
+	// UniformNoise draws the factor uniformly from [1 - amplitude, 1 + amplitude].
+	UniformNoise NoiseModel = "uniform"
+	// GaussianNoise draws the factor from the normal distribution with mean 1 and standard
+	// deviation amplitude.
+	GaussianNoise NoiseModel = "gaussian"
+	// LogNormalNoise draws the factor from the log-normal distribution with mean 1 whose logarithm
+	// has standard deviation amplitude, i.e., skewed to occasional spikes.
+	LogNormalNoise NoiseModel = "lognormal"
+)
+
+// UsageNoise is a noise model of the resource usage of pods, with its amplitude and seed.
+// The cpu and memory usage of a pod at each clock is the usage declared for the phase multiplied by
+// a factor drawn from the model (and floored at 0), independently for each pod, resource, and clock.
+// The factor is a function of the seed, the pod, the resource, and the clock, so that the same
+// simulation reproduces the same usage regardless of how often it is observed.
+type UsageNoise struct {
+	Model     NoiseModel
+	Amplitude float64
+	Seed      int64
+}
+
+// ParseUsageNoise parses the model and the amplitude in the format of UsageNoiseAnnotation, with the
+// seed.
+// Returns error if failed to parse.
+func ParseUsageNoise(str string, seed int64) (UsageNoise, error) {
+	if str == "" || str == string(NoNoise) {
+		return UsageNoise{Model: NoNoise, Seed: seed}, nil
+	}
+
+	fields := strings.SplitN(str, ":", 2)
+	if len(fields) != 2 {
+		return UsageNoise{}, strongerrors.InvalidArgument(
+			errors.Errorf("invalid usage noise %q: amplitude not specified", str))
+	}
+	amplitude, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return UsageNoise{}, strongerrors.InvalidArgument(
+			errors.Errorf("invalid amplitude of usage noise %q", str))
+	}
+
+	noise := UsageNoise{Model: NoiseModel(fields[0]), Amplitude: amplitude, Seed: seed}
+	if err := noise.Validate(); err != nil {
+		return UsageNoise{}, err
+	}
+
+	return noise, nil
+}
+
+// Validate returns error if the model is not supported or the amplitude is negative.
+// An empty model is the same as NoNoise.
+func (n UsageNoise) Validate() error {
+	switch n.Model {
+	case "", NoNoise, UniformNoise, GaussianNoise, LogNormalNoise:
+	default:
+		return strongerrors.InvalidArgument(
+			errors.Errorf("usage noise model %q is not supported", n.Model))
+	}
+	if n.Amplitude < 0 || math.IsNaN(n.Amplitude) || math.IsInf(n.Amplitude, 0) {
+		return strongerrors.InvalidArgument(
+			errors.Errorf("invalid amplitude of usage noise %v", n.Amplitude))
+	}
+
+	return nil
+}
+
+// noisyResources are the resources whose usage is perturbed by the noise.
+var noisyResources = []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory}
+
+// apply returns the usage of the pod with the key at the clock, perturbed by this noise.
+func (n UsageNoise) apply(usage v1.ResourceList, key string, clk clock.Clock) v1.ResourceList {
+	if n.Model == "" || n.Model == NoNoise || n.Amplitude == 0 {
+		return usage
+	}
+
+	noisy := usage.DeepCopy()
+	for _, rsrc := range noisyResources {
+		q, ok := usage[rsrc]
+		if !ok {
+			continue
+		}
+
+		factor := n.factor(key, rsrc, clk)
+		if rsrc == v1.ResourceCPU {
+			milli := int64(math.Round(float64(q.MilliValue()) * factor))
+			noisy[rsrc] = *resource.NewMilliQuantity(milli, q.Format)
+		} else {
+			noisy[rsrc] = *resource.NewQuantity(int64(math.Round(float64(q.Value())*factor)), q.Format)
+		}
+	}
+
+	return noisy
+}
+
+// factor returns the factor of the resource usage of the pod at the clock, which is not negative.
+func (n UsageNoise) factor(key string, rsrc v1.ResourceName, clk clock.Clock) float64 {
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(n.Seed))
+	h.Write(buf)                                          // nolint
+	h.Write([]byte(key + "\x00" + string(rsrc) + "\x00")) // nolint
+	binary.LittleEndian.PutUint64(buf, uint64(clk.ToMetaV1().UnixNano()))
+	h.Write(buf) // nolint
+
+	state := h.Sum64()
+	u1 := uniform(&state)
+	u2 := uniform(&state)
+
+	var factor float64
+	switch n.Model {
+	case UniformNoise:
+		factor = 1 + n.Amplitude*(2*u1-1)
+	case GaussianNoise:
+		factor = 1 + n.Amplitude*normal(u1, u2)
+	case LogNormalNoise:
+		factor = math.Exp(n.Amplitude*normal(u1, u2) - n.Amplitude*n.Amplitude/2)
+	default:
+		factor = 1
+	}
+
+	return math.Max(factor, 0)
+}
+
+// uniform advances the splitmix64 state and returns a number drawn uniformly from (0, 1).
+func uniform(state *uint64) float64 {
+	*state += 0x9e3779b97f4a7c15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+
+	return (float64(z>>11) + 0.5) / (1 << 53)
+}
+
+// normal returns a number drawn from the standard normal distribution with the Box-Muller
+// transform of the uniform numbers in (0, 1).
+func normal(u1, u2 float64) float64 {
+	return math.Sqrt(-2*math.Log(u1)) * math.Cos(2*math.Pi*u2)
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pod
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"simulator/pkg/clock"
+)
+
+func TestParseUsageNoise(t *testing.T) {
+	noise, err := ParseUsageNoise("gaussian:0.1", 42)
+	assert.NoError(t, err)
+	assert.Equal(t, UsageNoise{Model: GaussianNoise, Amplitude: 0.1, Seed: 42}, noise)
+
+	noise, err = ParseUsageNoise("none", 42)
+	assert.NoError(t, err)
+	assert.Equal(t, UsageNoise{Model: NoNoise, Seed: 42}, noise)
+
+	_, err = ParseUsageNoise("uniform", 0)
+	assert.EqualError(t, err, `invalid usage noise "uniform": amplitude not specified`)
+	_, err = ParseUsageNoise("uniform:-1", 0)
+	assert.EqualError(t, err, "invalid amplitude of usage noise -1")
+	_, err = ParseUsageNoise("uniform:Inf", 0)
+	assert.EqualError(t, err, "invalid amplitude of usage noise +Inf")
+	_, err = ParseUsageNoise("pareto:1", 0)
+	assert.EqualError(t, err, `usage noise model "pareto" is not supported`)
+}
+
+func TestUsageNoiseFactor(t *testing.T) {
+	start := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	const n = 10000
+
+	for _, noise := range []UsageNoise{
+		{Model: UniformNoise, Amplitude: 0.2, Seed: 1},
+		{Model: GaussianNoise, Amplitude: 0.1, Seed: 1},
+		{Model: LogNormalNoise, Amplitude: 0.3, Seed: 1},
+	} {
+		sum, sumSq := 0.0, 0.0
+		for i := 0; i < n; i++ {
+			clk := start.Add(time.Duration(i) * time.Second)
+			f := noise.factor("default/pod", v1.ResourceCPU, clk)
+			assert.True(t, f >= 0)
+			assert.Equal(t, f, noise.factor("default/pod", v1.ResourceCPU, clk), "not deterministic")
+			sum += f
+			sumSq += f * f
+		}
+
+		mean := sum / n
+		stddev := math.Sqrt(sumSq/n - mean*mean)
+		assert.InDelta(t, 1, mean, 0.01, string(noise.Model))
+		assert.True(t, stddev > noise.Amplitude/2 && stddev < noise.Amplitude*2, string(noise.Model))
+	}
+
+	noise := UsageNoise{Model: UniformNoise, Amplitude: 0.2, Seed: 1}
+	other := UsageNoise{Model: UniformNoise, Amplitude: 0.2, Seed: 2}
+	assert.NotEqual(t, noise.factor("default/pod", v1.ResourceCPU, start),
+		other.factor("default/pod", v1.ResourceCPU, start))
+	assert.NotEqual(t, noise.factor("default/pod", v1.ResourceCPU, start),
+		noise.factor("default/pod", v1.ResourceMemory, start))
+	assert.NotEqual(t, noise.factor("default/pod", v1.ResourceCPU, start),
+		noise.factor("default/pod-1", v1.ResourceCPU, start))
+}
+
+func TestPodResourceUsageWithNoise(t *testing.T) {
+	start := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	newPod := func(annotations map[string]string) *v1.Pod {
+		annotations["simSpec"] = `
+- seconds: 100
+  resourceUsage:
+    cpu: 1
+    memory: 1Gi
+    nvidia.com/gpu: 1
+`
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        "pod",
+			Namespace:   "default",
+			Annotations: annotations,
+		}}
+	}
+
+	clk := start.Add(10 * time.Second)
+	defaultNoise := UsageNoise{Model: UniformNoise, Amplitude: 0.5, Seed: 7}
+
+	simPod, err := NewPod(newPod(map[string]string{}), start, Ok, "node")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", resourceString(simPod.ResourceUsage(clk), v1.ResourceCPU))
+
+	simPod.SetDefaultUsageNoise(defaultNoise)
+	usage := simPod.ResourceUsage(clk)
+	assert.NotEqual(t, "1", resourceString(usage, v1.ResourceCPU))
+	assert.NotEqual(t, "1Gi", resourceString(usage, v1.ResourceMemory))
+	assert.Equal(t, "1", resourceString(usage, "nvidia.com/gpu"))
+	assert.Equal(t, usage, simPod.ResourceUsage(clk))
+
+	// The annotation overrides the default model, with the default seed.
+	simPod, err = NewPod(newPod(map[string]string{UsageNoiseAnnotation: "none"}), start, Ok, "node")
+	assert.NoError(t, err)
+	simPod.SetDefaultUsageNoise(defaultNoise)
+	assert.Equal(t, "1", resourceString(simPod.ResourceUsage(clk), v1.ResourceCPU))
+
+	simPod, err = NewPod(newPod(map[string]string{UsageNoiseAnnotation: "gaussian:0.1"}), start, Ok, "node")
+	assert.NoError(t, err)
+	simPod.SetDefaultUsageNoise(defaultNoise)
+	assert.Equal(t, UsageNoise{Model: GaussianNoise, Amplitude: 0.1, Seed: 7}, simPod.noise)
+
+	_, err = NewPod(newPod(map[string]string{UsageNoiseAnnotation: "gaussian"}), start, Ok, "node")
+	assert.EqualError(t, err,
+		`invalid simulator/usage-noise annotation: invalid usage noise "gaussian": amplitude not specified`)
+}
+
+func resourceString(rl v1.ResourceList, rsrc v1.ResourceName) string {
+	q, ok := rl[rsrc]
+	if !ok {
+		return ""
+	}
+	return q.String()
+}
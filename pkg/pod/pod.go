@@ -16,13 +16,16 @@ package pod
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/containerd/containerd/log"
+	"github.com/pkg/errors"
 	v1 "k8s.io/api/core/v1"
+	v1qos "k8s.io/kubernetes/pkg/apis/core/v1/helper/qos"
 
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/clock"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/util"
+	"simulator/pkg/clock"
+	"simulator/pkg/util"
 )
 
 // Pod represents a simulated pod.
@@ -32,6 +35,20 @@ type Pod struct {
 	boundAt clock.Clock
 	status  Status
 	node    string
+
+	noise UsageNoise
+	// noiseAnnotated is whether the noise model is selected by UsageNoiseAnnotation.
+	noiseAnnotated bool
+
+	qos v1.PodQOSClass
+	// usageLimits are the limits of the resource usage (see buildUsageLimits).
+	usageLimits v1.ResourceList
+
+	// startupLatency is the latency from the binding to the start of the execution (see
+	// StartupLatency).
+	startupLatency time.Duration
+	// initDuration is the time to initialize specified by InitSecondsAnnotation, or nil.
+	initDuration *time.Duration
 }
 
 // Metrics is a metrics of a pod at one time point.
@@ -43,9 +60,17 @@ type Metrics struct {
 	BoundAt         clock.Clock
 	Node            string
 	ExecutedSeconds int32
+	// SchedulingLatencySeconds is the duration from the submission of the pod to its binding.
+	SchedulingLatencySeconds float64
+	// StartedAt is the clock at which the pod starts its execution after the startup latency.
+	StartedAt clock.Clock
 
 	Priority int32
 	Status   Status
+	QOSClass v1.PodQOSClass
+
+	// Labels are the labels of the pod, so that the metrics can be filtered by label selectors.
+	Labels map[string]string `json:",omitempty"`
 }
 
 // Status represents status of a Pod.
@@ -64,6 +89,14 @@ const (
 
 	// OverCapacity indicates that the pod failed to start due to over capacity.
 	OverCapacity
+
+	// Evicted indicates that the pod has been evicted from its node under resource pressure, i.e.,
+	// killed immediately without a grace period.
+	Evicted
+
+	// OOMKilled indicates that the pod has been killed by the OOM killer, since its memory usage
+	// exceeded its limit.
+	OOMKilled
 )
 
 // String implements Stringer interface.
@@ -75,6 +108,10 @@ func (status Status) String() string {
 		return "Deleted"
 	case OverCapacity:
 		return "OverCapacity"
+	case Evicted:
+		return "Evicted"
+	case OOMKilled:
+		return "OOMKilled"
 	default:
 		log.L.Panic("Unknown pod.Status")
 		return ""
@@ -86,22 +123,74 @@ func (status Status) MarshalJSON() ([]byte, error) {
 	return json.Marshal(status.String())
 }
 
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (status *Status) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+
+	switch str {
+	case "Ok":
+		*status = Ok
+	case "Deleted":
+		*status = Deleted
+	case "OverCapacity":
+		*status = OverCapacity
+	case "Evicted":
+		*status = Evicted
+	case "OOMKilled":
+		*status = OOMKilled
+	default:
+		return fmt.Errorf("Unknown pod status %q", str)
+	}
+
+	return nil
+}
+
 // NewPod creates a pod with the given v1.Pod, the clock at which the pod was bound to a node, and
 // the pod's status.
-// Returns error if fails to parse the simulation spec of the pod.
+// The resource usage of the pod has no noise unless the pod has UsageNoiseAnnotation or
+// SetDefaultUsageNoise is called.
+// Returns error if fails to parse the simulation spec or UsageNoiseAnnotation of the pod.
 func NewPod(pod *v1.Pod, boundAt clock.Clock, status Status, node string) (*Pod, error) {
 	spec, err := parseSpec(pod)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Pod{
+	simPod := &Pod{
 		v1:      pod,
 		spec:    spec,
 		boundAt: boundAt,
 		status:  status,
 		node:    node,
-	}, nil
+
+		qos:         v1qos.GetPodQOS(pod),
+		usageLimits: buildUsageLimits(pod),
+	}
+
+	if annot, ok := pod.Annotations[UsageNoiseAnnotation]; ok {
+		if simPod.noise, err = ParseUsageNoise(annot, 0); err != nil {
+			return nil, errors.Wrapf(err, "invalid %s annotation", UsageNoiseAnnotation)
+		}
+		simPod.noiseAnnotated = true
+	}
+	if simPod.initDuration, err = parseInitSeconds(pod); err != nil {
+		return nil, err
+	}
+
+	return simPod, nil
+}
+
+// SetDefaultUsageNoise sets the noise model of the resource usage of this Pod, unless selected by
+// UsageNoiseAnnotation. The seed is set in either case.
+func (pod *Pod) SetDefaultUsageNoise(noise UsageNoise) {
+	if pod.noiseAnnotated {
+		pod.noise.Seed = noise.Seed
+		return
+	}
+	pod.noise = noise
 }
 
 // ToV1 returns v1.Pod representation of this Pod.
@@ -109,6 +198,11 @@ func (pod *Pod) ToV1() *v1.Pod {
 	return pod.v1
 }
 
+// BoundAt returns the clock at which this Pod was bound to its node.
+func (pod *Pod) BoundAt() clock.Clock {
+	return pod.boundAt
+}
+
 // Metrics returns the Metrics of this Pod at the given clock.
 func (pod *Pod) Metrics(clock clock.Clock) Metrics {
 	return Metrics{
@@ -119,10 +213,29 @@ func (pod *Pod) Metrics(clock clock.Clock) Metrics {
 		BoundAt:         pod.boundAt,
 		Node:            pod.node,
 		ExecutedSeconds: int32(pod.executedDuration(clock).Seconds()),
+		StartedAt:       pod.startAt(),
+
+		SchedulingLatencySeconds: pod.schedulingLatency().Seconds(),
 
 		Priority: util.PodPriority(pod.ToV1()),
 		Status:   pod.status,
+		QOSClass: pod.qos,
+
+		Labels: pod.ToV1().Labels,
+	}
+}
+
+// schedulingLatency returns the duration from the creation of this Pod, i.e., its submission, to
+// its binding, or 0 if the creation timestamp is not set.
+func (pod *Pod) schedulingLatency() time.Duration {
+	created := pod.ToV1().CreationTimestamp
+	if created.IsZero() {
+		return 0
+	}
+	if latency := pod.boundAt.Sub(clock.NewClockWithMetaV1(created)); latency > 0 {
+		return latency
 	}
+	return 0
 }
 
 // TotalResourceRequests extracts the total amount of resource requested by this Pod.
@@ -140,8 +253,29 @@ func (pod *Pod) TotalResourceLimits() v1.ResourceList {
 }
 
 // ResourceUsage returns resource usage of this Pod at the given clock.
+// The cpu and memory usage is bounded by the limits of this Pod, if every container has the limit,
+// and the usage of the device resources (e.g., nvidia.com/gpu) by their requests.
+// The memory usage beyond the limit kills this Pod by the OOM killer (see ExceedsMemoryLimit).
 func (pod *Pod) ResourceUsage(clock clock.Clock) v1.ResourceList {
-	if !(pod.IsRunning(clock) || pod.IsTerminating(clock)) {
+	return limitUsage(pod.unlimitedResourceUsage(clock), pod.usageLimits)
+}
+
+// ExceedsMemoryLimit returns whether this Pod is running and uses more memory than its limit at the
+// given clock, i.e., it is to be killed by the OOM killer (see OOMKill).
+func (pod *Pod) ExceedsMemoryLimit(clock clock.Clock) bool {
+	limit, ok := pod.usageLimits[v1.ResourceMemory]
+	if !ok || !pod.IsRunning(clock) {
+		return false
+	}
+
+	usage, ok := pod.unlimitedResourceUsage(clock)[v1.ResourceMemory]
+	return ok && usage.Cmp(limit) > 0
+}
+
+// unlimitedResourceUsage returns resource usage of this Pod at the given clock, not bounded by its
+// limits.
+func (pod *Pod) unlimitedResourceUsage(clock clock.Clock) v1.ResourceList {
+	if !(pod.IsRunning(clock) || pod.IsTerminating(clock)) || pod.IsStarting(clock) {
 		// pod is not using resource
 		return v1.ResourceList{}
 	}
@@ -151,7 +285,8 @@ func (pod *Pod) ResourceUsage(clock clock.Clock) v1.ResourceList {
 	for _, phase := range pod.spec {
 		phaseDurationAcc += phase.seconds
 		if executedSeconds < phaseDurationAcc {
-			return phase.resourceUsage
+			key := util.PodKeyFromNames(pod.v1.Namespace, pod.v1.Name)
+			return pod.noise.apply(phase.resourceUsage, key, clock)
 		}
 	}
 
@@ -159,16 +294,17 @@ func (pod *Pod) ResourceUsage(clock clock.Clock) v1.ResourceList {
 	return v1.ResourceList{}
 }
 
-// IsRunning returns whether this Pod is running at the given clock.
+// IsRunning returns whether this Pod is running at the given clock, including its startup (see
+// IsStarting).
 // Returns false if this Pod has failed to start.
 func (pod *Pod) IsRunning(clock clock.Clock) bool {
-	return pod.status == Ok && pod.executedDuration(clock) < pod.totalExecutionDuration()
+	return pod.status == Ok && clock.Before(pod.finishAt())
 }
 
 // IsTerminated returns whether this Pod is terminated at the clock.
 // If this Pod failed to start, false is returned.
 func (pod *Pod) IsTerminated(clock clock.Clock) bool {
-	return pod.status == Ok && pod.executedDuration(clock) >= pod.totalExecutionDuration()
+	return pod.status == Ok && !clock.Before(pod.finishAt())
 }
 
 // IsTerminating returns whether this Pod is terminating (i.e. in its grace period).
@@ -176,20 +312,75 @@ func (pod *Pod) IsTerminating(clock clock.Clock) bool {
 	return pod.status == Deleted && !pod.IsDeleted(clock)
 }
 
-// IsDeleted returns whether this Pod has been deleted.
+// IsDeleted returns whether this Pod has been deleted, evicted, or OOM-killed.
 func (pod *Pod) IsDeleted(clk clock.Clock) bool {
+	if pod.status == Evicted || pod.status == OOMKilled {
+		return true
+	}
+
+	return pod.status == Deleted && !clk.Before(pod.gracePeriodEnd())
+}
+
+// NextTransition returns the earliest clock after the given one at which this Pod changes its phase
+// by itself, i.e., starts its execution after the startup latency, enters a phase of its execution
+// using more memory than its limit, finishes it, or ends its grace period.
+// The second return value is false if it never does (e.g., it has terminated).
+func (pod *Pod) NextTransition(clk clock.Clock) (clock.Clock, bool) {
+	switch pod.status {
+	case Ok:
+		if clk.Before(pod.startAt()) {
+			return pod.startAt(), true
+		}
+		if at, ok := pod.nextMemoryLimitExceededAt(clk); ok {
+			return at, true
+		}
+		if clk.Before(pod.finishAt()) {
+			return pod.finishAt(), true
+		}
+	case Deleted:
+		if end := pod.gracePeriodEnd(); clk.Before(end) {
+			return end, true
+		}
+	}
+
+	return clock.Clock{}, false
+}
+
+// nextMemoryLimitExceededAt returns the earliest clock after the given one at which this Pod enters a
+// phase of its execution whose memory usage, without the noise, exceeds its limit.
+// The second return value is false if there is no such phase.
+func (pod *Pod) nextMemoryLimitExceededAt(clk clock.Clock) (clock.Clock, bool) {
+	limit, ok := pod.usageLimits[v1.ResourceMemory]
+	if !ok {
+		return clock.Clock{}, false
+	}
+
+	at := pod.startAt()
+	for _, phase := range pod.spec {
+		if q, ok := phase.resourceUsage[v1.ResourceMemory]; ok && q.Cmp(limit) > 0 && clk.Before(at) {
+			return at, true
+		}
+		at = at.Add(time.Duration(phase.seconds) * time.Second)
+	}
+
+	return clock.Clock{}, false
+}
+
+// gracePeriodEnd returns the clock at which the grace period of this Pod being deleted ends.
+func (pod *Pod) gracePeriodEnd() clock.Clock {
 	gp := int64(v1.DefaultTerminationGracePeriodSeconds)
 	if pod.v1.Spec.TerminationGracePeriodSeconds != nil {
 		gp = *pod.v1.Spec.TerminationGracePeriodSeconds
 	}
 
-	return pod.status == Deleted &&
-		clk.Sub(clock.NewClockWithMetaV1(*pod.ToV1().DeletionTimestamp)) >= time.Duration(gp)*time.Second
+	deletedAt := clock.NewClockWithMetaV1(*pod.ToV1().DeletionTimestamp)
+	return deletedAt.Add(time.Duration(gp) * time.Second)
 }
 
 // Delete starts to delete this Pod.
 func (pod *Pod) Delete(clock clock.Clock) {
-	if pod.IsTerminated(clock) || pod.status == Deleted {
+	if pod.IsTerminated(clock) || pod.status == Deleted || pod.status == Evicted ||
+		pod.status == OOMKilled {
 		return
 	}
 
@@ -200,6 +391,41 @@ func (pod *Pod) Delete(clock clock.Clock) {
 	pod.ToV1().DeletionTimestamp = &deletedAt
 }
 
+// Evict evicts this Pod from its node under resource pressure at the given clock.
+// The pod stops immediately, since its grace period is not respected.
+func (pod *Pod) Evict(clock clock.Clock) {
+	if !pod.IsRunning(clock) {
+		return
+	}
+
+	pod.status = Evicted
+	evictedAt := clock.ToMetaV1()
+	pod.ToV1().DeletionTimestamp = &evictedAt
+}
+
+// IsEvicted returns whether this Pod has been evicted from its node under resource pressure.
+func (pod *Pod) IsEvicted() bool {
+	return pod.status == Evicted
+}
+
+// OOMKill kills this Pod by the OOM killer at the given clock, since its memory usage exceeds its
+// limit.
+// The pod stops immediately and fails, like a pod whose restartPolicy is Never.
+func (pod *Pod) OOMKill(clock clock.Clock) {
+	if !pod.IsRunning(clock) {
+		return
+	}
+
+	pod.status = OOMKilled
+	killedAt := clock.ToMetaV1()
+	pod.ToV1().DeletionTimestamp = &killedAt
+}
+
+// IsOOMKilled returns whether this Pod has been killed by the OOM killer.
+func (pod *Pod) IsOOMKilled() bool {
+	return pod.status == OOMKilled
+}
+
 // HasFailedToStart returns whether this Pod has failed to start to a node.
 func (pod *Pod) HasFailedToStart() bool {
 	return pod.status == OverCapacity
@@ -209,6 +435,7 @@ func (pod *Pod) HasFailedToStart() bool {
 // deleted (but it can be terminating).
 func (pod *Pod) BuildStatus(clock clock.Clock) v1.PodStatus {
 	status := pod.ToV1().Status
+	status.QOSClass = pod.qos
 
 	switch pod.status {
 	case OverCapacity:
@@ -216,16 +443,39 @@ func (pod *Pod) BuildStatus(clock clock.Clock) v1.PodStatus {
 		// status.Conditions =
 		status.Reason = "CapacityExceeded"
 		status.Message = "Pod cannot be started due to the requested resource exceeds the capacity"
+	case Evicted:
+		status.Phase = v1.PodFailed
+		status.Reason = "Evicted"
+		status.Message = "The node was low on resource: memory."
+	case OOMKilled:
+		status.Phase = v1.PodFailed
+		status.Reason = "OOMKilled"
+		status.Message = "The pod used more memory than its limit."
 	case Ok, Deleted:
 		startTime := pod.boundAt.ToMetaV1()
 		status.StartTime = &startTime
 
+		if pod.IsStarting(clock) {
+			status.Phase = v1.PodPending
+			containerStatuses := make([]v1.ContainerStatus, 0, len(pod.ToV1().Spec.Containers))
+			for _, container := range pod.ToV1().Spec.Containers {
+				containerStatuses = append(containerStatuses, v1.ContainerStatus{
+					Name:  container.Name,
+					State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ContainerCreating"}},
+					Image: container.Image,
+				})
+			}
+			status.ContainerStatuses = containerStatuses
+			break
+		}
+
+		startedAt := pod.startAt().ToMetaV1()
 		var containerState v1.ContainerState
 		if pod.IsRunning(clock) || pod.IsTerminating(clock) {
 			status.Phase = v1.PodRunning
 			containerState = v1.ContainerState{
 				Running: &v1.ContainerStateRunning{
-					StartedAt: startTime,
+					StartedAt: startedAt,
 				}}
 		} else {
 			status.Phase = v1.PodSucceeded
@@ -235,7 +485,7 @@ func (pod *Pod) BuildStatus(clock clock.Clock) v1.PodStatus {
 					// Signal:
 					Reason:     "Succeeded",
 					Message:    "All containers in the pod have voluntarily terminated",
-					StartedAt:  startTime,
+					StartedAt:  startedAt,
 					FinishedAt: pod.finishAt().ToMetaV1(),
 					// ContainerID:
 				}}
@@ -246,7 +496,7 @@ func (pod *Pod) BuildStatus(clock clock.Clock) v1.PodStatus {
 				Type:               conditionType,
 				Status:             v1.ConditionTrue,
 				LastProbeTime:      clock.ToMetaV1(),
-				LastTransitionTime: startTime,
+				LastTransitionTime: startedAt,
 				// Reason:
 				// Message:
 			})
@@ -273,33 +523,36 @@ func (pod *Pod) BuildStatus(clock clock.Clock) v1.PodStatus {
 }
 
 // executedDuration returns the elapsed duration after this Pod started.
-// Returns 0 if the pod failed to start.
+// Returns 0 if the pod failed to start or is starting.
 func (pod *Pod) executedDuration(clock clock.Clock) time.Duration {
+	var elapsed time.Duration
 	switch pod.status {
 	case Ok:
-		elapsed := clock.Sub(pod.boundAt)
-		total := pod.totalExecutionDuration()
-		if elapsed < total {
-			return elapsed
+		elapsed = clock.Sub(pod.startAt())
+		if total := pod.totalExecutionDuration(); elapsed > total {
+			return total
 		}
-		return total
-	case Deleted:
-		return pod.ToV1().DeletionTimestamp.Sub(pod.boundAt.ToMetaV1().Time)
-	default:
+	case Deleted, Evicted, OOMKilled:
+		elapsed = pod.ToV1().DeletionTimestamp.Sub(pod.startAt().ToMetaV1().Time)
+	}
+
+	if elapsed < 0 {
 		return 0
 	}
+	return elapsed
 }
 
 // totalExecutionDuration returns the total execution duration of this Pod.
 func (pod *Pod) totalExecutionDuration() time.Duration {
-	phaseSecondsTotal := int32(0)
-	for _, phase := range pod.spec {
-		phaseSecondsTotal += phase.seconds
-	}
-	return time.Duration(phaseSecondsTotal) * time.Second
+	return pod.spec.totalDuration()
+}
+
+// startAt returns the clock at which this Pod starts its execution after the startup latency.
+func (pod *Pod) startAt() clock.Clock {
+	return pod.boundAt.Add(pod.startupLatency)
 }
 
 // finishAt returns the clock at which this Pod will finish spontaneously.
 func (pod *Pod) finishAt() clock.Clock {
-	return pod.boundAt.Add(pod.totalExecutionDuration())
+	return pod.startAt().Add(pod.totalExecutionDuration())
 }
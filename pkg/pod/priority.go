@@ -0,0 +1,157 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pod
+
+import (
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/apis/scheduling"
+
+	"simulator/pkg/util"
+)
+
+// PreemptionPolicyAnnotation is the annotation key of a pod that specifies its preemption policy,
+// which v1.PodSpec of this Kubernetes version does not have.
+// It is populated from the PriorityClass of the pod unless annotated.
+const PreemptionPolicyAnnotation = "simulator/preemption-policy"
+
+// PriorityClassNotFoundReason is the reason of a pod rejected since its PriorityClass does not exist.
+const PriorityClassNotFoundReason = "PriorityClassNotFound"
+
+// PreemptionPolicy is the policy of a pod preempting lower-priority pods.
+type PreemptionPolicy string
+
+const (
+	// PreemptLowerPriority lets the pod preempt lower-priority pods, the default.
+	PreemptLowerPriority PreemptionPolicy = "PreemptLowerPriority"
+	// PreemptNever places the pod ahead of lower-priority pods in the queue, but never lets it
+	// preempt them.
+	PreemptNever PreemptionPolicy = "Never"
+)
+
+// PriorityClass is a PriorityClass of pods, mapping its name to a priority.
+type PriorityClass struct {
+	Name  string
+	Value int32
+	// GlobalDefault makes the pods with no PriorityClassName and no priority use this class.
+	GlobalDefault bool
+	// PreemptionPolicy is the preemption policy of the pods of this class. Optional (default:
+	// PreemptLowerPriority)
+	PreemptionPolicy PreemptionPolicy
+}
+
+// PriorityClasses resolves the priorities of pods by their PriorityClassName, like the priority
+// admission controller.
+// The system-cluster-critical and system-node-critical classes always exist.
+type PriorityClasses struct {
+	classes      map[string]PriorityClass
+	defaultClass *PriorityClass
+}
+
+// NewPriorityClasses creates a new PriorityClasses of the classes and the system classes.
+// Returns error if a class has an invalid name, value, or preemption policy, or more than one class
+// is the global default.
+func NewPriorityClasses(classes []PriorityClass) (*PriorityClasses, error) {
+	pc := &PriorityClasses{classes: map[string]PriorityClass{
+		scheduling.SystemClusterCritical: {
+			Name: scheduling.SystemClusterCritical, Value: scheduling.SystemCriticalPriority,
+		},
+		scheduling.SystemNodeCritical: {
+			Name: scheduling.SystemNodeCritical, Value: scheduling.SystemCriticalPriority + 1000,
+		},
+	}}
+
+	for _, class := range classes {
+		if class.Name == "" {
+			return nil, strongerrors.InvalidArgument(errors.New("name of a PriorityClass must not be empty"))
+		}
+		if _, ok := pc.classes[class.Name]; ok {
+			return nil, strongerrors.InvalidArgument(errors.Errorf("duplicate PriorityClass %s", class.Name))
+		}
+		if class.Value > scheduling.HighestUserDefinablePriority {
+			return nil, strongerrors.InvalidArgument(errors.Errorf(
+				"value of PriorityClass %s must not be greater than %d",
+				class.Name, scheduling.HighestUserDefinablePriority))
+		}
+		switch class.PreemptionPolicy {
+		case "":
+			class.PreemptionPolicy = PreemptLowerPriority
+		case PreemptLowerPriority, PreemptNever:
+		default:
+			return nil, strongerrors.InvalidArgument(errors.Errorf(
+				"invalid preemption policy %q of PriorityClass %s", class.PreemptionPolicy, class.Name))
+		}
+
+		if class.GlobalDefault {
+			if pc.defaultClass != nil {
+				return nil, strongerrors.InvalidArgument(errors.Errorf(
+					"PriorityClasses %s and %s must not be both global default", pc.defaultClass.Name, class.Name))
+			}
+			c := class
+			pc.defaultClass = &c
+		}
+		pc.classes[class.Name] = class
+	}
+
+	return pc, nil
+}
+
+// Admit sets the priority of the pod to the value of its PriorityClass, or of the global default
+// class if the pod has neither PriorityClassName nor priority, and annotates the pod with the
+// preemption policy of the class unless annotated.
+// Returns error if the PriorityClass of the pod does not exist.
+func (pc *PriorityClasses) Admit(pod *v1.Pod) error {
+	var class PriorityClass
+	if pod.Spec.PriorityClassName != "" {
+		c, ok := pc.classes[pod.Spec.PriorityClassName]
+		if !ok {
+			return strongerrors.NotFound(errors.Errorf("no PriorityClass with name %s was found for pod %s",
+				pod.Spec.PriorityClassName, util.PodKeyFromNames(pod.Namespace, pod.Name)))
+		}
+		class = c
+	} else if pc.defaultClass != nil && pod.Spec.Priority == nil {
+		class = *pc.defaultClass
+		pod.Spec.PriorityClassName = class.Name
+	} else {
+		return nil
+	}
+
+	value := class.Value
+	pod.Spec.Priority = &value
+	if _, ok := pod.Annotations[PreemptionPolicyAnnotation]; !ok && class.PreemptionPolicy != "" {
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[PreemptionPolicyAnnotation] = string(class.PreemptionPolicy)
+	}
+
+	return nil
+}
+
+// GetPreemptionPolicy returns the preemption policy of the pod in its PreemptionPolicyAnnotation,
+// or PreemptLowerPriority if not annotated.
+func GetPreemptionPolicy(pod *v1.Pod) PreemptionPolicy {
+	if policy, ok := pod.Annotations[PreemptionPolicyAnnotation]; ok && policy != "" {
+		return PreemptionPolicy(policy)
+	}
+	return PreemptLowerPriority
+}
+
+// IsCritical returns whether the pod has a system-critical priority, i.e., is never evicted under
+// node pressure.
+func IsCritical(pod *v1.Pod) bool {
+	return util.PodPriority(pod) >= scheduling.SystemCriticalPriority
+}
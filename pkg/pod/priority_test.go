@@ -0,0 +1,75 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pod
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPriorityClassesAdmit(t *testing.T) {
+	classes, err := NewPriorityClasses([]PriorityClass{
+		{Name: "high", Value: 1000},
+		{Name: "batch", Value: 10, GlobalDefault: true, PreemptionPolicy: PreemptNever},
+	})
+	assert.NoError(t, err)
+
+	newPod := func(className string, priority *int32) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default"},
+			Spec:       v1.PodSpec{PriorityClassName: className, Priority: priority},
+		}
+	}
+
+	pod := newPod("high", nil)
+	assert.NoError(t, classes.Admit(pod))
+	assert.Equal(t, int32(1000), *pod.Spec.Priority)
+	assert.Equal(t, PreemptLowerPriority, GetPreemptionPolicy(pod))
+
+	// The pods with neither class nor priority are of the global default.
+	pod = newPod("", nil)
+	assert.NoError(t, classes.Admit(pod))
+	assert.Equal(t, "batch", pod.Spec.PriorityClassName)
+	assert.Equal(t, int32(10), *pod.Spec.Priority)
+	assert.Equal(t, PreemptNever, GetPreemptionPolicy(pod))
+
+	priority := int32(5)
+	pod = newPod("", &priority)
+	assert.NoError(t, classes.Admit(pod))
+	assert.Equal(t, int32(5), *pod.Spec.Priority)
+	assert.Equal(t, "", pod.Spec.PriorityClassName)
+
+	pod = newPod("system-node-critical", nil)
+	assert.NoError(t, classes.Admit(pod))
+	assert.Equal(t, int32(2000001000), *pod.Spec.Priority)
+	assert.True(t, IsCritical(pod))
+
+	assert.EqualError(t, classes.Admit(newPod("unknown", nil)),
+		"no PriorityClass with name unknown was found for pod default/pod")
+}
+
+func TestNewPriorityClasses(t *testing.T) {
+	_, err := NewPriorityClasses([]PriorityClass{{Name: "system-node-critical", Value: 1}})
+	assert.EqualError(t, err, "duplicate PriorityClass system-node-critical")
+	_, err = NewPriorityClasses([]PriorityClass{{Name: "huge", Value: 1000000001}})
+	assert.EqualError(t, err, "value of PriorityClass huge must not be greater than 1000000000")
+	_, err = NewPriorityClasses([]PriorityClass{{Name: "a", PreemptionPolicy: "Sometimes"}})
+	assert.EqualError(t, err, `invalid preemption policy "Sometimes" of PriorityClass a`)
+	_, err = NewPriorityClasses([]PriorityClass{{Name: "a", GlobalDefault: true}, {Name: "b", GlobalDefault: true}})
+	assert.EqualError(t, err, "PriorityClasses a and b must not be both global default")
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pod
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"simulator/pkg/util"
+)
+
+// qosRanks ranks the QoS classes in the order in which their pods are evicted first.
+var qosRanks = map[v1.PodQOSClass]int{
+	v1.PodQOSBestEffort: 0,
+	v1.PodQOSBurstable:  1,
+	v1.PodQOSGuaranteed: 2,
+}
+
+// QOSClass returns the QoS class of this Pod derived from the requests and limits of its
+// containers, like the kubelet.
+func (pod *Pod) QOSClass() v1.PodQOSClass {
+	return pod.qos
+}
+
+// QOSRank returns the rank of the QoS class of this Pod in the order of eviction, i.e., BestEffort
+// pods have the lowest rank and Guaranteed pods the highest.
+func (pod *Pod) QOSRank() int {
+	return qosRanks[pod.qos]
+}
+
+// limitedResources are the resources whose usage is bounded by the limits of the pod, i.e., CPU
+// throttled by the CFS quota and memory by the cgroup.
+var limitedResources = []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory}
+
+// buildUsageLimits returns the limits of the usage of the pod, for each of limitedResources limited
+// by every container of the pod, and for each device resource requested by the pod (see
+// IsDeviceResource), which cannot be used beyond the devices allocated to the pod.
+func buildUsageLimits(pod *v1.Pod) v1.ResourceList {
+	limits := v1.ResourceList{}
+	if len(pod.Spec.Containers) == 0 {
+		return limits
+	}
+
+	for rsrc, req := range util.PodTotalResourceRequests(pod) {
+		if IsDeviceResource(rsrc) {
+			limits[rsrc] = req
+		}
+	}
+
+	for _, rsrc := range limitedResources {
+		total := resource.Quantity{}
+		limited := true
+		for _, container := range pod.Spec.Containers {
+			limit, ok := container.Resources.Limits[rsrc]
+			if !ok {
+				limited = false
+				break
+			}
+			total.Add(limit)
+		}
+		if limited {
+			limits[rsrc] = total
+		}
+	}
+
+	return limits
+}
+
+// limitUsage returns the usage bounded by the limits.
+// Memory is capped at the limit as well, since the pod using more is killed by the OOM killer (see
+// Pod.ExceedsMemoryLimit).
+func limitUsage(usage, limits v1.ResourceList) v1.ResourceList {
+	if len(limits) == 0 {
+		return usage
+	}
+
+	var limited v1.ResourceList
+	for rsrc, limit := range limits {
+		q, ok := usage[rsrc]
+		if !ok || q.Cmp(limit) <= 0 {
+			continue
+		}
+		if limited == nil {
+			limited = usage.DeepCopy()
+		}
+		limited[rsrc] = limit.DeepCopy()
+	}
+
+	if limited == nil {
+		return usage
+	}
+	return limited
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pod
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"simulator/pkg/clock"
+)
+
+func TestPodQOSClass(t *testing.T) {
+	start := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	newPod := func(containers ...v1.ResourceRequirements) *v1.Pod {
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod",
+			Namespace: "default",
+			Annotations: map[string]string{"simSpec": `
+- seconds: 100
+  resourceUsage:
+    cpu: 3
+    memory: 3Gi
+`},
+		}}
+		for _, resources := range containers {
+			pod.Spec.Containers = append(pod.Spec.Containers, v1.Container{Resources: resources})
+		}
+		return pod
+	}
+	resources := func(cpu, memory string) v1.ResourceList {
+		return v1.ResourceList{"cpu": resource.MustParse(cpu), "memory": resource.MustParse(memory)}
+	}
+	clk := start.Add(10 * time.Second)
+
+	simPod, err := NewPod(newPod(v1.ResourceRequirements{}), start, Ok, "node")
+	assert.NoError(t, err)
+	assert.Equal(t, v1.PodQOSBestEffort, simPod.QOSClass())
+	assert.Equal(t, 0, simPod.QOSRank())
+	assert.Equal(t, "3", resourceString(simPod.ResourceUsage(clk), v1.ResourceCPU))
+	assert.Equal(t, "3Gi", resourceString(simPod.ResourceUsage(clk), v1.ResourceMemory))
+
+	// The usage is capped at the limits of all of the containers.
+	simPod, err = NewPod(newPod(
+		v1.ResourceRequirements{Requests: resources("1", "1Gi"), Limits: resources("1", "1Gi")},
+		v1.ResourceRequirements{Requests: resources("1", "1Gi"), Limits: resources("1", "1Gi")},
+	), start, Ok, "node")
+	assert.NoError(t, err)
+	assert.Equal(t, v1.PodQOSGuaranteed, simPod.QOSClass())
+	assert.Equal(t, 2, simPod.QOSRank())
+	assert.Equal(t, "2", resourceString(simPod.ResourceUsage(clk), v1.ResourceCPU))
+	assert.Equal(t, "2Gi", resourceString(simPod.ResourceUsage(clk), v1.ResourceMemory))
+	assert.Equal(t, v1.PodQOSGuaranteed, simPod.BuildStatus(clk).QOSClass)
+	assert.Equal(t, v1.PodQOSGuaranteed, simPod.Metrics(clk).QOSClass)
+
+	// A container without the limit of a resource does not bound its usage.
+	simPod, err = NewPod(newPod(
+		v1.ResourceRequirements{Requests: resources("1", "1Gi"), Limits: resources("2", "1Gi")},
+		v1.ResourceRequirements{Limits: v1.ResourceList{"memory": resource.MustParse("1Gi")}},
+	), start, Ok, "node")
+	assert.NoError(t, err)
+	assert.Equal(t, v1.PodQOSBurstable, simPod.QOSClass())
+	assert.Equal(t, 1, simPod.QOSRank())
+	assert.Equal(t, "3", resourceString(simPod.ResourceUsage(clk), v1.ResourceCPU))
+	assert.Equal(t, "2Gi", resourceString(simPod.ResourceUsage(clk), v1.ResourceMemory))
+}
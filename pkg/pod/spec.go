@@ -15,12 +15,18 @@
 package pod
 
 import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/cpuguy83/strongerrors"
 	"github.com/pkg/errors"
 	yaml "gopkg.in/yaml.v2"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/util"
+	"simulator/pkg/util"
 )
 
 // spec represents a list of a pod's resource usage spec of each execution phase.
@@ -32,15 +38,57 @@ type specPhase struct {
 	resourceUsage v1.ResourceList
 }
 
-// parseSpec parses the pod's "simSpec" annotation into spec.
-// Returns error if the "simSpec" annotation does not exist, or the failed to parse.
+// ResourceUsageAnnotation is the annotation key of a pod that specifies its resource usage in
+// execution phases (e.g., warmup, steady, and burst), as an alternative to the "simSpec" annotation.
+// The value is a YAML list of phases, each of which runs for the seconds and uses the resources at
+// the levels given as quantities (e.g., "500m") or percentages of the pod's requests (e.g., "80%").
+// The resources not listed in a phase are used as much as requested.
+// See "How to specify the resource usage of each pod" in README.md for an example.
+const ResourceUsageAnnotation = "simulator/resource-usage"
+
+// parseSpec parses the pod's "simSpec" or ResourceUsageAnnotation annotation into spec.
+// Returns error if neither or both of the annotations exist, or failed to parse.
 func parseSpec(pod *v1.Pod) (spec, error) {
-	specAnnot, ok := pod.ObjectMeta.Annotations["simSpec"]
-	if !ok {
+	specAnnot, hasSpec := pod.ObjectMeta.Annotations["simSpec"]
+	usageAnnot, hasUsage := pod.ObjectMeta.Annotations[ResourceUsageAnnotation]
+
+	switch {
+	case hasSpec && hasUsage:
+		return nil, strongerrors.InvalidArgument(
+			errors.Errorf("both simSpec and %s annotations defined", ResourceUsageAnnotation))
+	case hasUsage:
+		spec, err := parseResourceUsageYAML(usageAnnot, util.PodTotalResourceRequests(pod))
+		if err != nil {
+			return nil, strongerrors.InvalidArgument(
+				errors.Wrapf(err, "invalid %s annotation", ResourceUsageAnnotation))
+		}
+		return spec, nil
+	case hasSpec:
+		return parseSpecYAML(specAnnot)
+	default:
 		return nil, strongerrors.InvalidArgument(errors.Errorf("simSpec annotation not defined"))
 	}
+}
+
+// ExecutionDuration returns the total execution duration of the given pod, declared in its
+// "simSpec" or ResourceUsageAnnotation annotation.
+// Returns error if neither annotation is valid.
+func ExecutionDuration(pod *v1.Pod) (time.Duration, error) {
+	spec, err := parseSpec(pod)
+	if err != nil {
+		return 0, err
+	}
+
+	return spec.totalDuration(), nil
+}
 
-	return parseSpecYAML(specAnnot)
+// totalDuration returns the sum of the durations of all phases.
+func (sp spec) totalDuration() time.Duration {
+	phaseSecondsTotal := int32(0)
+	for _, phase := range sp {
+		phaseSecondsTotal += phase.seconds
+	}
+	return time.Duration(phaseSecondsTotal) * time.Second
 }
 
 // parseSpecYAML parses the YAML into spec.
@@ -74,3 +122,79 @@ func parseSpecYAML(specYAML string) (spec, error) {
 
 	return spec, nil
 }
+
+// parseResourceUsageYAML parses the YAML of ResourceUsageAnnotation into spec, with the percentages
+// relative to the requests.
+// Returns error if failed to parse, or a percentage is given for a resource not requested.
+func parseResourceUsageYAML(usageYAML string, requests v1.ResourceList) (spec, error) {
+	type phaseYAML struct {
+		Phase   string                     `yaml:"phase"`
+		Seconds int32                      `yaml:"seconds"`
+		Usage   map[v1.ResourceName]string `yaml:"usage"`
+	}
+
+	phases := []phaseYAML{}
+	if err := yaml.UnmarshalStrict([]byte(usageYAML), &phases); err != nil {
+		return nil, err
+	}
+	if len(phases) == 0 {
+		return nil, errors.New("no phases defined")
+	}
+
+	spec := spec{}
+	for i, phase := range phases {
+		name := phase.Phase
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		if phase.Seconds < 0 {
+			return nil, errors.Errorf("negative seconds of phase %s", name)
+		}
+
+		usage := v1.ResourceList{}
+		for rsrc, req := range requests {
+			usage[rsrc] = req
+		}
+		for rsrc, level := range phase.Usage {
+			q, err := parseUsageLevel(level, requests, rsrc)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid %s usage of phase %s", rsrc, name)
+			}
+			usage[rsrc] = q
+		}
+
+		spec = append(spec, specPhase{
+			seconds:       phase.Seconds,
+			resourceUsage: usage,
+		})
+	}
+
+	return spec, nil
+}
+
+// parseUsageLevel parses the usage level of the resource, either a quantity or a percentage of the
+// request.
+func parseUsageLevel(level string, requests v1.ResourceList, rsrc v1.ResourceName) (resource.Quantity, error) {
+	if !strings.HasSuffix(level, "%") {
+		q, err := resource.ParseQuantity(level)
+		if err != nil {
+			return resource.Quantity{}, err
+		}
+		if q.Sign() < 0 {
+			return resource.Quantity{}, errors.Errorf("negative usage %q", level)
+		}
+		return q, nil
+	}
+
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(level, "%"), 64)
+	if err != nil || percent < 0 || math.IsNaN(percent) || math.IsInf(percent, 0) {
+		return resource.Quantity{}, errors.Errorf("invalid percentage %q", level)
+	}
+	req, ok := requests[rsrc]
+	if !ok {
+		return resource.Quantity{}, errors.Errorf("percentage %q of a resource not requested", level)
+	}
+
+	milli := int64(math.Round(float64(req.MilliValue()) * percent / 100))
+	return *resource.NewMilliQuantity(milli, req.Format), nil
+}
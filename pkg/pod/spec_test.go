@@ -17,6 +17,7 @@ package pod
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
@@ -136,3 +137,95 @@ func TestParseSpecYAML(t *testing.T) {
 	_, err = parseSpecYAML(yamlStrInvalid)
 	assert.EqualError(t, err, "Invalid spec.resoruceUsage field")
 }
+
+func TestParseResourceUsage(t *testing.T) {
+	newPod := func(usage string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pod",
+				Namespace:   "default",
+				Annotations: map[string]string{ResourceUsageAnnotation: usage},
+			},
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{{
+					Resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+						"cpu":    resource.MustParse("2"),
+						"memory": resource.MustParse("4Gi"),
+					}},
+				}},
+			},
+		}
+	}
+
+	actual, err := parseSpec(newPod(`
+- phase: warmup
+  seconds: 60
+  usage:
+    cpu: 25%
+- phase: steady
+  seconds: 600
+  usage:
+    cpu: 1500m
+    memory: 50%
+- phase: burst
+  seconds: 30
+  usage:
+    cpu: 150%
+    nvidia.com/gpu: 1
+`))
+	assert.NoError(t, err)
+
+	expected := spec{
+		{seconds: 60, resourceUsage: v1.ResourceList{
+			"cpu":    resource.MustParse("500m"),
+			"memory": resource.MustParse("4Gi"),
+		}},
+		{seconds: 600, resourceUsage: v1.ResourceList{
+			"cpu":    resource.MustParse("1500m"),
+			"memory": resource.MustParse("2Gi"),
+		}},
+		{seconds: 30, resourceUsage: v1.ResourceList{
+			"cpu":            resource.MustParse("3"),
+			"memory":         resource.MustParse("4Gi"),
+			"nvidia.com/gpu": resource.MustParse("1"),
+		}},
+	}
+	assert.Len(t, actual, len(expected))
+	for i := range expected {
+		assert.Equal(t, expected[i].seconds, actual[i].seconds)
+		assert.Equal(t, len(expected[i].resourceUsage), len(actual[i].resourceUsage))
+		for rsrc, q := range expected[i].resourceUsage {
+			actualQ := actual[i].resourceUsage[rsrc]
+			assert.Zero(t, q.Cmp(actualQ), "phase %d, %s: %s", i, rsrc, actualQ.String())
+		}
+	}
+
+	dur, err := ExecutionDuration(newPod("- seconds: 60\n- seconds: 30\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 90*time.Second, dur)
+
+	for _, tc := range []struct{ usage, err string }{
+		{"[]", "invalid simulator/resource-usage annotation: no phases defined"},
+		{"- seconds: -1", "invalid simulator/resource-usage annotation: negative seconds of phase 0"},
+		{"- seconds: 1\n  usage:\n    nvidia.com/gpu: 50%",
+			`invalid simulator/resource-usage annotation: invalid nvidia.com/gpu usage of phase 0: ` +
+				`percentage "50%" of a resource not requested`},
+		{"- phase: burst\n  seconds: 1\n  usage:\n    cpu: x%",
+			`invalid simulator/resource-usage annotation: invalid cpu usage of phase burst: invalid percentage "x%"`},
+		{"- seconds: 1\n  usage:\n    cpu: NaN%",
+			`invalid simulator/resource-usage annotation: invalid cpu usage of phase 0: invalid percentage "NaN%"`},
+		{"- seconds: 1\n  usage:\n    cpu: Inf%",
+			`invalid simulator/resource-usage annotation: invalid cpu usage of phase 0: invalid percentage "Inf%"`},
+	} {
+		_, err := parseSpec(newPod(tc.usage))
+		assert.EqualError(t, err, tc.err)
+	}
+
+	_, err = parseSpec(newPod("- seconds: 1\n  usgae:\n    cpu: 1"))
+	assert.Error(t, err)
+
+	pod := newPod("- seconds: 1")
+	pod.Annotations["simSpec"] = "- seconds: 1\n  resourceUsage:\n    cpu: 1"
+	_, err = parseSpec(pod)
+	assert.EqualError(t, err, "both simSpec and simulator/resource-usage annotations defined")
+}
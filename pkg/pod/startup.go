@@ -0,0 +1,96 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pod
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/clock"
+)
+
+// InitSecondsAnnotation is the annotation key of a pod that specifies the time in seconds it takes
+// to initialize after its images are pulled (e.g., to run init containers and warm up), overriding
+// StartupLatency.Init.
+const InitSecondsAnnotation = "simulator/init-seconds"
+
+// StartupLatency is a model of the latency from the binding of a pod to the start of its
+// execution, the sum of:
+//  1. Bind, the latency of the binding until the kubelet notices the pod,
+//  2. the time to pull the images of the pod that its node does not have, at ImagePullBandwidth,
+//     and
+//  3. Init, the time to initialize the pod, overridden by InitSecondsAnnotation.
+type StartupLatency struct {
+	Bind time.Duration
+	// ImagePullBandwidth is the number of bytes of images pulled per second by a node, or 0 if an
+	// image is pulled instantly.
+	ImagePullBandwidth int64
+	Init               time.Duration
+}
+
+// PullDuration returns the time to pull the image of the size in bytes.
+func (l StartupLatency) PullDuration(size int64) time.Duration {
+	if l.ImagePullBandwidth <= 0 {
+		return 0
+	}
+	return time.Duration(float64(size) / float64(l.ImagePullBandwidth) * float64(time.Second))
+}
+
+// InitDuration returns the time to initialize this Pod, specified by InitSecondsAnnotation or the
+// default.
+func (pod *Pod) InitDuration(def time.Duration) time.Duration {
+	if pod.initDuration != nil {
+		return *pod.initDuration
+	}
+	return def
+}
+
+// SetStartupLatency sets the latency from the binding of this Pod to the start of its execution.
+// This Pod occupies its node, with no resource usage, until it starts.
+func (pod *Pod) SetStartupLatency(latency time.Duration) {
+	pod.startupLatency = latency
+}
+
+// StartupLatency returns the latency from the binding of this Pod to the start of its execution.
+func (pod *Pod) StartupLatency() time.Duration {
+	return pod.startupLatency
+}
+
+// IsStarting returns whether this Pod is bound but has not started its execution at the clock.
+func (pod *Pod) IsStarting(clock clock.Clock) bool {
+	return pod.status == Ok && clock.Before(pod.startAt())
+}
+
+// parseInitSeconds parses InitSecondsAnnotation of the pod, or returns nil if not annotated.
+// Returns error if failed to parse.
+func parseInitSeconds(pod *v1.Pod) (*time.Duration, error) {
+	annot, ok := pod.Annotations[InitSecondsAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	seconds, err := strconv.ParseFloat(annot, 64)
+	if err != nil || seconds < 0 {
+		return nil, strongerrors.InvalidArgument(
+			errors.Errorf("invalid %s annotation %q", InitSecondsAnnotation, annot))
+	}
+	d := time.Duration(seconds * float64(time.Second))
+
+	return &d, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pod
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"simulator/pkg/clock"
+)
+
+func TestPodStartupLatency(t *testing.T) {
+	start := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	v1Pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod",
+			Namespace: "default",
+			Annotations: map[string]string{
+				"simSpec":             "- seconds: 100\n  resourceUsage:\n    cpu: 1\n",
+				InitSecondsAnnotation: "2.5",
+			},
+		},
+		Spec: v1.PodSpec{Containers: []v1.Container{{Name: "container"}}},
+	}
+
+	simPod, err := NewPod(v1Pod, start, Ok, "node")
+	assert.NoError(t, err)
+	assert.Equal(t, 2500*time.Millisecond, simPod.InitDuration(time.Second))
+	simPod.SetStartupLatency(10 * time.Second)
+
+	// The pod occupies the node with no usage until it starts.
+	clk := start.Add(5 * time.Second)
+	assert.True(t, simPod.IsRunning(clk))
+	assert.True(t, simPod.IsStarting(clk))
+	assert.Empty(t, simPod.ResourceUsage(clk))
+	status := simPod.BuildStatus(clk)
+	assert.Equal(t, v1.PodPending, status.Phase)
+	assert.Equal(t, "ContainerCreating", status.ContainerStatuses[0].State.Waiting.Reason)
+
+	clk = start.Add(30 * time.Second)
+	assert.False(t, simPod.IsStarting(clk))
+	assert.Equal(t, "1", resourceString(simPod.ResourceUsage(clk), v1.ResourceCPU))
+	met := simPod.Metrics(clk)
+	assert.Equal(t, int32(20), met.ExecutedSeconds)
+	assert.Equal(t, start.Add(10*time.Second), met.StartedAt)
+	assert.Equal(t, v1.PodRunning, simPod.BuildStatus(clk).Phase)
+
+	// The execution finishes after the startup latency plus the execution time.
+	assert.True(t, simPod.IsRunning(start.Add(109*time.Second)))
+	assert.True(t, simPod.IsTerminated(start.Add(110*time.Second)))
+
+	v1Pod.Annotations[InitSecondsAnnotation] = "-1"
+	_, err = NewPod(v1Pod, start, Ok, "node")
+	assert.EqualError(t, err, `invalid simulator/init-seconds annotation "-1"`)
+}
+
+func TestStartupLatencyPullDuration(t *testing.T) {
+	assert.Equal(t, time.Duration(0), StartupLatency{}.PullDuration(1<<30))
+	assert.Equal(t, 2*time.Second, StartupLatency{ImagePullBandwidth: 50 << 20}.PullDuration(100<<20))
+}
+
+func TestPodSchedulingLatency(t *testing.T) {
+	start := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	v1Pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "pod",
+			Namespace:   "default",
+			Annotations: map[string]string{"simSpec": "- seconds: 100\n  resourceUsage:\n    cpu: 1\n"},
+		},
+	}
+
+	simPod, err := NewPod(v1Pod, start, Ok, "node")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, simPod.Metrics(start).SchedulingLatencySeconds)
+
+	v1Pod.CreationTimestamp = start.Add(-90 * time.Second).ToMetaV1()
+	simPod, err = NewPod(v1Pod, start, Ok, "node")
+	assert.NoError(t, err)
+	assert.Equal(t, 90.0, simPod.Metrics(start).SchedulingLatencySeconds)
+}
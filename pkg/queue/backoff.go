@@ -0,0 +1,314 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/util"
+)
+
+// Defaults of BackoffPolicy, which are those of kube-scheduler.
+const (
+	DefaultInitialBackoff       = 1 * time.Second
+	DefaultMaxBackoff           = 10 * time.Second
+	DefaultUnschedulableTimeout = 60 * time.Second
+)
+
+// BackoffPolicy is the policy of the backoff of the pods that the scheduler failed to schedule.
+type BackoffPolicy struct {
+	// Initial is the backoff after the first failure of a pod, which doubles at each failure up to
+	// Max.
+	Initial time.Duration
+	Max     time.Duration
+	// UnschedulableTimeout is the duration after which a pod is re-activated once its backoff has
+	// expired, even if the cluster has not changed.
+	UnschedulableTimeout time.Duration
+	// MaxRetries is the number of retries after which a pod failing again is given up, or 0 if
+	// unlimited.
+	MaxRetries int
+}
+
+// Backoff returns the backoff after the attempts-th failure.
+func (p BackoffPolicy) Backoff(attempts int) time.Duration {
+	backoff := p.Initial
+	for i := 1; i < attempts && backoff < p.Max; i++ {
+		backoff *= 2
+	}
+	if backoff > p.Max {
+		backoff = p.Max
+	}
+
+	return backoff
+}
+
+// BackoffMetrics represents a metrics of UnschedulablePods at one time point.
+type BackoffMetrics struct {
+	// UnschedulablePodsNum is the number of the pods waiting out their backoffs.
+	UnschedulablePodsNum int
+	// FailedPodsNum is the number of the pods given up after MaxRetries so far.
+	FailedPodsNum int
+}
+
+// UnschedulablePods is the set of the pods that the scheduler failed to schedule, held out of the
+// queue so that they do not block the other pods.
+// A pod is re-activated, i.e., pushed back to the queue, once its backoff has expired and the
+// cluster has changed (e.g., a node added or a pod completed) since it failed, or once
+// UnschedulableTimeout has also passed.
+type UnschedulablePods struct {
+	policy BackoffPolicy
+	pods   map[string]*unschedulablePod
+	// attempts is the number of failures of each pod, kept until the pod is bound or deleted.
+	attempts map[string]int
+	// changedAt is the clock at which the cluster changed last.
+	changedAt clock.Clock
+	failed    int
+}
+
+type unschedulablePod struct {
+	pod      *v1.Pod
+	key      string
+	failedAt clock.Clock
+	retryAt  clock.Clock
+}
+
+// NewUnschedulablePods creates a new UnschedulablePods with the policy.
+func NewUnschedulablePods(policy BackoffPolicy) *UnschedulablePods {
+	return &UnschedulablePods{
+		policy:   policy,
+		pods:     map[string]*unschedulablePod{},
+		attempts: map[string]int{},
+	}
+}
+
+// Add adds the pod that the scheduler failed to schedule at the clock, and returns true.
+// Returns false without adding it if it has failed more than MaxRetries times since its last
+// failure reset by Forget.
+func (u *UnschedulablePods) Add(pod *v1.Pod, clk clock.Clock) (bool, error) {
+	key, err := util.PodKey(pod)
+	if err != nil {
+		return false, err
+	}
+
+	u.attempts[key]++
+	attempts := u.attempts[key]
+	if u.policy.MaxRetries > 0 && attempts > u.policy.MaxRetries {
+		delete(u.attempts, key)
+		u.failed++
+		return false, nil
+	}
+
+	u.pods[key] = &unschedulablePod{
+		pod:      pod,
+		key:      key,
+		failedAt: clk,
+		retryAt:  clk.Add(u.policy.Backoff(attempts)),
+	}
+
+	return true, nil
+}
+
+// ClusterChanged notifies this UnschedulablePods that the cluster changed at the clock.
+func (u *UnschedulablePods) ClusterChanged(clk clock.Clock) {
+	u.changedAt = clk
+}
+
+// Reactivate removes and returns the pods to be re-activated at the clock, in the order of their
+// failures.
+func (u *UnschedulablePods) Reactivate(clk clock.Clock) []*v1.Pod {
+	return u.remove(func(p *unschedulablePod) bool {
+		return !clk.Before(u.reactivateAt(p))
+	})
+}
+
+// ReactivateAll removes and returns all of the pods, in the order of their failures.
+func (u *UnschedulablePods) ReactivateAll() []*v1.Pod {
+	return u.remove(func(*unschedulablePod) bool { return true })
+}
+
+// NextWakeup returns the earliest clock at which a pod is re-activated unless the cluster changes.
+// The second return value is false if no pod is held.
+func (u *UnschedulablePods) NextWakeup() (clock.Clock, bool) {
+	var next clock.Clock
+	found := false
+	for _, p := range u.pods {
+		if at := u.reactivateAt(p); !found || at.Before(next) {
+			next, found = at, true
+		}
+	}
+
+	return next, found
+}
+
+// Forget resets the failures of the pod with the key, e.g., when it is bound.
+func (u *UnschedulablePods) Forget(key string) {
+	delete(u.attempts, key)
+}
+
+// Delete deletes the pod from this UnschedulablePods.
+// Returns true if the pod is found, or false otherwise.
+func (u *UnschedulablePods) Delete(podNamespace, podName string) bool {
+	key := util.PodKeyFromNames(podNamespace, podName)
+	delete(u.attempts, key)
+	if _, ok := u.pods[key]; !ok {
+		return false
+	}
+	delete(u.pods, key)
+
+	return true
+}
+
+// Update updates the pod to the newPod, keeping its backoff.
+// Returns ErrNoMatchingPod if an original pod is not found.
+func (u *UnschedulablePods) Update(podNamespace, podName string, newPod *v1.Pod) error {
+	key := util.PodKeyFromNames(podNamespace, podName)
+	p, ok := u.pods[key]
+	if !ok {
+		return &ErrNoMatchingPod{key: key}
+	}
+	p.pod = newPod
+
+	return nil
+}
+
+// List returns the pods held, in the order of their failures.
+func (u *UnschedulablePods) List() []*v1.Pod {
+	held := make([]*unschedulablePod, 0, len(u.pods))
+	for _, p := range u.pods {
+		held = append(held, p)
+	}
+
+	return sortByFailure(held)
+}
+
+// BackoffState is the state of UnschedulablePods saved in a checkpoint.
+type BackoffState struct {
+	// Pods are the pods held, in the order of their failures.
+	Pods []BackoffPod `json:",omitempty"`
+	// Attempts maps the key of each pod that has failed since its last failure reset to the number
+	// of its failures, including the pods not held any longer (e.g., re-activated).
+	Attempts map[string]int `json:",omitempty"`
+	// ChangedAt is the clock at which the cluster changed last.
+	ChangedAt clock.Clock
+	// Failed is the number of the pods given up after MaxRetries so far.
+	Failed int `json:",omitempty"`
+}
+
+// BackoffPod is a pod held for its backoff in a BackoffState.
+type BackoffPod struct {
+	Pod      *v1.Pod
+	FailedAt clock.Clock
+	RetryAt  clock.Clock
+}
+
+// Snapshot returns a copy of the state of this UnschedulablePods.
+func (u *UnschedulablePods) Snapshot() *BackoffState {
+	held := make([]*unschedulablePod, 0, len(u.pods))
+	for _, p := range u.pods {
+		held = append(held, p)
+	}
+	sortByFailure(held)
+
+	state := &BackoffState{ChangedAt: u.changedAt, Failed: u.failed}
+	for _, p := range held {
+		state.Pods = append(state.Pods, BackoffPod{Pod: p.pod.DeepCopy(), FailedAt: p.failedAt, RetryAt: p.retryAt})
+	}
+	if len(u.attempts) > 0 {
+		state.Attempts = make(map[string]int, len(u.attempts))
+		for key, n := range u.attempts {
+			state.Attempts[key] = n
+		}
+	}
+
+	return state
+}
+
+// Restore restores the state returned by Snapshot into this UnschedulablePods, replacing its own.
+// Returns error if a pod in the state has an invalid key.
+func (u *UnschedulablePods) Restore(state *BackoffState) error {
+	pods := make(map[string]*unschedulablePod, len(state.Pods))
+	for _, p := range state.Pods {
+		key, err := util.PodKey(p.Pod)
+		if err != nil {
+			return err
+		}
+		pods[key] = &unschedulablePod{pod: p.Pod.DeepCopy(), key: key, failedAt: p.FailedAt, retryAt: p.RetryAt}
+	}
+	attempts := make(map[string]int, len(state.Attempts))
+	for key, n := range state.Attempts {
+		attempts[key] = n
+	}
+
+	u.pods, u.attempts = pods, attempts
+	u.changedAt, u.failed = state.ChangedAt, state.Failed
+	return nil
+}
+
+// Len returns the number of the pods held.
+func (u *UnschedulablePods) Len() int {
+	return len(u.pods)
+}
+
+// Metrics returns a metrics of this UnschedulablePods.
+func (u *UnschedulablePods) Metrics() BackoffMetrics {
+	return BackoffMetrics{
+		UnschedulablePodsNum: len(u.pods),
+		FailedPodsNum:        u.failed,
+	}
+}
+
+// reactivateAt returns the clock at which the pod is re-activated unless the cluster changes.
+func (u *UnschedulablePods) reactivateAt(p *unschedulablePod) clock.Clock {
+	if !u.changedAt.Before(p.failedAt) {
+		return p.retryAt
+	}
+	if timeout := p.failedAt.Add(u.policy.UnschedulableTimeout); p.retryAt.Before(timeout) {
+		return timeout
+	}
+	return p.retryAt
+}
+
+// remove removes and returns the pods satisfying the predicate, in the order of their failures.
+func (u *UnschedulablePods) remove(pred func(*unschedulablePod) bool) []*v1.Pod {
+	removed := []*unschedulablePod{}
+	for key, p := range u.pods {
+		if pred(p) {
+			removed = append(removed, p)
+			delete(u.pods, key)
+		}
+	}
+	return sortByFailure(removed)
+}
+
+// sortByFailure sorts the pods in the order of their failures, then of their keys.
+func sortByFailure(held []*unschedulablePod) []*v1.Pod {
+	sort.Slice(held, func(i, j int) bool {
+		if held[i].failedAt.Sub(held[j].failedAt) != 0 {
+			return held[i].failedAt.Before(held[j].failedAt)
+		}
+		return held[i].key < held[j].key
+	})
+
+	pods := make([]*v1.Pod, 0, len(held))
+	for _, p := range held {
+		pods = append(pods, p.pod)
+	}
+
+	return pods
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/queue"
+)
+
+func TestBackoffPolicyBackoff(t *testing.T) {
+	policy := queue.BackoffPolicy{Initial: time.Second, Max: 10 * time.Second}
+	assert.Equal(t, time.Second, policy.Backoff(1))
+	assert.Equal(t, 2*time.Second, policy.Backoff(2))
+	assert.Equal(t, 8*time.Second, policy.Backoff(4))
+	assert.Equal(t, 10*time.Second, policy.Backoff(5))
+	assert.Equal(t, 10*time.Second, policy.Backoff(100))
+}
+
+func TestUnschedulablePods(t *testing.T) {
+	start := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	u := queue.NewUnschedulablePods(queue.BackoffPolicy{
+		Initial:              time.Second,
+		Max:                  10 * time.Second,
+		UnschedulableTimeout: 60 * time.Second,
+		MaxRetries:           2,
+	})
+
+	added, err := u.Add(newPod("pod-0"), start)
+	assert.NoError(t, err)
+	assert.True(t, added)
+	added, err = u.Add(newPod("pod-1"), start.Add(time.Second))
+	assert.NoError(t, err)
+	assert.True(t, added)
+	assert.Equal(t, 2, u.Len())
+
+	// Without cluster changes, the pods wait for the timeout.
+	next, ok := u.NextWakeup()
+	assert.True(t, ok)
+	assert.Equal(t, start.Add(60*time.Second), next)
+	assert.Empty(t, u.Reactivate(start.Add(10*time.Second)))
+
+	// Once the cluster changes, pod-0 is re-activated after its backoff, and pod-1 is not since it
+	// failed after the change.
+	u.ClusterChanged(start.Add(500 * time.Millisecond))
+	pods := u.Reactivate(start.Add(time.Second))
+	assert.Len(t, pods, 1)
+	assert.Equal(t, "pod-0", pods[0].Name)
+	pods = u.Reactivate(start.Add(61 * time.Second))
+	assert.Len(t, pods, 1)
+	assert.Equal(t, "pod-1", pods[0].Name)
+
+	// The second failure doubles the backoff, and the third gives up the pod.
+	added, err = u.Add(newPod("pod-0"), start.Add(100*time.Second))
+	assert.NoError(t, err)
+	assert.True(t, added)
+	u.ClusterChanged(start.Add(100 * time.Second))
+	assert.Empty(t, u.Reactivate(start.Add(101*time.Second)))
+	assert.Len(t, u.Reactivate(start.Add(102*time.Second)), 1)
+	added, err = u.Add(newPod("pod-0"), start.Add(110*time.Second))
+	assert.NoError(t, err)
+	assert.False(t, added)
+	assert.Equal(t, queue.BackoffMetrics{UnschedulablePodsNum: 0, FailedPodsNum: 1}, u.Metrics())
+
+	// Forget resets the failures.
+	_, _ = u.Add(newPod("pod-1"), start.Add(120*time.Second))
+	u.Forget("default/pod-1")
+	assert.True(t, u.Delete("default", "pod-1"))
+	assert.False(t, u.Delete("default", "pod-1"))
+	added, _ = u.Add(newPod("pod-1"), start.Add(130*time.Second))
+	assert.True(t, added)
+	assert.IsType(t, &queue.ErrNoMatchingPod{}, u.Update("default", "pod-2", newPod("pod-2")))
+	assert.NoError(t, u.Update("default", "pod-1", newPod("pod-1")))
+	assert.Len(t, u.ReactivateAll(), 1)
+	_, ok = u.NextWakeup()
+	assert.False(t, ok)
+}
+
+func TestUnschedulablePodsSnapshot(t *testing.T) {
+	start := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	policy := queue.BackoffPolicy{
+		Initial:              time.Second,
+		Max:                  10 * time.Second,
+		UnschedulableTimeout: 60 * time.Second,
+		MaxRetries:           2,
+	}
+	u := queue.NewUnschedulablePods(policy)
+	_, err := u.Add(newPod("pod-0"), start)
+	assert.NoError(t, err)
+	u.ClusterChanged(start)
+	assert.Len(t, u.Reactivate(start.Add(time.Second)), 1)
+	_, err = u.Add(newPod("pod-0"), start.Add(10*time.Second))
+	assert.NoError(t, err)
+	_, err = u.Add(newPod("pod-1"), start.Add(11*time.Second))
+	assert.NoError(t, err)
+	u.ClusterChanged(start.Add(11 * time.Second))
+
+	state := u.Snapshot()
+	assert.Len(t, state.Pods, 2)
+	assert.Equal(t, "pod-0", state.Pods[0].Pod.Name)
+	assert.Equal(t, map[string]int{"default/pod-0": 2, "default/pod-1": 1}, state.Attempts)
+
+	// The restored pods keep their failures and retry clocks.
+	restored := queue.NewUnschedulablePods(policy)
+	assert.NoError(t, restored.Restore(state))
+	assert.Equal(t, 2, restored.Len())
+	next, ok := restored.NextWakeup()
+	assert.True(t, ok)
+	assert.Equal(t, start.Add(12*time.Second), next)
+	pods := restored.Reactivate(start.Add(12 * time.Second))
+	assert.Len(t, pods, 2)
+	added, err := restored.Add(newPod("pod-0"), start.Add(20*time.Second))
+	assert.NoError(t, err)
+	assert.False(t, added)
+	assert.Equal(t, queue.BackoffMetrics{UnschedulablePodsNum: 0, FailedPodsNum: 1}, restored.Metrics())
+}
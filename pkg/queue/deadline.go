@@ -0,0 +1,73 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/pod"
+)
+
+// EarliestDeadlineFirst is a Compare function that returns true if pod0 has an earlier deadline (see
+// pod.DeadlineAnnotation) than pod1.
+// Pods with deadlines precede those without; ties are broken by DefaultComparator.
+func EarliestDeadlineFirst(pod0, pod1 *v1.Pod) bool {
+	return compareByKey(pod0, pod1, func(p *v1.Pod) (clock.Clock, bool) {
+		deadline, ok, err := pod.Deadline(p)
+		return deadline, ok && err == nil
+	})
+}
+
+// LeastLaxityFirst is a Compare function that returns true if pod0 has less laxity than pod1.
+// The laxity of a pod is its deadline minus the current clock minus its execution duration declared
+// in its "simSpec" annotation, so pending pods are ordered by their latest start times.
+// Pods with deadlines precede those without; ties are broken by DefaultComparator.
+func LeastLaxityFirst(pod0, pod1 *v1.Pod) bool {
+	return compareByKey(pod0, pod1, latestStart)
+}
+
+// latestStart returns the latest clock at which the pod can start and meet its deadline.
+func latestStart(p *v1.Pod) (clock.Clock, bool) {
+	deadline, ok, err := pod.Deadline(p)
+	if err != nil || !ok {
+		return clock.Clock{}, false
+	}
+
+	dur, err := pod.ExecutionDuration(p)
+	if err != nil {
+		return deadline, true
+	}
+
+	return deadline.Add(-dur), true
+}
+
+// compareByKey returns true if pod0 has an earlier key than pod1.
+func compareByKey(pod0, pod1 *v1.Pod, key func(*v1.Pod) (clock.Clock, bool)) bool {
+	key0, ok0 := key(pod0)
+	key1, ok1 := key(pod1)
+
+	switch {
+	case ok0 && ok1 && key0.Sub(key1) != 0:
+		return key0.Before(key1)
+	case ok0 != ok1:
+		return ok0
+	default:
+		return DefaultComparator(pod0, pod1)
+	}
+}
+
+var _ = Compare(EarliestDeadlineFirst)
+var _ = Compare(LeastLaxityFirst)
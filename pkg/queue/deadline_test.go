@@ -0,0 +1,75 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"simulator/pkg/pod"
+)
+
+func newPodWithDeadline(name, deadline string, seconds string, ts metav1.Time) *v1.Pod {
+	p := newPodWithPriority(name, nil, ts)
+	p.Annotations = map[string]string{
+		"simSpec": "- seconds: " + seconds + "\n  resourceUsage:\n    cpu: 1\n",
+	}
+	if deadline != "" {
+		p.Annotations[pod.DeadlineAnnotation] = deadline
+	}
+	return p
+}
+
+func popNames(t *testing.T, q PodQueue) []string {
+	names := []string{}
+	for {
+		p, err := q.Pop()
+		if err == ErrEmptyQueue {
+			return names
+		}
+		assert.NoError(t, err)
+		names = append(names, p.Name)
+	}
+}
+
+func TestEarliestDeadlineFirst(t *testing.T) {
+	now := metav1.Now()
+	later := metav1.NewTime(now.Add(time.Second))
+
+	q := NewPriorityQueueWithComparator(EarliestDeadlineFirst)
+	_ = q.Push(newPodWithDeadline("none", "", "10", now))
+	_ = q.Push(newPodWithDeadline("late", "20m", "10", now))
+	_ = q.Push(newPodWithDeadline("early", now.Add(5*time.Minute).Format(time.RFC3339), "10", now))
+	_ = q.Push(newPodWithDeadline("invalid", "tomorrow", "10", now))
+	_ = q.Push(newPodWithDeadline("late-newer", "20m", "10", later))
+
+	assert.Equal(t, []string{"early", "late", "late-newer", "none", "invalid"}, popNames(t, q))
+}
+
+func TestLeastLaxityFirst(t *testing.T) {
+	now := metav1.Now()
+
+	q := NewPriorityQueueWithComparator(LeastLaxityFirst)
+	_ = q.Push(newPodWithDeadline("none", "", "10", now))
+	_ = q.Push(newPodWithDeadline("short", "10m", "60", now))
+	_ = q.Push(newPodWithDeadline("long", "15m", "600", now))
+
+	// The long pod must start by 5 minutes after, the short one by 9 minutes after.
+	assert.Equal(t, []string{"long", "short", "none"}, popNames(t, q))
+}
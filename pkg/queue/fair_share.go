@@ -0,0 +1,282 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/util"
+)
+
+// FairShareQueue stores pods in a queue per tenant, a namespace or the value of a label of pods,
+// and pops the pods of the tenant with the lowest weighted dominant share first, as in Dominant
+// Resource Fairness (DRF).
+// The dominant share of a tenant is the largest ratio, over the resources, of the requests of its
+// running pods to the allocatable resources of the cluster (see AllocationObserver), plus the
+// requests of its pods popped since then; it is divided by the weight of the tenant.
+// Ties are broken by DefaultComparator between the front pods of the tenants, then by their names.
+// The pods of each tenant are sorted by DefaultComparator.
+type FairShareQueue struct {
+	tenantLabel string
+	weights     map[string]float64
+
+	tenants map[string]*PriorityQueue
+	// tenantOf maps the key of each queued pod to its tenant.
+	tenantOf map[string]string
+
+	capacity map[v1.ResourceName]int64
+	// allocated is the requests in milli-units of the running and popped pods of each tenant.
+	allocated map[string]map[v1.ResourceName]int64
+	// popped maps the key of each pod popped since the last ObserveAllocation to its tenant, so that
+	// its requests are subtracted again if it is pushed back.
+	popped map[string]string
+}
+
+// NewFairShareQueue creates a new FairShareQueue whose tenants are the values of the label of pods
+// with the key tenantLabel, or their namespaces if empty.
+// The weights of the tenants default to 1.
+func NewFairShareQueue(tenantLabel string, weights map[string]float64) *FairShareQueue {
+	return &FairShareQueue{
+		tenantLabel: tenantLabel,
+		weights:     weights,
+		tenants:     map[string]*PriorityQueue{},
+		tenantOf:    map[string]string{},
+		capacity:    map[v1.ResourceName]int64{},
+		allocated:   map[string]map[v1.ResourceName]int64{},
+		popped:      map[string]string{},
+	}
+}
+
+func (q *FairShareQueue) Push(pod *v1.Pod) error {
+	key, err := util.PodKey(pod)
+	if err != nil {
+		return err
+	}
+
+	if tenant, ok := q.popped[key]; ok {
+		q.allocate(tenant, pod, -1)
+		delete(q.popped, key)
+	}
+
+	tenant := q.tenant(pod)
+	if err := q.queueOf(tenant).Push(pod); err != nil {
+		return err
+	}
+	q.tenantOf[key] = tenant
+
+	return nil
+}
+
+func (q *FairShareQueue) Pop() (*v1.Pod, error) {
+	tenant, ok := q.frontTenant()
+	if !ok {
+		return nil, ErrEmptyQueue
+	}
+
+	pod, err := q.tenants[tenant].Pop()
+	if err != nil {
+		return nil, err
+	}
+	key, _ := util.PodKey(pod) // stored pod never have invalid key
+	delete(q.tenantOf, key)
+
+	q.popped[key] = tenant
+	q.allocate(tenant, pod, 1)
+
+	return pod, nil
+}
+
+func (q *FairShareQueue) Front() (*v1.Pod, error) {
+	tenant, ok := q.frontTenant()
+	if !ok {
+		return nil, ErrEmptyQueue
+	}
+	return q.tenants[tenant].Front()
+}
+
+func (q *FairShareQueue) Delete(podNamespace, podName string) bool {
+	key := util.PodKeyFromNames(podNamespace, podName)
+	tenant, ok := q.tenantOf[key]
+	if !ok {
+		return false
+	}
+	delete(q.tenantOf, key)
+
+	return q.tenants[tenant].Delete(podNamespace, podName)
+}
+
+func (q *FairShareQueue) Update(podNamespace, podName string, newPod *v1.Pod) error {
+	keyOrig := util.PodKeyFromNames(podNamespace, podName)
+	keyNew, err := util.PodKey(newPod)
+	if err != nil {
+		return err
+	}
+	if keyOrig != keyNew {
+		return ErrDifferentNames
+	}
+
+	tenant, ok := q.tenantOf[keyOrig]
+	if !ok {
+		return &ErrNoMatchingPod{key: keyOrig}
+	}
+
+	// The new pod may belong to another tenant.
+	if q.tenant(newPod) != tenant {
+		q.Delete(podNamespace, podName)
+		return q.Push(newPod)
+	}
+
+	return q.tenants[tenant].Update(podNamespace, podName, newPod)
+}
+
+func (q *FairShareQueue) UpdateNominatedNode(pod *v1.Pod, nodeName string) error {
+	return q.queueOf(q.tenant(pod)).UpdateNominatedNode(pod, nodeName)
+}
+
+func (q *FairShareQueue) RemoveNominatedNode(pod *v1.Pod) error {
+	return q.queueOf(q.tenant(pod)).RemoveNominatedNode(pod)
+}
+
+func (q *FairShareQueue) NominatedPods(nodeName string) []*v1.Pod {
+	pods := []*v1.Pod{}
+	for _, tenant := range q.tenantNames() {
+		pods = append(pods, q.tenants[tenant].NominatedPods(nodeName)...)
+	}
+
+	return pods
+}
+
+func (q *FairShareQueue) Metrics() Metrics {
+	return Metrics{
+		PendingPodsNum: len(q.tenantOf),
+	}
+}
+
+// List implements Lister interface.
+// The pods are listed by tenant in the order of their names, each in the order of the queue of the
+// tenant (see PriorityQueue.List).
+func (q *FairShareQueue) List() []*v1.Pod {
+	pods := make([]*v1.Pod, 0, len(q.tenantOf))
+	for _, tenant := range q.tenantNames() {
+		pods = append(pods, q.tenants[tenant].List()...)
+	}
+
+	return pods
+}
+
+// ObserveAllocation implements AllocationObserver interface.
+// It resets the allocation of each tenant to the requests of its running pods.
+func (q *FairShareQueue) ObserveAllocation(capacity v1.ResourceList, pods []*v1.Pod) {
+	q.capacity = make(map[v1.ResourceName]int64, len(capacity))
+	for rsrc, quantity := range capacity {
+		q.capacity[rsrc] = quantity.MilliValue()
+	}
+
+	q.allocated = map[string]map[v1.ResourceName]int64{}
+	q.popped = map[string]string{}
+	for _, pod := range pods {
+		q.allocate(q.tenant(pod), pod, 1)
+	}
+}
+
+// DominantShare returns the dominant share of the tenant divided by its weight.
+func (q *FairShareQueue) DominantShare(tenant string) float64 {
+	share := 0.0
+	for rsrc, allocated := range q.allocated[tenant] {
+		if capacity := q.capacity[rsrc]; capacity > 0 {
+			if s := float64(allocated) / float64(capacity); s > share {
+				share = s
+			}
+		}
+	}
+
+	weight, ok := q.weights[tenant]
+	if !ok {
+		weight = 1
+	}
+
+	return share / weight
+}
+
+// tenant returns the tenant of the pod.
+func (q *FairShareQueue) tenant(pod *v1.Pod) string {
+	if q.tenantLabel == "" {
+		return pod.Namespace
+	}
+	return pod.Labels[q.tenantLabel]
+}
+
+// queueOf returns the queue of the tenant, creating it if not exists.
+func (q *FairShareQueue) queueOf(tenant string) *PriorityQueue {
+	pq, ok := q.tenants[tenant]
+	if !ok {
+		pq = NewPriorityQueue()
+		q.tenants[tenant] = pq
+	}
+
+	return pq
+}
+
+// tenantNames returns the names of the tenants in order.
+func (q *FairShareQueue) tenantNames() []string {
+	names := make([]string, 0, len(q.tenants))
+	for tenant := range q.tenants {
+		names = append(names, tenant)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// frontTenant returns the tenant whose front pod is popped next.
+// The second return value is false if no pod is queued.
+func (q *FairShareQueue) frontTenant() (string, bool) {
+	var front string
+	var frontPod *v1.Pod
+	var frontShare float64
+
+	for _, tenant := range q.tenantNames() {
+		pod, err := q.tenants[tenant].Front()
+		if err != nil {
+			continue
+		}
+
+		share := q.DominantShare(tenant)
+		if frontPod == nil || share < frontShare || (share == frontShare && DefaultComparator(pod, frontPod)) {
+			front, frontPod, frontShare = tenant, pod, share
+		}
+	}
+
+	return front, frontPod != nil
+}
+
+// allocate adds the requests of the pod, multiplied by sign, to the allocation of the tenant.
+func (q *FairShareQueue) allocate(tenant string, pod *v1.Pod, sign int64) {
+	allocated, ok := q.allocated[tenant]
+	if !ok {
+		allocated = map[v1.ResourceName]int64{}
+		q.allocated[tenant] = allocated
+	}
+
+	for rsrc, quantity := range util.PodTotalResourceRequests(pod) {
+		allocated[rsrc] += sign * quantity.MilliValue()
+	}
+}
+
+var _ = PodQueue(&FairShareQueue{})
+var _ = Lister(&FairShareQueue{})
+var _ = AllocationObserver(&FairShareQueue{})
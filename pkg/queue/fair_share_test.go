@@ -0,0 +1,110 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTenantPod(namespace, name, cpu string, ts metav1.Time) *v1.Pod {
+	p := newPodWithPriority(name, nil, ts)
+	p.Namespace = namespace
+	p.Spec.Containers = []v1.Container{{
+		Resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpu)},
+		},
+	}}
+	return p
+}
+
+func TestFairShareQueue(t *testing.T) {
+	t0 := metav1.Now()
+	at := func(sec int) metav1.Time { return metav1.NewTime(t0.Add(time.Duration(sec) * time.Second)) }
+	capacity := v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("10"),
+		v1.ResourceMemory: resource.MustParse("10Gi"),
+	}
+
+	q := NewFairShareQueue("", nil)
+	for _, p := range []*v1.Pod{
+		newTenantPod("a", "a-0", "1", at(0)),
+		newTenantPod("a", "a-1", "1", at(1)),
+		newTenantPod("b", "b-0", "2", at(2)),
+		newTenantPod("b", "b-1", "2", at(3)),
+		newTenantPod("b", "b-2", "2", at(4)),
+	} {
+		assert.NoError(t, q.Push(p))
+	}
+	assert.Equal(t, 5, q.Metrics().PendingPodsNum)
+	assert.Len(t, q.List(), 5)
+
+	// a runs 4 of the 10 cpus.
+	q.ObserveAllocation(capacity, []*v1.Pod{newTenantPod("a", "running", "4", t0)})
+	assert.InDelta(t, 0.4, q.DominantShare("a"), 1e-9)
+	assert.Equal(t, 0.0, q.DominantShare("b"))
+
+	// A pod pushed back returns its share.
+	p, err := q.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "b-0", p.Name)
+	assert.InDelta(t, 0.2, q.DominantShare("b"), 1e-9)
+	assert.NoError(t, q.Push(p))
+	assert.Equal(t, 0.0, q.DominantShare("b"))
+
+	// b catches up with a, then a wins the tie by the earlier front pod.
+	assert.Equal(t, []string{"b-0", "b-1", "a-0", "b-2", "a-1"}, popNames(t, q))
+
+	// The weight of a halves its share.
+	q = NewFairShareQueue("", map[string]float64{"a": 2})
+	assert.NoError(t, q.Push(newTenantPod("a", "a-0", "1", at(1))))
+	assert.NoError(t, q.Push(newTenantPod("b", "b-0", "1", t0)))
+	q.ObserveAllocation(capacity, []*v1.Pod{
+		newTenantPod("a", "running-a", "4", t0),
+		newTenantPod("b", "running-b", "3", t0),
+	})
+	assert.InDelta(t, 0.2, q.DominantShare("a"), 1e-9)
+	assert.Equal(t, []string{"a-0", "b-0"}, popNames(t, q))
+}
+
+func TestFairShareQueueTenantLabel(t *testing.T) {
+	ts := metav1.Now()
+	newUserPod := func(name, user string) *v1.Pod {
+		p := newTenantPod("default", name, "1", ts)
+		p.Labels = map[string]string{"user": user}
+		return p
+	}
+
+	q := NewFairShareQueue("user", nil)
+	assert.NoError(t, q.Push(newUserPod("pod-0", "alice")))
+	assert.NoError(t, q.Push(newUserPod("pod-1", "alice")))
+	assert.NoError(t, q.Push(newUserPod("pod-2", "bob")))
+	q.ObserveAllocation(v1.ResourceList{v1.ResourceCPU: resource.MustParse("4")}, nil)
+
+	// Moving pod-1 to bob moves it to the queue of bob.
+	assert.NoError(t, q.Update("default", "pod-1", newUserPod("pod-1", "bob")))
+	assert.True(t, q.Delete("default", "pod-2"))
+	assert.False(t, q.Delete("default", "pod-2"))
+	assert.Equal(t, 2, q.Metrics().PendingPodsNum)
+
+	assert.Equal(t, []string{"pod-0", "pod-1"}, popNames(t, q))
+	assert.Equal(t, 0.25, q.DominantShare("alice"))
+	assert.Equal(t, 0.25, q.DominantShare("bob"))
+}
@@ -17,7 +17,7 @@ package queue
 import (
 	v1 "k8s.io/api/core/v1"
 
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/util"
+	"simulator/pkg/util"
 )
 
 // FIFOQueue stores pods in a FIFO queue.
@@ -119,8 +119,25 @@ func (fifo *FIFOQueue) NominatedPods(nodeName string) []*v1.Pod {
 
 func (fifo *FIFOQueue) Metrics() Metrics {
 	return Metrics{
-		PendingPodsNum: len(fifo.queue),
+		PendingPodsNum: len(fifo.pods),
 	}
 }
 
+// List implements Lister interface.
+// The pods are listed in the order they will be popped.
+func (fifo *FIFOQueue) List() []*v1.Pod {
+	pods := make([]*v1.Pod, 0, len(fifo.pods))
+	listed := make(map[string]bool, len(fifo.pods))
+	for _, key := range fifo.queue {
+		// A pod deleted and pushed again has multiple keys in the slice; it is popped at the first.
+		if pod, ok := fifo.pods[key]; ok && !listed[key] {
+			pods = append(pods, pod)
+			listed[key] = true
+		}
+	}
+
+	return pods
+}
+
 var _ = PodQueue(&FIFOQueue{})
+var _ = Lister(&FIFOQueue{})
@@ -21,7 +21,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/queue"
+	"simulator/pkg/queue"
 )
 
 func newPod(name string) *v1.Pod {
@@ -134,6 +134,18 @@ func TestFIFOQueueDeleteAndFront(t *testing.T) {
 	}
 }
 
+func TestFIFOQueueDeleteAndMetrics(t *testing.T) {
+	q := queue.NewFIFOQueue()
+
+	q.Push(newPod("pod-0"))
+	q.Push(newPod("pod-1"))
+	q.Delete("default", "pod-0")
+
+	if actual := q.Metrics().PendingPodsNum; actual != 1 {
+		t.Errorf("got: %d\nwant: 1", actual)
+	}
+}
+
 func TestFIFOQueueUpdate(t *testing.T) {
 	q := queue.NewFIFOQueue()
 
@@ -163,3 +175,20 @@ func TestFIFOQueueUpdate(t *testing.T) {
 		t.Errorf("got: %+v\nwant: %+v", actual, expected)
 	}
 }
+
+func TestFIFOQueueList(t *testing.T) {
+	q := queue.NewFIFOQueue()
+
+	q.Push(newPod("pod-0"))
+	q.Push(newPod("pod-1"))
+	q.Push(newPod("pod-2"))
+	q.Delete("default", "pod-1")
+	q.Delete("default", "pod-0")
+	q.Push(newPod("pod-0"))
+
+	names := []string{}
+	for _, pod := range q.List() {
+		names = append(names, pod.Name)
+	}
+	assert.Equal(t, []string{"pod-0", "pod-2"}, names)
+}
@@ -0,0 +1,227 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/pod"
+	"simulator/pkg/util"
+)
+
+// PodGroupQueue is a PodQueue that holds the pods of each pod group (see pod.GroupNameLabel) out of
+// the underlying queue until minAvailable pods of the group are pending or running, so that a
+// scheduler does not try a partial group.
+// The running pods are those observed by ObserveAllocation before each scheduling round.
+// The held pods are not visible to Front and Pop, but are counted in Metrics and listed by List.
+type PodGroupQueue struct {
+	inner PodQueue
+	// held maps each group to its pods held, in the order of Push.
+	held map[string][]*v1.Pod
+	// queued maps the key of each pod of a group in the underlying queue to the group.
+	queued  map[string]string
+	running map[string]int
+}
+
+// NewPodGroupQueue creates a new PodGroupQueue of the underlying queue.
+func NewPodGroupQueue(inner PodQueue) *PodGroupQueue {
+	return &PodGroupQueue{
+		inner:   inner,
+		held:    map[string][]*v1.Pod{},
+		queued:  map[string]string{},
+		running: map[string]int{},
+	}
+}
+
+// Push pushes the pod to the underlying queue, or holds it if its group has not enough pods yet.
+func (q *PodGroupQueue) Push(v1Pod *v1.Pod) error {
+	group, minAvailable := pod.GroupOf(v1Pod)
+	if group == "" || minAvailable <= 1 {
+		return q.inner.Push(v1Pod)
+	}
+
+	q.held[group] = append(q.held[group], v1Pod)
+	return q.release(group)
+}
+
+func (q *PodGroupQueue) Pop() (*v1.Pod, error) {
+	v1Pod, err := q.inner.Pop()
+	if err != nil {
+		return nil, err
+	}
+	delete(q.queued, util.PodKeyFromNames(v1Pod.Namespace, v1Pod.Name))
+
+	return v1Pod, nil
+}
+
+func (q *PodGroupQueue) Front() (*v1.Pod, error) {
+	return q.inner.Front()
+}
+
+func (q *PodGroupQueue) Delete(podNamespace, podName string) bool {
+	key := util.PodKeyFromNames(podNamespace, podName)
+	for group, pods := range q.held {
+		for i, v1Pod := range pods {
+			if v1Pod.Namespace == podNamespace && v1Pod.Name == podName {
+				q.held[group] = append(pods[:i], pods[i+1:]...)
+				if len(q.held[group]) == 0 {
+					delete(q.held, group)
+				}
+				return true
+			}
+		}
+	}
+
+	if !q.inner.Delete(podNamespace, podName) {
+		return false
+	}
+	delete(q.queued, key)
+
+	return true
+}
+
+// Update updates the pod held or in the underlying queue.
+// A held pod moved to another group by the update is pushed again.
+func (q *PodGroupQueue) Update(podNamespace, podName string, newPod *v1.Pod) error {
+	if podNamespace != newPod.Namespace || podName != newPod.Name {
+		return ErrDifferentNames
+	}
+
+	key := util.PodKeyFromNames(podNamespace, podName)
+	newGroup, _ := pod.GroupOf(newPod)
+	for group, pods := range q.held {
+		for i, v1Pod := range pods {
+			if v1Pod.Namespace != podNamespace || v1Pod.Name != podName {
+				continue
+			}
+			if group == newGroup {
+				pods[i] = newPod
+				return q.release(group)
+			}
+			q.Delete(podNamespace, podName)
+			return q.Push(newPod)
+		}
+	}
+
+	if err := q.inner.Update(podNamespace, podName, newPod); err != nil {
+		return err
+	}
+	if _, ok := q.queued[key]; ok {
+		q.queued[key] = newGroup
+	}
+
+	return nil
+}
+
+func (q *PodGroupQueue) NominatedPods(nodeName string) []*v1.Pod {
+	return q.inner.NominatedPods(nodeName)
+}
+
+func (q *PodGroupQueue) UpdateNominatedNode(pod *v1.Pod, nodeName string) error {
+	return q.inner.UpdateNominatedNode(pod, nodeName)
+}
+
+func (q *PodGroupQueue) RemoveNominatedNode(pod *v1.Pod) error {
+	return q.inner.RemoveNominatedNode(pod)
+}
+
+// Metrics returns the metrics of the underlying queue, in which the held pods are counted as
+// pending.
+func (q *PodGroupQueue) Metrics() Metrics {
+	met := q.inner.Metrics()
+	for _, pods := range q.held {
+		met.PendingPodsNum += len(pods)
+	}
+
+	return met
+}
+
+// List implements Lister interface.
+// The pods in the underlying queue are listed first (see listPods), then the held pods by group.
+func (q *PodGroupQueue) List() []*v1.Pod {
+	pods := listPods(q.inner)
+	for _, group := range q.heldGroups() {
+		pods = append(pods, q.held[group]...)
+	}
+
+	return pods
+}
+
+// ObserveAllocation implements AllocationObserver interface.
+// It counts the running pods of each group, releases the held groups that have got enough pods,
+// and lets the underlying queue observe the pods if it implements AllocationObserver.
+func (q *PodGroupQueue) ObserveAllocation(capacity v1.ResourceList, pods []*v1.Pod) {
+	q.running = map[string]int{}
+	for _, v1Pod := range pods {
+		if group, _ := pod.GroupOf(v1Pod); group != "" {
+			q.running[group]++
+		}
+	}
+
+	if observer, ok := q.inner.(AllocationObserver); ok {
+		observer.ObserveAllocation(capacity, pods)
+	}
+
+	for _, group := range q.heldGroups() {
+		q.release(group) // nolint
+	}
+}
+
+// release pushes the held pods of the group to the underlying queue, if minAvailable pods of the
+// group are held, queued, or running.
+func (q *PodGroupQueue) release(group string) error {
+	pods := q.held[group]
+	if len(pods) == 0 {
+		return nil
+	}
+
+	_, minAvailable := pod.GroupOf(pods[0])
+	count := len(pods) + q.running[group]
+	for _, g := range q.queued {
+		if g == group {
+			count++
+		}
+	}
+	if count < minAvailable {
+		return nil
+	}
+
+	delete(q.held, group)
+	for _, v1Pod := range pods {
+		if err := q.inner.Push(v1Pod); err != nil {
+			return err
+		}
+		q.queued[util.PodKeyFromNames(v1Pod.Namespace, v1Pod.Name)] = group
+	}
+
+	return nil
+}
+
+// heldGroups returns the groups of the held pods in order.
+func (q *PodGroupQueue) heldGroups() []string {
+	groups := make([]string, 0, len(q.held))
+	for group := range q.held {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	return groups
+}
+
+var _ = PodQueue(&PodGroupQueue{})
+var _ = Lister(&PodGroupQueue{})
+var _ = AllocationObserver(&PodGroupQueue{})
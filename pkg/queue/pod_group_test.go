@@ -0,0 +1,82 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+)
+
+func newGroupPod(name, group, minAvailable string) *v1.Pod {
+	p := newPod(name)
+	p.Labels = map[string]string{
+		pod.GroupNameLabel:         group,
+		pod.GroupMinAvailableLabel: minAvailable,
+	}
+	return p
+}
+
+func TestPodGroupQueue(t *testing.T) {
+	q := queue.NewPodGroupQueue(queue.NewFIFOQueue())
+
+	// The pods of group a are held until 3 of them are pushed.
+	assert.NoError(t, q.Push(newGroupPod("a-0", "a", "3")))
+	assert.NoError(t, q.Push(newPod("pod-0")))
+	assert.NoError(t, q.Push(newGroupPod("a-1", "a", "3")))
+	assert.Equal(t, 3, q.Metrics().PendingPodsNum)
+
+	front, err := q.Front()
+	assert.NoError(t, err)
+	assert.Equal(t, "pod-0", front.Name)
+	_, err = q.Pop()
+	assert.NoError(t, err)
+	_, err = q.Pop()
+	assert.Equal(t, queue.ErrEmptyQueue, err)
+
+	assert.NoError(t, q.Push(newGroupPod("a-2", "a", "3")))
+	names := []string{}
+	for _, p := range q.List() {
+		names = append(names, p.Name)
+	}
+	assert.Equal(t, []string{"a-0", "a-1", "a-2"}, names)
+
+	// A pod of group b is released once another is running.
+	assert.NoError(t, q.Push(newGroupPod("b-0", "b", "2")))
+	names = []string{}
+	for _, p := range q.List() {
+		names = append(names, p.Name)
+	}
+	assert.Equal(t, []string{"a-0", "a-1", "a-2", "b-0"}, names)
+	assert.True(t, q.Delete("default", "a-1"))
+	q.ObserveAllocation(v1.ResourceList{}, []*v1.Pod{newGroupPod("b-1", "b", "2")})
+	for _, name := range []string{"a-0", "a-2", "b-0"} {
+		p, err := q.Pop()
+		assert.NoError(t, err)
+		assert.Equal(t, name, p.Name)
+	}
+
+	// A held pod updated out of its group is released.
+	assert.NoError(t, q.Push(newGroupPod("c-0", "c", "2")))
+	assert.NoError(t, q.Update("default", "c-0", newPod("c-0")))
+	p, err := q.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "c-0", p.Name)
+	assert.Equal(t, 0, q.Metrics().PendingPodsNum)
+}
@@ -19,7 +19,7 @@ import (
 
 	v1 "k8s.io/api/core/v1"
 
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/util"
+	"simulator/pkg/util"
 )
 
 // PriorityQueue stores pods in a priority queue.
@@ -58,11 +58,24 @@ func (pq *PriorityQueue) Reorder(comparator Compare) *PriorityQueue {
 	return newWithItems(items, comparator)
 }
 
+// Push implements PodQueue interface.
+// A pod of the same key already queued is replaced with the pod, dropping its nomination, so that
+// the heap never holds two items of a key.
 func (pq *PriorityQueue) Push(pod *v1.Pod) error {
-	if _, err := util.PodKey(pod); err != nil {
+	key, err := util.PodKey(pod)
+	if err != nil {
 		return err
 	}
 
+	if item, ok := pq.inner.items[key]; ok {
+		if err := pq.RemoveNominatedNode(item.pod); err != nil {
+			return err
+		}
+		item.pod = pod
+		heap.Fix(&pq.inner, item.index)
+		return nil
+	}
+
 	heap.Push(&pq.inner, &item{pod: pod})
 	return nil
 }
@@ -167,7 +180,20 @@ func (pq *PriorityQueue) Metrics() Metrics {
 	}
 }
 
+// List implements Lister interface.
+// The pods are listed in the order of the underlying heap, so that pushing them in this order
+// rebuilds the same heap.
+func (pq *PriorityQueue) List() []*v1.Pod {
+	pods := make([]*v1.Pod, 0, pq.inner.Len())
+	for _, key := range pq.inner.keys {
+		pods = append(pods, pq.inner.items[key].pod)
+	}
+
+	return pods
+}
+
 var _ = PodQueue(&PriorityQueue{})
+var _ = Lister(&PriorityQueue{})
 
 type item struct {
 	pod   *v1.Pod
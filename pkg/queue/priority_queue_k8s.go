@@ -38,7 +38,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	v1pod "k8s.io/kubernetes/pkg/api/v1/pod"
 
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/clock"
+	"simulator/pkg/clock"
 )
 
 func podTimestamp(pod *v1.Pod) clock.Clock {
@@ -23,7 +23,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/util"
+	"simulator/pkg/util"
 )
 
 func newPodWithPriority(name string, prio *int32, ts metav1.Time) *v1.Pod {
@@ -284,3 +284,56 @@ func TestPriorityQueueNomination(t *testing.T) {
 		t.Errorf("got: %v\nwant: [\"pod-0\"]", pods)
 	}
 }
+
+func TestPriorityQueueList(t *testing.T) {
+	now := metav1.Now()
+	q := NewPriorityQueue()
+
+	// Equal for the comparator, so the order of popping depends on the heap.
+	for i := 0; i < 8; i++ {
+		assert.NoError(t, q.Push(newPodWithPriority(fmt.Sprintf("pod-%d", i), nil, now)))
+	}
+	q.Pop()
+	q.Delete("default", "pod-5")
+
+	rebuilt := NewPriorityQueue()
+	for _, pod := range q.List() {
+		assert.NoError(t, rebuilt.Push(pod))
+	}
+
+	for {
+		expected, err := q.Pop()
+		actual, errRebuilt := rebuilt.Pop()
+		assert.Equal(t, err, errRebuilt)
+		if err != nil {
+			break
+		}
+		assert.Equal(t, expected.Name, actual.Name)
+	}
+}
+
+func TestPriorityQueuePushDuplicate(t *testing.T) {
+	now := metav1.Now()
+	q := NewPriorityQueue()
+
+	prio := int32(1)
+	pod0 := newPodWithPriority("pod-0", nil, now)
+	assert.NoError(t, q.Push(pod0))
+	assert.NoError(t, q.Push(newPodWithPriority("pod-1", nil, now)))
+	assert.NoError(t, q.UpdateNominatedNode(pod0, "node-0"))
+
+	// The pushed pod replaces the queued one of the same key, which loses its nomination.
+	assert.NoError(t, q.Push(newPodWithPriority("pod-0", &prio, now)))
+	assert.Len(t, q.List(), 2)
+	assert.Empty(t, q.NominatedPods("node-0"))
+
+	pod, err := q.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "pod-0", pod.Name)
+	assert.Equal(t, prio, *pod.Spec.Priority)
+	pod, err = q.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "pod-1", pod.Name)
+	_, err = q.Pop()
+	assert.Equal(t, ErrEmptyQueue, err)
+}
@@ -77,3 +77,41 @@ type PodQueue interface {
 	// Metrics returns a metrics of this PodQueue.
 	Metrics() Metrics
 }
+
+// Lister is an optional interface of a PodQueue that lists its pods without popping them.
+type Lister interface {
+	// List returns the pods in this PodQueue, in an order such that pushing them to an empty queue
+	// of the same kind and comparator rebuilds the same queue, including the order of pods that
+	// are equal for the comparator.
+	List() []*v1.Pod
+}
+
+// AllocationObserver is an optional interface of a PodQueue that orders or holds its pods by the
+// running pods (e.g., FairShareQueue and PodGroupQueue).
+type AllocationObserver interface {
+	// ObserveAllocation is called before each scheduling round with the allocatable resources of
+	// the cluster and the pods running on it.
+	ObserveAllocation(capacity v1.ResourceList, pods []*v1.Pod)
+}
+
+// listPods returns the pods in the queue in the order of its List if it implements Lister, or pops
+// them and pushes them back otherwise.
+func listPods(queue PodQueue) []*v1.Pod {
+	if lister, ok := queue.(Lister); ok {
+		return lister.List()
+	}
+
+	popped := []*v1.Pod{}
+	for {
+		pod, err := queue.Pop()
+		if err != nil {
+			break
+		}
+		popped = append(popped, pod)
+	}
+	for _, pod := range popped {
+		queue.Push(pod) // nolint
+	}
+
+	return popped
+}
@@ -0,0 +1,184 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// RoutingQueue is a PodQueue of the queues of multiple schedulers, to which pods are routed by their
+// spec.schedulerName.
+// The pods whose scheduler has no queue are routed to the default queue.
+// Front and Pop refer to the default queue first, then to the others in the order of the names.
+type RoutingQueue struct {
+	defaultQueue PodQueue
+	routes       map[string]PodQueue
+	names        []string
+}
+
+// NewRoutingQueue creates a new RoutingQueue with the default queue.
+func NewRoutingQueue(defaultQueue PodQueue) *RoutingQueue {
+	return &RoutingQueue{
+		defaultQueue: defaultQueue,
+		routes:       map[string]PodQueue{},
+		names:        []string{},
+	}
+}
+
+// AddRoute routes the pods whose spec.schedulerName is the name to the queue.
+func (q *RoutingQueue) AddRoute(schedulerName string, queue PodQueue) {
+	if _, ok := q.routes[schedulerName]; !ok {
+		q.names = append(q.names, schedulerName)
+		sort.Strings(q.names)
+	}
+	q.routes[schedulerName] = queue
+}
+
+// Default returns the default queue.
+func (q *RoutingQueue) Default() PodQueue {
+	return q.defaultQueue
+}
+
+// Route returns the queue of the scheduler with the name, or nil if not routed.
+func (q *RoutingQueue) Route(schedulerName string) PodQueue {
+	return q.routes[schedulerName]
+}
+
+// Names returns the names of the routed schedulers in order.
+func (q *RoutingQueue) Names() []string {
+	return q.names
+}
+
+func (q *RoutingQueue) Push(pod *v1.Pod) error {
+	return q.queueOf(pod).Push(pod)
+}
+
+func (q *RoutingQueue) Pop() (*v1.Pod, error) {
+	for _, queue := range q.queues() {
+		if pod, err := queue.Pop(); err != ErrEmptyQueue {
+			return pod, err
+		}
+	}
+
+	return nil, ErrEmptyQueue
+}
+
+func (q *RoutingQueue) Front() (*v1.Pod, error) {
+	for _, queue := range q.queues() {
+		if pod, err := queue.Front(); err != ErrEmptyQueue {
+			return pod, err
+		}
+	}
+
+	return nil, ErrEmptyQueue
+}
+
+func (q *RoutingQueue) Delete(podNamespace, podName string) bool {
+	for _, queue := range q.queues() {
+		if queue.Delete(podNamespace, podName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Update updates the pod in the queue where it is found.
+func (q *RoutingQueue) Update(podNamespace, podName string, newPod *v1.Pod) error {
+	var err error
+	for _, queue := range q.queues() {
+		err = queue.Update(podNamespace, podName, newPod)
+		if _, ok := err.(*ErrNoMatchingPod); !ok {
+			return err
+		}
+	}
+
+	return err
+}
+
+// NominatedPods returns the pods nominated for the node in all of the queues, since the schedulers
+// share the nodes.
+func (q *RoutingQueue) NominatedPods(nodeName string) []*v1.Pod {
+	pods := []*v1.Pod{}
+	for _, queue := range q.queues() {
+		pods = append(pods, queue.NominatedPods(nodeName)...)
+	}
+
+	return pods
+}
+
+func (q *RoutingQueue) UpdateNominatedNode(pod *v1.Pod, nodeName string) error {
+	return q.queueOf(pod).UpdateNominatedNode(pod, nodeName)
+}
+
+func (q *RoutingQueue) RemoveNominatedNode(pod *v1.Pod) error {
+	return q.queueOf(pod).RemoveNominatedNode(pod)
+}
+
+func (q *RoutingQueue) Metrics() Metrics {
+	met := Metrics{}
+	for _, queue := range q.queues() {
+		met.PendingPodsNum += queue.Metrics().PendingPodsNum
+	}
+
+	return met
+}
+
+// List implements Lister interface.
+// The pods are listed by queue in the order of Pop, each in the order of its List if it implements
+// Lister, or popped and pushed back otherwise.
+func (q *RoutingQueue) List() []*v1.Pod {
+	pods := []*v1.Pod{}
+	for _, queue := range q.queues() {
+		pods = append(pods, listPods(queue)...)
+	}
+
+	return pods
+}
+
+// ObserveAllocation implements AllocationObserver interface.
+// It lets each queue implementing AllocationObserver observe all of the running pods.
+func (q *RoutingQueue) ObserveAllocation(capacity v1.ResourceList, pods []*v1.Pod) {
+	for _, queue := range q.queues() {
+		if observer, ok := queue.(AllocationObserver); ok {
+			observer.ObserveAllocation(capacity, pods)
+		}
+	}
+}
+
+// queueOf returns the queue to which the pod is routed.
+func (q *RoutingQueue) queueOf(pod *v1.Pod) PodQueue {
+	if queue, ok := q.routes[pod.Spec.SchedulerName]; ok {
+		return queue
+	}
+	return q.defaultQueue
+}
+
+// queues returns the default queue and the routed queues in the order of the names.
+func (q *RoutingQueue) queues() []PodQueue {
+	queues := make([]PodQueue, 0, len(q.names)+1)
+	queues = append(queues, q.defaultQueue)
+	for _, name := range q.names {
+		queues = append(queues, q.routes[name])
+	}
+
+	return queues
+}
+
+var _ = PodQueue(&RoutingQueue{})
+var _ = Lister(&RoutingQueue{})
+var _ = AllocationObserver(&RoutingQueue{})
@@ -0,0 +1,58 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"simulator/pkg/queue"
+)
+
+func TestRoutingQueue(t *testing.T) {
+	q := queue.NewRoutingQueue(queue.NewFIFOQueue())
+	q.AddRoute("b", queue.NewFIFOQueue())
+	q.AddRoute("a", queue.NewFIFOQueue())
+	assert.Equal(t, []string{"a", "b"}, q.Names())
+
+	for _, route := range []string{"b", "", "a", "unknown"} {
+		pod := newPod("pod-" + route)
+		pod.Spec.SchedulerName = route
+		assert.NoError(t, q.Push(pod))
+	}
+	assert.Equal(t, 4, q.Metrics().PendingPodsNum)
+	assert.Equal(t, 2, q.Default().Metrics().PendingPodsNum)
+	assert.Equal(t, 1, q.Route("a").Metrics().PendingPodsNum)
+
+	updated := newPod("pod-a")
+	updated.Spec.SchedulerName = "a"
+	updated.Labels = map[string]string{"updated": "true"}
+	assert.NoError(t, q.Update("default", "pod-a", updated))
+	assert.IsType(t, &queue.ErrNoMatchingPod{}, q.Update("default", "pod-c", newPod("pod-c")))
+
+	// The default queue first, then the others in the order of the names.
+	names := []string{}
+	for _, pod := range q.List() {
+		names = append(names, pod.Name)
+	}
+	assert.Equal(t, []string{"pod-", "pod-unknown", "pod-a", "pod-b"}, names)
+
+	assert.True(t, q.Delete("default", "pod-b"))
+	assert.False(t, q.Delete("default", "pod-b"))
+	pod, err := q.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "pod-", pod.Name)
+}
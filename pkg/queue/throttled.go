@@ -0,0 +1,129 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/util"
+)
+
+// ThrottledQueue is a PodQueue that lets a scheduler pop at most a limited number of pods from the
+// underlying queue, and each of them at most once, so that a scheduler pushing back unschedulable
+// pods does not pop them again within the same scheduling round.
+// It appears empty once the limit is reached or its front pod has been popped before, while the
+// other pods stay in the underlying queue for the next round.
+type ThrottledQueue struct {
+	inner  PodQueue
+	limit  int
+	popped map[string]bool
+}
+
+// NewThrottledQueue creates a new ThrottledQueue of the underlying queue for a scheduling round,
+// from which at most limit pods are popped.
+func NewThrottledQueue(inner PodQueue, limit int) *ThrottledQueue {
+	return &ThrottledQueue{
+		inner:  inner,
+		limit:  limit,
+		popped: map[string]bool{},
+	}
+}
+
+// Pop pops the front pod of the underlying queue, or returns ErrEmptyQueue if the limit is reached
+// or the pod has been popped before.
+func (q *ThrottledQueue) Pop() (*v1.Pod, error) {
+	pod, err := q.Front()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := util.PodKey(pod)
+	if err != nil {
+		return nil, err
+	}
+	if pod, err = q.inner.Pop(); err != nil {
+		return nil, err
+	}
+	q.popped[key] = true
+
+	return pod, nil
+}
+
+// Front refers the front pod of the underlying queue, or returns ErrEmptyQueue if the limit is
+// reached or the pod has been popped before.
+func (q *ThrottledQueue) Front() (*v1.Pod, error) {
+	if len(q.popped) >= q.limit {
+		return nil, ErrEmptyQueue
+	}
+
+	pod, err := q.inner.Front()
+	if err != nil {
+		return nil, err
+	}
+	key, err := util.PodKey(pod)
+	if err != nil {
+		return nil, err
+	}
+	if q.popped[key] {
+		return nil, ErrEmptyQueue
+	}
+
+	return pod, nil
+}
+
+func (q *ThrottledQueue) Push(pod *v1.Pod) error {
+	return q.inner.Push(pod)
+}
+
+func (q *ThrottledQueue) Delete(podNamespace, podName string) bool {
+	return q.inner.Delete(podNamespace, podName)
+}
+
+func (q *ThrottledQueue) Update(podNamespace, podName string, newPod *v1.Pod) error {
+	return q.inner.Update(podNamespace, podName, newPod)
+}
+
+func (q *ThrottledQueue) NominatedPods(nodeName string) []*v1.Pod {
+	return q.inner.NominatedPods(nodeName)
+}
+
+func (q *ThrottledQueue) UpdateNominatedNode(pod *v1.Pod, nodeName string) error {
+	return q.inner.UpdateNominatedNode(pod, nodeName)
+}
+
+func (q *ThrottledQueue) RemoveNominatedNode(pod *v1.Pod) error {
+	return q.inner.RemoveNominatedNode(pod)
+}
+
+func (q *ThrottledQueue) Metrics() Metrics {
+	return q.inner.Metrics()
+}
+
+// List implements Lister interface.
+// The pods in the underlying queue (see listPods) that have not been popped in this round are
+// listed.
+func (q *ThrottledQueue) List() []*v1.Pod {
+	pods := []*v1.Pod{}
+	for _, pod := range listPods(q.inner) {
+		if !q.popped[util.PodKeyFromNames(pod.Namespace, pod.Name)] {
+			pods = append(pods, pod)
+		}
+	}
+
+	return pods
+}
+
+var _ = PodQueue(&ThrottledQueue{})
+var _ = Lister(&ThrottledQueue{})
@@ -0,0 +1,67 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"simulator/pkg/queue"
+)
+
+func TestThrottledQueue(t *testing.T) {
+	inner := queue.NewFIFOQueue()
+	for _, name := range []string{"pod-0", "pod-1", "pod-2", "pod-3"} {
+		assert.NoError(t, inner.Push(newPod(name)))
+	}
+
+	q := queue.NewThrottledQueue(inner, 3)
+	pod, err := q.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "pod-0", pod.Name)
+
+	// A pod pushed back is not popped again in this round.
+	assert.NoError(t, q.Push(pod))
+	pod, err = q.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "pod-1", pod.Name)
+	pod, err = q.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "pod-2", pod.Name)
+
+	// The limit is reached.
+	_, err = q.Front()
+	assert.Equal(t, queue.ErrEmptyQueue, err)
+	_, err = q.Pop()
+	assert.Equal(t, queue.ErrEmptyQueue, err)
+	assert.Equal(t, 2, q.Metrics().PendingPodsNum)
+	// Only the pod not popped in this round is listed.
+	listed := q.List()
+	assert.Len(t, listed, 1)
+	assert.Equal(t, "pod-3", listed[0].Name)
+
+	// The next round starts from the rest of the queue.
+	q = queue.NewThrottledQueue(inner, 3)
+	pod, err = q.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "pod-3", pod.Name)
+	assert.NoError(t, q.Push(pod))
+	pod, err = q.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "pod-0", pod.Name)
+	_, err = q.Pop()
+	assert.Equal(t, queue.ErrEmptyQueue, err)
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubesim
+
+import (
+	"github.com/containerd/containerd/log"
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/metrics"
+	"simulator/pkg/pod"
+	"simulator/pkg/util"
+)
+
+// quotaCharge is the usage of the ResourceQuota of its namespace by a pod not bound yet.
+type quotaCharge struct {
+	namespace string
+	usage     v1.ResourceList
+}
+
+// admitToNamespace applies the LimitRange of the namespace of the submitted pod to it and checks
+// that it does not exceed the ResourceQuota of the namespace, charging the quota for the pod until
+// it is bound (see releaseQuota).
+// Returns the event of the rejection if the pod violates the LimitRange or exceeds the quota,
+// marking it Failed, or nil if admitted.
+func (k *KubeSim) admitToNamespace(v1Pod *v1.Pod) *metrics.Event {
+	key := util.PodKeyFromNames(v1Pod.Namespace, v1Pod.Name)
+
+	reason := pod.LimitRangeViolatedReason
+	err := k.namespaces.ApplyLimitRange(v1Pod)
+	if err == nil {
+		reason = pod.QuotaExceededReason
+		var usage v1.ResourceList
+		if usage, err = k.namespaces.CheckQuota(v1Pod, k.quotaUsage(v1Pod.Namespace)); err == nil {
+			if usage != nil {
+				k.chargeQuota(key, v1Pod.Namespace, usage)
+			}
+			return nil
+		}
+	}
+
+	return k.rejectPod(v1Pod, reason, err)
+}
+
+// rejectPod marks the submitted pod, or the new pod of an update, Failed with the reason and the
+// error, instead of queueing it.
+// Returns the event of the rejection.
+func (k *KubeSim) rejectPod(v1Pod *v1.Pod, reason string, err error) *metrics.Event {
+	key := util.PodKeyFromNames(v1Pod.Namespace, v1Pod.Name)
+	v1Pod.Status.Phase = v1.PodFailed
+	v1Pod.Status.Reason = reason
+	v1Pod.Status.Message = err.Error()
+	log.L.Debugf("Pod %s rejected: %s", key, err.Error())
+
+	return &metrics.Event{
+		Clock: k.clock.ToRFC3339(),
+		Kind:  metrics.RejectEvent,
+		Pod:   key,
+	}
+}
+
+// chargeQuotaFor charges the ResourceQuota of its namespace for the pod pushed back to the queue or
+// updated while not bound, without checking the quota.
+func (k *KubeSim) chargeQuotaFor(v1Pod *v1.Pod) {
+	if k.namespaces.HasQuota(v1Pod.Namespace) {
+		key := util.PodKeyFromNames(v1Pod.Namespace, v1Pod.Name)
+		k.chargeQuota(key, v1Pod.Namespace, pod.QuotaUsage(v1Pod))
+	}
+}
+
+// chargeQuota charges the ResourceQuota of the namespace for the pod with the key not bound yet.
+func (k *KubeSim) chargeQuota(key, namespace string, usage v1.ResourceList) {
+	k.releaseQuota(key)
+	k.quotaWaiting[key] = quotaCharge{namespace: namespace, usage: usage}
+	if k.quotaUsed != nil {
+		k.addQuotaUsage(namespace, usage)
+	}
+}
+
+// releaseQuota releases the charge of the pod with the key, which has been bound, deleted, or given
+// up, if any.
+// The bound pods are counted by quotaUsage instead while running or terminating.
+func (k *KubeSim) releaseQuota(key string) {
+	if _, ok := k.quotaWaiting[key]; ok {
+		delete(k.quotaWaiting, key)
+		k.quotaUsed = nil
+	}
+}
+
+// quotaUsage returns the usage of the ResourceQuota of the namespace by its pods, i.e., the pods
+// charged and not bound yet, and the bound pods running or terminating at the current clock.
+// The usage of all of the namespaces with quotas is computed at most once per submission unless a
+// charge is released.
+func (k *KubeSim) quotaUsage(namespace string) v1.ResourceList {
+	if k.quotaUsed == nil {
+		k.quotaUsed = map[string]v1.ResourceList{}
+		for _, charge := range k.quotaWaiting {
+			k.addQuotaUsage(charge.namespace, charge.usage)
+		}
+		for _, p := range k.boundPods {
+			v1Pod := p.ToV1()
+			if !k.namespaces.HasQuota(v1Pod.Namespace) ||
+				!(p.IsRunning(k.clock) || p.IsTerminating(k.clock)) {
+				continue
+			}
+			k.addQuotaUsage(v1Pod.Namespace, pod.QuotaUsage(v1Pod))
+		}
+	}
+
+	if used, ok := k.quotaUsed[namespace]; ok {
+		return used
+	}
+	k.quotaUsed[namespace] = v1.ResourceList{}
+	return k.quotaUsed[namespace]
+}
+
+// addQuotaUsage adds the usage to the usage of the ResourceQuota of the namespace computed by
+// quotaUsage.
+func (k *KubeSim) addQuotaUsage(namespace string, usage v1.ResourceList) {
+	used, ok := k.quotaUsed[namespace]
+	if !ok {
+		used = v1.ResourceList{}
+	}
+	k.quotaUsed[namespace] = util.ResourceListSum(used, usage)
+}
@@ -0,0 +1,159 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubesim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"simulator/pkg/config"
+	"simulator/pkg/metrics"
+	"simulator/pkg/pod"
+	"simulator/pkg/scheduler"
+	"simulator/pkg/submitter"
+)
+
+func TestKubeSimNamespaces(t *testing.T) {
+	conf := newCheckpointConfig(10)
+	conf.Namespaces = []config.NamespaceConfig{{
+		Name:          "default",
+		ResourceQuota: map[v1.ResourceName]string{"pods": "1", "limits.memory": "2Gi"},
+		LimitRange: &config.LimitRangeConfig{
+			Default: map[v1.ResourceName]string{"memory": "1Gi"},
+			Max:     map[v1.ResourceName]string{"memory": "2Gi"},
+		},
+	}}
+	binPacking := scheduler.NewBinPackingScheduler()
+	k, err := NewKubeSim(WithConfig(conf), WithScheduler(&binPacking))
+	assert.NoError(t, err)
+	t0 := k.clock
+
+	events := []metrics.Event{}
+	k.AddEventHandler(func(e metrics.Event) error {
+		if e.Kind != metrics.SubmitEvent {
+			events = append(events, e)
+		}
+		return nil
+	})
+	// The pod 1 exceeds the quota of pods while the pod 0 runs, and the pod 2 violates the
+	// LimitRange. The pod 3 is admitted once the pod 0 completes.
+	pods := []*v1.Pod{newCheckpointPod("pod-0"), newCheckpointPod("pod-1"), newCheckpointPod("pod-2"),
+		newCheckpointPod("pod-3")}
+	pods[2].Spec.Containers[0].Resources.Limits = v1.ResourceList{"memory": resource.MustParse("4Gi")}
+	k.AddSubmitter("Staged", &stagedSubmitter{stages: [][]*v1.Pod{
+		{pods[0], pods[1]}, {pods[2]}, {}, {}, {}, {}, {}, {pods[3]},
+	}})
+	assert.NoError(t, k.Run(context.Background()))
+
+	str := func(d time.Duration) string { return t0.Add(d).ToRFC3339() }
+	assert.Equal(t, []metrics.Event{
+		{Clock: str(0), Kind: metrics.RejectEvent, Pod: "default/pod-1"},
+		{Clock: str(0), Kind: metrics.BindEvent, Pod: "default/pod-0", Node: "node-0"},
+		{Clock: str(10 * time.Second), Kind: metrics.RejectEvent, Pod: "default/pod-2"},
+		{Clock: str(60 * time.Second), Kind: metrics.CompleteEvent, Pod: "default/pod-0", Node: "node-0"},
+		{Clock: str(70 * time.Second), Kind: metrics.BindEvent, Pod: "default/pod-3", Node: "node-0"},
+		{Clock: str(130 * time.Second), Kind: metrics.CompleteEvent, Pod: "default/pod-3", Node: "node-0"},
+	}, events)
+
+	assert.Equal(t, v1.PodFailed, pods[1].Status.Phase)
+	assert.Equal(t, pod.QuotaExceededReason, pods[1].Status.Reason)
+	assert.Equal(t, "exceeded quota: pods (requested 1, used 1, limited 1)", pods[1].Status.Message)
+	assert.Equal(t, pod.LimitRangeViolatedReason, pods[2].Status.Reason)
+
+	limit := pods[0].Spec.Containers[0].Resources.Limits[v1.ResourceMemory]
+	assert.Equal(t, "1Gi", limit.String())
+	assert.Empty(t, k.quotaWaiting)
+}
+
+func TestKubeSimRejectUpdateByLimitRange(t *testing.T) {
+	conf := newCheckpointConfig(10)
+	conf.Namespaces = []config.NamespaceConfig{{
+		Name: "default",
+		LimitRange: &config.LimitRangeConfig{
+			Max: map[v1.ResourceName]string{"cpu": "2"},
+		},
+	}}
+	binPacking := scheduler.NewBinPackingScheduler()
+	k, err := NewKubeSim(WithConfig(conf), WithScheduler(&binPacking))
+	assert.NoError(t, err)
+	t0 := k.clock
+
+	events := []metrics.Event{}
+	k.AddEventHandler(func(e metrics.Event) error {
+		if e.Kind == metrics.RejectEvent || e.Kind == metrics.BindEvent {
+			events = append(events, e)
+		}
+		return nil
+	})
+	// The update of the pending pod violating the LimitRange is ignored, and the pod is bound as
+	// submitted.
+	submitted := newCheckpointPod("pod-0")
+	submitted.Spec.Containers[0].Resources.Limits = v1.ResourceList{"cpu": resource.MustParse("1")}
+	update := submitted.DeepCopy()
+	update.Spec.Containers[0].Resources.Limits["cpu"] = resource.MustParse("4")
+	k.AddSubmitter("Step", &stepSubmitter{steps: []func() []submitter.Event{func() []submitter.Event {
+		return []submitter.Event{
+			&submitter.SubmitEvent{Pod: submitted},
+			&submitter.UpdateEvent{PodNamespace: "default", PodName: "pod-0", NewPod: update},
+		}
+	}}})
+	assert.NoError(t, k.Run(context.Background()))
+
+	str := t0.ToRFC3339()
+	assert.Equal(t, []metrics.Event{
+		{Clock: str, Kind: metrics.RejectEvent, Pod: "default/pod-0"},
+		{Clock: str, Kind: metrics.BindEvent, Pod: "default/pod-0", Node: "node-0"},
+	}, events)
+	pods, err := k.ListPods(labels.Everything())
+	assert.NoError(t, err)
+	assert.Len(t, pods, 1)
+	assert.Equal(t, v1.PodSucceeded, pods[0].Status.Phase)
+	limit := pods[0].Spec.Containers[0].Resources.Limits[v1.ResourceCPU]
+	assert.Equal(t, "1", limit.String())
+}
+
+func TestKubeSimRejectUnknownPriorityClass(t *testing.T) {
+	binPacking := scheduler.NewBinPackingScheduler()
+	k, err := NewKubeSim(WithConfig(newCheckpointConfig(10)), WithScheduler(&binPacking))
+	assert.NoError(t, err)
+	t0 := k.clock
+
+	events := []metrics.Event{}
+	k.AddEventHandler(func(e metrics.Event) error {
+		if e.Kind == metrics.RejectEvent || e.Kind == metrics.BindEvent {
+			events = append(events, e)
+		}
+		return nil
+	})
+	// Only the pod 0 of the unknown class is rejected.
+	pods := []*v1.Pod{newCheckpointPod("pod-0"), newCheckpointPod("pod-1")}
+	pods[0].Spec.PriorityClassName = "unknown"
+	k.AddSubmitter("Staged", &stagedSubmitter{stages: [][]*v1.Pod{pods}})
+	assert.NoError(t, k.Run(context.Background()))
+
+	str := t0.ToRFC3339()
+	assert.Equal(t, []metrics.Event{
+		{Clock: str, Kind: metrics.RejectEvent, Pod: "default/pod-0"},
+		{Clock: str, Kind: metrics.BindEvent, Pod: "default/pod-1", Node: "node-0"},
+	}, events)
+	assert.Equal(t, v1.PodFailed, pods[0].Status.Phase)
+	assert.Equal(t, pod.PriorityClassNotFoundReason, pods[0].Status.Reason)
+}
@@ -0,0 +1,249 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reservation
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/pod"
+	"simulator/pkg/util"
+)
+
+const (
+	// PredicateName is the name with which the predicate of a Store is registered.
+	PredicateName = "Reservation"
+
+	// ClaimAnnotation is the annotation key of a pod that names the reservation the pod consumes.
+	// A pod claiming a reservation can use the reserved resources.
+	ClaimAnnotation = "simulator/reservation"
+)
+
+// ErrNodeReserved is the failure reason of the predicate of a Store.
+var ErrNodeReserved = &predicates.PredicateFailureError{
+	PredicateName: PredicateName,
+	PredicateDesc: "node(s) didn't have enough unreserved resources",
+}
+
+// Reservation represents an amount of resources reserved on a node, or on each node in a zone,
+// during the time interval [Start, End).
+type Reservation struct {
+	Name string
+	// NodeName is the name of the reserved node.
+	// Either NodeName or Zone must be specified.
+	NodeName string
+	// Zone is the zone in which every node is reserved.
+	// The zone of a node is read from its v1.LabelZoneFailureDomain label.
+	Zone string
+	// Resource is the amount of resources reserved on each node.
+	Resource v1.ResourceList
+
+	Start clock.Clock
+	End   clock.Clock
+}
+
+// ActiveAt returns whether this Reservation is active at the given clock.
+func (r *Reservation) ActiveAt(clock clock.Clock) bool {
+	return !clock.Before(r.Start) && clock.Before(r.End)
+}
+
+// Overlaps returns whether this Reservation is active at the clock from, or starts after it and
+// before the clock until.
+func (r *Reservation) Overlaps(from, until clock.Clock) bool {
+	return r.ActiveAt(from) || (from.Before(r.Start) && r.Start.Before(until))
+}
+
+// Matches returns whether this Reservation reserves resources on the given node.
+func (r *Reservation) Matches(node *v1.Node) bool {
+	if r.NodeName != "" {
+		return r.NodeName == node.Name
+	}
+	return r.Zone == node.Labels[v1.LabelZoneFailureDomain]
+}
+
+// IsClaimedBy returns whether the pod consumes this Reservation.
+func (r *Reservation) IsClaimedBy(pod *v1.Pod) bool {
+	return pod.Annotations[ClaimAnnotation] == r.Name
+}
+
+// Store stores reservations, and provides a predicate that keeps pods off reserved resources.
+// The predicate evaluates reservations at the clock set with SetClock, which KubeSim updates in
+// every tick.
+type Store struct {
+	reservations map[string]*Reservation
+	clock        clock.Clock
+
+	mu sync.RWMutex
+}
+
+// NewStore creates a new empty Store.
+func NewStore() *Store {
+	return &Store{
+		reservations: map[string]*Reservation{},
+	}
+}
+
+// Add adds the reservation to this Store.
+// Returns error if the reservation is invalid, or one with the same name already exists.
+func (s *Store) Add(r *Reservation) error {
+	if r.Name == "" {
+		return strongerrors.InvalidArgument(errors.New("reservation name must not be empty"))
+	}
+	if (r.NodeName == "") == (r.Zone == "") {
+		return strongerrors.InvalidArgument(
+			errors.Errorf("reservation %q must specify exactly one of nodeName and zone", r.Name))
+	}
+	if !r.Start.Before(r.End) {
+		return strongerrors.InvalidArgument(
+			errors.Errorf("reservation %q must start before it ends", r.Name))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.reservations[r.Name]; ok {
+		return strongerrors.AlreadyExists(errors.Errorf("reservation %q already exists", r.Name))
+	}
+	s.reservations[r.Name] = r
+
+	return nil
+}
+
+// Delete deletes the reservation with the given name from this Store.
+// Returns true if the reservation existed.
+func (s *Store) Delete(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.reservations[name]
+	delete(s.reservations, name)
+	return ok
+}
+
+// Len returns the number of the reservations in this Store.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.reservations)
+}
+
+// List returns all reservations in this Store, sorted by their names.
+func (s *Store) List() []*Reservation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]*Reservation, 0, len(s.reservations))
+	for _, r := range s.reservations {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
+
+// SetClock sets the clock at which the predicate evaluates reservations.
+func (s *Store) SetClock(clock clock.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clock = clock
+}
+
+// Predicate implements "k8s.io/kubernetes/pkg/scheduler/algorithm/predicates".FitPredicate.
+// The pod fits in the node if the resources on the node suffice for the pod, the pods on the node,
+// and the reservations on the node that the pod does not claim, active now or starting before the
+// pod is expected to end (see pod.ExecutionDuration).
+// The resources used by the pods claiming a reservation are deducted from the reservation.
+func (s *Store) Predicate(
+	pod *v1.Pod, meta predicates.PredicateMetadata, nodeInfo *nodeinfo.NodeInfo,
+) (bool, []predicates.PredicateFailureReason, error) {
+
+	node := nodeInfo.Node()
+	if node == nil {
+		return false, nil, errors.New("node not found")
+	}
+
+	reserved := s.reservedResource(pod, nodeInfo)
+	if len(reserved) == 0 {
+		return true, nil, nil
+	}
+
+	used := util.PodTotalResourceRequests(pod)
+	for _, p := range nodeInfo.Pods() {
+		used = util.ResourceListSum(used, util.PodTotalResourceRequests(p))
+	}
+	used = util.ResourceListSum(used, reserved)
+
+	for name := range reserved {
+		alloc, ok := node.Status.Allocatable[name]
+		if !ok {
+			continue
+		}
+		if usedQ := used[name]; usedQ.Cmp(alloc) > 0 {
+			return false, []predicates.PredicateFailureReason{ErrNodeReserved}, nil
+		}
+	}
+
+	return true, nil, nil
+}
+
+var _ = predicates.FitPredicate((&Store{}).Predicate)
+
+// reservedResource sums up the resources of the reservations on the node that the pod does not
+// claim, active during the expected run of the pod from the current clock.
+// A pod of unknown duration is expected to run only at the current clock.
+func (s *Store) reservedResource(v1Pod *v1.Pod, nodeInfo *nodeinfo.NodeInfo) v1.ResourceList {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	end := s.clock
+	if dur, err := pod.ExecutionDuration(v1Pod); err == nil {
+		end = s.clock.Add(dur)
+	}
+
+	reserved := v1.ResourceList{}
+	for _, r := range s.reservations {
+		if !r.Overlaps(s.clock, end) || !r.Matches(nodeInfo.Node()) || r.IsClaimedBy(v1Pod) {
+			continue
+		}
+
+		claimed := v1.ResourceList{}
+		for _, p := range nodeInfo.Pods() {
+			if r.IsClaimedBy(p) {
+				claimed = util.ResourceListSum(claimed, util.PodTotalResourceRequests(p))
+			}
+		}
+
+		for name, q := range r.Resource {
+			remaining := q.DeepCopy()
+			if c, ok := claimed[name]; ok {
+				remaining.Sub(c)
+			}
+			if remaining.Sign() > 0 {
+				reserved = util.ResourceListSum(reserved, v1.ResourceList{name: remaining})
+			}
+		}
+	}
+
+	return reserved
+}
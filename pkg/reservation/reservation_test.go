@@ -0,0 +1,151 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reservation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/clock"
+)
+
+func newPod(name, cpu string, annotations map[string]string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Annotations: annotations},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name: "container",
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{"cpu": resource.MustParse(cpu)},
+				},
+			}},
+		},
+	}
+}
+
+func newNodeInfo(t *testing.T, name, zone, cpu string, pods ...*v1.Pod) *nodeinfo.NodeInfo {
+	alloc := v1.ResourceList{
+		"cpu":  resource.MustParse(cpu),
+		"pods": resource.MustParse("110"),
+	}
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{v1.LabelZoneFailureDomain: zone},
+		},
+		Status: v1.NodeStatus{Capacity: alloc, Allocatable: alloc},
+	}
+
+	info := nodeinfo.NewNodeInfo(pods...)
+	assert.NoError(t, info.SetNode(node))
+	return info
+}
+
+func TestStoreAdd(t *testing.T) {
+	now := clock.NewClock(time.Now())
+	store := NewStore()
+
+	assert.EqualError(t, store.Add(&Reservation{NodeName: "node", Start: now, End: now.Add(1)}),
+		"reservation name must not be empty")
+	assert.EqualError(t, store.Add(&Reservation{Name: "r", Start: now, End: now.Add(1)}),
+		"reservation \"r\" must specify exactly one of nodeName and zone")
+	assert.EqualError(t, store.Add(&Reservation{Name: "r", NodeName: "node", Start: now, End: now}),
+		"reservation \"r\" must start before it ends")
+
+	assert.NoError(t, store.Add(&Reservation{Name: "r", Zone: "zone", Start: now, End: now.Add(1)}))
+	assert.EqualError(t, store.Add(&Reservation{Name: "r", Zone: "zone", Start: now, End: now.Add(1)}),
+		"reservation \"r\" already exists")
+
+	assert.Len(t, store.List(), 1)
+	assert.True(t, store.Delete("r"))
+	assert.False(t, store.Delete("r"))
+	assert.Empty(t, store.List())
+}
+
+func TestStorePredicate(t *testing.T) {
+	start := clock.NewClock(time.Now())
+	store := NewStore()
+	assert.NoError(t, store.Add(&Reservation{
+		Name:     "job",
+		NodeName: "node-0",
+		Resource: v1.ResourceList{"cpu": resource.MustParse("3")},
+		Start:    start,
+		End:      start.Add(10 * time.Minute),
+	}))
+	assert.NoError(t, store.Add(&Reservation{
+		Name:     "maintenance",
+		Zone:     "zone-1",
+		Resource: v1.ResourceList{"cpu": resource.MustParse("4")},
+		Start:    start.Add(5 * time.Minute),
+		End:      start.Add(10 * time.Minute),
+	}))
+
+	node0 := newNodeInfo(t, "node-0", "zone-0", "4")
+	node1 := newNodeInfo(t, "node-1", "zone-1", "4")
+	pod := newPod("pod", "2", nil)
+	claimer := newPod("claimer", "2", map[string]string{ClaimAnnotation: "job"})
+
+	// Before the reservation starts
+	store.SetClock(start.Add(-time.Second))
+	fit, _, err := store.Predicate(pod, nil, node0)
+	assert.NoError(t, err)
+	assert.True(t, fit)
+
+	// The reservation on node-0 is active, and the one on zone-1 is not yet.
+	store.SetClock(start)
+	fit, reasons, err := store.Predicate(pod, nil, node0)
+	assert.NoError(t, err)
+	assert.False(t, fit)
+	assert.Equal(t, []predicates.PredicateFailureReason{ErrNodeReserved}, reasons)
+
+	fit, _, _ = store.Predicate(claimer, nil, node0)
+	assert.True(t, fit)
+
+	fit, _, _ = store.Predicate(pod, nil, node1)
+	assert.True(t, fit)
+
+	// A pod expected to run into the reservation on zone-1 does not fit, while a shorter one does.
+	long := newPod("long", "2", map[string]string{"simSpec": "- seconds: 600\n  resourceUsage:\n    cpu: 2\n"})
+	fit, reasons, _ = store.Predicate(long, nil, node1)
+	assert.False(t, fit)
+	assert.Equal(t, []predicates.PredicateFailureReason{ErrNodeReserved}, reasons)
+	short := newPod("short", "2", map[string]string{"simSpec": "- seconds: 60\n  resourceUsage:\n    cpu: 2\n"})
+	fit, _, _ = store.Predicate(short, nil, node1)
+	assert.True(t, fit)
+
+	// The resources used by the claimer are deducted from the reservation.
+	node0 = newNodeInfo(t, "node-0", "zone-0", "4", claimer)
+	fit, _, _ = store.Predicate(newPod("small", "1", nil), nil, node0)
+	assert.True(t, fit)
+	fit, _, _ = store.Predicate(newPod("medium", "2", nil), nil, node0)
+	assert.False(t, fit)
+
+	// Every node in zone-1 is reserved.
+	store.SetClock(start.Add(5 * time.Minute))
+	fit, _, _ = store.Predicate(newPod("small", "1", nil), nil, node1)
+	assert.False(t, fit)
+
+	// After the reservations end
+	store.SetClock(start.Add(10 * time.Minute))
+	fit, _, _ = store.Predicate(pod, nil, node1)
+	assert.True(t, fit)
+}
@@ -0,0 +1,301 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+	"k8s.io/kubernetes/pkg/scheduler/core"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+)
+
+// BackfillScheduler makes scheduling decisions in the way of HPC batch schedulers with
+// backfilling.
+// At each clock, it pops all pods from the queue and tries to place them in the order of the queue.
+// When a pod does not fit in any node, a reservation is made for it on the node that can run it
+// earliest, estimated from the declared durations (see pod.ExecutionDuration) of the running pods.
+// The following pods are backfilled into the remaining resources only if they do not delay any of
+// the reservations, i.e., they finish before the reserved time, or there will still be enough
+// resources for the reserved pod at that time.
+//
+// With maxReservations == 1, this is the EASY backfilling; larger values approach the conservative
+// backfilling.
+// Pods without a valid duration are assumed to run forever.
+// Reservations take only cpu and memory into account.
+type BackfillScheduler struct {
+	predicates      map[string]predicates.FitPredicate
+	maxReservations int
+
+	backfilledPods int64
+}
+
+// NewBackfillScheduler creates a new BackfillScheduler that makes at most maxReservations
+// reservations at each clock.
+func NewBackfillScheduler(maxReservations int) BackfillScheduler {
+	return BackfillScheduler{
+		predicates:      map[string]predicates.FitPredicate{},
+		maxReservations: maxReservations,
+	}
+}
+
+// AddPredicate adds a predicate plugin to this BackfillScheduler.
+// The resource fitness of pods is always checked, regardless of registered predicates.
+func (sched *BackfillScheduler) AddPredicate(name string, predicate predicates.FitPredicate) {
+	sched.predicates[name] = predicate
+}
+
+// backfillReservation represents resources reserved on a node for a queued pod from a time.
+type backfillReservation struct {
+	pod      *v1.Pod
+	node     string
+	start    time.Time
+	resource *nodeinfo.Resource
+}
+
+// Schedule implements Scheduler interface.
+func (sched *BackfillScheduler) Schedule(
+	ctx context.Context,
+	clock clock.Clock,
+	pendingPods queue.PodQueue,
+	nodeLister algorithm.NodeLister,
+	nodeInfoMap map[string]*nodeinfo.NodeInfo) ([]Event, error) {
+
+	pods := popAllPods(pendingPods)
+	if len(pods) == 0 {
+		return []Event{}, nil
+	}
+
+	nodes, err := nodeLister.List()
+	if err != nil {
+		return []Event{}, err
+	}
+
+	now := clock.ToMetaV1().Time
+	results := []Event{}
+	reservations := []backfillReservation{}
+
+	for _, pod := range pods {
+		result, err := sched.selectNode(ctx, pod, now, nodes, nodeInfoMap, pendingPods, reservations)
+		if err != nil {
+			if _, ok := err.(*core.FitError); !ok && err != core.ErrNoNodesAvailable {
+				return []Event{}, err
+			}
+
+			updatePodStatusSchedulingFailure(clock, pod, err)
+			if err := pendingPods.Push(pod); err != nil {
+				return []Event{}, err
+			}
+
+			if len(reservations) < sched.maxReservations {
+				if r := reserve(pod, now, nodes, nodeInfoMap); r != nil {
+					log.L.Debugf("Reserved node %s at %s for pod %s",
+						r.node, r.start.Format(time.RFC3339), podKeyOrEmpty(pod))
+					reservations = append(reservations, *r)
+				}
+			}
+			continue
+		}
+
+		if len(reservations) > 0 {
+			log.L.Debugf("Backfilled pod %s to node %s", podKeyOrEmpty(pod), result.SuggestedHost)
+			sched.backfilledPods++
+		}
+
+		updatePodStatusSchedulingSucceess(clock, pod)
+		if err := pendingPods.RemoveNominatedNode(pod); err != nil {
+			return []Event{}, err
+		}
+		nodeInfoMap[result.SuggestedHost].AddPod(pod)
+
+		results = append(results, &BindEvent{Pod: pod, ScheduleResult: result})
+	}
+
+	return results, nil
+}
+
+// Metrics implements MetricsReporter interface.
+func (sched *BackfillScheduler) Metrics() Metrics {
+	return Metrics{
+		BackfilledPods: sched.backfilledPods,
+	}
+}
+
+var _ = Scheduler(&BackfillScheduler{})
+var _ = MetricsReporter(&BackfillScheduler{})
+
+// selectNode selects the best-fit node among the feasible nodes on which the pod does not delay any
+// of the reservations.
+func (sched *BackfillScheduler) selectNode(
+	ctx context.Context,
+	pod *v1.Pod,
+	now time.Time,
+	nodes []*v1.Node,
+	nodeInfoMap map[string]*nodeinfo.NodeInfo,
+	podQueue queue.PodQueue,
+	reservations []backfillReservation,
+) (core.ScheduleResult, error) {
+
+	candidates := make([]*v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		info, ok := nodeInfoMap[node.Name]
+		if !ok {
+			return core.ScheduleResult{}, fmt.Errorf("No node named %s", node.Name)
+		}
+		if !delaysReservations(pod, now, info, reservations) {
+			candidates = append(candidates, node)
+		}
+	}
+
+	result, err := selectNodeByFit(ctx, pod, candidates, nodeInfoMap, sched.predicates, podQueue, bestFit)
+	if err == core.ErrNoNodesAvailable && len(nodes) > 0 {
+		return result, &core.FitError{Pod: pod, NumAllNodes: len(nodes)}
+	}
+
+	return result, err
+}
+
+// delaysReservations returns whether placing the pod on the node at now delays any of the
+// reservations on the node.
+func delaysReservations(
+	pod *v1.Pod, now time.Time, nodeInfo *nodeinfo.NodeInfo, reservations []backfillReservation) bool {
+
+	end, finite := podEnd(pod, now)
+	podReq := predicates.GetResourceRequest(pod)
+
+	for _, r := range reservations {
+		if r.node != nodeInfo.Node().Name {
+			continue
+		}
+		if finite && !end.After(r.start) {
+			continue // finishes before the reservation starts
+		}
+
+		free := freeResourceAt(nodeInfo, r.start, now)
+		if free.MilliCPU-podReq.MilliCPU < r.resource.MilliCPU ||
+			free.Memory-podReq.Memory < r.resource.Memory {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reserve finds the node on which the pod can start earliest, and returns a reservation on the node.
+// Returns nil if no node will be able to run the pod.
+func reserve(
+	pod *v1.Pod, now time.Time, nodes []*v1.Node, nodeInfoMap map[string]*nodeinfo.NodeInfo,
+) *backfillReservation {
+
+	req := predicates.GetResourceRequest(pod)
+	var selected *backfillReservation
+
+	for _, node := range nodes {
+		info, ok := nodeInfoMap[node.Name]
+		if !ok {
+			continue
+		}
+
+		start, ok := earliestStart(req, now, info)
+		if !ok {
+			continue
+		}
+
+		if selected == nil || start.Before(selected.start) ||
+			(start.Equal(selected.start) && node.Name < selected.node) {
+			selected = &backfillReservation{pod: pod, node: node.Name, start: start, resource: req}
+		}
+	}
+
+	return selected
+}
+
+// earliestStart estimates the earliest time at which the requested resources become available on
+// the node, as the pods on the node finish.
+// Returns false if the resources will never be available.
+func earliestStart(req *nodeinfo.Resource, now time.Time, nodeInfo *nodeinfo.NodeInfo) (time.Time, bool) {
+	alloc := nodeInfo.AllocatableResource()
+	if alloc.MilliCPU < req.MilliCPU || alloc.Memory < req.Memory {
+		return time.Time{}, false
+	}
+
+	fits := func(t time.Time) bool {
+		free := freeResourceAt(nodeInfo, t, now)
+		return free.MilliCPU >= req.MilliCPU && free.Memory >= req.Memory
+	}
+
+	if fits(now) {
+		return now, true
+	}
+
+	ends := []time.Time{}
+	for _, p := range nodeInfo.Pods() {
+		if end, finite := podEnd(p, now); finite {
+			ends = append(ends, end)
+		}
+	}
+	sort.Slice(ends, func(i, j int) bool { return ends[i].Before(ends[j]) })
+
+	for _, end := range ends {
+		if fits(end) {
+			return end, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// freeResourceAt estimates the resources that will be free on the node at t, assuming that no pods
+// other than those already on the node are placed.
+func freeResourceAt(nodeInfo *nodeinfo.NodeInfo, t time.Time, now time.Time) *nodeinfo.Resource {
+	free := nodeInfo.AllocatableResource()
+	for _, p := range nodeInfo.Pods() {
+		if end, finite := podEnd(p, now); finite && !end.After(t) {
+			continue
+		}
+		req := predicates.GetResourceRequest(p)
+		free.MilliCPU -= req.MilliCPU
+		free.Memory -= req.Memory
+	}
+
+	return &free
+}
+
+// podEnd estimates the time at which the pod finishes.
+// A pod that has not started is assumed to start at now.
+// Returns false if the pod does not declare its duration.
+func podEnd(v1Pod *v1.Pod, now time.Time) (time.Time, bool) {
+	dur, err := pod.ExecutionDuration(v1Pod)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	start := now
+	if v1Pod.Status.StartTime != nil {
+		start = v1Pod.Status.StartTime.Time
+	}
+
+	return start.Add(dur), true
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/queue"
+)
+
+func withDuration(pod *v1.Pod, seconds int) *v1.Pod {
+	pod.Annotations = map[string]string{
+		"simSpec": fmt.Sprintf(`
+- seconds: %d
+  resourceUsage:
+    cpu: 1
+`, seconds),
+	}
+	return pod
+}
+
+func TestBackfillSchedulerSchedule(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	nodes := []*v1.Node{newTestNode("node-0", "4", "8Gi")}
+	nodeInfoMap := newTestNodeInfoMap(t, nodes)
+
+	running := withDuration(newTestPod("running", "2", "2Gi", now), 100)
+	startTime := metav1.NewTime(now)
+	running.Status.StartTime = &startTime
+	nodeInfoMap["node-0"].AddPod(running)
+
+	q := queue.NewFIFOQueue()
+	_ = q.Push(withDuration(newTestPod("large", "4", "4Gi", now), 100))
+	_ = q.Push(withDuration(newTestPod("short", "1", "1Gi", now), 50))
+	_ = q.Push(withDuration(newTestPod("long", "1", "1Gi", now), 200))
+
+	sched := NewBackfillScheduler(1)
+	events, err := sched.Schedule(ctx, clock.NewClock(now), q, fakeNodeLister(nodes), nodeInfoMap)
+	assert.NoError(t, err)
+
+	// Only the short pod, which finishes before the reservation for the large pod starts, is
+	// backfilled.
+	assert.Equal(t, map[string]string{"short": "node-0"}, boundNodes(events))
+	assert.Equal(t, int64(1), sched.Metrics().BackfilledPods)
+
+	pod, _ := q.Pop()
+	assert.Equal(t, "large", pod.Name)
+	pod, _ = q.Pop()
+	assert.Equal(t, "long", pod.Name)
+}
@@ -0,0 +1,270 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/containerd/containerd/log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+	"k8s.io/kubernetes/pkg/scheduler/core"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/queue"
+	"simulator/pkg/util"
+)
+
+// BinPackingScheduler makes scheduling decisions for all pending pods at once in the best-fit
+// decreasing manner.
+// At each clock, it pops all pods from the queue, sorts them in the decreasing order of their sizes,
+// and places each of them onto the feasible node that leaves the least resources after the
+// placement.
+// Pods that do not fit in any node are pushed back to the queue.
+//
+// Unlike GenericScheduler, an unschedulable pod does not block the following pods.
+type BinPackingScheduler struct {
+	predicates map[string]predicates.FitPredicate
+}
+
+// NewBinPackingScheduler creates a new BinPackingScheduler.
+func NewBinPackingScheduler() BinPackingScheduler {
+	return BinPackingScheduler{
+		predicates: map[string]predicates.FitPredicate{},
+	}
+}
+
+// AddPredicate adds a predicate plugin to this BinPackingScheduler.
+// The resource fitness of pods is always checked, regardless of registered predicates.
+func (sched *BinPackingScheduler) AddPredicate(name string, predicate predicates.FitPredicate) {
+	sched.predicates[name] = predicate
+}
+
+// Schedule implements Scheduler interface.
+func (sched *BinPackingScheduler) Schedule(
+	ctx context.Context,
+	clock clock.Clock,
+	pendingPods queue.PodQueue,
+	nodeLister algorithm.NodeLister,
+	nodeInfoMap map[string]*nodeinfo.NodeInfo) ([]Event, error) {
+
+	return scheduleByFit(ctx, clock, pendingPods, nodeLister, nodeInfoMap, sched.predicates, bestFit, true)
+}
+
+var _ = Scheduler(&BinPackingScheduler{})
+
+// scheduleByFit pops all pods from the queue and places each of them onto the feasible node
+// preferred by the given fitPolicy.
+// If sortDecreasing is true, the pods are placed in the decreasing order of their dominant shares;
+// otherwise in the order of the queue.
+// Pods that do not fit in any node are pushed back to the queue.
+func scheduleByFit(
+	ctx context.Context,
+	clock clock.Clock,
+	pendingPods queue.PodQueue,
+	nodeLister algorithm.NodeLister,
+	nodeInfoMap map[string]*nodeinfo.NodeInfo,
+	preds map[string]predicates.FitPredicate,
+	policy fitPolicy,
+	sortDecreasing bool) ([]Event, error) {
+
+	pods := popAllPods(pendingPods)
+	if len(pods) == 0 {
+		return []Event{}, nil
+	}
+
+	nodes, err := nodeLister.List()
+	if err != nil {
+		return []Event{}, err
+	}
+
+	if sortDecreasing {
+		capacity := clusterCapacity(nodes)
+		sort.SliceStable(pods, func(i, j int) bool {
+			return dominantShare(pods[i], capacity) > dominantShare(pods[j], capacity)
+		})
+	}
+
+	results := []Event{}
+	for _, pod := range pods {
+		result, err := selectNodeByFit(ctx, pod, nodes, nodeInfoMap, preds, pendingPods, policy)
+		if err != nil {
+			if _, ok := err.(*core.FitError); !ok && err != core.ErrNoNodesAvailable {
+				return []Event{}, err
+			}
+
+			log.L.Debugf("Pod %s does not fit in any node", podKeyOrEmpty(pod))
+			updatePodStatusSchedulingFailure(clock, pod, err)
+			if err := pendingPods.Push(pod); err != nil {
+				return []Event{}, err
+			}
+			continue
+		}
+
+		log.L.Debugf("Selected node %s for pod %s", result.SuggestedHost, podKeyOrEmpty(pod))
+
+		updatePodStatusSchedulingSucceess(clock, pod)
+		if err := pendingPods.RemoveNominatedNode(pod); err != nil {
+			return []Event{}, err
+		}
+		nodeInfoMap[result.SuggestedHost].AddPod(pod)
+
+		results = append(results, &BindEvent{Pod: pod, ScheduleResult: result})
+	}
+
+	return results, nil
+}
+
+// fitPolicy returns true if placing a pod on a node leaving rem0 (the fraction of remaining
+// resources) is preferred to placing it on a node leaving rem1.
+type fitPolicy = func(rem0, rem1 float64) bool
+
+// bestFit prefers the node that will have the least remaining resources.
+func bestFit(rem0, rem1 float64) bool { return rem0 < rem1 }
+
+// selectNodeByFit selects the feasible node preferred by the given fitPolicy.
+// Ties are broken by node names so that the decision is deterministic.
+// Returns core.ErrNoNodesAvailable if there are no nodes, or core.FitError if the pod does not fit
+// in any node.
+func selectNodeByFit(
+	ctx context.Context,
+	pod *v1.Pod,
+	nodes []*v1.Node,
+	nodeInfoMap map[string]*nodeinfo.NodeInfo,
+	preds map[string]predicates.FitPredicate,
+	podQueue queue.PodQueue,
+	policy fitPolicy,
+) (core.ScheduleResult, error) {
+
+	if len(nodes) == 0 {
+		return core.ScheduleResult{}, core.ErrNoNodesAvailable
+	}
+
+	// Always check the resource fitness in addition to the given predicates.
+	predsWithResources := make(map[string]predicates.FitPredicate, len(preds)+2)
+	for name, pred := range preds {
+		predsWithResources[name] = pred
+	}
+	predsWithResources[predicates.PodFitsResourcesPred] = predicates.PodFitsResources
+	predsWithResources[MiscResourcesPred] = PodFitsMiscResources
+
+	filtered, failedPredicateMap, err := filterWithPlugins(ctx, pod, predsWithResources, nodes, nodeInfoMap, podQueue)
+	if err != nil {
+		return core.ScheduleResult{}, err
+	}
+	if len(filtered) == 0 {
+		return core.ScheduleResult{}, &core.FitError{
+			Pod:              pod,
+			NumAllNodes:      len(nodes),
+			FailedPredicates: failedPredicateMap,
+		}
+	}
+
+	remainings := make(map[string]float64, len(filtered))
+	for _, node := range filtered {
+		info, ok := nodeInfoMap[node.Name]
+		if !ok {
+			return core.ScheduleResult{}, fmt.Errorf("No node named %s", node.Name)
+		}
+		remainings[node.Name] = remainingFraction(pod, info)
+	}
+
+	sort.Slice(filtered, func(i, j int) bool {
+		rem0 := remainings[filtered[i].Name]
+		rem1 := remainings[filtered[j].Name]
+		if rem0 == rem1 {
+			return filtered[i].Name < filtered[j].Name
+		}
+		return policy(rem0, rem1)
+	})
+
+	return core.ScheduleResult{
+		SuggestedHost:  filtered[0].Name,
+		EvaluatedNodes: len(filtered) + len(failedPredicateMap),
+		FeasibleNodes:  len(filtered),
+	}, nil
+}
+
+// remainingFraction calculates the average fraction of cpu and memory that will remain on the node
+// after the pod is placed on it.
+func remainingFraction(pod *v1.Pod, nodeInfo *nodeinfo.NodeInfo) float64 {
+	podReq := predicates.GetResourceRequest(pod)
+	alloc := nodeInfo.AllocatableResource()
+	req := nodeInfo.RequestedResource()
+
+	frac := func(alloc, used int64) float64 {
+		if alloc <= 0 {
+			return 0
+		}
+		return float64(alloc-used) / float64(alloc)
+	}
+
+	cpu := frac(alloc.MilliCPU, req.MilliCPU+podReq.MilliCPU)
+	mem := frac(alloc.Memory, req.Memory+podReq.Memory)
+
+	return (cpu + mem) / 2
+}
+
+// clusterCapacity sums up the allocatable resources of all the given nodes.
+func clusterCapacity(nodes []*v1.Node) *nodeinfo.Resource {
+	capacity := &nodeinfo.Resource{}
+	for _, node := range nodes {
+		capacity.Add(node.Status.Allocatable)
+	}
+	return capacity
+}
+
+// dominantShare calculates the largest share of the cluster capacity among the cpu and memory
+// requested by the pod.
+func dominantShare(pod *v1.Pod, capacity *nodeinfo.Resource) float64 {
+	req := predicates.GetResourceRequest(pod)
+
+	share := 0.0
+	if capacity.MilliCPU > 0 {
+		share = float64(req.MilliCPU) / float64(capacity.MilliCPU)
+	}
+	if capacity.Memory > 0 {
+		if s := float64(req.Memory) / float64(capacity.Memory); s > share {
+			share = s
+		}
+	}
+
+	return share
+}
+
+// popAllPods pops all pods from the queue, in the order of the queue.
+func popAllPods(podQueue queue.PodQueue) []*v1.Pod {
+	pods := []*v1.Pod{}
+	for {
+		pod, err := podQueue.Pop()
+		if err != nil {
+			break
+		}
+		pods = append(pods, pod)
+	}
+
+	return pods
+}
+
+// podKeyOrEmpty returns the key of the pod, or an empty string if the pod has an invalid name.
+// Only for logging.
+func podKeyOrEmpty(pod *v1.Pod) string {
+	key, _ := util.PodKey(pod)
+	return key
+}
@@ -0,0 +1,148 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/queue"
+)
+
+type fakeNodeLister []*v1.Node
+
+func (l fakeNodeLister) List() ([]*v1.Node, error) { return l, nil }
+
+func newTestNode(name, cpu, memory string) *v1.Node {
+	alloc := v1.ResourceList{
+		"cpu":    resource.MustParse(cpu),
+		"memory": resource.MustParse(memory),
+		"pods":   resource.MustParse("110"),
+	}
+
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status:     v1.NodeStatus{Capacity: alloc, Allocatable: alloc},
+	}
+}
+
+func newTestPod(name, cpu, memory string, ts time.Time) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(ts),
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name: "container",
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{
+						"cpu":    resource.MustParse(cpu),
+						"memory": resource.MustParse(memory),
+					},
+				},
+			}},
+		},
+	}
+}
+
+func newTestNodeInfoMap(t *testing.T, nodes []*v1.Node) map[string]*nodeinfo.NodeInfo {
+	infoMap := map[string]*nodeinfo.NodeInfo{}
+	for _, node := range nodes {
+		info := nodeinfo.NewNodeInfo()
+		assert.NoError(t, info.SetNode(node))
+		infoMap[node.Name] = info
+	}
+	return infoMap
+}
+
+func boundNodes(events []Event) map[string]string {
+	bound := map[string]string{}
+	for _, e := range events {
+		if bind, ok := e.(*BindEvent); ok {
+			bound[bind.Pod.Name] = bind.ScheduleResult.SuggestedHost
+		}
+	}
+	return bound
+}
+
+func TestBinPackingSchedulerSchedule(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	nodes := []*v1.Node{
+		newTestNode("node-0", "4", "8Gi"),
+		newTestNode("node-1", "2", "4Gi"),
+	}
+	nodeInfoMap := newTestNodeInfoMap(t, nodes)
+
+	q := queue.NewFIFOQueue()
+	_ = q.Push(newTestPod("small", "1", "1Gi", now))
+	_ = q.Push(newTestPod("large", "3", "6Gi", now))
+	_ = q.Push(newTestPod("medium", "2", "4Gi", now))
+	_ = q.Push(newTestPod("huge", "8", "16Gi", now))
+
+	sched := NewBinPackingScheduler()
+	events, err := sched.Schedule(ctx, clock.NewClock(now), q, fakeNodeLister(nodes), nodeInfoMap)
+	assert.NoError(t, err)
+
+	// large -> node-0 (only fit), medium -> node-1 (exact fit), small -> node-0 (only fit)
+	assert.Equal(t, map[string]string{
+		"large":  "node-0",
+		"medium": "node-1",
+		"small":  "node-0",
+	}, boundNodes(events))
+
+	// The pod that fits no node is placed back.
+	pod, err := q.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "huge", pod.Name)
+	_, err = q.Pop()
+	assert.Equal(t, queue.ErrEmptyQueue, err)
+}
+
+func TestWorstFitSchedulerSchedule(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	nodes := []*v1.Node{
+		newTestNode("node-0", "4", "8Gi"),
+		newTestNode("node-1", "4", "8Gi"),
+	}
+	nodeInfoMap := newTestNodeInfoMap(t, nodes)
+
+	q := queue.NewFIFOQueue()
+	_ = q.Push(newTestPod("pod-0", "1", "1Gi", now))
+	_ = q.Push(newTestPod("pod-1", "1", "1Gi", now))
+	_ = q.Push(newTestPod("pod-2", "1", "1Gi", now))
+
+	sched := NewWorstFitScheduler()
+	events, err := sched.Schedule(ctx, clock.NewClock(now), q, fakeNodeLister(nodes), nodeInfoMap)
+	assert.NoError(t, err)
+
+	// Pods are spread over the nodes; ties are broken by node names.
+	assert.Equal(t, map[string]string{
+		"pod-0": "node-0",
+		"pod-1": "node-1",
+		"pod-2": "node-0",
+	}, boundNodes(events))
+}
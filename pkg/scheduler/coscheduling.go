@@ -0,0 +1,336 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+	"k8s.io/kubernetes/pkg/scheduler/core"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+)
+
+const (
+	// PodGroupNameLabel is the label key of a pod that names the pod group the pod belongs to.
+	PodGroupNameLabel = pod.GroupNameLabel
+
+	// PodGroupMinAvailableLabel is the label key of a pod that specifies the minimum number of pods
+	// in the pod group that must be scheduled together (minMember).
+	PodGroupMinAvailableLabel = pod.GroupMinAvailableLabel
+)
+
+// EnableCoscheduling enables the coscheduling of pod groups in this GenericScheduler, with the
+// permit/wait semantics of the coscheduling plugin in kubernetes-sigs/scheduler-plugins.
+// A pod in a group (see PodGroupNameLabel and PodGroupMinAvailableLabel) that has been assigned a
+// node waits, holding the resources of the node, until minAvailable pods of the group are assigned
+// or running.
+// Then all the waiting pods of the group are bound at once.
+// If the group is not ready within timeout since its first pod started waiting, all the waiting
+// pods are rejected and pushed back to the queue.
+func (sched *GenericScheduler) EnableCoscheduling(timeout time.Duration) {
+	sched.cosched.enabled = true
+	sched.cosched.timeout = timeout
+}
+
+// EnableGangScheduling enables the all-or-nothing scheduling of pod groups in this
+// GenericScheduler, taking precedence over EnableCoscheduling.
+// When a pod in a group comes to the front of the queue, the pods of the group in the queue (see
+// queue.Lister) are assigned nodes together, each tentatively holding the resources of its node for
+// the others.
+// They are bound at once if minAvailable pods of the group, counting the running ones, fit;
+// otherwise, the tentative assignments are released and the pods stay in the queue as
+// unschedulable.
+// The pods of the group that do not fit stay in the queue as well.
+// See queue.PodGroupQueue to hold the pods of a group until enough of them are submitted.
+func (sched *GenericScheduler) EnableGangScheduling() {
+	sched.cosched.gang = true
+}
+
+// podGroupPermits manages the pods waiting for their pod groups.
+type podGroupPermits struct {
+	enabled bool
+	timeout time.Duration
+	waiting map[string]*waitingPodGroup
+	gang    bool
+
+	scheduledGroups int64
+	timedOutGroups  int64
+	unfitGroups     int64
+}
+
+// waitingPodGroup is a pod group of which some pods are waiting for the others.
+type waitingPodGroup struct {
+	deadline clock.Clock
+	pods     []waitingPod
+}
+
+type waitingPod struct {
+	pod    *v1.Pod
+	result core.ScheduleResult
+}
+
+func newPodGroupPermits() *podGroupPermits {
+	return &podGroupPermits{
+		waiting: map[string]*waitingPodGroup{},
+	}
+}
+
+// expire rejects the pod groups whose deadlines have passed, and returns their waiting pods.
+func (p *podGroupPermits) expire(clock clock.Clock) []*v1.Pod {
+	groups := make([]string, 0, len(p.waiting))
+	for group, w := range p.waiting {
+		if !clock.Before(w.deadline) {
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+
+	rejected := []*v1.Pod{}
+	for _, group := range groups {
+		log.L.Debugf("Pod group %s timed out", group)
+
+		for _, w := range p.waiting[group].pods {
+			updatePodStatusSchedulingFailure(clock, w.pod,
+				fmt.Errorf("pod group %s is not ready within %s", group, p.timeout))
+			rejected = append(rejected, w.pod)
+		}
+		delete(p.waiting, group)
+		p.timedOutGroups++
+	}
+
+	return rejected
+}
+
+// assume adds the waiting pods to the nodes assigned to them, so that they hold the resources.
+func (p *podGroupPermits) assume(nodeInfoMap map[string]*nodeinfo.NodeInfo) error {
+	for _, group := range p.waiting {
+		for _, w := range group.pods {
+			info, ok := nodeInfoMap[w.result.SuggestedHost]
+			if !ok {
+				return fmt.Errorf("No node named %s", w.result.SuggestedHost)
+			}
+			assumePod(info, w.pod)
+		}
+	}
+
+	return nil
+}
+
+// permit decides whether the pod assigned a node can be bound.
+// If the pod group is ready, returns all the pods of the group to be bound, including the given
+// one.
+// Otherwise, makes the pod wait and returns nothing.
+func (p *podGroupPermits) permit(
+	clock clock.Clock,
+	v1Pod *v1.Pod,
+	result core.ScheduleResult,
+	nodeInfoMap map[string]*nodeinfo.NodeInfo,
+) []waitingPod {
+
+	group, minAvailable := pod.GroupOf(v1Pod)
+	if !p.enabled || group == "" || minAvailable <= 1 {
+		return []waitingPod{{pod: v1Pod, result: result}}
+	}
+
+	w, ok := p.waiting[group]
+	if !ok {
+		w = &waitingPodGroup{deadline: clock.Add(p.timeout)}
+	}
+	w.pods = append(w.pods, waitingPod{pod: v1Pod, result: result})
+
+	// Pods of the group already running also count; the waiting pods have been assumed.
+	if countPodGroupMembers(group, nodeInfoMap)+1 < minAvailable {
+		log.L.Debugf("Pod %s waits for pod group %s", podKeyOrEmpty(v1Pod), group)
+		p.waiting[group] = w
+		return []waitingPod{}
+	}
+
+	log.L.Debugf("Pod group %s is ready", group)
+	delete(p.waiting, group)
+	p.scheduledGroups++
+
+	return w.pods
+}
+
+// nextDeadline returns the earliest deadline of the waiting pod groups, or false if none.
+func (p *podGroupPermits) nextDeadline() (clock.Clock, bool) {
+	var next clock.Clock
+	found := false
+	for _, w := range p.waiting {
+		if !found || w.deadline.Before(next) {
+			next, found = w.deadline, true
+		}
+	}
+
+	return next, found
+}
+
+// drain removes all the waiting pods and returns them.
+func (p *podGroupPermits) drain() []*v1.Pod {
+	pods := p.held()
+	p.waiting = map[string]*waitingPodGroup{}
+
+	return pods
+}
+
+// held returns the pods waiting for their pod groups, in the order of the groups, without removing
+// them.
+func (p *podGroupPermits) held() []*v1.Pod {
+	groups := make([]string, 0, len(p.waiting))
+	for group := range p.waiting {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	pods := []*v1.Pod{}
+	for _, group := range groups {
+		for _, w := range p.waiting[group].pods {
+			pods = append(pods, w.pod)
+		}
+	}
+
+	return pods
+}
+
+// fillMetrics fills the pod group fields of the metrics.
+func (p *podGroupPermits) fillMetrics(met *Metrics) {
+	met.ScheduledPodGroups = p.scheduledGroups
+	met.TimedOutPodGroups = p.timedOutGroups
+	met.UnfitPodGroups = p.unfitGroups
+	for _, w := range p.waiting {
+		met.WaitingPods += int64(len(w.pods))
+	}
+}
+
+// scheduleGang assigns nodes to the pods of the group of the front pod in the queue at once, and
+// returns them if minAvailable pods of the group fit, or nothing otherwise.
+// The pods assigned are removed from the queue and added to the nodes; the pods of the group that
+// do not fit, or all the pods if the group does not fit, are updated as unschedulable.
+// The second return value is false if the gang scheduling is disabled or the pod does not belong to
+// any group.
+func (sched *GenericScheduler) scheduleGang(
+	ctx context.Context,
+	clock clock.Clock,
+	front *v1.Pod,
+	nodeLister algorithm.NodeLister,
+	nodeInfoMap map[string]*nodeinfo.NodeInfo,
+	pendingPods queue.PodQueue,
+) ([]waitingPod, bool, error) {
+
+	group, minAvailable := pod.GroupOf(front)
+	if !sched.cosched.gang || group == "" {
+		return nil, false, nil
+	}
+
+	members := []*v1.Pod{front}
+	if lister, ok := pendingPods.(queue.Lister); ok {
+		for _, v1Pod := range lister.List() {
+			if g, _ := pod.GroupOf(v1Pod); g == group &&
+				(v1Pod.Namespace != front.Namespace || v1Pod.Name != front.Name) {
+				members = append(members, v1Pod)
+			}
+		}
+	}
+
+	// The pods assigned hold the resources of the clones of their nodes, which are discarded if the
+	// group does not fit.
+	tentative := make(map[string]*nodeinfo.NodeInfo, len(nodeInfoMap))
+	for name, info := range nodeInfoMap {
+		tentative[name] = info
+	}
+	sched.setNodeInfoMap(tentative)
+	defer sched.setNodeInfoMap(nodeInfoMap)
+
+	assigned := []waitingPod{}
+	unfit := []*v1.Pod{}
+	for _, member := range members {
+		profile, ok := sched.profileOf(member)
+		if !ok {
+			unfit = append(unfit, member)
+			continue
+		}
+		result, err := profile.scheduleOne(ctx, member, nodeLister, tentative, pendingPods)
+		if err != nil {
+			if _, ok := err.(*core.FitError); !ok && err != core.ErrNoNodesAvailable {
+				return nil, true, err
+			}
+			updatePodStatusSchedulingFailure(clock, member, err)
+			unfit = append(unfit, member)
+			continue
+		}
+
+		info, ok := tentative[result.SuggestedHost]
+		if !ok {
+			return nil, true, fmt.Errorf("No node named %s", result.SuggestedHost)
+		}
+		if info == nodeInfoMap[result.SuggestedHost] {
+			info = info.Clone()
+			tentative[result.SuggestedHost] = info
+		}
+		assumePod(info, member)
+		assigned = append(assigned, waitingPod{pod: member, result: result})
+	}
+
+	if running := countPodGroupMembers(group, nodeInfoMap); running+len(assigned) < minAvailable {
+		log.L.Debugf("Pod group %s does not fit: %d of %d pods", group, running+len(assigned), minAvailable)
+
+		err := fmt.Errorf("only %d of min-available %d pods of pod group %s fit",
+			running+len(assigned), minAvailable, group)
+		for _, w := range assigned {
+			updatePodStatusSchedulingFailure(clock, w.pod, err)
+		}
+		sched.cosched.unfitGroups++
+		return []waitingPod{}, true, nil
+	}
+	if len(assigned) == 0 {
+		// The group is running, and its remaining pods do not fit.
+		return []waitingPod{}, true, nil
+	}
+
+	log.L.Debugf("Pod group %s fits: %d pods", group, len(assigned))
+	for _, w := range assigned {
+		pendingPods.Delete(w.pod.Namespace, w.pod.Name)
+		if err := pendingPods.RemoveNominatedNode(w.pod); err != nil {
+			return nil, true, err
+		}
+		assumePod(nodeInfoMap[w.result.SuggestedHost], w.pod)
+	}
+	sched.cosched.scheduledGroups++
+
+	return assigned, true, nil
+}
+
+// countPodGroupMembers counts the pods of the group on the nodes.
+func countPodGroupMembers(group string, nodeInfoMap map[string]*nodeinfo.NodeInfo) int {
+	count := 0
+	for _, info := range nodeInfoMap {
+		for _, v1Pod := range info.Pods() {
+			if g, _ := pod.GroupOf(v1Pod); g == group {
+				count++
+			}
+		}
+	}
+
+	return count
+}
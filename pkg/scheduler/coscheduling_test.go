@@ -0,0 +1,123 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/queue"
+)
+
+func newTestGroupPod(name, group, minAvailable string, ts time.Time) *v1.Pod {
+	pod := newTestPod(name, "1", "1Gi", ts)
+	pod.Labels = map[string]string{
+		PodGroupNameLabel:         group,
+		PodGroupMinAvailableLabel: minAvailable,
+	}
+	return pod
+}
+
+func TestGenericSchedulerCoscheduling(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	nodes := []*v1.Node{
+		newTestNode("node-0", "2", "4Gi"),
+	}
+
+	sched := NewGenericScheduler(false)
+	sched.AddPredicate("PodFitsResources", predicates.PodFitsResources)
+	sched.EnableCoscheduling(30 * time.Second)
+
+	q := queue.NewFIFOQueue()
+	_ = q.Push(newTestGroupPod("a-0", "a", "2", now))
+
+	// The first pod of group a waits for the other.
+	events, err := sched.Schedule(ctx, clock.NewClock(now), q, fakeNodeLister(nodes), newTestNodeInfoMap(t, nodes))
+	assert.NoError(t, err)
+	assert.Empty(t, boundNodes(events))
+	assert.Equal(t, int64(1), sched.Metrics().WaitingPods)
+
+	// Waiting pods hold the resources, so groups a and b block each other holding one slot each.
+	_ = q.Push(newTestGroupPod("b-0", "b", "2", now))
+	_ = q.Push(newTestGroupPod("b-1", "b", "2", now))
+	_ = q.Push(newTestGroupPod("a-1", "a", "2", now))
+	events, err = sched.Schedule(ctx, clock.NewClock(now.Add(10*time.Second)), q, fakeNodeLister(nodes),
+		newTestNodeInfoMap(t, nodes))
+	assert.NoError(t, err)
+	assert.Empty(t, boundNodes(events))
+
+	// After the timeout, group a is rejected and group b gets the resources.
+	events, err = sched.Schedule(ctx, clock.NewClock(now.Add(30*time.Second)), q, fakeNodeLister(nodes),
+		newTestNodeInfoMap(t, nodes))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"b-0": "node-0", "b-1": "node-0"}, boundNodes(events))
+
+	met := sched.Metrics()
+	assert.Equal(t, int64(1), met.ScheduledPodGroups)
+	assert.Equal(t, int64(1), met.TimedOutPodGroups)
+
+	// Group a is scheduled together once the cluster becomes empty.
+	events, err = sched.Schedule(ctx, clock.NewClock(now.Add(40*time.Second)), q, fakeNodeLister(nodes),
+		newTestNodeInfoMap(t, nodes))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"a-0": "node-0", "a-1": "node-0"}, boundNodes(events))
+	assert.Equal(t, int64(0), sched.Metrics().WaitingPods)
+}
+
+func TestGenericSchedulerGangScheduling(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	nodes := []*v1.Node{
+		newTestNode("node-0", "2", "4Gi"),
+	}
+
+	sched := NewGenericScheduler(false)
+	sched.AddPredicate("PodFitsResources", predicates.PodFitsResources)
+	sched.EnableGangScheduling()
+
+	// Group a does not fit, and releases the resources assigned to its pods.
+	q := queue.NewFIFOQueue()
+	for _, name := range []string{"a-0", "a-1", "a-2"} {
+		_ = q.Push(newTestGroupPod(name, "a", "3", now))
+	}
+	nodeInfoMap := newTestNodeInfoMap(t, nodes)
+	events, err := sched.Schedule(ctx, clock.NewClock(now), q, fakeNodeLister(nodes), nodeInfoMap)
+	assert.NoError(t, err)
+	assert.Empty(t, boundNodes(events))
+	assert.Empty(t, nodeInfoMap["node-0"].Pods())
+	assert.Equal(t, 3, q.Metrics().PendingPodsNum)
+	assert.Equal(t, int64(1), sched.Metrics().UnfitPodGroups)
+
+	// The pods of group b are bound at once, even though another pod is queued between them.
+	for _, name := range []string{"a-0", "a-1", "a-2"} {
+		q.Delete("default", name)
+	}
+	_ = q.Push(newTestGroupPod("b-0", "b", "2", now))
+	_ = q.Push(newTestPod("c", "1", "1Gi", now))
+	_ = q.Push(newTestGroupPod("b-1", "b", "2", now))
+	events, err = sched.Schedule(ctx, clock.NewClock(now.Add(10*time.Second)), q, fakeNodeLister(nodes),
+		newTestNodeInfoMap(t, nodes))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"b-0": "node-0", "b-1": "node-0"}, boundNodes(events))
+	assert.Equal(t, 1, q.Metrics().PendingPodsNum)
+	assert.Equal(t, int64(1), sched.Metrics().ScheduledPodGroups)
+}
@@ -0,0 +1,181 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/util"
+)
+
+const (
+	// PreferredNodesAnnotation is the annotation key of a pod that lists the names of the nodes
+	// preferred by the pod (e.g., the nodes that store the pod's input data), separated by commas.
+	PreferredNodesAnnotation = "simulator/preferred-nodes"
+
+	// PreferredZonesAnnotation is the annotation key of a pod that lists the zones preferred by the
+	// pod, separated by commas.
+	// The zone of a node is read from its v1.LabelZoneFailureDomain label.
+	PreferredZonesAnnotation = "simulator/preferred-zones"
+)
+
+// EnableDelayScheduling enables the delay scheduling of this GenericScheduler.
+// A pod with locality preferences (see PreferredNodesAnnotation and PreferredZonesAnnotation)
+// is scheduled only to its preferred nodes for up to maxDelayTicks ticks of the given length of
+// simulated time since it first waited, and waits for a preferred slot to become available instead
+// of being placed elsewhere.
+// After that, the pod accepts any feasible node.
+// While a pod is waiting, the following pods in the queue are scheduled.
+func (sched *GenericScheduler) EnableDelayScheduling(maxDelayTicks int, tick time.Duration) {
+	sched.locality.maxDelay = time.Duration(maxDelayTicks) * tick
+}
+
+// Forget implements Forgetter interface.
+// The pod deleted while waiting for its preferred nodes waits anew if submitted again.
+func (sched *GenericScheduler) Forget(podNamespace, podName string) {
+	sched.locality.forget(util.PodKeyFromNames(podNamespace, podName))
+}
+
+// localityTracker tracks the waiting time and the locality hits of pods with locality preferences.
+type localityTracker struct {
+	maxDelay time.Duration
+	// waitingSince maps the key of each pod waiting for its preferred nodes to the clock at which it
+	// first waited.
+	waitingSince map[string]clock.Clock
+
+	hits   int64
+	misses int64
+}
+
+func newLocalityTracker() *localityTracker {
+	return &localityTracker{
+		waitingSince: map[string]clock.Clock{},
+	}
+}
+
+// toWait returns whether the pod should be scheduled only to its preferred nodes at the clock.
+func (t *localityTracker) toWait(clk clock.Clock, pod *v1.Pod) bool {
+	if t.maxDelay <= 0 || !hasLocalityPreference(pod) {
+		return false
+	}
+
+	since, ok := t.waitingSince[podKeyOrEmpty(pod)]
+	return !ok || clk.Sub(since) < t.maxDelay
+}
+
+// wait records that the pod has waited for a preferred node at the clock.
+func (t *localityTracker) wait(clk clock.Clock, pod *v1.Pod) {
+	key := podKeyOrEmpty(pod)
+	if _, ok := t.waitingSince[key]; !ok {
+		t.waitingSince[key] = clk
+	}
+}
+
+// forget forgets the waiting time of the pod with the key.
+func (t *localityTracker) forget(key string) {
+	delete(t.waitingSince, key)
+}
+
+// bound records the binding of the pod to the node.
+func (t *localityTracker) bound(pod *v1.Pod, node *v1.Node) {
+	t.forget(podKeyOrEmpty(pod))
+
+	if !hasLocalityPreference(pod) {
+		return
+	}
+
+	if isPreferredNode(pod, node) {
+		t.hits++
+	} else {
+		t.misses++
+	}
+}
+
+// fillMetrics fills the locality fields of the metrics.
+func (t *localityTracker) fillMetrics(met *Metrics) {
+	met.LocalityHits = t.hits
+	met.LocalityMisses = t.misses
+	if total := t.hits + t.misses; total > 0 {
+		met.LocalityHitRate = float64(t.hits) / float64(total)
+	}
+}
+
+func hasLocalityPreference(pod *v1.Pod) bool {
+	_, nodesOk := pod.Annotations[PreferredNodesAnnotation]
+	_, zonesOk := pod.Annotations[PreferredZonesAnnotation]
+	return nodesOk || zonesOk
+}
+
+// isPreferredNode returns whether the node is one of the preferred nodes, or in one of the
+// preferred zones of the pod.
+func isPreferredNode(pod *v1.Pod, node *v1.Node) bool {
+	for _, name := range splitAnnotation(pod.Annotations[PreferredNodesAnnotation]) {
+		if name == node.Name {
+			return true
+		}
+	}
+
+	zone, ok := node.Labels[v1.LabelZoneFailureDomain]
+	if !ok {
+		return false
+	}
+	for _, z := range splitAnnotation(pod.Annotations[PreferredZonesAnnotation]) {
+		if z == zone {
+			return true
+		}
+	}
+
+	return false
+}
+
+func splitAnnotation(annot string) []string {
+	values := []string{}
+	for _, v := range strings.Split(annot, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// preferredNodeLister lists only the nodes preferred by the pod.
+type preferredNodeLister struct {
+	pod   *v1.Pod
+	inner algorithm.NodeLister
+}
+
+// List implements "k8s.io/pkg/scheduler/algorithm".NodeLister interface.
+func (l *preferredNodeLister) List() ([]*v1.Node, error) {
+	nodes, err := l.inner.List()
+	if err != nil {
+		return nil, err
+	}
+
+	preferred := make([]*v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if isPreferredNode(l.pod, node) {
+			preferred = append(preferred, node)
+		}
+	}
+
+	return preferred, nil
+}
+
+var _ = algorithm.NodeLister(&preferredNodeLister{})
@@ -0,0 +1,82 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/queue"
+)
+
+func TestGenericSchedulerDelayScheduling(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	nodes := []*v1.Node{
+		newTestNode("node-0", "1", "1Gi"),
+		newTestNode("node-1", "4", "8Gi"),
+	}
+	nodes[1].Labels = map[string]string{v1.LabelZoneFailureDomain: "zone-1"}
+
+	sched := NewGenericScheduler(false)
+	sched.AddPredicate("PodFitsResources", predicates.PodFitsResources)
+	sched.EnableDelayScheduling(2, 10*time.Second)
+
+	q := queue.NewFIFOQueue()
+	waiting := newTestPod("waiting", "2", "2Gi", now)
+	waiting.Annotations = map[string]string{PreferredNodesAnnotation: "node-0"}
+	_ = q.Push(waiting)
+	zoned := newTestPod("zoned", "1", "1Gi", now)
+	zoned.Annotations = map[string]string{PreferredZonesAnnotation: "zone-0, zone-1"}
+	_ = q.Push(zoned)
+
+	schedule := func(d time.Duration) map[string]string {
+		events, err := sched.Schedule(ctx, clock.NewClock(now.Add(d)), q, fakeNodeLister(nodes),
+			newTestNodeInfoMap(t, nodes))
+		assert.NoError(t, err)
+		return boundNodes(events)
+	}
+
+	// The waiting pod does not block the following pod.
+	assert.Equal(t, map[string]string{"zoned": "node-1"}, schedule(0))
+
+	// The pod waits for two ticks of the simulated time, however many times it is tried.
+	assert.Empty(t, schedule(0))
+	assert.Empty(t, schedule(10*time.Second))
+	assert.Empty(t, schedule(19*time.Second))
+
+	// After waiting for two ticks, the pod accepts any feasible node.
+	assert.Equal(t, map[string]string{"waiting": "node-1"}, schedule(20*time.Second))
+	assert.Empty(t, sched.locality.waitingSince)
+
+	assert.Equal(t, Metrics{LocalityHits: 1, LocalityMisses: 1, LocalityHitRate: 0.5}, sched.Metrics())
+
+	// The pod deleted while waiting waits anew when submitted again.
+	_ = q.Push(waiting)
+	assert.Empty(t, schedule(30*time.Second))
+	assert.Contains(t, sched.locality.waitingSince, "default/waiting")
+	q.Delete("default", "waiting")
+	sched.Forget("default", "waiting")
+	assert.Empty(t, sched.locality.waitingSince)
+	_ = q.Push(waiting)
+	assert.Empty(t, schedule(50*time.Second))
+	assert.Equal(t, map[string]string{"waiting": "node-1"}, schedule(70*time.Second))
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"strconv"
+
+	"github.com/containerd/containerd/log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/util"
+)
+
+const (
+	// DisruptionBudgetAnnotation is the annotation key of a pod that names the disruption budget
+	// the pod belongs to, like the selector of a PodDisruptionBudget.
+	DisruptionBudgetAnnotation = "simulator/disruption-budget"
+
+	// DisruptionBudgetMinAvailableAnnotation is the annotation key of a pod that specifies the
+	// minimum number of running pods in its disruption budget that preemption must leave.
+	DisruptionBudgetMinAvailableAnnotation = "simulator/disruption-budget-min-available"
+)
+
+// disruptionBudgetOf returns the namespace/name of the disruption budget of the pod and its
+// minAvailable, or an empty string if the pod does not belong to any budget.
+func disruptionBudgetOf(pod *v1.Pod) (string, int) {
+	name, ok := pod.Annotations[DisruptionBudgetAnnotation]
+	if !ok || name == "" {
+		return "", 0
+	}
+
+	minAvailable, err := strconv.Atoi(pod.Annotations[DisruptionBudgetMinAvailableAnnotation])
+	if err != nil || minAvailable < 0 {
+		log.L.Warnf("Invalid %s annotation of pod %s", DisruptionBudgetMinAvailableAnnotation, podKeyOrEmpty(pod))
+		minAvailable = 0
+	}
+
+	return util.PodKeyFromNames(pod.Namespace, name), minAvailable
+}
+
+// disruptionsAllowed returns the number of pods that can be disrupted in each disruption budget,
+// i.e., the number of its pods on the nodes minus its minAvailable, like the status of a
+// PodDisruptionBudget.
+func disruptionsAllowed(nodeInfoMap map[string]*nodeinfo.NodeInfo) map[string]int {
+	allowed := map[string]int{}
+	for _, info := range nodeInfoMap {
+		for _, pod := range info.Pods() {
+			if budget, minAvailable := disruptionBudgetOf(pod); budget != "" {
+				if _, ok := allowed[budget]; !ok {
+					allowed[budget] = -minAvailable
+				}
+				allowed[budget]++
+			}
+		}
+	}
+
+	return allowed
+}
+
+// filterPodsWithDisruptionBudgetViolation groups the pods into the ones whose eviction would violate
+// their disruption budgets and the others, evicting the pods in the given order.
+func filterPodsWithDisruptionBudgetViolation(
+	pods []*v1.Pod, allowed map[string]int,
+) (violatingPods, nonViolatingPods []*v1.Pod) {
+
+	remaining := make(map[string]int, len(allowed))
+	for budget, n := range allowed {
+		remaining[budget] = n
+	}
+
+	for _, pod := range pods {
+		budget, _ := disruptionBudgetOf(pod)
+		if budget == "" {
+			nonViolatingPods = append(nonViolatingPods, pod)
+			continue
+		}
+		if remaining[budget] <= 0 {
+			violatingPods = append(violatingPods, pod)
+			continue
+		}
+		remaining[budget]--
+		nonViolatingPods = append(nonViolatingPods, pod)
+	}
+
+	return violatingPods, nonViolatingPods
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/queue"
+)
+
+func newBudgetPod(name, cpu string, priority int32, budget string, minAvailable string) *v1.Pod {
+	pod := newTestPod(name, cpu, "1Gi", time.Now())
+	pod.UID = types.UID(name) // to be removed from NodeInfo
+	pod.Spec.Priority = &priority
+	if budget != "" {
+		pod.Annotations = map[string]string{
+			DisruptionBudgetAnnotation:             budget,
+			DisruptionBudgetMinAvailableAnnotation: minAvailable,
+		}
+	}
+	return pod
+}
+
+func TestDisruptionsAllowed(t *testing.T) {
+	nodes := []*v1.Node{newTestNode("node-0", "4", "8Gi"), newTestNode("node-1", "4", "8Gi")}
+	nodeInfoMap := newTestNodeInfoMap(t, nodes)
+	web0 := newBudgetPod("web-0", "1", 0, "web", "2")
+	web1 := newBudgetPod("web-1", "1", 0, "web", "2")
+	web2 := newBudgetPod("web-2", "1", 0, "web", "2")
+	db := newBudgetPod("db", "1", 0, "db", "1")
+	nodeInfoMap["node-0"].AddPod(web0)
+	nodeInfoMap["node-0"].AddPod(web1)
+	nodeInfoMap["node-1"].AddPod(web2)
+	nodeInfoMap["node-1"].AddPod(db)
+
+	allowed := disruptionsAllowed(nodeInfoMap)
+	assert.Equal(t, map[string]int{"default/web": 1, "default/db": 0}, allowed)
+
+	other := newBudgetPod("other", "1", 0, "", "")
+	violating, nonViolating := filterPodsWithDisruptionBudgetViolation(
+		[]*v1.Pod{web0, other, web1, db}, allowed)
+	assert.Equal(t, []*v1.Pod{web1, db}, violating)
+	assert.Equal(t, []*v1.Pod{web0, other}, nonViolating)
+	assert.Equal(t, 1, allowed["default/web"], "the given map is modified")
+}
+
+func TestPreemptionRespectsDisruptionBudgets(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	for i := 0; i < 10; i++ {
+		nodes := []*v1.Node{newTestNode("node-0", "2", "8Gi"), newTestNode("node-1", "2", "8Gi")}
+		nodeInfoMap := newTestNodeInfoMap(t, nodes)
+		// Evicting web-0 would leave no pod of the budget running.
+		nodeInfoMap["node-0"].AddPod(newBudgetPod("web-0", "2", 0, "web", "1"))
+		nodeInfoMap["node-1"].AddPod(newBudgetPod("batch-0", "2", 0, "", ""))
+
+		q := queue.NewPriorityQueue()
+		assert.NoError(t, q.Push(newBudgetPod("preemptor", "2", 10, "", "")))
+
+		sched := NewGenericScheduler(true)
+		sched.AddPredicate(predicates.PodFitsResourcesPred, predicates.PodFitsResources)
+		events, err := sched.Schedule(ctx, clock.NewClock(now), q, fakeNodeLister(nodes), nodeInfoMap)
+		assert.NoError(t, err)
+
+		assert.Len(t, events, 1)
+		del, ok := events[0].(*DeleteEvent)
+		assert.True(t, ok)
+		assert.Equal(t, DeleteEvent{PodNamespace: "default", PodName: "batch-0", NodeName: "node-1"}, *del)
+	}
+}
@@ -15,10 +15,13 @@
 package scheduler
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math/rand"
 
 	"github.com/containerd/containerd/log"
+	"github.com/cpuguy83/strongerrors"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/kubernetes/pkg/scheduler/algorithm"
 	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
@@ -27,10 +30,10 @@ import (
 	"k8s.io/kubernetes/pkg/scheduler/core"
 	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
 
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/clock"
-	l "github.com/pfnet-research/k8s-cluster-simulator/pkg/log"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/queue"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/util"
+	"simulator/pkg/clock"
+	l "simulator/pkg/log"
+	"simulator/pkg/queue"
+	"simulator/pkg/util"
 )
 
 // GenericScheduler makes scheduling decision for each given pod in the one-by-one manner.
@@ -43,13 +46,32 @@ type GenericScheduler struct {
 
 	lastNodeIndex     uint64
 	preemptionEnabled bool
+	// rand breaks the ties between the nodes of the highest score if not nil, instead of the
+	// round robin of lastNodeIndex (see SetRand).
+	rand *rand.Rand
+
+	locality *localityTracker
+	cosched  *podGroupPermits
+	// cluster lists the pods on all the nodes given to Schedule (see InterPodAffinityPredicate).
+	cluster *clusterLister
+
+	// profileName is the scheduler name of the pods that this GenericScheduler schedules by itself,
+	// and profiles are the GenericSchedulers of the other scheduler names (see AddProfile).
+	profileName string
+	profiles    map[string]*GenericScheduler
 }
 
 // NewGenericScheduler creates a new GenericScheduler.
 func NewGenericScheduler(preeptionEnabled bool) GenericScheduler {
 	return GenericScheduler{
-		predicates:        map[string]predicates.FitPredicate{},
+		predicates: map[string]predicates.FitPredicate{
+			MaxPodsPred:       PodFitsMaxPods,
+			MiscResourcesPred: PodFitsMiscResources,
+		},
 		preemptionEnabled: preeptionEnabled,
+		locality:          newLocalityTracker(),
+		cosched:           newPodGroupPermits(),
+		cluster:           newClusterLister(),
 	}
 }
 
@@ -59,10 +81,80 @@ func (sched *GenericScheduler) AddExtender(extender Extender) {
 }
 
 // AddPredicate adds a predicate plugin to this GenericScheduler.
+// The number of pods and the miscellaneous resources of each node are always checked (see
+// MaxPodsPred and MiscResourcesPred).
 func (sched *GenericScheduler) AddPredicate(name string, predicate predicates.FitPredicate) {
+	if name == predicates.GeneralPred || name == predicates.PodFitsResourcesPred {
+		// It checks the number of pods as well.
+		delete(sched.predicates, MaxPodsPred)
+	}
 	sched.predicates[name] = predicate
 }
 
+// AddProfile adds the profile, which makes the scheduling decisions for the pods whose
+// spec.schedulerName is the name, as profiles of kube-scheduler do.
+// The other pods are scheduled by this GenericScheduler itself.
+// Only the extenders, predicates, prioritizers, and preemption of the profile are used.
+// Returns error if a profile with the name has been added.
+func (sched *GenericScheduler) AddProfile(name string, profile *GenericScheduler) error {
+	if _, ok := sched.profiles[name]; ok || name == sched.profileName {
+		return strongerrors.InvalidArgument(fmt.Errorf("duplicate profile %s", name))
+	}
+	if sched.profiles == nil {
+		sched.profiles = map[string]*GenericScheduler{}
+	}
+	sched.profiles[name] = profile
+	if sched.rand != nil {
+		profile.SetRand(sched.rand)
+	}
+
+	return nil
+}
+
+// SetRand implements Randomized interface.
+// The ties between the nodes of the highest score are broken at random with the generator, as
+// kube-scheduler does, instead of in the round robin; so are the ones of the profiles.
+func (sched *GenericScheduler) SetRand(rng *rand.Rand) {
+	sched.rand = rng
+	for _, profile := range sched.profiles {
+		profile.SetRand(rng)
+	}
+}
+
+// assumePod adds a copy of the pod bound to the node of the nodeInfo to the nodeInfo, as
+// kube-scheduler assumes a pod, so that the plugins looking up the nodes of the pods on the nodes
+// (see InterPodAffinityPredicate) find the node of the pod.
+func assumePod(nodeInfo *nodeinfo.NodeInfo, pod *v1.Pod) {
+	assumed := pod.DeepCopy()
+	assumed.Spec.NodeName = nodeInfo.Node().Name
+	nodeInfo.AddPod(assumed)
+}
+
+// setNodeInfoMap sets the nodeInfoMap given to Schedule to the cluster listers of this
+// GenericScheduler and its profiles.
+func (sched *GenericScheduler) setNodeInfoMap(nodeInfoMap map[string]*nodeinfo.NodeInfo) {
+	sched.cluster.nodeInfoMap = nodeInfoMap
+	for _, profile := range sched.profiles {
+		profile.setNodeInfoMap(nodeInfoMap)
+	}
+}
+
+// profileOf returns the profile that schedules the pod.
+// If this GenericScheduler is named (see NewGenericSchedulerFromConfiguration), the pods with no
+// scheduler name are of DefaultSchedulerProfileName, and the second return value is false for the
+// pods of a scheduler name without a profile, which kube-scheduler leaves pending; otherwise, this
+// GenericScheduler schedules the pods of the other scheduler names.
+func (sched *GenericScheduler) profileOf(pod *v1.Pod) (*GenericScheduler, bool) {
+	name := pod.Spec.SchedulerName
+	if name == "" && sched.profileName != "" {
+		name = DefaultSchedulerProfileName
+	}
+	if profile, ok := sched.profiles[name]; ok {
+		return profile, true
+	}
+	return sched, sched.profileName == "" || name == sched.profileName
+}
+
 // AddPrioritizer adds a prioritizer plugin to this GenericScheduler.
 func (sched *GenericScheduler) AddPrioritizer(prioritizer priorities.PriorityConfig) {
 	sched.prioritizers = append(sched.prioritizers, prioritizer)
@@ -72,12 +164,23 @@ func (sched *GenericScheduler) AddPrioritizer(prioritizer priorities.PriorityCon
 // Schedules pods in one-by-one manner by using registered extenders and plugins.
 // schedule入口
 func (sched *GenericScheduler) Schedule(
+	ctx context.Context,
 	clock clock.Clock,
 	pendingPods queue.PodQueue,
 	nodeLister algorithm.NodeLister,
 	nodeInfoMap map[string]*nodeinfo.NodeInfo) ([]Event, error) {
 
+	sched.setNodeInfoMap(nodeInfoMap)
+
 	results := []Event{}
+	// Pods waiting for their preferred nodes, or rejected with their pod groups; pushed back to the
+	// queue at the end.
+	delayed := sched.cosched.expire(clock)
+
+	// Pods waiting for their pod groups hold the resources of the assigned nodes.
+	if err := sched.cosched.assume(nodeInfoMap); err != nil {
+		return []Event{}, err
+	}
 
 	for {
 		// For each pod popped from the front of the queue, ...
@@ -98,8 +201,53 @@ func (sched *GenericScheduler) Schedule(
 		}
 		log.L.Debugf("Trying to schedule pod %s", podKey)
 
+		// The pod of a scheduler name without a profile stays pending.
+		profile, ok := sched.profileOf(pod)
+		if !ok {
+			log.L.Debugf("Pod %s has no profile of scheduler name %s", podKey, pod.Spec.SchedulerName)
+
+			pod, _ = pendingPods.Pop()
+			delayed = append(delayed, pod)
+			continue
+		}
+
+		// If the pod belongs to a pod group, try to bind the whole group at once.
+		gang, ok, err := sched.scheduleGang(ctx, clock, pod, nodeLister, nodeInfoMap, pendingPods)
+		if err != nil {
+			return []Event{}, err
+		}
+		if ok {
+			if len(gang) == 0 {
+				// Stop the scheduling process at this clock.
+				break
+			}
+			for _, w := range gang {
+				updatePodStatusSchedulingSucceess(clock, w.pod)
+				sched.locality.bound(w.pod, nodeInfoMap[w.result.SuggestedHost].Node())
+				results = append(results, &BindEvent{Pod: w.pod, ScheduleResult: w.result})
+			}
+			continue
+		}
+
 		// ... try to bind the pod to a node.
-		result, err := sched.scheduleOne(pod, nodeLister, nodeInfoMap, pendingPods)
+		lister := nodeLister
+		toWait := sched.locality.toWait(clock, pod)
+		if toWait {
+			lister = &preferredNodeLister{pod: pod, inner: nodeLister}
+		}
+		result, err := profile.scheduleOne(ctx, pod, lister, nodeInfoMap, pendingPods)
+
+		// If the pod does not fit in its preferred nodes, let it wait for them.
+		if toWait && err != nil {
+			if _, ok := err.(*core.FitError); ok || err == core.ErrNoNodesAvailable {
+				log.L.Debugf("Pod %s waits for its preferred nodes", podKey)
+
+				pod, _ = pendingPods.Pop()
+				sched.locality.wait(clock, pod)
+				delayed = append(delayed, pod)
+				continue
+			}
+		}
 
 		if err != nil {
 			updatePodStatusSchedulingFailure(clock, pod, err)
@@ -110,11 +258,11 @@ func (sched *GenericScheduler) Schedule(
 				log.L.Debugf("Pod %s does not fit in any node", podKey)
 
 				// ... and preemption is enabled, ...
-				if sched.preemptionEnabled {
+				if profile.preemptionEnabled {
 					log.L.Debug("Trying preemption")
 
 					// ... try to preempt other low-priority pods.
-					delEvents, err := sched.preempt(pod, pendingPods, nodeLister, nodeInfoMap, fitError)
+					delEvents, err := profile.preempt(pod, pendingPods, nodeLister, nodeInfoMap, fitError)
 					if err != nil {
 						return []Event{}, err
 					}
@@ -122,19 +270,16 @@ func (sched *GenericScheduler) Schedule(
 					// Delete the victim pods.
 					results = append(results, delEvents...)
 				}
-
-				// Else, stop the scheduling process at this clock.
-				break
-			} else {
-				return []Event{}, nil
 			}
+
+			// Stop the scheduling process at this clock.
+			break
 		}
 
 		// If found a node that can accommodate the pod, ...
 		log.L.Debugf("Selected node %s", result.SuggestedHost)
 
 		pod, _ = pendingPods.Pop()
-		updatePodStatusSchedulingSucceess(clock, pod)
 		if err := pendingPods.RemoveNominatedNode(pod); err != nil {
 			return []Event{}, err
 		}
@@ -143,22 +288,67 @@ func (sched *GenericScheduler) Schedule(
 		if !ok {
 			return []Event{}, fmt.Errorf("No node named %s", result.SuggestedHost)
 		}
-		nodeInfo.AddPod(pod)
+		// The pod may wait for its pod group, holding the resources of the node.
+		permitted := sched.cosched.permit(clock, pod, result, nodeInfoMap)
+		assumePod(nodeInfo, pod)
+
+		// ... then bind it (and the other pods in its pod group) to the node.
+		for _, w := range permitted {
+			updatePodStatusSchedulingSucceess(clock, w.pod)
+			sched.locality.bound(w.pod, nodeInfoMap[w.result.SuggestedHost].Node())
+			results = append(results, &BindEvent{Pod: w.pod, ScheduleResult: w.result})
+		}
+	}
 
-		// ... then bind it to the node.
-		results = append(results, &BindEvent{Pod: pod, ScheduleResult: result})
+	for _, pod := range delayed {
+		if err := pendingPods.Push(pod); err != nil {
+			return []Event{}, err
+		}
 	}
 
 	return results, nil
 }
 
+// Metrics implements MetricsReporter interface.
+func (sched *GenericScheduler) Metrics() Metrics {
+	met := Metrics{}
+	sched.locality.fillMetrics(&met)
+	sched.cosched.fillMetrics(&met)
+	return met
+}
+
+// Drain implements Drainer interface.
+// Returns the pods waiting for their pod groups.
+func (sched *GenericScheduler) Drain() []*v1.Pod {
+	return sched.cosched.drain()
+}
+
+// Held implements Holder interface.
+// Returns the pods waiting for their pod groups.
+func (sched *GenericScheduler) Held() []*v1.Pod {
+	return sched.cosched.held()
+}
+
+// NextWakeup implements Waker interface.
+// Returns the earliest deadline of the pod groups waiting for their pods.
+func (sched *GenericScheduler) NextWakeup(clock clock.Clock) (clock.Clock, bool) {
+	return sched.cosched.nextDeadline()
+}
+
 var _ = Scheduler(&GenericScheduler{})
+var _ = MetricsReporter(&GenericScheduler{})
+var _ = Drainer(&GenericScheduler{})
+var _ = Forgetter(&GenericScheduler{})
+var _ = Holder(&GenericScheduler{})
+var _ = Randomized(&GenericScheduler{})
+var _ = Waker(&GenericScheduler{})
 
 // scheduleOne makes scheduling decision for the given pod and nodes.
 // Returns core.ErrNoNodesAvailable if nodeLister lists zero nodes, or core.FitError if the given
 // pod does not fit in any nodes.
 // 顾名思义，每次调用单个pod
 func (sched *GenericScheduler) scheduleOne(
+	ctx context.Context,
 	pod *v1.Pod,
 	nodeLister algorithm.NodeLister,
 	nodeInfoMap map[string]*nodeinfo.NodeInfo,
@@ -174,7 +364,7 @@ func (sched *GenericScheduler) scheduleOne(
 	}
 
 	// Filter out nodes that cannot accommodate the pod.
-	nodesFiltered, failedPredicateMap, err := sched.filter(pod, nodes, nodeInfoMap, podQueue)
+	nodesFiltered, failedPredicateMap, err := sched.filter(ctx, pod, nodes, nodeInfoMap, podQueue)
 	if err != nil {
 		return result, err
 	}
@@ -195,7 +385,7 @@ func (sched *GenericScheduler) scheduleOne(
 	}
 
 	// Prioritize nodes that have passed the filtering phase.
-	prios, err := sched.prioritize(pod, nodesFiltered, nodeInfoMap, podQueue)
+	prios, err := sched.prioritize(ctx, pod, nodesFiltered, nodeInfoMap, podQueue)
 	if err != nil {
 		return result, err
 	}
@@ -211,6 +401,7 @@ func (sched *GenericScheduler) scheduleOne(
 }
 
 func (sched *GenericScheduler) filter(
+	ctx context.Context,
 	pod *v1.Pod,
 	nodes []*v1.Node,
 	nodeInfoMap map[string]*nodeinfo.NodeInfo,
@@ -226,7 +417,7 @@ func (sched *GenericScheduler) filter(
 	}
 
 	// In-process plugins
-	filtered, failedPredicateMap, err := filterWithPlugins(pod, sched.predicates, nodes, nodeInfoMap, podQueue)
+	filtered, failedPredicateMap, err := filterWithPlugins(ctx, pod, sched.predicates, nodes, nodeInfoMap, podQueue)
 	if err != nil {
 		return []*v1.Node{}, core.FailedPredicateMap{}, err
 	}
@@ -266,6 +457,7 @@ func (sched *GenericScheduler) filter(
 }
 
 func (sched *GenericScheduler) prioritize(
+	ctx context.Context,
 	pod *v1.Pod,
 	filteredNodes []*v1.Node,
 	nodeInfoMap map[string]*nodeinfo.NodeInfo,
@@ -301,7 +493,7 @@ func (sched *GenericScheduler) prioritize(
 	}
 
 	// In-process plugins
-	prioList, err := prioritizeWithPlugins(pod, sched.prioritizers, filteredNodes, nodeInfoMap, podQueue)
+	prioList, err := prioritizeWithPlugins(ctx, pod, sched.prioritizers, filteredNodes, nodeInfoMap, podQueue)
 	if err != nil {
 		return api.HostPriorityList{}, err
 	}
@@ -445,12 +637,11 @@ func (sched *GenericScheduler) findPreemption(
 		return nil, nil, []*v1.Pod{preemptor}, nil
 	}
 
-	// pdbs, err := sched.pdbLister.List(labels.Everything())
-	// if err != nil {
-	// 	return nil, nil, nil, err
-	// }
+	// The disruption budgets of the pods annotated with DisruptionBudgetAnnotation substitute for
+	// PodDisruptionBudgets.
+	allowed := disruptionsAllowed(nodeInfoMap)
 
-	nodeToVictims, err := sched.selectNodesForPreemption(preemptor, nodeInfoMap, potentialNodes, podQueue /* , pdb */)
+	nodeToVictims, err := sched.selectNodesForPreemption(preemptor, nodeInfoMap, potentialNodes, podQueue, allowed)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -37,6 +37,7 @@ package scheduler
 import (
 	"errors"
 	"math"
+	"sort"
 
 	"github.com/containerd/containerd/log"
 	v1 "k8s.io/api/core/v1"
@@ -46,9 +47,10 @@ import (
 	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
 	kutil "k8s.io/kubernetes/pkg/scheduler/util"
 
-	l "github.com/pfnet-research/k8s-cluster-simulator/pkg/log"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/queue"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/util"
+	l "simulator/pkg/log"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+	"simulator/pkg/util"
 )
 
 func (sched *GenericScheduler) selectHost(priorities api.HostPriorityList) (string, error) {
@@ -57,6 +59,9 @@ func (sched *GenericScheduler) selectHost(priorities api.HostPriorityList) (stri
 	}
 
 	maxScores := findMaxScores(priorities)
+	if sched.rand != nil {
+		return priorities[maxScores[sched.rand.Intn(len(maxScores))]].Host, nil
+	}
 	idx := int(sched.lastNodeIndex % uint64(len(maxScores)))
 	sched.lastNodeIndex++
 
@@ -81,6 +86,10 @@ func findMaxScores(priorities api.HostPriorityList) []int {
 }
 
 func podEligibleToPreemptOthers(preemptor *v1.Pod, nodeInfoMap map[string]*nodeinfo.NodeInfo) bool {
+	if pod.GetPreemptionPolicy(preemptor) == pod.PreemptNever {
+		return false
+	}
+
 	nomNodeName := preemptor.Status.NominatedNodeName
 	if len(nomNodeName) > 0 {
 		if nodeInfo, ok := nodeInfoMap[nomNodeName]; ok {
@@ -144,12 +153,12 @@ func (sched *GenericScheduler) selectNodesForPreemption(
 	nodeInfoMap map[string]*nodeinfo.NodeInfo,
 	potentialNodes []*v1.Node,
 	podQueue queue.PodQueue,
-	// pdbs []*policy.PodDisruptionBudget,
+	disruptionsAllowed map[string]int,
 ) (map[*v1.Node]*api.Victims, error) {
 	nodeToVictims := map[*v1.Node]*api.Victims{}
 
 	for _, node := range potentialNodes {
-		pods, numPDBViolations, fits := sched.selectVictimsOnNode(preemptor, nodeInfoMap[node.Name], podQueue /* , pdbs */)
+		pods, numPDBViolations, fits := sched.selectVictimsOnNode(preemptor, nodeInfoMap[node.Name], podQueue, disruptionsAllowed)
 		if fits {
 			nodeToVictims[node] = &api.Victims{
 				Pods:             pods,
@@ -165,7 +174,7 @@ func (sched *GenericScheduler) selectVictimsOnNode(
 	preemptor *v1.Pod,
 	nodeInfo *nodeinfo.NodeInfo,
 	podQueue queue.PodQueue,
-	// pdbs []*policy.PodDisruptionBudget,
+	disruptionsAllowed map[string]int,
 ) (pods []*v1.Pod, numPDBViolations int, fits bool) {
 	if nodeInfo == nil {
 		return nil, 0, false
@@ -203,12 +212,17 @@ func (sched *GenericScheduler) selectVictimsOnNode(
 	}
 
 	var victims []*v1.Pod
-	// numViolatingVictim := 0
-
-	// // Try to reprieve as many pods as possible. We first try to reprieve the PDB
-	// // violating victims and then other non-violating ones. In both cases, we start
-	// // from the highest priority victims.
-	// violatingVictims, nonViolatingVictims := filterPodsWithPDBViolation(potentialVictims.Items, pdbs)
+	numViolatingVictim := 0
+
+	// Try to reprieve as many pods as possible. We first try to reprieve the PDB
+	// violating victims and then other non-violating ones. In both cases, we start
+	// from the highest priority victims.
+	potentialVictimPods := make([]*v1.Pod, 0, len(potentialVictims.Items))
+	for _, p := range potentialVictims.Items {
+		potentialVictimPods = append(potentialVictimPods, p.(*v1.Pod))
+	}
+	violatingVictims, nonViolatingVictims :=
+		filterPodsWithDisruptionBudgetViolation(potentialVictimPods, disruptionsAllowed)
 
 	reprievePod := func(p *v1.Pod) bool {
 		addPod(p)
@@ -230,18 +244,18 @@ func (sched *GenericScheduler) selectVictimsOnNode(
 		return fits
 	}
 
-	for _, p := range /* violatingVictims */ potentialVictims.Items {
-		if !reprievePod(p.(*v1.Pod)) {
-			// numViolatingVictim++
+	for _, p := range violatingVictims {
+		if !reprievePod(p) {
+			numViolatingVictim++
 		}
 	}
 
-	// // Now we try to reprieve non-violating victims.
-	// for _, p := range nonViolatingVictims {
-	// 	reprievePod(p)
-	// }
+	// Now we try to reprieve non-violating victims.
+	for _, p := range nonViolatingVictims {
+		reprievePod(p)
+	}
 
-	return victims /* numViolatingVictim */, 0, true
+	return victims, numViolatingVictim, true
 }
 
 func podFitsOnNode(
@@ -301,31 +315,37 @@ func pickOneNodeForPreemption(nodesToVictims map[*v1.Node]*api.Victims) *v1.Node
 		return nil
 	}
 
-	// minNumPDBViolatingPods := math.MaxInt32
+	// The nodes are visited in the order of their names, so that the ties are broken
+	// deterministically.
+	nodes := make([]*v1.Node, 0, len(nodesToVictims))
+	for node := range nodesToVictims {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+
+	minNumPDBViolatingPods := math.MaxInt32
 	var minNodes1 []*v1.Node
 	lenNodes1 := 0
-	for node := range nodesToVictims {
-		// if len(victims.Pods) == 0 {
-		// 	// We found a node that doesn't need any preemption. Return it!
-		// 	// This should happen rarely when one or more pods are terminated between
-		// 	// the time that scheduler tries to schedule the pod and the time that
-		// 	// preemption logic tries to find nodes for preemption.
-		// 	return node
-		// }
-
-		// numPDBViolatingPods := victims.NumPDBViolations
-		// if numPDBViolatingPods < minNumPDBViolatingPods {
-		// 	minNumPDBViolatingPods = numPDBViolatingPods
-		// 	minNodes1 = nil
-		// 	lenNodes1 = 0
-		// }
-		// if numPDBViolatingPods == minNumPDBViolatingPods {
-		// 	minNodes1 = append(minNodes1, node)
-		// 	lenNodes1++
-		// }
-
-		minNodes1 = append(minNodes1, node)
-		lenNodes1++
+	for _, node := range nodes {
+		victims := nodesToVictims[node]
+		if len(victims.Pods) == 0 {
+			// We found a node that doesn't need any preemption. Return it!
+			// This should happen rarely when one or more pods are terminated between
+			// the time that scheduler tries to schedule the pod and the time that
+			// preemption logic tries to find nodes for preemption.
+			return node
+		}
+
+		numPDBViolatingPods := victims.NumPDBViolations
+		if numPDBViolatingPods < minNumPDBViolatingPods {
+			minNumPDBViolatingPods = numPDBViolatingPods
+			minNodes1 = nil
+			lenNodes1 = 0
+		}
+		if numPDBViolatingPods == minNumPDBViolatingPods {
+			minNodes1 = append(minNodes1, node)
+			lenNodes1++
+		}
 	}
 	if lenNodes1 == 1 {
 		return minNodes1[0]
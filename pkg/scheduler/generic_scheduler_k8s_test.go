@@ -0,0 +1,35 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/pod"
+)
+
+func TestPodEligibleToPreemptOthers(t *testing.T) {
+	preemptor := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default"}}
+	nodeInfoMap := map[string]*nodeinfo.NodeInfo{}
+	assert.True(t, podEligibleToPreemptOthers(preemptor, nodeInfoMap))
+
+	preemptor.Annotations = map[string]string{pod.PreemptionPolicyAnnotation: string(pod.PreemptNever)}
+	assert.False(t, podEligibleToPreemptOthers(preemptor, nodeInfoMap))
+}
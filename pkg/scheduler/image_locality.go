@@ -0,0 +1,95 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/priorities"
+	"k8s.io/kubernetes/pkg/scheduler/api"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/node"
+)
+
+// The bounds of the total size of the images of a pod on a node, between which the score increases
+// linearly, the same as the ImageLocality priority of kube-scheduler.
+const (
+	imageLocalityMinThreshold int64 = 23 * 1024 * 1024
+	imageLocalityMaxThreshold int64 = 1000 * 1024 * 1024
+)
+
+// NewImageLocalityPrioritizer creates a prioritizer plugin that favors the nodes that have already
+// pulled the images of the containers of a pod, in the same way as the ImageLocality priority of
+// kube-scheduler: the score increases with the total size of the images present on the node, each
+// scaled by the fraction of the nodes having it to avoid piling pods up on a few nodes.
+// The images of each node are its v1.NodeStatus.Images, seeded by the config and updated as pods
+// start on it.
+//
+// The ImageLocalityPriorityMap of kube-scheduler cannot be used as is, since it needs the number of
+// the nodes in its own priority metadata.
+func NewImageLocalityPrioritizer(weight int) priorities.PriorityConfig {
+	return priorities.PriorityConfig{
+		Name: "ImageLocality",
+		// Map sums up the sizes of the images multiplied by the number of the nodes having them, which
+		// Reduce divides by the number of all the nodes.
+		Map: func(pod *v1.Pod, meta interface{}, nodeInfo *nodeinfo.NodeInfo) (api.HostPriority, error) {
+			return api.HostPriority{
+				Host:  nodeInfo.Node().Name,
+				Score: int(sumImageSizesBySpread(pod, nodeInfo)),
+			}, nil
+		},
+		Reduce: func(
+			pod *v1.Pod,
+			meta interface{},
+			nodeInfoMap map[string]*nodeinfo.NodeInfo,
+			result api.HostPriorityList,
+		) error {
+			for i := range result {
+				result[i].Score = imageLocalityScore(int64(result[i].Score) / int64(len(nodeInfoMap)))
+			}
+			return nil
+		},
+		Weight: weight,
+	}
+}
+
+// sumImageSizesBySpread returns the sum of the sizes of the images of the containers of the pod on
+// the node, each multiplied by the number of the nodes having the image.
+// Init containers are not considered, as in kube-scheduler.
+func sumImageSizesBySpread(pod *v1.Pod, nodeInfo *nodeinfo.NodeInfo) int64 {
+	states := nodeInfo.ImageStates()
+
+	var sum int64
+	for _, container := range pod.Spec.Containers {
+		if state, ok := states[node.NormalizedImageName(container.Image)]; ok {
+			sum += state.Size * int64(state.NumNodes)
+		}
+	}
+
+	return sum
+}
+
+// imageLocalityScore maps the total size of the images scaled by their spread to
+// [0, api.MaxPriority].
+func imageLocalityScore(sum int64) int {
+	if sum < imageLocalityMinThreshold {
+		sum = imageLocalityMinThreshold
+	} else if sum > imageLocalityMaxThreshold {
+		sum = imageLocalityMaxThreshold
+	}
+
+	return int(int64(api.MaxPriority) * (sum - imageLocalityMinThreshold) /
+		(imageLocalityMaxThreshold - imageLocalityMinThreshold))
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/api"
+
+	"simulator/pkg/node"
+)
+
+func TestImageLocalityPrioritizer(t *testing.T) {
+	const mi = 1024 * 1024
+	nodes := []*v1.Node{
+		newTestNode("node-0", "4", "8Gi"),
+		newTestNode("node-1", "4", "8Gi"),
+		newTestNode("node-2", "4", "8Gi"),
+	}
+	nodes[0].Status.Images = []v1.ContainerImage{
+		{Names: []string{"big:1.0"}, SizeBytes: 500 * mi},
+		{Names: []string{"small:latest"}, SizeBytes: 300 * mi},
+	}
+	nodes[1].Status.Images = []v1.ContainerImage{
+		{Names: []string{"big:1.0"}, SizeBytes: 500 * mi},
+	}
+	infoMap := newTestNodeInfoMap(t, nodes)
+	node.SetImageStates(infoMap)
+
+	pod := newTestPod("pod", "1", "1Gi", time.Now())
+	pod.Spec.Containers[0].Image = "big:1.0"
+	pod.Spec.Containers = append(pod.Spec.Containers, v1.Container{Name: "sidecar", Image: "small"})
+
+	prioritizer := NewImageLocalityPrioritizer(1)
+	result := api.HostPriorityList{}
+	for _, n := range nodes {
+		score, err := prioritizer.Map(pod, nil, infoMap[n.Name])
+		assert.NoError(t, err)
+		result = append(result, score)
+	}
+	assert.NoError(t, prioritizer.Reduce(pod, nil, infoMap, result))
+
+	// node-0: 500Mi * 2/3 + 300Mi * 1/3, node-1: 500Mi * 2/3, node-2: none
+	assert.Equal(t, api.HostPriorityList{
+		{Host: "node-0", Score: 4},
+		{Host: "node-1", Score: 3},
+		{Host: "node-2", Score: 0},
+	}, result)
+}
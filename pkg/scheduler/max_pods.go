@@ -0,0 +1,43 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+)
+
+// MaxPodsPred is the name of the predicate that fails if the number of pods on a node reaches its
+// allocatable pods resource (see PodFitsMaxPods).
+// A GenericScheduler always checks it, unless a predicate checking the number of pods as well is
+// added with the name predicates.GeneralPred or predicates.PodFitsResourcesPred.
+const MaxPodsPred = "MaxPods"
+
+// PodFitsMaxPods is a predicate that checks whether the node can accept one more pod, i.e., the
+// number of pods on the node is less than its allocatable pods resource, like the pod number check
+// of predicates.PodFitsResources.
+func PodFitsMaxPods(
+	pod *v1.Pod, meta predicates.PredicateMetadata, nodeInfo *nodeinfo.NodeInfo,
+) (bool, []predicates.PredicateFailureReason, error) {
+	allowed := nodeInfo.AllowedPodNumber()
+	if len(nodeInfo.Pods())+1 > allowed {
+		return false, []predicates.PredicateFailureReason{
+			predicates.NewInsufficientResourceError(v1.ResourcePods, 1, int64(len(nodeInfo.Pods())), int64(allowed)),
+		}, nil
+	}
+
+	return true, nil, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/queue"
+)
+
+func TestGenericSchedulerMaxPods(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	nodes := []*v1.Node{newTestNode("node-0", "4", "8Gi"), newTestNode("node-1", "4", "8Gi")}
+	for _, node := range nodes {
+		node.Status.Allocatable["pods"] = resource.MustParse("1")
+	}
+	nodeInfoMap := newTestNodeInfoMap(t, nodes)
+	nodeInfoMap["node-0"].AddPod(newTestPod("running", "1", "1Gi", now))
+
+	// The number of pods is checked with no predicates.
+	sched := NewGenericScheduler(false)
+	q := queue.NewFIFOQueue()
+	_ = q.Push(newTestPod("pod-0", "1", "1Gi", now))
+	_ = q.Push(newTestPod("pod-1", "1", "1Gi", now))
+	events, err := sched.Schedule(ctx, clock.NewClock(now), q, fakeNodeLister(nodes), nodeInfoMap)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"pod-0": "node-1"}, boundNodes(events))
+
+	// GeneralPredicates checks it instead.
+	sched.AddPredicate(predicates.GeneralPred, predicates.GeneralPredicates)
+	_, ok := sched.predicates[MaxPodsPred]
+	assert.False(t, ok)
+
+	fits, reasons, err := PodFitsMaxPods(newTestPod("pod-2", "1", "1Gi", now), nil, nodeInfoMap["node-0"])
+	assert.NoError(t, err)
+	assert.False(t, fits)
+	assert.Equal(t, []predicates.PredicateFailureReason{
+		predicates.NewInsufficientResourceError(v1.ResourcePods, 1, 1, 1),
+	}, reasons)
+}
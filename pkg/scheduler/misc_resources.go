@@ -0,0 +1,87 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	v1helper "k8s.io/kubernetes/pkg/apis/core/v1/helper"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/util"
+)
+
+// MiscResourcesPred is the name of the predicate that fails if a node does not have enough
+// allocatable miscellaneous resources for a pod (see PodFitsMiscResources).
+// The schedulers of this package always check it.
+const MiscResourcesPred = "MiscResources"
+
+// PodFitsMiscResources is a predicate that checks whether the node has enough allocatable resources
+// for the requests of the pod of the miscellaneous resources, i.e., the ones with no domain that
+// predicates.PodFitsResources ignores, such as util.ResourcePID and open-file-style counters
+// (e.g., "open-files").
+// A node that does not list a requested resource in its allocatable resources has none.
+func PodFitsMiscResources(
+	pod *v1.Pod, meta predicates.PredicateMetadata, nodeInfo *nodeinfo.NodeInfo,
+) (bool, []predicates.PredicateFailureReason, error) {
+	node := nodeInfo.Node()
+	if node == nil {
+		return false, nil, fmt.Errorf("node not found")
+	}
+
+	request := util.PodTotalResourceRequests(pod)
+	rsrcs := make([]string, 0, len(request))
+	for rsrc, q := range request {
+		if isMiscResource(rsrc) && !q.IsZero() {
+			rsrcs = append(rsrcs, string(rsrc))
+		}
+	}
+	if len(rsrcs) == 0 {
+		return true, nil, nil
+	}
+	sort.Strings(rsrcs)
+
+	used := v1.ResourceList{}
+	for _, p := range nodeInfo.Pods() {
+		used = util.ResourceListSum(used, util.PodTotalResourceRequests(p))
+	}
+
+	var failures []predicates.PredicateFailureReason
+	for _, rsrc := range rsrcs {
+		name := v1.ResourceName(rsrc)
+		req, alloc, inUse := request[name], node.Status.Allocatable[name], used[name]
+		total := inUse.DeepCopy()
+		total.Add(req)
+		if total.Cmp(alloc) > 0 {
+			failures = append(failures,
+				predicates.NewInsufficientResourceError(name, req.Value(), inUse.Value(), alloc.Value()))
+		}
+	}
+
+	return len(failures) == 0, failures, nil
+}
+
+// isMiscResource returns whether the resource is not checked by predicates.PodFitsResources.
+func isMiscResource(rsrc v1.ResourceName) bool {
+	switch rsrc {
+	case v1.ResourceCPU, v1.ResourceMemory, v1.ResourceEphemeralStorage, v1.ResourcePods:
+		return false
+	default:
+		return !v1helper.IsScalarResourceName(rsrc)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/queue"
+	"simulator/pkg/util"
+)
+
+func TestPodFitsMiscResources(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	newPod := func(name, pids string) *v1.Pod {
+		pod := newTestPod(name, "1", "1Gi", now)
+		pod.Spec.Containers[0].Resources.Requests[util.ResourcePID] = resource.MustParse(pids)
+		return pod
+	}
+
+	nodes := []*v1.Node{newTestNode("node-0", "4", "8Gi"), newTestNode("node-1", "4", "8Gi")}
+	nodes[0].Status.Allocatable[util.ResourcePID] = resource.MustParse("1000")
+	nodeInfoMap := newTestNodeInfoMap(t, nodes)
+	nodeInfoMap["node-0"].AddPod(newPod("running", "600"))
+
+	fits, reasons, err := PodFitsMiscResources(newPod("pod", "400"), nil, nodeInfoMap["node-0"])
+	assert.NoError(t, err)
+	assert.True(t, fits)
+	assert.Empty(t, reasons)
+
+	fits, reasons, err = PodFitsMiscResources(newPod("pod", "500"), nil, nodeInfoMap["node-0"])
+	assert.NoError(t, err)
+	assert.False(t, fits)
+	assert.Equal(t, []predicates.PredicateFailureReason{
+		predicates.NewInsufficientResourceError(util.ResourcePID, 500, 600, 1000),
+	}, reasons)
+
+	// node-1 has no PIDs to allocate.
+	fits, _, err = PodFitsMiscResources(newPod("pod", "1"), nil, nodeInfoMap["node-1"])
+	assert.NoError(t, err)
+	assert.False(t, fits)
+
+	// The resources checked by PodFitsResources are not.
+	fits, _, err = PodFitsMiscResources(newTestPod("pod", "8", "1Gi", now), nil, nodeInfoMap["node-1"])
+	assert.NoError(t, err)
+	assert.True(t, fits)
+
+	// Both GenericScheduler and BinPackingScheduler check it.
+	for _, sched := range []Scheduler{newGenericScheduler(), newBinPackingScheduler()} {
+		q := queue.NewFIFOQueue()
+		_ = q.Push(newPod("pod-0", "600"))
+		_ = q.Push(newPod("pod-1", "600"))
+		events, err := sched.Schedule(ctx, clock.NewClock(now), q, fakeNodeLister(nodes), newTestNodeInfoMap(t, nodes))
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"pod-0": "node-0"}, boundNodes(events))
+	}
+}
+
+func newGenericScheduler() Scheduler {
+	sched := NewGenericScheduler(false)
+	sched.AddPredicate(predicates.GeneralPred, predicates.GeneralPredicates)
+	return &sched
+}
+
+func newBinPackingScheduler() Scheduler {
+	sched := NewBinPackingScheduler()
+	return &sched
+}
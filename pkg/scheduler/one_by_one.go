@@ -0,0 +1,124 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containerd/containerd/log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+	"k8s.io/kubernetes/pkg/scheduler/core"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/queue"
+)
+
+// PodScheduler defines the interface of a scheduling algorithm that makes the decision for one pod
+// at a time, which OneByOneScheduler drives over the queue.
+type PodScheduler interface {
+	// SchedulePod selects the node to which the pod is bound.
+	// nodeInfoMap reflects the pods bound earlier at the same clock.
+	// Returns core.ErrNoNodesAvailable or core.FitError if the pod does not fit in any node; the pod
+	// is then pushed back to the queue and tried again at the next clock.
+	// It must never block.
+	SchedulePod(
+		ctx context.Context,
+		pod *v1.Pod,
+		nodeLister algorithm.NodeLister,
+		nodeInfoMap map[string]*nodeinfo.NodeInfo) (core.ScheduleResult, error)
+}
+
+// PodSchedulerFunc is a function that implements PodScheduler interface.
+type PodSchedulerFunc func(
+	ctx context.Context,
+	pod *v1.Pod,
+	nodeLister algorithm.NodeLister,
+	nodeInfoMap map[string]*nodeinfo.NodeInfo) (core.ScheduleResult, error)
+
+// SchedulePod implements PodScheduler interface.
+func (f PodSchedulerFunc) SchedulePod(
+	ctx context.Context,
+	pod *v1.Pod,
+	nodeLister algorithm.NodeLister,
+	nodeInfoMap map[string]*nodeinfo.NodeInfo) (core.ScheduleResult, error) {
+
+	return f(ctx, pod, nodeLister, nodeInfoMap)
+}
+
+var _ = PodScheduler(PodSchedulerFunc(nil))
+
+// OneByOneScheduler is a Scheduler that lets a PodScheduler make scheduling decisions for the
+// pending pods one by one, so that a custom policy can be prototyped without handling the queue
+// and the scheduling events.
+// At each clock, it pops all pods from the queue and passes each of them, in the order of the
+// queue, to the PodScheduler.
+// Pods that do not fit in any node are pushed back to the queue.
+type OneByOneScheduler struct {
+	podScheduler PodScheduler
+}
+
+// NewOneByOneScheduler creates a new OneByOneScheduler with the PodScheduler.
+func NewOneByOneScheduler(podScheduler PodScheduler) OneByOneScheduler {
+	return OneByOneScheduler{podScheduler: podScheduler}
+}
+
+// Schedule implements Scheduler interface.
+// Returns error if the PodScheduler returns an error other than core.ErrNoNodesAvailable and
+// core.FitError, or selects an unknown node.
+func (sched *OneByOneScheduler) Schedule(
+	ctx context.Context,
+	clock clock.Clock,
+	pendingPods queue.PodQueue,
+	nodeLister algorithm.NodeLister,
+	nodeInfoMap map[string]*nodeinfo.NodeInfo) ([]Event, error) {
+
+	results := []Event{}
+	for _, pod := range popAllPods(pendingPods) {
+		result, err := sched.podScheduler.SchedulePod(ctx, pod, nodeLister, nodeInfoMap)
+		if err != nil {
+			if _, ok := err.(*core.FitError); !ok && err != core.ErrNoNodesAvailable {
+				return []Event{}, err
+			}
+
+			log.L.Debugf("Pod %s does not fit in any node", podKeyOrEmpty(pod))
+			updatePodStatusSchedulingFailure(clock, pod, err)
+			if err := pendingPods.Push(pod); err != nil {
+				return []Event{}, err
+			}
+			continue
+		}
+
+		nodeInfo, ok := nodeInfoMap[result.SuggestedHost]
+		if !ok {
+			return []Event{}, fmt.Errorf("No node named %s", result.SuggestedHost)
+		}
+		log.L.Debugf("Selected node %s for pod %s", result.SuggestedHost, podKeyOrEmpty(pod))
+
+		updatePodStatusSchedulingSucceess(clock, pod)
+		if err := pendingPods.RemoveNominatedNode(pod); err != nil {
+			return []Event{}, err
+		}
+		nodeInfo.AddPod(pod)
+
+		results = append(results, &BindEvent{Pod: pod, ScheduleResult: result})
+	}
+
+	return results, nil
+}
+
+var _ = Scheduler(&OneByOneScheduler{})
@@ -0,0 +1,89 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+	"k8s.io/kubernetes/pkg/scheduler/core"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/queue"
+)
+
+// mostFreeCPU selects the node with the most cpu left; a minimal custom policy.
+func mostFreeCPU(
+	_ context.Context,
+	pod *v1.Pod,
+	nodeLister algorithm.NodeLister,
+	nodeInfoMap map[string]*nodeinfo.NodeInfo) (core.ScheduleResult, error) {
+
+	nodes, _ := nodeLister.List()
+	req := pod.Spec.Containers[0].Resources.Requests.Cpu().MilliValue()
+
+	result := core.ScheduleResult{EvaluatedNodes: len(nodes)}
+	best := int64(-1)
+	for _, node := range nodes {
+		info := nodeInfoMap[node.Name]
+		free := info.AllocatableResource().MilliCPU - info.RequestedResource().MilliCPU - req
+		if free >= 0 && free > best {
+			result.SuggestedHost, best = node.Name, free
+		}
+	}
+	if result.SuggestedHost == "" {
+		return result, &core.FitError{Pod: pod, NumAllNodes: len(nodes)}
+	}
+	return result, nil
+}
+
+func TestOneByOneScheduler(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	nodes := []*v1.Node{
+		newTestNode("node-0", "4", "8Gi"),
+		newTestNode("node-1", "2", "4Gi"),
+	}
+	nodeInfoMap := newTestNodeInfoMap(t, nodes)
+
+	q := queue.NewFIFOQueue()
+	_ = q.Push(newTestPod("pod-0", "2", "1Gi", now))
+	_ = q.Push(newTestPod("pod-1", "1", "1Gi", now))
+	_ = q.Push(newTestPod("pod-2", "4", "1Gi", now))
+
+	sched := NewOneByOneScheduler(PodSchedulerFunc(mostFreeCPU))
+	events, err := sched.Schedule(ctx, clock.NewClock(now), q, fakeNodeLister(nodes), nodeInfoMap)
+	assert.NoError(t, err)
+
+	// pod-0 -> node-0 (2 cpu left), pod-1 -> node-0 (1 cpu left, vs. 1 on node-1; the first wins)
+	assert.Equal(t, map[string]string{"pod-0": "node-0", "pod-1": "node-0"}, boundNodes(events))
+	pod, err := q.Front()
+	assert.NoError(t, err)
+	assert.Equal(t, "pod-2", pod.Name)
+	assert.Equal(t, v1.ConditionFalse, pod.Status.Conditions[0].Status)
+
+	unknown := NewOneByOneScheduler(PodSchedulerFunc(func(
+		context.Context, *v1.Pod, algorithm.NodeLister, map[string]*nodeinfo.NodeInfo,
+	) (core.ScheduleResult, error) {
+		return core.ScheduleResult{SuggestedHost: "node-9"}, nil
+	}))
+	_, err = unknown.Schedule(ctx, clock.NewClock(now), q, fakeNodeLister(nodes), nodeInfoMap)
+	assert.EqualError(t, err, "No node named node-9")
+}
@@ -29,13 +29,19 @@ import (
 	"k8s.io/kubernetes/pkg/scheduler/core"
 	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
 
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/queue"
+	"simulator/pkg/queue"
 )
 
 // dummyPredicateMetadata implements predicates.PredicateMetadata interface.
 type dummyPredicateMetadata struct{}
 type dummyPriorityMetadata struct{}
 
+// priorityMetadata is the metadata passed to the prioritizer plugins, carrying the context of the
+// scheduling to the plugins that accept one (see NewScorerPrioritizer).
+type priorityMetadata struct {
+	ctx context.Context
+}
+
 func (d *dummyPredicateMetadata) ShallowCopy() predicates.PredicateMetadata             { return d }
 func (d *dummyPredicateMetadata) AddPod(pod *v1.Pod, nodeInfo *nodeinfo.NodeInfo) error { return nil }
 func (d *dummyPredicateMetadata) RemovePod(pod *v1.Pod) error                           { return nil }
@@ -43,6 +49,7 @@ func (d *dummyPredicateMetadata) RemovePod(pod *v1.Pod) error
 const workerNum = 16
 
 func filterWithPlugins(
+	ctx context.Context,
 	pod *v1.Pod,
 	preds map[string]predicates.FitPredicate,
 	nodes []*v1.Node,
@@ -63,10 +70,11 @@ func filterWithPlugins(
 	errs := errors.MessageCountMap{}
 	var predicateResultLock sync.Mutex
 
-	ctx, cancel := context.WithCancel(context.Background())
+	filterCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	// Run predicate plugins in parallel along nodes.
-	workqueue.ParallelizeUntil(ctx, workerNum, int(nodesNum), func(i int) {
+	workqueue.ParallelizeUntil(filterCtx, workerNum, int(nodesNum), func(i int) {
 		nodeName := nodes[i].Name
 		nodeInfo, ok := nodeInfoMap[nodeName]
 		if !ok {
@@ -105,6 +113,9 @@ func filterWithPlugins(
 		}
 	})
 
+	if err := ctx.Err(); err != nil {
+		return []*v1.Node{}, core.FailedPredicateMap{}, err
+	}
 	if len(errs) > 0 {
 		return []*v1.Node{}, core.FailedPredicateMap{}, errors.CreateAggregateFromMessageCountMap(errs)
 	}
@@ -113,6 +124,7 @@ func filterWithPlugins(
 }
 
 func prioritizeWithPlugins(
+	ctx context.Context,
 	pod *v1.Pod,
 	prioritizers []priorities.PriorityConfig,
 	nodes []*v1.Node,
@@ -129,13 +141,14 @@ func prioritizeWithPlugins(
 		}
 	)
 
+	meta := &priorityMetadata{ctx: ctx}
 	resultList := make([]api.HostPriorityList, len(prioritizers))
 	for i := range prioritizers {
 		resultList[i] = make(api.HostPriorityList, len(nodes))
 	}
 
 	// Run map phases of prioritizer plugins in parallel along nodes.
-	workqueue.ParallelizeUntil(context.TODO(), workerNum, len(nodes), func(nodeIdx int) {
+	workqueue.ParallelizeUntil(ctx, workerNum, len(nodes), func(nodeIdx int) {
 		nodeName := nodes[nodeIdx].Name
 		nodeInfo, ok := nodeInfoMap[nodeName]
 		if !ok {
@@ -149,7 +162,7 @@ func prioritizeWithPlugins(
 			}
 
 			var err error
-			resultList[prioIdx][nodeIdx], err = prioritizers[prioIdx].Map(pod, &dummyPriorityMetadata{}, nodeInfo)
+			resultList[prioIdx][nodeIdx], err = prioritizers[prioIdx].Map(pod, meta, nodeInfo)
 			if err != nil {
 				appendError(err)
 				resultList[prioIdx][nodeIdx].Host = nodeName
@@ -157,9 +170,23 @@ func prioritizeWithPlugins(
 		}
 	})
 
-	// Run reduce phases of prioritizer plugins in parallel along plugins.
+	// Run reduce phases of prioritizer plugins, and the prioritizer plugins of a function over all
+	// the nodes (e.g., InterPodAffinityPriority), in parallel along plugins.
 	wg := sync.WaitGroup{}
 	for prioIdx := range prioritizers {
+		if prioritizers[prioIdx].Function != nil {
+			wg.Add(1)
+			go func(prioIdx int) {
+				defer wg.Done()
+				result, err := prioritizers[prioIdx].Function(pod, nodeInfoMap, nodes)
+				if err != nil {
+					appendError(err)
+					return
+				}
+				resultList[prioIdx] = result
+			}(prioIdx)
+			continue
+		}
 		if prioritizers[prioIdx].Reduce == nil {
 			continue
 		}
@@ -167,13 +194,16 @@ func prioritizeWithPlugins(
 		wg.Add(1)
 		go func(prioIdx int) {
 			defer wg.Done()
-			if err := prioritizers[prioIdx].Reduce(pod, &dummyPriorityMetadata{}, nodeInfoMap, resultList[prioIdx]); err != nil {
+			if err := prioritizers[prioIdx].Reduce(pod, meta, nodeInfoMap, resultList[prioIdx]); err != nil {
 				appendError(err)
 			}
 		}(prioIdx)
 	}
 
 	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return api.HostPriorityList{}, err
+	}
 	if len(errs) != 0 {
 		return api.HostPriorityList{}, errors.NewAggregate(errs)
 	}
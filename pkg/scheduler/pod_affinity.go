@@ -0,0 +1,119 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/priorities"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+)
+
+// InterPodAffinityPriority is the name of the prioritizer returned by
+// GenericScheduler.InterPodAffinityPrioritizer.
+const InterPodAffinityPriority = "InterPodAffinityPriority"
+
+// InterPodAffinityPredicate returns the MatchInterPodAffinity predicate of kube-scheduler, which
+// filters out the nodes on which a pod would break its required pod affinity and anti-affinity, or
+// the required anti-affinity of the pods already bound, within their topology keys:
+//
+//	sched.AddPredicate(predicates.MatchInterPodAffinityPred, sched.InterPodAffinityPredicate())
+//
+// Unlike the other predicates, it looks up the pods on all the nodes, which are listed from the
+// nodes given to Schedule of this GenericScheduler, including the pods bound so far at the clock.
+func (sched *GenericScheduler) InterPodAffinityPredicate() predicates.FitPredicate {
+	return predicates.NewPodAffinityPredicate(sched.cluster, sched.cluster)
+}
+
+// InterPodAffinityPrioritizer returns the InterPodAffinityPriority prioritizer of kube-scheduler
+// with the weight, which favors the nodes satisfying the preferred pod affinity and anti-affinity
+// of a pod and of the pods already bound, within their topology keys.
+// The required affinity of the pods already bound counts with hardPodAffinityWeight (e.g.,
+// v1.DefaultHardPodAffinitySymmetricWeight), as in kube-scheduler.
+// The pods are listed as in InterPodAffinityPredicate.
+func (sched *GenericScheduler) InterPodAffinityPrioritizer(
+	weight int, hardPodAffinityWeight int32,
+) priorities.PriorityConfig {
+
+	return priorities.PriorityConfig{
+		Name: InterPodAffinityPriority,
+		Function: priorities.NewInterPodAffinityPriority(
+			sched.cluster, &clusterNodeLister{sched.cluster}, sched.cluster, hardPodAffinityWeight),
+		Weight: weight,
+	}
+}
+
+// clusterLister lists the nodes and the pods bound to them in the nodeInfoMap given to Schedule,
+// for the plugins that look up other nodes than the one to filter or to score.
+// It implements algorithm.PodLister and predicates.NodeInfo.
+type clusterLister struct {
+	nodeInfoMap map[string]*nodeinfo.NodeInfo
+}
+
+func newClusterLister() *clusterLister {
+	return &clusterLister{nodeInfoMap: map[string]*nodeinfo.NodeInfo{}}
+}
+
+// List implements algorithm.PodLister interface.
+func (c *clusterLister) List(selector labels.Selector) ([]*v1.Pod, error) {
+	return c.FilteredList(func(*v1.Pod) bool { return true }, selector)
+}
+
+// FilteredList implements algorithm.PodLister interface.
+func (c *clusterLister) FilteredList(filter algorithm.PodFilter, selector labels.Selector) ([]*v1.Pod, error) {
+	pods := []*v1.Pod{}
+	for _, info := range c.nodeInfoMap {
+		for _, pod := range info.Pods() {
+			if filter(pod) && selector.Matches(labels.Set(pod.Labels)) {
+				pods = append(pods, pod)
+			}
+		}
+	}
+
+	return pods, nil
+}
+
+// GetNodeInfo implements predicates.NodeInfo interface.
+func (c *clusterLister) GetNodeInfo(name string) (*v1.Node, error) {
+	info, ok := c.nodeInfoMap[name]
+	if !ok || info.Node() == nil {
+		return nil, fmt.Errorf("No node named %s", name)
+	}
+	return info.Node(), nil
+}
+
+// clusterNodeLister lists the nodes of a clusterLister.
+type clusterNodeLister struct {
+	cluster *clusterLister
+}
+
+// List implements algorithm.NodeLister interface.
+func (c *clusterNodeLister) List() ([]*v1.Node, error) {
+	nodes := make([]*v1.Node, 0, len(c.cluster.nodeInfoMap))
+	for _, info := range c.cluster.nodeInfoMap {
+		if info.Node() != nil {
+			nodes = append(nodes, info.Node())
+		}
+	}
+	return nodes, nil
+}
+
+var _ = algorithm.PodLister(&clusterLister{})
+var _ = predicates.NodeInfo(&clusterLister{})
+var _ = algorithm.NodeLister(&clusterNodeLister{})
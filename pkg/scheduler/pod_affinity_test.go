@@ -0,0 +1,136 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/priorities"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/queue"
+)
+
+func newAffinityTestPod(name, app string, affinity *v1.Affinity, ts time.Time) *v1.Pod {
+	pod := newTestPod(name, "1", "1Gi", ts)
+	pod.UID = types.UID("uid-" + pod.Name)
+	pod.Labels = map[string]string{"app": app}
+	pod.Spec.Affinity = affinity
+	return pod
+}
+
+func appTerm(app, topologyKey string) v1.PodAffinityTerm {
+	return v1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": app}},
+		TopologyKey:   topologyKey,
+	}
+}
+
+func TestGenericSchedulerInterPodAffinity(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	nodes := []*v1.Node{
+		newTestNode("node-0", "4", "8Gi"),
+		newTestNode("node-1", "4", "8Gi"),
+		newTestNode("node-2", "4", "8Gi"),
+	}
+	for i, zone := range []string{"zone-0", "zone-0", "zone-1"} {
+		nodes[i].Labels = map[string]string{v1.LabelHostname: nodes[i].Name, v1.LabelZoneFailureDomain: zone}
+	}
+	nodeInfoMap := newTestNodeInfoMap(t, nodes)
+
+	sched := NewGenericScheduler(false)
+	sched.AddPredicate(predicates.PodFitsResourcesPred, predicates.PodFitsResources)
+	sched.AddPredicate(predicates.MatchInterPodAffinityPred, sched.InterPodAffinityPredicate())
+
+	// The web pods spread over the nodes, and the cache pod follows the web pod in zone-1.
+	spread := &v1.Affinity{PodAntiAffinity: &v1.PodAntiAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{appTerm("web", v1.LabelHostname)},
+	}}
+	q := queue.NewFIFOQueue()
+	for _, name := range []string{"web-0", "web-1", "web-2", "web-3"} {
+		_ = q.Push(newAffinityTestPod(name, "web", spread, now))
+	}
+	events, err := sched.Schedule(ctx, clock.NewClock(now), q, fakeNodeLister(nodes), nodeInfoMap)
+	assert.NoError(t, err)
+	bound := boundNodes(events)
+	assert.Len(t, bound, 3)
+	assert.ElementsMatch(t, []string{"node-0", "node-1", "node-2"},
+		[]string{bound["web-0"], bound["web-1"], bound["web-2"]})
+
+	// web-3 fits no node, and blocks the queue.
+	pending, err := q.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "web-3", pending.Name)
+
+	// The cache pod follows the web pod selected into zone-1 by its node affinity.
+	zoned := &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{{
+			MatchExpressions: []v1.NodeSelectorRequirement{{
+				Key: v1.LabelZoneFailureDomain, Operator: v1.NodeSelectorOpIn, Values: []string{"zone-1"},
+			}},
+		}}},
+	}}
+	colocate := &v1.Affinity{PodAffinity: &v1.PodAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{appTerm("web", v1.LabelZoneFailureDomain)},
+	}}
+	sched.AddPredicate(predicates.MatchNodeSelectorPred, predicates.PodMatchNodeSelector)
+	_ = q.Push(newAffinityTestPod("web", "web", zoned, now))
+	_ = q.Push(newAffinityTestPod("cache", "cache", colocate, now))
+	events, err = sched.Schedule(ctx, clock.NewClock(now), q, fakeNodeLister(nodes), newTestNodeInfoMap(t, nodes))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"web": "node-2", "cache": "node-2"}, boundNodes(events))
+}
+
+func TestGenericSchedulerInterPodAffinityPriority(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	nodes := []*v1.Node{
+		newTestNode("node-0", "4", "8Gi"),
+		newTestNode("node-1", "4", "8Gi"),
+	}
+	for _, node := range nodes {
+		node.Labels = map[string]string{v1.LabelHostname: node.Name}
+	}
+
+	sched := NewGenericScheduler(false)
+	sched.AddPredicate(predicates.PodFitsResourcesPred, predicates.PodFitsResources)
+	sched.AddPrioritizer(priorities.PriorityConfig{
+		Name: "MostRequested", Map: priorities.MostRequestedPriorityMap, Weight: 1,
+	})
+	sched.AddPrioritizer(sched.InterPodAffinityPrioritizer(10, v1.DefaultHardPodAffinitySymmetricWeight))
+
+	// The web pods prefer the nodes without web pods, over packing them on one node.
+	prefer := &v1.Affinity{PodAntiAffinity: &v1.PodAntiAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{{
+			Weight: 100, PodAffinityTerm: appTerm("web", v1.LabelHostname),
+		}},
+	}}
+	q := queue.NewFIFOQueue()
+	_ = q.Push(newAffinityTestPod("web-0", "web", prefer, now))
+	_ = q.Push(newAffinityTestPod("web-1", "web", prefer, now))
+	events, err := sched.Schedule(ctx, clock.NewClock(now), q, fakeNodeLister(nodes), newTestNodeInfoMap(t, nodes))
+	assert.NoError(t, err)
+	bound := boundNodes(events)
+	assert.Len(t, bound, 2)
+	assert.NotEqual(t, bound["web-0"], bound["web-1"])
+}
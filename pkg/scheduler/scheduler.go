@@ -15,13 +15,16 @@
 package scheduler
 
 import (
+	"context"
+	"math/rand"
+
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/kubernetes/pkg/scheduler/algorithm"
 	"k8s.io/kubernetes/pkg/scheduler/core"
 	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
 
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/clock"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/queue"
+	"simulator/pkg/clock"
+	"simulator/pkg/queue"
 )
 
 // Scheduler defines the lowest-level scheduler interface.
@@ -29,13 +32,85 @@ type Scheduler interface {
 	// Schedule makes scheduling decisions for (subset of) pending pods and running pods.
 	// The return value is a list of scheduling events.
 	// This method must never block.
+	// The context is canceled when the simulation is interrupted, and is passed to the plugins that
+	// accept one (e.g., Scorer).
 	Schedule(
+		ctx context.Context,
 		clock clock.Clock,
 		podQueue queue.PodQueue,
 		nodeLister algorithm.NodeLister,
 		nodeInfoMap map[string]*nodeinfo.NodeInfo) ([]Event, error)
 }
 
+// MetricsReporter is an optional interface that a Scheduler can implement to report its own metrics
+// to the simulated cluster.
+type MetricsReporter interface {
+	// Metrics returns a metrics of the scheduler.
+	Metrics() Metrics
+}
+
+// Drainer is an optional interface that a Scheduler can implement to give back the pods it holds
+// (e.g., pods waiting for their pod groups) when it is switched to another scheduler.
+type Drainer interface {
+	// Drain returns all the pods held by the scheduler, which are pushed back to the queue.
+	Drain() []*v1.Pod
+}
+
+// Holder is an optional interface that a Scheduler implementing Drainer can implement to list the
+// pods it holds without giving them back, so that a snapshot of the simulation does not affect it.
+type Holder interface {
+	// Held returns all the pods held by the scheduler, in the order Drain would return them.
+	Held() []*v1.Pod
+}
+
+// Waker is an optional interface that a Scheduler can implement to tell the clock at which it needs
+// to be called even if no pods are pending (e.g., to time out the pods it holds), so that the
+// simulated cluster can fast-forward the ticks at which nothing happens.
+// A Scheduler not implementing it is assumed to act only on pending pods.
+type Waker interface {
+	// NextWakeup returns the earliest clock after the given one at which the scheduler needs to be
+	// called. The second return value is false if none.
+	NextWakeup(clock clock.Clock) (clock.Clock, bool)
+}
+
+// Forgetter is an optional interface that a Scheduler can implement to forget its state of a pod
+// (e.g., how long the pod has waited for its preferred nodes) when the pod is deleted before bound.
+type Forgetter interface {
+	// Forget forgets the pod with the namespace and the name.
+	Forget(podNamespace, podName string)
+}
+
+// Randomized is an optional interface that a Scheduler can implement to draw its random numbers
+// (e.g., to break ties between nodes) from the random number generator of the simulated cluster, so
+// that the same seed reproduces the same scheduling decisions.
+type Randomized interface {
+	// SetRand sets the random number generator of the scheduler.
+	SetRand(rng *rand.Rand)
+}
+
+// Metrics represents a metrics of a Scheduler at one time point.
+type Metrics struct {
+	// LocalityHits is the number of pods with locality preferences bound to their preferred nodes.
+	LocalityHits int64
+	// LocalityMisses is the number of pods with locality preferences bound to other nodes.
+	LocalityMisses int64
+	// LocalityHitRate is LocalityHits / (LocalityHits + LocalityMisses).
+	LocalityHitRate float64
+
+	// BackfilledPods is the number of pods placed ahead of reserved pods without delaying them.
+	BackfilledPods int64
+
+	// ScheduledPodGroups is the number of pod groups whose pods have been bound together.
+	ScheduledPodGroups int64
+	// TimedOutPodGroups is the number of times pod groups were rejected by the timeout.
+	TimedOutPodGroups int64
+	// UnfitPodGroups is the number of times pod groups were rejected by the gang scheduling, since
+	// not enough of their pods fit at once.
+	UnfitPodGroups int64
+	// WaitingPods is the number of pods currently waiting for their pod groups.
+	WaitingPods int64
+}
+
 // Event defines the interface of a scheduling event.
 // Submit can returns any type in a list that implements this interface.
 type Event interface {
@@ -0,0 +1,435 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/containerd/containerd/log"
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/priorities"
+	"sigs.k8s.io/yaml"
+)
+
+// KubeSchedulerConfiguration is the part of the KubeSchedulerConfiguration of kube-scheduler
+// (kubescheduler.config.k8s.io/v1beta1 to v1) that configures the scheduling algorithm.
+// The other fields (e.g., clientConnection and leaderElection) are ignored.
+type KubeSchedulerConfiguration struct {
+	APIVersion string                 `json:"apiVersion"`
+	Kind       string                 `json:"kind"`
+	Profiles   []KubeSchedulerProfile `json:"profiles"`
+}
+
+// KubeSchedulerProfile is a scheduling profile, which schedules the pods with its scheduler name.
+type KubeSchedulerProfile struct {
+	SchedulerName string         `json:"schedulerName"`
+	Plugins       *Plugins       `json:"plugins"`
+	PluginConfig  []PluginConfig `json:"pluginConfig"`
+}
+
+// Plugins are the plugins enabled or disabled at the extension points.
+// The plugins at the other extension points (e.g., preFilter and bind) have no counterparts in
+// this simulator, and are ignored.
+type Plugins struct {
+	MultiPoint PluginSet `json:"multiPoint"`
+	Filter     PluginSet `json:"filter"`
+	PostFilter PluginSet `json:"postFilter"`
+	Score      PluginSet `json:"score"`
+}
+
+// PluginSet is the plugins enabled and disabled at an extension point, in addition to the default
+// plugins. Disabling "*" disables all the default plugins.
+type PluginSet struct {
+	Enabled  []Plugin `json:"enabled"`
+	Disabled []Plugin `json:"disabled"`
+}
+
+// Plugin is a plugin, with its weight if a score plugin.
+type Plugin struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+// PluginConfig is the arguments of a plugin.
+// Only the scoringStrategy of NodeResourcesFit and the hardPodAffinityWeight of InterPodAffinity are
+// read.
+type PluginConfig struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args"`
+}
+
+// DefaultSchedulerProfileName is the scheduler name of a profile that does not specify it, and of
+// the pods that do not specify it.
+const DefaultSchedulerProfileName = v1.DefaultSchedulerName
+
+// filterPlugins maps the supported filter plugins to their predicates.
+// InterPodAffinity lists the pods of its GenericScheduler (see buildProfile).
+var filterPlugins = map[string]struct {
+	name      string
+	predicate predicates.FitPredicate
+}{
+	"NodeUnschedulable": {predicates.CheckNodeUnschedulablePred, predicates.CheckNodeUnschedulablePredicate},
+	"NodeName":          {predicates.HostNamePred, predicates.PodFitsHost},
+	"NodePorts":         {predicates.PodFitsHostPortsPred, predicates.PodFitsHostPorts},
+	"NodeAffinity":      {predicates.MatchNodeSelectorPred, predicates.PodMatchNodeSelector},
+	"TaintToleration":   {predicates.PodToleratesNodeTaintsPred, predicates.PodToleratesNodeTaints},
+	"NodeResourcesFit":  {predicates.PodFitsResourcesPred, predicates.PodFitsResources},
+	"InterPodAffinity":  {predicates.MatchInterPodAffinityPred, nil},
+}
+
+// scorePlugins maps the supported score plugins to their prioritizers.
+// NodeResourcesFit scores nodes by the scoringStrategy in its args, and InterPodAffinity lists the
+// pods of its GenericScheduler (see buildProfile).
+var scorePlugins = map[string]priorities.PriorityConfig{
+	"NodeResourcesBalancedAllocation": {
+		Name: "BalancedResourceAllocation", Map: priorities.BalancedResourceAllocationMap,
+	},
+	"NodeResourcesLeastAllocated": {Name: "LeastRequested", Map: priorities.LeastRequestedPriorityMap},
+	"NodeResourcesMostAllocated":  {Name: "MostRequested", Map: priorities.MostRequestedPriorityMap},
+	"NodeAffinity": {
+		Name:   "NodeAffinityPriority",
+		Map:    priorities.CalculateNodeAffinityPriorityMap,
+		Reduce: priorities.CalculateNodeAffinityPriorityReduce,
+	},
+	"TaintToleration": {
+		Name:   "TaintTolerationPriority",
+		Map:    priorities.ComputeTaintTolerationPriorityMap,
+		Reduce: priorities.ComputeTaintTolerationPriorityReduce,
+	},
+	"NodePreferAvoidPods": {
+		Name: "NodePreferAvoidPodsPriority", Map: priorities.CalculateNodePreferAvoidPodsPriorityMap,
+	},
+	"ImageLocality":    NewImageLocalityPrioritizer(1),
+	"NodeResourcesFit": {},
+	"InterPodAffinity": {Name: InterPodAffinityPriority},
+}
+
+// unsupportedPlugins are the plugins of kube-scheduler that need the objects that this simulator
+// does not have (e.g., volumes and services), or that this Kubernetes version does not implement
+// (e.g., topology spread constraints); they are ignored with a warning.
+var unsupportedPlugins = map[string]bool{
+	"PrioritySort": true, "DefaultBinder": true, "SchedulingGates": true,
+	"VolumeRestrictions": true, "VolumeBinding": true, "VolumeZone": true, "NodeVolumeLimits": true,
+	"EBSLimits": true, "GCEPDLimits": true, "AzureDiskLimits": true, "CinderLimits": true,
+	"PodTopologySpread": true, "SelectorSpread": true,
+	"DefaultPodTopologySpread": true, "ServiceAffinity": true, "NodeLabel": true,
+	"RequestedToCapacityRatio": true,
+}
+
+// defaultPlugins are the default plugins of kube-scheduler of the API version, which are enabled
+// unless disabled: the filter plugins, and the score plugins with their weights.
+// The unsupported ones are included too, so that each of them is warned about unless disabled (see
+// checkPlugin).
+func defaultPlugins(apiVersion string) ([]string, []Plugin) {
+	filters := []string{
+		"NodeUnschedulable", "NodeName", "TaintToleration", "NodeAffinity", "NodePorts", "NodeResourcesFit",
+		"VolumeRestrictions", "EBSLimits", "GCEPDLimits", "NodeVolumeLimits", "AzureDiskLimits",
+		"VolumeBinding", "VolumeZone", "PodTopologySpread", "InterPodAffinity",
+	}
+
+	switch apiVersion {
+	case "kubescheduler.config.k8s.io/v1beta1":
+		return filters, []Plugin{
+			{Name: "NodeResourcesBalancedAllocation", Weight: 1},
+			{Name: "ImageLocality", Weight: 1},
+			{Name: "InterPodAffinity", Weight: 1},
+			{Name: "NodeResourcesLeastAllocated", Weight: 1},
+			{Name: "NodeAffinity", Weight: 1},
+			{Name: "NodePreferAvoidPods", Weight: 10000},
+			{Name: "PodTopologySpread", Weight: 2},
+			{Name: "TaintToleration", Weight: 1},
+		}
+	case "kubescheduler.config.k8s.io/v1beta2":
+		return filters, []Plugin{
+			{Name: "NodeResourcesBalancedAllocation", Weight: 1},
+			{Name: "ImageLocality", Weight: 1},
+			{Name: "InterPodAffinity", Weight: 1},
+			{Name: "NodeResourcesFit", Weight: 1},
+			{Name: "NodeAffinity", Weight: 1},
+			{Name: "NodePreferAvoidPods", Weight: 10000},
+			{Name: "PodTopologySpread", Weight: 2},
+			{Name: "TaintToleration", Weight: 1},
+		}
+	default: // v1beta3 and v1
+		return filters, []Plugin{
+			{Name: "TaintToleration", Weight: 3},
+			{Name: "NodeAffinity", Weight: 2},
+			{Name: "NodeResourcesFit", Weight: 1},
+			{Name: "PodTopologySpread", Weight: 2},
+			{Name: "InterPodAffinity", Weight: 2},
+			{Name: "NodeResourcesBalancedAllocation", Weight: 1},
+			{Name: "ImageLocality", Weight: 1},
+		}
+	}
+}
+
+// ReadKubeSchedulerConfiguration reads the KubeSchedulerConfiguration in the YAML or JSON file at
+// the path, and builds a GenericScheduler of its profiles (see NewGenericSchedulerFromConfiguration).
+func ReadKubeSchedulerConfiguration(path string) (*GenericScheduler, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := KubeSchedulerConfiguration{}
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		return nil, strongerrors.InvalidArgument(
+			errors.Errorf("invalid KubeSchedulerConfiguration %s: %s", path, err.Error()))
+	}
+
+	return NewGenericSchedulerFromConfiguration(&conf)
+}
+
+// NewGenericSchedulerFromConfiguration creates a new GenericScheduler of the profiles of the
+// KubeSchedulerConfiguration, in which the filter plugins are translated to predicates, the score
+// plugins to prioritizers with their weights, and the DefaultPreemption post-filter plugin to
+// preemption.
+// The first profile (or the default profile if none) schedules the pods whose scheduler name
+// matches no profile, and the others are added by AddProfile.
+// Returns error if the API version or the kind is not supported, or a plugin is unknown.
+func NewGenericSchedulerFromConfiguration(conf *KubeSchedulerConfiguration) (*GenericScheduler, error) {
+	switch conf.APIVersion {
+	case "kubescheduler.config.k8s.io/v1beta1", "kubescheduler.config.k8s.io/v1beta2",
+		"kubescheduler.config.k8s.io/v1beta3", "kubescheduler.config.k8s.io/v1":
+	default:
+		return nil, strongerrors.InvalidArgument(
+			errors.Errorf("apiVersion %q of KubeSchedulerConfiguration is not supported", conf.APIVersion))
+	}
+	if conf.Kind != "KubeSchedulerConfiguration" {
+		return nil, strongerrors.InvalidArgument(errors.Errorf("invalid kind %q", conf.Kind))
+	}
+
+	profiles := conf.Profiles
+	if len(profiles) == 0 {
+		profiles = []KubeSchedulerProfile{{}}
+	}
+
+	var sched *GenericScheduler
+	for _, profile := range profiles {
+		profileSched, err := buildProfile(conf.APIVersion, profile)
+		if err != nil {
+			return nil, err
+		}
+
+		name := profile.SchedulerName
+		if name == "" {
+			name = DefaultSchedulerProfileName
+		}
+		if sched == nil {
+			sched = profileSched
+			sched.profileName = name
+		} else {
+			if err := sched.AddProfile(name, profileSched); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return sched, nil
+}
+
+// buildProfile builds a GenericScheduler of the profile.
+func buildProfile(apiVersion string, profile KubeSchedulerProfile) (*GenericScheduler, error) {
+	plugins := profile.Plugins
+	if plugins == nil {
+		plugins = &Plugins{}
+	}
+
+	defaultFilters, defaultScores := defaultPlugins(apiVersion)
+	filters := make([]Plugin, 0, len(defaultFilters))
+	for _, name := range defaultFilters {
+		filters = append(filters, Plugin{Name: name})
+	}
+	filters = mergePlugins(filters, plugins.MultiPoint, plugins.Filter)
+	scores := mergePlugins(defaultScores, plugins.MultiPoint, plugins.Score)
+	postFilters := mergePlugins([]Plugin{{Name: "DefaultPreemption"}}, plugins.MultiPoint, plugins.PostFilter)
+
+	preemption := false
+	for _, plugin := range postFilters {
+		if plugin.Name == "DefaultPreemption" {
+			preemption = true
+		}
+	}
+	sched := NewGenericScheduler(preemption)
+
+	warned := map[string]bool{}
+	for _, plugin := range filters {
+		if filter, ok := filterPlugins[plugin.Name]; ok {
+			if plugin.Name == "InterPodAffinity" {
+				filter.predicate = sched.InterPodAffinityPredicate()
+			}
+			sched.AddPredicate(filter.name, filter.predicate)
+		} else if err := checkPlugin(plugin.Name, plugins.MultiPoint, warned); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, plugin := range scores {
+		prioritizer, ok := scorePlugins[plugin.Name]
+		if !ok {
+			if err := checkPlugin(plugin.Name, plugins.MultiPoint, warned); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		switch plugin.Name {
+		case "NodeResourcesFit":
+			var err error
+			if prioritizer, err = nodeResourcesFitPrioritizer(profile.PluginConfig); err != nil {
+				return nil, err
+			}
+		case "InterPodAffinity":
+			weight, err := hardPodAffinityWeight(profile.PluginConfig)
+			if err != nil {
+				return nil, err
+			}
+			prioritizer = sched.InterPodAffinityPrioritizer(0, weight)
+		}
+
+		prioritizer.Weight = plugin.Weight
+		if prioritizer.Weight == 0 {
+			prioritizer.Weight = 1
+		}
+		sched.AddPrioritizer(prioritizer)
+	}
+
+	return &sched, nil
+}
+
+// mergePlugins returns the default plugins without the disabled ones, followed by the enabled ones,
+// of the multiPoint and the extension point.
+func mergePlugins(defaults []Plugin, multiPoint, set PluginSet) []Plugin {
+	disabled := map[string]bool{}
+	for _, plugin := range append(multiPoint.Disabled, set.Disabled...) {
+		disabled[plugin.Name] = true
+	}
+
+	merged := []Plugin{}
+	if !disabled["*"] {
+		for _, plugin := range defaults {
+			if !disabled[plugin.Name] {
+				merged = append(merged, plugin)
+			}
+		}
+	}
+
+	// An enabled plugin overrides the weight of the default one.
+	for _, plugin := range append(multiPoint.Enabled, set.Enabled...) {
+		replaced := false
+		for i := range merged {
+			if merged[i].Name == plugin.Name {
+				merged[i] = plugin
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, plugin)
+		}
+	}
+
+	return merged
+}
+
+// checkPlugin returns error if the plugin, which is not a filter or score plugin of this
+// simulator, is unknown; and warns if it is unsupported, unless it is in warned, to which it is
+// added.
+// The plugins in multiPoint are enabled at all the extension points that they implement, so the
+// ones supported at another extension point are accepted.
+func checkPlugin(name string, multiPoint PluginSet, warned map[string]bool) error {
+	if unsupportedPlugins[name] {
+		if !warned[name] {
+			log.L.Warnf("Plugin %s is not supported, and ignored", name)
+			warned[name] = true
+		}
+		return nil
+	}
+	_, isFilter := filterPlugins[name]
+	_, isScore := scorePlugins[name]
+	if name == "DefaultPreemption" || isFilter || isScore {
+		for _, plugin := range multiPoint.Enabled {
+			if plugin.Name == name {
+				return nil
+			}
+		}
+	}
+
+	return strongerrors.InvalidArgument(errors.Errorf("unknown plugin %q", name))
+}
+
+// nodeResourcesFitPrioritizer returns the prioritizer of the scoringStrategy of NodeResourcesFit
+// in the pluginConfig, LeastAllocated by default.
+func nodeResourcesFitPrioritizer(pluginConfig []PluginConfig) (priorities.PriorityConfig, error) {
+	strategy := "LeastAllocated"
+	for _, conf := range pluginConfig {
+		if conf.Name != "NodeResourcesFit" || len(conf.Args) == 0 {
+			continue
+		}
+
+		args := struct {
+			ScoringStrategy *struct {
+				Type string `json:"type"`
+			} `json:"scoringStrategy"`
+		}{}
+		if err := json.Unmarshal(conf.Args, &args); err != nil {
+			return priorities.PriorityConfig{}, strongerrors.InvalidArgument(
+				errors.Errorf("invalid args of NodeResourcesFit: %s", err.Error()))
+		}
+		if args.ScoringStrategy != nil && args.ScoringStrategy.Type != "" {
+			strategy = args.ScoringStrategy.Type
+		}
+	}
+
+	switch strategy {
+	case "LeastAllocated":
+		return scorePlugins["NodeResourcesLeastAllocated"], nil
+	case "MostAllocated":
+		return scorePlugins["NodeResourcesMostAllocated"], nil
+	default:
+		return priorities.PriorityConfig{}, strongerrors.InvalidArgument(
+			errors.Errorf("scoringStrategy %q of NodeResourcesFit is not supported", strategy))
+	}
+}
+
+// hardPodAffinityWeight returns the hardPodAffinityWeight of InterPodAffinity in the pluginConfig,
+// v1.DefaultHardPodAffinitySymmetricWeight by default.
+func hardPodAffinityWeight(pluginConfig []PluginConfig) (int32, error) {
+	weight := v1.DefaultHardPodAffinitySymmetricWeight
+	for _, conf := range pluginConfig {
+		if conf.Name != "InterPodAffinity" || len(conf.Args) == 0 {
+			continue
+		}
+
+		args := struct {
+			HardPodAffinityWeight *int32 `json:"hardPodAffinityWeight"`
+		}{}
+		if err := json.Unmarshal(conf.Args, &args); err != nil {
+			return 0, strongerrors.InvalidArgument(
+				errors.Errorf("invalid args of InterPodAffinity: %s", err.Error()))
+		}
+		if args.HardPodAffinityWeight != nil {
+			weight = *args.HardPodAffinityWeight
+		}
+	}
+
+	if weight < 0 || weight > 100 {
+		return 0, strongerrors.InvalidArgument(
+			errors.Errorf("hardPodAffinityWeight %d of InterPodAffinity is not in [0, 100]", weight))
+	}
+	return weight, nil
+}
@@ -0,0 +1,180 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/queue"
+)
+
+func predicateNames(sched *GenericScheduler) []string {
+	names := []string{}
+	for name := range sched.predicates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func prioritizerWeights(sched *GenericScheduler) map[string]int {
+	weights := map[string]int{}
+	for _, prioritizer := range sched.prioritizers {
+		weights[prioritizer.Name] = prioritizer.Weight
+	}
+	return weights
+}
+
+func TestReadKubeSchedulerConfiguration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scheduler")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`apiVersion: kubescheduler.config.k8s.io/v1
+kind: KubeSchedulerConfiguration
+clientConnection:
+  kubeconfig: /etc/kubernetes/scheduler.conf
+profiles:
+- schedulerName: default-scheduler
+  plugins:
+    score:
+      disabled:
+      - name: ImageLocality
+      enabled:
+      - name: NodeResourcesFit
+        weight: 5
+- schedulerName: batch
+  plugins:
+    multiPoint:
+      disabled:
+      - name: "*"
+      enabled:
+      - name: NodeResourcesFit
+      - name: PodTopologySpread
+  pluginConfig:
+  - name: NodeResourcesFit
+    args:
+      scoringStrategy:
+        type: MostAllocated
+`), 0644))
+
+	sched, err := ReadKubeSchedulerConfiguration(path)
+	assert.NoError(t, err)
+
+	assert.True(t, sched.preemptionEnabled)
+	assert.Equal(t, []string{
+		"CheckNodeUnschedulable", "HostName", "MatchInterPodAffinity", "MatchNodeSelector", "MiscResources",
+		"PodFitsHostPorts", "PodFitsResources", "PodToleratesNodeTaints",
+	}, predicateNames(sched))
+	assert.Equal(t, map[string]int{
+		"TaintTolerationPriority":    3,
+		"NodeAffinityPriority":       2,
+		"LeastRequested":             5,
+		"InterPodAffinityPriority":   2,
+		"BalancedResourceAllocation": 1,
+	}, prioritizerWeights(sched))
+
+	// The pods of the batch scheduler are scheduled by the batch profile, without preemption.
+	batch, ok := sched.profileOf(&v1.Pod{Spec: v1.PodSpec{SchedulerName: "batch"}})
+	assert.True(t, ok)
+	assert.NotEqual(t, sched, batch)
+	profile, ok := sched.profileOf(&v1.Pod{})
+	assert.True(t, ok)
+	assert.Equal(t, sched, profile)
+	// The pods of the other scheduler names stay pending.
+	_, ok = sched.profileOf(&v1.Pod{Spec: v1.PodSpec{SchedulerName: "unknown"}})
+	assert.False(t, ok)
+	assert.False(t, batch.preemptionEnabled)
+	assert.Equal(t, []string{"MiscResources", "PodFitsResources"}, predicateNames(batch))
+	assert.Equal(t, map[string]int{"MostRequested": 1}, prioritizerWeights(batch))
+}
+
+func TestNewGenericSchedulerFromConfiguration(t *testing.T) {
+	sched, err := NewGenericSchedulerFromConfiguration(&KubeSchedulerConfiguration{
+		APIVersion: "kubescheduler.config.k8s.io/v1beta1",
+		Kind:       "KubeSchedulerConfiguration",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 10000, prioritizerWeights(sched)["NodePreferAvoidPodsPriority"])
+	assert.Equal(t, 1, prioritizerWeights(sched)["LeastRequested"])
+
+	_, err = NewGenericSchedulerFromConfiguration(&KubeSchedulerConfiguration{
+		APIVersion: "kubescheduler.config.k8s.io/v1alpha1",
+		Kind:       "KubeSchedulerConfiguration",
+	})
+	assert.EqualError(t, err,
+		`apiVersion "kubescheduler.config.k8s.io/v1alpha1" of KubeSchedulerConfiguration is not supported`)
+
+	_, err = NewGenericSchedulerFromConfiguration(&KubeSchedulerConfiguration{
+		APIVersion: "kubescheduler.config.k8s.io/v1",
+		Kind:       "KubeSchedulerConfiguration",
+		Profiles: []KubeSchedulerProfile{{Plugins: &Plugins{
+			Filter: PluginSet{Enabled: []Plugin{{Name: "MyFilter"}}},
+		}}},
+	})
+	assert.EqualError(t, err, `unknown plugin "MyFilter"`)
+
+	_, err = NewGenericSchedulerFromConfiguration(&KubeSchedulerConfiguration{
+		APIVersion: "kubescheduler.config.k8s.io/v1",
+		Kind:       "KubeSchedulerConfiguration",
+		Profiles:   []KubeSchedulerProfile{{}, {SchedulerName: DefaultSchedulerProfileName}},
+	})
+	assert.EqualError(t, err, "duplicate profile default-scheduler")
+
+	_, err = NewGenericSchedulerFromConfiguration(&KubeSchedulerConfiguration{
+		APIVersion: "kubescheduler.config.k8s.io/v1",
+		Kind:       "KubeSchedulerConfiguration",
+		Profiles: []KubeSchedulerProfile{{PluginConfig: []PluginConfig{
+			{Name: "InterPodAffinity", Args: []byte(`{"hardPodAffinityWeight": 101}`)},
+		}}},
+	})
+	assert.EqualError(t, err, "hardPodAffinityWeight 101 of InterPodAffinity is not in [0, 100]")
+}
+
+func TestGenericSchedulerUnknownProfile(t *testing.T) {
+	now := time.Now()
+	nodes := []*v1.Node{newTestNode("node-0", "2", "4Gi")}
+	sched, err := NewGenericSchedulerFromConfiguration(&KubeSchedulerConfiguration{
+		APIVersion: "kubescheduler.config.k8s.io/v1",
+		Kind:       "KubeSchedulerConfiguration",
+	})
+	assert.NoError(t, err)
+
+	// The pod of the unknown scheduler name stays pending without blocking the other.
+	unknown := newTestPod("pod-0", "1", "1Gi", now)
+	unknown.Spec.SchedulerName = "unknown"
+	q := queue.NewFIFOQueue()
+	_ = q.Push(unknown)
+	_ = q.Push(newTestPod("pod-1", "1", "1Gi", now))
+
+	events, err := sched.Schedule(context.Background(), clock.NewClock(now), q, fakeNodeLister(nodes),
+		newTestNodeInfoMap(t, nodes))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"pod-1": "node-0"}, boundNodes(events))
+	front, err := q.Front()
+	assert.NoError(t, err)
+	assert.Equal(t, "pod-0", front.Name)
+}
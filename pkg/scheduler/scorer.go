@@ -0,0 +1,343 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os/exec"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/priorities"
+	"k8s.io/kubernetes/pkg/scheduler/api"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/pod"
+)
+
+// Scorer defines the interface of scoring plugins, such as learned placement policies.
+type Scorer interface {
+	// Score returns a score for each of the given featurized views of (pod, node, cluster).
+	// The returned slice must have the same length as features.
+	// A higher score means a more preferred node.
+	// The context is the one given to GenericScheduler.Schedule, canceled when the simulation is
+	// interrupted.
+	Score(ctx context.Context, features []ScoringFeatures) ([]float64, error)
+}
+
+// ScoringFeatures is a featurized view of a pod, a candidate node, and the cluster.
+type ScoringFeatures struct {
+	Pod     PodFeatures     `json:"pod"`
+	Node    NodeFeatures    `json:"node"`
+	Cluster ClusterFeatures `json:"cluster"`
+}
+
+// PodFeatures is a featurized view of a pod to be scheduled.
+type PodFeatures struct {
+	Name      string           `json:"name"`
+	Namespace string           `json:"namespace"`
+	Priority  int32            `json:"priority"`
+	Request   ResourceFeatures `json:"request"`
+	// ExecutionSeconds is the execution duration declared in the "simSpec" annotation, or 0 if
+	// unknown.
+	ExecutionSeconds float64 `json:"executionSeconds"`
+}
+
+// NodeFeatures is a featurized view of a candidate node.
+type NodeFeatures struct {
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels"`
+	Allocatable ResourceFeatures  `json:"allocatable"`
+	Requested   ResourceFeatures  `json:"requested"`
+	PodsNum     int               `json:"podsNum"`
+}
+
+// ClusterFeatures is a featurized view of the whole cluster.
+type ClusterFeatures struct {
+	NodesNum    int              `json:"nodesNum"`
+	Allocatable ResourceFeatures `json:"allocatable"`
+	Requested   ResourceFeatures `json:"requested"`
+	PodsNum     int              `json:"podsNum"`
+}
+
+// ResourceFeatures is an amount of resources.
+type ResourceFeatures struct {
+	MilliCPU         int64            `json:"milliCPU"`
+	Memory           int64            `json:"memory"`
+	EphemeralStorage int64            `json:"ephemeralStorage"`
+	Scalar           map[string]int64 `json:"scalar,omitempty"`
+}
+
+// NewScorerPrioritizer creates a prioritizer plugin that scores the feasible nodes with the scorer.
+// The scores are normalized linearly to [0, api.MaxPriority], with the highest score mapped to
+// api.MaxPriority; scheduling fails if a score is NaN or infinite.
+// All the feasible nodes of a pod are scored in one call of Scorer.Score.
+func NewScorerPrioritizer(name string, scorer Scorer, weight int) priorities.PriorityConfig {
+	return priorities.PriorityConfig{
+		Name: name,
+		// Map only fills the host names; the nodes are scored in Reduce all at once.
+		Map: func(pod *v1.Pod, meta interface{}, nodeInfo *nodeinfo.NodeInfo) (api.HostPriority, error) {
+			return api.HostPriority{Host: nodeInfo.Node().Name}, nil
+		},
+		Reduce: func(
+			pod *v1.Pod,
+			meta interface{},
+			nodeInfoMap map[string]*nodeinfo.NodeInfo,
+			result api.HostPriorityList,
+		) error {
+			ctx := context.Background()
+			if m, ok := meta.(*priorityMetadata); ok {
+				ctx = m.ctx
+			}
+			return scoreWith(ctx, scorer, pod, nodeInfoMap, result)
+		},
+		Weight: weight,
+	}
+}
+
+func scoreWith(
+	ctx context.Context,
+	scorer Scorer, pod *v1.Pod, nodeInfoMap map[string]*nodeinfo.NodeInfo, result api.HostPriorityList,
+) error {
+
+	if len(result) == 0 {
+		return nil
+	}
+
+	podFeatures := featurizePod(pod)
+	clusterFeatures := featurizeCluster(nodeInfoMap)
+
+	features := make([]ScoringFeatures, 0, len(result))
+	for _, prio := range result {
+		info, ok := nodeInfoMap[prio.Host]
+		if !ok {
+			return fmt.Errorf("No node named %s", prio.Host)
+		}
+		features = append(features, ScoringFeatures{
+			Pod:     podFeatures,
+			Node:    featurizeNode(info),
+			Cluster: clusterFeatures,
+		})
+	}
+
+	scores, err := scorer.Score(ctx, features)
+	if err != nil {
+		return err
+	}
+	if len(scores) != len(result) {
+		return fmt.Errorf("Scorer returned %d scores for %d nodes", len(scores), len(result))
+	}
+
+	min, max := scores[0], scores[0]
+	for i, s := range scores {
+		if math.IsNaN(s) || math.IsInf(s, 0) {
+			return fmt.Errorf("Scorer returned non-finite score %v for node %s", s, result[i].Host)
+		}
+		if s < min {
+			min = s
+		}
+		if s > max {
+			max = s
+		}
+	}
+	if math.IsInf(max-min, 0) {
+		return fmt.Errorf("Scorer returned scores from %v to %v, too far apart to normalize", min, max)
+	}
+
+	for i, s := range scores {
+		if max == min {
+			result[i].Score = api.MaxPriority
+		} else {
+			result[i].Score = int((s - min) / (max - min) * api.MaxPriority)
+		}
+	}
+
+	return nil
+}
+
+func featurizePod(v1Pod *v1.Pod) PodFeatures {
+	features := PodFeatures{
+		Name:      v1Pod.Name,
+		Namespace: v1Pod.Namespace,
+		Request:   featurizeResource(predicates.GetResourceRequest(v1Pod)),
+	}
+	if v1Pod.Spec.Priority != nil {
+		features.Priority = *v1Pod.Spec.Priority
+	}
+	if dur, err := pod.ExecutionDuration(v1Pod); err == nil {
+		features.ExecutionSeconds = dur.Seconds()
+	}
+
+	return features
+}
+
+func featurizeNode(info *nodeinfo.NodeInfo) NodeFeatures {
+	alloc := info.AllocatableResource()
+	req := info.RequestedResource()
+	return NodeFeatures{
+		Name:        info.Node().Name,
+		Labels:      info.Node().Labels,
+		Allocatable: featurizeResource(&alloc),
+		Requested:   featurizeResource(&req),
+		PodsNum:     len(info.Pods()),
+	}
+}
+
+func featurizeCluster(nodeInfoMap map[string]*nodeinfo.NodeInfo) ClusterFeatures {
+	features := ClusterFeatures{NodesNum: len(nodeInfoMap)}
+	for _, info := range nodeInfoMap {
+		node := featurizeNode(info)
+		features.Allocatable = addResourceFeatures(features.Allocatable, node.Allocatable)
+		features.Requested = addResourceFeatures(features.Requested, node.Requested)
+		features.PodsNum += node.PodsNum
+	}
+
+	return features
+}
+
+func featurizeResource(r *nodeinfo.Resource) ResourceFeatures {
+	features := ResourceFeatures{
+		MilliCPU:         r.MilliCPU,
+		Memory:           r.Memory,
+		EphemeralStorage: r.EphemeralStorage,
+	}
+	if len(r.ScalarResources) > 0 {
+		features.Scalar = make(map[string]int64, len(r.ScalarResources))
+		for name, q := range r.ScalarResources {
+			features.Scalar[string(name)] = q
+		}
+	}
+
+	return features
+}
+
+func addResourceFeatures(r0, r1 ResourceFeatures) ResourceFeatures {
+	sum := ResourceFeatures{
+		MilliCPU:         r0.MilliCPU + r1.MilliCPU,
+		Memory:           r0.Memory + r1.Memory,
+		EphemeralStorage: r0.EphemeralStorage + r1.EphemeralStorage,
+	}
+	for _, r := range []ResourceFeatures{r0, r1} {
+		for name, q := range r.Scalar {
+			if sum.Scalar == nil {
+				sum.Scalar = map[string]int64{}
+			}
+			sum.Scalar[name] += q
+		}
+	}
+
+	return sum
+}
+
+// scoringRequest is the JSON body sent to external scorers.
+type scoringRequest struct {
+	Features []ScoringFeatures `json:"features"`
+}
+
+// scoringResponse is the JSON body returned from external scorers.
+type scoringResponse struct {
+	Scores []float64 `json:"scores"`
+}
+
+// ExecScorer is a Scorer that runs an external command for each scoring, e.g., a script that
+// evaluates an ONNX model.
+// The command reads {"features": [ScoringFeatures...]} in JSON from its standard input, and writes
+// {"scores": [float...]} in JSON to its standard output.
+type ExecScorer struct {
+	// Command is the command line to run.
+	Command []string
+}
+
+// Score implements Scorer interface.
+func (s *ExecScorer) Score(ctx context.Context, features []ScoringFeatures) ([]float64, error) {
+	if len(s.Command) == 0 {
+		return nil, fmt.Errorf("ExecScorer has no command")
+	}
+
+	req, err := json.Marshal(scoringRequest{Features: features})
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...) // nolint: gosec
+	cmd.Stdin = bytes.NewReader(req)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Error running scorer %v: %s: %s", s.Command, err.Error(), stderr.String())
+	}
+
+	var resp scoringResponse
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, fmt.Errorf("Error parsing output of scorer %v: %s", s.Command, err.Error())
+	}
+
+	return resp.Scores, nil
+}
+
+// HTTPScorer is a Scorer that asks an external service, e.g., a model server.
+// It POSTs {"features": [ScoringFeatures...]} in JSON to URL, which responds {"scores": [float...]}
+// in JSON.
+type HTTPScorer struct {
+	URL string
+	// Client is the HTTP client used for the requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Score implements Scorer interface.
+func (s *HTTPScorer) Score(ctx context.Context, features []ScoringFeatures) ([]float64, error) {
+	req, err := json.Marshal(scoringRequest{Features: features})
+	if err != nil {
+		return nil, err
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := client.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Scorer %s responded %s", s.URL, httpResp.Status)
+	}
+
+	var resp scoringResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("Error parsing response of scorer %s: %s", s.URL, err.Error())
+	}
+
+	return resp.Scores, nil
+}
+
+var _ = Scorer(&ExecScorer{})
+var _ = Scorer(&HTTPScorer{})
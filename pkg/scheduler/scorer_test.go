@@ -0,0 +1,136 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+	"k8s.io/kubernetes/pkg/scheduler/api"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/queue"
+)
+
+// emptiestNodeScorer prefers the node with the most free memory.
+type emptiestNodeScorer struct {
+	features []ScoringFeatures
+}
+
+func (s *emptiestNodeScorer) Score(_ context.Context, features []ScoringFeatures) ([]float64, error) {
+	s.features = features
+	scores := make([]float64, 0, len(features))
+	for _, f := range features {
+		scores = append(scores, float64(f.Node.Allocatable.Memory-f.Node.Requested.Memory))
+	}
+	return scores, nil
+}
+
+func TestGenericSchedulerWithScorer(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	nodes := []*v1.Node{
+		newTestNode("node-0", "4", "4Gi"),
+		newTestNode("node-1", "4", "8Gi"),
+	}
+
+	scorer := &emptiestNodeScorer{}
+	sched := NewGenericScheduler(false)
+	sched.AddPredicate("PodFitsResources", predicates.PodFitsResources)
+	sched.AddPrioritizer(NewScorerPrioritizer("Learned", scorer, 1))
+
+	q := queue.NewFIFOQueue()
+	_ = q.Push(newTestPod("pod", "1", "1Gi", now))
+
+	events, err := sched.Schedule(ctx, clock.NewClock(now), q, fakeNodeLister(nodes), newTestNodeInfoMap(t, nodes))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"pod": "node-1"}, boundNodes(events))
+
+	assert.Len(t, scorer.features, 2)
+	f := scorer.features[0]
+	assert.Equal(t, "pod", f.Pod.Name)
+	assert.Equal(t, int64(1000), f.Pod.Request.MilliCPU)
+	assert.Equal(t, 2, f.Cluster.NodesNum)
+	assert.Equal(t, int64(8000), f.Cluster.Allocatable.MilliCPU)
+}
+
+// fixedScorer returns its scores regardless of the features.
+type fixedScorer []float64
+
+func (s fixedScorer) Score(_ context.Context, _ []ScoringFeatures) ([]float64, error) {
+	return s, nil
+}
+
+func TestScorerPrioritizerNonFiniteScores(t *testing.T) {
+	nodes := []*v1.Node{
+		newTestNode("node-0", "4", "4Gi"),
+		newTestNode("node-1", "4", "8Gi"),
+	}
+	pod := newTestPod("pod", "1", "1Gi", time.Now())
+
+	for _, tc := range []struct {
+		scores fixedScorer
+		err    string
+	}{
+		{fixedScorer{1, math.NaN()}, "Scorer returned non-finite score NaN for node node-1"},
+		{fixedScorer{math.Inf(1), 1}, "Scorer returned non-finite score +Inf for node node-0"},
+		{fixedScorer{1, math.Inf(-1)}, "Scorer returned non-finite score -Inf for node node-1"},
+		{fixedScorer{-math.MaxFloat64, math.MaxFloat64},
+			"Scorer returned scores from -1.7976931348623157e+308 to 1.7976931348623157e+308, too far apart to normalize"},
+	} {
+		result := api.HostPriorityList{{Host: "node-0"}, {Host: "node-1"}}
+		prio := NewScorerPrioritizer("Learned", tc.scores, 1)
+		err := prio.Reduce(pod, nil, newTestNodeInfoMap(t, nodes), result)
+		assert.EqualError(t, err, tc.err)
+	}
+}
+
+func TestExternalScorers(t *testing.T) {
+	ctx := context.Background()
+	features := []ScoringFeatures{{Node: NodeFeatures{Name: "node-0"}}, {Node: NodeFeatures{Name: "node-1"}}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req scoringRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, features, req.Features)
+		_ = json.NewEncoder(w).Encode(scoringResponse{Scores: []float64{0.5, 1.5}})
+	}))
+	defer server.Close()
+
+	scores, err := (&HTTPScorer{URL: server.URL}).Score(ctx, features)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0.5, 1.5}, scores)
+
+	exec := &ExecScorer{Command: []string{"sh", "-c", `cat > /dev/null; echo '{"scores": [2, 1]}'`}}
+	scores, err = exec.Score(ctx, features)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{2, 1}, scores)
+
+	// A canceled context aborts the scoring.
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = (&HTTPScorer{URL: server.URL}).Score(canceled, features)
+	assert.Error(t, err)
+	_, err = exec.Score(canceled, features)
+	assert.Error(t, err)
+}
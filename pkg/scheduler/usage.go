@@ -0,0 +1,158 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/priorities"
+	"k8s.io/kubernetes/pkg/scheduler/api"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/node"
+	"simulator/pkg/util"
+)
+
+// UsageFitPred is the name of the predicate that fails if the actual resource usage of a node plus
+// the requests of a pod exceeds its capacity (see PodFitsUsage).
+const UsageFitPred = "UsageFit"
+
+// usageResources are the resources whose actual usage is considered by the usage-based plugins.
+var usageResources = []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory}
+
+// PodFitsUsage is a predicate that checks whether the cpu and memory requests of the pod fit in the
+// capacity of the node minus the actual usage of the pods on it, given by node.UsageAnnotation,
+// instead of the requests of the pods as predicates.PodFitsResources does.
+// Combined with overcommitted allocatable resources, pods are packed by the real utilization while
+// the requests are still bounded by the allocatable resources.
+// A node without the annotation is treated as if the pods on it used as much as requested.
+func PodFitsUsage(
+	pod *v1.Pod, meta predicates.PredicateMetadata, nodeInfo *nodeinfo.NodeInfo,
+) (bool, []predicates.PredicateFailureReason, error) {
+	v1Node := nodeInfo.Node()
+	if v1Node == nil {
+		return false, nil, fmt.Errorf("node not found")
+	}
+
+	request := util.PodTotalResourceRequests(pod)
+	usage := nodeUsage(nodeInfo)
+
+	var failures []predicates.PredicateFailureReason
+	for _, rsrc := range usageResources {
+		req, used, capacity := request[rsrc], usage[rsrc], v1Node.Status.Capacity[rsrc]
+		if req.IsZero() {
+			continue
+		}
+		total := used.DeepCopy()
+		total.Add(req)
+		if total.Cmp(capacity) > 0 {
+			failures = append(failures, newInsufficientUsageError(rsrc, req, used, capacity))
+		}
+	}
+
+	return len(failures) == 0, failures, nil
+}
+
+// NewUsagePrioritizer creates a prioritizer plugin that scores nodes by their actual utilization
+// after placing a pod, i.e., the usage given by node.UsageAnnotation plus the requests of the pod
+// relative to the capacity, averaged over cpu and memory.
+// If mostUsed is true, it favors the most utilized nodes to pack pods ("MostUsed"); otherwise the
+// least utilized ones to spread them ("LeastUsed"), like MostRequested and LeastRequested of
+// kube-scheduler do with the requests.
+func NewUsagePrioritizer(weight int, mostUsed bool) priorities.PriorityConfig {
+	name := "LeastUsed"
+	if mostUsed {
+		name = "MostUsed"
+	}
+
+	return priorities.PriorityConfig{
+		Name: name,
+		Map: func(pod *v1.Pod, meta interface{}, nodeInfo *nodeinfo.NodeInfo) (api.HostPriority, error) {
+			v1Node := nodeInfo.Node()
+			if v1Node == nil {
+				return api.HostPriority{}, fmt.Errorf("node not found")
+			}
+
+			utilization := usageUtilization(util.PodTotalResourceRequests(pod), nodeUsage(nodeInfo),
+				v1Node.Status.Capacity)
+			if !mostUsed {
+				utilization = 1 - utilization
+			}
+
+			return api.HostPriority{
+				Host:  v1Node.Name,
+				Score: int(utilization * float64(api.MaxPriority)),
+			}, nil
+		},
+		Reduce: nil,
+		Weight: weight,
+	}
+}
+
+// nodeUsage returns the actual resource usage of the node, or the total requests of the pods on it
+// if it does not have node.UsageAnnotation.
+func nodeUsage(nodeInfo *nodeinfo.NodeInfo) v1.ResourceList {
+	if usage, ok := node.ResourceUsageOf(nodeInfo.Node()); ok {
+		return usage
+	}
+
+	usage := v1.ResourceList{}
+	for _, p := range nodeInfo.Pods() {
+		usage = util.ResourceListSum(usage, util.PodTotalResourceRequests(p))
+	}
+	return usage
+}
+
+// usageUtilization returns the mean of the fractions of the capacity of cpu and memory used by the
+// usage plus the request, each clamped to [0, 1].
+// A resource of zero capacity counts as fully utilized.
+func usageUtilization(request, usage, capacity v1.ResourceList) float64 {
+	sum := 0.0
+	for _, rsrc := range usageResources {
+		req, used, capa := request[rsrc], usage[rsrc], capacity[rsrc]
+		if capa.IsZero() {
+			sum++
+			continue
+		}
+
+		var fraction float64
+		if rsrc == v1.ResourceCPU {
+			fraction = float64(used.MilliValue()+req.MilliValue()) / float64(capa.MilliValue())
+		} else {
+			fraction = float64(used.Value()+req.Value()) / float64(capa.Value())
+		}
+		if fraction > 1 {
+			fraction = 1
+		}
+		sum += fraction
+	}
+
+	return sum / float64(len(usageResources))
+}
+
+// newInsufficientUsageError returns the failure reason of PodFitsUsage for the resource, in milli
+// units for cpu as predicates.PodFitsResources does.
+func newInsufficientUsageError(
+	rsrc v1.ResourceName, req, used, capacity resource.Quantity,
+) *predicates.InsufficientResourceError {
+	if rsrc == v1.ResourceCPU {
+		return predicates.NewInsufficientResourceError(
+			rsrc, req.MilliValue(), used.MilliValue(), capacity.MilliValue())
+	}
+	return predicates.NewInsufficientResourceError(rsrc, req.Value(), used.Value(), capacity.Value())
+}
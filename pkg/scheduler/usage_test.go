@@ -0,0 +1,76 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+	"k8s.io/kubernetes/pkg/scheduler/api"
+
+	"simulator/pkg/node"
+)
+
+func TestUsagePlugins(t *testing.T) {
+	now := time.Now()
+	nodes := []*v1.Node{
+		newTestNode("node-0", "4", "8Gi"),
+		newTestNode("node-1", "4", "8Gi"),
+		newTestNode("node-2", "4", "8Gi"),
+	}
+	// node-0 is heavily used, node-1 lightly, and node-2 has no annotation.
+	nodes[0].Annotations = map[string]string{node.UsageAnnotation: `{"cpu":"3","memory":"6Gi"}`}
+	nodes[1].Annotations = map[string]string{node.UsageAnnotation: `{"cpu":"1","memory":"2Gi"}`}
+	infoMap := newTestNodeInfoMap(t, nodes)
+	// The requests of the pods on node-1 exceed its usage, and are used on node-2.
+	infoMap["node-1"].AddPod(newTestPod("running-0", "3", "6Gi", now))
+	infoMap["node-2"].AddPod(newTestPod("running-1", "2", "4Gi", now))
+
+	pod := newTestPod("pod", "2", "2Gi", now)
+
+	fits, reasons, err := PodFitsUsage(pod, nil, infoMap["node-0"])
+	assert.NoError(t, err)
+	assert.False(t, fits)
+	assert.Equal(t, []predicates.PredicateFailureReason{
+		predicates.NewInsufficientResourceError(v1.ResourceCPU, 2000, 3000, 4000),
+	}, reasons)
+
+	fits, _, err = PodFitsUsage(pod, nil, infoMap["node-1"])
+	assert.NoError(t, err)
+	assert.True(t, fits)
+
+	fits, _, err = PodFitsUsage(newTestPod("large", "3", "1Gi", now), nil, infoMap["node-2"])
+	assert.NoError(t, err)
+	assert.False(t, fits)
+
+	// The utilization after placing the pod: node-0: (5/4 -> 1 + 1) / 2, node-1: (3/4 + 4/8) / 2,
+	// node-2: (4/4 + 6/8) / 2
+	least, most := NewUsagePrioritizer(1, false), NewUsagePrioritizer(2, true)
+	assert.Equal(t, "LeastUsed", least.Name)
+	assert.Equal(t, "MostUsed", most.Name)
+	assert.Equal(t, 2, most.Weight)
+	for i, expected := range []struct{ least, most int }{{0, 10}, {3, 6}, {1, 8}} {
+		score, err := least.Map(pod, nil, infoMap[nodes[i].Name])
+		assert.NoError(t, err)
+		assert.Equal(t, api.HostPriority{Host: nodes[i].Name, Score: expected.least}, score)
+
+		score, err = most.Map(pod, nil, infoMap[nodes[i].Name])
+		assert.NoError(t, err)
+		assert.Equal(t, api.HostPriority{Host: nodes[i].Name, Score: expected.most}, score)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/queue"
+)
+
+// WorstFitScheduler makes scheduling decisions for all pending pods at once in the worst-fit
+// (maximum-spread) manner.
+// At each clock, it pops all pods from the queue and places each of them, in the order of the
+// queue, onto the feasible node that leaves the most resources after the placement, i.e., the
+// least-utilized one.
+// Pods that do not fit in any node are pushed back to the queue.
+//
+// WorstFitScheduler shares the resource accounting and the predicates with BinPackingScheduler, so
+// that the results of the two policies are directly comparable.
+type WorstFitScheduler struct {
+	predicates map[string]predicates.FitPredicate
+}
+
+// NewWorstFitScheduler creates a new WorstFitScheduler.
+func NewWorstFitScheduler() WorstFitScheduler {
+	return WorstFitScheduler{
+		predicates: map[string]predicates.FitPredicate{},
+	}
+}
+
+// AddPredicate adds a predicate plugin to this WorstFitScheduler.
+// The resource fitness of pods is always checked, regardless of registered predicates.
+func (sched *WorstFitScheduler) AddPredicate(name string, predicate predicates.FitPredicate) {
+	sched.predicates[name] = predicate
+}
+
+// Schedule implements Scheduler interface.
+func (sched *WorstFitScheduler) Schedule(
+	ctx context.Context,
+	clock clock.Clock,
+	pendingPods queue.PodQueue,
+	nodeLister algorithm.NodeLister,
+	nodeInfoMap map[string]*nodeinfo.NodeInfo) ([]Event, error) {
+
+	return scheduleByFit(ctx, clock, pendingPods, nodeLister, nodeInfoMap, sched.predicates, worstFit, false)
+}
+
+var _ = Scheduler(&WorstFitScheduler{})
+
+// worstFit prefers the node that will have the most remaining resources.
+func worstFit(rem0, rem1 float64) bool { return rem0 > rem1 }
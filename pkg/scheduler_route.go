@@ -0,0 +1,72 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubesim
+
+import (
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
+)
+
+// schedulerQueue is a scheduler with the queue of the pods it schedules.
+type schedulerQueue struct {
+	scheduler scheduler.Scheduler
+	queue     queue.PodQueue
+}
+
+// AddScheduler adds the scheduler that schedules the pods whose spec.schedulerName is the name from
+// the queue of its own, alongside the active scheduler, which schedules the pods of the other names
+// from the queue of this KubeSim.
+// At each tick, the active scheduler runs first, then the added ones in the order of their names,
+// each seeing the pods bound by the previous ones on the shared nodes.
+// Only the active scheduler reports its metrics.
+// It must be called before Run and RestoreCheckpoint, while no pod is pending.
+// The scheduler draws its random numbers from the generator of this KubeSim if it implements
+// scheduler.Randomized.
+func (k *KubeSim) AddScheduler(schedulerName string, sched scheduler.Scheduler, podQueue queue.PodQueue) {
+	if k.routing == nil {
+		k.routing = queue.NewRoutingQueue(k.pendingPods)
+		k.pendingPods = k.routing
+	}
+
+	k.routing.AddRoute(schedulerName, podQueue)
+	k.routed[schedulerName] = sched
+	k.randomize(sched)
+}
+
+// schedulerQueues returns the active scheduler with the default queue, then the schedulers added by
+// AddScheduler with their queues in the order of their names.
+func (k *KubeSim) schedulerQueues() []schedulerQueue {
+	if k.routing == nil {
+		return []schedulerQueue{{scheduler: k.scheduler, queue: k.pendingPods}}
+	}
+
+	sqs := []schedulerQueue{{scheduler: k.scheduler, queue: k.routing.Default()}}
+	for _, name := range k.routing.Names() {
+		sqs = append(sqs, schedulerQueue{scheduler: k.routed[name], queue: k.routing.Route(name)})
+	}
+
+	return sqs
+}
+
+// routedName returns the schedulerName of the pod if routed to a scheduler added by AddScheduler,
+// or empty if scheduled by the active scheduler.
+func (k *KubeSim) routedName(v1Pod *v1.Pod) string {
+	if _, ok := k.routed[v1Pod.Spec.SchedulerName]; ok {
+		return v1Pod.Spec.SchedulerName
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubesim
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
+)
+
+// listingScheduler records the names of the pods in the queue given to the inner scheduler.
+type listingScheduler struct {
+	inner  scheduler.Scheduler
+	listed []string
+}
+
+func (s *listingScheduler) Schedule(
+	ctx context.Context,
+	clock clock.Clock,
+	pendingPods queue.PodQueue,
+	nodeLister algorithm.NodeLister,
+	nodeInfoMap map[string]*nodeinfo.NodeInfo) ([]scheduler.Event, error) {
+
+	for _, pod := range pendingPods.(queue.Lister).List() {
+		s.listed = append(s.listed, pod.Name)
+	}
+	return s.inner.Schedule(ctx, clock, pendingPods, nodeLister, nodeInfoMap)
+}
+
+func TestKubeSimAddScheduler(t *testing.T) {
+	binPacking := scheduler.NewBinPackingScheduler()
+	worstFit := scheduler.NewWorstFitScheduler()
+	active := &listingScheduler{inner: &binPacking}
+	routed := &listingScheduler{inner: &worstFit}
+
+	k, err := NewKubeSim(WithConfig(newCheckpointConfig(10)), WithQueue(queue.NewFIFOQueue()),
+		WithScheduler(active))
+	assert.NoError(t, err)
+	k.AddScheduler("worst-fit-scheduler", routed, queue.NewFIFOQueue())
+
+	for _, name := range []string{"pod-0", "pod-1", "pod-2"} {
+		pod := newCheckpointPod(name)
+		if name != "pod-0" {
+			pod.Spec.SchedulerName = "worst-fit-scheduler"
+		}
+		assert.NoError(t, k.pendingPods.Push(pod))
+	}
+	assert.Equal(t, 3, k.pendingPods.Metrics().PendingPodsNum)
+
+	// The node of 2 cpus fits pod-0 of the active scheduler, then pod-1 of the routed one.
+	assert.NoError(t, k.schedule(context.Background()))
+	assert.Equal(t, []string{"pod-0"}, active.listed)
+	assert.Equal(t, []string{"pod-1", "pod-2"}, routed.listed)
+
+	assert.Contains(t, k.boundPods, "default/pod-0")
+	assert.Contains(t, k.boundPods, "default/pod-1")
+	assert.Equal(t, 0, k.routing.Default().Metrics().PendingPodsNum)
+	pending := k.routing.Route("worst-fit-scheduler").(queue.Lister).List()
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "pod-2", pending[0].Name)
+}
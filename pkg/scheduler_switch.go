@@ -0,0 +1,208 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubesim
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/config"
+	"simulator/pkg/scheduler"
+)
+
+// DefaultSchedulerName is the name of the scheduler given to NewKubeSim.
+const DefaultSchedulerName = "default"
+
+// KubeSchedulerConfigName is the name of the scheduler built from the schedulerConfig of the config
+// if NewKubeSim is given another scheduler.
+const KubeSchedulerConfigName = "kube-scheduler"
+
+// schedulerSwitcher manages the named schedulers of a KubeSim and the switches between them.
+type schedulerSwitcher struct {
+	schedulers map[string]scheduler.Scheduler
+	active     string
+
+	// timed switches sorted by their clocks
+	timed []schedulerSwitch
+
+	// requested is the scheduler requested by SwitchScheduler, or empty.
+	requested string
+	mu        sync.Mutex
+}
+
+type schedulerSwitch struct {
+	at   clock.Clock
+	name string
+}
+
+func newSchedulerSwitcher(sched scheduler.Scheduler) *schedulerSwitcher {
+	return &schedulerSwitcher{
+		schedulers: map[string]scheduler.Scheduler{DefaultSchedulerName: sched},
+		active:     DefaultSchedulerName,
+	}
+}
+
+// RegisterScheduler registers the scheduler with the name, so that this KubeSim can switch to it
+// during the simulation.
+// The scheduler draws its random numbers from the generator of this KubeSim if it implements
+// scheduler.Randomized.
+func (k *KubeSim) RegisterScheduler(name string, sched scheduler.Scheduler) {
+	k.switcher.mu.Lock()
+	defer k.switcher.mu.Unlock()
+
+	k.switcher.schedulers[name] = sched
+	k.randomize(sched)
+}
+
+// randomize makes the scheduler draw its random numbers from the generator of this KubeSim, if it
+// implements scheduler.Randomized.
+func (k *KubeSim) randomize(sched scheduler.Scheduler) {
+	if r, ok := sched.(scheduler.Randomized); ok {
+		r.SetRand(k.rand)
+	}
+}
+
+// SwitchScheduler switches the active scheduler to the one registered with the name, without
+// restarting the simulation.
+// The switch takes effect at the scheduling of the next tick.
+// This method can be called from other goroutines while Run is executing, e.g., from a control API.
+// Returns error if no scheduler is registered with the name.
+func (k *KubeSim) SwitchScheduler(name string) error {
+	k.switcher.mu.Lock()
+	defer k.switcher.mu.Unlock()
+
+	if _, ok := k.switcher.schedulers[name]; !ok {
+		return strongerrors.NotFound(errors.Errorf("scheduler %q not registered", name))
+	}
+	k.switcher.requested = name
+
+	return nil
+}
+
+// AddSchedulerSwitch makes this KubeSim switch the active scheduler to the one registered with the
+// name at the given clock.
+func (k *KubeSim) AddSchedulerSwitch(at clock.Clock, name string) {
+	k.switcher.mu.Lock()
+	defer k.switcher.mu.Unlock()
+
+	k.switcher.timed = append(k.switcher.timed, schedulerSwitch{at: at, name: name})
+	sort.SliceStable(k.switcher.timed, func(i, j int) bool {
+		return k.switcher.timed[i].at.Before(k.switcher.timed[j].at)
+	})
+}
+
+// ActiveSchedulerName returns the name of the active scheduler.
+func (k *KubeSim) ActiveSchedulerName() string {
+	k.switcher.mu.Lock()
+	defer k.switcher.mu.Unlock()
+
+	return k.switcher.active
+}
+
+// activeName returns the name of the active scheduler, and whether multiple schedulers are
+// registered.
+func (s *schedulerSwitcher) activeName() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.active, len(s.schedulers) > 1
+}
+
+// switchScheduler switches the active scheduler if a switch is due at the current clock, or has been
+// requested.
+// The pods held by the old scheduler (see scheduler.Drainer) are pushed back to the queue.
+func (k *KubeSim) switchScheduler() error {
+	k.switcher.mu.Lock()
+	defer k.switcher.mu.Unlock()
+
+	name := ""
+	for len(k.switcher.timed) > 0 && !k.clock.Before(k.switcher.timed[0].at) {
+		name = k.switcher.timed[0].name
+		k.switcher.timed = k.switcher.timed[1:]
+	}
+	if k.switcher.requested != "" {
+		name = k.switcher.requested
+		k.switcher.requested = ""
+	}
+	if name == "" || name == k.switcher.active {
+		return nil
+	}
+
+	sched, ok := k.switcher.schedulers[name]
+	if !ok {
+		return strongerrors.NotFound(errors.Errorf("scheduler %q not registered", name))
+	}
+
+	if drainer, ok := k.scheduler.(scheduler.Drainer); ok {
+		for _, pod := range drainer.Drain() {
+			if err := k.pendingPods.Push(pod); err != nil {
+				return err
+			}
+		}
+	}
+
+	log.L.Infof("Switch scheduler from %s to %s at %s", k.switcher.active, name, k.clock.ToRFC3339())
+	k.scheduler = sched
+	k.switcher.active = name
+
+	return nil
+}
+
+// restore makes the scheduler with the name active, and drops the timed switches at or before the
+// clock, which have been consumed before a checkpoint.
+func (s *schedulerSwitcher) restore(active string, consumedUntil clock.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active = active
+	for len(s.timed) > 0 && !consumedUntil.Before(s.timed[0].at) {
+		s.timed = s.timed[1:]
+	}
+}
+
+// buildScheduler builds the scheduler from the schedulerConfig of the config, or returns nil if not
+// configured.
+func buildScheduler(conf *config.Config) (scheduler.Scheduler, error) {
+	if conf.SchedulerConfig == "" {
+		return nil, nil
+	}
+
+	sched, err := scheduler.ReadKubeSchedulerConfiguration(conf.SchedulerConfig)
+	if err != nil {
+		return nil, err
+	}
+	log.L.Infof("Scheduler built from %s", conf.SchedulerConfig)
+
+	return sched, nil
+}
+
+func buildSchedulerSwitches(k *KubeSim, conf *config.Config) error {
+	for _, switchConf := range conf.SchedulerSwitches {
+		at, err := time.Parse(time.RFC3339, switchConf.At)
+		if err != nil {
+			return strongerrors.InvalidArgument(
+				errors.Errorf("invalid clock of scheduler switch %q: %s", switchConf.At, err.Error()))
+		}
+		k.AddSchedulerSwitch(clock.NewClock(at), switchConf.Scheduler)
+	}
+
+	return nil
+}
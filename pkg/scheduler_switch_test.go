@@ -0,0 +1,71 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubesim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"simulator/pkg/config"
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
+)
+
+func TestKubeSimSwitchScheduler(t *testing.T) {
+	start := "2019-01-01T00:00:00Z"
+	conf := &config.Config{
+		LogLevel:   "info",
+		Tick:       10,
+		StartClock: start,
+		SchedulerSwitches: []config.SchedulerSwitchConfig{
+			{At: "2019-01-01T00:01:00Z", Scheduler: "worst-fit"},
+		},
+	}
+
+	generic := scheduler.NewGenericScheduler(false)
+	k, err := NewKubeSim(WithConfig(conf), WithQueue(queue.NewFIFOQueue()), WithScheduler(&generic))
+	assert.NoError(t, err)
+
+	worstFit := scheduler.NewWorstFitScheduler()
+	binPacking := scheduler.NewBinPackingScheduler()
+	k.RegisterScheduler("worst-fit", &worstFit)
+	k.RegisterScheduler("bin-packing", &binPacking)
+
+	assert.Error(t, k.SwitchScheduler("unknown"))
+
+	// Before the timed switch
+	k.clock = k.clock.Add(50 * time.Second)
+	assert.NoError(t, k.schedule(context.Background()))
+	assert.Equal(t, DefaultSchedulerName, k.ActiveSchedulerName())
+
+	// At the timed switch
+	k.clock = k.clock.Add(10 * time.Second)
+	assert.NoError(t, k.schedule(context.Background()))
+	assert.Equal(t, "worst-fit", k.ActiveSchedulerName())
+	assert.Equal(t, &worstFit, k.scheduler)
+
+	// Requested switch
+	assert.NoError(t, k.SwitchScheduler("bin-packing"))
+	assert.Equal(t, "worst-fit", k.ActiveSchedulerName())
+	assert.NoError(t, k.schedule(context.Background()))
+	assert.Equal(t, "bin-packing", k.ActiveSchedulerName())
+
+	met, err := k.buildMetrics()
+	assert.NoError(t, err)
+	assert.Equal(t, "bin-packing", met["ActiveScheduler"])
+}
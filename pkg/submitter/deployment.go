@@ -0,0 +1,450 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package submitter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/metrics"
+	"simulator/pkg/pod"
+	"simulator/pkg/util"
+)
+
+// DeploymentUpdate is a change of the pod template of a Deployment at a clock, which starts a
+// rollout of a new revision.
+type DeploymentUpdate struct {
+	At       clock.Clock
+	Template v1.PodTemplateSpec
+}
+
+// Rollout is a rollout of a revision of a Deployment.
+type Rollout struct {
+	// Revision is the revision rolled out, starting from 1 for the initial pod template.
+	Revision  int
+	StartedAt clock.Clock
+	// CompletedAt is the clock at which all the replicas are available pods of this revision and no
+	// pods of the older revisions remain, or nil if not completed (e.g., superseded by the next
+	// update).
+	CompletedAt *clock.Clock
+	// MaxPods is the largest number of the pods of the Deployment (pending, running, or terminating)
+	// during the rollout.
+	MaxPods int
+	// MinAvailable is the smallest number of the available pods of the Deployment during the
+	// rollout.
+	MinAvailable int
+	// MaxResourceRequest is the largest total resource request of the pods of the Deployment bound
+	// to nodes during the rollout, i.e., the capacity headroom that the rollout requires.
+	MaxResourceRequest v1.ResourceList
+}
+
+// Duration returns the duration of this Rollout, or 0 if not completed.
+func (r Rollout) Duration() time.Duration {
+	if r.CompletedAt == nil {
+		return 0
+	}
+	return r.CompletedAt.Sub(r.StartedAt)
+}
+
+// DeploymentSubmitter is a submitter that keeps the replicas of a Deployment like the deployment
+// and the replicaset controllers, and rolls out the updates of its pod template with its
+// RollingUpdate (maxSurge and maxUnavailable) or Recreate strategy.
+// A pod is available once it has started its execution after the startup latency; the pods that
+// finish or are evicted are replaced.
+// It terminates when the rollout of the last update completes.
+type DeploymentSubmitter struct {
+	name           string
+	namespace      string
+	replicas       int
+	recreate       bool
+	maxSurge       int
+	maxUnavailable int
+
+	updates  []DeploymentUpdate
+	template v1.PodTemplateSpec
+	revision int
+	rollouts []Rollout
+
+	// pods are the pods of the Deployment that may still exist, keyed by their keys.
+	pods map[string]*deploymentPod
+	seq  int
+}
+
+type deploymentPod struct {
+	revision int
+	seq      int
+	// bound is whether the pod has been observed bound to a node.
+	bound bool
+	// deletedAt is the clock at which the pod is deleted, or nil if not deleted.
+	deletedAt   *clock.Clock
+	gracePeriod time.Duration
+}
+
+// NewDeploymentSubmitter creates a new DeploymentSubmitter of the deployment, whose pod template is
+// changed by the updates at their clocks.
+// The replicas default to 1, and the strategy to RollingUpdate with maxSurge and maxUnavailable
+// 25%, as in Kubernetes.
+// Returns error if the strategy is invalid.
+func NewDeploymentSubmitter(
+	deployment *appsv1.Deployment, updates []DeploymentUpdate) (*DeploymentSubmitter, error) {
+
+	if deployment.Name == "" {
+		return nil, strongerrors.InvalidArgument(errors.New("name of a deployment must not be empty"))
+	}
+	namespace := deployment.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	replicas := 1
+	if deployment.Spec.Replicas != nil {
+		replicas = int(*deployment.Spec.Replicas)
+	}
+	if replicas < 0 {
+		return nil, strongerrors.InvalidArgument(
+			errors.Errorf("invalid replicas %d of deployment %s", replicas, deployment.Name))
+	}
+
+	subm := &DeploymentSubmitter{
+		name:      deployment.Name,
+		namespace: namespace,
+		replicas:  replicas,
+		updates:   append([]DeploymentUpdate{}, updates...),
+		template:  deployment.Spec.Template,
+		pods:      map[string]*deploymentPod{},
+	}
+	sort.SliceStable(subm.updates, func(i, j int) bool {
+		return subm.updates[i].At.Before(subm.updates[j].At)
+	})
+
+	strategy := deployment.Spec.Strategy
+	switch strategy.Type {
+	case appsv1.RecreateDeploymentStrategyType:
+		subm.recreate = true
+	case "", appsv1.RollingUpdateDeploymentStrategyType:
+		defaultValue := intstr.FromString("25%")
+		maxSurge, maxUnavailable := &defaultValue, &defaultValue
+		if strategy.RollingUpdate != nil {
+			if strategy.RollingUpdate.MaxSurge != nil {
+				maxSurge = strategy.RollingUpdate.MaxSurge
+			}
+			if strategy.RollingUpdate.MaxUnavailable != nil {
+				maxUnavailable = strategy.RollingUpdate.MaxUnavailable
+			}
+		}
+
+		var err error
+		if subm.maxSurge, err = intstr.GetValueFromIntOrPercent(maxSurge, replicas, true); err != nil {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("invalid maxSurge of deployment %s: %s", deployment.Name, err.Error()))
+		}
+		if subm.maxUnavailable, err = intstr.GetValueFromIntOrPercent(maxUnavailable, replicas, false); err != nil {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("invalid maxUnavailable of deployment %s: %s", deployment.Name, err.Error()))
+		}
+		if subm.maxSurge < 0 || subm.maxUnavailable < 0 {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("maxSurge and maxUnavailable of deployment %s must not be negative", deployment.Name))
+		}
+		if subm.maxSurge == 0 && subm.maxUnavailable == 0 {
+			// The deployment controller also proceeds in this case.
+			subm.maxUnavailable = 1
+		}
+		if subm.maxUnavailable > replicas {
+			subm.maxUnavailable = replicas
+		}
+	default:
+		return nil, strongerrors.InvalidArgument(
+			errors.Errorf("deployment strategy type %q is not supported", strategy.Type))
+	}
+
+	return subm, nil
+}
+
+// Rollouts returns the rollouts of the revisions started so far, in the order of the revisions.
+func (s *DeploymentSubmitter) Rollouts() []Rollout {
+	return s.rollouts
+}
+
+// deploymentCounts are the numbers of the pods of a Deployment observed at a clock.
+type deploymentCounts struct {
+	// newAlive and oldAlive are the numbers of the pending or running pods of the current revision
+	// and of the older revisions, respectively.
+	newAlive int
+	oldAlive int
+	// newAvailable and oldAvailable are the numbers of the available ones of them.
+	newAvailable int
+	oldAvailable int
+	// terminating and oldTerminating are the numbers of the deleted pods in their grace periods,
+	// of all the revisions and of the older revisions, respectively.
+	terminating    int
+	oldTerminating int
+	// oldUnavailablePods and oldAvailablePods are the pending or running pods of the older revisions,
+	// in the order of deletion.
+	oldUnavailablePods []*deploymentPod
+	oldAvailablePods   []*deploymentPod
+	resourceRequest    v1.ResourceList
+}
+
+// Submit submits and deletes the pods of the Deployment to keep its replicas and roll out its
+// updates.
+func (s *DeploymentSubmitter) Submit(
+	_ context.Context,
+	clk clock.Clock,
+	_ algorithm.NodeLister,
+	met metrics.Metrics) ([]Event, error) {
+
+	if s.revision == 0 {
+		s.startRollout(clk, s.template)
+	}
+	for len(s.updates) > 0 && !clk.Before(s.updates[0].At) {
+		s.startRollout(clk, s.updates[0].Template)
+		s.updates = s.updates[1:]
+	}
+
+	podsMetrics, _ := met[metrics.PodsMetricsKey].(map[string]pod.Metrics)
+	counts := s.observe(clk, podsMetrics)
+
+	rollout := &s.rollouts[len(s.rollouts)-1]
+	if rollout.CompletedAt == nil {
+		s.recordRollout(clk, rollout, counts)
+	}
+	if rollout.CompletedAt != nil && len(s.updates) == 0 && counts.newAlive == s.replicas {
+		return []Event{&TerminateSubmitterEvent{}}, nil
+	}
+
+	events := []Event{}
+	if s.recreate {
+		if counts.oldAlive > 0 || counts.oldTerminating > 0 {
+			for _, p := range append(counts.oldUnavailablePods, counts.oldAvailablePods...) {
+				events = append(events, s.deletePod(clk, p))
+			}
+			return events, nil
+		}
+		return s.createPods(s.replicas - counts.newAlive), nil
+	}
+
+	toCreate := s.replicas - counts.newAlive
+	if surge := s.replicas + s.maxSurge - counts.newAlive - counts.oldAlive; surge < toCreate {
+		toCreate = surge
+	}
+	if toCreate > 0 {
+		// The deployment controller scales down the old pods in the next sync after scaling up.
+		return s.createPods(toCreate), nil
+	}
+
+	minAvailable := s.replicas - s.maxUnavailable
+	newUnavailable := counts.newAlive - counts.newAvailable
+	maxScaledDown := counts.newAlive + counts.oldAlive - minAvailable - newUnavailable
+	// The unavailable old pods are deleted first, which does not decrease the available pods.
+	for _, p := range counts.oldUnavailablePods {
+		if maxScaledDown <= 0 {
+			break
+		}
+		events = append(events, s.deletePod(clk, p))
+		maxScaledDown--
+	}
+	scaleDown := counts.newAvailable + counts.oldAvailable - minAvailable
+	for _, p := range counts.oldAvailablePods {
+		if maxScaledDown <= 0 || scaleDown <= 0 {
+			break
+		}
+		events = append(events, s.deletePod(clk, p))
+		maxScaledDown--
+		scaleDown--
+	}
+
+	return events, nil
+}
+
+// startRollout starts the rollout of a new revision of the template at the clock.
+func (s *DeploymentSubmitter) startRollout(clk clock.Clock, template v1.PodTemplateSpec) {
+	s.revision++
+	s.template = template
+	s.rollouts = append(s.rollouts, Rollout{
+		Revision:           s.revision,
+		StartedAt:          clk,
+		MinAvailable:       math.MaxInt32,
+		MaxResourceRequest: v1.ResourceList{},
+	})
+	log.L.Debugf("Deployment %s: Start rolling out revision %d", s.key(), s.revision)
+}
+
+// observe counts the pods of the Deployment at the clock by their metrics, forgetting the pods that
+// no longer exist.
+// A pod not in the metrics is pending if it has never been bound, and has finished otherwise.
+func (s *DeploymentSubmitter) observe(clk clock.Clock, podsMetrics map[string]pod.Metrics) deploymentCounts {
+	counts := deploymentCounts{resourceRequest: v1.ResourceList{}}
+
+	keys := make([]string, 0, len(s.pods))
+	for key := range s.pods {
+		keys = append(keys, key)
+	}
+	// The pods of the older revisions are deleted first, and the most recently created pods first
+	// in each revision, as the replicaset controller does.
+	sort.Slice(keys, func(i, j int) bool {
+		pi, pj := s.pods[keys[i]], s.pods[keys[j]]
+		if pi.revision != pj.revision {
+			return pi.revision < pj.revision
+		}
+		return pi.seq > pj.seq
+	})
+
+	for _, key := range keys {
+		p := s.pods[key]
+		m, bound := podsMetrics[key]
+		if bound {
+			p.bound = true
+			for rsrc, q := range m.ResourceRequest {
+				total := counts.resourceRequest[rsrc]
+				total.Add(q)
+				counts.resourceRequest[rsrc] = total
+			}
+		}
+
+		isNew := p.revision == s.revision
+		if p.deletedAt != nil {
+			if !clk.Before(p.deletedAt.Add(p.gracePeriod)) {
+				delete(s.pods, key)
+				continue
+			}
+			counts.terminating++
+			if !isNew {
+				counts.oldTerminating++
+			}
+			continue
+		}
+		if (p.bound && !bound) || (bound && m.Status != pod.Ok) { // finished, evicted, or failed to start
+			delete(s.pods, key)
+			continue
+		}
+
+		available := bound && !clk.Before(m.StartedAt)
+		if isNew {
+			counts.newAlive++
+			if available {
+				counts.newAvailable++
+			}
+		} else {
+			counts.oldAlive++
+			if available {
+				counts.oldAvailable++
+				counts.oldAvailablePods = append(counts.oldAvailablePods, p)
+			} else {
+				counts.oldUnavailablePods = append(counts.oldUnavailablePods, p)
+			}
+		}
+	}
+
+	return counts
+}
+
+// recordRollout records the counts at the clock in the rollout in progress, and completes it if
+// all the replicas are available pods of the current revision.
+func (s *DeploymentSubmitter) recordRollout(clk clock.Clock, rollout *Rollout, counts deploymentCounts) {
+	if pods := counts.newAlive + counts.oldAlive + counts.terminating; pods > rollout.MaxPods {
+		rollout.MaxPods = pods
+	}
+	if available := counts.newAvailable + counts.oldAvailable; available < rollout.MinAvailable {
+		rollout.MinAvailable = available
+	}
+	for rsrc, q := range counts.resourceRequest {
+		if max, ok := rollout.MaxResourceRequest[rsrc]; !ok || q.Cmp(max) > 0 {
+			rollout.MaxResourceRequest[rsrc] = q
+		}
+	}
+
+	if counts.newAvailable == s.replicas && counts.oldAlive == 0 && counts.oldTerminating == 0 {
+		rollout.CompletedAt = &clk
+		log.L.Infof("Deployment %s: Revision %d rolled out in %v",
+			s.key(), rollout.Revision, rollout.Duration())
+	}
+}
+
+// createPods returns the events of submitting n pods of the current revision.
+func (s *DeploymentSubmitter) createPods(n int) []Event {
+	events := make([]Event, 0, n)
+	for i := 0; i < n; i++ {
+		meta := s.template.ObjectMeta.DeepCopy()
+		meta.Name = s.podName(s.revision, s.seq)
+		meta.Namespace = s.namespace
+		if meta.Labels == nil {
+			meta.Labels = map[string]string{}
+		}
+		meta.Labels[appsv1.DefaultDeploymentUniqueLabelKey] = strconv.Itoa(s.revision)
+
+		v1Pod := &v1.Pod{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: *meta,
+			Spec:       *s.template.Spec.DeepCopy(),
+		}
+
+		s.pods[util.PodKeyFromNames(s.namespace, meta.Name)] = &deploymentPod{
+			revision:    s.revision,
+			seq:         s.seq,
+			gracePeriod: gracePeriod(&v1Pod.Spec),
+		}
+		s.seq++
+
+		events = append(events, &SubmitEvent{Pod: v1Pod})
+	}
+
+	return events
+}
+
+// deletePod returns the event of deleting the pod at the clock.
+// A pending pod is deleted immediately, and a bound one after its grace period.
+func (s *DeploymentSubmitter) deletePod(clk clock.Clock, p *deploymentPod) Event {
+	name := s.podName(p.revision, p.seq)
+	if p.bound {
+		p.deletedAt = &clk
+	} else {
+		delete(s.pods, util.PodKeyFromNames(s.namespace, name))
+	}
+
+	return &DeleteEvent{PodName: name, PodNamespace: s.namespace}
+}
+
+// podName returns the name of the pod of the revision created seq-th.
+func (s *DeploymentSubmitter) podName(revision, seq int) string {
+	return fmt.Sprintf("%s-%d-%d", s.name, revision, seq)
+}
+
+// key returns the key of the Deployment (namespace/name).
+func (s *DeploymentSubmitter) key() string {
+	return util.PodKeyFromNames(s.namespace, s.name)
+}
+
+// gracePeriod returns the termination grace period of the pod spec.
+func gracePeriod(spec *v1.PodSpec) time.Duration {
+	seconds := int64(v1.DefaultTerminationGracePeriodSeconds)
+	if spec.TerminationGracePeriodSeconds != nil {
+		seconds = *spec.TerminationGracePeriodSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
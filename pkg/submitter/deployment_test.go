@@ -0,0 +1,218 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package submitter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/metrics"
+	"simulator/pkg/pod"
+	"simulator/pkg/util"
+)
+
+var testStart = clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+
+func newTestDeployment(replicas int32, strategy appsv1.DeploymentStrategy) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Strategy: strategy,
+			Template: newTestTemplate("web:1"),
+		},
+	}
+}
+
+func newTestTemplate(image string) v1.PodTemplateSpec {
+	gracePeriod := int64(10)
+	return v1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web"}},
+		Spec: v1.PodSpec{
+			TerminationGracePeriodSeconds: &gracePeriod,
+			Containers: []v1.Container{{
+				Name:  "web",
+				Image: image,
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+				},
+			}},
+		},
+	}
+}
+
+// fakeCluster is a cluster that binds every pod at its submission to the first node in the zone
+// required by its node affinity, or to the nodes in turn, and starts it 5 seconds later.
+type fakeCluster struct {
+	nodes []*v1.Node
+	pods  map[string]pod.Metrics
+	next  int
+}
+
+func newFakeCluster(zones ...string) *fakeCluster {
+	cluster := &fakeCluster{pods: map[string]pod.Metrics{}}
+	for i, zone := range zones {
+		cluster.nodes = append(cluster.nodes, &v1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:   fmt.Sprintf("node-%d", i),
+			Labels: map[string]string{v1.LabelZoneFailureDomain: zone},
+		}})
+	}
+	return cluster
+}
+
+func (c *fakeCluster) List() ([]*v1.Node, error) {
+	return c.nodes, nil
+}
+
+// run runs the submitter every second until it terminates, calling the hook before each call.
+// Returns the clock at which it terminates.
+func (c *fakeCluster) run(t *testing.T, subm Submitter, hook func(clk clock.Clock)) clock.Clock {
+	ctx := context.Background()
+	clk := testStart
+	for i := 0; i < 1000; i++ {
+		if hook != nil {
+			hook(clk)
+		}
+		events, err := subm.Submit(ctx, clk, c, metrics.Metrics{metrics.PodsMetricsKey: c.pods})
+		assert.NoError(t, err)
+
+		for _, e := range events {
+			switch e := e.(type) {
+			case *SubmitEvent:
+				c.pods[util.PodKeyFromNames(e.Pod.Namespace, e.Pod.Name)] = pod.Metrics{
+					ResourceRequest: util.PodTotalResourceRequests(e.Pod),
+					BoundAt:         clk,
+					Node:            c.selectNode(e.Pod),
+					StartedAt:       clk.Add(5 * time.Second),
+					Status:          pod.Ok,
+					Labels:          e.Pod.Labels,
+				}
+			case *DeleteEvent:
+				key := util.PodKeyFromNames(e.PodNamespace, e.PodName)
+				m := c.pods[key]
+				m.Status = pod.Deleted
+				c.pods[key] = m
+			case *TerminateSubmitterEvent:
+				return clk
+			}
+		}
+
+		clk = clk.Add(time.Second)
+	}
+
+	assert.Fail(t, "submitter not terminated")
+	return clk
+}
+
+func (c *fakeCluster) selectNode(v1Pod *v1.Pod) string {
+	if affinity := v1Pod.Spec.Affinity; affinity != nil && affinity.NodeAffinity != nil {
+		zone := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.
+			NodeSelectorTerms[0].MatchExpressions[0].Values[0]
+		for _, node := range c.nodes {
+			if node.Labels[v1.LabelZoneFailureDomain] == zone {
+				return node.Name
+			}
+		}
+	}
+	if len(c.nodes) == 0 {
+		return "node"
+	}
+	node := c.nodes[c.next]
+	c.next = (c.next + 1) % len(c.nodes)
+	return node.Name
+}
+
+func TestDeploymentSubmitterRollingUpdate(t *testing.T) {
+	maxSurge, maxUnavailable := intstr.FromInt(1), intstr.FromInt(0)
+	deployment := newTestDeployment(4, appsv1.DeploymentStrategy{
+		Type: appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{
+			MaxSurge:       &maxSurge,
+			MaxUnavailable: &maxUnavailable,
+		},
+	})
+	subm, err := NewDeploymentSubmitter(deployment, []DeploymentUpdate{
+		{At: testStart.Add(time.Minute), Template: newTestTemplate("web:2")},
+	})
+	assert.NoError(t, err)
+
+	newFakeCluster().run(t, subm, nil)
+	rollouts := subm.Rollouts()
+	assert.Len(t, rollouts, 2)
+
+	// All the 4 pods are created at once, and start in 5 seconds.
+	assert.Equal(t, 5*time.Second, rollouts[0].Duration())
+	assert.Equal(t, 4, rollouts[0].MaxPods)
+
+	// A new pod is created every 6 seconds, once the previous one has started and an old pod has been
+	// deleted; the terminating pods do not count toward the surge but hold their resources for 10
+	// seconds, as in Kubernetes.
+	assert.Equal(t, time.Minute, rollouts[1].StartedAt.Sub(testStart))
+	assert.Equal(t, 4, rollouts[1].MinAvailable)
+	assert.Equal(t, 7, rollouts[1].MaxPods)
+	cpu := rollouts[1].MaxResourceRequest[v1.ResourceCPU]
+	assert.Equal(t, "7", cpu.String())
+	assert.Equal(t, (3*6+5+10)*time.Second, rollouts[1].Duration())
+}
+
+func TestDeploymentSubmitterRecreate(t *testing.T) {
+	deployment := newTestDeployment(4, appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType})
+	subm, err := NewDeploymentSubmitter(deployment, []DeploymentUpdate{
+		{At: testStart.Add(time.Minute), Template: newTestTemplate("web:2")},
+	})
+	assert.NoError(t, err)
+
+	newFakeCluster().run(t, subm, nil)
+	rollouts := subm.Rollouts()
+	assert.Len(t, rollouts, 2)
+
+	// The new pods are created after the old pods terminate in 10 seconds, and start in 5 seconds.
+	assert.Equal(t, 0, rollouts[1].MinAvailable)
+	assert.Equal(t, 4, rollouts[1].MaxPods)
+	assert.Equal(t, 15*time.Second, rollouts[1].Duration())
+}
+
+func TestNewDeploymentSubmitter(t *testing.T) {
+	subm, err := NewDeploymentSubmitter(newTestDeployment(10, appsv1.DeploymentStrategy{}), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, subm.maxSurge)
+	assert.Equal(t, 2, subm.maxUnavailable)
+
+	zero := intstr.FromInt(0)
+	subm, err = NewDeploymentSubmitter(newTestDeployment(10, appsv1.DeploymentStrategy{
+		RollingUpdate: &appsv1.RollingUpdateDeployment{MaxSurge: &zero, MaxUnavailable: &zero},
+	}), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, subm.maxUnavailable)
+
+	invalid := intstr.FromString("x%")
+	_, err = NewDeploymentSubmitter(newTestDeployment(10, appsv1.DeploymentStrategy{
+		RollingUpdate: &appsv1.RollingUpdateDeployment{MaxSurge: &invalid},
+	}), nil)
+	assert.Error(t, err)
+
+	_, err = NewDeploymentSubmitter(newTestDeployment(1, appsv1.DeploymentStrategy{Type: "BlueGreen"}), nil)
+	assert.EqualError(t, err, `deployment strategy type "BlueGreen" is not supported`)
+}
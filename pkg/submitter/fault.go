@@ -0,0 +1,253 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package submitter
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/containerd/containerd/log"
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/metrics"
+)
+
+// FaultKind is the kind of a Fault.
+type FaultKind string
+
+const (
+	// NodeCrash deletes the node, whose running pods stop immediately and are pushed back to the
+	// queue, and adds it back empty when the fault ends (see NodeManager).
+	// The node is added back as it was listed when it crashed, e.g., still degraded.
+	NodeCrash FaultKind = "crash"
+	// NodeNotReady makes the node not ready while the fault lasts (see NodeFaulter.SetNodeReady).
+	NodeNotReady FaultKind = "notReady"
+	// NodeDegradation reduces the capacity of the node while the fault lasts (see
+	// NodeFaulter.DegradeNode).
+	NodeDegradation FaultKind = "degradation"
+)
+
+// Fault is a fault of a node injected during the simulation.
+type Fault struct {
+	Kind FaultKind
+	Node string
+	// From is the clock at which the fault starts.
+	From clock.Clock
+	// Until is the clock at which the fault ends, or nil if it lasts until the end of the
+	// simulation.
+	Until *clock.Clock
+	// Ratios maps each resource to the ratio of the capacity of the node degraded by a
+	// NodeDegradation (e.g., cpu: 0.5).
+	Ratios map[v1.ResourceName]float64
+}
+
+// FaultInjector is a submitter that injects the faults into the nodes at their clocks, through the
+// NodeManager and the NodeFaulter implemented by the nodeLister given to Submit.
+// It submits no pods, and terminates when the last fault ends.
+type FaultInjector struct {
+	actions []faultAction
+	// applied is the number of the actions applied.
+	applied int
+	// crashed maps the name of each crashed node to the node to add back.
+	crashed map[string]*v1.Node
+}
+
+// faultAction is the start or the end of a fault.
+type faultAction struct {
+	at    clock.Clock
+	fault Fault
+	end   bool
+}
+
+// NewFaultInjector creates a new FaultInjector of the faults.
+// Returns error if a fault is of an unknown kind, has no node, or ends before it starts.
+func NewFaultInjector(faults []Fault) (*FaultInjector, error) {
+	actions := make([]faultAction, 0, 2*len(faults))
+	for _, f := range faults {
+		switch f.Kind {
+		case NodeCrash, NodeNotReady, NodeDegradation:
+		default:
+			return nil, strongerrors.InvalidArgument(errors.Errorf("fault kind %q is not supported", f.Kind))
+		}
+		if f.Node == "" {
+			return nil, strongerrors.InvalidArgument(errors.Errorf("no node of %s fault", f.Kind))
+		}
+		if f.Until != nil && f.Until.Before(f.From) {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("%s fault of node %s ends before it starts", f.Kind, f.Node))
+		}
+
+		actions = append(actions, faultAction{at: f.From, fault: f})
+		if f.Until != nil {
+			actions = append(actions, faultAction{at: *f.Until, fault: f, end: true})
+		}
+	}
+	// The ends at a clock come before the starts, so that a fault can follow another immediately.
+	sort.SliceStable(actions, func(i, j int) bool {
+		if actions[i].at.Sub(actions[j].at) != 0 {
+			return actions[i].at.Before(actions[j].at)
+		}
+		return actions[i].end && !actions[j].end
+	})
+
+	return &FaultInjector{
+		actions: actions,
+		crashed: map[string]*v1.Node{},
+	}, nil
+}
+
+// Submit applies the starts and the ends of the faults at or before the clock.
+// Returns error if the nodeLister does not implement NodeManager or NodeFaulter, or failed to
+// apply a fault.
+func (s *FaultInjector) Submit(
+	_ context.Context,
+	clk clock.Clock,
+	nodeLister algorithm.NodeLister,
+	_ metrics.Metrics) ([]Event, error) {
+
+	for s.applied < len(s.actions) && !clk.Before(s.actions[s.applied].at) {
+		if err := s.apply(s.actions[s.applied], nodeLister); err != nil {
+			return []Event{}, err
+		}
+		s.applied++
+	}
+
+	if s.applied == len(s.actions) {
+		return []Event{&TerminateSubmitterEvent{}}, nil
+	}
+	return []Event{}, nil
+}
+
+// apply applies the start or the end of the fault.
+func (s *FaultInjector) apply(action faultAction, nodeLister algorithm.NodeLister) error {
+	manager, ok := nodeLister.(NodeManager)
+	if !ok {
+		return strongerrors.InvalidArgument(errors.New("fault injection requires a NodeManager"))
+	}
+	faulter, ok := nodeLister.(NodeFaulter)
+	if !ok {
+		return strongerrors.InvalidArgument(errors.New("fault injection requires a NodeFaulter"))
+	}
+
+	f := action.fault
+	log.L.Debugf("Fault %s of node %s (end: %v)", f.Kind, f.Node, action.end)
+
+	switch f.Kind {
+	case NodeCrash:
+		if action.end {
+			node, ok := s.crashed[f.Node]
+			if !ok {
+				return strongerrors.NotFound(errors.Errorf("node %s has not crashed", f.Node))
+			}
+			delete(s.crashed, f.Node)
+			return manager.AddNode(node)
+		}
+
+		nodes, err := nodeLister.List()
+		if err != nil {
+			return err
+		}
+		for _, node := range nodes {
+			if node.Name == f.Node {
+				s.crashed[f.Node] = node.DeepCopy()
+			}
+		}
+		return manager.DeleteNode(f.Node)
+	case NodeNotReady:
+		return faulter.SetNodeReady(f.Node, action.end)
+	default: // NodeDegradation
+		if action.end {
+			return faulter.DegradeNode(f.Node, nil)
+		}
+		return faulter.DegradeNode(f.Node, f.Ratios)
+	}
+}
+
+// NextWakeup implements Waker interface.
+// Returns the clock of the next start or end of the faults.
+func (s *FaultInjector) NextWakeup(clk clock.Clock) (clock.Clock, bool) {
+	if s.applied == len(s.actions) {
+		// Terminates at the next call.
+		return clk, true
+	}
+	return s.actions[s.applied].at, true
+}
+
+type faultInjectorState struct {
+	Applied int
+	Crashed map[string]*v1.Node
+}
+
+// Snapshot implements Snapshotter interface.
+func (s *FaultInjector) Snapshot() (json.RawMessage, error) {
+	return json.Marshal(faultInjectorState{Applied: s.applied, Crashed: s.crashed})
+}
+
+// Restore implements Snapshotter interface.
+// The nodes crashed in the state are restored to be added back when their faults end.
+// The other nodes under the faults, e.g., degraded or not ready, are restored in that state with the
+// checkpoint of the cluster (see kubesim.CheckpointNode), so that the faults end on them as usual.
+// Returns error if the state does not match the faults, e.g., a node crashed in the state is not
+// under a crash fault.
+func (s *FaultInjector) Restore(state json.RawMessage) error {
+	st := faultInjectorState{}
+	if err := json.Unmarshal(state, &st); err != nil {
+		return err
+	}
+	if st.Applied > len(s.actions) {
+		return strongerrors.InvalidArgument(
+			errors.Errorf("%d faults applied in the state, more than %d", st.Applied, len(s.actions)))
+	}
+
+	// crashing is the number of the crash faults in effect on each node after the applied actions.
+	crashing := map[string]int{}
+	for _, action := range s.actions[:st.Applied] {
+		if action.fault.Kind != NodeCrash {
+			continue
+		}
+		if action.end {
+			crashing[action.fault.Node]--
+		} else {
+			crashing[action.fault.Node]++
+		}
+	}
+	for name, n := range crashing {
+		if _, ok := st.Crashed[name]; n > 0 && !ok {
+			return strongerrors.InvalidArgument(errors.Errorf("crashed node %s is not in the state", name))
+		}
+	}
+	for name := range st.Crashed {
+		if crashing[name] <= 0 {
+			return strongerrors.InvalidArgument(errors.Errorf("node %s has not crashed", name))
+		}
+	}
+
+	s.applied = st.Applied
+	s.crashed = st.Crashed
+	if s.crashed == nil {
+		s.crashed = map[string]*v1.Node{}
+	}
+
+	return nil
+}
+
+var _ = Submitter(&FaultInjector{})
+var _ = Waker(&FaultInjector{})
+var _ = Snapshotter(&FaultInjector{})
@@ -0,0 +1,69 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package submitter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestNewFaultInjector(t *testing.T) {
+	until := testStart.Add(time.Minute)
+	s, err := NewFaultInjector([]Fault{
+		{Kind: NodeDegradation, Node: "node-1", From: until, Ratios: map[v1.ResourceName]float64{"cpu": 0.5}},
+		{Kind: NodeNotReady, Node: "node-0", From: testStart, Until: &until},
+	})
+	assert.NoError(t, err)
+
+	// The end of the notReady fault comes before the start of the degradation at the same clock.
+	assert.Len(t, s.actions, 3)
+	assert.True(t, s.actions[1].end)
+	assert.Equal(t, NodeDegradation, s.actions[2].fault.Kind)
+
+	next, ok := s.NextWakeup(testStart)
+	assert.True(t, ok)
+	assert.Equal(t, testStart, next)
+
+	s.applied = 2
+	state, err := s.Snapshot()
+	assert.NoError(t, err)
+	restored, err := NewFaultInjector([]Fault{
+		{Kind: NodeDegradation, Node: "node-1", From: until, Ratios: map[v1.ResourceName]float64{"cpu": 0.5}},
+		{Kind: NodeNotReady, Node: "node-0", From: testStart, Until: &until},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, restored.Restore(state))
+	next, _ = restored.NextWakeup(testStart)
+	assert.Equal(t, until, next)
+
+	// The crashed nodes in the state must match the crash faults applied.
+	crash, err := NewFaultInjector([]Fault{{Kind: NodeCrash, Node: "node-0", From: testStart, Until: &until}})
+	assert.NoError(t, err)
+	assert.EqualError(t, crash.Restore([]byte(`{"Applied":1}`)), "crashed node node-0 is not in the state")
+	assert.EqualError(t, crash.Restore([]byte(`{"Applied":2,"Crashed":{"node-0":{}}}`)), "node node-0 has not crashed")
+	assert.NoError(t, crash.Restore([]byte(`{"Applied":1,"Crashed":{"node-0":{}}}`)))
+	assert.Contains(t, crash.crashed, "node-0")
+
+	_, err = NewFaultInjector([]Fault{{Kind: "reboot", Node: "node-0"}})
+	assert.EqualError(t, err, `fault kind "reboot" is not supported`)
+	_, err = NewFaultInjector([]Fault{{Kind: NodeCrash}})
+	assert.EqualError(t, err, "no node of crash fault")
+	before := testStart.Add(-time.Second)
+	_, err = NewFaultInjector([]Fault{{Kind: NodeCrash, Node: "node-0", From: testStart, Until: &before}})
+	assert.EqualError(t, err, "crash fault of node node-0 ends before it starts")
+}
@@ -0,0 +1,419 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package submitter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/metrics"
+	"simulator/pkg/pod"
+	"simulator/pkg/util"
+)
+
+// StatefulSetScale is a change of the replicas of a StatefulSet at a clock.
+type StatefulSetScale struct {
+	At       clock.Clock
+	Replicas int
+}
+
+// Scaling is a scaling of a StatefulSet to a number of replicas.
+type Scaling struct {
+	Replicas  int
+	StartedAt clock.Clock
+	// CompletedAt is the clock at which the pods of all the ordinals below the replicas are
+	// available and no other pods remain, or nil if not completed (e.g., superseded by the next
+	// scale).
+	CompletedAt *clock.Clock
+}
+
+// Duration returns the duration of this Scaling, or 0 if not completed.
+func (s Scaling) Duration() time.Duration {
+	if s.CompletedAt == nil {
+		return 0
+	}
+	return s.CompletedAt.Sub(s.StartedAt)
+}
+
+// Recovery is the recreation of a pod of a StatefulSet that has been lost, i.e., has finished, been
+// evicted, or failed to start.
+type Recovery struct {
+	// Pod is the name of the pod, which is the same before and after the recovery.
+	Pod    string
+	LostAt clock.Clock
+	// RecoveredAt is the clock at which the recreated pod is available, or nil if not recovered.
+	RecoveredAt *clock.Clock
+	// Zone is the zone of the volumes of the pod, to which the recreated pod is pinned, or empty if
+	// the pod has no volumes.
+	Zone string
+}
+
+// Duration returns the duration of this Recovery, or 0 if not recovered.
+func (r Recovery) Duration() time.Duration {
+	if r.RecoveredAt == nil {
+		return 0
+	}
+	return r.RecoveredAt.Sub(r.LostAt)
+}
+
+// StatefulSetSubmitter is a submitter that keeps the replicas of a StatefulSet like the statefulset
+// controller: the pod of each ordinal is named "<name>-<ordinal>" and recreated with the same name
+// when lost, and the pods are created in the order of their ordinals and deleted in the reverse
+// order, one at a time after the previous one is available (OrderedReady), or all at once
+// (Parallel).
+// If the StatefulSet has volumeClaimTemplates, the volumes of each ordinal are bound to the zone of
+// the node on which its first pod is bound, and the later pods of the ordinal are pinned to the zone
+// by a required node affinity, as persistent volumes in a zone are.
+// The volumes remain after scaling down, as PVCs do.
+// It terminates when the last scaling completes; a scale to the same replicas keeps it running
+// until the clock.
+type StatefulSetSubmitter struct {
+	name        string
+	namespace   string
+	serviceName string
+	replicas    int
+	parallel    bool
+	volumes     bool
+	template    v1.PodTemplateSpec
+
+	scales     []StatefulSetScale
+	scalings   []Scaling
+	recoveries []Recovery
+	// recovering maps the ordinals being recovered to the indexes of their recoveries.
+	recovering map[int]int
+
+	pods map[int]*statefulSetPod
+	// zones maps the ordinals to the zones of their volumes.
+	zones map[int]string
+}
+
+type statefulSetPod struct {
+	submittedAt clock.Clock
+	// bound is whether the pod has been observed bound to a node.
+	bound bool
+	// deletedAt is the clock at which the pod is deleted, or nil if not deleted.
+	deletedAt   *clock.Clock
+	gracePeriod time.Duration
+}
+
+// NewStatefulSetSubmitter creates a new StatefulSetSubmitter of the statefulSet, whose replicas are
+// changed by the scales at their clocks.
+// The replicas default to 1, and the pod management policy to OrderedReady, as in Kubernetes.
+// Returns error if the replicas or the pod management policy is invalid.
+func NewStatefulSetSubmitter(
+	statefulSet *appsv1.StatefulSet, scales []StatefulSetScale) (*StatefulSetSubmitter, error) {
+
+	if statefulSet.Name == "" {
+		return nil, strongerrors.InvalidArgument(errors.New("name of a statefulset must not be empty"))
+	}
+	namespace := statefulSet.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	replicas := 1
+	if statefulSet.Spec.Replicas != nil {
+		replicas = int(*statefulSet.Spec.Replicas)
+	}
+
+	subm := &StatefulSetSubmitter{
+		name:        statefulSet.Name,
+		namespace:   namespace,
+		serviceName: statefulSet.Spec.ServiceName,
+		replicas:    replicas,
+		volumes:     len(statefulSet.Spec.VolumeClaimTemplates) > 0,
+		template:    statefulSet.Spec.Template,
+		scales:      append([]StatefulSetScale{}, scales...),
+		recovering:  map[int]int{},
+		pods:        map[int]*statefulSetPod{},
+		zones:       map[int]string{},
+	}
+	sort.SliceStable(subm.scales, func(i, j int) bool {
+		return subm.scales[i].At.Before(subm.scales[j].At)
+	})
+
+	if replicas < 0 {
+		return nil, strongerrors.InvalidArgument(
+			errors.Errorf("invalid replicas %d of statefulset %s", replicas, statefulSet.Name))
+	}
+	for _, scale := range subm.scales {
+		if scale.Replicas < 0 {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("invalid replicas %d of statefulset %s", scale.Replicas, statefulSet.Name))
+		}
+	}
+
+	switch statefulSet.Spec.PodManagementPolicy {
+	case "", appsv1.OrderedReadyPodManagement:
+	case appsv1.ParallelPodManagement:
+		subm.parallel = true
+	default:
+		return nil, strongerrors.InvalidArgument(
+			errors.Errorf("pod management policy %q is not supported", statefulSet.Spec.PodManagementPolicy))
+	}
+
+	return subm, nil
+}
+
+// Scalings returns the scalings started so far, including the initial creation.
+func (s *StatefulSetSubmitter) Scalings() []Scaling {
+	return s.scalings
+}
+
+// Recoveries returns the recoveries of the lost pods so far.
+func (s *StatefulSetSubmitter) Recoveries() []Recovery {
+	return s.recoveries
+}
+
+// Submit submits and deletes the pods of the StatefulSet to keep its replicas.
+func (s *StatefulSetSubmitter) Submit(
+	_ context.Context,
+	clk clock.Clock,
+	nodeLister algorithm.NodeLister,
+	met metrics.Metrics) ([]Event, error) {
+
+	if len(s.scalings) == 0 {
+		s.startScaling(clk, s.replicas)
+	}
+	for len(s.scales) > 0 && !clk.Before(s.scales[0].At) {
+		s.startScaling(clk, s.scales[0].Replicas)
+		s.scales = s.scales[1:]
+	}
+
+	podsMetrics, _ := met[metrics.PodsMetricsKey].(map[string]pod.Metrics)
+	available, err := s.observe(clk, nodeLister, podsMetrics)
+	if err != nil {
+		return nil, err
+	}
+
+	scaling := &s.scalings[len(s.scalings)-1]
+	if scaling.CompletedAt == nil && s.isScaled(available) {
+		scaling.CompletedAt = &clk
+		log.L.Infof("StatefulSet %s: Scaled to %d replicas in %v",
+			util.PodKeyFromNames(s.namespace, s.name), s.replicas, scaling.Duration())
+	}
+	if scaling.CompletedAt != nil && len(s.scales) == 0 {
+		return []Event{&TerminateSubmitterEvent{}}, nil
+	}
+
+	events := []Event{}
+	for ord := 0; ord < s.replicas; ord++ {
+		p, ok := s.pods[ord]
+		if !ok {
+			events = append(events, s.createPod(clk, ord))
+			if !s.parallel {
+				return events, nil
+			}
+			continue
+		}
+		// The pod of an ordinal terminating after a scale-down is recreated after it terminates.
+		if !s.parallel && (p.deletedAt != nil || !available[ord]) {
+			return events, nil
+		}
+	}
+
+	condemned := []int{}
+	for ord := range s.pods {
+		if ord >= s.replicas {
+			condemned = append(condemned, ord)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(condemned)))
+	for _, ord := range condemned {
+		if s.pods[ord].deletedAt == nil {
+			events = append(events, s.deletePod(clk, ord))
+		}
+		if !s.parallel {
+			break
+		}
+	}
+
+	return events, nil
+}
+
+// isScaled returns whether the pods of all the ordinals below the replicas are available and no
+// other pods remain.
+func (s *StatefulSetSubmitter) isScaled(available map[int]bool) bool {
+	if len(s.pods) != s.replicas {
+		return false
+	}
+	for ord := 0; ord < s.replicas; ord++ {
+		if !available[ord] {
+			return false
+		}
+	}
+	return true
+}
+
+// startScaling starts the scaling to the replicas at the clock.
+func (s *StatefulSetSubmitter) startScaling(clk clock.Clock, replicas int) {
+	s.replicas = replicas
+	s.scalings = append(s.scalings, Scaling{Replicas: replicas, StartedAt: clk})
+	log.L.Debugf("StatefulSet %s: Start scaling to %d replicas",
+		util.PodKeyFromNames(s.namespace, s.name), replicas)
+}
+
+// observe updates the pods of the StatefulSet at the clock by their metrics, forgetting the pods
+// that no longer exist and recording the zones of the nodes to which the pods with volumes are
+// first bound.
+// Returns the set of the ordinals whose pods are available.
+func (s *StatefulSetSubmitter) observe(
+	clk clock.Clock,
+	nodeLister algorithm.NodeLister,
+	podsMetrics map[string]pod.Metrics) (map[int]bool, error) {
+
+	var zones map[string]string // zones of nodes, listed lazily
+	available := map[int]bool{}
+
+	// In the order of the ordinals, so that the recoveries of the pods lost at once are recorded
+	// deterministically.
+	ords := make([]int, 0, len(s.pods))
+	for ord := range s.pods {
+		ords = append(ords, ord)
+	}
+	sort.Ints(ords)
+
+	for _, ord := range ords {
+		p := s.pods[ord]
+		m, bound := podsMetrics[util.PodKeyFromNames(s.namespace, s.podName(ord))]
+		if bound && m.BoundAt.Before(p.submittedAt) { // the previous pod of the same name
+			bound = false
+		}
+
+		if bound && !p.bound {
+			p.bound = true
+			if _, ok := s.zones[ord]; s.volumes && !ok {
+				if zones == nil {
+					nodes, err := nodeLister.List()
+					if err != nil {
+						return nil, err
+					}
+					zones = map[string]string{}
+					for _, node := range nodes {
+						zones[node.Name] = node.Labels[v1.LabelZoneFailureDomain]
+					}
+				}
+				s.zones[ord] = zones[m.Node]
+			}
+		}
+
+		if p.deletedAt != nil {
+			if !clk.Before(p.deletedAt.Add(p.gracePeriod)) {
+				delete(s.pods, ord)
+			}
+			continue
+		}
+		if (p.bound && !bound) || (bound && m.Status != pod.Ok) { // finished, evicted, or failed to start
+			delete(s.pods, ord)
+			if ord < s.replicas {
+				s.recovering[ord] = len(s.recoveries)
+				s.recoveries = append(s.recoveries, Recovery{Pod: s.podName(ord), LostAt: clk, Zone: s.zones[ord]})
+				log.L.Debugf("StatefulSet %s: Pod %s lost",
+					util.PodKeyFromNames(s.namespace, s.name), s.podName(ord))
+			}
+			continue
+		}
+
+		if bound && !clk.Before(m.StartedAt) {
+			available[ord] = true
+			if i, ok := s.recovering[ord]; ok {
+				s.recoveries[i].RecoveredAt = &clk
+				delete(s.recovering, ord)
+			}
+		}
+	}
+
+	return available, nil
+}
+
+// createPod returns the event of submitting the pod of the ordinal at the clock.
+func (s *StatefulSetSubmitter) createPod(clk clock.Clock, ord int) Event {
+	name := s.podName(ord)
+	meta := s.template.ObjectMeta.DeepCopy()
+	meta.Name = name
+	meta.Namespace = s.namespace
+	if meta.Labels == nil {
+		meta.Labels = map[string]string{}
+	}
+	meta.Labels[appsv1.StatefulSetPodNameLabel] = name
+
+	spec := s.template.Spec.DeepCopy()
+	spec.Hostname = name
+	spec.Subdomain = s.serviceName
+	if zone := s.zones[ord]; zone != "" {
+		requireZone(spec, zone)
+	}
+
+	s.pods[ord] = &statefulSetPod{submittedAt: clk, gracePeriod: gracePeriod(spec)}
+
+	return &SubmitEvent{Pod: &v1.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: *meta,
+		Spec:       *spec,
+	}}
+}
+
+// deletePod returns the event of deleting the pod of the ordinal at the clock.
+// A pending pod is deleted immediately, and a bound one after its grace period.
+func (s *StatefulSetSubmitter) deletePod(clk clock.Clock, ord int) Event {
+	if s.pods[ord].bound {
+		s.pods[ord].deletedAt = &clk
+	} else {
+		delete(s.pods, ord)
+	}
+
+	return &DeleteEvent{PodName: s.podName(ord), PodNamespace: s.namespace}
+}
+
+// podName returns the name of the pod of the ordinal.
+func (s *StatefulSetSubmitter) podName(ord int) string {
+	return fmt.Sprintf("%s-%d", s.name, ord)
+}
+
+// requireZone adds the requirement of the zone to every term of the required node affinity of the
+// pod spec.
+func requireZone(spec *v1.PodSpec, zone string) {
+	requirement := v1.NodeSelectorRequirement{
+		Key:      v1.LabelZoneFailureDomain,
+		Operator: v1.NodeSelectorOpIn,
+		Values:   []string{zone},
+	}
+
+	if spec.Affinity == nil {
+		spec.Affinity = &v1.Affinity{}
+	}
+	if spec.Affinity.NodeAffinity == nil {
+		spec.Affinity.NodeAffinity = &v1.NodeAffinity{}
+	}
+	selector := spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if selector == nil || len(selector.NodeSelectorTerms) == 0 {
+		selector = &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{{}}}
+		spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = selector
+	}
+	for i := range selector.NodeSelectorTerms {
+		term := &selector.NodeSelectorTerms[i]
+		term.MatchExpressions = append(term.MatchExpressions, requirement)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package submitter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/pod"
+)
+
+func newTestStatefulSet(replicas int32, policy appsv1.PodManagementPolicyType, volumes bool) *appsv1.StatefulSet {
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "db"},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:            &replicas,
+			ServiceName:         "db",
+			PodManagementPolicy: policy,
+			Template:            newTestTemplate("db:1"),
+		},
+	}
+	if volumes {
+		statefulSet.Spec.VolumeClaimTemplates = []v1.PersistentVolumeClaim{
+			{ObjectMeta: metav1.ObjectMeta{Name: "data"}},
+		}
+	}
+	return statefulSet
+}
+
+func TestStatefulSetSubmitterOrderedReady(t *testing.T) {
+	subm, err := NewStatefulSetSubmitter(newTestStatefulSet(3, "", false), []StatefulSetScale{
+		{At: testStart.Add(time.Minute), Replicas: 1},
+	})
+	assert.NoError(t, err)
+
+	cluster := newFakeCluster()
+	cluster.run(t, subm, nil)
+	scalings := subm.Scalings()
+	assert.Len(t, scalings, 2)
+
+	// Each pod is created after the previous one starts in 5 seconds.
+	assert.Equal(t, 3*5*time.Second, scalings[0].Duration())
+	assert.Equal(t, "db-0", cluster.pods["default/db-0"].Labels[appsv1.StatefulSetPodNameLabel])
+
+	// The pods are deleted in the reverse order, after the previous one terminates in 10 seconds.
+	assert.Equal(t, 1, scalings[1].Replicas)
+	assert.Equal(t, 2*10*time.Second, scalings[1].Duration())
+	assert.Equal(t, pod.Ok, cluster.pods["default/db-0"].Status)
+	assert.Equal(t, pod.Deleted, cluster.pods["default/db-1"].Status)
+}
+
+func TestStatefulSetSubmitterParallel(t *testing.T) {
+	subm, err := NewStatefulSetSubmitter(newTestStatefulSet(3, appsv1.ParallelPodManagement, false), nil)
+	assert.NoError(t, err)
+
+	newFakeCluster().run(t, subm, nil)
+	assert.Equal(t, 5*time.Second, subm.Scalings()[0].Duration())
+}
+
+func TestStatefulSetSubmitterRecovery(t *testing.T) {
+	subm, err := NewStatefulSetSubmitter(newTestStatefulSet(2, "", true), []StatefulSetScale{
+		{At: testStart.Add(time.Minute), Replicas: 2},
+	})
+	assert.NoError(t, err)
+
+	// The pods are bound to the nodes in turn, i.e., db-1 to node-1 in zone-b first, then to node-2
+	// in zone-a if not pinned.
+	cluster := newFakeCluster("zone-a", "zone-b", "zone-a")
+	cluster.run(t, subm, func(clk clock.Clock) {
+		if clk.Sub(testStart) == 30*time.Second {
+			m := cluster.pods["default/db-1"]
+			m.Status = pod.Evicted
+			cluster.pods["default/db-1"] = m
+		}
+	})
+
+	assert.Equal(t, "node-1", cluster.pods["default/db-1"].Node)
+	recoveries := subm.Recoveries()
+	assert.Len(t, recoveries, 1)
+	assert.Equal(t, "db-1", recoveries[0].Pod)
+	assert.Equal(t, "zone-b", recoveries[0].Zone)
+	assert.Equal(t, 30*time.Second, recoveries[0].LostAt.Sub(testStart))
+	assert.Equal(t, 5*time.Second, recoveries[0].Duration())
+}
+
+func TestStatefulSetSubmitterRecoveryOrder(t *testing.T) {
+	subm, err := NewStatefulSetSubmitter(newTestStatefulSet(3, appsv1.ParallelPodManagement, false),
+		[]StatefulSetScale{{At: testStart.Add(time.Minute), Replicas: 3}})
+	assert.NoError(t, err)
+
+	// All the pods are lost at once.
+	cluster := newFakeCluster()
+	cluster.run(t, subm, func(clk clock.Clock) {
+		if clk.Sub(testStart) == 30*time.Second {
+			for _, key := range []string{"default/db-0", "default/db-1", "default/db-2"} {
+				m := cluster.pods[key]
+				m.Status = pod.Evicted
+				cluster.pods[key] = m
+			}
+		}
+	})
+
+	names := []string{}
+	for _, recovery := range subm.Recoveries() {
+		names = append(names, recovery.Pod)
+	}
+	assert.Equal(t, []string{"db-0", "db-1", "db-2"}, names)
+}
+
+func TestRequireZone(t *testing.T) {
+	spec := &v1.PodSpec{Affinity: &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{
+			{MatchExpressions: []v1.NodeSelectorRequirement{{Key: "gpu", Operator: v1.NodeSelectorOpExists}}},
+			{MatchExpressions: []v1.NodeSelectorRequirement{{Key: "ssd", Operator: v1.NodeSelectorOpExists}}},
+		}},
+	}}}
+	requireZone(spec, "zone-a")
+
+	for _, term := range spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		assert.Len(t, term.MatchExpressions, 2)
+		assert.Equal(t, []string{"zone-a"}, term.MatchExpressions[1].Values)
+	}
+}
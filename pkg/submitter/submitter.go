@@ -15,26 +15,107 @@
 package submitter
 
 import (
+	"context"
+	"encoding/json"
+
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/kubernetes/pkg/scheduler/algorithm"
 
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/clock"
-	"github.com/pfnet-research/k8s-cluster-simulator/pkg/metrics"
+	"simulator/pkg/clock"
+	"simulator/pkg/metrics"
 )
 
 // Submitter defines the submitter interface.
 type Submitter interface {
 	// Submit submits pods to a simulated cluster.
 	// The return value is a list of submitter events.
-	// Submitters are called serially in the same order that they are registered to the simulated
-	// cluster.
+	// Submitters are called serially in the order of the names with which they are registered to
+	// the simulated cluster.
 	// This method must never block.
+	// The context is canceled when the simulation is interrupted.
 	Submit(
+		ctx context.Context,
 		clock clock.Clock,
 		nodeLister algorithm.NodeLister,
 		metrics metrics.Metrics) ([]Event, error)
 }
 
+// PodLister lists the pods bound to the nodes of a simulated cluster.
+// The nodeLister given to Submit implements this interface, so that a submitter can react to the
+// completion of the pods it submitted:
+//
+//	if lister, ok := nodeLister.(submitter.PodLister); ok {
+//		pods, err := lister.ListPods(selector)
+//		...
+//	}
+type PodLister interface {
+	// ListPods returns the pods bound to the nodes and matching the selector, with their status at
+	// the current clock, including the pods that have terminated (the phase is Succeeded or Failed).
+	// The pods are copies; modifying them does not affect the cluster.
+	ListPods(selector labels.Selector) ([]*v1.Pod, error)
+}
+
+// NodeManager adds and deletes the nodes of a simulated cluster during the simulation.
+// The nodeLister given to Submit implements this interface, so that a submitter can simulate node
+// failures, drains, and scale-ups:
+//
+//	if manager, ok := nodeLister.(submitter.NodeManager); ok {
+//		err := manager.DeleteNode("node-0")
+//		...
+//	}
+type NodeManager interface {
+	// AddNode adds a copy of the node to the cluster at the current clock.
+	AddNode(node *v1.Node) error
+	// DeleteNode deletes the node of the name from the cluster at the current clock.
+	// The running pods on the node are pushed back to the queue.
+	DeleteNode(name string) error
+}
+
+// NodeTainter taints and untaints the nodes of a simulated cluster during the simulation.
+// The nodeLister given to Submit implements this interface as well, so that a submitter can
+// dedicate nodes or drain them with NoExecute taints.
+type NodeTainter interface {
+	// TaintNode adds the taint to the node of the name at the current clock.
+	// The running pods not tolerating a NoExecute taint are evicted and pushed back to the queue.
+	TaintNode(name string, taint v1.Taint) error
+	// UntaintNode removes the taint of the key and the effect from the node of the name.
+	UntaintNode(name, key string, effect v1.TaintEffect) error
+}
+
+// NodeFaulter injects faults into the nodes of a simulated cluster during the simulation.
+// The nodeLister given to Submit implements this interface as well (see FaultInjector).
+type NodeFaulter interface {
+	// SetNodeReady sets the Ready condition of the node of the name at the current clock.
+	// A node not ready is tainted so that no pods are scheduled onto it, and the running pods not
+	// tolerating the taint are evicted and pushed back to the queue.
+	SetNodeReady(name string, ready bool) error
+	// DegradeNode reduces the capacity of the node of the name by the ratio of each resource, or
+	// restores it if ratios is empty.
+	DegradeNode(name string, ratios map[v1.ResourceName]float64) error
+}
+
+// Snapshotter is an optional interface that a Submitter can implement to save its state in a
+// snapshot of the simulated cluster, from which it is restored when the simulation is resumed or
+// branched (see kubesim.KubeSim.Snapshot).
+// A submitter not implementing it must be added in the state of the snapshot by other means.
+type Snapshotter interface {
+	// Snapshot returns the state of the submitter in JSON.
+	Snapshot() (json.RawMessage, error)
+	// Restore restores the state of the submitter from the JSON returned by Snapshot.
+	Restore(state json.RawMessage) error
+}
+
+// Waker is an optional interface that a Submitter can implement to tell the clock at which it
+// submits next, so that the simulated cluster can fast-forward the ticks at which nothing happens.
+// A submitter not implementing it is called at every tick (e.g., to react to the completion of its
+// pods).
+type Waker interface {
+	// NextWakeup returns the earliest clock after the given one at which the submitter may return
+	// events. The second return value is false if it never does.
+	NextWakeup(clock clock.Clock) (clock.Clock, bool)
+}
+
 // Event defines the interface of a submitter event.
 // Submit can returns any type in a list that implements this interface.
 type Event interface {
@@ -0,0 +1,126 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubesim
+
+import (
+	"simulator/pkg/clock"
+	"simulator/pkg/metrics"
+	"simulator/pkg/scheduler"
+)
+
+// RunState is the state of a simulation at the start of a tick, on which a Condition is evaluated.
+type RunState struct {
+	// Clock is the clock of the tick about to be processed.
+	Clock clock.Clock
+	// Ticks is the number of the ticks processed since RunUntil started.
+	// The ticks skipped by the fast-forward are not counted.
+	Ticks int
+	// Metrics is the metrics of the cluster built at the end of the last tick.
+	Metrics metrics.Metrics
+	// SubmittedPods is the number of the pods submitted since the simulation started, including the
+	// ones before the checkpoint it was resumed from.
+	SubmittedPods int
+	// PendingPods is the number of the pods in the queue, backing off, or held by the schedulers
+	// (see scheduler.Holder), and RunningPods is the number of the workload pods running or
+	// terminating on the nodes.
+	PendingPods int
+	RunningPods int
+	// SubmittersTerminated is whether all the submitters added ever have terminated (see
+	// submitter.TerminateSubmitterEvent).
+	SubmittersTerminated bool
+}
+
+// Condition is a condition on which RunUntil ends a simulation.
+type Condition func(state RunState) bool
+
+// AllPodsCompleted returns a Condition that holds when some pods have been submitted, and none of
+// them is pending or running, even if the submitters may submit more pods later.
+func AllPodsCompleted() Condition {
+	return func(state RunState) bool {
+		return state.SubmittedPods > 0 && state.PendingPods == 0 && state.RunningPods == 0
+	}
+}
+
+// SubmittersExhausted returns a Condition that holds when all the submitters have terminated, even
+// if their pods are still pending or running.
+func SubmittersExhausted() Condition {
+	return func(state RunState) bool {
+		return state.SubmittersTerminated
+	}
+}
+
+// ClockReaches returns a Condition that holds when the clock reaches the given one, so that the
+// ticks before it are processed.
+func ClockReaches(clk clock.Clock) Condition {
+	return func(state RunState) bool {
+		return !state.Clock.Before(clk)
+	}
+}
+
+// TicksElapsed returns a Condition that holds when n ticks have been processed.
+func TicksElapsed(n int) Condition {
+	return func(state RunState) bool {
+		return state.Ticks >= n
+	}
+}
+
+// AnyOf returns a Condition that holds when any of the conditions holds.
+func AnyOf(conds ...Condition) Condition {
+	return func(state RunState) bool {
+		for _, cond := range conds {
+			if cond(state) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AllOf returns a Condition that holds when all of the conditions hold.
+func AllOf(conds ...Condition) Condition {
+	return func(state RunState) bool {
+		for _, cond := range conds {
+			if !cond(state) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// runState returns the RunState at the current clock.
+func (k *KubeSim) runState(ticks int, met metrics.Metrics, submitterAddedEver bool) RunState {
+	state := RunState{
+		Clock:                k.clock,
+		Ticks:                ticks,
+		Metrics:              met,
+		SubmittedPods:        k.submittedPods,
+		PendingPods:          k.pendingPods.Metrics().PendingPodsNum,
+		SubmittersTerminated: submitterAddedEver && len(k.submitters) == 0,
+	}
+	if k.unschedulable != nil {
+		state.PendingPods += k.unschedulable.Len()
+	}
+	for _, sq := range k.schedulerQueues() {
+		if holder, ok := sq.scheduler.(scheduler.Holder); ok {
+			state.PendingPods += len(holder.Held())
+		}
+	}
+	for _, node := range k.nodes {
+		state.RunningPods += int(node.WorkloadPodsNum(k.clock))
+	}
+
+	return state
+}
@@ -0,0 +1,147 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubesim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/metrics"
+	"simulator/pkg/scheduler"
+	"simulator/pkg/submitter"
+)
+
+// endlessSubmitter submits the pods at the first call, and never terminates.
+type endlessSubmitter struct {
+	pods []*v1.Pod
+}
+
+func (s *endlessSubmitter) Submit(
+	_ context.Context, _ clock.Clock, _ algorithm.NodeLister, _ metrics.Metrics,
+) ([]submitter.Event, error) {
+
+	events := []submitter.Event{}
+	for _, p := range s.pods {
+		events = append(events, &submitter.SubmitEvent{Pod: p})
+	}
+	s.pods = nil
+	return events, nil
+}
+
+func TestKubeSimRunUntil(t *testing.T) {
+	newKubeSim := func(sub submitter.Submitter) *KubeSim {
+		binPacking := scheduler.NewBinPackingScheduler()
+		k, err := NewKubeSim(WithConfig(newCheckpointConfig(10)), WithScheduler(&binPacking))
+		assert.NoError(t, err)
+		k.AddSubmitter("Pods", sub)
+		return k
+	}
+	podPhases := func(k *KubeSim) []v1.PodPhase {
+		pods, err := k.ListPods(labels.Everything())
+		assert.NoError(t, err)
+		phases := []v1.PodPhase{}
+		for _, p := range pods {
+			phases = append(phases, p.Status.Phase)
+		}
+		return phases
+	}
+
+	k := newKubeSim(&endlessSubmitter{})
+	start := k.clock
+	assert.NoError(t, k.RunUntil(context.Background(), TicksElapsed(3)))
+	assert.Equal(t, start.Add(30*time.Second), k.clock)
+
+	k = newKubeSim(&endlessSubmitter{})
+	assert.NoError(t, k.RunUntil(context.Background(), ClockReaches(start.Add(25*time.Second))))
+	assert.Equal(t, start.Add(30*time.Second), k.clock)
+
+	// The pod completes at 60s, while the submitter never terminates.
+	k = newKubeSim(&endlessSubmitter{pods: []*v1.Pod{newCheckpointPod("pod-0")}})
+	completed := 0
+	k.AddEventHandler(func(e metrics.Event) error {
+		if e.Kind == metrics.CompleteEvent {
+			completed++
+		}
+		return nil
+	})
+	assert.NoError(t, k.RunUntil(context.Background(), AllPodsCompleted()))
+	assert.Equal(t, start.Add(60*time.Second), k.clock)
+	assert.Equal(t, 1, completed)
+	assert.Equal(t, []v1.PodPhase{v1.PodSucceeded}, podPhases(k))
+
+	// The submitter terminates at the first tick, while the pod is still running.
+	k = newKubeSim(&oneShotSubmitter{pods: []*v1.Pod{newCheckpointPod("pod-0")}})
+	assert.NoError(t, k.RunUntil(context.Background(),
+		AnyOf(SubmittersExhausted(), TicksElapsed(100))))
+	assert.Equal(t, start.Add(10*time.Second), k.clock)
+	assert.Equal(t, []v1.PodPhase{v1.PodRunning}, podPhases(k))
+
+	k = newKubeSim(&oneShotSubmitter{pods: []*v1.Pod{newCheckpointPod("pod-0")}})
+	assert.NoError(t, k.RunUntil(context.Background(),
+		AllOf(SubmittersExhausted(), TicksElapsed(3))))
+	assert.Equal(t, start.Add(30*time.Second), k.clock)
+}
+
+func TestKubeSimRunUntilAllPodsCompleted(t *testing.T) {
+	ctx := context.Background()
+
+	// The pod held by the scheduler for its pod group is not completed.
+	sched := scheduler.NewGenericScheduler(false)
+	sched.AddPredicate(predicates.PodFitsResourcesPred, predicates.PodFitsResources)
+	sched.EnableCoscheduling(300 * time.Second)
+	k, err := NewKubeSim(WithConfig(newCheckpointConfig(10)), WithScheduler(&sched))
+	assert.NoError(t, err)
+	start := k.clock
+	member := newCheckpointPod("member")
+	member.Labels = map[string]string{
+		scheduler.PodGroupNameLabel: "group", scheduler.PodGroupMinAvailableLabel: "2",
+	}
+	k.AddSubmitter("Pods", &endlessSubmitter{pods: []*v1.Pod{member}})
+	assert.NoError(t, k.RunUntil(ctx, AnyOf(AllPodsCompleted(), TicksElapsed(100))))
+	assert.Equal(t, start.Add(1000*time.Second), k.clock)
+
+	// The pods submitted before a snapshot are counted after resuming from it.
+	newKubeSim := func(state *SimState) *KubeSim {
+		binPacking := scheduler.NewBinPackingScheduler()
+		opts := []Option{WithConfig(newCheckpointConfig(10)), WithScheduler(&binPacking)}
+		if state == nil {
+			k, err := NewKubeSim(opts...)
+			assert.NoError(t, err)
+			return k
+		}
+		k, err := NewKubeSimFromSnapshot(state, opts...)
+		assert.NoError(t, err)
+		return k
+	}
+	k = newKubeSim(nil)
+	k.AddSubmitter("Pods", &endlessSubmitter{pods: []*v1.Pod{newCheckpointPod("pod-0")}})
+	assert.NoError(t, k.RunUntil(ctx, ClockReaches(start.Add(20*time.Second))))
+	state, err := k.Snapshot()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, state.SubmittedPods)
+
+	resumed := newKubeSim(state)
+	resumed.AddSubmitter("Pods", &endlessSubmitter{})
+	assert.NoError(t, resumed.RunUntil(ctx, AnyOf(AllPodsCompleted(), TicksElapsed(50))))
+	assert.Equal(t, start.Add(60*time.Second), resumed.clock)
+}
@@ -0,0 +1,232 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubesim
+
+import (
+	"sort"
+
+	"github.com/containerd/containerd/log"
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/config"
+	"simulator/pkg/metrics"
+	"simulator/pkg/node"
+	"simulator/pkg/submitter"
+	"simulator/pkg/trace"
+	"simulator/pkg/util"
+)
+
+// AddNode adds a copy of the node to the cluster at the current clock, with the node-level settings
+// of the config, like WithNodes. It can be called during the simulation, e.g., by a submitter.
+// A node of a node group of the autoscaler starts with the system pods of the template of the group.
+// Returns error if a node of the same name exists or failed to build the node.
+func (k *KubeSim) AddNode(nodeV1 *v1.Node) error {
+	if _, ok := k.nodes[nodeV1.Name]; ok {
+		return strongerrors.AlreadyExists(errors.Errorf("node %s already exists", nodeV1.Name))
+	}
+
+	systemPods, err := k.groupSystemPods(nodeV1.Name)
+	if err != nil {
+		return err
+	}
+	nodeSim, err := buildNodeFromV1(k.conf, nodeV1, systemPods, k.clock)
+	if err != nil {
+		return err
+	}
+	k.nodes[nodeV1.Name] = nodeSim
+	if err := k.recordNodeEvent(trace.Entry{Kind: trace.AddNode, Node: nodeV1}); err != nil {
+		return err
+	}
+
+	log.L.Infof("Node %s added", nodeV1.Name)
+	return k.writeEvents([]metrics.Event{
+		{Clock: k.clock.ToRFC3339(), Kind: metrics.NodeAddEvent, Node: nodeV1.Name},
+	})
+}
+
+// groupSystemPods builds the system pods of the template of the node group of the autoscaler on the
+// node of the name, or returns none if it is not a node of the groups.
+func (k *KubeSim) groupSystemPods(name string) ([]*v1.Pod, error) {
+	if k.autoscaler == nil {
+		return nil, nil
+	}
+	group, ok := k.autoscaler.GroupOf(name)
+	if !ok {
+		return nil, nil
+	}
+
+	for _, groupConf := range k.conf.Autoscaler.NodeGroups {
+		if groupConf.Name == group {
+			return config.BuildSystemPods(groupConf.Template.SystemPods, name)
+		}
+	}
+	return nil, nil
+}
+
+// DeleteNode deletes the node from the cluster at the current clock, e.g., by its failure or drain.
+// It can be called during the simulation, e.g., by a submitter.
+// The running pods on the node stop immediately, and are pushed back to the queue as pending pods,
+// as their controllers would recreate them. The system pods on the node are deleted with it.
+// Returns error if no node of the name exists.
+func (k *KubeSim) DeleteNode(name string) error {
+	nodeSim, ok := k.nodes[name]
+	if !ok {
+		return strongerrors.NotFound(errors.Errorf("no node named %s", name))
+	}
+
+	pods := nodeSim.PodList()
+	sort.Slice(pods, func(i, j int) bool {
+		return util.PodKeyFromNames(pods[i].ToV1().Namespace, pods[i].ToV1().Name) <
+			util.PodKeyFromNames(pods[j].ToV1().Namespace, pods[j].ToV1().Name)
+	})
+
+	events := []metrics.Event{}
+	clk := k.clock.ToRFC3339()
+	for _, p := range pods {
+		namespace, podName := p.ToV1().Namespace, p.ToV1().Name
+		if nodeSim.IsSystemPod(namespace, podName) || !p.IsRunning(k.clock) {
+			continue
+		}
+
+		p.Delete(k.clock)
+		events = append(events, metrics.Event{
+			Clock: clk,
+			Kind:  metrics.NodeEvictEvent,
+			Pod:   util.PodKeyFromNames(namespace, podName),
+			Node:  name,
+		})
+		if err := k.requeuePod(namespace, podName); err != nil {
+			return err
+		}
+	}
+	delete(k.nodes, name)
+	if err := k.recordNodeEvent(trace.Entry{Kind: trace.DeleteNode, NodeName: name}); err != nil {
+		return err
+	}
+	events = append(events, metrics.Event{Clock: clk, Kind: metrics.NodeDeleteEvent, Node: name})
+
+	log.L.Infof("Node %s deleted", name)
+	return k.writeEvents(events)
+}
+
+// TaintNode adds the taint to the node at the current clock, replacing the one of the same key and
+// effect, e.g., to dedicate the node or to drain it with a NoExecute taint.
+// It can be called during the simulation, e.g., by a submitter.
+// The running pods not tolerating a NoExecute taint are evicted at the tick, after their
+// tolerationSeconds if any, and pushed back to the queue (see node.Node.EvictIntolerantPods).
+// Returns error if no node of the name exists or the taint is invalid.
+func (k *KubeSim) TaintNode(name string, taint v1.Taint) error {
+	nodeSim, ok := k.nodes[name]
+	if !ok {
+		return strongerrors.NotFound(errors.Errorf("no node named %s", name))
+	}
+	if err := node.ValidateTaint(taint); err != nil {
+		return err
+	}
+
+	nodeSim.AddTaint(k.clock, taint)
+	if err := k.recordNodeEvent(trace.Entry{Kind: trace.TaintNode, NodeName: name, Taint: &taint}); err != nil {
+		return err
+	}
+	log.L.Infof("Node %s tainted with %s", name, taint.ToString())
+	return nil
+}
+
+// UntaintNode removes the taint of the key and the effect from the node.
+// Returns error if no node of the name exists or the node has no such taint.
+func (k *KubeSim) UntaintNode(name, key string, effect v1.TaintEffect) error {
+	nodeSim, ok := k.nodes[name]
+	if !ok {
+		return strongerrors.NotFound(errors.Errorf("no node named %s", name))
+	}
+	if !nodeSim.RemoveTaint(key, effect) {
+		return strongerrors.NotFound(errors.Errorf("no taint %s:%s on node %s", key, effect, name))
+	}
+	if err := k.recordNodeEvent(trace.Entry{
+		Kind: trace.UntaintNode, NodeName: name, Taint: &v1.Taint{Key: key, Effect: effect},
+	}); err != nil {
+		return err
+	}
+
+	log.L.Infof("Node %s untainted %s:%s", name, key, effect)
+	return nil
+}
+
+// SetNodeReady sets the Ready condition of the node at the current clock, e.g., by a transient
+// failure of its kubelet or network.
+// It can be called during the simulation, e.g., by a submitter.
+// A node not ready is tainted with the node.kubernetes.io/not-ready NoSchedule and NoExecute
+// taints, so that no pods are scheduled onto it, and the running pods not tolerating the taint are
+// evicted at the tick, after their tolerationSeconds if any, and pushed back to the queue (see
+// node.Node.SetReady).
+// Returns error if no node of the name exists.
+func (k *KubeSim) SetNodeReady(name string, ready bool) error {
+	nodeSim, ok := k.nodes[name]
+	if !ok {
+		return strongerrors.NotFound(errors.Errorf("no node named %s", name))
+	}
+	if !nodeSim.SetReady(k.clock, ready) {
+		return nil
+	}
+	if err := k.recordNodeEvent(trace.Entry{Kind: trace.SetNodeReady, NodeName: name, Ready: ready}); err != nil {
+		return err
+	}
+
+	kind, state := metrics.NodeNotReadyEvent, "not ready"
+	if ready {
+		kind, state = metrics.NodeReadyEvent, "ready"
+	}
+	log.L.Infof("Node %s %s", name, state)
+	return k.writeEvents([]metrics.Event{{Clock: k.clock.ToRFC3339(), Kind: kind, Node: name}})
+}
+
+// DegradeNode reduces the capacity and the allocatable resources of the node to those before any
+// degradation multiplied by the ratio of each resource, e.g., by thermal throttling or a noisy
+// neighbor, or restores them if ratios is empty.
+// It can be called during the simulation, e.g., by a submitter.
+// The running pods keep running (see node.Node.Degrade).
+// Returns error if no node of the name exists or a ratio is invalid.
+func (k *KubeSim) DegradeNode(name string, ratios map[v1.ResourceName]float64) error {
+	nodeSim, ok := k.nodes[name]
+	if !ok {
+		return strongerrors.NotFound(errors.Errorf("no node named %s", name))
+	}
+	if err := node.ValidateDegradation(ratios); err != nil {
+		return err
+	}
+	if len(ratios) == 0 && !nodeSim.IsDegraded() {
+		return nil
+	}
+
+	nodeSim.Degrade(ratios)
+	if err := k.recordNodeEvent(trace.Entry{Kind: trace.DegradeNode, NodeName: name, Ratios: ratios}); err != nil {
+		return err
+	}
+	if len(ratios) == 0 {
+		log.L.Infof("Node %s restored", name)
+	} else {
+		log.L.Infof("Node %s degraded by %v", name, ratios)
+	}
+	return k.writeEvents([]metrics.Event{
+		{Clock: k.clock.ToRFC3339(), Kind: metrics.NodeDegradeEvent, Node: name},
+	})
+}
+
+var _ = submitter.NodeManager(&KubeSim{})
+var _ = submitter.NodeTainter(&KubeSim{})
+var _ = submitter.NodeFaulter(&KubeSim{})
+var _ = trace.Cluster(&KubeSim{})
@@ -0,0 +1,373 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubesim
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm/predicates"
+
+	"simulator/pkg/autoscaler"
+	"simulator/pkg/clock"
+	"simulator/pkg/config"
+	"simulator/pkg/metrics"
+	"simulator/pkg/scheduler"
+	"simulator/pkg/submitter"
+	"simulator/pkg/trace"
+)
+
+// stepSubmitter runs each step at each call, then terminates.
+type stepSubmitter struct {
+	steps []func() []submitter.Event
+}
+
+func (s *stepSubmitter) Submit(
+	_ context.Context, _ clock.Clock, _ algorithm.NodeLister, _ metrics.Metrics,
+) ([]submitter.Event, error) {
+
+	if len(s.steps) == 0 {
+		return []submitter.Event{&submitter.TerminateSubmitterEvent{}}, nil
+	}
+
+	events := s.steps[0]()
+	s.steps = s.steps[1:]
+	return events, nil
+}
+
+func TestKubeSimAddAndDeleteNode(t *testing.T) {
+	binPacking := scheduler.NewBinPackingScheduler()
+	k, err := NewKubeSim(WithConfig(newCheckpointConfig(10)), WithScheduler(&binPacking))
+	assert.NoError(t, err)
+	nodeEvents := []metrics.EventKind{}
+	k.AddEventHandler(func(e metrics.Event) error {
+		if e.IsNodeEvent() {
+			nodeEvents = append(nodeEvents, e.Kind)
+		}
+		return nil
+	})
+
+	node1 := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: v1.NodeStatus{Allocatable: v1.ResourceList{
+			"cpu": resource.MustParse("2"), "memory": resource.MustParse("4Gi"),
+		}},
+	}
+
+	// pod-2 waits for node-1, then pod-0 and pod-1 on node-0 are pushed back to the queue.
+	k.AddSubmitter("Steps", &stepSubmitter{steps: []func() []submitter.Event{
+		func() []submitter.Event {
+			return []submitter.Event{
+				&submitter.SubmitEvent{Pod: newCheckpointPod("pod-0")},
+				&submitter.SubmitEvent{Pod: newCheckpointPod("pod-1")},
+				&submitter.SubmitEvent{Pod: newCheckpointPod("pod-2")},
+			}
+		},
+		func() []submitter.Event {
+			assert.NoError(t, k.AddNode(node1))
+			assert.EqualError(t, k.AddNode(node1), "node node-1 already exists")
+			return []submitter.Event{}
+		},
+		func() []submitter.Event {
+			assert.NoError(t, k.DeleteNode("node-0"))
+			assert.EqualError(t, k.DeleteNode("node-0"), "no node named node-0")
+			return []submitter.Event{}
+		},
+	}})
+	assert.NoError(t, k.Run(context.Background()))
+
+	nodes, err := k.List()
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 1)
+	assert.Equal(t, "node-1", nodes[0].Name)
+	assert.Equal(t, []metrics.EventKind{metrics.NodeAddEvent, metrics.NodeDeleteEvent}, nodeEvents)
+
+	pods, err := k.ListPods(labels.Everything())
+	assert.NoError(t, err)
+	assert.Len(t, pods, 3)
+	for _, p := range pods {
+		assert.Equal(t, "node-1", p.Spec.NodeName, p.Name)
+		assert.Equal(t, v1.PodSucceeded, p.Status.Phase, p.Name)
+	}
+}
+
+func TestKubeSimTaintNode(t *testing.T) {
+	conf := newCheckpointConfig(10)
+	conf.Cluster = append(conf.Cluster, config.NodeConfig{
+		Metadata: metav1.ObjectMeta{Name: "node-1"},
+		Spec: v1.NodeSpec{Taints: []v1.Taint{
+			{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule},
+		}},
+		Status: config.NodeStatus{Allocatable: map[v1.ResourceName]string{"cpu": "2", "memory": "4Gi"}},
+	})
+	binPacking := scheduler.NewBinPackingScheduler()
+	binPacking.AddPredicate(predicates.PodToleratesNodeTaintsPred, predicates.PodToleratesNodeTaints)
+	k, err := NewKubeSim(WithConfig(conf), WithScheduler(&binPacking))
+	assert.NoError(t, err)
+
+	tolerant := newCheckpointPod("pod-1")
+	tolerant.Spec.Tolerations = []v1.Toleration{{Operator: v1.TolerationOpExists}}
+
+	// pod-0 is evicted from node-0 by the NoExecute taint, and waits for node-1 to be untainted.
+	k.AddSubmitter("Steps", &stepSubmitter{steps: []func() []submitter.Event{
+		func() []submitter.Event {
+			return []submitter.Event{
+				&submitter.SubmitEvent{Pod: newCheckpointPod("pod-0")},
+				&submitter.SubmitEvent{Pod: tolerant},
+			}
+		},
+		func() []submitter.Event {
+			assert.NoError(t, k.TaintNode("node-0", v1.Taint{Key: "maintenance", Effect: v1.TaintEffectNoExecute}))
+			assert.EqualError(t, k.TaintNode("node-2", v1.Taint{Key: "maintenance"}), "no node named node-2")
+			assert.EqualError(t, k.TaintNode("node-0", v1.Taint{Key: "maintenance"}),
+				`invalid effect "" of taint maintenance`)
+			return []submitter.Event{}
+		},
+		func() []submitter.Event {
+			evicted := k.boundPods["default/pod-0"]
+			assert.Equal(t, "node-0", evicted.ToV1().Spec.NodeName)
+			assert.True(t, evicted.IsTerminating(k.clock))
+			assert.Equal(t, 1, k.pendingPods.Metrics().PendingPodsNum)
+
+			assert.NoError(t, k.UntaintNode("node-1", "dedicated", v1.TaintEffectNoSchedule))
+			assert.EqualError(t, k.UntaintNode("node-1", "dedicated", v1.TaintEffectNoSchedule),
+				"no taint dedicated:NoSchedule on node node-1")
+			return []submitter.Event{}
+		},
+	}})
+	assert.NoError(t, k.Run(context.Background()))
+
+	pods, err := k.ListPods(labels.Everything())
+	assert.NoError(t, err)
+	assert.Len(t, pods, 2)
+	for _, p := range pods {
+		if p.Name == "pod-0" {
+			assert.Equal(t, "node-1", p.Spec.NodeName)
+		}
+		assert.Equal(t, v1.PodSucceeded, p.Status.Phase, p.Name)
+	}
+}
+
+func TestKubeSimAutoscaler(t *testing.T) {
+	conf := newCheckpointConfig(10)
+	conf.Autoscaler = &config.AutoscalerConfig{
+		NodeGroups: []config.NodeGroupConfig{{
+			Name:    "pool",
+			MaxSize: 2,
+			Template: config.NodeConfig{Status: config.NodeStatus{Allocatable: map[v1.ResourceName]string{
+				"cpu": "2", "memory": "4Gi",
+			}}},
+		}},
+		ProvisioningSeconds: 20,
+	}
+	binPacking := scheduler.NewBinPackingScheduler()
+	k, err := NewKubeSim(WithConfig(conf), WithScheduler(&binPacking))
+	assert.NoError(t, err)
+	t0 := k.clock
+
+	// Two pods wait for a node of the group to be provisioned.
+	k.AddSubmitter("OneShot", &oneShotSubmitter{pods: []*v1.Pod{
+		newCheckpointPod("pod-0"), newCheckpointPod("pod-1"), newCheckpointPod("pod-2"), newCheckpointPod("pod-3"),
+	}})
+	assert.NoError(t, k.Run(context.Background()))
+
+	nodes, err := k.List()
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 2)
+
+	pods, err := k.ListPods(labels.Everything())
+	assert.NoError(t, err)
+	assert.Len(t, pods, 4)
+	onPool := 0
+	for _, p := range pods {
+		assert.Equal(t, v1.PodSucceeded, p.Status.Phase, p.Name)
+		if p.Spec.NodeName == "pool-0" {
+			onPool++
+			assert.Equal(t, t0.Add(30*time.Second).ToMetaV1(), *p.Status.StartTime, p.Name)
+		}
+	}
+	assert.Equal(t, 2, onPool)
+	assert.Equal(t, map[string]autoscaler.GroupMetrics{"pool": {Size: 1}}, k.autoscaler.Metrics())
+}
+
+func TestKubeSimAutoscalerSystemPods(t *testing.T) {
+	conf := newCheckpointConfig(10)
+	conf.Cluster = nil
+	conf.Autoscaler = &config.AutoscalerConfig{
+		NodeGroups: []config.NodeGroupConfig{{
+			Name:    "pool",
+			MinSize: 1,
+			MaxSize: 3,
+			Template: config.NodeConfig{
+				Status: config.NodeStatus{Allocatable: map[v1.ResourceName]string{"cpu": "2", "memory": "4Gi"}},
+				SystemPods: []config.SystemPodConfig{{
+					Name:     "kube-proxy",
+					Requests: map[v1.ResourceName]string{"cpu": "500m"},
+				}},
+			},
+		}},
+	}
+	binPacking := scheduler.NewBinPackingScheduler()
+	k, err := NewKubeSim(WithConfig(conf), WithScheduler(&binPacking))
+	assert.NoError(t, err)
+	assert.True(t, k.nodes["pool-0"].IsSystemPod("kube-system", "kube-proxy-pool-0"))
+
+	// Only one of the pods fits in the rest of each node, so that a node is added for the other.
+	k.AddSubmitter("OneShot", &oneShotSubmitter{pods: []*v1.Pod{
+		newCheckpointPod("pod-0"), newCheckpointPod("pod-1"),
+	}})
+	assert.NoError(t, k.Run(context.Background()))
+
+	assert.Equal(t, map[string]autoscaler.GroupMetrics{"pool": {Size: 2}}, k.autoscaler.Metrics())
+	assert.True(t, k.nodes["pool-1"].IsSystemPod("kube-system", "kube-proxy-pool-1"))
+	met := k.nodes["pool-1"].Metrics(k.clock)
+	assert.Equal(t, "500m", met.TotalResourceRequest.Cpu().String())
+
+	pods, err := k.ListPods(labels.Everything())
+	assert.NoError(t, err)
+	assert.Len(t, pods, 2)
+	for _, p := range pods {
+		assert.Equal(t, v1.PodSucceeded, p.Status.Phase, p.Name)
+	}
+}
+
+func TestKubeSimFaults(t *testing.T) {
+	conf := newCheckpointConfig(10)
+	conf.Cluster = append(conf.Cluster, config.NodeConfig{
+		Metadata: metav1.ObjectMeta{Name: "node-1"},
+		Status:   config.NodeStatus{Allocatable: map[v1.ResourceName]string{"cpu": "2", "memory": "4Gi"}},
+	})
+	conf.Faults = []config.FaultConfig{
+		{Kind: "degradation", Node: "node-1", At: "2019-01-01T00:00:00Z", Until: "2019-01-01T00:00:20Z",
+			Ratios: map[v1.ResourceName]float64{"cpu": 0.5}},
+		{Kind: "notReady", Node: "node-0", At: "2019-01-01T00:00:10Z", Until: "2019-01-01T00:00:30Z"},
+		{Kind: "crash", Node: "node-1", At: "2019-01-01T00:00:40Z", Until: "2019-01-01T00:00:50Z"},
+	}
+	binPacking := scheduler.NewBinPackingScheduler()
+	binPacking.AddPredicate(predicates.PodToleratesNodeTaintsPred, predicates.PodToleratesNodeTaints)
+	k, err := NewKubeSim(WithConfig(conf), WithScheduler(&binPacking))
+	assert.NoError(t, err)
+	nodeEvents := []metrics.EventKind{}
+	k.AddEventHandler(func(e metrics.Event) error {
+		if e.IsNodeEvent() {
+			nodeEvents = append(nodeEvents, e.Kind)
+		}
+		return nil
+	})
+
+	// node-1 fits one pod while degraded; the pods on node-0 are evicted while it is not ready, and
+	// the pods on node-1 are pushed back to the queue when it crashes.
+	k.AddSubmitter("OneShot", &oneShotSubmitter{pods: []*v1.Pod{
+		newCheckpointPod("pod-0"), newCheckpointPod("pod-1"), newCheckpointPod("pod-2"),
+	}})
+	assert.NoError(t, k.Run(context.Background()))
+
+	assert.Equal(t, []metrics.EventKind{
+		metrics.NodeDegradeEvent, metrics.NodeNotReadyEvent, metrics.NodeDegradeEvent, metrics.NodeReadyEvent,
+		metrics.NodeDeleteEvent, metrics.NodeAddEvent,
+	}, nodeEvents)
+
+	nodes, err := k.List()
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 2)
+	for _, n := range nodes {
+		assert.Equal(t, "2", n.Status.Allocatable.Cpu().String(), n.Name)
+		assert.Empty(t, n.Spec.Taints, n.Name)
+	}
+
+	pods, err := k.ListPods(labels.Everything())
+	assert.NoError(t, err)
+	assert.Len(t, pods, 3)
+	for _, p := range pods {
+		assert.Equal(t, v1.PodSucceeded, p.Status.Phase, p.Name)
+	}
+}
+
+func TestKubeSimReplayNodeEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	conf := newCheckpointConfig(10)
+	conf.TraceFile = filepath.Join(dir, "trace.jsonl")
+	conf.Faults = []config.FaultConfig{
+		{Kind: "notReady", Node: "node-0", At: "2019-01-01T00:00:10Z", Until: "2019-01-01T00:00:30Z"},
+	}
+	conf.Autoscaler = &config.AutoscalerConfig{
+		NodeGroups: []config.NodeGroupConfig{{
+			Name:    "pool",
+			MaxSize: 2,
+			Template: config.NodeConfig{Status: config.NodeStatus{Allocatable: map[v1.ResourceName]string{
+				"cpu": "2", "memory": "4Gi",
+			}}},
+		}},
+		ProvisioningSeconds: 20,
+	}
+
+	// run runs the simulation and returns the node events, and the nodes and the start times of the
+	// pods.
+	run := func(opts ...Option) ([]metrics.EventKind, map[string]string) {
+		binPacking := scheduler.NewBinPackingScheduler()
+		binPacking.AddPredicate(predicates.PodToleratesNodeTaintsPred, predicates.PodToleratesNodeTaints)
+		k, err := NewKubeSim(append([]Option{WithConfig(conf), WithScheduler(&binPacking)}, opts...)...)
+		assert.NoError(t, err)
+		nodeEvents := []metrics.EventKind{}
+		k.AddEventHandler(func(e metrics.Event) error {
+			if e.IsNodeEvent() {
+				nodeEvents = append(nodeEvents, e.Kind)
+			}
+			return nil
+		})
+		if len(opts) == 0 {
+			k.AddSubmitter("OneShot", &oneShotSubmitter{pods: []*v1.Pod{
+				newCheckpointPod("pod-0"), newCheckpointPod("pod-1"), newCheckpointPod("pod-2"),
+			}})
+		}
+		assert.NoError(t, k.Run(context.Background()))
+
+		pods, err := k.ListPods(labels.Everything())
+		assert.NoError(t, err)
+		placements := map[string]string{}
+		for _, p := range pods {
+			assert.Equal(t, v1.PodSucceeded, p.Status.Phase, p.Name)
+			placements[p.Name] = p.Spec.NodeName + " " + p.Status.StartTime.UTC().Format(time.RFC3339)
+		}
+		return nodeEvents, placements
+	}
+
+	// The pods on node-0 are evicted while it is not ready, and wait for a node of the group.
+	nodeEvents, placements := run()
+	assert.Contains(t, nodeEvents, metrics.NodeNotReadyEvent)
+	assert.Contains(t, nodeEvents, metrics.NodeAddEvent)
+	assert.Len(t, placements, 3)
+
+	// The faults and the scale-ups are replayed instead of the fault injector and the autoscaler.
+	replayer, err := trace.NewReplayerFromFile(conf.TraceFile)
+	assert.NoError(t, err)
+	conf.TraceFile = ""
+	replayedEvents, replayedPlacements := run(WithScheduler(replayer.Scheduler()), WithReplayer(replayer))
+	assert.Equal(t, nodeEvents, replayedEvents)
+	assert.Equal(t, placements, replayedPlacements)
+}
@@ -0,0 +1,408 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"simulator/pkg/scheduler"
+)
+
+var (
+	// DefaultLabelAllowlist is the allowlist of pod labels used by the simulator.
+	DefaultLabelAllowlist = []string{"pod-group.scheduling.sigs.k8s.io/*"}
+	// DefaultAnnotationAllowlist is the allowlist of pod annotations used by the simulator, e.g.,
+	// the resource usage spec and the deadline.
+	DefaultAnnotationAllowlist = []string{"simSpec", "simulator/*"}
+	// DefaultTolerationAllowlist is the allowlist of the keys of pod tolerations of the taints
+	// added by Kubernetes itself.
+	DefaultTolerationAllowlist = []string{"node.kubernetes.io/*", "node.alpha.kubernetes.io/*"}
+)
+
+// AnonymizeOptions are the options of an Anonymizer.
+type AnonymizeOptions struct {
+	// Salt is mixed into the hashes, so that the names cannot be recovered by hashing guesses.
+	Salt string
+	// KeepNodeNames keeps the names of nodes, to replay the trace on the original cluster config.
+	KeepNodeNames bool
+	// Labels and Annotations are the allowlists of the keys of pod labels and annotations to keep;
+	// the others are stripped.
+	// A key ending with "*" matches the keys with the prefix before it.
+	Labels      []string
+	Annotations []string
+	// Tolerations is the allowlist of the keys of pod tolerations to keep, in the same form; the
+	// others are stripped, except for the ones with empty keys, which tolerate every taint.
+	Tolerations []string
+}
+
+// Anonymizer anonymizes trace entries, so that traces derived from production clusters can be
+// shared publicly.
+// The names of pods, namespaces, and nodes are replaced with salted hashes, consistently across
+// entries, also in the affinities of pods; the labels, annotations, and tolerations not
+// allowlisted, the pod affinity terms selecting the labels not allowlisted, and the pod fields
+// irrelevant to scheduling (e.g., commands, environment variables, and volumes) are stripped.
+type Anonymizer struct {
+	opts AnonymizeOptions
+}
+
+// NewAnonymizer creates a new Anonymizer with the options.
+func NewAnonymizer(opts AnonymizeOptions) *Anonymizer {
+	return &Anonymizer{opts: opts}
+}
+
+// Entry returns the anonymized copy of the entry.
+func (a *Anonymizer) Entry(entry Entry) Entry {
+	if entry.Source != "" {
+		entry.Source = a.hash("submitter", entry.Source)
+	}
+	if entry.Pod != nil {
+		entry.Pod = a.Pod(entry.Pod)
+	}
+	if entry.PodNamespace != "" {
+		entry.PodNamespace = a.hash("ns", entry.PodNamespace)
+	}
+	if entry.PodName != "" {
+		entry.PodName = a.hash("pod", entry.PodName)
+	}
+	entry.NodeName = a.node(entry.NodeName)
+	if entry.ScheduleResult != nil {
+		result := *entry.ScheduleResult
+		result.SuggestedHost = a.node(result.SuggestedHost)
+		entry.ScheduleResult = &result
+	}
+	if entry.Node != nil {
+		entry.Node = a.Node(entry.Node)
+	}
+
+	return entry
+}
+
+// Node returns the anonymized copy of the node, with its resources, taints, and conditions, and with
+// the labels allowlisted for pods except for its hostname, which is hashed.
+func (a *Anonymizer) Node(node *v1.Node) *v1.Node {
+	anon := &v1.Node{
+		TypeMeta: node.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              a.node(node.Name),
+			CreationTimestamp: node.CreationTimestamp,
+			Labels:            filterKeys(node.Labels, a.opts.Labels),
+		},
+		Spec: v1.NodeSpec{
+			Unschedulable: node.Spec.Unschedulable,
+			Taints:        append([]v1.Taint(nil), node.Spec.Taints...),
+		},
+		Status: v1.NodeStatus{
+			Capacity:    node.Status.Capacity.DeepCopy(),
+			Allocatable: node.Status.Allocatable.DeepCopy(),
+			Conditions:  append([]v1.NodeCondition(nil), node.Status.Conditions...),
+		},
+	}
+
+	if hostname, ok := node.Labels[v1.LabelHostname]; ok {
+		if anon.Labels == nil {
+			anon.Labels = map[string]string{}
+		}
+		anon.Labels[v1.LabelHostname] = a.node(hostname)
+	}
+
+	return anon
+}
+
+// Pod returns the anonymized copy of the pod.
+func (a *Anonymizer) Pod(pod *v1.Pod) *v1.Pod {
+	anon := &v1.Pod{
+		TypeMeta: pod.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              a.hash("pod", pod.Name),
+			Namespace:         a.hash("ns", pod.Namespace),
+			CreationTimestamp: pod.CreationTimestamp,
+			Labels:            filterKeys(pod.Labels, a.opts.Labels),
+			Annotations:       filterKeys(pod.Annotations, a.opts.Annotations),
+		},
+		Spec: v1.PodSpec{
+			InitContainers:    a.containers(pod.Spec.InitContainers),
+			Containers:        a.containers(pod.Spec.Containers),
+			NodeSelector:      a.nodeSelector(pod.Spec.NodeSelector),
+			NodeName:          a.node(pod.Spec.NodeName),
+			Affinity:          a.affinity(pod.Spec.Affinity),
+			SchedulerName:     pod.Spec.SchedulerName,
+			Tolerations:       a.tolerations(pod.Spec.Tolerations),
+			PriorityClassName: pod.Spec.PriorityClassName,
+			Priority:          pod.Spec.Priority,
+		},
+		Status: v1.PodStatus{
+			Phase:             pod.Status.Phase,
+			NominatedNodeName: a.node(pod.Status.NominatedNodeName),
+		},
+	}
+
+	if name, ok := anon.Labels[scheduler.PodGroupNameLabel]; ok {
+		anon.Labels[scheduler.PodGroupNameLabel] = a.hash("group", name)
+	}
+	if nodes, ok := anon.Annotations[scheduler.PreferredNodesAnnotation]; ok {
+		names := strings.Split(nodes, ",")
+		for i, name := range names {
+			names[i] = a.node(strings.TrimSpace(name))
+		}
+		anon.Annotations[scheduler.PreferredNodesAnnotation] = strings.Join(names, ",")
+	}
+
+	return anon
+}
+
+// containers returns the containers with their resources, and with hashed images.
+func (a *Anonymizer) containers(containers []v1.Container) []v1.Container {
+	if containers == nil {
+		return nil
+	}
+
+	anon := make([]v1.Container, 0, len(containers))
+	for i, c := range containers {
+		anon = append(anon, v1.Container{
+			Name:      fmt.Sprintf("container-%d", i),
+			Image:     a.hash("image", c.Image),
+			Resources: *c.Resources.DeepCopy(),
+		})
+	}
+
+	return anon
+}
+
+func (a *Anonymizer) nodeSelector(selector map[string]string) map[string]string {
+	if selector == nil {
+		return nil
+	}
+
+	anon := make(map[string]string, len(selector))
+	for key, value := range selector {
+		if key == v1.LabelHostname {
+			value = a.node(value)
+		}
+		anon[key] = value
+	}
+
+	return anon
+}
+
+// affinity returns the affinity with hashed node names and namespaces, whose pod affinity terms
+// selecting the labels not allowlisted are stripped.
+func (a *Anonymizer) affinity(affinity *v1.Affinity) *v1.Affinity {
+	if affinity == nil {
+		return nil
+	}
+
+	anon := &v1.Affinity{}
+	if na := affinity.NodeAffinity; na != nil {
+		anonNA := &v1.NodeAffinity{}
+		if required := na.RequiredDuringSchedulingIgnoredDuringExecution; required != nil {
+			terms := make([]v1.NodeSelectorTerm, 0, len(required.NodeSelectorTerms))
+			for _, term := range required.NodeSelectorTerms {
+				terms = append(terms, a.nodeSelectorTerm(term))
+			}
+			anonNA.RequiredDuringSchedulingIgnoredDuringExecution = &v1.NodeSelector{NodeSelectorTerms: terms}
+		}
+		for _, term := range na.PreferredDuringSchedulingIgnoredDuringExecution {
+			anonNA.PreferredDuringSchedulingIgnoredDuringExecution = append(
+				anonNA.PreferredDuringSchedulingIgnoredDuringExecution,
+				v1.PreferredSchedulingTerm{
+					Weight:     term.Weight,
+					Preference: a.nodeSelectorTerm(term.Preference),
+				})
+		}
+		anon.NodeAffinity = anonNA
+	}
+	if pa := affinity.PodAffinity; pa != nil {
+		required, preferred := a.podAffinityTerms(
+			pa.RequiredDuringSchedulingIgnoredDuringExecution,
+			pa.PreferredDuringSchedulingIgnoredDuringExecution)
+		anon.PodAffinity = &v1.PodAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution:  required,
+			PreferredDuringSchedulingIgnoredDuringExecution: preferred,
+		}
+	}
+	if pa := affinity.PodAntiAffinity; pa != nil {
+		required, preferred := a.podAffinityTerms(
+			pa.RequiredDuringSchedulingIgnoredDuringExecution,
+			pa.PreferredDuringSchedulingIgnoredDuringExecution)
+		anon.PodAntiAffinity = &v1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution:  required,
+			PreferredDuringSchedulingIgnoredDuringExecution: preferred,
+		}
+	}
+
+	return anon
+}
+
+// nodeSelectorTerm returns the term with hashed node names, as nodeSelector.
+func (a *Anonymizer) nodeSelectorTerm(term v1.NodeSelectorTerm) v1.NodeSelectorTerm {
+	anonymize := func(reqs []v1.NodeSelectorRequirement, key string) []v1.NodeSelectorRequirement {
+		if reqs == nil {
+			return nil
+		}
+		anon := make([]v1.NodeSelectorRequirement, 0, len(reqs))
+		for _, req := range reqs {
+			values := make([]string, 0, len(req.Values))
+			for _, value := range req.Values {
+				if req.Key == key {
+					value = a.node(value)
+				}
+				values = append(values, value)
+			}
+			anon = append(anon, v1.NodeSelectorRequirement{
+				Key:      req.Key,
+				Operator: req.Operator,
+				Values:   values,
+			})
+		}
+		return anon
+	}
+
+	return v1.NodeSelectorTerm{
+		MatchExpressions: anonymize(term.MatchExpressions, v1.LabelHostname),
+		MatchFields:      anonymize(term.MatchFields, nodeNameField),
+	}
+}
+
+// nodeNameField is the field of nodes selected by their names in NodeSelectorTerm.MatchFields.
+const nodeNameField = "metadata.name"
+
+// podAffinityTerms returns the required and preferred terms with hashed namespaces, without the
+// ones selecting the labels not allowlisted.
+func (a *Anonymizer) podAffinityTerms(
+	required []v1.PodAffinityTerm,
+	preferred []v1.WeightedPodAffinityTerm,
+) ([]v1.PodAffinityTerm, []v1.WeightedPodAffinityTerm) {
+
+	var anonRequired []v1.PodAffinityTerm
+	for _, term := range required {
+		if anon, ok := a.podAffinityTerm(term); ok {
+			anonRequired = append(anonRequired, anon)
+		}
+	}
+	var anonPreferred []v1.WeightedPodAffinityTerm
+	for _, term := range preferred {
+		if anon, ok := a.podAffinityTerm(term.PodAffinityTerm); ok {
+			anonPreferred = append(anonPreferred,
+				v1.WeightedPodAffinityTerm{Weight: term.Weight, PodAffinityTerm: anon})
+		}
+	}
+
+	return anonRequired, anonPreferred
+}
+
+// podAffinityTerm returns the term with hashed namespaces and pod group names.
+// The second return value is false if the term selects a label not allowlisted.
+func (a *Anonymizer) podAffinityTerm(term v1.PodAffinityTerm) (v1.PodAffinityTerm, bool) {
+	anon := v1.PodAffinityTerm{TopologyKey: term.TopologyKey}
+	for _, ns := range term.Namespaces {
+		anon.Namespaces = append(anon.Namespaces, a.hash("ns", ns))
+	}
+	if term.LabelSelector == nil {
+		return anon, true
+	}
+
+	value := func(key, value string) string {
+		if key == scheduler.PodGroupNameLabel {
+			return a.hash("group", value)
+		}
+		return value
+	}
+	anon.LabelSelector = &metav1.LabelSelector{}
+	for key, v := range term.LabelSelector.MatchLabels {
+		if !allowed(key, a.opts.Labels) {
+			return v1.PodAffinityTerm{}, false
+		}
+		if anon.LabelSelector.MatchLabels == nil {
+			anon.LabelSelector.MatchLabels = map[string]string{}
+		}
+		anon.LabelSelector.MatchLabels[key] = value(key, v)
+	}
+	for _, req := range term.LabelSelector.MatchExpressions {
+		if !allowed(req.Key, a.opts.Labels) {
+			return v1.PodAffinityTerm{}, false
+		}
+		values := make([]string, 0, len(req.Values))
+		for _, v := range req.Values {
+			values = append(values, value(req.Key, v))
+		}
+		anon.LabelSelector.MatchExpressions = append(anon.LabelSelector.MatchExpressions,
+			metav1.LabelSelectorRequirement{Key: req.Key, Operator: req.Operator, Values: values})
+	}
+
+	return anon, true
+}
+
+// tolerations returns the tolerations whose keys are allowlisted or empty.
+func (a *Anonymizer) tolerations(tolerations []v1.Toleration) []v1.Toleration {
+	var anon []v1.Toleration
+	for _, toleration := range tolerations {
+		if toleration.Key == "" || allowed(toleration.Key, a.opts.Tolerations) {
+			anon = append(anon, *toleration.DeepCopy())
+		}
+	}
+
+	return anon
+}
+
+func (a *Anonymizer) node(name string) string {
+	if name == "" || a.opts.KeepNodeNames {
+		return name
+	}
+	return a.hash("node", name)
+}
+
+// hash returns the name anonymized with the prefix, or empty if the name is empty.
+func (a *Anonymizer) hash(prefix, name string) string {
+	if name == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, []byte(a.opts.Salt))
+	mac.Write([]byte(prefix + "/" + name)) // nolint: never returns error
+	return prefix + "-" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// filterKeys returns the entries of the map whose keys match the allowlist.
+func filterKeys(m map[string]string, allowlist []string) map[string]string {
+	filtered := map[string]string{}
+	for key, value := range m {
+		if allowed(key, allowlist) {
+			filtered[key] = value
+		}
+	}
+
+	if len(filtered) == 0 {
+		return nil
+	}
+	return filtered
+}
+
+// allowed returns whether the key matches the allowlist.
+func allowed(key string, allowlist []string) bool {
+	for _, allowed := range allowlist {
+		if key == allowed ||
+			strings.HasSuffix(allowed, "*") && strings.HasPrefix(key, strings.TrimSuffix(allowed, "*")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/scheduler/core"
+
+	"simulator/pkg/scheduler"
+)
+
+func TestAnonymizer(t *testing.T) {
+	pod := newPod("secret-job")
+	pod.Namespace = "team-a"
+	pod.Labels = map[string]string{
+		"app":                       "payroll",
+		scheduler.PodGroupNameLabel: "payroll-group",
+	}
+	pod.Annotations = map[string]string{
+		"simSpec":                          "- seconds: 10",
+		"owner":                            "alice@example.com",
+		scheduler.PreferredNodesAnnotation: "node-0, node-1",
+	}
+	pod.Spec.Containers = []v1.Container{{
+		Name:    "payroll",
+		Image:   "registry.example.com/payroll:1.0",
+		Command: []string{"run", "--password=secret"},
+		Resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{"cpu": resource.MustParse("1")},
+		},
+	}}
+
+	a := NewAnonymizer(AnonymizeOptions{
+		Salt:        "salt",
+		Labels:      DefaultLabelAllowlist,
+		Annotations: DefaultAnnotationAllowlist,
+	})
+
+	bind := a.Entry(Entry{
+		Kind:           Bind,
+		Pod:            pod,
+		ScheduleResult: &core.ScheduleResult{SuggestedHost: "node-0"},
+	})
+	anon := bind.Pod
+	assert.True(t, strings.HasPrefix(anon.Name, "pod-"))
+	assert.True(t, strings.HasPrefix(anon.Namespace, "ns-"))
+	assert.NotContains(t, anon.Labels, "app")
+	assert.NotEqual(t, "payroll-group", anon.Labels[scheduler.PodGroupNameLabel])
+	assert.Equal(t, map[string]string{
+		"simSpec":                          "- seconds: 10",
+		scheduler.PreferredNodesAnnotation: a.node("node-0") + "," + a.node("node-1"),
+	}, anon.Annotations)
+	assert.Equal(t, []v1.Container{{
+		Name:      "container-0",
+		Image:     a.hash("image", "registry.example.com/payroll:1.0"),
+		Resources: pod.Spec.Containers[0].Resources,
+	}}, anon.Spec.Containers)
+	assert.Equal(t, a.node("node-0"), bind.ScheduleResult.SuggestedHost)
+	assert.NotEqual(t, "node-0", bind.ScheduleResult.SuggestedHost)
+
+	// The names are consistent across entries.
+	del := a.Entry(Entry{Kind: Delete, PodNamespace: "team-a", PodName: "secret-job"})
+	assert.Equal(t, anon.Namespace, del.PodNamespace)
+	assert.Equal(t, anon.Name, del.PodName)
+
+	// The original pod is not modified.
+	assert.Equal(t, "secret-job", pod.Name)
+	assert.Equal(t, "payroll", pod.Labels["app"])
+
+	// Another salt gives other names.
+	other := NewAnonymizer(AnonymizeOptions{Salt: "other", KeepNodeNames: true})
+	assert.NotEqual(t, anon.Name, other.Pod(pod).Name)
+	assert.Equal(t, "node-0", other.Entry(Entry{Kind: Evict, NodeName: "node-0"}).NodeName)
+}
+
+func TestAnonymizerAffinityAndTolerations(t *testing.T) {
+	pod := newPod("secret-job")
+	pod.Spec.Affinity = &v1.Affinity{
+		NodeAffinity: &v1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+				NodeSelectorTerms: []v1.NodeSelectorTerm{{
+					MatchExpressions: []v1.NodeSelectorRequirement{
+						{Key: v1.LabelHostname, Operator: v1.NodeSelectorOpIn, Values: []string{"node-0"}},
+						{Key: v1.LabelZoneFailureDomain, Operator: v1.NodeSelectorOpIn, Values: []string{"zone-a"}},
+					},
+				}},
+			},
+		},
+		PodAntiAffinity: &v1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{
+				{
+					LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "payroll"}},
+					TopologyKey:   v1.LabelHostname,
+				},
+				{
+					LabelSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{scheduler.PodGroupNameLabel: "payroll-group"},
+					},
+					Namespaces:  []string{"team-a"},
+					TopologyKey: v1.LabelHostname,
+				},
+			},
+		},
+	}
+	pod.Spec.Tolerations = []v1.Toleration{
+		{Key: "dedicated", Operator: v1.TolerationOpEqual, Value: "payroll", Effect: v1.TaintEffectNoSchedule},
+		{Key: "node.kubernetes.io/not-ready", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoExecute},
+		{Operator: v1.TolerationOpExists},
+	}
+
+	a := NewAnonymizer(AnonymizeOptions{
+		Salt:        "salt",
+		Labels:      DefaultLabelAllowlist,
+		Tolerations: DefaultTolerationAllowlist,
+	})
+	anon := a.Pod(pod)
+	nodeTerms := func(p *v1.Pod) []v1.NodeSelectorTerm {
+		return p.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	}
+
+	// The node names are hashed as in nodeSelector.
+	assert.Equal(t, []v1.NodeSelectorRequirement{
+		{Key: v1.LabelHostname, Operator: v1.NodeSelectorOpIn, Values: []string{a.node("node-0")}},
+		{Key: v1.LabelZoneFailureDomain, Operator: v1.NodeSelectorOpIn, Values: []string{"zone-a"}},
+	}, nodeTerms(anon)[0].MatchExpressions)
+	// The term selecting the label stripped is stripped, and the pod group and namespace are hashed.
+	assert.Equal(t, []v1.PodAffinityTerm{{
+		LabelSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{scheduler.PodGroupNameLabel: a.hash("group", "payroll-group")},
+		},
+		Namespaces:  []string{a.hash("ns", "team-a")},
+		TopologyKey: v1.LabelHostname,
+	}}, anon.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution)
+	assert.Equal(t, pod.Spec.Tolerations[1:], anon.Spec.Tolerations)
+
+	// The original pod is not modified.
+	assert.Equal(t, "node-0", nodeTerms(pod)[0].MatchExpressions[0].Values[0])
+}
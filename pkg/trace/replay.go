@@ -0,0 +1,374 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"context"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/metrics"
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
+	"simulator/pkg/submitter"
+	"simulator/pkg/util"
+)
+
+// Replayer replays a trace, providing submitters and a scheduler that return the recorded events
+// at the recorded clocks.
+// The submitters also change the nodes as the recorded submitters did (e.g., the faults injected by
+// them), while the other node events are replayed by the simulation itself (see ApplyNodeChanges and
+// Kills).
+// The simulation must be configured in the same way as the recorded one (e.g., cluster, tick, and
+// startClock).
+type Replayer struct {
+	// submitter replays the events of all the recorded submitters, and submitters those of each.
+	submitter  *replaySubmitter
+	submitters map[string]*replaySubmitter
+	scheduler  *replayScheduler
+	// nodeEvents are the node changes made outside the submitters and the pods killed by their
+	// nodes.
+	nodeEvents []timedEntry
+}
+
+// Cluster is the simulated cluster whose nodes are changed as recorded.
+type Cluster interface {
+	submitter.NodeManager
+	submitter.NodeTainter
+	submitter.NodeFaulter
+}
+
+type timedEntry struct {
+	at    clock.Clock
+	entry Entry
+}
+
+// NewReplayer creates a new Replayer of the entries.
+// Returns error if the entries have invalid clocks or lack the fields of their kinds.
+func NewReplayer(entries []Entry) (*Replayer, error) {
+	r := &Replayer{
+		submitter:  newReplaySubmitter(),
+		submitters: map[string]*replaySubmitter{},
+		scheduler:  &replayScheduler{},
+		nodeEvents: []timedEntry{},
+	}
+
+	for _, entry := range entries {
+		t, err := time.Parse(time.RFC3339, entry.Clock)
+		if err != nil {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("invalid clock of trace entry %q: %s", entry.Clock, err.Error()))
+		}
+		timed := timedEntry{at: clock.NewClock(t), entry: entry}
+
+		switch entry.Kind {
+		case Submit, Delete, Update, TerminateSubmitter:
+			r.addSubmitterEntry(timed)
+		case Bind, Evict:
+			r.scheduler.entries = append(r.scheduler.entries, timed)
+		case AddNode, DeleteNode, TaintNode, UntaintNode, SetNodeReady, DegradeNode:
+			if err := validateNodeChange(entry); err != nil {
+				return nil, err
+			}
+			if entry.Source != "" {
+				r.addSubmitterEntry(timed)
+			} else {
+				r.nodeEvents = append(r.nodeEvents, timed)
+			}
+		case OOMKill, TaintEvict, PressureEvict:
+			r.nodeEvents = append(r.nodeEvents, timed)
+		default:
+			return nil, strongerrors.InvalidArgument(errors.Errorf("unknown trace entry kind %q", entry.Kind))
+		}
+	}
+
+	return r, nil
+}
+
+// addSubmitterEntry adds the entry of a recorded submitter to the merged submitter and to the one of
+// its source.
+// The node changes do not make their sources awaited for termination, e.g., those of a submitter
+// that only changed nodes and never terminated, but the replay submitters terminate only after
+// applying them.
+func (r *Replayer) addSubmitterEntry(timed timedEntry) {
+	source := timed.entry.Source
+	sub, ok := r.submitters[source]
+	if !ok {
+		sub = newReplaySubmitter()
+		r.submitters[source] = sub
+	}
+
+	for _, s := range []*replaySubmitter{r.submitter, sub} {
+		s.entries = append(s.entries, timed)
+		if !timed.entry.Kind.IsNodeChange() {
+			s.sources[source] = true
+		}
+	}
+}
+
+// validateNodeChange returns error if the node change lacks the node or the taint of its kind.
+func validateNodeChange(entry Entry) error {
+	switch {
+	case entry.Kind == AddNode && entry.Node == nil:
+		return strongerrors.InvalidArgument(errors.Errorf("no node of %s at %s", entry.Kind, entry.Clock))
+	case (entry.Kind == TaintNode || entry.Kind == UntaintNode) && entry.Taint == nil:
+		return strongerrors.InvalidArgument(errors.Errorf("no taint of %s at %s", entry.Kind, entry.Clock))
+	}
+	return nil
+}
+
+// NewReplayerFromFile creates a new Replayer of the trace file at the path.
+func NewReplayerFromFile(path string) (*Replayer, error) {
+	entries, err := ReadTrace(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewReplayer(entries)
+}
+
+// Submitter returns the submitter.Submitter that replays the events of all the recorded submitters.
+// It terminates when all the recorded submitters have terminated.
+// The node changes of a clock are applied before the events of the clock are consumed; add
+// Submitters instead to replay them in the order of the recorded submitters.
+func (r *Replayer) Submitter() submitter.Submitter {
+	return r.submitter
+}
+
+// Submitters returns the submitter.Submitter replaying the events of each recorded submitter, by
+// its name, which are to be added with the same names, so that they are called in the recorded
+// order.
+// Each of them terminates when the recorded one has terminated.
+func (r *Replayer) Submitters() map[string]submitter.Submitter {
+	subs := make(map[string]submitter.Submitter, len(r.submitters))
+	for name, sub := range r.submitters {
+		subs[name] = sub
+	}
+	return subs
+}
+
+// Scheduler returns the scheduler.Scheduler that replays the recorded scheduler events.
+func (r *Replayer) Scheduler() scheduler.Scheduler {
+	return r.scheduler
+}
+
+// SkipUntil drops the recorded events at or before the clock, which have been consumed by a
+// simulation resumed from a checkpoint (see kubesim.Checkpoint.ConsumedUntil).
+func (r *Replayer) SkipUntil(clock clock.Clock) {
+	r.submitter.skipUntil(clock)
+	for _, sub := range r.submitters {
+		sub.skipUntil(clock)
+	}
+
+	for len(r.scheduler.entries) > 0 && !clock.Before(r.scheduler.entries[0].at) {
+		r.scheduler.entries = r.scheduler.entries[1:]
+	}
+
+	for len(r.nodeEvents) > 0 && !clock.Before(r.nodeEvents[0].at) {
+		r.nodeEvents = r.nodeEvents[1:]
+	}
+}
+
+// Kills returns the recorded pods killed by their nodes at or before the clock, which the
+// simulation kills before its own evictions at the tick.
+func (r *Replayer) Kills(clock clock.Clock) []Entry {
+	kills := []Entry{}
+	for len(r.nodeEvents) > 0 && !clock.Before(r.nodeEvents[0].at) && r.nodeEvents[0].entry.Kind.IsKill() {
+		kills = append(kills, r.nodeEvents[0].entry)
+		r.nodeEvents = r.nodeEvents[1:]
+	}
+
+	return kills
+}
+
+// ApplyNodeChanges applies the recorded node changes made outside the submitters (e.g., by the
+// autoscaler) at or before the clock to the cluster, which the simulation does instead of its
+// autoscaler at the tick.
+// Returns error if failed to apply a change.
+func (r *Replayer) ApplyNodeChanges(clock clock.Clock, cluster Cluster) error {
+	for len(r.nodeEvents) > 0 && !clock.Before(r.nodeEvents[0].at) && r.nodeEvents[0].entry.Kind.IsNodeChange() {
+		entry := r.nodeEvents[0].entry
+		r.nodeEvents = r.nodeEvents[1:]
+		if err := applyNodeChange(entry, cluster); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NextNodeEvent returns the clock of the next recorded node event replayed by the simulation.
+// The second return value is false if none.
+func (r *Replayer) NextNodeEvent(clock clock.Clock) (clock.Clock, bool) {
+	return nextEntryClock(r.nodeEvents, clock)
+}
+
+// applyNodeChange applies the recorded node change to the cluster.
+func applyNodeChange(entry Entry, cluster Cluster) error {
+	switch entry.Kind {
+	case AddNode:
+		return cluster.AddNode(entry.Node)
+	case DeleteNode:
+		return cluster.DeleteNode(entry.NodeName)
+	case TaintNode:
+		return cluster.TaintNode(entry.NodeName, *entry.Taint)
+	case UntaintNode:
+		return cluster.UntaintNode(entry.NodeName, entry.Taint.Key, entry.Taint.Effect)
+	case SetNodeReady:
+		return cluster.SetNodeReady(entry.NodeName, entry.Ready)
+	default: // DegradeNode
+		return cluster.DegradeNode(entry.NodeName, entry.Ratios)
+	}
+}
+
+type replaySubmitter struct {
+	entries []timedEntry
+	// sources is the set of recorded submitters that have not terminated.
+	sources map[string]bool
+}
+
+func newReplaySubmitter() *replaySubmitter {
+	return &replaySubmitter{sources: map[string]bool{}}
+}
+
+// skipUntil drops the entries at or before the clock.
+func (s *replaySubmitter) skipUntil(clock clock.Clock) {
+	for len(s.entries) > 0 && !clock.Before(s.entries[0].at) {
+		if entry := s.entries[0].entry; entry.Kind == TerminateSubmitter {
+			delete(s.sources, entry.Source)
+		}
+		s.entries = s.entries[1:]
+	}
+}
+
+// Submit implements submitter.Submitter interface.
+// Returns error if the nodeLister does not implement Cluster when a recorded node change is to be
+// applied, or failed to apply it.
+func (s *replaySubmitter) Submit(
+	_ context.Context, clock clock.Clock, nodeLister algorithm.NodeLister, met metrics.Metrics,
+) ([]submitter.Event, error) {
+
+	events := []submitter.Event{}
+	for len(s.entries) > 0 && !clock.Before(s.entries[0].at) {
+		entry := s.entries[0].entry
+		s.entries = s.entries[1:]
+
+		switch entry.Kind {
+		case Submit:
+			events = append(events, &submitter.SubmitEvent{Pod: entry.Pod.DeepCopy()})
+		case Delete:
+			events = append(events, &submitter.DeleteEvent{
+				PodNamespace: entry.PodNamespace,
+				PodName:      entry.PodName,
+			})
+		case Update:
+			events = append(events, &submitter.UpdateEvent{
+				PodNamespace: entry.PodNamespace,
+				PodName:      entry.PodName,
+				NewPod:       entry.Pod.DeepCopy(),
+			})
+		case TerminateSubmitter:
+			delete(s.sources, entry.Source)
+		default: // node changes
+			cluster, ok := nodeLister.(Cluster)
+			if !ok {
+				return []submitter.Event{}, strongerrors.InvalidArgument(
+					errors.New("replaying node changes requires a Cluster"))
+			}
+			if err := applyNodeChange(entry, cluster); err != nil {
+				return []submitter.Event{}, err
+			}
+		}
+	}
+
+	if len(s.sources) == 0 && len(s.entries) == 0 {
+		events = append(events, &submitter.TerminateSubmitterEvent{})
+	}
+
+	return events, nil
+}
+
+// NextWakeup implements submitter.Waker interface.
+// Returns the clock of the next recorded event.
+func (s *replaySubmitter) NextWakeup(clock clock.Clock) (clock.Clock, bool) {
+	return nextEntryClock(s.entries, clock)
+}
+
+var _ = submitter.Submitter(&replaySubmitter{})
+var _ = submitter.Waker(&replaySubmitter{})
+
+type replayScheduler struct {
+	entries []timedEntry
+}
+
+// Schedule implements scheduler.Scheduler interface.
+// Returns error if a recorded pod to be bound is not pending, i.e., the replay has diverged.
+func (s *replayScheduler) Schedule(
+	_ context.Context,
+	clock clock.Clock,
+	pendingPods queue.PodQueue,
+	nodeLister algorithm.NodeLister,
+	nodeInfoMap map[string]*nodeinfo.NodeInfo,
+) ([]scheduler.Event, error) {
+
+	events := []scheduler.Event{}
+	for len(s.entries) > 0 && !clock.Before(s.entries[0].at) {
+		entry := s.entries[0].entry
+		s.entries = s.entries[1:]
+
+		switch entry.Kind {
+		case Bind:
+			if !pendingPods.Delete(entry.Pod.Namespace, entry.Pod.Name) {
+				return []scheduler.Event{}, strongerrors.NotFound(errors.Errorf(
+					"replay diverged: pod %s to be bound is not pending at %s",
+					util.PodKeyFromNames(entry.Pod.Namespace, entry.Pod.Name), clock.ToRFC3339()))
+			}
+			events = append(events, &scheduler.BindEvent{
+				Pod:            entry.Pod.DeepCopy(),
+				ScheduleResult: *entry.ScheduleResult,
+			})
+		case Evict:
+			events = append(events, &scheduler.DeleteEvent{
+				PodNamespace: entry.PodNamespace,
+				PodName:      entry.PodName,
+				NodeName:     entry.NodeName,
+			})
+		}
+	}
+
+	return events, nil
+}
+
+// NextWakeup implements scheduler.Waker interface.
+// Returns the clock of the next recorded event.
+func (s *replayScheduler) NextWakeup(clock clock.Clock) (clock.Clock, bool) {
+	return nextEntryClock(s.entries, clock)
+}
+
+// nextEntryClock returns the clock of the first entry, or false if none.
+func nextEntryClock(entries []timedEntry, clock clock.Clock) (clock.Clock, bool) {
+	if len(entries) == 0 {
+		return clock, false
+	}
+	return entries[0].at, true
+}
+
+var _ = scheduler.Scheduler(&replayScheduler{})
+var _ = scheduler.Waker(&replayScheduler{})
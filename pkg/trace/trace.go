@@ -0,0 +1,283 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package trace records the inputs consumed by a simulation into a trace file, and replays them.
+//
+// A trace records the events returned from the submitters and the scheduler at each clock, in the
+// order KubeSim consumed them, as well as the changes of the nodes (e.g., the faults injected by the
+// submitters and the scale-ups and scale-downs of the autoscaler) and the pods killed by their nodes
+// (e.g., OOM kills and evictions).
+// Because the outputs of submitters and schedulers are recorded, random draws and other
+// nondeterminism inside them do not affect the replay; the nodes are changed as recorded, whatever
+// drew the changes.
+package trace
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/core"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/logfile"
+	"simulator/pkg/scheduler"
+	"simulator/pkg/submitter"
+)
+
+// Kind is the kind of an Entry.
+type Kind string
+
+const (
+	// Submit is a submitter.SubmitEvent.
+	Submit Kind = "Submit"
+	// Delete is a submitter.DeleteEvent.
+	Delete Kind = "Delete"
+	// Update is a submitter.UpdateEvent.
+	Update Kind = "Update"
+	// TerminateSubmitter is a submitter.TerminateSubmitterEvent.
+	TerminateSubmitter Kind = "TerminateSubmitter"
+	// Bind is a scheduler.BindEvent.
+	Bind Kind = "Bind"
+	// Evict is a scheduler.DeleteEvent.
+	Evict Kind = "Evict"
+
+	// AddNode is a node added to the cluster (see submitter.NodeManager).
+	AddNode Kind = "AddNode"
+	// DeleteNode is a node deleted from the cluster.
+	DeleteNode Kind = "DeleteNode"
+	// TaintNode is a taint added to a node (see submitter.NodeTainter).
+	TaintNode Kind = "TaintNode"
+	// UntaintNode is a taint removed from a node.
+	UntaintNode Kind = "UntaintNode"
+	// SetNodeReady is a change of the Ready condition of a node (see submitter.NodeFaulter).
+	SetNodeReady Kind = "SetNodeReady"
+	// DegradeNode is a degradation of a node, or its restoration if Ratios is empty.
+	DegradeNode Kind = "DegradeNode"
+
+	// OOMKill is a pod killed by its node for using more memory than its limit.
+	OOMKill Kind = "OOMKill"
+	// TaintEvict is a pod evicted by the NoExecute taints of its node.
+	TaintEvict Kind = "TaintEvict"
+	// PressureEvict is a pod evicted by its node under memory pressure.
+	PressureEvict Kind = "PressureEvict"
+)
+
+// IsNodeChange returns whether the kind is a change of a node.
+func (k Kind) IsNodeChange() bool {
+	switch k {
+	case AddNode, DeleteNode, TaintNode, UntaintNode, SetNodeReady, DegradeNode:
+		return true
+	}
+	return false
+}
+
+// IsKill returns whether the kind is a pod killed by its node.
+func (k Kind) IsKill() bool {
+	return k == OOMKill || k == TaintEvict || k == PressureEvict
+}
+
+// Entry is an input consumed by a simulation at one clock.
+type Entry struct {
+	Clock string `json:"clock"`
+	Kind  Kind   `json:"kind"`
+	// Source is the name of the submitter that emitted the event or changed the node, or empty for
+	// the scheduler events, the pods killed by their nodes, and the node changes made outside the
+	// submitters (e.g., by the autoscaler).
+	Source string `json:"source,omitempty"`
+
+	Pod            *v1.Pod              `json:"pod,omitempty"`
+	PodNamespace   string               `json:"podNamespace,omitempty"`
+	PodName        string               `json:"podName,omitempty"`
+	NodeName       string               `json:"nodeName,omitempty"`
+	ScheduleResult *core.ScheduleResult `json:"scheduleResult,omitempty"`
+
+	// Node is the node added by an AddNode.
+	Node *v1.Node `json:"node,omitempty"`
+	// Taint is the taint added by a TaintNode, or the key and the effect of the one removed by an
+	// UntaintNode.
+	Taint *v1.Taint `json:"taint,omitempty"`
+	// Ready is the Ready condition set by a SetNodeReady.
+	Ready bool `json:"ready,omitempty"`
+	// Ratios are the ratios of the capacity of the node degraded by a DegradeNode.
+	Ratios map[v1.ResourceName]float64 `json:"ratios,omitempty"`
+}
+
+// Recorder writes entries to a trace file in JSON lines.
+type Recorder struct {
+	file *logfile.Writer
+	enc  *json.Encoder
+	// anonymizer anonymizes the entries if not nil.
+	anonymizer *Anonymizer
+}
+
+// NewRecorder creates a new Recorder writing to the file at the path, compressed and rotated with
+// the options.
+// Returns error if failed to create the file.
+func NewRecorder(path string, opts logfile.Options) (*Recorder, error) {
+	if path == "" {
+		return nil, strongerrors.InvalidArgument(errors.New("trace file path must not be empty"))
+	}
+
+	file, err := logfile.NewWriter(path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Recorder{
+		file: file,
+		enc:  json.NewEncoder(file),
+	}, nil
+}
+
+// SetAnonymizer makes this Recorder anonymize the entries with the anonymizer before recording.
+func (r *Recorder) SetAnonymizer(anonymizer *Anonymizer) {
+	r.anonymizer = anonymizer
+}
+
+// RecordEntries records the entries, e.g., read from another trace.
+func (r *Recorder) RecordEntries(entries []Entry) error {
+	for _, entry := range entries {
+		if err := r.record(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Recorder) record(entry Entry) error {
+	if r.anonymizer != nil {
+		entry = r.anonymizer.Entry(entry)
+	}
+	return r.enc.Encode(&entry)
+}
+
+// RecordSubmitterEvents records the events returned from the submitter at the clock.
+// The pods are copied, so that later modifications by KubeSim are not recorded.
+func (r *Recorder) RecordSubmitterEvents(clock clock.Clock, source string, events []submitter.Event) error {
+	for _, e := range events {
+		entry := Entry{Clock: clock.ToRFC3339(), Source: source}
+
+		switch ev := e.(type) {
+		case *submitter.SubmitEvent:
+			entry.Kind = Submit
+			entry.Pod = ev.Pod.DeepCopy()
+		case *submitter.DeleteEvent:
+			entry.Kind = Delete
+			entry.PodNamespace = ev.PodNamespace
+			entry.PodName = ev.PodName
+		case *submitter.UpdateEvent:
+			entry.Kind = Update
+			entry.PodNamespace = ev.PodNamespace
+			entry.PodName = ev.PodName
+			entry.Pod = ev.NewPod.DeepCopy()
+		case *submitter.TerminateSubmitterEvent:
+			entry.Kind = TerminateSubmitter
+		default:
+			return strongerrors.InvalidArgument(errors.Errorf("unknown submitter event %T", e))
+		}
+
+		if err := r.record(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RecordSchedulerEvents records the events returned from the scheduler at the clock.
+func (r *Recorder) RecordSchedulerEvents(clock clock.Clock, events []scheduler.Event) error {
+	for _, e := range events {
+		entry := Entry{Clock: clock.ToRFC3339()}
+
+		switch ev := e.(type) {
+		case *scheduler.BindEvent:
+			result := ev.ScheduleResult
+			entry.Kind = Bind
+			entry.Pod = ev.Pod.DeepCopy()
+			entry.ScheduleResult = &result
+		case *scheduler.DeleteEvent:
+			entry.Kind = Evict
+			entry.PodNamespace = ev.PodNamespace
+			entry.PodName = ev.PodName
+			entry.NodeName = ev.NodeName
+		default:
+			return strongerrors.InvalidArgument(errors.Errorf("unknown scheduler event %T", e))
+		}
+
+		if err := r.record(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RecordNodeEvent records the node change or the pod killed by its node at the clock, made by the
+// submitter of the source, or outside the submitters if empty.
+// The node and the taint are copied, so that later modifications by KubeSim are not recorded.
+// Returns error if the entry is of another kind.
+func (r *Recorder) RecordNodeEvent(clock clock.Clock, source string, entry Entry) error {
+	if !entry.Kind.IsNodeChange() && !entry.Kind.IsKill() {
+		return strongerrors.InvalidArgument(errors.Errorf("%s is not a node event", entry.Kind))
+	}
+
+	entry.Clock = clock.ToRFC3339()
+	entry.Source = source
+	if entry.Node != nil {
+		entry.Node = entry.Node.DeepCopy()
+	}
+	if entry.Taint != nil {
+		entry.Taint = entry.Taint.DeepCopy()
+	}
+
+	return r.record(entry)
+}
+
+// Close flushes the recorded entries and closes the trace file.
+func (r *Recorder) Close() error {
+	return r.file.Close()
+}
+
+// ReadTrace reads all entries from the trace file at the path, which may be compressed or rotated
+// (see logfile.Open).
+func ReadTrace(path string) ([]Entry, error) {
+	file, err := logfile.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return readEntries(file)
+}
+
+func readEntries(reader io.Reader) ([]Entry, error) {
+	entries := []Entry{}
+	dec := json.NewDecoder(reader)
+	for {
+		var entry Entry
+		if err := dec.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("invalid trace entry %d: %s", len(entries), err.Error()))
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,231 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/scheduler/core"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/logfile"
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
+	"simulator/pkg/submitter"
+)
+
+func newPod(name string) *v1.Pod {
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "trace")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "trace.jsonl")
+
+	t0 := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	t1 := t0.Add(10 * time.Second)
+
+	rec, err := NewRecorder(path, logfile.Options{})
+	assert.NoError(t, err)
+
+	pod := newPod("pod-0")
+	assert.NoError(t, rec.RecordSubmitterEvents(t0, "s", []submitter.Event{
+		&submitter.SubmitEvent{Pod: pod},
+		&submitter.SubmitEvent{Pod: newPod("pod-1")},
+	}))
+	pod.Spec.NodeName = "modified after submission" // not recorded
+	assert.NoError(t, rec.RecordSchedulerEvents(t1, []scheduler.Event{
+		&scheduler.BindEvent{Pod: newPod("pod-0"), ScheduleResult: core.ScheduleResult{SuggestedHost: "node-0"}},
+	}))
+	assert.NoError(t, rec.RecordSubmitterEvents(t1, "s", []submitter.Event{
+		&submitter.DeleteEvent{PodNamespace: "default", PodName: "pod-1"},
+		&submitter.TerminateSubmitterEvent{},
+	}))
+	assert.NoError(t, rec.Close())
+
+	replayer, err := NewReplayerFromFile(path)
+	assert.NoError(t, err)
+	subm := replayer.Submitter()
+	sched := replayer.Scheduler()
+	q := queue.NewFIFOQueue()
+
+	// t0
+	events, err := subm.Submit(ctx, t0, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []submitter.Event{
+		&submitter.SubmitEvent{Pod: newPod("pod-0")},
+		&submitter.SubmitEvent{Pod: newPod("pod-1")},
+	}, events)
+	for _, e := range events {
+		assert.NoError(t, q.Push(e.(*submitter.SubmitEvent).Pod))
+	}
+
+	schedEvents, err := sched.Schedule(ctx, t0, q, nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, schedEvents)
+
+	// t1
+	events, err = subm.Submit(ctx, t1, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []submitter.Event{
+		&submitter.DeleteEvent{PodNamespace: "default", PodName: "pod-1"},
+		&submitter.TerminateSubmitterEvent{},
+	}, events)
+
+	schedEvents, err = sched.Schedule(ctx, t1, q, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []scheduler.Event{
+		&scheduler.BindEvent{Pod: newPod("pod-0"), ScheduleResult: core.ScheduleResult{SuggestedHost: "node-0"}},
+	}, schedEvents)
+
+	// The bound pod has been removed from the queue.
+	front, err := q.Front()
+	assert.NoError(t, err)
+	assert.Equal(t, "pod-1", front.Name)
+}
+
+func TestReplayDiverged(t *testing.T) {
+	ctx := context.Background()
+	replayer, err := NewReplayer([]Entry{{
+		Clock:          "2019-01-01T00:00:00Z",
+		Kind:           Bind,
+		Pod:            newPod("pod-0"),
+		ScheduleResult: &core.ScheduleResult{SuggestedHost: "node-0"},
+	}})
+	assert.NoError(t, err)
+
+	_, err = replayer.Scheduler().Schedule(
+		ctx, clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)), queue.NewFIFOQueue(), nil, nil)
+	assert.EqualError(t, err,
+		"replay diverged: pod default/pod-0 to be bound is not pending at 2019-01-01T00:00:00Z")
+}
+
+// fakeCluster records the node changes applied to it.
+type fakeCluster struct {
+	changes []string
+}
+
+func (c *fakeCluster) List() ([]*v1.Node, error) { return []*v1.Node{}, nil }
+
+func (c *fakeCluster) AddNode(node *v1.Node) error {
+	c.changes = append(c.changes, "add "+node.Name)
+	return nil
+}
+
+func (c *fakeCluster) DeleteNode(name string) error {
+	c.changes = append(c.changes, "delete "+name)
+	return nil
+}
+
+func (c *fakeCluster) TaintNode(name string, taint v1.Taint) error {
+	c.changes = append(c.changes, "taint "+name+" "+taint.Key)
+	return nil
+}
+
+func (c *fakeCluster) UntaintNode(name, key string, effect v1.TaintEffect) error {
+	c.changes = append(c.changes, "untaint "+name+" "+key)
+	return nil
+}
+
+func (c *fakeCluster) SetNodeReady(name string, ready bool) error {
+	if ready {
+		c.changes = append(c.changes, "ready "+name)
+	} else {
+		c.changes = append(c.changes, "not ready "+name)
+	}
+	return nil
+}
+
+func (c *fakeCluster) DegradeNode(name string, ratios map[v1.ResourceName]float64) error {
+	c.changes = append(c.changes, "degrade "+name)
+	return nil
+}
+
+func TestRecordAndReplayNodeEvents(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "trace")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "trace.jsonl")
+
+	t0 := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	t1 := t0.Add(10 * time.Second)
+
+	rec, err := NewRecorder(path, logfile.Options{})
+	assert.NoError(t, err)
+
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	assert.NoError(t, rec.RecordSubmitterEvents(t0, "s", []submitter.Event{
+		&submitter.SubmitEvent{Pod: newPod("pod-0")},
+	}))
+	assert.NoError(t, rec.RecordNodeEvent(t0, "faults", Entry{Kind: SetNodeReady, NodeName: "node-0"}))
+	assert.NoError(t, rec.RecordNodeEvent(t0, "", Entry{Kind: AddNode, Node: node}))
+	node.Name = "modified after addition" // not recorded
+	assert.NoError(t, rec.RecordNodeEvent(t1, "", Entry{
+		Kind: OOMKill, PodNamespace: "default", PodName: "pod-0", NodeName: "node-1",
+	}))
+	assert.NoError(t, rec.RecordNodeEvent(t1, "faults", Entry{Kind: SetNodeReady, NodeName: "node-0", Ready: true}))
+	assert.Error(t, rec.RecordNodeEvent(t1, "", Entry{Kind: Submit}))
+	assert.NoError(t, rec.Close())
+
+	replayer, err := NewReplayerFromFile(path)
+	assert.NoError(t, err)
+	subs := replayer.Submitters()
+	assert.Len(t, subs, 2)
+	cluster := &fakeCluster{}
+
+	// t0: the faults are injected by their submitter, and the node is added by the simulation.
+	events, err := subs["faults"].Submit(ctx, t0, cluster, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+	assert.Equal(t, []string{"not ready node-0"}, cluster.changes)
+
+	next, ok := replayer.NextNodeEvent(t0)
+	assert.True(t, ok)
+	assert.Equal(t, t0, next)
+	assert.Empty(t, replayer.Kills(t0))
+	assert.NoError(t, replayer.ApplyNodeChanges(t0, cluster))
+	assert.Equal(t, []string{"not ready node-0", "add node-1"}, cluster.changes)
+
+	// t1
+	next, ok = replayer.NextNodeEvent(t0)
+	assert.True(t, ok)
+	assert.Equal(t, t1, next)
+	assert.Equal(t, []Entry{{
+		Clock: t1.ToRFC3339(), Kind: OOMKill, PodNamespace: "default", PodName: "pod-0", NodeName: "node-1",
+	}}, replayer.Kills(t1))
+
+	events, err = subs["faults"].Submit(ctx, t1, cluster, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []submitter.Event{&submitter.TerminateSubmitterEvent{}}, events)
+	assert.Equal(t, []string{"not ready node-0", "add node-1", "ready node-0"}, cluster.changes)
+
+	// Node changes cannot be replayed without a Cluster.
+	replayer, err = NewReplayerFromFile(path)
+	assert.NoError(t, err)
+	_, err = replayer.Submitters()["faults"].Submit(ctx, t0, nil, nil)
+	assert.Error(t, err)
+}
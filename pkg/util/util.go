@@ -24,6 +24,14 @@ import (
 	"k8s.io/kubernetes/pkg/apis/scheduling"
 )
 
+// ResourcePID is the name of the resource of the number of process IDs, with which a pod requests
+// PIDs and a node limits them (see scheduler.PodFitsMiscResources).
+const ResourcePID v1.ResourceName = "pid"
+
+// ResourceGPU is the name of the extended resource of the NVIDIA GPUs, with which a pod requests
+// GPUs and a node lists them in its allocatable resources.
+const ResourceGPU v1.ResourceName = "nvidia.com/gpu"
+
 // BuildResourceList parses a map from resource names to quantities (in strings) to a
 // v1.ResourceList.
 // Returns error if failed to parse.
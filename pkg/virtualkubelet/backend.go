@@ -0,0 +1,638 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package virtualkubelet lets KubeSim act as the virtual-kubelet provider of its simulated nodes
+// against a real API server: the nodes are registered to the API server, the pods bound to them by
+// the actual kube-scheduler run on the simulated nodes, and their statuses are reported back, so
+// that the real scheduler and controllers drive the simulated cluster.
+package virtualkubelet
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	v1qos "k8s.io/kubernetes/pkg/apis/core/v1/helper/qos"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+	"k8s.io/kubernetes/pkg/scheduler/core"
+	"k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/metrics"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
+	"simulator/pkg/submitter"
+	"simulator/pkg/util"
+)
+
+const (
+	// ProviderName is the value of the "type" label of the registered nodes, and of their taint with
+	// Options.Taint.
+	ProviderName = "kubesim"
+	// TaintKey is the key of the taint of the registered nodes with Options.Taint, the same as
+	// virtual-kubelet.
+	TaintKey = "virtual-kubelet.io/provider"
+
+	// DefaultHeartbeatPeriod is the default Options.HeartbeatPeriod, which is the default
+	// node-status-update-frequency of the kubelet.
+	DefaultHeartbeatPeriod = 10 * time.Second
+)
+
+// Options are the options of a Backend.
+type Options struct {
+	// Taint taints the registered nodes with TaintKey=ProviderName:NoSchedule, so that only the pods
+	// tolerating it are scheduled to them.
+	Taint bool
+	// RunSeconds is the execution time of the pods without the "simSpec" or
+	// pod.ResourceUsageAnnotation annotations, which use as much as requested, or 0 to run forever.
+	RunSeconds int32
+	// HeartbeatPeriod is the period of the updates of the node statuses (default:
+	// DefaultHeartbeatPeriod).
+	HeartbeatPeriod time.Duration
+}
+
+// Backend registers the nodes of a KubeSim to an API server, and provides a submitter and a
+// scheduler that run the pods bound to them by the API server: the submitter submits the pods
+// bound to the nodes, deletes the pods deleted in the API server, and reports the statuses of the
+// pods and the nodes; the scheduler binds the pods to the nodes chosen by the real scheduler.
+// The KubeSim must be paced to the wall clock (see KubeSim.SetRealTime), and its nodes may admit a
+// pod that does not fit, which fails with the OverCapacity reason.
+type Backend struct {
+	client kubernetes.Interface
+	opts   Options
+	// nodes is the set of the names of the registered nodes.
+	nodes map[string]bool
+
+	// mu guards the pods observed by the informer since the last Submit.
+	mu      sync.Mutex
+	added   map[string]*v1.Pod
+	deleted map[string]types.UID
+	// removed are the pods removed from the API server, a subset of deleted.
+	removed map[string]types.UID
+
+	// opsMu guards the operations on the API server run by the worker.
+	opsMu sync.Mutex
+	ops   []func(ctx context.Context) error
+	wake  chan struct{}
+
+	// The following are used only by Submit and Schedule, which KubeSim calls serially.
+	pods          map[string]*trackedPod
+	toBind        []string
+	wallStart     time.Time
+	simStart      clock.Clock
+	lastHeartbeat time.Time
+}
+
+// trackedPod is a pod of the API server run on a simulated node.
+type trackedPod struct {
+	uid  types.UID
+	node string
+	// sim is the pod submitted to KubeSim.
+	sim   *v1.Pod
+	bound bool
+	// deletedAt is the clock at which the pod was deleted in the API server.
+	deletedAt *clock.Clock
+	// phase and reason are the ones reported to the API server last.
+	phase  v1.PodPhase
+	reason string
+	// done means that the pod has terminated, and is no longer reported.
+	done bool
+	// removed means that the pod has been removed from the API server; it is forgotten once done.
+	removed bool
+}
+
+// NewBackend creates a new Backend with the client of an API server and the options.
+func NewBackend(client kubernetes.Interface, opts Options) *Backend {
+	if opts.HeartbeatPeriod <= 0 {
+		opts.HeartbeatPeriod = DefaultHeartbeatPeriod
+	}
+
+	return &Backend{
+		client:  client,
+		opts:    opts,
+		nodes:   map[string]bool{},
+		added:   map[string]*v1.Pod{},
+		deleted: map[string]types.UID{},
+		removed: map[string]types.UID{},
+		wake:    make(chan struct{}, 1),
+		pods:    map[string]*trackedPod{},
+	}
+}
+
+// Start registers the nodes to the API server (or updates their statuses if they exist), and
+// starts watching the pods bound to them and running the operations on the API server until the
+// context is done.
+// Returns error if failed to register a node.
+func (b *Backend) Start(ctx context.Context, nodes []*v1.Node) error {
+	now := time.Now()
+	for _, node := range nodes {
+		if err := b.registerNode(node, now); err != nil {
+			return err
+		}
+		b.nodes[node.Name] = true
+		log.L.Infof("Node %s registered", node.Name)
+	}
+
+	factory := informers.NewSharedInformerFactory(b.client, 0)
+	informer := factory.Core().V1().Pods().Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    b.observePod,
+		UpdateFunc: func(_, obj interface{}) { b.observePod(obj) },
+		DeleteFunc: b.observeDeletedPod,
+	})
+	factory.Start(ctx.Done())
+
+	go b.work(ctx)
+	return nil
+}
+
+// Submitter returns the submitter of this Backend, which must be the only submitter of the KubeSim.
+func (b *Backend) Submitter() submitter.Submitter {
+	return &backendSubmitter{b}
+}
+
+// Scheduler returns the scheduler of this Backend, which binds the pods to the nodes chosen by the
+// API server.
+func (b *Backend) Scheduler() scheduler.Scheduler {
+	return &backendScheduler{b}
+}
+
+type backendSubmitter struct{ *Backend }
+
+// Submit implements submitter.Submitter interface.
+// It never terminates.
+func (s *backendSubmitter) Submit(
+	_ context.Context, clk clock.Clock, nodeLister algorithm.NodeLister, met metrics.Metrics,
+) ([]submitter.Event, error) {
+	b := s.Backend
+	if b.wallStart.IsZero() {
+		b.wallStart, b.simStart = time.Now(), clk
+	}
+
+	b.mu.Lock()
+	added, deleted, removed := b.added, b.deleted, b.removed
+	b.added, b.deleted = map[string]*v1.Pod{}, map[string]types.UID{}
+	b.removed = map[string]types.UID{}
+	b.mu.Unlock()
+
+	events := []submitter.Event{}
+	for key, uid := range deleted {
+		tp, ok := b.pods[key]
+		if !ok || tp.uid != uid || tp.done || tp.deletedAt != nil {
+			continue
+		}
+		at := clk
+		tp.deletedAt = &at
+		events = append(events, &submitter.DeleteEvent{PodNamespace: tp.sim.Namespace, PodName: tp.sim.Name})
+	}
+	for key, uid := range removed {
+		if tp, ok := b.pods[key]; ok && tp.uid == uid {
+			tp.removed = true
+		}
+	}
+
+	for _, key := range sortedPodKeys(added) {
+		apiPod := added[key]
+		if tp, ok := b.pods[key]; ok && tp.uid == apiPod.UID {
+			continue
+		} else if ok && !tp.done {
+			// Replaced by a pod of the same name, which waits until the old one terminates.
+			b.retry(key, apiPod)
+			continue
+		}
+
+		sim := b.simPod(apiPod)
+		b.pods[key] = &trackedPod{uid: apiPod.UID, node: apiPod.Spec.NodeName, sim: sim}
+		b.toBind = append(b.toBind, key)
+		events = append(events, &submitter.SubmitEvent{Pod: sim})
+	}
+
+	podsMet, _ := met[metrics.PodsMetricsKey].(map[string]pod.Metrics)
+	for _, key := range sortedTrackedKeys(b.pods) {
+		tp := b.pods[key]
+		b.syncPod(key, tp, clk, podsMet)
+		if tp.done && tp.removed {
+			delete(b.pods, key)
+		}
+	}
+
+	if now := time.Now(); now.Sub(b.lastHeartbeat) >= b.opts.HeartbeatPeriod {
+		b.lastHeartbeat = now
+		nodes, err := nodeLister.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			node := node
+			b.enqueue(func(ctx context.Context) error { return b.updateNodeStatus(node, now) })
+		}
+	}
+
+	return events, nil
+}
+
+type backendScheduler struct{ *Backend }
+
+// Schedule implements scheduler.Scheduler interface.
+// The pods submitted by the submitter are bound to the nodes to which the API server bound them.
+func (s *backendScheduler) Schedule(
+	_ context.Context,
+	clk clock.Clock,
+	pendingPods queue.PodQueue,
+	nodeLister algorithm.NodeLister,
+	nodeInfoMap map[string]*nodeinfo.NodeInfo,
+) ([]scheduler.Event, error) {
+	b := s.Backend
+	events := []scheduler.Event{}
+	for _, key := range b.toBind {
+		tp, ok := b.pods[key]
+		if !ok || tp.done || tp.deletedAt != nil || !pendingPods.Delete(tp.sim.Namespace, tp.sim.Name) {
+			continue
+		}
+		tp.bound = true
+		events = append(events, &scheduler.BindEvent{
+			Pod:            tp.sim,
+			ScheduleResult: core.ScheduleResult{SuggestedHost: tp.node, EvaluatedNodes: 1, FeasibleNodes: 1},
+		})
+	}
+	b.toBind = nil
+
+	return events, nil
+}
+
+// syncPod reports the status of the pod at the clock, derived from its metrics, to the API server,
+// and deletes it from the API server once it has been deleted in the simulation.
+func (b *Backend) syncPod(key string, tp *trackedPod, clk clock.Clock, podsMet map[string]pod.Metrics) {
+	if tp.done {
+		return
+	}
+	met, running := podsMet[key]
+
+	if tp.deletedAt != nil {
+		grace := time.Duration(v1.DefaultTerminationGracePeriodSeconds) * time.Second
+		if gp := tp.sim.Spec.TerminationGracePeriodSeconds; gp != nil {
+			grace = time.Duration(*gp) * time.Second
+		}
+		if tp.bound && running && clk.Sub(*tp.deletedAt) < grace {
+			return
+		}
+		tp.done = true
+		b.enqueue(func(ctx context.Context) error { return b.deletePod(tp) })
+		return
+	}
+	if !tp.bound {
+		return
+	}
+
+	var phase v1.PodPhase
+	var reason, message string
+	var startedAt *time.Time
+	switch {
+	case !running: // completed
+		phase = v1.PodSucceeded
+		tp.done = true
+	case met.Status == pod.OverCapacity:
+		phase, reason, message = v1.PodFailed, "OverCapacity", "Pod does not fit in the simulated node"
+		tp.done = true
+	case met.Status == pod.Evicted:
+		phase, reason, message = v1.PodFailed, "Evicted", "The node was low on resource: memory."
+		tp.done = true
+	case met.Status == pod.OOMKilled:
+		phase, reason, message = v1.PodFailed, "OOMKilled", "The pod used more memory than its limit."
+		tp.done = true
+	case !clk.Before(met.StartedAt):
+		phase = v1.PodRunning
+		t := b.wallClock(met.StartedAt)
+		startedAt = &t
+	default:
+		phase, reason = v1.PodPending, "ContainerCreating"
+	}
+
+	if phase == tp.phase && reason == tp.reason {
+		return
+	}
+	tp.phase, tp.reason = phase, reason
+
+	status := b.podStatus(tp, phase, reason, message, startedAt)
+	b.enqueue(func(ctx context.Context) error { return b.updatePodStatus(tp, status) })
+}
+
+// simPod returns the copy of the pod of the API server submitted to KubeSim.
+// The pods without resource usage annotations use as much as requested for Options.RunSeconds.
+// The priority class is dropped, since the API server has resolved it to the priority.
+func (b *Backend) simPod(apiPod *v1.Pod) *v1.Pod {
+	sim := apiPod.DeepCopy()
+	sim.ResourceVersion = ""
+	sim.Status = v1.PodStatus{}
+	sim.Spec.PriorityClassName = ""
+
+	_, hasSpec := sim.Annotations["simSpec"]
+	_, hasUsage := sim.Annotations[pod.ResourceUsageAnnotation]
+	if !hasSpec && !hasUsage {
+		seconds := b.opts.RunSeconds
+		if seconds <= 0 {
+			seconds = math.MaxInt32
+		}
+		if sim.Annotations == nil {
+			sim.Annotations = map[string]string{}
+		}
+		sim.Annotations[pod.ResourceUsageAnnotation] = fmt.Sprintf("- phase: run\n  seconds: %d\n", seconds)
+	}
+
+	return sim
+}
+
+// wallClock returns the wall-clock time corresponding to the clock of the simulation.
+func (b *Backend) wallClock(clk clock.Clock) time.Time {
+	return b.wallStart.Add(clk.Sub(b.simStart))
+}
+
+// podStatus builds the status of the pod reported to the API server.
+func (b *Backend) podStatus(
+	tp *trackedPod, phase v1.PodPhase, reason, message string, startedAt *time.Time,
+) v1.PodStatus {
+	now := metav1.Now()
+	ready := v1.ConditionFalse
+	if phase == v1.PodRunning {
+		ready = v1.ConditionTrue
+	}
+
+	status := v1.PodStatus{
+		Phase:   phase,
+		Reason:  reason,
+		Message: message,
+		Conditions: []v1.PodCondition{
+			{Type: v1.PodScheduled, Status: v1.ConditionTrue, LastTransitionTime: now},
+			{Type: v1.PodInitialized, Status: v1.ConditionTrue, LastTransitionTime: now},
+			{Type: v1.ContainersReady, Status: ready, LastTransitionTime: now},
+			{Type: v1.PodReady, Status: ready, LastTransitionTime: now},
+		},
+		StartTime: &now,
+		QOSClass:  v1qos.GetPodQOS(tp.sim),
+	}
+
+	for _, c := range tp.sim.Spec.Containers {
+		cs := v1.ContainerStatus{Name: c.Name, Image: c.Image, Ready: phase == v1.PodRunning}
+		switch phase {
+		case v1.PodPending:
+			cs.State.Waiting = &v1.ContainerStateWaiting{Reason: reason}
+		case v1.PodRunning:
+			cs.State.Running = &v1.ContainerStateRunning{StartedAt: metav1.NewTime(*startedAt)}
+		case v1.PodSucceeded:
+			cs.State.Terminated = &v1.ContainerStateTerminated{Reason: "Completed", FinishedAt: now}
+		default:
+			cs.State.Terminated = &v1.ContainerStateTerminated{
+				Reason: reason, Message: message, ExitCode: 137, FinishedAt: now,
+			}
+		}
+		status.ContainerStatuses = append(status.ContainerStatuses, cs)
+	}
+
+	return status
+}
+
+// observePod records the pod observed by the informer, if it is bound to a registered node.
+func (b *Backend) observePod(obj interface{}) {
+	p, ok := obj.(*v1.Pod)
+	if !ok || !b.nodes[p.Spec.NodeName] {
+		return
+	}
+	key := util.PodKeyFromNames(p.Namespace, p.Name)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if p.DeletionTimestamp != nil {
+		delete(b.added, key)
+		b.deleted[key] = p.UID
+	} else if p.Status.Phase != v1.PodSucceeded && p.Status.Phase != v1.PodFailed {
+		b.added[key] = p
+	}
+}
+
+// observeDeletedPod records the pod deleted from the API server.
+func (b *Backend) observeDeletedPod(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	p, ok := obj.(*v1.Pod)
+	if !ok || !b.nodes[p.Spec.NodeName] {
+		return
+	}
+	key := util.PodKeyFromNames(p.Namespace, p.Name)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.added, key)
+	b.deleted[key] = p.UID
+	b.removed[key] = p.UID
+}
+
+// retry records the pod again to be submitted by the next Submit, unless a newer one has been
+// observed.
+func (b *Backend) retry(key string, p *v1.Pod) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.added[key]; !ok {
+		b.added[key] = p
+	}
+}
+
+// enqueue enqueues the operation on the API server, run by the worker in order.
+func (b *Backend) enqueue(op func(ctx context.Context) error) {
+	b.opsMu.Lock()
+	b.ops = append(b.ops, op)
+	b.opsMu.Unlock()
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// work runs the enqueued operations until the context is done.
+// A failed operation is logged and dropped; the next heartbeat or transition of a pod reports its
+// latest state again.
+func (b *Backend) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.wake:
+		}
+
+		b.opsMu.Lock()
+		ops := b.ops
+		b.ops = nil
+		b.opsMu.Unlock()
+
+		for _, op := range ops {
+			if err := op(ctx); err != nil {
+				log.L.Warnf("Error updating API server: %s", err.Error())
+			}
+		}
+	}
+}
+
+// updatePodStatus updates the status of the pod in the API server, unless it has been replaced.
+func (b *Backend) updatePodStatus(tp *trackedPod, status v1.PodStatus) error {
+	pods := b.client.CoreV1().Pods(tp.sim.Namespace)
+	current, err := pods.Get(tp.sim.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if current.UID != tp.uid {
+		return nil
+	}
+
+	if current.Status.StartTime != nil {
+		status.StartTime = current.Status.StartTime
+	}
+	status.HostIP = current.Status.HostIP
+	current.Status = status
+	_, err = pods.UpdateStatus(current)
+	return err
+}
+
+// deletePod deletes the pod from the API server immediately, as the kubelet does after its
+// containers have stopped.
+func (b *Backend) deletePod(tp *trackedPod) error {
+	zero := int64(0)
+	err := b.client.CoreV1().Pods(tp.sim.Namespace).Delete(tp.sim.Name, &metav1.DeleteOptions{
+		GracePeriodSeconds: &zero,
+		Preconditions:      &metav1.Preconditions{UID: &tp.uid},
+	})
+	if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+		return nil
+	}
+	return err
+}
+
+// registerNode creates the node in the API server, or updates its status if it exists.
+func (b *Backend) registerNode(node *v1.Node, now time.Time) error {
+	labels := map[string]string{}
+	for k, v := range node.Labels {
+		labels[k] = v
+	}
+	labels["type"] = "virtual-kubelet"
+	labels["kubernetes.io/role"] = "agent"
+	labels[v1.LabelHostname] = node.Name
+
+	taints := append([]v1.Taint{}, node.Spec.Taints...)
+	if b.opts.Taint {
+		taints = append(taints, v1.Taint{Key: TaintKey, Value: ProviderName, Effect: v1.TaintEffectNoSchedule})
+	}
+
+	apiNode := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: node.Name, Labels: labels, Annotations: node.Annotations},
+		Spec:       v1.NodeSpec{Taints: taints, Unschedulable: node.Spec.Unschedulable},
+		Status:     nodeStatus(node, nil, now),
+	}
+	if _, err := b.client.CoreV1().Nodes().Create(apiNode); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	return b.updateNodeStatus(node, now)
+}
+
+// updateNodeStatus updates the status of the node in the API server with the simulated node.
+func (b *Backend) updateNodeStatus(node *v1.Node, now time.Time) error {
+	nodes := b.client.CoreV1().Nodes()
+	current, err := nodes.Get(node.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	current.Status = nodeStatus(node, current.Status.Conditions, now)
+	_, err = nodes.UpdateStatus(current)
+	return err
+}
+
+// nodeStatus builds the status of the simulated node reported to the API server at the time, with
+// the conditions of the simulated node (e.g., not ready while faulty), keeping the transition times
+// of the conditions not changed from the last ones.
+// A node without the Ready condition is reported ready.
+func nodeStatus(node *v1.Node, last []v1.NodeCondition, now time.Time) v1.NodeStatus {
+	heartbeat := metav1.NewTime(now)
+	conditions := []v1.NodeCondition{}
+	hasReady := false
+	for _, c := range node.Status.Conditions {
+		conditions = append(conditions, c)
+		hasReady = hasReady || c.Type == v1.NodeReady
+	}
+	if !hasReady {
+		conditions = append([]v1.NodeCondition{{
+			Type:    v1.NodeReady,
+			Status:  v1.ConditionTrue,
+			Reason:  "KubeletReady",
+			Message: "kubelet is simulated by KubeSim",
+		}}, conditions...)
+	}
+
+	for i := range conditions {
+		conditions[i].LastHeartbeatTime = heartbeat
+		conditions[i].LastTransitionTime = heartbeat
+		for _, l := range last {
+			if l.Type == conditions[i].Type && l.Status == conditions[i].Status {
+				conditions[i].LastTransitionTime = l.LastTransitionTime
+			}
+		}
+	}
+
+	return v1.NodeStatus{
+		Capacity:    node.Status.Capacity,
+		Allocatable: node.Status.Allocatable,
+		Conditions:  conditions,
+		Addresses:   []v1.NodeAddress{{Type: v1.NodeHostName, Address: node.Name}},
+		NodeInfo: v1.NodeSystemInfo{
+			KubeletVersion:  "v1.14.0-kubesim",
+			OperatingSystem: "linux",
+			Architecture:    "amd64",
+		},
+	}
+}
+
+// sortedPodKeys returns the keys of the pods in order.
+func sortedPodKeys(pods map[string]*v1.Pod) []string {
+	keys := make([]string, 0, len(pods))
+	for key := range pods {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedTrackedKeys returns the keys of the tracked pods in order.
+func sortedTrackedKeys(pods map[string]*trackedPod) []string {
+	keys := make([]string, 0, len(pods))
+	for key := range pods {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,257 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package virtualkubelet
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/metrics"
+	"simulator/pkg/pod"
+	"simulator/pkg/queue"
+	"simulator/pkg/scheduler"
+	"simulator/pkg/submitter"
+)
+
+type nodeLister []*v1.Node
+
+func (l nodeLister) List() ([]*v1.Node, error) { return l, nil }
+
+func newNode(name string) *v1.Node {
+	rl := v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("4"),
+		v1.ResourceMemory: resource.MustParse("8Gi"),
+		v1.ResourcePods:   resource.MustParse("110"),
+	}
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"zone": "a"}},
+		Status:     v1.NodeStatus{Capacity: rl, Allocatable: rl},
+	}
+}
+
+func newAPIPod(name, node string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID("uid-" + name)},
+		Spec: v1.PodSpec{
+			NodeName:          node,
+			PriorityClassName: "high",
+			Containers:        []v1.Container{{Name: "c", Image: "busybox"}},
+		},
+	}
+}
+
+func TestBackendRegistersNodes(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backend := NewBackend(client, Options{Taint: true})
+	assert.NoError(t, backend.Start(ctx, []*v1.Node{newNode("node-0")}))
+
+	node, err := client.CoreV1().Nodes().Get("node-0", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "a", node.Labels["zone"])
+	assert.Equal(t, "virtual-kubelet", node.Labels["type"])
+	assert.Equal(t, []v1.Taint{{Key: TaintKey, Value: ProviderName, Effect: v1.TaintEffectNoSchedule}},
+		node.Spec.Taints)
+	assert.Equal(t, "4", node.Status.Allocatable.Cpu().String())
+	assert.Equal(t, v1.NodeReady, node.Status.Conditions[0].Type)
+	assert.Equal(t, v1.ConditionTrue, node.Status.Conditions[0].Status)
+
+	// Registering again only updates the status.
+	other := NewBackend(client, Options{})
+	assert.NoError(t, other.Start(ctx, []*v1.Node{newNode("node-0")}))
+}
+
+func TestBackendReportsNotReadyNodes(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backend := NewBackend(client, Options{})
+	assert.NoError(t, backend.Start(ctx, []*v1.Node{newNode("node-0")}))
+
+	readyCondition := func() v1.NodeCondition {
+		node, err := client.CoreV1().Nodes().Get("node-0", metav1.GetOptions{})
+		assert.NoError(t, err)
+		for _, c := range node.Status.Conditions {
+			if c.Type == v1.NodeReady {
+				return c
+			}
+		}
+		t.Fatal("no Ready condition")
+		return v1.NodeCondition{}
+	}
+	registered := readyCondition()
+	assert.Equal(t, v1.ConditionTrue, registered.Status)
+
+	// The simulated node gets not ready, e.g., by a fault.
+	notReady := newNode("node-0")
+	notReady.Status.Conditions = []v1.NodeCondition{{
+		Type:    v1.NodeReady,
+		Status:  v1.ConditionFalse,
+		Reason:  "KubeletNotReady",
+		Message: "kubelet is not posting ready status",
+	}}
+	now := time.Now().Add(time.Minute)
+	assert.NoError(t, backend.updateNodeStatus(notReady, now))
+	c := readyCondition()
+	assert.Equal(t, v1.ConditionFalse, c.Status)
+	assert.Equal(t, "KubeletNotReady", c.Reason)
+	assert.Equal(t, now.Unix(), c.LastTransitionTime.Unix())
+
+	// The transition time is kept while the condition is unchanged.
+	assert.NoError(t, backend.updateNodeStatus(notReady, now.Add(time.Minute)))
+	c = readyCondition()
+	assert.Equal(t, now.Unix(), c.LastTransitionTime.Unix())
+	assert.Equal(t, now.Add(time.Minute).Unix(), c.LastHeartbeatTime.Unix())
+}
+
+func TestBackendRunsPods(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backend := NewBackend(client, Options{RunSeconds: 60})
+	nodes := []*v1.Node{newNode("node-0")}
+	assert.NoError(t, backend.Start(ctx, nodes))
+	subm, sched := backend.Submitter(), backend.Scheduler()
+
+	_, err := client.CoreV1().Pods("default").Create(newAPIPod("pod-0", "node-0"))
+	assert.NoError(t, err)
+	_, err = client.CoreV1().Pods("default").Create(newAPIPod("pod-1", "other-node"))
+	assert.NoError(t, err)
+
+	t0 := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	var events []submitter.Event
+	assert.Eventually(t, func() bool {
+		events, err = subm.Submit(ctx, t0, nodeLister(nodes), metrics.Metrics{})
+		return err == nil && len(events) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Only the pod bound to the registered node is submitted.
+	assert.Len(t, events, 1)
+	simPod := events[0].(*submitter.SubmitEvent).Pod
+	assert.Equal(t, "pod-0", simPod.Name)
+	assert.Equal(t, "", simPod.Spec.PriorityClassName)
+	assert.Equal(t, "- phase: run\n  seconds: 60\n", simPod.Annotations[pod.ResourceUsageAnnotation])
+
+	q := queue.NewFIFOQueue()
+	assert.NoError(t, q.Push(simPod))
+	schedEvents, err := sched.Schedule(ctx, t0, q, nodeLister(nodes), nil)
+	assert.NoError(t, err)
+	assert.Len(t, schedEvents, 1)
+	assert.Equal(t, "node-0", schedEvents[0].(*scheduler.BindEvent).ScheduleResult.SuggestedHost)
+
+	// Running
+	podsMet := map[string]pod.Metrics{"default/pod-0": {Status: pod.Ok, StartedAt: t0, Node: "node-0"}}
+	met := metrics.Metrics{metrics.PodsMetricsKey: podsMet}
+	_, err = subm.Submit(ctx, t0.Add(time.Second), nodeLister(nodes), met)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		p, err := client.CoreV1().Pods("default").Get("pod-0", metav1.GetOptions{})
+		return err == nil && p.Status.Phase == v1.PodRunning
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Completed
+	_, err = subm.Submit(ctx, t0.Add(time.Minute), nodeLister(nodes), metrics.Metrics{
+		metrics.PodsMetricsKey: map[string]pod.Metrics{},
+	})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		p, err := client.CoreV1().Pods("default").Get("pod-0", metav1.GetOptions{})
+		return err == nil && p.Status.Phase == v1.PodSucceeded
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The completed pod is forgotten once removed from the API server.
+	assert.NoError(t, client.CoreV1().Pods("default").Delete("pod-0", &metav1.DeleteOptions{}))
+	assert.Eventually(t, func() bool {
+		_, err := subm.Submit(ctx, t0.Add(2*time.Minute), nodeLister(nodes), metrics.Metrics{
+			metrics.PodsMetricsKey: map[string]pod.Metrics{},
+		})
+		return err == nil && len(backend.pods) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestBackendDeletesPods(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backend := NewBackend(client, Options{})
+	nodes := []*v1.Node{newNode("node-0")}
+	assert.NoError(t, backend.Start(ctx, nodes))
+	subm, sched := backend.Submitter(), backend.Scheduler()
+
+	apiPod := newAPIPod("pod-0", "node-0")
+	grace := int64(30)
+	apiPod.Spec.TerminationGracePeriodSeconds = &grace
+	_, err := client.CoreV1().Pods("default").Create(apiPod)
+	assert.NoError(t, err)
+
+	t0 := clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	var events []submitter.Event
+	assert.Eventually(t, func() bool {
+		events, err = subm.Submit(ctx, t0, nodeLister(nodes), metrics.Metrics{})
+		return err == nil && len(events) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	q := queue.NewFIFOQueue()
+	assert.NoError(t, q.Push(events[0].(*submitter.SubmitEvent).Pod))
+	_, err = sched.Schedule(ctx, t0, q, nodeLister(nodes), nil)
+	assert.NoError(t, err)
+
+	// The API server marks the pod to be deleted gracefully.
+	now := metav1.Now()
+	apiPod.DeletionTimestamp = &now
+	_, err = client.CoreV1().Pods("default").Update(apiPod)
+	assert.NoError(t, err)
+
+	podsMet := map[string]pod.Metrics{"default/pod-0": {Status: pod.Deleted, StartedAt: t0, Node: "node-0"}}
+	met := metrics.Metrics{metrics.PodsMetricsKey: podsMet}
+	t1 := t0.Add(time.Second)
+	assert.Eventually(t, func() bool {
+		events, err = subm.Submit(ctx, t1, nodeLister(nodes), met)
+		return err == nil && len(events) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []submitter.Event{&submitter.DeleteEvent{PodNamespace: "default", PodName: "pod-0"}}, events)
+
+	// The pod is deleted from the API server after the grace period.
+	_, err = subm.Submit(ctx, t1.Add(10*time.Second), nodeLister(nodes), met)
+	assert.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	_, err = client.CoreV1().Pods("default").Get("pod-0", metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	_, err = subm.Submit(ctx, t1.Add(30*time.Second), nodeLister(nodes), met)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := client.CoreV1().Pods("default").Get("pod-0", metav1.GetOptions{})
+		return err != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	// The deleted pod is forgotten once the informer observes its removal.
+	assert.Eventually(t, func() bool {
+		_, err := subm.Submit(ctx, t1.Add(31*time.Second), nodeLister(nodes), met)
+		return err == nil && len(backend.pods) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
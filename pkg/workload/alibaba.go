@@ -0,0 +1,127 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workload
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+
+	"simulator/pkg/logfile"
+)
+
+// Columns of the batch_task table of the Alibaba cluster trace.
+const (
+	alibabaTaskName = iota
+	alibabaInstanceNum
+	alibabaJobName
+	alibabaTaskType
+	alibabaStatus
+	alibabaStartTime
+	alibabaEndTime
+	alibabaPlanCPU
+	alibabaPlanMem
+	alibabaColumns
+)
+
+// alibabaTerminated is the status of the tasks that have run to the end.
+const alibabaTerminated = "Terminated"
+
+// ReadAlibabaTrace reads the batch_task CSV file (optionally compressed) at the path.
+// Each instance of a terminated task becomes a pod "alibaba-<job name>-<task name>-<instance>",
+// submitted at the start time of the task and running until its end time.
+// plan_cpu is in percent of a core, and plan_mem in percent of Options.MemoryScale.
+// The other tasks are ignored.
+func ReadAlibabaTrace(path string, opts Options) ([]Pod, error) {
+	file, err := logfile.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	pods := []Pod{}
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = alibabaColumns
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, strongerrors.InvalidArgument(errors.Wrapf(err, "invalid batch task in %s", path))
+		}
+		if record[alibabaStatus] != alibabaTerminated {
+			continue
+		}
+
+		instances, err1 := strconv.Atoi(record[alibabaInstanceNum])
+		start, err2 := strconv.ParseInt(record[alibabaStartTime], 10, 64)
+		end, err3 := strconv.ParseInt(record[alibabaEndTime], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil || end < start {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("invalid batch task at line %d of %s", line, path))
+		}
+		// Requests may be missing.
+		cpu, _ := strconv.ParseFloat(record[alibabaPlanCPU], 64)
+		mem, _ := strconv.ParseFloat(record[alibabaPlanMem], 64)
+
+		name := fmt.Sprintf("alibaba-%s-%s", record[alibabaJobName], record[alibabaTaskName])
+		name = strings.ToLower(strings.Replace(name, "_", "-", -1))
+		for i := 0; i < instances; i++ {
+			pods = append(pods, Pod{
+				SubmitAt: opts.Start.Add(time.Duration(start) * time.Second),
+				Pod: newPod(fmt.Sprintf("%s-%d", name, i), nil,
+					cpu/100, mem/100*opts.MemoryScale, end-start),
+			})
+		}
+	}
+
+	sortPods(pods)
+	return pods, nil
+}
+
+// WriteAlibabaTrace writes the workload to a batch_task CSV file at the path.
+// Each pod becomes a terminated task of one instance in its own job, named "j_<index of the pod>".
+// Returns error if a pod has no valid "simSpec" annotation.
+func WriteAlibabaTrace(path string, pods []Pod, opts Options) error {
+	records := make([][]string, 0, len(pods))
+	for i, p := range pods {
+		cores, memory, secs, err := podShape(p.Pod)
+		if err != nil {
+			return err
+		}
+
+		start := seconds(opts.Start, p.SubmitAt)
+		record := make([]string, alibabaColumns)
+		record[alibabaTaskName] = "M1"
+		record[alibabaInstanceNum] = "1"
+		record[alibabaJobName] = fmt.Sprintf("j_%d", i)
+		record[alibabaTaskType] = "1"
+		record[alibabaStatus] = alibabaTerminated
+		record[alibabaStartTime] = strconv.FormatInt(start, 10)
+		record[alibabaEndTime] = strconv.FormatInt(start+secs, 10)
+		record[alibabaPlanCPU] = formatFloat(cores * 100)
+		record[alibabaPlanMem] = formatFloat(memory / opts.MemoryScale * 100)
+		records = append(records, record)
+	}
+
+	return writeCSV(path, records)
+}
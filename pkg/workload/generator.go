@@ -0,0 +1,269 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workload
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+
+	"simulator/pkg/clock"
+)
+
+// ArrivalProcess is a process of the submissions of pods.
+type ArrivalProcess string
+
+const (
+	// PoissonArrival submits pods with exponentially distributed intervals.
+	PoissonArrival ArrivalProcess = "poisson"
+	// UniformArrival submits pods at a constant interval.
+	UniformArrival ArrivalProcess = "uniform"
+	// BurstyArrival submits bursts of Arrival.BurstSize pods at once, with exponentially distributed
+	// intervals between the bursts.
+	BurstyArrival ArrivalProcess = "bursty"
+)
+
+// Arrival is the arrival process of pods with its average rate in pods per second.
+type Arrival struct {
+	Process   ArrivalProcess
+	Rate      float64
+	BurstSize int
+}
+
+// DistributionKind is a kind of probability distribution.
+type DistributionKind string
+
+const (
+	// ConstantDistribution always draws Distribution.Value.
+	ConstantDistribution DistributionKind = "constant"
+	// UniformDistribution draws uniformly from [Distribution.Min, Distribution.Max).
+	UniformDistribution DistributionKind = "uniform"
+	// NormalDistribution draws from the normal distribution with Distribution.Mean and
+	// Distribution.StdDev.
+	NormalDistribution DistributionKind = "normal"
+	// LogNormalDistribution draws from the log-normal distribution with Distribution.Mean and
+	// Distribution.StdDev (of the distribution itself, not of its logarithm).
+	LogNormalDistribution DistributionKind = "lognormal"
+	// ExponentialDistribution draws from the exponential distribution with Distribution.Mean.
+	ExponentialDistribution DistributionKind = "exponential"
+)
+
+// Distribution is a probability distribution of a non-negative quantity.
+// The normal, lognormal, and exponential draws are clamped to [Min, Max] if Max is positive, and to
+// at least Min otherwise.
+type Distribution struct {
+	Kind   DistributionKind
+	Value  float64
+	Min    float64
+	Max    float64
+	Mean   float64
+	StdDev float64
+}
+
+// PriorityWeight is a priority of pods and its relative frequency.
+type PriorityWeight struct {
+	Priority int32
+	Weight   float64
+}
+
+// Generator generates a synthetic workload of Count pods named "<Name>-<index>", submitted by the
+// arrival process from the start clock.
+// Each pod requests the CPU cores and the bytes of memory drawn from CPU and Memory, runs for the
+// seconds drawn from Duration, and has a priority drawn from Priorities by their weights (or no
+// priority if empty).
+// The same Seed generates the same workload.
+type Generator struct {
+	Name       string
+	Namespace  string
+	Count      int
+	Seed       int64
+	Arrival    Arrival
+	CPU        Distribution
+	Memory     Distribution
+	Duration   Distribution
+	Priorities []PriorityWeight
+}
+
+// Validate returns error if this Generator is invalid.
+func (g *Generator) Validate() error {
+	if g.Name == "" {
+		return strongerrors.InvalidArgument(errors.New("generator name must not be empty"))
+	}
+	if g.Count <= 0 {
+		return strongerrors.InvalidArgument(
+			errors.Errorf("count of generator %s must be positive", g.Name))
+	}
+
+	switch g.Arrival.Process {
+	case PoissonArrival, UniformArrival:
+	case BurstyArrival:
+		if g.Arrival.BurstSize <= 0 {
+			return strongerrors.InvalidArgument(
+				errors.Errorf("burst size of generator %s must be positive", g.Name))
+		}
+	default:
+		return strongerrors.InvalidArgument(
+			errors.Errorf("arrival process %q of generator %s is not supported", g.Arrival.Process, g.Name))
+	}
+	if !(g.Arrival.Rate > 0) {
+		return strongerrors.InvalidArgument(
+			errors.Errorf("arrival rate of generator %s must be positive", g.Name))
+	}
+
+	for _, d := range []struct {
+		name string
+		dist Distribution
+	}{{"cpu", g.CPU}, {"memory", g.Memory}, {"duration", g.Duration}} {
+		if err := d.dist.validate(); err != nil {
+			return errors.Wrapf(err, "invalid %s distribution of generator %s", d.name, g.Name)
+		}
+	}
+
+	for _, p := range g.Priorities {
+		if p.Weight < 0 || math.IsNaN(p.Weight) {
+			return strongerrors.InvalidArgument(
+				errors.Errorf("weight of priority %d of generator %s must not be negative", p.Priority, g.Name))
+		}
+	}
+
+	return nil
+}
+
+// Generate generates the workload submitted from the start clock, sorted by the submission clocks.
+// Returns error if this Generator is invalid.
+func (g *Generator) Generate(start clock.Clock) ([]Pod, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(g.Seed))
+	pods := make([]Pod, 0, g.Count)
+	at := 0.0
+	for i := 0; i < g.Count; i++ {
+		at += g.interval(rng, i)
+
+		p := newPod(fmt.Sprintf("%s-%d", g.Name, i), g.priority(rng),
+			g.CPU.sample(rng), g.Memory.sample(rng), int64(math.Round(g.Duration.sample(rng))))
+		if g.Namespace != "" {
+			p.Namespace = g.Namespace
+		}
+
+		pods = append(pods, Pod{
+			SubmitAt: start.Add(time.Duration(at * float64(time.Second)).Round(time.Millisecond)),
+			Pod:      p,
+		})
+	}
+
+	return pods, nil
+}
+
+// interval returns the seconds between the submissions of the (i-1)-th and the i-th pods.
+func (g *Generator) interval(rng *rand.Rand, i int) float64 {
+	switch g.Arrival.Process {
+	case UniformArrival:
+		if i == 0 {
+			return 0
+		}
+		return 1 / g.Arrival.Rate
+	case BurstyArrival:
+		if i%g.Arrival.BurstSize != 0 {
+			return 0
+		}
+		return rng.ExpFloat64() * float64(g.Arrival.BurstSize) / g.Arrival.Rate
+	default:
+		return rng.ExpFloat64() / g.Arrival.Rate
+	}
+}
+
+// priority draws a priority by the weights, or returns nil if there are no priorities.
+func (g *Generator) priority(rng *rand.Rand) *int32 {
+	total := 0.0
+	for _, p := range g.Priorities {
+		total += p.Weight
+	}
+	if total == 0 {
+		return nil
+	}
+
+	x := rng.Float64() * total
+	for _, p := range g.Priorities {
+		if x < p.Weight {
+			priority := p.Priority
+			return &priority
+		}
+		x -= p.Weight
+	}
+
+	priority := g.Priorities[len(g.Priorities)-1].Priority
+	return &priority
+}
+
+// validate returns error if the kind is not supported or the parameters are invalid.
+// An empty kind is the same as ConstantDistribution.
+func (d Distribution) validate() error {
+	for _, v := range []float64{d.Value, d.Min, d.Max, d.Mean, d.StdDev} {
+		if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			return strongerrors.InvalidArgument(errors.New("parameters must not be negative"))
+		}
+	}
+
+	switch d.Kind {
+	case "", ConstantDistribution, NormalDistribution, LogNormalDistribution, ExponentialDistribution:
+	case UniformDistribution:
+		if d.Max < d.Min {
+			return strongerrors.InvalidArgument(errors.New("max must not be less than min"))
+		}
+	default:
+		return strongerrors.InvalidArgument(errors.Errorf("distribution %q is not supported", d.Kind))
+	}
+
+	return nil
+}
+
+// sample draws a value from this Distribution.
+func (d Distribution) sample(rng *rand.Rand) float64 {
+	var x float64
+	switch d.Kind {
+	case UniformDistribution:
+		return d.Min + rng.Float64()*(d.Max-d.Min)
+	case NormalDistribution:
+		x = d.Mean + rng.NormFloat64()*d.StdDev
+	case LogNormalDistribution:
+		if d.Mean == 0 {
+			return d.clamp(0)
+		}
+		sigma2 := math.Log(1 + d.StdDev*d.StdDev/(d.Mean*d.Mean))
+		x = math.Exp(math.Log(d.Mean) - sigma2/2 + rng.NormFloat64()*math.Sqrt(sigma2))
+	case ExponentialDistribution:
+		x = rng.ExpFloat64() * d.Mean
+	default:
+		return d.Value
+	}
+
+	return d.clamp(x)
+}
+
+// clamp clamps the value to [Min, Max] if Max is positive, and to at least Min otherwise.
+func (d Distribution) clamp(x float64) float64 {
+	x = math.Max(x, d.Min)
+	if d.Max > 0 {
+		x = math.Min(x, d.Max)
+	}
+	return x
+}
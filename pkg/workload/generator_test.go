@@ -0,0 +1,116 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workload
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerator(t *testing.T) {
+	gen := Generator{
+		Name:     "batch",
+		Count:    1000,
+		Seed:     1,
+		Arrival:  Arrival{Process: PoissonArrival, Rate: 0.1},
+		CPU:      Distribution{Kind: UniformDistribution, Min: 0.5, Max: 2},
+		Memory:   Distribution{Kind: NormalDistribution, Mean: 1 << 30, StdDev: 256 << 20, Min: 128 << 20},
+		Duration: Distribution{Kind: LogNormalDistribution, Mean: 600, StdDev: 300},
+		Priorities: []PriorityWeight{
+			{Priority: 0, Weight: 3},
+			{Priority: 100, Weight: 1},
+		},
+	}
+	pods, err := gen.Generate(testOpts.Start)
+	assert.NoError(t, err)
+	assert.Len(t, pods, 1000)
+	assert.Equal(t, "batch-0", pods[0].Pod.Name)
+
+	again, err := gen.Generate(testOpts.Start)
+	assert.NoError(t, err)
+	assert.Equal(t, shapes(t, pods), shapes(t, again), "not reproducible")
+
+	var cpu, memory, secs float64
+	high := 0
+	for i, s := range shapes(t, pods) {
+		if i > 0 {
+			assert.False(t, s.submitAt < pods[i-1].SubmitAt.Sub(testOpts.Start))
+		}
+		assert.True(t, s.cores >= 0.5 && s.cores < 2)
+		assert.True(t, s.memory >= 128<<20)
+		cpu += s.cores
+		memory += s.memory
+		secs += float64(s.seconds)
+		if *pods[i].Pod.Spec.Priority == 100 {
+			high++
+		}
+	}
+	last := pods[len(pods)-1].SubmitAt.Sub(testOpts.Start)
+	assert.InDelta(t, 10000, last.Seconds(), 1000)
+	assert.InDelta(t, 1.25, cpu/1000, 0.05)
+	assert.InDelta(t, 1<<30, memory/1000, 32<<20)
+	assert.InDelta(t, 600, secs/1000, 30)
+	assert.InDelta(t, 250, high, 50)
+
+	gen.Seed = 2
+	other, err := gen.Generate(testOpts.Start)
+	assert.NoError(t, err)
+	assert.NotEqual(t, shapes(t, pods), shapes(t, other))
+}
+
+func TestGeneratorArrival(t *testing.T) {
+	submitAt := func(arrival Arrival) []time.Duration {
+		gen := Generator{Name: "web", Count: 6, Arrival: arrival}
+		pods, err := gen.Generate(testOpts.Start)
+		assert.NoError(t, err)
+		durations := []time.Duration{}
+		for _, p := range pods {
+			durations = append(durations, p.SubmitAt.Sub(testOpts.Start))
+		}
+		return durations
+	}
+
+	assert.Equal(t, []time.Duration{0, 500 * time.Millisecond, time.Second,
+		1500 * time.Millisecond, 2 * time.Second, 2500 * time.Millisecond},
+		submitAt(Arrival{Process: UniformArrival, Rate: 2}))
+
+	bursty := submitAt(Arrival{Process: BurstyArrival, Rate: 1, BurstSize: 3})
+	assert.Equal(t, bursty[0], bursty[2])
+	assert.Equal(t, bursty[3], bursty[5])
+	assert.True(t, bursty[2] < bursty[3])
+}
+
+func TestGeneratorValidate(t *testing.T) {
+	gen := Generator{Name: "web", Count: 1, Arrival: Arrival{Process: "periodic", Rate: 1}}
+	assert.EqualError(t, gen.Validate(), `arrival process "periodic" of generator web is not supported`)
+
+	gen = Generator{Name: "web", Count: 1, Arrival: Arrival{Process: BurstyArrival, Rate: 1}}
+	assert.EqualError(t, gen.Validate(), "burst size of generator web must be positive")
+
+	gen = Generator{Name: "web", Arrival: Arrival{Process: PoissonArrival, Rate: 1}}
+	assert.EqualError(t, gen.Validate(), "count of generator web must be positive")
+
+	gen = Generator{Name: "web", Count: 1, Arrival: Arrival{Process: PoissonArrival, Rate: 1},
+		Duration: Distribution{Kind: UniformDistribution, Min: 2, Max: 1}}
+	assert.EqualError(t, gen.Validate(),
+		"invalid duration distribution of generator web: max must not be less than min")
+
+	gen = Generator{Name: "web", Count: 1, Arrival: Arrival{Process: PoissonArrival, Rate: 1},
+		CPU: Distribution{Kind: "pareto"}}
+	assert.EqualError(t, gen.Validate(),
+		`invalid cpu distribution of generator web: distribution "pareto" is not supported`)
+}
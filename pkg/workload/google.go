@@ -0,0 +1,219 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workload
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+
+	"simulator/pkg/logfile"
+	"simulator/pkg/util"
+)
+
+// Columns and event types of the task_events table of the Google cluster-usage trace.
+const (
+	googleTimestamp = iota
+	googleMissingInfo
+	googleJobID
+	googleTaskIndex
+	googleMachineID
+	googleEventType
+	googleUser
+	googleSchedulingClass
+	googlePriority
+	googleCPURequest
+	googleMemoryRequest
+	googleDiskRequest
+	googleDifferentMachines
+	googleColumns
+)
+
+const (
+	googleSubmit = iota
+	googleSchedule
+	googleEvict
+	googleFail
+	googleFinish
+	googleKill
+	googleLost
+)
+
+// googleTask is the lifecycle of a task in the Google trace, in microseconds.
+type googleTask struct {
+	job, index  string
+	priority    int32
+	cpu, memory float64
+
+	submit, schedule, end       int64
+	submitted, scheduled, ended bool
+}
+
+// ReadGoogleTrace reads the task_events CSV file (optionally compressed, e.g., the original
+// part-*.csv.gz) at the path.
+// Each task scheduled and then finished, failed, evicted, killed, or lost becomes a pod
+// "google-<job ID>-<task index>", submitted at its first submission and running between its first
+// scheduling and the end.
+// The other tasks are ignored. A task resubmitted after the end runs only for the first time.
+func ReadGoogleTrace(path string, opts Options) ([]Pod, error) {
+	file, err := logfile.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tasks := map[string]*googleTask{}
+	order := []*googleTask{}
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = googleColumns
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, strongerrors.InvalidArgument(errors.Wrapf(err, "invalid task event in %s", path))
+		}
+
+		ts, err1 := strconv.ParseInt(record[googleTimestamp], 10, 64)
+		eventType, err2 := strconv.Atoi(record[googleEventType])
+		if err1 != nil || err2 != nil {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("invalid task event at line %d of %s", line, path))
+		}
+
+		key := record[googleJobID] + "-" + record[googleTaskIndex]
+		task, ok := tasks[key]
+		if !ok {
+			task = &googleTask{job: record[googleJobID], index: record[googleTaskIndex]}
+			tasks[key] = task
+			order = append(order, task)
+		}
+		if task.ended {
+			continue
+		}
+
+		switch eventType {
+		case googleSubmit:
+			if !task.submitted {
+				task.submit = ts
+				task.submitted = true
+				if prio, err := strconv.ParseInt(record[googlePriority], 10, 32); err == nil {
+					task.priority = int32(prio)
+				}
+				// Requests may be missing.
+				task.cpu, _ = strconv.ParseFloat(record[googleCPURequest], 64)
+				task.memory, _ = strconv.ParseFloat(record[googleMemoryRequest], 64)
+			}
+		case googleSchedule:
+			if !task.scheduled {
+				task.schedule = ts
+				task.scheduled = true
+			}
+		case googleEvict, googleFail, googleFinish, googleKill, googleLost:
+			if task.scheduled {
+				task.end = ts
+				task.ended = true
+			}
+		}
+	}
+
+	pods := []Pod{}
+	for _, task := range order {
+		if !task.ended {
+			continue
+		}
+
+		prio := task.priority
+		secs := (task.end - task.schedule + int64(time.Second/time.Microsecond) - 1) /
+			int64(time.Second/time.Microsecond)
+		pods = append(pods, Pod{
+			SubmitAt: opts.Start.Add(time.Duration(task.submit) * time.Microsecond),
+			Pod: newPod(fmt.Sprintf("google-%s-%s", task.job, task.index), &prio,
+				task.cpu*opts.CPUScale, task.memory*opts.MemoryScale, secs),
+		})
+	}
+
+	sortPods(pods)
+	return pods, nil
+}
+
+// WriteGoogleTrace writes the workload to a task_events CSV file at the path.
+// Each pod becomes a task of its own job, whose ID is the index of the pod in the workload, with a
+// SUBMIT, a SCHEDULE, and a FINISH event at its submission, at its submission, and after its
+// execution.
+// Returns error if a pod has no valid "simSpec" annotation.
+func WriteGoogleTrace(path string, pods []Pod, opts Options) error {
+	records := [][]string{}
+	for i, p := range pods {
+		cores, memory, secs, err := podShape(p.Pod)
+		if err != nil {
+			return err
+		}
+
+		submit := p.SubmitAt.Sub(opts.Start) / time.Microsecond
+		end := submit + time.Duration(secs)*time.Second/time.Microsecond
+		for _, event := range []struct {
+			ts        time.Duration
+			eventType int
+		}{{submit, googleSubmit}, {submit, googleSchedule}, {end, googleFinish}} {
+			record := make([]string, googleColumns)
+			record[googleTimestamp] = strconv.FormatInt(int64(event.ts), 10)
+			record[googleJobID] = strconv.Itoa(i)
+			record[googleTaskIndex] = "0"
+			record[googleEventType] = strconv.Itoa(event.eventType)
+			record[googlePriority] = strconv.Itoa(int(util.PodPriority(p.Pod)))
+			record[googleCPURequest] = formatFloat(cores / opts.CPUScale)
+			record[googleMemoryRequest] = formatFloat(memory / opts.MemoryScale)
+			records = append(records, record)
+		}
+	}
+
+	// The events are ordered by the timestamps as in the original trace.
+	sort.SliceStable(records, func(i, j int) bool {
+		ti, _ := strconv.ParseInt(records[i][googleTimestamp], 10, 64)
+		tj, _ := strconv.ParseInt(records[j][googleTimestamp], 10, 64)
+		return ti < tj
+	})
+
+	return writeCSV(path, records)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// writeCSV writes the records to a CSV file at the path.
+func writeCSV(path string, records [][]string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(file)
+	if err := writer.WriteAll(records); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workload
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+
+	"simulator/pkg/logfile"
+	"simulator/pkg/util"
+)
+
+// jsonTask is a pod in the json format.
+type jsonTask struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	// SubmitSeconds is the submission clock in seconds since Options.Start.
+	SubmitSeconds int64 `json:"submitSeconds"`
+	// Requests are the resource requests of the pod (e.g., {"cpu": "500m", "memory": "1Gi"}).
+	Requests        v1.ResourceList `json:"requests"`
+	DurationSeconds int64           `json:"durationSeconds"`
+	Priority        *int32          `json:"priority,omitempty"`
+}
+
+// ReadJSONWorkload reads the JSON lines file (optionally compressed) at the path, each line of which
+// is a pod like
+//
+//	{"name": "job-0", "submitSeconds": 10, "requests": {"cpu": "2", "memory": "4Gi"},
+//	 "durationSeconds": 600, "priority": 100}
+//
+// submitted at submitSeconds after Options.Start and running for durationSeconds.
+// The namespace defaults to "default", and the priority is optional.
+func ReadJSONWorkload(path string, opts Options) ([]Pod, error) {
+	file, err := logfile.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	pods := []Pod{}
+	dec := json.NewDecoder(file)
+	for {
+		var task jsonTask
+		if err := dec.Decode(&task); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("invalid task %d in %s: %s", len(pods), path, err.Error()))
+		}
+		if task.Name == "" || task.SubmitSeconds < 0 || task.DurationSeconds < 0 {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("invalid task %d in %s", len(pods), path))
+		}
+
+		cpu := task.Requests[v1.ResourceCPU]
+		memory := task.Requests[v1.ResourceMemory]
+		p := newPod(task.Name, task.Priority,
+			float64(cpu.MilliValue())/1000, float64(memory.Value()), task.DurationSeconds)
+		if task.Namespace != "" {
+			p.Namespace = task.Namespace
+		}
+		// Keep the other resources, such as GPUs, in the requests.
+		for rsrc, q := range task.Requests {
+			p.Spec.Containers[0].Resources.Requests[rsrc] = q
+		}
+
+		pods = append(pods, Pod{
+			SubmitAt: opts.Start.Add(time.Duration(task.SubmitSeconds) * time.Second),
+			Pod:      p,
+		})
+	}
+
+	sortPods(pods)
+	return pods, nil
+}
+
+// WriteJSONWorkload writes the workload to a JSON lines file at the path, in the format read by
+// ReadJSONWorkload.
+// Returns error if a pod has no valid "simSpec" annotation.
+func WriteJSONWorkload(path string, pods []Pod, opts Options) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(file)
+	for _, p := range pods {
+		_, _, secs, err := podShape(p.Pod)
+		if err != nil {
+			file.Close()
+			return err
+		}
+
+		task := jsonTask{
+			Name:            p.Pod.Name,
+			SubmitSeconds:   seconds(opts.Start, p.SubmitAt),
+			Requests:        util.PodTotalResourceRequests(p.Pod),
+			DurationSeconds: secs,
+			Priority:        p.Pod.Spec.Priority,
+		}
+		if p.Pod.Namespace != "default" {
+			task.Namespace = p.Pod.Namespace
+		}
+		if err := enc.Encode(&task); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workload
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	"simulator/pkg/clock"
+)
+
+// SubmitTimeAnnotation is the annotation key of a pod manifest that specifies the clock at which the
+// pod is submitted, in RFC3339 format.
+const SubmitTimeAnnotation = "simulator/submit-time"
+
+// ReadManifests reads the pod manifests in the YAML (.yaml or .yml) or JSON (.json) files in the
+// directory at the path, one pod per file.
+// A pod is submitted at its SubmitTimeAnnotation, or at Options.Start if not annotated; the pods
+// submitted at the same clock are ordered by the file names.
+func ReadManifests(path string, opts Options) ([]Pod, error) {
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pods := []Pod{}
+	for _, file := range files { // sorted by names
+		ext := strings.ToLower(filepath.Ext(file.Name()))
+		if file.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+
+		filePath := filepath.Join(path, file.Name())
+		data, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		pod := &v1.Pod{}
+		if err := yaml.UnmarshalStrict(data, pod); err != nil {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("invalid pod manifest %s: %s", filePath, err.Error()))
+		}
+		if pod.Namespace == "" {
+			pod.Namespace = "default"
+		}
+
+		submitAt := opts.Start
+		if at, ok := pod.Annotations[SubmitTimeAnnotation]; ok {
+			t, err := time.Parse(time.RFC3339, at)
+			if err != nil {
+				return nil, strongerrors.InvalidArgument(
+					errors.Errorf("invalid %s of %s: %s", SubmitTimeAnnotation, filePath, err.Error()))
+			}
+			submitAt = clock.NewClock(t)
+			delete(pod.Annotations, SubmitTimeAnnotation)
+		}
+
+		pods = append(pods, Pod{SubmitAt: submitAt, Pod: pod})
+	}
+
+	sortPods(pods)
+	return pods, nil
+}
+
+// WriteManifests writes the pods to YAML files "<index>_<namespace>_<name>.yaml" in the directory
+// at the path, annotated with their submission clocks (see SubmitTimeAnnotation).
+// The directory is created if it does not exist.
+func WriteManifests(path string, pods []Pod, opts Options) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+
+	// The file names are prefixed with the order of the pods, so that the pods submitted at the
+	// same clock are read in the same order.
+	width := len(strconv.Itoa(len(pods)))
+	for i, p := range pods {
+		pod := p.Pod.DeepCopy()
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[SubmitTimeAnnotation] = p.SubmitAt.ToRFC3339()
+
+		data, err := yaml.Marshal(pod)
+		if err != nil {
+			return err
+		}
+
+		name := fmt.Sprintf("%0*d_%s_%s.yaml", width, i, pod.Namespace, pod.Name)
+		if err := ioutil.WriteFile(filepath.Join(path, name), data, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workload
+
+import (
+	"context"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	"k8s.io/kubernetes/pkg/scheduler/algorithm"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/metrics"
+	"simulator/pkg/submitter"
+)
+
+// Submitter is a submitter.Submitter that submits the pods of a workload at their submission
+// clocks, and terminates after the last one.
+type Submitter struct {
+	pods []Pod
+}
+
+// NewSubmitter creates a new Submitter of the pods, sorted by the submission clocks.
+func NewSubmitter(pods []Pod) *Submitter {
+	sorted := make([]Pod, len(pods))
+	copy(sorted, pods)
+	sortPods(sorted)
+
+	return &Submitter{pods: sorted}
+}
+
+// NewSubmitterFromFile creates a new Submitter of the workload at the path in the format.
+// Returns error if the format is not supported or failed to read the workload.
+func NewSubmitterFromFile(format, path string, opts Options) (*Submitter, error) {
+	reader, ok := Formats[format]
+	if !ok {
+		return nil, strongerrors.InvalidArgument(errors.Errorf("format %q is not supported", format))
+	}
+
+	pods, err := reader.Read(path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSubmitter(pods), nil
+}
+
+// SkipUntil drops the pods submitted at or before the clock, which have been consumed by a
+// simulation resumed from a checkpoint (see kubesim.Checkpoint.ConsumedUntil).
+func (s *Submitter) SkipUntil(clock clock.Clock) {
+	for len(s.pods) > 0 && !clock.Before(s.pods[0].SubmitAt) {
+		s.pods = s.pods[1:]
+	}
+}
+
+// Submit implements submitter.Submitter interface.
+func (s *Submitter) Submit(
+	_ context.Context, clock clock.Clock, nodeLister algorithm.NodeLister, met metrics.Metrics,
+) ([]submitter.Event, error) {
+
+	events := []submitter.Event{}
+	for len(s.pods) > 0 && !clock.Before(s.pods[0].SubmitAt) {
+		events = append(events, &submitter.SubmitEvent{Pod: s.pods[0].Pod.DeepCopy()})
+		s.pods = s.pods[1:]
+	}
+
+	if len(s.pods) == 0 {
+		events = append(events, &submitter.TerminateSubmitterEvent{})
+	}
+
+	return events, nil
+}
+
+// NextWakeup implements submitter.Waker interface.
+// Returns the submission clock of the next pod.
+func (s *Submitter) NextWakeup(clock clock.Clock) (clock.Clock, bool) {
+	if len(s.pods) == 0 {
+		return clock, false
+	}
+	return s.pods[0].SubmitAt, true
+}
+
+var _ = submitter.Submitter(&Submitter{})
+var _ = submitter.Waker(&Submitter{})
@@ -0,0 +1,245 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package workload reads and writes workloads, i.e., pods and the clocks at which they are
+// submitted, in the following formats, so that a workload prepared for one submitter can be reused
+// elsewhere.
+//
+//	google:    task_events of the Google cluster-usage trace (clusterdata-2011-2), a CSV file
+//	alibaba:   batch_task of the Alibaba cluster trace (cluster-trace-v2018), a CSV file
+//	manifests: a directory of pod manifests, one pod per YAML or JSON file
+//	json:      a JSON lines file of pods with their submission clocks, requests, and durations
+//	trace:     a trace of the submissions (see package trace), replayable by kubesim run
+//
+// Only the submissions are converted; the resource usage of each pod is its resource request
+// during its execution, which is declared in the "simSpec" annotation.
+// A workload in any format can also be submitted to a simulation directly by Submitter, and a
+// synthetic workload can be generated by Generator.
+package workload
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/logfile"
+	"simulator/pkg/pod"
+	"simulator/pkg/trace"
+	"simulator/pkg/util"
+)
+
+// Pod is a pod of a workload and the clock at which it is submitted.
+type Pod struct {
+	SubmitAt clock.Clock
+	Pod      *v1.Pod
+}
+
+// Options are the options of reading and writing workloads.
+type Options struct {
+	// Start is the clock of time 0 in the google, alibaba, and json formats, and the submission clock of
+	// the manifests without the SubmitTimeAnnotation.
+	Start clock.Clock
+	// CPUScale is the number of cores of the normalized CPU request 1.0 in the google format.
+	CPUScale float64
+	// MemoryScale is the bytes of the normalized memory request 1.0 in the google format, and of
+	// plan_mem 100 in the alibaba format.
+	MemoryScale float64
+}
+
+// Format is a format of workloads.
+type Format struct {
+	// Read reads the workload at the path, sorted by the submission clocks.
+	Read func(path string, opts Options) ([]Pod, error)
+	// Write writes the workload to the path.
+	Write func(path string, pods []Pod, opts Options) error
+}
+
+// Formats maps the name of each supported format to the Format.
+var Formats = map[string]Format{
+	"google":    {Read: ReadGoogleTrace, Write: WriteGoogleTrace},
+	"alibaba":   {Read: ReadAlibabaTrace, Write: WriteAlibabaTrace},
+	"manifests": {Read: ReadManifests, Write: WriteManifests},
+	"json":      {Read: ReadJSONWorkload, Write: WriteJSONWorkload},
+	"trace":     {Read: ReadTrace, Write: WriteTrace},
+}
+
+// FormatNames returns the sorted names of the supported formats.
+func FormatNames() []string {
+	names := make([]string, 0, len(Formats))
+	for name := range Formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Convert reads the workload at the path src in the format from, and writes it to the path dst in
+// the format to.
+// Returns the number of converted pods, or error if a format is not supported or failed to convert.
+func Convert(from, src, to, dst string, opts Options) (int, error) {
+	reader, ok := Formats[from]
+	if !ok {
+		return 0, strongerrors.InvalidArgument(errors.Errorf("format %q is not supported", from))
+	}
+	writer, ok := Formats[to]
+	if !ok {
+		return 0, strongerrors.InvalidArgument(errors.Errorf("format %q is not supported", to))
+	}
+
+	pods, err := reader.Read(src, opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := writer.Write(dst, pods, opts); err != nil {
+		return 0, err
+	}
+
+	return len(pods), nil
+}
+
+// workloadSource is the submitter name of the traces written by WriteTrace.
+const workloadSource = "Workload"
+
+// ReadTrace reads the submissions in the trace at the path.
+func ReadTrace(path string, opts Options) ([]Pod, error) {
+	entries, err := trace.ReadTrace(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pods := []Pod{}
+	for _, entry := range entries {
+		if entry.Kind != trace.Submit {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, entry.Clock)
+		if err != nil {
+			return nil, strongerrors.InvalidArgument(
+				errors.Errorf("invalid clock of trace entry %q: %s", entry.Clock, err.Error()))
+		}
+		pods = append(pods, Pod{SubmitAt: clock.NewClock(t), Pod: entry.Pod})
+	}
+
+	sortPods(pods)
+	return pods, nil
+}
+
+// WriteTrace writes the workload to a trace at the path, as submitted by one submitter that
+// terminates after the last submission.
+func WriteTrace(path string, pods []Pod, opts Options) error {
+	rec, err := trace.NewRecorder(path, logfile.Options{})
+	if err != nil {
+		return err
+	}
+
+	entries := make([]trace.Entry, 0, len(pods)+1)
+	last := opts.Start
+	for _, p := range pods {
+		entries = append(entries, trace.Entry{
+			Clock:  p.SubmitAt.ToRFC3339(),
+			Kind:   trace.Submit,
+			Source: workloadSource,
+			Pod:    p.Pod,
+		})
+		if last.Before(p.SubmitAt) {
+			last = p.SubmitAt
+		}
+	}
+	entries = append(entries, trace.Entry{
+		Clock:  last.ToRFC3339(),
+		Kind:   trace.TerminateSubmitter,
+		Source: workloadSource,
+	})
+
+	if err := rec.RecordEntries(entries); err != nil {
+		rec.Close()
+		return err
+	}
+	return rec.Close()
+}
+
+// sortPods sorts the pods by the submission clocks, keeping the order of pods submitted at the same
+// clock.
+func sortPods(pods []Pod) {
+	sort.SliceStable(pods, func(i, j int) bool {
+		return pods[i].SubmitAt.Before(pods[j].SubmitAt)
+	})
+}
+
+// newPod creates a pod requesting the cores and bytes of memory, running for the seconds.
+func newPod(name string, priority *int32, cores, memory float64, seconds int64) *v1.Pod {
+	requests := v1.ResourceList{}
+	if cores > 0 {
+		requests[v1.ResourceCPU] = *resource.NewMilliQuantity(int64(math.Round(cores*1000)), resource.DecimalSI)
+	}
+	if memory > 0 {
+		requests[v1.ResourceMemory] = *resource.NewQuantity(int64(math.Round(memory)), resource.BinarySI)
+	}
+
+	simSpec := fmt.Sprintf("- seconds: %d\n  resourceUsage:\n", seconds)
+	for _, rsrc := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+		q, ok := requests[rsrc]
+		if !ok {
+			q = resource.MustParse("0")
+		}
+		simSpec += fmt.Sprintf("    %s: %s\n", rsrc, q.String())
+	}
+
+	return &v1.Pod{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "default",
+			Annotations: map[string]string{"simSpec": simSpec},
+		},
+		Spec: v1.PodSpec{
+			Priority: priority,
+			Containers: []v1.Container{{
+				Name:      "container",
+				Image:     "container",
+				Resources: v1.ResourceRequirements{Requests: requests},
+			}},
+		},
+	}
+}
+
+// podShape returns the cores and bytes of memory requested by the pod, and its execution seconds.
+// Returns error if the pod has no valid "simSpec" annotation.
+func podShape(p *v1.Pod) (float64, float64, int64, error) {
+	dur, err := pod.ExecutionDuration(p)
+	if err != nil {
+		return 0, 0, 0, errors.Wrapf(err, "error reading pod %s/%s", p.Namespace, p.Name)
+	}
+
+	requests := util.PodTotalResourceRequests(p)
+	cpu := requests[v1.ResourceCPU]
+	memory := requests[v1.ResourceMemory]
+
+	return float64(cpu.MilliValue()) / 1000, float64(memory.Value()), int64(dur / time.Second), nil
+}
+
+// seconds returns the seconds between the start and the clock.
+func seconds(start, clk clock.Clock) int64 {
+	return int64(clk.Sub(start) / time.Second)
+}
@@ -0,0 +1,207 @@
+// Copyright 2019 Preferred Networks, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workload
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"simulator/pkg/clock"
+	"simulator/pkg/submitter"
+)
+
+var testOpts = Options{
+	Start:       clock.NewClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)),
+	CPUScale:    32,
+	MemoryScale: 64 << 30,
+}
+
+type shape struct {
+	name        string
+	submitAt    time.Duration
+	cores       float64
+	memory      float64
+	seconds     int64
+	prioritySet bool
+}
+
+func shapes(t *testing.T, pods []Pod) []shape {
+	shapes := []shape{}
+	for _, p := range pods {
+		cores, memory, secs, err := podShape(p.Pod)
+		assert.NoError(t, err)
+		shapes = append(shapes, shape{
+			name:        p.Pod.Name,
+			submitAt:    p.SubmitAt.Sub(testOpts.Start),
+			cores:       cores,
+			memory:      memory,
+			seconds:     secs,
+			prioritySet: p.Pod.Spec.Priority != nil,
+		})
+	}
+	return shapes
+}
+
+func tempFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestReadGoogleTrace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "workload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := tempFile(t, dir, "task_events.csv", `0,,1,0,,0,u,0,2,0.125,0.25,0,
+2000000,,1,1,,0,u,0,2,0.0625,,0,
+3000000,,1,0,,1,m,0,2,0.125,0.25,0,
+5000000,,2,0,,0,u,1,9,0.5,0.5,0,
+63500000,,1,0,,4,m,0,2,0.125,0.25,0,
+70000000,,1,0,,0,u,0,2,0.125,0.25,0,
+`)
+
+	pods, err := ReadGoogleTrace(path, testOpts)
+	assert.NoError(t, err)
+	// Task 1-1 and job 2 are never scheduled; the resubmission of task 1-0 after the end is ignored.
+	assert.Equal(t, []shape{
+		{name: "google-1-0", cores: 4, memory: 16 << 30, seconds: 61, prioritySet: true},
+	}, shapes(t, pods))
+	assert.Equal(t, int32(2), *pods[0].Pod.Spec.Priority)
+}
+
+func TestReadAlibabaTrace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "workload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := tempFile(t, dir, "batch_task.csv", `M1,2,j_1,1,Terminated,100,160,50,25
+R2_1,1,j_1,1,Failed,100,200,100,1
+M1,1,j_2,1,Terminated,90,100,200,
+`)
+
+	pods, err := ReadAlibabaTrace(path, testOpts)
+	assert.NoError(t, err)
+	assert.Equal(t, []shape{
+		{name: "alibaba-j-2-m1-0", submitAt: 90 * time.Second, cores: 2, seconds: 10},
+		{name: "alibaba-j-1-m1-0", submitAt: 100 * time.Second, cores: 0.5, memory: 16 << 30, seconds: 60},
+		{name: "alibaba-j-1-m1-1", submitAt: 100 * time.Second, cores: 0.5, memory: 16 << 30, seconds: 60},
+	}, shapes(t, pods))
+}
+
+func TestReadJSONWorkload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "workload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := tempFile(t, dir, "workload.jsonl", `{"name": "b", "submitSeconds": 30, "requests": {"cpu": "500m", "memory": "1Gi"}, "durationSeconds": 60, "priority": 10}
+{"name": "a", "namespace": "batch", "submitSeconds": 10, "requests": {"cpu": "2", "nvidia.com/gpu": "1"}, "durationSeconds": 5}
+`)
+	pods, err := ReadJSONWorkload(path, testOpts)
+	assert.NoError(t, err)
+	assert.Equal(t, []shape{
+		{name: "a", submitAt: 10 * time.Second, cores: 2, seconds: 5},
+		{name: "b", submitAt: 30 * time.Second, cores: 0.5, memory: 1 << 30, seconds: 60, prioritySet: true},
+	}, shapes(t, pods))
+	assert.Equal(t, "batch", pods[0].Pod.Namespace)
+	gpu := pods[0].Pod.Spec.Containers[0].Resources.Requests["nvidia.com/gpu"]
+	assert.Equal(t, "1", gpu.String())
+	assert.Equal(t, int32(10), *pods[1].Pod.Spec.Priority)
+
+	path = tempFile(t, dir, "invalid.jsonl", `{"name": "a", "submitSeconds": -1}`)
+	_, err = ReadJSONWorkload(path, testOpts)
+	assert.EqualError(t, err, "invalid task 0 in "+path)
+}
+
+func TestSubmitter(t *testing.T) {
+	pods := []Pod{
+		{SubmitAt: testOpts.Start.Add(20 * time.Second), Pod: newPod("b", nil, 1, 0, 10)},
+		{SubmitAt: testOpts.Start.Add(10 * time.Second), Pod: newPod("a", nil, 1, 0, 10)},
+		{SubmitAt: testOpts.Start.Add(20 * time.Second), Pod: newPod("c", nil, 1, 0, 10)},
+	}
+	sub := NewSubmitter(pods)
+
+	submitted := func(clk clock.Clock) []string {
+		events, err := sub.Submit(context.Background(), clk, nil, nil)
+		assert.NoError(t, err)
+		names := []string{}
+		for _, ev := range events {
+			switch ev := ev.(type) {
+			case *submitter.SubmitEvent:
+				names = append(names, ev.Pod.Name)
+			case *submitter.TerminateSubmitterEvent:
+				names = append(names, "terminate")
+			}
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{}, submitted(testOpts.Start))
+	assert.Equal(t, []string{"a"}, submitted(testOpts.Start.Add(15*time.Second)))
+	assert.Equal(t, []string{"b", "c", "terminate"}, submitted(testOpts.Start.Add(20*time.Second)))
+
+	sub = NewSubmitter(pods)
+	sub.SkipUntil(testOpts.Start.Add(10 * time.Second))
+	assert.Equal(t, []string{"b", "c", "terminate"}, submitted(testOpts.Start.Add(30*time.Second)))
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "workload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src := tempFile(t, dir, "batch_task.csv", `M1,2,j_1,1,Terminated,100,160,50,25
+M1,1,j_2,1,Terminated,30,100,200,50
+`)
+	expected, err := ReadAlibabaTrace(src, testOpts)
+	assert.NoError(t, err)
+
+	steps := []struct{ format, path string }{
+		{"trace", "trace.jsonl"},
+		{"manifests", "manifests"},
+		{"json", "workload.jsonl"},
+		{"google", "task_events.csv"},
+		{"alibaba", "batch_task.csv"},
+	}
+	from, prev := "alibaba", src
+	for _, step := range steps {
+		dst := filepath.Join(dir, "out-"+step.path)
+		n, err := Convert(from, prev, step.format, dst, testOpts)
+		assert.NoError(t, err, step.format)
+		assert.Equal(t, len(expected), n, step.format)
+
+		pods, err := Formats[step.format].Read(dst, testOpts)
+		assert.NoError(t, err, step.format)
+		actual := shapes(t, pods)
+		for i, s := range shapes(t, expected) {
+			// The google and alibaba formats name the pods by their own IDs.
+			assert.Equal(t, s.submitAt, actual[i].submitAt, step.format)
+			assert.Equal(t, s.cores, actual[i].cores, step.format)
+			assert.InDelta(t, s.memory, actual[i].memory, 1, step.format)
+			assert.Equal(t, s.seconds, actual[i].seconds, step.format)
+		}
+
+		from, prev = step.format, dst
+	}
+
+	_, err = Convert("unknown", src, "trace", filepath.Join(dir, "x"), testOpts)
+	assert.EqualError(t, err, `format "unknown" is not supported`)
+}
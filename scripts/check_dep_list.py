@@ -82,13 +82,13 @@ def deps_gopkg():
     import toml
 
     """
-    Parses `Gopkg.toml` and returns a list of dependencies.
+    Parses `Gopkg.toml` and returns a list of dependencies, including overridden ones.
     """
 
     dep_names = []
     with (PROJECT_ROOT / GOPKG_PATH).open() as f:
         deps = toml.load(f)
-        for c in deps["constraint"]:
+        for c in deps["constraint"] + deps.get("override", []):
             dep_names.append(c["name"])
 
     return dep_names